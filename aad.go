@@ -0,0 +1,48 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+
+	"github.com/Azure/azure-amqp-common-go/aad"
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// NamespaceWithAzureActiveDirectory configures a namespace to authorize its connections with Azure Active Directory
+// tokens acquired by the provided service principal token, which must be issued for the https://servicebus.azure.net/
+// resource. Any adal token source may be used, such as a managed identity or a federated workload identity. The token
+// is refreshed once it expires.
+func NamespaceWithAzureActiveDirectory(token *adal.ServicePrincipalToken) NamespaceOption {
+	return func(ns *Namespace) error {
+		if token == nil {
+			return errors.New("service principal token must not be nil")
+		}
+		provider, err := aad.NewJWTProvider(aad.JWTProviderWithAADToken(token))
+		if err != nil {
+			return err
+		}
+		ns.TokenProvider = provider
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// abandonWindow is the number of recent outcomes the abandon rate is measured over
+	abandonWindow = 20
+	// abandonMinSamples is the number of outcomes needed before the abandon rate is trusted
+	abandonMinSamples = 5
+	// abandonMinDelay is the pause the throttle starts from once the abandon rate exceeds the threshold
+	abandonMinDelay = 50 * time.Millisecond
+)
+
+type (
+	// abandonThrottle slows down receiving while a large share of recent messages are abandoned, doubling its pause
+	// after each message while the abandon rate is above the threshold and halving it as the rate recovers
+	abandonThrottle struct {
+		mu        sync.Mutex
+		threshold float64
+		maxDelay  time.Duration
+		outcomes  [abandonWindow]bool
+		count     int
+		next      int
+		abandoned int
+		delay     time.Duration
+	}
+)
+
+// ReceiveWithAbandonThrottle configures a receive operation to slow down when more than threshold, a fraction between 0
+// and 1, of the last 20 messages handled were abandoned, as happens when a downstream dependency is unavailable and
+// every message fails. Released and deferred messages are not counted as failures. Rather than taking the redelivered
+// messages as fast as the broker can offer them, the receiver pauses after settling each message, doubling the pause
+// up to maxDelay while the abandon rate stays above the threshold. Once messages succeed again, the pause is halved
+// with each message until the receiver is back at full speed. Only PeekLock messages are throttled. Messages
+// prefetched beyond the one being handled keep their locks while the receiver pauses, so a low prefetch count is
+// advisable.
+func ReceiveWithAbandonThrottle(threshold float64, maxDelay time.Duration) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if threshold <= 0 || threshold >= 1 {
+			return errors.New("ReceiveWithAbandonThrottle: threshold must be between 0 and 1")
+		}
+		if maxDelay <= 0 {
+			return errors.New("ReceiveWithAbandonThrottle: max delay must be greater than zero")
+		}
+		o.abandonThrottle = &abandonThrottle{threshold: threshold, maxDelay: maxDelay}
+		return nil
+	}
+}
+
+// throttled wraps the handler so that receiving pauses after each message while the abandon rate is too high
+func (o *receiveOptions) throttled(ns *Namespace, handler Handler) Handler {
+	if o.abandonThrottle == nil {
+		return handler
+	}
+	return HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		action := handler.Handle(ctx, msg)
+		if action == nil {
+			action = msg.Complete()
+		}
+		return func(ctx context.Context) {
+			action(ctx)
+
+			delay := o.abandonThrottle.record(msg.settledAs.failed())
+			if delay <= 0 {
+				return
+			}
+			log.For(ctx).Debug(fmt.Sprintf("abandon rate above threshold, pausing receiving for %v", delay))
+			_ = ns.sleep(ctx, delay)
+		}
+	})
+}
+
+// record adds the outcome of a message to the window and returns how long to pause before the next message
+func (at *abandonThrottle) record(abandoned bool) time.Duration {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if at.count == abandonWindow {
+		if at.outcomes[at.next] {
+			at.abandoned--
+		}
+	} else {
+		at.count++
+	}
+	at.outcomes[at.next] = abandoned
+	at.next = (at.next + 1) % abandonWindow
+	if abandoned {
+		at.abandoned++
+	}
+
+	if at.count >= abandonMinSamples && float64(at.abandoned)/float64(at.count) > at.threshold {
+		at.delay *= 2
+		if at.delay < abandonMinDelay {
+			at.delay = abandonMinDelay
+		}
+		if at.delay > at.maxDelay {
+			at.delay = at.maxDelay
+		}
+		return at.delay
+	}
+
+	at.delay /= 2
+	if at.delay < abandonMinDelay {
+		at.delay = 0
+	}
+	return at.delay
+}
@@ -0,0 +1,84 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbandonThrottle_Record(t *testing.T) {
+	at := &abandonThrottle{threshold: 0.5, maxDelay: 300 * time.Millisecond}
+
+	for i := 0; i < abandonMinSamples-1; i++ {
+		assert.Zero(t, at.record(true), "too few samples to judge the abandon rate")
+	}
+	assert.Equal(t, 50*time.Millisecond, at.record(true))
+	assert.Equal(t, 100*time.Millisecond, at.record(true))
+	assert.Equal(t, 200*time.Millisecond, at.record(true))
+	assert.Equal(t, 300*time.Millisecond, at.record(true), "the pause is capped at the max delay")
+
+	// 8 of 8 abandoned; it takes 8 successes to bring the rate down to the threshold
+	for i := 0; i < 7; i++ {
+		assert.Equal(t, 300*time.Millisecond, at.record(false))
+	}
+	assert.Equal(t, 150*time.Millisecond, at.record(false))
+	assert.Equal(t, 75*time.Millisecond, at.record(false))
+	assert.Zero(t, at.record(false), "pauses shorter than the minimum are dropped")
+}
+
+func TestAbandonThrottle_Window(t *testing.T) {
+	at := &abandonThrottle{threshold: 0.5, maxDelay: time.Second}
+	for i := 0; i < abandonWindow; i++ {
+		at.record(false)
+	}
+	for i := 0; i < abandonWindow/2; i++ {
+		assert.Zero(t, at.record(true), "old successes hold the rate at or below the threshold")
+	}
+	assert.Equal(t, abandonMinDelay, at.record(true), "successes older than the window are forgotten")
+	assert.Equal(t, abandonWindow, at.count)
+}
+
+func TestReceiveWithAbandonThrottle(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+	options, err := newReceiveOptions(ReceiveWithAbandonThrottle(0.1, time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handler := options.wrap(ns, HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		return func(context.Context) {
+			msg.settledAs = OutcomeAbandoned
+		}
+	}))
+	for i := 0; i < abandonMinSamples-1; i++ {
+		handler.Handle(context.Background(), NewMessageFromString("failing"))(context.Background())
+	}
+	assert.Equal(t, 0, clock.pending())
+
+	done := make(chan struct{})
+	go func() {
+		handler.Handle(context.Background(), NewMessageFromString("failing"))(context.Background())
+		close(done)
+	}()
+	clock.waitForCalls(1)
+	select {
+	case <-done:
+		t.Fatal("the disposition should pause once the abandon rate exceeds the threshold")
+	default:
+	}
+	clock.Advance(abandonMinDelay)
+	<-done
+
+	for _, threshold := range []float64{0, 1} {
+		_, err = newReceiveOptions(ReceiveWithAbandonThrottle(threshold, time.Minute))
+		assert.Error(t, err)
+	}
+	_, err = newReceiveOptions(ReceiveWithAbandonThrottle(0.5, 0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,525 @@
+package atom
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	// ServiceBusSchema is the XML namespace of Service Bus entity descriptions
+	ServiceBusSchema = "http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"
+	// Schema is the XML namespace of Atom feeds and entries
+	Schema = "http://www.w3.org/2005/Atom"
+	// ApplicationXML is the content type of the body of an Atom entry
+	ApplicationXML = "application/xml"
+
+	// ClientRequestIDHeader is the header carrying the ID the client gives each management request, which is recorded
+	// on the request's span and in the errors it returns so failures can be matched with the service's logs
+	ClientRequestIDHeader = "x-ms-client-request-id"
+
+	apiVersion   = "2017-04"
+	requestIDTag = "http.request_id"
+)
+
+type (
+	// EntityManager provides authenticated access to the Service Bus ATOM management API. It can be used to call
+	// management operations which are not yet wrapped by the servicebus package.
+	EntityManager struct {
+		TokenProvider auth.TokenProvider
+		Host          string
+		// StartSpan, if not nil, starts the spans tracing management requests in place of the global opentracing
+		// tracer
+		StartSpan func(ctx context.Context, operationName string) (Span, context.Context)
+		// Retry, if not nil, is called with the number of the failed attempt when a request fails to reach the
+		// service, is throttled or is answered with a server error. It waits before the request is sent again and
+		// reports whether it should be; returning false hands the failed attempt back to the caller. Only requests
+		// which can be repeated without changing their effect are retried after a server error or a lost response:
+		// GET, HEAD, DELETE and a PUT with an If-Match header. Any request throttled with 429 Too Many Requests is
+		// retried, as the service did not act on it.
+		Retry func(ctx context.Context, attempt int, res *http.Response, err error) bool
+	}
+
+	// Span is a management request traced by StartSpan. It has the method set of servicebus.Span.
+	Span interface {
+		// SetAttribute records a key and value describing the request
+		SetAttribute(key string, value interface{})
+		// End completes the span
+		End()
+	}
+
+	openTracingSpan struct {
+		span opentracing.Span
+	}
+
+	// ManagementError is the error body returned by the Service Bus management API. Errors built from a response by
+	// NewManagementError also carry its status code and the client request ID it was sent with.
+	ManagementError struct {
+		XMLName    xml.Name `xml:"Error"`
+		Code       int      `xml:"Code"`
+		Detail     string   `xml:"Detail"`
+		StatusCode int      `xml:"-"`
+		RequestID  string   `xml:"-"`
+	}
+
+	// ServerBusyError is returned when the management API throttles a request with 429 Too Many Requests or
+	// 503 Service Unavailable. RetryAfter reports how long the service asked callers to wait, if it said.
+	ServerBusyError struct {
+		StatusCode int
+		Detail     string
+		RequestID  string
+		retryAfter time.Duration
+	}
+
+	// RequestOption modifies a management request before it is sent, for example to add a header
+	RequestOption func(req *http.Request)
+)
+
+// NewEntityManager creates a new instance of an EntityManager given a host (https://{namespace}.servicebus.windows.net/)
+// and a token provider
+func NewEntityManager(host string, tokenProvider auth.TokenProvider) *EntityManager {
+	return &EntityManager{
+		Host:          host,
+		TokenProvider: tokenProvider,
+	}
+}
+
+// Get performs an HTTP Get for a given entity path
+func (em *EntityManager) Get(ctx context.Context, entityPath string) (*http.Response, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Get")
+	defer span.End()
+
+	return em.Execute(ctx, http.MethodGet, entityPath, http.NoBody)
+}
+
+// Put performs an HTTP PUT for a given entity path and body
+func (em *EntityManager) Put(ctx context.Context, entityPath string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Put")
+	defer span.End()
+
+	return em.Execute(ctx, http.MethodPut, entityPath, bytes.NewReader(body), opts...)
+}
+
+// Delete performs an HTTP DELETE for a given entity path
+func (em *EntityManager) Delete(ctx context.Context, entityPath string) (*http.Response, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Delete")
+	defer span.End()
+
+	return em.Execute(ctx, http.MethodDelete, entityPath, http.NoBody)
+}
+
+// Post performs an HTTP POST for a given entity path and body
+func (em *EntityManager) Post(ctx context.Context, entityPath string, body []byte) (*http.Response, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Post")
+	defer span.End()
+
+	return em.Execute(ctx, http.MethodPost, entityPath, bytes.NewReader(body))
+}
+
+// Execute performs an HTTP request given a http method, path and body
+func (em *EntityManager) Execute(ctx context.Context, method string, entityPath string, body io.Reader, opts ...RequestOption) (*http.Response, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Execute")
+	defer span.End()
+
+	var payload []byte
+	if body != nil && body != http.NoBody && em.Retry != nil {
+		// the body is read up front so that it can be sent again should the request be retried
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+		payload = b
+		body = bytes.NewReader(payload)
+	}
+
+	repeatable := em.Retry != nil && idempotent(method, opts)
+	for attempt := 1; ; attempt++ {
+		res, err := em.execute(ctx, span, method, entityPath, body, opts...)
+		if em.Retry == nil || ctx.Err() != nil || !retryable(repeatable, res, err) || !em.Retry(ctx, attempt, res, err) {
+			return res, err
+		}
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+	}
+}
+
+// execute sends a single attempt of a management request
+func (em *EntityManager) execute(ctx context.Context, span Span, method string, entityPath string, body io.Reader, opts ...RequestOption) (*http.Response, error) {
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+	}
+	req, err := http.NewRequest(method, em.Host+strings.TrimPrefix(entityPath, "/"), body)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	req = addAtomXMLContentType(req)
+	req = addAPIVersion(req)
+	for _, opt := range opts {
+		opt(req)
+	}
+	if req.Header.Get(ClientRequestIDHeader) == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+		req.Header.Set(ClientRequestIDHeader, id.String())
+	}
+	applyRequestInfo(span, req)
+	req, err = em.addAuthorization(req)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	res, err := client.Do(req)
+
+	applyResponseInfo(span, res)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return res, err
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		err = newServerBusyError(res)
+		log.For(ctx).Error(err)
+	}
+	return res, err
+}
+
+// newServerBusyError reads the detail of a throttled response, leaving its body to be read again by the caller
+func newServerBusyError(res *http.Response) *ServerBusyError {
+	busy := &ServerBusyError{
+		StatusCode: res.StatusCode,
+		Detail:     http.StatusText(res.StatusCode),
+		RequestID:  requestID(res),
+		retryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+
+	if b, err := ioutil.ReadAll(res.Body); err == nil {
+		res.Body = ioutil.NopCloser(bytes.NewReader(b))
+		var mgmtError ManagementError
+		if xml.Unmarshal(b, &mgmtError) == nil && mgmtError.Detail != "" {
+			busy.Detail = mgmtError.Detail
+		}
+	}
+	return busy
+}
+
+// idempotent reports whether sending a request with the method and options more than once has the same effect as
+// sending it once. A PUT is only idempotent with an If-Match header; without one it creates the entity, and repeating
+// a creation which succeeded fails with 409 Conflict.
+func idempotent(method string, opts []RequestOption) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return true
+	case http.MethodPut:
+		req, err := http.NewRequest(method, "https://localhost/", nil)
+		if err != nil {
+			return false
+		}
+		for _, opt := range opts {
+			opt(req)
+		}
+		return req.Header.Get("If-Match") != ""
+	default:
+		return false
+	}
+}
+
+// retryable reports whether a management request which ended with res and err may succeed if it is sent again. A
+// throttled request was not acted on and can always be sent again. Requests which did not reach the service, timed out
+// or met a transient server error may have taken effect, so they are only sent again if they are idempotent.
+func retryable(idempotent bool, res *http.Response, err error) bool {
+	if res != nil && res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	if res == nil {
+		return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch res.StatusCode {
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// GetEntry fetches the Atom entry at the entity path. If the entity does not exist, nil is returned without an error.
+func (em *EntityManager) GetEntry(ctx context.Context, entityPath string) (*Entry, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.GetEntry")
+	defer span.End()
+
+	res, err := em.Get(ctx, entityPath)
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := xml.Unmarshal(b, &entry); err != nil {
+		var feed Feed
+		if feedErr := xml.Unmarshal(b, &feed); feedErr == nil && len(feed.Entries) == 0 {
+			// the service responds with an empty feed rather than a 404 for some missing entities
+			return nil, nil
+		}
+		return nil, NewManagementError(res, b)
+	}
+	return &entry, nil
+}
+
+// GetFeed fetches the Atom feed at the entity path, such as `$Resources/Queues` or `{topic}/subscriptions`
+func (em *EntityManager) GetFeed(ctx context.Context, entityPath string) (*Feed, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.GetFeed")
+	defer span.End()
+
+	res, err := em.Get(ctx, entityPath)
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed Feed
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		return nil, NewManagementError(res, b)
+	}
+	return &feed, nil
+}
+
+// PutEntry creates or updates the entity at the entity path with the description, which must be an XML serializable
+// entity description such as a QueueDescription, and returns the entry sent back by the service
+func (em *EntityManager) PutEntry(ctx context.Context, entityPath string, description interface{}) (*Entry, error) {
+	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.PutEntry")
+	defer span.End()
+
+	body, err := xml.Marshal(description)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBytes, err := xml.Marshal(&Entry{
+		AtomSchema: Schema,
+		Content: &Content{
+			Type: ApplicationXML,
+			Body: string(body),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := em.Put(ctx, entityPath, []byte(xml.Header+string(reqBytes)))
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := xml.Unmarshal(b, &entry); err != nil {
+		return nil, NewManagementError(res, b)
+	}
+	return &entry, nil
+}
+
+// IfMatch sets the If-Match header of the request. A PUT with IfMatch("*") updates an existing entity rather than
+// failing because it already exists.
+func IfMatch(etag string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set("If-Match", etag)
+	}
+}
+
+func (e *ServerBusyError) Error() string {
+	return withRequestID(fmt.Sprintf("server busy, status code: %d, Details: %s", e.StatusCode, e.Detail), e.RequestID)
+}
+
+// RetryAfter returns how long the service asked callers to wait before retrying, and whether it said
+func (e *ServerBusyError) RetryAfter() (time.Duration, bool) {
+	return e.retryAfter, e.retryAfter > 0
+}
+
+func (m *ManagementError) Error() string {
+	return withRequestID(fmt.Sprintf("error code: %d, Details: %s", m.Code, m.Detail), m.RequestID)
+}
+
+// FormatManagementError builds an error from the body of a failed management response. If the body is a well formed
+// ManagementError, it is returned; otherwise the body is returned as the message of the error.
+func FormatManagementError(body []byte) error {
+	var mgmtError ManagementError
+	unmarshalErr := xml.Unmarshal(body, &mgmtError)
+	if unmarshalErr != nil {
+		return errors.New(string(body))
+	}
+
+	return &mgmtError
+}
+
+// NewManagementError builds a ManagementError from a failed management response and its body, recording the status
+// code of the response and the client request ID of the request. If the body is not a well formed ManagementError, the
+// body is used as the detail of the error and the status code as its code.
+func NewManagementError(res *http.Response, body []byte) error {
+	var mgmtError ManagementError
+	if err := xml.Unmarshal(body, &mgmtError); err != nil || mgmtError.Code == 0 {
+		mgmtError = ManagementError{Code: res.StatusCode, Detail: string(body)}
+		if mgmtError.Detail == "" {
+			mgmtError.Detail = http.StatusText(res.StatusCode)
+		}
+	}
+	mgmtError.StatusCode = res.StatusCode
+	mgmtError.RequestID = requestID(res)
+	return &mgmtError
+}
+
+// CheckResponse returns a ManagementError built from the response unless it has a successful status code. The body of
+// a failed response is consumed.
+func CheckResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	return NewManagementError(res, b)
+}
+
+// requestID returns the client request ID the response was requested with, if any
+func requestID(res *http.Response) string {
+	if res.Request == nil {
+		return ""
+	}
+	return res.Request.Header.Get(ClientRequestIDHeader)
+}
+
+func withRequestID(msg, requestID string) string {
+	if requestID == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s, RequestID: %s", msg, requestID)
+}
+
+func (em *EntityManager) addAuthorization(req *http.Request) (*http.Request, error) {
+	signature, err := em.TokenProvider.GetToken(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", signature.Token)
+	return req, nil
+}
+
+func addAtomXMLContentType(req *http.Request) *http.Request {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		req.Header.Add("content-Type", "application/atom+xml;type=entry;charset=utf-8")
+	}
+	return req
+}
+
+func addAPIVersion(req *http.Request) *http.Request {
+	q := req.URL.Query()
+	q.Add("api-version", apiVersion)
+	req.URL.RawQuery = q.Encode()
+	return req
+}
+
+func (em *EntityManager) startSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if em.StartSpan != nil {
+		return em.StartSpan(ctx, operationName)
+	}
+	otSpan, ctx := opentracing.StartSpanFromContext(ctx, operationName)
+	span := openTracingSpan{span: otSpan}
+	span.SetAttribute("component", "github.com/Azure/azure-service-bus-go")
+	span.SetAttribute("span.kind", "client")
+	return span, ctx
+}
+
+func applyRequestInfo(span Span, req *http.Request) {
+	span.SetAttribute("http.url", req.URL.String())
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute(requestIDTag, req.Header.Get(ClientRequestIDHeader))
+}
+
+func applyResponseInfo(span Span, res *http.Response) {
+	if res != nil {
+		span.SetAttribute("http.status_code", uint16(res.StatusCode))
+	}
+}
+
+// SetAttribute sets a tag on the span
+func (ots openTracingSpan) SetAttribute(key string, value interface{}) {
+	ots.span.SetTag(key, value)
+}
+
+// End finishes the span
+func (ots openTracingSpan) End() {
+	ots.span.Finish()
+}
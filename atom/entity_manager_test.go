@@ -0,0 +1,212 @@
+package atom
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatManagementError(t *testing.T) {
+	body := []byte(`<Error><Code>409</Code><Detail>Conflict. TrackingId:abc</Detail></Error>`)
+	err := FormatManagementError(body)
+	if assert.IsType(t, &ManagementError{}, err) {
+		mgmtErr := err.(*ManagementError)
+		assert.Equal(t, 409, mgmtErr.Code)
+		assert.Equal(t, "Conflict. TrackingId:abc", mgmtErr.Detail)
+	}
+	assert.EqualError(t, err, "error code: 409, Details: Conflict. TrackingId:abc")
+}
+
+func TestFormatManagementError_UnstructuredBody(t *testing.T) {
+	err := FormatManagementError([]byte("bad gateway"))
+	assert.EqualError(t, err, "bad gateway")
+}
+
+func TestIfMatch(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "https://foo.servicebus.windows.net/topic/subscriptions/sub/rules/$Default", nil)
+	IfMatch("*")(req)
+	assert.Equal(t, "*", req.Header.Get("If-Match"))
+}
+
+type staticTokenProvider struct{}
+
+func (staticTokenProvider) GetToken(uri string) (*auth.Token, error) {
+	return auth.NewToken(auth.CBSTokenTypeSAS, "token", ""), nil
+}
+
+func TestExecute_ServerBusy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`<Error><Code>503</Code><Detail>Throttled. TrackingId:abc</Detail></Error>`))
+	}))
+	defer server.Close()
+
+	em := NewEntityManager(server.URL+"/", staticTokenProvider{})
+	res, err := em.Get(context.Background(), "queue")
+	if assert.NotNil(t, res) {
+		defer res.Body.Close()
+	}
+	if assert.IsType(t, &ServerBusyError{}, err) {
+		busy := err.(*ServerBusyError)
+		assert.Equal(t, http.StatusServiceUnavailable, busy.StatusCode)
+		assert.Equal(t, "Throttled. TrackingId:abc", busy.Detail)
+		after, ok := busy.RetryAfter()
+		assert.True(t, ok)
+		assert.Equal(t, 7*time.Second, after)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 2*time.Minute, parseRetryAfter(now.Add(2*time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+}
+
+func TestExecute_SetsClientRequestID(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(ClientRequestIDHeader))
+	}))
+	defer server.Close()
+
+	em := NewEntityManager(server.URL+"/", staticTokenProvider{})
+	for i := 0; i < 2; i++ {
+		res, err := em.Get(context.Background(), "queue")
+		if assert.NoError(t, err) {
+			_ = res.Body.Close()
+		}
+	}
+
+	res, err := em.Execute(context.Background(), http.MethodGet, "queue", http.NoBody, func(req *http.Request) {
+		req.Header.Set(ClientRequestIDHeader, "mine")
+	})
+	if assert.NoError(t, err) {
+		_ = res.Body.Close()
+	}
+
+	if assert.Len(t, received, 3) {
+		assert.NotEmpty(t, received[0])
+		assert.NotEqual(t, received[0], received[1])
+		assert.Equal(t, "mine", received[2])
+	}
+}
+
+func TestNewManagementError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "https://foo.servicebus.windows.net/queue", nil)
+	req.Header.Set(ClientRequestIDHeader, "request")
+	res := &http.Response{StatusCode: http.StatusConflict, Request: req}
+
+	err := NewManagementError(res, []byte(`<Error><Code>409</Code><Detail>Conflict. TrackingId:abc</Detail></Error>`))
+	if assert.IsType(t, &ManagementError{}, err) {
+		mgmtErr := err.(*ManagementError)
+		assert.Equal(t, 409, mgmtErr.Code)
+		assert.Equal(t, http.StatusConflict, mgmtErr.StatusCode)
+		assert.Equal(t, "request", mgmtErr.RequestID)
+	}
+	assert.EqualError(t, err, "error code: 409, Details: Conflict. TrackingId:abc, RequestID: request")
+
+	res.StatusCode = http.StatusBadGateway
+	assert.EqualError(t, NewManagementError(res, []byte("bad gateway")), "error code: 502, Details: bad gateway, RequestID: request")
+	assert.EqualError(t, NewManagementError(res, nil), "error code: 502, Details: Bad Gateway, RequestID: request")
+}
+
+func TestCheckResponse(t *testing.T) {
+	ok := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}
+	assert.NoError(t, CheckResponse(ok))
+
+	failed := &http.Response{StatusCode: http.StatusForbidden, Body: ioutil.NopCloser(strings.NewReader("denied"))}
+	assert.EqualError(t, CheckResponse(failed), "error code: 403, Details: denied")
+}
+
+func TestRetryable(t *testing.T) {
+	for status, expected := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            false,
+		http.StatusConflict:            false,
+		http.StatusNotImplemented:      false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	} {
+		assert.Equal(t, expected, retryable(true, &http.Response{StatusCode: status}, nil), http.StatusText(status))
+	}
+	assert.True(t, retryable(true, nil, errors.New("connection reset")))
+	assert.False(t, retryable(true, nil, context.Canceled))
+
+	assert.True(t, retryable(false, &http.Response{StatusCode: http.StatusTooManyRequests}, nil))
+	assert.False(t, retryable(false, &http.Response{StatusCode: http.StatusServiceUnavailable}, nil))
+	assert.False(t, retryable(false, &http.Response{StatusCode: http.StatusBadGateway}, nil))
+	assert.False(t, retryable(false, nil, errors.New("connection reset")))
+}
+
+func TestIdempotent(t *testing.T) {
+	assert.True(t, idempotent(http.MethodGet, nil))
+	assert.True(t, idempotent(http.MethodDelete, nil))
+	assert.True(t, idempotent(http.MethodPut, []RequestOption{IfMatch("*")}))
+	assert.False(t, idempotent(http.MethodPut, nil))
+	assert.False(t, idempotent(http.MethodPost, nil))
+}
+
+func TestExecute_DoesNotRetryCreation(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	em := NewEntityManager(server.URL+"/", staticTokenProvider{})
+	em.Retry = func(context.Context, int, *http.Response, error) bool {
+		return true
+	}
+
+	res, err := em.Put(context.Background(), "queue", []byte("<entry/>"))
+	if assert.NoError(t, err) {
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	}
+	assert.Equal(t, 1, requests, "the queue may have been created, so the PUT must not be repeated")
+}
+
+func TestExecute_RetryDeclined(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`<Error><Code>503</Code><Detail>Throttled</Detail></Error>`))
+	}))
+	defer server.Close()
+
+	var attempts []int
+	em := NewEntityManager(server.URL+"/", staticTokenProvider{})
+	em.Retry = func(ctx context.Context, attempt int, res *http.Response, err error) bool {
+		attempts = append(attempts, attempt)
+		return attempt < 2
+	}
+
+	res, err := em.Get(context.Background(), "queue")
+	if assert.NotNil(t, res) {
+		defer res.Body.Close()
+		// the last response is handed back to the caller unread
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Contains(t, string(body), "Throttled")
+	}
+	assert.IsType(t, &ServerBusyError{}, err)
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,303 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"pack.ag/amqp"
+)
+
+const (
+	// DefaultMaxBatchSizeInBytes is the largest encoded batch SendBatch will transfer at once, which is the maximum
+	// message size of a Standard tier namespace
+	DefaultMaxBatchSizeInBytes = StandardMaxMessageSizeInBytes
+
+	// batchMessageFormat is the AMQP message format of a message whose data sections each hold an encoded message
+	batchMessageFormat uint32 = 0x80013700
+
+	// batchEnvelopeOverhead is held back from each batch for the envelope's own encoding and any trace context
+	batchEnvelopeOverhead = 1024
+
+	// batchSectionOverhead is the cost of wrapping an encoded message in a data section
+	batchSectionOverhead = 8
+
+	partitionKeyAnnotation = "x-opt-partition-key"
+)
+
+type (
+	// BatchOption configures how SendBatch splits messages into batches
+	BatchOption func(*batchOptions) error
+
+	batchOptions struct {
+		maxSize int
+	}
+
+	// BatchChunkError reports that the messages at Indexes of the slice passed to SendBatch were not sent
+	BatchChunkError struct {
+		Indexes []int
+		Err     error
+	}
+
+	// ErrBatchFailed is returned by SendBatch when one or more of the batches it split the messages into were not
+	// sent. The messages of every batch not listed in Failed were sent.
+	ErrBatchFailed struct {
+		Batches int
+		Failed  []BatchChunkError
+	}
+
+	// messageBatch is a single transfer of several messages
+	messageBatch struct {
+		messages   []*Message
+		encoded    [][]byte
+		properties map[string]interface{}
+	}
+
+	// batchChunk holds the indexes of the messages sent in a single transfer
+	batchChunk struct {
+		indexes []int
+	}
+
+	// batchRoute is what the broker routes a batch by. The envelope carries the session and partition key of its first
+	// message, so every message of a batch must share them.
+	batchRoute struct {
+		sessionID    string
+		partitionKey string
+	}
+)
+
+// BatchWithMaxSizeInBytes sets the largest encoded size of a single batch. Premium tier namespaces accept larger
+// messages than DefaultMaxBatchSizeInBytes.
+func BatchWithMaxSizeInBytes(size int) BatchOption {
+	return func(o *batchOptions) error {
+		if size <= batchEnvelopeOverhead {
+			return fmt.Errorf("max batch size must be greater than %d bytes", batchEnvelopeOverhead)
+		}
+		o.maxSize = size
+		return nil
+	}
+}
+
+func (e BatchChunkError) Error() string {
+	return fmt.Sprintf("messages %v: %v", e.Indexes, e.Err)
+}
+
+func (e ErrBatchFailed) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i, failed := range e.Failed {
+		failures[i] = failed.Error()
+	}
+	return fmt.Sprintf("%d of %d batches failed to send: %s", len(e.Failed), e.Batches, strings.Join(failures, "; "))
+}
+
+// SendBatch sends messages to the Queue in as few transfers as fit within the maximum batch size, one after another.
+// Only messages with the same session and partition key share a transfer, and each keeps its order relative to the
+// others with its key. Messages which are too large to share a transfer are sent in batches of their own. If any batch fails, including
+// those left unsent because the context expired, the others are still attempted and an ErrBatchFailed reports which
+// messages were not sent.
+func (q *Queue) SendBatch(ctx context.Context, messages []*Message, opts ...BatchOption) error {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.SendBatch")
+	defer span.End()
+	defer q.pending.add(len(messages))()
+
+	if err := q.schemas.validate(ctx, messages...); err != nil {
+		return err
+	}
+
+	if err := q.ensureSender(ctx); err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return sendBatch(ctx, q.sender, q.sendLimiter, messages, opts...)
+}
+
+// SendBatch sends messages to the Topic in as few transfers as fit within the maximum batch size, one after another.
+// Only messages with the same session and partition key share a transfer, and each keeps its order relative to the
+// others with its key. Messages which are too large to share a transfer are sent in batches of their own. If any batch fails, including
+// those left unsent because the context expired, the others are still attempted and an ErrBatchFailed reports which
+// messages were not sent.
+func (t *Topic) SendBatch(ctx context.Context, messages []*Message, opts ...BatchOption) error {
+	span, ctx := t.startSpanFromContext(ctx, "sb.Topic.SendBatch")
+	defer span.End()
+	defer t.pending.add(len(messages))()
+
+	if err := t.schemas.validate(ctx, messages...); err != nil {
+		return err
+	}
+
+	if err := t.ensureSender(ctx); err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return sendBatch(ctx, t.sender, t.sendLimiter, messages, opts...)
+}
+
+func sendBatch(ctx context.Context, s *sender, limiter *rateLimiter, messages []*Message, opts ...BatchOption) error {
+	span, ctx := s.startProducerSpanFromContext(ctx, "sb.sender.SendBatch")
+	defer span.End()
+
+	if len(messages) == 0 {
+		return errors.New("expected one or more messages")
+	}
+
+	options := &batchOptions{maxSize: DefaultMaxBatchSizeInBytes}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			log.For(ctx).Error(err)
+			return err
+		}
+	}
+
+	encoded := make([][]byte, len(messages))
+	routes := make([]batchRoute, len(messages))
+	for i, msg := range messages {
+		if err := s.prepare(ctx, span, msg); err != nil {
+			return err
+		}
+		bin, err := encodeMessage(msg)
+		if err != nil {
+			log.For(ctx).Error(err)
+			return err
+		}
+		encoded[i] = bin
+		routes[i] = routeOf(msg)
+	}
+
+	chunks := chunkMessages(routes, encoded, options.maxSize)
+	var failed []BatchChunkError
+	for _, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			failed = append(failed, BatchChunkError{Indexes: chunk.indexes, Err: err})
+			continue
+		}
+
+		err := limiter.wait(ctx, len(chunk.indexes))
+		if err == nil {
+			batch := &messageBatch{
+				messages: make([]*Message, len(chunk.indexes)),
+				encoded:  make([][]byte, len(chunk.indexes)),
+			}
+			for i, idx := range chunk.indexes {
+				batch.messages[i], batch.encoded[i] = messages[idx], encoded[idx]
+			}
+			err = s.trySend(ctx, batch)
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			failed = append(failed, BatchChunkError{Indexes: chunk.indexes, Err: err})
+		}
+	}
+
+	if len(failed) > 0 {
+		return ErrBatchFailed{Batches: len(chunks), Failed: failed}
+	}
+	return nil
+}
+
+// chunkMessages groups the encoded messages of each route, in order, into chunks whose batch encoding fits within
+// maxSize. Chunks are ordered by the first message they hold. A message too large to fit alongside any other is given a
+// chunk of its own, and left for the broker to accept or reject.
+func chunkMessages(routes []batchRoute, encoded [][]byte, maxSize int) []batchChunk {
+	budget := maxSize - batchEnvelopeOverhead
+	var chunks []batchChunk
+	var sizes []int
+	open := make(map[batchRoute]int)
+	for i, bin := range encoded {
+		n := len(bin) + batchSectionOverhead
+		c, ok := open[routes[i]]
+		if !ok || sizes[c]+n > budget {
+			c = len(chunks)
+			chunks = append(chunks, batchChunk{})
+			sizes = append(sizes, 0)
+			open[routes[i]] = c
+		}
+		chunks[c].indexes = append(chunks[c].indexes, i)
+		sizes[c] += n
+	}
+	return chunks
+}
+
+func routeOf(msg *Message) batchRoute {
+	var route batchRoute
+	if msg.GroupID != nil {
+		route.sessionID = *msg.GroupID
+	}
+	route.partitionKey, _ = msg.PartitionKey()
+	return route
+}
+
+func encodeMessage(msg *Message) ([]byte, error) {
+	amqpMsg, err := msg.toMsg()
+	if err != nil {
+		return nil, err
+	}
+	return amqpMsg.MarshalBinary()
+}
+
+// Set implements opentracing.TextMapWriter, carrying trace context on the batch envelope
+func (b *messageBatch) Set(key, value string) {
+	if b.properties == nil {
+		b.properties = make(map[string]interface{})
+	}
+	b.properties[key] = value
+}
+
+// toMsg wraps the encoded messages in a batch envelope. The envelope carries the identifying properties of the first
+// message, which the broker uses to route the batch to a partition or session, so the messages must share its
+// batchRoute.
+func (b *messageBatch) toMsg() (*amqp.Message, error) {
+	if len(b.encoded) == 1 {
+		msg, err := b.messages[0].toMsg()
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range b.properties {
+			if msg.ApplicationProperties == nil {
+				msg.ApplicationProperties = make(map[string]interface{})
+			}
+			msg.ApplicationProperties[key] = value
+		}
+		return msg, nil
+	}
+
+	first := b.messages[0]
+	envelope := &amqp.Message{
+		Format: batchMessageFormat,
+		Data:   b.encoded,
+		Properties: &amqp.MessageProperties{
+			MessageID: first.ID,
+		},
+		ApplicationProperties: b.properties,
+	}
+	if first.GroupID != nil {
+		envelope.Properties.GroupID = *first.GroupID
+	}
+	if first.SystemProperties != nil && first.SystemProperties.PartitionKey != nil {
+		envelope.Annotations = amqp.Annotations{partitionKeyAnnotation: *first.SystemProperties.PartitionKey}
+	}
+	return envelope, nil
+}
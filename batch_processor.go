@@ -0,0 +1,240 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// DefaultBatchProcessorSize is the largest batch a BatchProcessor hands to its handler unless configured otherwise
+	DefaultBatchProcessorSize = 32
+)
+
+type (
+	// BatchReceiver is an entity messages can be received from in batches, such as a Queue or Subscription
+	BatchReceiver interface {
+		ReceiveBatch(ctx context.Context, maxMessages int, handler Handler, opts ...ReceiveOption) error
+	}
+
+	// BatchItemResult is the outcome of handling one message of a batch
+	BatchItemResult struct {
+		// Err is nil if the message was handled, in which case it is completed, or why handling it failed
+		Err error
+		// DeadLetter dead-letters a message which failed, rather than abandoning it to be redelivered, for failures
+		// which retrying cannot fix
+		DeadLetter bool
+	}
+
+	// BatchHandler handles a batch of messages at once, such as with a single bulk write, and returns the result of
+	// each message in the same order as the messages
+	BatchHandler func(ctx context.Context, messages []*Message) []BatchItemResult
+
+	// BatchCheckpoint summarizes how the messages of a batch were settled
+	BatchCheckpoint struct {
+		Completed    int
+		Abandoned    int
+		DeadLettered int
+		// Unsettled is how many messages could not be settled. They are redelivered once their locks expire.
+		Unsettled int
+	}
+
+	// BatchProcessor receives messages in batches, hands each batch to a BatchHandler and settles each message of the
+	// batch according to the result the handler reports for it, so that one failed item does not cause the whole batch
+	// to be redelivered. The messages are held, unsettled, while the batch is received and handled, so the batch
+	// should be handled well within the lock duration of the entity, which must be received from in PeekLock mode.
+	BatchProcessor struct {
+		receiver     BatchReceiver
+		handler      BatchHandler
+		maxBatchSize int
+		maxWaitTime  time.Duration
+		checkpoint   func(ctx context.Context, checkpoint BatchCheckpoint) error
+		settle       func(ctx context.Context, msg *Message, outcome SettlementOutcome, reason error) error
+	}
+
+	// BatchProcessorOption configures a BatchProcessor
+	BatchProcessorOption func(*BatchProcessor) error
+)
+
+// BatchProcessorWithMaxBatchSize configures the largest batch handed to the handler, which is
+// DefaultBatchProcessorSize by default
+func BatchProcessorWithMaxBatchSize(size int) BatchProcessorOption {
+	return func(bp *BatchProcessor) error {
+		if size < 1 {
+			return errors.New("max batch size must be at least 1")
+		}
+		bp.maxBatchSize = size
+		return nil
+	}
+}
+
+// BatchProcessorWithMaxWaitTime configures how long to wait for the first message of a batch before giving up on it
+// and waiting again. By default the wait lasts as long as the context allows.
+func BatchProcessorWithMaxWaitTime(d time.Duration) BatchProcessorOption {
+	return func(bp *BatchProcessor) error {
+		if d <= 0 {
+			return errors.New("max wait time must be greater than zero")
+		}
+		bp.maxWaitTime = d
+		return nil
+	}
+}
+
+// BatchProcessorWithCheckpoint configures a func called once the messages of each batch have been settled, for
+// recording progress such as committing the offsets of a downstream store. An error from the func stops Run.
+func BatchProcessorWithCheckpoint(checkpoint func(ctx context.Context, checkpoint BatchCheckpoint) error) BatchProcessorOption {
+	return func(bp *BatchProcessor) error {
+		if checkpoint == nil {
+			return errors.New("checkpoint must not be nil")
+		}
+		bp.checkpoint = checkpoint
+		return nil
+	}
+}
+
+// NewBatchProcessor creates a BatchProcessor which receives batches from the receiver and hands them to the handler
+func NewBatchProcessor(receiver BatchReceiver, handler BatchHandler, opts ...BatchProcessorOption) (*BatchProcessor, error) {
+	if receiver == nil || handler == nil {
+		return nil, errors.New("both a receiver and a handler are required")
+	}
+
+	bp := &BatchProcessor{
+		receiver:     receiver,
+		handler:      handler,
+		maxBatchSize: DefaultBatchProcessorSize,
+		settle:       settleBatchItem,
+	}
+	for _, opt := range opts {
+		if err := opt(bp); err != nil {
+			return nil, err
+		}
+	}
+	return bp, nil
+}
+
+// Run processes batches until the context is done, returning the error of the batch which stopped it, or nil once the
+// context is done
+func (bp *BatchProcessor) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		_, err := bp.ProcessBatch(ctx)
+		if _, ok := err.(ErrNoMessages); ok {
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessBatch receives a single batch, hands it to the handler and settles its messages. ErrNoMessages is returned
+// if no message arrives within the max wait time. If the batch cannot be received in full, the messages received are
+// released without being handled.
+func (bp *BatchProcessor) ProcessBatch(ctx context.Context) (BatchCheckpoint, error) {
+	var opts []ReceiveOption
+	if bp.maxWaitTime > 0 {
+		opts = append(opts, WithMaxWaitTime(bp.maxWaitTime))
+	}
+
+	var batch []*Message
+	err := bp.receiver.ReceiveBatch(ctx, bp.maxBatchSize, HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		batch = append(batch, msg)
+		// the message is held until the handler has reported on the whole batch
+		return func(context.Context) {}
+	}), opts...)
+	if _, ok := err.(ErrNoMessages); ok && len(batch) == 0 {
+		return BatchCheckpoint{}, err
+	}
+	if err != nil {
+		log.For(ctx).Error(err)
+		for _, msg := range batch {
+			_ = bp.settle(ctx, msg, OutcomeReleased, nil)
+		}
+		return BatchCheckpoint{}, err
+	}
+	if len(batch) == 0 {
+		return BatchCheckpoint{}, ErrNoMessages{}
+	}
+
+	results := bp.handler(ctx, batch)
+	if len(results) != len(batch) {
+		err := fmt.Errorf("batch handler returned %d results for %d messages", len(results), len(batch))
+		log.For(ctx).Error(err)
+		for _, msg := range batch {
+			_ = bp.settle(ctx, msg, OutcomeAbandoned, nil)
+		}
+		return BatchCheckpoint{Abandoned: len(batch)}, err
+	}
+
+	var checkpoint BatchCheckpoint
+	for i, msg := range batch {
+		outcome := OutcomeCompleted
+		switch {
+		case results[i].Err != nil && results[i].DeadLetter:
+			outcome = OutcomeDeadLettered
+		case results[i].Err != nil:
+			outcome = OutcomeAbandoned
+		}
+
+		if err := bp.settle(ctx, msg, outcome, results[i].Err); err != nil {
+			checkpoint.Unsettled++
+			continue
+		}
+		switch outcome {
+		case OutcomeCompleted:
+			checkpoint.Completed++
+		case OutcomeDeadLettered:
+			checkpoint.DeadLettered++
+		default:
+			checkpoint.Abandoned++
+		}
+	}
+
+	if bp.checkpoint != nil {
+		if err := bp.checkpoint(ctx, checkpoint); err != nil {
+			log.For(ctx).Error(err)
+			return checkpoint, err
+		}
+	}
+	return checkpoint, nil
+}
+
+// settleBatchItem settles the message with the outcome, dead-lettering it with the reason
+func settleBatchItem(ctx context.Context, msg *Message, outcome SettlementOutcome, reason error) error {
+	action := msg.Complete()
+	switch outcome {
+	case OutcomeAbandoned:
+		action = msg.Abandon()
+	case OutcomeDeadLettered:
+		action = msg.DeadLetter(reason)
+	case OutcomeReleased:
+		action = msg.Release()
+	}
+	_, err := msg.Settle(ctx, action)
+	return err
+}
@@ -0,0 +1,188 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ BatchReceiver = (*Queue)(nil)
+	_ BatchReceiver = (*Subscription)(nil)
+)
+
+type (
+	// fakeBatchReceiver hands out its batches in turn, then reports there are no messages
+	fakeBatchReceiver struct {
+		batches     [][]*Message
+		err         error
+		maxMessages []int
+	}
+
+	settlement struct {
+		id      string
+		outcome SettlementOutcome
+		reason  error
+	}
+)
+
+func (br *fakeBatchReceiver) ReceiveBatch(ctx context.Context, maxMessages int, handler Handler, _ ...ReceiveOption) error {
+	br.maxMessages = append(br.maxMessages, maxMessages)
+	if len(br.batches) == 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrNoMessages{}
+	}
+	batch := br.batches[0]
+	br.batches = br.batches[1:]
+	for _, msg := range batch {
+		handler.Handle(ctx, msg)(ctx)
+	}
+	return br.err
+}
+
+func messagesWithIDs(ids ...string) []*Message {
+	messages := make([]*Message, len(ids))
+	for i, id := range ids {
+		messages[i] = NewMessageFromString(id)
+		messages[i].ID = id
+	}
+	return messages
+}
+
+// recordSettlements makes the processor record how it settles messages rather than settling them with the broker
+func recordSettlements(bp *BatchProcessor, fail map[string]bool) *[]settlement {
+	var settled []settlement
+	bp.settle = func(_ context.Context, msg *Message, outcome SettlementOutcome, reason error) error {
+		if fail[msg.ID] {
+			return errors.New("lock lost")
+		}
+		settled = append(settled, settlement{id: msg.ID, outcome: outcome, reason: reason})
+		return nil
+	}
+	return &settled
+}
+
+func TestBatchProcessor_SettlesEachItem(t *testing.T) {
+	malformed := errors.New("malformed")
+	throttled := errors.New("throttled")
+	receiver := &fakeBatchReceiver{batches: [][]*Message{messagesWithIDs("a", "b", "c", "d")}}
+
+	var checkpoints []BatchCheckpoint
+	bp, err := NewBatchProcessor(receiver, func(_ context.Context, messages []*Message) []BatchItemResult {
+		assert.Len(t, messages, 4)
+		return []BatchItemResult{{}, {Err: malformed, DeadLetter: true}, {Err: throttled}, {}}
+	}, BatchProcessorWithMaxBatchSize(10), BatchProcessorWithCheckpoint(func(_ context.Context, checkpoint BatchCheckpoint) error {
+		checkpoints = append(checkpoints, checkpoint)
+		return nil
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	settled := recordSettlements(bp, map[string]bool{"d": true})
+
+	checkpoint, err := bp.ProcessBatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []settlement{
+		{id: "a", outcome: OutcomeCompleted},
+		{id: "b", outcome: OutcomeDeadLettered, reason: malformed},
+		{id: "c", outcome: OutcomeAbandoned, reason: throttled},
+	}, *settled)
+	assert.Equal(t, BatchCheckpoint{Completed: 1, Abandoned: 1, DeadLettered: 1, Unsettled: 1}, checkpoint)
+	assert.Equal(t, []BatchCheckpoint{checkpoint}, checkpoints)
+	assert.Equal(t, []int{10}, receiver.maxMessages)
+
+	_, err = bp.ProcessBatch(context.Background())
+	assert.IsType(t, ErrNoMessages{}, err)
+	assert.Len(t, checkpoints, 1, "no checkpoint without a batch")
+}
+
+func TestBatchProcessor_AbandonsBatchOnMismatchedResults(t *testing.T) {
+	receiver := &fakeBatchReceiver{batches: [][]*Message{messagesWithIDs("a", "b")}}
+	bp, err := NewBatchProcessor(receiver, func(context.Context, []*Message) []BatchItemResult {
+		return []BatchItemResult{{}}
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	settled := recordSettlements(bp, nil)
+
+	checkpoint, err := bp.ProcessBatch(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, BatchCheckpoint{Abandoned: 2}, checkpoint)
+	assert.Equal(t, []settlement{{id: "a", outcome: OutcomeAbandoned}, {id: "b", outcome: OutcomeAbandoned}}, *settled)
+}
+
+func TestBatchProcessor_ReleasesPartiallyReceivedBatch(t *testing.T) {
+	detached := errors.New("link detached")
+	receiver := &fakeBatchReceiver{batches: [][]*Message{messagesWithIDs("a")}, err: detached}
+	bp, err := NewBatchProcessor(receiver, func(context.Context, []*Message) []BatchItemResult {
+		t.Fatal("a batch which was not received in full should not be handled")
+		return nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	settled := recordSettlements(bp, nil)
+
+	_, err = bp.ProcessBatch(context.Background())
+	assert.Equal(t, detached, err)
+	assert.Equal(t, []settlement{{id: "a", outcome: OutcomeReleased}}, *settled)
+}
+
+func TestBatchProcessor_RunStopsOnCheckpointError(t *testing.T) {
+	commitFailed := errors.New("commit failed")
+	receiver := &fakeBatchReceiver{batches: [][]*Message{messagesWithIDs("a"), messagesWithIDs("b")}}
+	bp, err := NewBatchProcessor(receiver, func(_ context.Context, messages []*Message) []BatchItemResult {
+		return make([]BatchItemResult, len(messages))
+	}, BatchProcessorWithCheckpoint(func(context.Context, BatchCheckpoint) error {
+		return commitFailed
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	recordSettlements(bp, nil)
+
+	assert.Equal(t, commitFailed, bp.Run(context.Background()))
+	assert.Len(t, receiver.batches, 1, "processing should stop after the failed checkpoint")
+}
+
+func TestBatchProcessor_RunReturnsOnceContextIsDone(t *testing.T) {
+	receiver := &fakeBatchReceiver{batches: [][]*Message{messagesWithIDs("a")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	bp, err := NewBatchProcessor(receiver, func(_ context.Context, messages []*Message) []BatchItemResult {
+		cancel()
+		return make([]BatchItemResult, len(messages))
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	settled := recordSettlements(bp, nil)
+
+	assert.NoError(t, bp.Run(ctx))
+	assert.Equal(t, []settlement{{id: "a", outcome: OutcomeCompleted}}, *settled)
+}
+
+func TestBatchProcessorOptions(t *testing.T) {
+	handler := func(context.Context, []*Message) []BatchItemResult { return nil }
+	receiver := new(fakeBatchReceiver)
+
+	_, err := NewBatchProcessor(nil, handler)
+	assert.Error(t, err)
+	_, err = NewBatchProcessor(receiver, nil)
+	assert.Error(t, err)
+	_, err = NewBatchProcessor(receiver, handler, BatchProcessorWithMaxBatchSize(0))
+	assert.Error(t, err)
+	_, err = NewBatchProcessor(receiver, handler, BatchProcessorWithMaxWaitTime(0))
+	assert.Error(t, err)
+	_, err = NewBatchProcessor(receiver, handler, BatchProcessorWithCheckpoint(nil))
+	assert.Error(t, err)
+
+	bp, err := NewBatchProcessor(receiver, handler)
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultBatchProcessorSize, bp.maxBatchSize)
+	}
+}
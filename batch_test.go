@@ -0,0 +1,107 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkMessages(t *testing.T) {
+	const maxSize = batchEnvelopeOverhead + 100
+	sized := func(sizes ...int) [][]byte {
+		encoded := make([][]byte, len(sizes))
+		for i, size := range sizes {
+			encoded[i] = make([]byte, size)
+		}
+		return encoded
+	}
+
+	chunk := func(indexes ...int) batchChunk {
+		return batchChunk{indexes: indexes}
+	}
+	a, b := batchRoute{sessionID: "a"}, batchRoute{sessionID: "a", partitionKey: "b"}
+	same := func(n int) []batchRoute {
+		return make([]batchRoute, n)
+	}
+
+	assert.Equal(t, []batchChunk{chunk(0, 1, 2)}, chunkMessages(same(3), sized(10, 10, 10), maxSize))
+	assert.Equal(t, []batchChunk{chunk(0, 1), chunk(2, 3), chunk(4)},
+		chunkMessages(same(5), sized(40, 40, 40, 40, 40), maxSize))
+	assert.Equal(t, []batchChunk{chunk(0), chunk(1), chunk(2)},
+		chunkMessages(same(3), sized(10, 500, 10), maxSize), "an oversized message is sent on its own")
+	assert.Equal(t, []batchChunk{chunk(0, 2), chunk(1, 4), chunk(3)},
+		chunkMessages([]batchRoute{a, b, a, a, b}, sized(40, 10, 40, 40, 10), maxSize),
+		"only messages with the same session and partition key share a batch")
+}
+
+func TestErrBatchFailed_Error(t *testing.T) {
+	err := ErrBatchFailed{
+		Batches: 3,
+		Failed: []BatchChunkError{
+			{Indexes: []int{2, 3}, Err: errors.New("rejected")},
+			{Indexes: []int{4}, Err: context.DeadlineExceeded},
+		},
+	}
+	assert.EqualError(t, err, "2 of 3 batches failed to send: messages [2 3]: rejected; "+
+		"messages [4]: context deadline exceeded")
+}
+
+func TestBatchWithMaxSizeInBytes(t *testing.T) {
+	options := new(batchOptions)
+	assert.Error(t, BatchWithMaxSizeInBytes(batchEnvelopeOverhead)(options))
+	if assert.NoError(t, BatchWithMaxSizeInBytes(1024*1024)(options)) {
+		assert.Equal(t, 1024*1024, options.maxSize)
+	}
+}
+
+func TestMessageBatch_ToMsg(t *testing.T) {
+	group, key := "group", "key"
+	first := NewMessageFromString("first")
+	first.ID = "first"
+	first.GroupID = &group
+	first.SystemProperties = &SystemProperties{PartitionKey: &key}
+	second := NewMessageFromString("second")
+	second.ID = "second"
+
+	encoded := make([][]byte, 2)
+	for i, msg := range []*Message{first, second} {
+		bin, err := encodeMessage(msg)
+		if !assert.NoError(t, err) {
+			return
+		}
+		encoded[i] = bin
+	}
+
+	batch := &messageBatch{messages: []*Message{first, second}, encoded: encoded}
+	batch.Set("trace", "span")
+	envelope, err := batch.toMsg()
+	if assert.NoError(t, err) {
+		assert.Equal(t, batchMessageFormat, envelope.Format)
+		assert.Equal(t, encoded, envelope.Data)
+		assert.Equal(t, "first", envelope.Properties.MessageID)
+		assert.Equal(t, group, envelope.Properties.GroupID)
+		assert.Equal(t, key, envelope.Annotations[partitionKeyAnnotation])
+		assert.Equal(t, "span", envelope.ApplicationProperties["trace"])
+	}
+
+	single := &messageBatch{messages: []*Message{second}, encoded: encoded[1:]}
+	single.Set("trace", "span")
+	msg, err := single.toMsg()
+	if assert.NoError(t, err) {
+		assert.Zero(t, msg.Format)
+		assert.Equal(t, "second", string(msg.Data[0]))
+		assert.Equal(t, "span", msg.ApplicationProperties["trace"])
+	}
+}
+
+func TestRouteOf(t *testing.T) {
+	group, key := "group", "key"
+	msg := NewMessageFromString("hello")
+	assert.Equal(t, batchRoute{}, routeOf(msg))
+
+	msg.GroupID = &group
+	msg.SystemProperties = &SystemProperties{PartitionKey: &key}
+	assert.Equal(t, batchRoute{sessionID: group, partitionKey: key}, routeOf(msg))
+}
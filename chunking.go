@@ -0,0 +1,405 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+)
+
+const (
+	// ChunkGroupIDProperty is the user property which carries the ID of the message a chunk is part of
+	ChunkGroupIDProperty = "chunk-group-id"
+	// ChunkIndexProperty is the user property which carries the position of a chunk within its message, from zero
+	ChunkIndexProperty = "chunk-index"
+	// ChunkCountProperty is the user property which carries the number of chunks a message was split into
+	ChunkCountProperty = "chunk-count"
+
+	// DefaultReassemblyTimeout is how long the chunks of a message are held waiting for the rest of them by default
+	DefaultReassemblyTimeout = 30 * time.Second
+
+	// chunkPropertiesReserve is held back from each chunk for the chunk properties and ID suffix, which vary by chunk
+	chunkPropertiesReserve = 64
+)
+
+type (
+	// ChunkingSender sends messages too large for the namespace as several smaller chunk messages, which a handler
+	// created by NewReassemblingHandler puts back together. Messages which fit are sent unchanged. Every chunk carries
+	// the properties of the message, so chunks are routed, filtered and partitioned like the message would have been.
+	ChunkingSender struct {
+		sender  MessageSender
+		maxSize int
+	}
+
+	// ChunkingOption configures a ChunkingSender
+	ChunkingOption func(*ChunkingSender) error
+
+	// ReassemblyOption configures a handler created by NewReassemblingHandler
+	ReassemblyOption func(*reassemblingHandler) error
+
+	reassemblingHandler struct {
+		handler      Handler
+		onIncomplete Handler
+		timeout      time.Duration
+		mu           sync.Mutex
+		groups       map[string]*chunkGroup
+		// finished remembers messages which were reassembled and settled, until the timeout passes, so chunks of them
+		// which are delivered again are dropped rather than held forever
+		finished map[string]time.Time
+		// settleChunk settles a chunk with the outcome of its reassembled message
+		settleChunk func(chunk *Message, groupID string, outcome SettlementOutcome) DispositionAction
+	}
+
+	// chunkGroup holds the chunks of a message which have arrived, by index
+	chunkGroup struct {
+		deadline time.Time
+		chunks   []*Message
+		received int
+	}
+)
+
+// ChunkingWithMaxSize configures the size limit of the namespace, which is StandardMaxMessageSizeInBytes by default
+func ChunkingWithMaxSize(size int) ChunkingOption {
+	return func(cs *ChunkingSender) error {
+		if size <= batchEnvelopeOverhead+chunkPropertiesReserve {
+			return fmt.Errorf("max size must be greater than %d bytes", batchEnvelopeOverhead+chunkPropertiesReserve)
+		}
+		cs.maxSize = size
+		return nil
+	}
+}
+
+// NewChunkingSender creates a ChunkingSender which sends messages, and their chunks, with the sender
+func NewChunkingSender(sender MessageSender, opts ...ChunkingOption) (*ChunkingSender, error) {
+	if sender == nil {
+		return nil, errors.New("sender must not be nil")
+	}
+
+	cs := &ChunkingSender{sender: sender, maxSize: StandardMaxMessageSizeInBytes}
+	for _, opt := range opts {
+		if err := opt(cs); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// Send sends the message, split into chunks if it is too large. Chunks are sent one after another and sending stops
+// at the first which fails; chunks which were sent are dropped by the receiving handler once its reassembly timeout
+// passes. The ID of the message, or a new UUID if it has none, ties its chunks together.
+func (cs *ChunkingSender) Send(ctx context.Context, msg *Message) error {
+	fits, err := msg.Fits(cs.maxSize)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	if fits {
+		return cs.sender.Send(ctx, msg)
+	}
+
+	chunks, err := cs.split(msg)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	for i, chunk := range chunks {
+		if err := cs.sender.Send(ctx, chunk); err != nil {
+			err = fmt.Errorf("sent %d of the %d chunks of message %q: %v", i, len(chunks), chunk.UserProperties[ChunkGroupIDProperty], err)
+			log.For(ctx).Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// split copies the message into chunks which each carry a slice of its payload
+func (cs *ChunkingSender) split(msg *Message) ([]*Message, error) {
+	if msg.Value != nil {
+		return nil, errors.New("a message with an AMQP value body cannot be split into chunks")
+	}
+
+	groupID := msg.ID
+	if groupID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		groupID = id.String()
+	}
+
+	template := *msg
+	template.message = nil
+	template.Data = nil
+	template.ID = groupID
+	template.UserProperties = chunkProperties(msg.UserProperties, groupID, 0, 0)
+	overhead, err := template.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	budget := cs.maxSize - batchEnvelopeOverhead - chunkPropertiesReserve - overhead
+	if budget <= 0 {
+		return nil, fmt.Errorf("the properties of message %q leave no room for its payload within %d bytes", groupID, cs.maxSize)
+	}
+
+	count := (len(msg.Data) + budget - 1) / budget
+	chunks := make([]*Message, count)
+	for i := range chunks {
+		chunk := template
+		chunk.ID = fmt.Sprintf("%s/%d", groupID, i)
+		chunk.Data = msg.Data[i*budget : min((i+1)*budget, len(msg.Data))]
+		chunk.UserProperties = chunkProperties(msg.UserProperties, groupID, i, count)
+		chunks[i] = &chunk
+	}
+	return chunks, nil
+}
+
+func chunkProperties(properties map[string]interface{}, groupID string, index, count int) map[string]interface{} {
+	chunked := make(map[string]interface{}, len(properties)+3)
+	for key, value := range properties {
+		chunked[key] = value
+	}
+	chunked[ChunkGroupIDProperty] = groupID
+	chunked[ChunkIndexProperty] = int64(index)
+	chunked[ChunkCountProperty] = int64(count)
+	return chunked
+}
+
+// ReassemblyWithTimeout configures how long the chunks of a message are held waiting for the rest of them, which is
+// DefaultReassemblyTimeout by default. Chunks are held without being settled, so the timeout should be shorter than the
+// lock duration of the entity.
+func ReassemblyWithTimeout(timeout time.Duration) ReassemblyOption {
+	return func(rh *reassemblingHandler) error {
+		if timeout <= 0 {
+			return errors.New("timeout must be greater than zero")
+		}
+		rh.timeout = timeout
+		return nil
+	}
+}
+
+// ReassemblyWithOnIncomplete configures the handler called for each chunk of a message whose other chunks did not
+// arrive within the timeout. By default, such chunks are dead-lettered with an ErrIncompleteChunkGroup.
+func ReassemblyWithOnIncomplete(handler Handler) ReassemblyOption {
+	return func(rh *reassemblingHandler) error {
+		if handler == nil {
+			return errors.New("handler must not be nil")
+		}
+		rh.onIncomplete = handler
+		return nil
+	}
+}
+
+// NewReassemblingHandler wraps the handler so the chunks of messages sent by a ChunkingSender are put back together
+// and handled as the original message, while other messages are handled as they are. Chunks are held, unsettled,
+// until the last of them arrives, and then settled with whichever outcome the handler settles the message with, so a
+// message which is abandoned is redelivered in full.
+func NewReassemblingHandler(handler Handler, opts ...ReassemblyOption) (Handler, error) {
+	if handler == nil {
+		return nil, errors.New("handler must not be nil")
+	}
+
+	rh := &reassemblingHandler{
+		handler:     handler,
+		timeout:     DefaultReassemblyTimeout,
+		groups:      make(map[string]*chunkGroup),
+		finished:    make(map[string]time.Time),
+		settleChunk: settleChunkAs,
+	}
+	for _, opt := range opts {
+		if err := opt(rh); err != nil {
+			return nil, err
+		}
+	}
+	return rh, nil
+}
+
+func (rh *reassemblingHandler) Handle(ctx context.Context, msg *Message) DispositionAction {
+	if _, ok := msg.UserProperties[ChunkGroupIDProperty]; !ok {
+		return rh.handler.Handle(ctx, msg)
+	}
+
+	now := msg.getClock().Now()
+	var actions []DispositionAction
+	for _, expired := range rh.expire(now) {
+		if rh.onIncomplete != nil {
+			actions = append(actions, rh.onIncomplete.Handle(ctx, expired.chunk))
+			continue
+		}
+		actions = append(actions, expired.chunk.DeadLetter(expired.reason))
+	}
+	actions = append(actions, rh.collect(ctx, msg, now))
+
+	if len(actions) == 1 {
+		return actions[0]
+	}
+	return func(ctx context.Context) {
+		for _, action := range actions {
+			if action != nil {
+				action(ctx)
+			}
+		}
+	}
+}
+
+// collect adds the chunk to its group, handling the reassembled message once the group is complete
+func (rh *reassemblingHandler) collect(ctx context.Context, msg *Message, now time.Time) DispositionAction {
+	groupID, _ := msg.UserProperties[ChunkGroupIDProperty].(string)
+	index, indexErr := msg.intProperty(ChunkIndexProperty)
+	count, countErr := msg.intProperty(ChunkCountProperty)
+	if groupID == "" || indexErr != nil || countErr != nil || index < 0 || index >= count {
+		return msg.DeadLetter(fmt.Errorf("message %q has invalid chunk properties", msg.ID))
+	}
+
+	rh.mu.Lock()
+	if _, ok := rh.finished[groupID]; ok {
+		rh.mu.Unlock()
+		return msg.Complete()
+	}
+
+	group, ok := rh.groups[groupID]
+	if !ok {
+		group = &chunkGroup{deadline: now.Add(rh.timeout), chunks: make([]*Message, count)}
+		rh.groups[groupID] = group
+	}
+	if len(group.chunks) != count {
+		rh.mu.Unlock()
+		return msg.DeadLetter(fmt.Errorf("message %q says message %q has %d chunks, but other chunks say %d", msg.ID, groupID, count, len(group.chunks)))
+	}
+
+	// a chunk delivered again replaces the earlier delivery, whose lock has expired
+	if group.chunks[index] == nil {
+		group.received++
+	}
+	group.chunks[index] = msg
+	if group.received < count {
+		rh.mu.Unlock()
+		return func(context.Context) {}
+	}
+	delete(rh.groups, groupID)
+	rh.mu.Unlock()
+
+	assembled := reassemble(groupID, group.chunks, msg)
+	hook := assembled.settlementHook
+	assembled.settlementHook = func(ctx context.Context, m *Message, outcome SettlementOutcome) {
+		if hook != nil {
+			hook(ctx, m, outcome)
+		}
+		if !outcome.redelivered() {
+			rh.mu.Lock()
+			rh.finished[groupID] = m.getClock().Now().Add(rh.timeout)
+			rh.mu.Unlock()
+		}
+		for _, chunk := range group.chunks {
+			if chunk != msg {
+				rh.settleChunk(chunk, groupID, outcome)(ctx)
+			}
+		}
+	}
+
+	action := rh.handler.Handle(ctx, assembled)
+	if action == nil {
+		return assembled.Complete()
+	}
+	return action
+}
+
+type expiredChunk struct {
+	chunk  *Message
+	reason ErrIncompleteChunkGroup
+}
+
+// expire forgets the groups whose timeout has passed, returning the chunks of those which were never completed
+func (rh *reassemblingHandler) expire(now time.Time) []expiredChunk {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	var expired []expiredChunk
+	for groupID, group := range rh.groups {
+		if now.Before(group.deadline) {
+			continue
+		}
+		delete(rh.groups, groupID)
+		reason := ErrIncompleteChunkGroup{GroupID: groupID, Received: group.received, Count: len(group.chunks)}
+		for _, chunk := range group.chunks {
+			if chunk != nil {
+				expired = append(expired, expiredChunk{chunk: chunk, reason: reason})
+			}
+		}
+	}
+
+	for groupID, until := range rh.finished {
+		if !now.Before(until) {
+			delete(rh.finished, groupID)
+		}
+	}
+	return expired
+}
+
+// reassemble builds the original message from its chunks. It is settled through the last chunk to arrive, which has
+// the most recently taken lock.
+func reassemble(groupID string, chunks []*Message, last *Message) *Message {
+	assembled := *last
+	assembled.ID = groupID
+	assembled.reassembled = true
+
+	size := 0
+	for _, chunk := range chunks {
+		size += len(chunk.Data)
+	}
+	assembled.Data = make([]byte, 0, size)
+	for _, chunk := range chunks {
+		assembled.Data = append(assembled.Data, chunk.Data...)
+	}
+
+	assembled.UserProperties = make(map[string]interface{}, len(last.UserProperties))
+	for key, value := range last.UserProperties {
+		switch key {
+		case ChunkGroupIDProperty, ChunkIndexProperty, ChunkCountProperty:
+		default:
+			assembled.UserProperties[key] = value
+		}
+	}
+	return &assembled
+}
+
+// settleChunkAs settles a chunk with the outcome its reassembled message was settled with
+func settleChunkAs(chunk *Message, groupID string, outcome SettlementOutcome) DispositionAction {
+	switch outcome {
+	case OutcomeCompleted:
+		return chunk.Complete()
+	case OutcomeDeadLettered:
+		return chunk.DeadLetter(fmt.Errorf("message %q was dead-lettered", groupID))
+	case OutcomeReleased:
+		return chunk.Release()
+	default:
+		return chunk.Abandon()
+	}
+}
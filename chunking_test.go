@@ -0,0 +1,205 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reassemblyRecorder records the messages a reassembling handler passes on and the outcomes its chunks are settled with
+type reassemblyRecorder struct {
+	handled []*Message
+	settled map[string]SettlementOutcome
+}
+
+func newReassemblyRecorder(t *testing.T, opts ...ReassemblyOption) (*reassemblingHandler, *reassemblyRecorder) {
+	recorder := &reassemblyRecorder{settled: make(map[string]SettlementOutcome)}
+	handler, err := NewReassemblingHandler(HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		recorder.handled = append(recorder.handled, msg)
+		return func(context.Context) {}
+	}), opts...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	rh := handler.(*reassemblingHandler)
+	rh.settleChunk = func(chunk *Message, _ string, outcome SettlementOutcome) DispositionAction {
+		return func(context.Context) {
+			recorder.settled[chunk.ID] = outcome
+		}
+	}
+	return rh, recorder
+}
+
+func chunkedMessage(t *testing.T, maxSize int) (*Message, []*Message) {
+	msg := NewMessage(bytes.Repeat([]byte("0123456789"), 1000))
+	msg.ID = "order-1"
+	msg.Label = "OrderPlaced"
+	msg.Set("tenant", "contoso")
+
+	sender := new(recordingSender)
+	cs, err := NewChunkingSender(sender, ChunkingWithMaxSize(maxSize))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, cs.Send(context.Background(), msg)) {
+		t.FailNow()
+	}
+	return msg, sender.sent
+}
+
+func TestChunkingSender_SplitsOversizedMessages(t *testing.T) {
+	const maxSize = 4096
+	msg, chunks := chunkedMessage(t, maxSize)
+	if !assert.True(t, len(chunks) > 2) {
+		return
+	}
+
+	var data []byte
+	for i, chunk := range chunks {
+		fits, err := chunk.Fits(maxSize)
+		assert.NoError(t, err)
+		assert.True(t, fits, "chunk %d fits", i)
+		assert.Equal(t, "order-1", chunk.UserProperties[ChunkGroupIDProperty])
+		assert.Equal(t, int64(i), chunk.UserProperties[ChunkIndexProperty])
+		assert.Equal(t, int64(len(chunks)), chunk.UserProperties[ChunkCountProperty])
+		assert.Equal(t, "contoso", chunk.UserProperties["tenant"])
+		assert.Equal(t, "OrderPlaced", chunk.Label)
+		data = append(data, chunk.Data...)
+	}
+	assert.Equal(t, msg.Data, data)
+	assert.Equal(t, "order-1/0", chunks[0].ID)
+	assert.Len(t, msg.UserProperties, 1, "the message being split is left unchanged")
+
+	small := NewMessageFromString("payload")
+	sender := new(recordingSender)
+	cs, err := NewChunkingSender(sender)
+	if assert.NoError(t, err) {
+		assert.NoError(t, cs.Send(context.Background(), small))
+		assert.Equal(t, []*Message{small}, sender.sent, "messages which fit are sent unchanged")
+	}
+}
+
+func TestChunkingSender_RejectsUnsplittableMessages(t *testing.T) {
+	cs, err := NewChunkingSender(new(recordingSender), ChunkingWithMaxSize(2048))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	value := NewMessageFromAMQPValue(string(bytes.Repeat([]byte("a"), 4096)))
+	assert.Error(t, cs.Send(context.Background(), value))
+
+	crowded := NewMessage(bytes.Repeat([]byte("a"), 4096))
+	crowded.Set("padding", string(bytes.Repeat([]byte("b"), 2048)))
+	assert.Error(t, cs.Send(context.Background(), crowded))
+
+	_, err = NewChunkingSender(nil)
+	assert.Error(t, err)
+	_, err = NewChunkingSender(new(recordingSender), ChunkingWithMaxSize(100))
+	assert.Error(t, err)
+}
+
+func TestReassemblingHandler_ReassemblesChunks(t *testing.T) {
+	msg, chunks := chunkedMessage(t, 4096)
+	rh, recorder := newReassemblyRecorder(t)
+
+	// chunks may arrive out of order and be delivered more than once
+	order := append([]*Message{chunks[len(chunks)-1], chunks[0]}, chunks[:len(chunks)-1]...)
+	for _, chunk := range order {
+		assert.NotNil(t, rh.Handle(context.Background(), chunk), "held chunks are not completed automatically")
+	}
+
+	if !assert.Len(t, recorder.handled, 1) {
+		return
+	}
+	assembled := recorder.handled[0]
+	assert.Equal(t, msg.Data, assembled.Data)
+	assert.Equal(t, "order-1", assembled.ID)
+	assert.Equal(t, "OrderPlaced", assembled.Label)
+	assert.Equal(t, map[string]interface{}{"tenant": "contoso"}, assembled.UserProperties)
+
+	// settling the message settles every chunk with the same outcome
+	assert.NoError(t, assembled.settle(context.Background(), OutcomeAbandoned, func() error { return nil }))
+	assert.Len(t, recorder.settled, len(chunks)-1, "the last chunk is settled as the message itself")
+	for _, outcome := range recorder.settled {
+		assert.Equal(t, OutcomeAbandoned, outcome)
+	}
+
+	// an abandoned message is redelivered and reassembled again, while a completed one is not
+	for _, chunk := range chunks {
+		rh.Handle(context.Background(), chunk)
+	}
+	if assert.Len(t, recorder.handled, 2) {
+		assert.NoError(t, recorder.handled[1].settle(context.Background(), OutcomeCompleted, func() error { return nil }))
+	}
+	rh.Handle(context.Background(), chunks[0])
+	assert.Len(t, recorder.handled, 2)
+	assert.Empty(t, rh.groups, "chunks of a completed message which are delivered again are dropped")
+
+	plain := NewMessageFromString("plain")
+	rh.Handle(context.Background(), plain)
+	assert.Equal(t, plain, recorder.handled[2])
+}
+
+func TestReassemblingHandler_ExpiresIncompleteGroups(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var incomplete []string
+	rh, recorder := newReassemblyRecorder(t, ReassemblyWithTimeout(time.Minute), ReassemblyWithOnIncomplete(
+		HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+			incomplete = append(incomplete, msg.ID)
+			return nil
+		})))
+
+	_, chunks := chunkedMessage(t, 4096)
+	for _, chunk := range chunks {
+		chunk.namespace = ns
+	}
+	rh.Handle(context.Background(), chunks[0])
+	rh.Handle(context.Background(), chunks[1])
+
+	clock.Advance(time.Minute)
+	rh.Handle(context.Background(), chunks[2])
+	assert.Equal(t, []string{"order-1/0", "order-1/1"}, incomplete)
+	assert.Empty(t, recorder.handled)
+	if assert.Contains(t, rh.groups, "order-1") {
+		assert.Equal(t, 1, rh.groups["order-1"].received, "a chunk arriving after the timeout starts over")
+	}
+
+	invalid := NewMessageFromString("chunk")
+	invalid.Set(ChunkGroupIDProperty, "order-2")
+	assert.NotNil(t, rh.Handle(context.Background(), invalid))
+	assert.NotContains(t, rh.groups, "order-2")
+
+	assert.Equal(t, `only 2 of the 3 chunks of message "order-1" arrived before the reassembly timeout`,
+		ErrIncompleteChunkGroup{GroupID: "order-1", Received: 2, Count: 3}.Error())
+}
@@ -0,0 +1,102 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// Clock provides the current time and timers to the parts of the package which schedule messages, track lock
+	// expiration and back off between retries. Supplying a Clock through NamespaceWithClock allows tests to drive those
+	// decisions deterministically rather than waiting on real sleeps.
+	Clock interface {
+		// Now returns the current time
+		Now() time.Time
+		// After waits for the duration to elapse and then sends the current time on the returned channel
+		After(d time.Duration) <-chan time.Time
+	}
+
+	// systemClock is the default Clock and defers to the time package
+	systemClock struct{}
+)
+
+// Now returns time.Now()
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns time.After(d)
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// getClock returns the Clock configured for the namespace, falling back to the system clock
+func (ns *Namespace) getClock() Clock {
+	if ns.clock == nil {
+		return systemClock{}
+	}
+	return ns.clock
+}
+
+// until returns the duration from the namespace's current time until t
+func (ns *Namespace) until(t time.Time) time.Duration {
+	return t.Sub(ns.getClock().Now())
+}
+
+// sleep blocks for the duration d as measured by the namespace Clock, or until the context is done
+func (ns *Namespace) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ns.getClock().After(d):
+		return nil
+	}
+}
+
+// withTimeout returns a copy of the context which is cancelled once the duration d has elapsed on the namespace Clock.
+// A duration of zero or less leaves the context without a timeout.
+func (ns *Namespace) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if d <= 0 {
+		return ctx, cancel
+	}
+
+	timer := ns.getClock().After(d)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-timer:
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+// retry will attempt an action a number of times while it returns a common.Retryable error, waiting delay between each
+// attempt as measured by the namespace Clock. Errors carrying a RetryAfter delay, such as ErrServerBusy, are retried
+// after the delay the service asked for instead.
+func (ns *Namespace) retry(ctx context.Context, times int, delay time.Duration, action func() (interface{}, error)) (interface{}, error) {
+	return ns.retryWithPolicy(ctx, RetryPolicy{MaxAttempts: times, MinDelay: delay, MaxDelay: delay}, action)
+}
@@ -0,0 +1,178 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// fakeClock is a Clock which only advances when told to do so, firing any timers which have become due
+	fakeClock struct {
+		mu     sync.Mutex
+		now    time.Time
+		timers []fakeTimer
+		calls  int
+	}
+
+	fakeTimer struct {
+		at time.Time
+		ch chan time.Time
+	}
+)
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) After(d time.Duration) <-chan time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.calls++
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- fc.now
+		return ch
+	}
+	fc.timers = append(fc.timers, fakeTimer{at: fc.now.Add(d), ch: ch})
+	return ch
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+	remaining := fc.timers[:0]
+	for _, t := range fc.timers {
+		if !t.at.After(fc.now) {
+			t.ch <- fc.now
+			continue
+		}
+		remaining = append(remaining, t)
+	}
+	fc.timers = remaining
+}
+
+// waitForCalls blocks until After has been called at least n times
+func (fc *fakeClock) waitForCalls(n int) {
+	for {
+		fc.mu.Lock()
+		calls := fc.calls
+		fc.mu.Unlock()
+		if calls >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (fc *fakeClock) pending() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(fc.timers)
+}
+
+func TestNamespaceWithClock(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if assert.NoError(t, err) {
+		assert.Equal(t, now, ns.getClock().Now())
+		assert.Equal(t, 5*time.Minute, ns.until(now.Add(5*time.Minute)))
+	}
+
+	_, err = NewNamespace(NamespaceWithClock(nil))
+	assert.Error(t, err)
+}
+
+func TestNamespace_RetryUsesClock(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		_, err := ns.retry(context.Background(), 3, time.Hour, func() (interface{}, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, common.Retryable("try again")
+			}
+			return nil, nil
+		})
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		for clock.pending() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry did not complete after advancing the clock")
+	}
+}
+
+func TestNamespace_RetryStopsOnUnretryableError(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithClock(newFakeClock(time.Now())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fatal := errors.New("fatal")
+	_, err = ns.retry(context.Background(), 3, time.Hour, func() (interface{}, error) {
+		return nil, fatal
+	})
+	assert.Equal(t, fatal, err)
+}
+
+func TestNamespace_SleepHonorsContext(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithClock(newFakeClock(time.Now())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, ns.sleep(ctx, time.Hour))
+}
+
+func TestNamespace_WithTimeoutUsesClock(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := ns.withTimeout(context.Background(), time.Minute)
+	defer cancel()
+	assert.NoError(t, ctx.Err())
+
+	clock.Advance(time.Minute)
+	<-ctx.Done()
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	unbounded, cancel := ns.withTimeout(context.Background(), 0)
+	defer cancel()
+	assert.NoError(t, unbounded.Err())
+	assert.Equal(t, 0, clock.pending())
+}
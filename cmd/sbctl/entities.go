@@ -0,0 +1,454 @@
+package main
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+type (
+	// verbs are the functions implementing list, get, create and delete for a kind of entity
+	verbs map[string]func(ctx context.Context, env *environment, args []string) error
+
+	// entityRow is a line of the table listing entities
+	entityRow struct {
+		name   string
+		status *servicebus.EntityStatus
+		counts *servicebus.CountDetails
+	}
+
+	// countsView is how the message counts of an entity are printed
+	countsView struct {
+		Active             int32 `json:"active"`
+		DeadLetter         int32 `json:"deadLetter"`
+		Scheduled          int32 `json:"scheduled"`
+		Transfer           int32 `json:"transfer"`
+		TransferDeadLetter int32 `json:"transferDeadLetter"`
+	}
+)
+
+func runQueue(ctx context.Context, env *environment, args []string) error {
+	return verbs{"list": listQueues, "get": getQueue, "create": createQueue, "delete": deleteQueue}.run(ctx, env, args)
+}
+
+func runTopic(ctx context.Context, env *environment, args []string) error {
+	return verbs{"list": listTopics, "get": getTopic, "create": createTopic, "delete": deleteTopic}.run(ctx, env, args)
+}
+
+func runSubscription(ctx context.Context, env *environment, args []string) error {
+	return verbs{"list": listSubscriptions, "get": getSubscription, "create": createSubscription, "delete": deleteSubscription}.run(ctx, env, args)
+}
+
+func (v verbs) run(ctx context.Context, env *environment, args []string) error {
+	if len(args) == 0 {
+		return usagef("expected list, get, create or delete")
+	}
+	fn, ok := v[args[0]]
+	if !ok {
+		return usagef("unknown verb %q: expected list, get, create or delete", args[0])
+	}
+	return fn(ctx, env, args[1:])
+}
+
+// parseName parses the flags of a verb and returns the single entity name following them
+func parseName(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		return "", usagef("expected a single name, got %d arguments", flags.NArg())
+	}
+	return flags.Arg(0), nil
+}
+
+// parseNone parses the flags of a verb which takes no arguments
+func parseNone(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return usagef("expected no arguments, got %d", flags.NArg())
+	}
+	return nil
+}
+
+func listQueues(ctx context.Context, env *environment, args []string) error {
+	if err := parseNone(env.newFlagSet("queue list", ""), args); err != nil {
+		return err
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	queues, err := ns.NewQueueManager().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]entityRow, len(queues))
+	for i, qe := range queues {
+		rows[i] = entityRow{name: qe.Name, status: qe.Status, counts: qe.CountDetails}
+	}
+	return printRows(env.stdout, rows)
+}
+
+func getQueue(ctx context.Context, env *environment, args []string) error {
+	name, err := parseName(env.newFlagSet("queue get", "NAME"), args)
+	if err != nil {
+		return err
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	qe, err := ns.NewQueueManager().Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, qe)
+}
+
+func createQueue(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("queue create", "[flags] NAME")
+	partitioned := flags.Bool("partitioned", false, "partition the queue across message brokers")
+	sessions := flags.Bool("sessions", false, "require messages to be sent with a session ID")
+	maxDeliveries := flags.Int("max-delivery-count", 0, "deliveries after which a message is dead-lettered (default the broker's)")
+	lock := flags.Duration("lock-duration", 0, "how long a received message is locked for (default the broker's)")
+	ttl := flags.Duration("ttl", 0, "default time to live of messages (default the broker's)")
+	dedupe := flags.Duration("duplicate-detection", 0, "window in which messages with the ID of an earlier one are discarded (default disabled)")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var opts []servicebus.QueueManagementOption
+	if *partitioned {
+		opts = append(opts, servicebus.QueueEntityWithPartitioning())
+	}
+	if *sessions {
+		opts = append(opts, servicebus.QueueEntityWithRequiredSessions())
+	}
+	if *maxDeliveries > 0 {
+		opts = append(opts, servicebus.QueueEntityWithMaxDeliveryCount(int32(*maxDeliveries)))
+	}
+	if *lock > 0 {
+		opts = append(opts, servicebus.QueueEntityWithLockDuration(lock))
+	}
+	if *ttl > 0 {
+		opts = append(opts, servicebus.QueueEntityWithMessageTimeToLive(ttl))
+	}
+	if *dedupe > 0 {
+		opts = append(opts, servicebus.QueueEntityWithDuplicateDetection(dedupe))
+	}
+
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	qe, err := ns.NewQueueManager().Put(ctx, name, opts...)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, qe)
+}
+
+func deleteQueue(ctx context.Context, env *environment, args []string) error {
+	name, err := parseName(env.newFlagSet("queue delete", "NAME"), args)
+	if err != nil {
+		return err
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	return ns.NewQueueManager().Delete(ctx, name)
+}
+
+func listTopics(ctx context.Context, env *environment, args []string) error {
+	if err := parseNone(env.newFlagSet("topic list", ""), args); err != nil {
+		return err
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	topics, err := ns.NewTopicManager().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]entityRow, len(topics))
+	for i, te := range topics {
+		rows[i] = entityRow{name: te.Name, status: te.Status, counts: te.CountDetails}
+	}
+	return printRows(env.stdout, rows)
+}
+
+func getTopic(ctx context.Context, env *environment, args []string) error {
+	name, err := parseName(env.newFlagSet("topic get", "NAME"), args)
+	if err != nil {
+		return err
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	te, err := ns.NewTopicManager().Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, te)
+}
+
+func createTopic(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("topic create", "[flags] NAME")
+	partitioned := flags.Bool("partitioned", false, "partition the topic across message brokers")
+	ttl := flags.Duration("ttl", 0, "default time to live of messages (default the broker's)")
+	dedupe := flags.Duration("duplicate-detection", 0, "window in which messages with the ID of an earlier one are discarded (default disabled)")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var opts []servicebus.TopicManagementOption
+	if *partitioned {
+		opts = append(opts, servicebus.TopicWithPartitioning())
+	}
+	if *ttl > 0 {
+		opts = append(opts, servicebus.TopicWithMessageTimeToLive(ttl))
+	}
+	if *dedupe > 0 {
+		opts = append(opts, servicebus.TopicWithDuplicateDetection(dedupe))
+	}
+
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	te, err := ns.NewTopicManager().Put(ctx, name, opts...)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, te)
+}
+
+func deleteTopic(ctx context.Context, env *environment, args []string) error {
+	name, err := parseName(env.newFlagSet("topic delete", "NAME"), args)
+	if err != nil {
+		return err
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	return ns.NewTopicManager().Delete(ctx, name)
+}
+
+// subscriptionManager returns the manager of the subscriptions of the topic
+func subscriptionManager(env *environment, topic string) (*servicebus.SubscriptionManager, error) {
+	if topic == "" {
+		return nil, usagef("-topic is required")
+	}
+	ns, err := env.connect()
+	if err != nil {
+		return nil, err
+	}
+	t, err := ns.NewTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+	return t.NewSubscriptionManager(), nil
+}
+
+func listSubscriptions(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("subscription list", "-topic NAME")
+	topic := flags.String("topic", "", "name of the topic")
+	if err := parseNone(flags, args); err != nil {
+		return err
+	}
+	sm, err := subscriptionManager(env, *topic)
+	if err != nil {
+		return err
+	}
+	subs, err := sm.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]entityRow, len(subs))
+	for i, se := range subs {
+		rows[i] = entityRow{name: se.Name, status: se.Status, counts: se.CountDetails}
+	}
+	return printRows(env.stdout, rows)
+}
+
+func getSubscription(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("subscription get", "-topic NAME NAME")
+	topic := flags.String("topic", "", "name of the topic")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+	sm, err := subscriptionManager(env, *topic)
+	if err != nil {
+		return err
+	}
+	se, err := sm.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, se)
+}
+
+func createSubscription(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("subscription create", "-topic NAME [flags] NAME")
+	topic := flags.String("topic", "", "name of the topic")
+	sessions := flags.Bool("sessions", false, "require messages to be received with sessions")
+	lock := flags.Duration("lock-duration", 0, "how long a received message is locked for (default the broker's)")
+	ttl := flags.Duration("ttl", 0, "default time to live of messages (default the broker's)")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var opts []servicebus.SubscriptionManagementOption
+	if *sessions {
+		opts = append(opts, servicebus.SubscriptionWithRequiredSessions())
+	}
+	if *lock > 0 {
+		opts = append(opts, servicebus.SubscriptionWithLockDuration(lock))
+	}
+	if *ttl > 0 {
+		opts = append(opts, servicebus.SubscriptionWithMessageTimeToLive(ttl))
+	}
+
+	sm, err := subscriptionManager(env, *topic)
+	if err != nil {
+		return err
+	}
+	se, err := sm.Put(ctx, name, opts...)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, se)
+}
+
+func deleteSubscription(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("subscription delete", "-topic NAME NAME")
+	topic := flags.String("topic", "", "name of the topic")
+	name, err := parseName(flags, args)
+	if err != nil {
+		return err
+	}
+	sm, err := subscriptionManager(env, *topic)
+	if err != nil {
+		return err
+	}
+	return sm.Delete(ctx, name)
+}
+
+func runCounts(ctx context.Context, env *environment, args []string) error {
+	var t target
+	flags := env.newFlagSet("counts", "(-queue NAME | -topic NAME -subscription NAME)")
+	t.addFlags(flags, true, false)
+	if err := parseNone(flags, args); err != nil {
+		return err
+	}
+	if err := t.validate(true); err != nil {
+		return err
+	}
+
+	var counts *servicebus.CountDetails
+	if t.queue != "" {
+		ns, err := env.connect()
+		if err != nil {
+			return err
+		}
+		qe, err := ns.NewQueueManager().Get(ctx, t.queue)
+		if err != nil {
+			return err
+		}
+		counts = qe.CountDetails
+	} else {
+		sm, err := subscriptionManager(env, t.topic)
+		if err != nil {
+			return err
+		}
+		se, err := sm.Get(ctx, t.subscription)
+		if err != nil {
+			return err
+		}
+		counts = se.CountDetails
+	}
+	return printJSON(env.stdout, viewOfCounts(counts))
+}
+
+func viewOfCounts(counts *servicebus.CountDetails) countsView {
+	var view countsView
+	if counts == nil {
+		return view
+	}
+	for _, c := range []struct {
+		from *int32
+		to   *int32
+	}{
+		{counts.ActiveMessageCount, &view.Active},
+		{counts.DeadLetterMessageCount, &view.DeadLetter},
+		{counts.ScheduledMessageCount, &view.Scheduled},
+		{counts.TransferMessageCount, &view.Transfer},
+		{counts.TransferDeadLetterMessageCount, &view.TransferDeadLetter},
+	} {
+		if c.from != nil {
+			*c.to = *c.from
+		}
+	}
+	return view
+}
+
+// printRows prints entities as a table of their names, statuses and message counts
+func printRows(w io.Writer, rows []entityRow) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tACTIVE\tDEAD-LETTER\tSCHEDULED")
+	for _, row := range rows {
+		status := "-"
+		if row.status != nil {
+			status = string(*row.status)
+		}
+		counts := viewOfCounts(row.counts)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\n", row.name, status, counts.Active, counts.DeadLetter, counts.Scheduled)
+	}
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
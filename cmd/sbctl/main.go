@@ -0,0 +1,210 @@
+// Command sbctl is a command line tool for operating Service Bus namespaces, built on the servicebus package. It sends,
+// peeks and receives messages, replays dead-lettered messages, manages queues, topics and subscriptions, and reports
+// their message counts. See sbctl -h for the commands.
+package main
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+// connectionStringEnv is the environment variable the connection string is read from unless -connection-string is set
+const connectionStringEnv = "SERVICEBUS_CONNECTION_STRING"
+
+type (
+	// command is a subcommand of sbctl
+	command struct {
+		summary string
+		run     func(ctx context.Context, env *environment, args []string) error
+	}
+
+	// environment is what commands read from and write to, and how they connect to the namespace
+	environment struct {
+		stdin            io.Reader
+		stdout           io.Writer
+		stderr           io.Writer
+		connectionString string
+		namespace        *servicebus.Namespace
+	}
+
+	// usageError is returned for invalid arguments, which are reported along with the usage of the command
+	usageError struct {
+		msg string
+	}
+)
+
+var commands = map[string]command{
+	"send":         {summary: "send a message to a queue or topic", run: runSend},
+	"peek":         {summary: "browse the messages of a queue or subscription without locking them", run: runPeek},
+	"receive":      {summary: "receive and complete messages from a queue or subscription", run: runReceive},
+	"replay-dlq":   {summary: "send the dead-lettered messages of a queue back to it", run: runReplayDeadLetters},
+	"queue":        {summary: "list, get, create or delete queues", run: runQueue},
+	"topic":        {summary: "list, get, create or delete topics", run: runTopic},
+	"subscription": {summary: "list, get, create or delete the subscriptions of a topic", run: runSubscription},
+	"counts":       {summary: "show the message counts of a queue or subscription", run: runCounts},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	env := &environment{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(run(ctx, env, os.Args[1:]))
+}
+
+// run runs the command line and returns the exit code: 0 on success, 2 for invalid arguments and 1 for other errors
+func run(ctx context.Context, env *environment, args []string) int {
+	flags := flag.NewFlagSet("sbctl", flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.StringVar(&env.connectionString, "connection-string", "", "connection string of the namespace (default $"+connectionStringEnv+")")
+	flags.Usage = func() { printUsage(env.stderr, flags) }
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if env.connectionString == "" {
+		env.connectionString = os.Getenv(connectionStringEnv)
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(env.stderr, "sbctl: unknown command %q\n", name)
+		flags.Usage()
+		return 2
+	}
+
+	if err := cmd.run(ctx, env, flags.Args()[1:]); err != nil {
+		var usage usageError
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &usage):
+			fmt.Fprintf(env.stderr, "sbctl %s: %s\n", name, usage.msg)
+			return 2
+		default:
+			fmt.Fprintf(env.stderr, "sbctl %s: %v\n", name, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: sbctl [-connection-string STRING] COMMAND [ARGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-13s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run sbctl COMMAND -h for the arguments of a command.")
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// newFlagSet creates the flags of a command, which write their usage to stderr
+func (env *environment) newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet("sbctl "+name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(env.stderr, "Usage: sbctl %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// connect returns the namespace the connection string refers to, connecting on first use
+func (env *environment) connect() (*servicebus.Namespace, error) {
+	if env.namespace != nil {
+		return env.namespace, nil
+	}
+	if env.connectionString == "" {
+		return nil, usagef("no connection string: set -connection-string or $%s", connectionStringEnv)
+	}
+	ns, err := servicebus.NewNamespace(servicebus.NamespaceWithConnectionString(env.connectionString))
+	if err != nil {
+		return nil, err
+	}
+	env.namespace = ns
+	return ns, nil
+}
+
+// parseProperties parses KEY=VALUE pairs into user properties
+func parseProperties(pairs []string) (map[string]interface{}, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	props := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, usagef("property %q is not of the form KEY=VALUE", pair)
+		}
+		props[key] = value
+	}
+	return props, nil
+}
+
+// stringsFlag is a flag which may be repeated, collecting each value
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(value string) error {
+	*sf = append(*sf, value)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func runArgs(t *testing.T, args ...string) (int, string, string) {
+	t.Setenv(connectionStringEnv, "")
+	var stdout, stderr bytes.Buffer
+	env := &environment{stdin: strings.NewReader(""), stdout: &stdout, stderr: &stderr}
+	code := run(context.Background(), env, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _, stderr := runArgs(t)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: sbctl")
+	assert.Contains(t, stderr, "replay-dlq")
+
+	code, _, stderr = runArgs(t, "frobnicate")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "frobnicate"`)
+
+	code, _, _ = runArgs(t, "-h")
+	assert.Equal(t, 0, code)
+
+	code, _, stderr = runArgs(t, "peek", "-h")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stderr, "Usage: sbctl peek")
+}
+
+func TestRun_InvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"send", "hello"}, "-queue or -topic is required"},
+		{[]string{"send", "-queue", "q", "-topic", "t", "hello"}, "cannot be used together"},
+		{[]string{"send", "-queue", "q", "-property", "novalue", "hello"}, "KEY=VALUE"},
+		{[]string{"peek", "-topic", "t"}, "-subscription is required"},
+		{[]string{"receive", "-queue", "q", "-n", "0"}, "-n must be at least 1"},
+		{[]string{"replay-dlq"}, "-queue is required"},
+		{[]string{"queue"}, "expected list, get, create or delete"},
+		{[]string{"queue", "rename", "q"}, `unknown verb "rename"`},
+		{[]string{"queue", "get"}, "expected a single name"},
+		{[]string{"subscription", "get", "s"}, "-topic is required"},
+		{[]string{"send", "-queue", "q", "hello"}, "no connection string"},
+	} {
+		code, _, stderr := runArgs(t, tc.args...)
+		assert.Equal(t, 2, code, strings.Join(tc.args, " "))
+		assert.Contains(t, stderr, tc.want, strings.Join(tc.args, " "))
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	props, err := parseProperties([]string{"tenant=contoso", "expr=a=b"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"tenant": "contoso", "expr": "a=b"}, props)
+
+	props, err = parseProperties(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, props)
+
+	_, err = parseProperties([]string{"=value"})
+	assert.Error(t, err)
+}
+
+func TestViewOf(t *testing.T) {
+	seq := int64(42)
+	enqueued := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	session := "session"
+	msg := servicebus.NewMessageFromString("hello")
+	msg.ID = "id"
+	msg.Label = "greeting"
+	msg.GroupID = &session
+	msg.UserProperties = map[string]interface{}{"tenant": "contoso"}
+	msg.SystemProperties = &servicebus.SystemProperties{SequenceNumber: &seq, EnqueuedTime: &enqueued}
+
+	encoded, err := json.Marshal(viewOf(msg))
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{
+			"id": "id",
+			"sequenceNumber": 42,
+			"enqueuedTime": "2018-10-01T12:00:00Z",
+			"sessionId": "session",
+			"label": "greeting",
+			"properties": {"tenant": "contoso"},
+			"body": "hello"
+		}`, string(encoded))
+	}
+}
+
+func TestPrintRows(t *testing.T) {
+	active, deadLetter := int32(3), int32(1)
+	status := servicebus.EntityStatus("Active")
+	var out bytes.Buffer
+	err := printRows(&out, []entityRow{
+		{name: "orders", status: &status, counts: &servicebus.CountDetails{ActiveMessageCount: &active, DeadLetterMessageCount: &deadLetter}},
+		{name: "empty"},
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{"NAME", "STATUS", "ACTIVE", "DEAD-LETTER", "SCHEDULED"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"orders", "Active", "3", "1", "0"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"empty", "-", "0", "0", "0"}, strings.Fields(lines[2]))
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+const deadLetterQueueSuffix = "/$DeadLetterQueue"
+
+type (
+	// target is the queue, topic or subscription a command works on
+	target struct {
+		queue        string
+		topic        string
+		subscription string
+		deadLetter   bool
+	}
+
+	// messageView is how messages are printed, one JSON object per line
+	messageView struct {
+		ID             string                 `json:"id"`
+		SequenceNumber *int64                 `json:"sequenceNumber,omitempty"`
+		EnqueuedTime   *time.Time             `json:"enqueuedTime,omitempty"`
+		DeliveryCount  uint32                 `json:"deliveryCount,omitempty"`
+		SessionID      string                 `json:"sessionId,omitempty"`
+		CorrelationID  string                 `json:"correlationId,omitempty"`
+		Label          string                 `json:"label,omitempty"`
+		ContentType    string                 `json:"contentType,omitempty"`
+		Properties     map[string]interface{} `json:"properties,omitempty"`
+		Body           string                 `json:"body"`
+	}
+)
+
+// addFlags registers the flags selecting the target. Only commands which read messages can select a dead-letter queue.
+func (t *target) addFlags(flags *flag.FlagSet, subscriptions, deadLetter bool) {
+	flags.StringVar(&t.queue, "queue", "", "name of the queue")
+	flags.StringVar(&t.topic, "topic", "", "name of the topic")
+	if subscriptions {
+		flags.StringVar(&t.subscription, "subscription", "", "name of the subscription of the topic")
+	}
+	if deadLetter {
+		flags.BoolVar(&t.deadLetter, "dead-letter", false, "use the dead-letter queue of the queue or subscription")
+	}
+}
+
+// validate checks that exactly one of a queue, a topic or a subscription of a topic was selected
+func (t *target) validate(subscriptions bool) error {
+	switch {
+	case t.queue != "" && t.topic != "":
+		return usagef("-queue and -topic cannot be used together")
+	case t.queue != "" && t.subscription != "":
+		return usagef("-subscription requires -topic, not -queue")
+	case t.queue == "" && t.topic == "":
+		if subscriptions {
+			return usagef("-queue or -topic and -subscription is required")
+		}
+		return usagef("-queue or -topic is required")
+	case subscriptions && t.topic != "" && t.subscription == "":
+		return usagef("-subscription is required with -topic")
+	}
+	return nil
+}
+
+func (t *target) path(name string) string {
+	if t.deadLetter {
+		return name + deadLetterQueueSuffix
+	}
+	return name
+}
+
+// receiver opens the queue or subscription to read messages from
+func (t *target) receiver(ns *servicebus.Namespace) (interface {
+	Peek(ctx context.Context, options ...servicebus.PeekOption) (servicebus.MessageIterator, error)
+	ReceiveOne(ctx context.Context, handler servicebus.Handler, opts ...servicebus.ReceiveOption) error
+	Close(ctx context.Context) error
+}, error) {
+	if t.queue != "" {
+		return ns.NewQueue(t.path(t.queue))
+	}
+	topic, err := ns.NewTopic(t.topic)
+	if err != nil {
+		return nil, err
+	}
+	return topic.NewSubscription(t.path(t.subscription))
+}
+
+func runSend(ctx context.Context, env *environment, args []string) error {
+	var t target
+	var props stringsFlag
+	flags := env.newFlagSet("send", "(-queue NAME | -topic NAME) [flags] [BODY]")
+	t.addFlags(flags, false, false)
+	id := flags.String("id", "", "message ID (default a new UUID)")
+	label := flags.String("label", "", "label of the message")
+	contentType := flags.String("content-type", "", "content type of the message")
+	correlationID := flags.String("correlation-id", "", "correlation ID of the message")
+	sessionID := flags.String("session-id", "", "session ID of the message")
+	flags.Var(&props, "property", "user property of the message as KEY=VALUE, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := t.validate(false); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return usagef("expected at most one body argument, got %d", flags.NArg())
+	}
+	userProps, err := parseProperties(props)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if flags.NArg() == 1 {
+		body = []byte(flags.Arg(0))
+	} else if body, err = io.ReadAll(env.stdin); err != nil {
+		return err
+	}
+
+	msg := servicebus.NewMessage(body)
+	msg.ID = *id
+	msg.Label = *label
+	msg.ContentType = *contentType
+	msg.CorrelationID = *correlationID
+	msg.UserProperties = userProps
+	if *sessionID != "" {
+		msg.GroupID = sessionID
+	}
+
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	if t.queue != "" {
+		q, err := ns.NewQueue(t.queue)
+		if err != nil {
+			return err
+		}
+		defer q.Close(ctx)
+		return q.Send(ctx, msg)
+	}
+	topic, err := ns.NewTopic(t.topic)
+	if err != nil {
+		return err
+	}
+	defer topic.Close(ctx)
+	return topic.Send(ctx, msg)
+}
+
+func runPeek(ctx context.Context, env *environment, args []string) error {
+	var t target
+	flags := env.newFlagSet("peek", "(-queue NAME | -topic NAME -subscription NAME) [flags]")
+	t.addFlags(flags, true, true)
+	count := flags.Int("n", 10, "maximum number of messages to peek")
+	from := flags.Int64("from", 0, "sequence number to start peeking from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := t.validate(true); err != nil {
+		return err
+	}
+	if *count < 1 {
+		return usagef("-n must be at least 1")
+	}
+
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	r, err := t.receiver(ns)
+	if err != nil {
+		return err
+	}
+	defer r.Close(ctx)
+
+	opts := []servicebus.PeekOption{servicebus.PeekWithPageSize(min(*count, 100))}
+	if *from > 0 {
+		opts = append(opts, servicebus.PeekFromSequenceNumber(*from))
+	}
+	it, err := r.Peek(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(env.stdout)
+	for i := 0; i < *count; i++ {
+		msg, err := it.Next(ctx)
+		if _, ok := err.(servicebus.ErrNoMessages); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(viewOf(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runReceive(ctx context.Context, env *environment, args []string) error {
+	var t target
+	flags := env.newFlagSet("receive", "(-queue NAME | -topic NAME -subscription NAME) [flags]")
+	t.addFlags(flags, true, true)
+	count := flags.Int("n", 1, "maximum number of messages to receive")
+	wait := flags.Duration("wait", 10*time.Second, "how long to wait for each message")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := t.validate(true); err != nil {
+		return err
+	}
+	if *count < 1 {
+		return usagef("-n must be at least 1")
+	}
+	if *wait <= 0 {
+		return usagef("-wait must be greater than zero")
+	}
+
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	r, err := t.receiver(ns)
+	if err != nil {
+		return err
+	}
+	defer r.Close(ctx)
+
+	enc := json.NewEncoder(env.stdout)
+	for i := 0; i < *count; i++ {
+		var printErr error
+		err := r.ReceiveOne(ctx, servicebus.HandlerFunc(func(ctx context.Context, msg *servicebus.Message) servicebus.DispositionAction {
+			if printErr = enc.Encode(viewOf(msg)); printErr != nil {
+				return msg.Abandon()
+			}
+			return msg.Complete()
+		}), servicebus.WithMaxWaitTime(*wait))
+		if _, ok := err.(servicebus.ErrNoMessages); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if printErr != nil {
+			return printErr
+		}
+	}
+	return nil
+}
+
+func runReplayDeadLetters(ctx context.Context, env *environment, args []string) error {
+	flags := env.newFlagSet("replay-dlq", "-queue NAME [flags]")
+	queue := flags.String("queue", "", "name of the queue")
+	batch := flags.Int("batch", 0, "number of dead-lettered messages to receive at a time (default the library's)")
+	rate := flags.Float64("rate", 0, "maximum messages per second to send back, 0 for no limit")
+	ordered := flags.Bool("ordered", false, "send messages back in the order they were first enqueued")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *queue == "" {
+		return usagef("-queue is required")
+	}
+
+	var opts []servicebus.ReplayOption
+	if *batch > 0 {
+		opts = append(opts, servicebus.ReplayWithBatchSize(*batch))
+	}
+	if *rate > 0 {
+		opts = append(opts, servicebus.ReplayWithRateLimit(*rate))
+	}
+	if *ordered {
+		opts = append(opts, servicebus.ReplayInEnqueueOrder())
+	}
+
+	ns, err := env.connect()
+	if err != nil {
+		return err
+	}
+	q, err := ns.NewQueue(*queue)
+	if err != nil {
+		return err
+	}
+	defer q.Close(ctx)
+
+	replayed, err := q.ReplayDeadLetters(ctx, opts...)
+	fmt.Fprintf(env.stdout, "replayed %d messages\n", replayed)
+	return err
+}
+
+func viewOf(msg *servicebus.Message) messageView {
+	view := messageView{
+		ID:            msg.ID,
+		DeliveryCount: msg.DeliveryCount,
+		CorrelationID: msg.CorrelationID,
+		Label:         msg.Label,
+		ContentType:   msg.ContentType,
+		Properties:    msg.UserProperties,
+		Body:          string(msg.Data),
+	}
+	if msg.GroupID != nil {
+		view.SessionID = *msg.GroupID
+	}
+	if sp := msg.SystemProperties; sp != nil {
+		view.SequenceNumber = sp.SequenceNumber
+		view.EnqueuedTime = sp.EnqueuedTime
+	}
+	return view
+}
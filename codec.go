@@ -0,0 +1,261 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// JSONContentType is the content type of payloads encoded by JSONCodec
+	JSONContentType = "application/json"
+	// TextContentType is the content type of payloads encoded by TextCodec
+	TextContentType = "text/plain"
+	// MsgpackContentType is the content type of payloads encoded by MsgpackCodec
+	MsgpackContentType = "application/msgpack"
+)
+
+type (
+	// Codec encodes values into message payloads of a single content type and decodes them back. It is the one
+	// interface payloads are encoded through: CodecRegistry picks a Codec by content type, SchemaCodec provides a
+	// Codec for each schema, and NewProtoMessage and Message.UnmarshalProto use ProtobufCodec.
+	Codec interface {
+		// ContentType is the content type set on messages encoded by the codec
+		ContentType() string
+		// Encode serializes v
+		Encode(v interface{}) ([]byte, error)
+		// Decode deserializes data into v
+		Decode(data []byte, v interface{}) error
+	}
+
+	// CodecRegistry maps content types to the codecs which encode and decode them. It is safe for concurrent use.
+	CodecRegistry struct {
+		mu     sync.RWMutex
+		codecs map[string]Codec
+	}
+
+	// JSONCodec encodes values with encoding/json
+	JSONCodec struct{}
+
+	// TextCodec encodes strings, byte slices and fmt.Stringers as plain text, and decodes into *string or *[]byte
+	TextCodec struct{}
+
+	// ProtobufCodec encodes and decodes values implementing proto.Message
+	ProtobufCodec struct{}
+)
+
+// DefaultCodecRegistry is used by queues which have not been configured with their own registry, and by
+// Message.DecodeValue for messages which were not received from such a queue. It knows JSON, text, MessagePack and
+// protobuf payloads.
+var DefaultCodecRegistry = NewCodecRegistry(JSONCodec{}, TextCodec{}, MsgpackCodec{}, ProtobufCodec{})
+
+// NewCodecRegistry creates a CodecRegistry with the codecs registered
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	r := &CodecRegistry{codecs: make(map[string]Codec)}
+	for _, codec := range codecs {
+		r.Register(codec)
+	}
+	return r
+}
+
+// Register adds the codec to the registry, replacing any codec previously registered for its content type
+func (r *CodecRegistry) Register(codec Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[normalizeContentType(codec.ContentType())] = codec
+}
+
+// Lookup finds the codec for the content type. Parameters such as charset are ignored.
+func (r *CodecRegistry) Lookup(contentType string) (Codec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codec, ok := r.codecs[normalizeContentType(contentType)]
+	if !ok {
+		return nil, fmt.Errorf("no codec is registered for content type %q", contentType)
+	}
+	return codec, nil
+}
+
+// NewMessage encodes v with the codec for the content type and returns a message carrying the content type
+func (r *CodecRegistry) NewMessage(contentType string, v interface{}) (*Message, error) {
+	codec, err := r.Lookup(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := NewMessage(data)
+	msg.ContentType = codec.ContentType()
+	return msg, nil
+}
+
+// Decode decodes the payload of the message into v with the codec for the message's content type
+func (r *CodecRegistry) Decode(msg *Message, v interface{}) error {
+	if msg.ContentType == "" {
+		return ErrMissingField("ContentType")
+	}
+
+	codec, err := r.Lookup(msg.ContentType)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(msg.Data, v)
+}
+
+// DecodeValue decodes the payload of the message into v using the codec for the message's content type. Messages
+// received from a Queue configured with QueueWithCodecs use its registry; others use DefaultCodecRegistry.
+func (m *Message) DecodeValue(v interface{}) error {
+	if m.codecs != nil {
+		return m.codecs.Decode(m, v)
+	}
+	return DefaultCodecRegistry.Decode(m, v)
+}
+
+// QueueWithCodecs configures the registry SendValue encodes values with and the messages received from the Queue
+// decode their values with
+func QueueWithCodecs(registry *CodecRegistry) QueueOption {
+	return func(q *Queue) error {
+		if registry == nil {
+			return errors.New("codec registry must not be nil")
+		}
+		q.codecs = registry
+		return nil
+	}
+}
+
+// QueueWithContentType configures the content type SendValue encodes values as, which is application/json by default
+func QueueWithContentType(contentType string) QueueOption {
+	return func(q *Queue) error {
+		if contentType == "" {
+			return errors.New("content type must not be empty")
+		}
+		q.contentType = contentType
+		return nil
+	}
+}
+
+// SendValue encodes v with the codec for the queue's content type and sends it to the Queue
+func (q *Queue) SendValue(ctx context.Context, v interface{}) error {
+	registry, contentType := q.codecs, q.contentType
+	if registry == nil {
+		registry = DefaultCodecRegistry
+	}
+	if contentType == "" {
+		contentType = JSONContentType
+	}
+
+	msg, err := registry.NewMessage(contentType, v)
+	if err != nil {
+		return err
+	}
+	return q.Send(ctx, msg)
+}
+
+// ContentType returns application/json
+func (JSONCodec) ContentType() string {
+	return JSONContentType
+}
+
+// Encode marshals v to JSON
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode unmarshals the JSON data into v
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ContentType returns text/plain
+func (TextCodec) ContentType() string {
+	return TextContentType
+}
+
+// Encode returns the text of a string, byte slice or fmt.Stringer
+func (TextCodec) Encode(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case string:
+		return []byte(t), nil
+	case []byte:
+		return t, nil
+	case fmt.Stringer:
+		return []byte(t.String()), nil
+	default:
+		return nil, fmt.Errorf("cannot encode %T as text", v)
+	}
+}
+
+// Decode stores the text in a *string or *[]byte
+func (TextCodec) Decode(data []byte, v interface{}) error {
+	switch t := v.(type) {
+	case *string:
+		*t = string(data)
+	case *[]byte:
+		*t = append((*t)[:0], data...)
+	default:
+		return fmt.Errorf("cannot decode text into %T", v)
+	}
+	return nil
+}
+
+// ContentType returns application/x-protobuf
+func (ProtobufCodec) ContentType() string {
+	return ProtobufContentType
+}
+
+// Encode marshals v, which must be a proto.Message
+func (ProtobufCodec) Encode(v interface{}) ([]byte, error) {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as protobuf", v)
+	}
+	return proto.Marshal(pm)
+}
+
+// Decode unmarshals the data into v, which must be a proto.Message
+func (ProtobufCodec) Decode(data []byte, v interface{}) error {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot decode protobuf into %T", v)
+	}
+	return proto.Unmarshal(data, pm)
+}
+
+func normalizeContentType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
@@ -0,0 +1,142 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type reverseCodec struct{}
+
+func (reverseCodec) ContentType() string { return MsgpackContentType }
+
+func (reverseCodec) Encode(v interface{}) ([]byte, error) {
+	b := []byte(v.(string))
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b, nil
+}
+
+func (c reverseCodec) Decode(data []byte, v interface{}) error {
+	b, _ := c.Encode(string(data))
+	*v.(*string) = string(b)
+	return nil
+}
+
+func TestCodecRegistry_RoundTrips(t *testing.T) {
+	type order struct {
+		ID string `json:"id"`
+	}
+
+	msg, err := DefaultCodecRegistry.NewMessage(JSONContentType, order{ID: "42"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, JSONContentType, msg.ContentType)
+		assert.Equal(t, `{"id":"42"}`, string(msg.Data))
+
+		var got order
+		assert.NoError(t, msg.DecodeValue(&got))
+		assert.Equal(t, "42", got.ID)
+	}
+
+	msg, err = DefaultCodecRegistry.NewMessage(ProtobufContentType, wrapperspb.String("hello"))
+	if assert.NoError(t, err) {
+		var got wrapperspb.StringValue
+		assert.NoError(t, msg.DecodeValue(&got))
+		assert.Equal(t, "hello", got.GetValue())
+	}
+
+	msg = NewMessageFromString("plain")
+	msg.ContentType = "Text/Plain; charset=utf-8"
+	var text string
+	assert.NoError(t, msg.DecodeValue(&text))
+	assert.Equal(t, "plain", text)
+}
+
+func TestCodecRegistry_Register(t *testing.T) {
+	registry := NewCodecRegistry(JSONCodec{})
+	_, err := registry.NewMessage(MsgpackContentType, "abc")
+	assert.Error(t, err)
+
+	registry.Register(reverseCodec{})
+	msg, err := registry.NewMessage(MsgpackContentType, "abc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "cba", string(msg.Data))
+
+		var got string
+		assert.NoError(t, registry.Decode(msg, &got))
+		assert.Equal(t, "abc", got)
+	}
+}
+
+func TestCodecRegistry_DecodeErrors(t *testing.T) {
+	var v string
+	assert.Error(t, NewMessageFromString("no content type").DecodeValue(&v))
+
+	msg := NewMessageFromString("x")
+	msg.ContentType = "application/unknown"
+	assert.Error(t, msg.DecodeValue(&v))
+
+	_, err := DefaultCodecRegistry.NewMessage(ProtobufContentType, "not a proto")
+	assert.Error(t, err)
+}
+
+func TestQueueCodecOptions(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	registry := NewCodecRegistry(reverseCodec{})
+	q, err := ns.NewQueue("orders", QueueWithCodecs(registry), QueueWithContentType(MsgpackContentType))
+	if assert.NoError(t, err) {
+		assert.Equal(t, registry, q.codecs)
+		assert.Equal(t, MsgpackContentType, q.contentType)
+	}
+
+	opts := q.receiverOptions()
+	r := new(receiver)
+	for _, opt := range opts {
+		assert.NoError(t, opt(r))
+	}
+	assert.True(t, r.codecs == registry, "messages received from the queue decode with its registry")
+
+	_, err = ns.NewQueue("orders", QueueWithCodecs(nil))
+	assert.Error(t, err)
+	_, err = ns.NewQueue("orders", QueueWithContentType(""))
+	assert.Error(t, err)
+}
+
+func TestMessage_DecodeValueWithItsQueuesRegistry(t *testing.T) {
+	msg := NewMessageFromString("cba")
+	msg.ContentType = MsgpackContentType
+	msg.codecs = NewCodecRegistry(reverseCodec{})
+
+	var got string
+	if assert.NoError(t, msg.DecodeValue(&got)) {
+		assert.Equal(t, "abc", got, "the queue's codec replaces the default MessagePack codec")
+	}
+}
@@ -0,0 +1,126 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-service-bus-go/atom"
+)
+
+type (
+	// ConsumerGroupOption provides a way to customize the subscription backing a consumer group
+	ConsumerGroupOption func(*consumerGroupOptions) error
+
+	consumerGroupOptions struct {
+		filter              FilterDescriber
+		action              ActionDescriber
+		managementOptions   []SubscriptionManagementOption
+		subscriptionOptions []SubscriptionOption
+	}
+)
+
+// ConsumerGroupWithFilter configures the consumer group to receive only the messages selected by the filter and, if
+// action is not nil, to modify them with the action. The filter replaces the $Default rule of the subscription.
+func ConsumerGroupWithFilter(filter FilterDescriber, action ActionDescriber) ConsumerGroupOption {
+	return func(o *consumerGroupOptions) error {
+		if filter == nil {
+			return errors.New("consumer group filter must not be nil")
+		}
+		o.filter = filter
+		o.action = action
+		return nil
+	}
+}
+
+// ConsumerGroupWithSubscriptionManagementOptions configures the subscription created for a new consumer group. The
+// options are not applied to the subscription of an existing consumer group.
+func ConsumerGroupWithSubscriptionManagementOptions(opts ...SubscriptionManagementOption) ConsumerGroupOption {
+	return func(o *consumerGroupOptions) error {
+		o.managementOptions = append(o.managementOptions, opts...)
+		return nil
+	}
+}
+
+// ConsumerGroupWithSubscriptionOptions configures the Subscription client returned for the consumer group
+func ConsumerGroupWithSubscriptionOptions(opts ...SubscriptionOption) ConsumerGroupOption {
+	return func(o *consumerGroupOptions) error {
+		o.subscriptionOptions = append(o.subscriptionOptions, opts...)
+		return nil
+	}
+}
+
+// ConsumerGroup emulates an Event Hubs consumer group on the topic: it creates the subscription named after the group
+// if it does not exist yet, applies the filter of ConsumerGroupWithFilter, if any, to it, and returns a Subscription
+// client to receive the group's messages. Every consumer group gets its own copy of each message sent to the topic,
+// while the receivers of a single group compete for its messages. Calling ConsumerGroup again with the same name and
+// filter is harmless, so each instance of a service can call it as it starts.
+func (t *Topic) ConsumerGroup(ctx context.Context, name string, opts ...ConsumerGroupOption) (*Subscription, error) {
+	span, ctx := t.startSpanFromContext(ctx, "sb.Topic.ConsumerGroup")
+	defer span.End()
+
+	return t.consumerGroup(ctx, t.NewSubscriptionManager(), name, opts...)
+}
+
+func (t *Topic) consumerGroup(ctx context.Context, sm *SubscriptionManager, name string, opts ...ConsumerGroupOption) (*Subscription, error) {
+	if name == "" {
+		return nil, errors.New("consumer group name must not be empty")
+	}
+
+	options := new(consumerGroupOptions)
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+	}
+
+	existing, err := sm.Get(ctx, name)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+	if existing == nil {
+		_, err := sm.Put(ctx, name, options.managementOptions...)
+		// another instance starting at the same time may have created the subscription since it was fetched
+		if mgmtErr, ok := err.(*atom.ManagementError); ok && mgmtErr.Code == http.StatusConflict {
+			err = nil
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+	}
+
+	if options.filter != nil {
+		if _, err := sm.ReplaceDefaultRule(ctx, name, options.filter, options.action); err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+	}
+
+	return t.NewSubscription(name, options.subscriptionOptions...)
+}
@@ -0,0 +1,99 @@
+package servicebus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+	"github.com/stretchr/testify/assert"
+)
+
+// consumerGroupServer serves the management requests made to provision a consumer group, recording them
+type consumerGroupServer struct {
+	mu       sync.Mutex
+	exists   bool
+	conflict bool
+	requests []string
+}
+
+func (s *consumerGroupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	const entry = `<entry xmlns="http://www.w3.org/2005/Atom"><title>%s</title><content type="application/xml">` +
+		`<%s xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"></%[2]s></content></entry>`
+	switch {
+	case strings.Contains(r.URL.Path, "/rules/"):
+		fmt.Fprintf(w, entry, "$Default", "RuleDescription")
+	case r.Method == http.MethodGet && !s.exists:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPut && s.conflict:
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, `<Error><Code>409</Code><Detail>The messaging entity already exists.</Detail></Error>`)
+	default:
+		s.exists = true
+		fmt.Fprintf(w, entry, "billing", "SubscriptionDescription")
+	}
+}
+
+func newConsumerGroupTopic(t *testing.T, server *httptest.Server) (*Topic, *SubscriptionManager) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	topic, err := ns.NewTopic("orders")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	sm := topic.NewSubscriptionManager()
+	sm.entityManager = &entityManager{EntityManager: atom.NewEntityManager(server.URL+"/", staticTokenProvider("token"))}
+	return topic, sm
+}
+
+func TestTopic_ConsumerGroupProvisionsSubscriptionAndFilter(t *testing.T) {
+	backend := new(consumerGroupServer)
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	topic, sm := newConsumerGroupTopic(t, server)
+
+	ctx := context.Background()
+	sub, err := topic.consumerGroup(ctx, sm, "billing",
+		ConsumerGroupWithFilter(SQLFilter{Expression: "region = 'eu'"}, nil),
+		ConsumerGroupWithSubscriptionOptions(SubscriptionWithPrefetchCount(10)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "billing", sub.Name)
+		assert.Equal(t, uint32(10), sub.prefetchCount)
+	}
+	assert.Equal(t, []string{
+		"GET /orders/subscriptions/billing",
+		"PUT /orders/subscriptions/billing",
+		"PUT /orders/subscriptions/billing/rules/$Default",
+	}, backend.requests)
+
+	backend.requests = nil
+	_, err = topic.consumerGroup(ctx, sm, "billing")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /orders/subscriptions/billing"}, backend.requests,
+		"an existing consumer group is not created again")
+}
+
+func TestTopic_ConsumerGroupCreatedConcurrently(t *testing.T) {
+	backend := &consumerGroupServer{conflict: true}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	topic, sm := newConsumerGroupTopic(t, server)
+
+	_, err := topic.consumerGroup(context.Background(), sm, "billing")
+	assert.NoError(t, err)
+
+	_, err = topic.consumerGroup(context.Background(), sm, "")
+	assert.Error(t, err)
+	_, err = topic.consumerGroup(context.Background(), sm, "billing", ConsumerGroupWithFilter(nil, nil))
+	assert.Error(t, err)
+}
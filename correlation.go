@@ -0,0 +1,143 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+)
+
+type (
+	// CorrelationOption configures the handler created by NewCorrelationHandler
+	CorrelationOption func(*correlationHandler) error
+
+	// correlationHandler puts the correlation id of each message into the context of the handler it wraps
+	correlationHandler struct {
+		handler  Handler
+		property string
+		fallback func(*Message) string
+	}
+
+	// correlation is the correlation id carried by a context, and the user property it is read from and written to, or
+	// an empty property for the CorrelationID of messages
+	correlation struct {
+		id       string
+		property string
+	}
+
+	correlationKey struct{}
+)
+
+// CorrelationWithProperty configures the correlation id to be read from and written to the user property, rather than
+// the CorrelationID of messages, for systems which already use CorrelationID to match replies to requests
+func CorrelationWithProperty(property string) CorrelationOption {
+	return func(ch *correlationHandler) error {
+		if property == "" {
+			return errors.New("property must not be empty")
+		}
+		ch.property = property
+		return nil
+	}
+}
+
+// CorrelationWithoutFallback configures messages without a correlation id to be handled with a context carrying none,
+// rather than starting a new correlation from their message ID
+func CorrelationWithoutFallback() CorrelationOption {
+	return func(ch *correlationHandler) error {
+		ch.fallback = nil
+		return nil
+	}
+}
+
+// NewCorrelationHandler wraps the handler so it is passed a context carrying the correlation id of each message, which
+// is the message's CorrelationID or, for a message without one, its ID. Messages sent by a Queue or Topic with that
+// context, or a context derived from it, are given the same correlation id unless they have one already, so the id
+// follows the work from hop to hop without each handler copying it across.
+func NewCorrelationHandler(handler Handler, opts ...CorrelationOption) (Handler, error) {
+	if handler == nil {
+		return nil, errors.New("handler must not be nil")
+	}
+
+	ch := &correlationHandler{
+		handler: handler,
+		fallback: func(msg *Message) string {
+			return msg.ID
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(ch); err != nil {
+			return nil, err
+		}
+	}
+	return ch, nil
+}
+
+// Handle passes the message to the wrapped handler with its correlation id in the context
+func (ch *correlationHandler) Handle(ctx context.Context, msg *Message) DispositionAction {
+	id := correlationIDOf(msg, ch.property)
+	if id == "" && ch.fallback != nil {
+		id = ch.fallback(msg)
+	}
+	if id != "" {
+		ctx = context.WithValue(ctx, correlationKey{}, correlation{id: id, property: ch.property})
+	}
+	return ch.handler.Handle(ctx, msg)
+}
+
+// ContextWithCorrelationID returns a copy of the context carrying the correlation id, for sending messages correlated
+// with work which did not start from a message handled by a NewCorrelationHandler. The id is written to the same
+// property as the correlation id the context already carries, if any.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	c, _ := ctx.Value(correlationKey{}).(correlation)
+	c.id = id
+	return context.WithValue(ctx, correlationKey{}, c)
+}
+
+// CorrelationIDFromContext returns the correlation id carried by the context
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	c, ok := ctx.Value(correlationKey{}).(correlation)
+	return c.id, ok && c.id != ""
+}
+
+// stampCorrelation gives the message the correlation id carried by the context, unless it has one already
+func stampCorrelation(ctx context.Context, msg *Message) {
+	c, ok := ctx.Value(correlationKey{}).(correlation)
+	if !ok || c.id == "" || correlationIDOf(msg, c.property) != "" {
+		return
+	}
+	if c.property == "" {
+		msg.CorrelationID = c.id
+		return
+	}
+	msg.Set(c.property, c.id)
+}
+
+// correlationIDOf returns the correlation id of the message held in the property, or in its CorrelationID if the
+// property is empty
+func correlationIDOf(msg *Message, property string) string {
+	if property == "" {
+		return msg.CorrelationID
+	}
+	id, _ := msg.UserProperties[property].(string)
+	return id
+}
@@ -0,0 +1,342 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const xmlSchema = "http://www.w3.org/2001/XMLSchema"
+
+type (
+	// CorrelationProperties are the user properties a CorrelationFilter matches. Values must be strings, booleans,
+	// integers, floats or times.
+	CorrelationProperties map[string]interface{}
+
+	// CorrelationFilterOption configures a CorrelationFilter built by NewCorrelationFilter
+	CorrelationFilterOption func(*CorrelationFilter) error
+
+	correlationProperty struct {
+		Key   string             `xml:"Key"`
+		Value correlationPropVal `xml:"Value"`
+	}
+
+	correlationPropVal struct {
+		Type  string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+// NewCorrelationFilter builds a CorrelationFilter from the options, for example
+//
+//	NewCorrelationFilter(CorrelationFilterWithLabel("order"), CorrelationFilterWithProperty("region", "emea"))
+func NewCorrelationFilter(opts ...CorrelationFilterOption) (*CorrelationFilter, error) {
+	cf := new(CorrelationFilter)
+	for _, opt := range opts {
+		if err := opt(cf); err != nil {
+			return nil, err
+		}
+	}
+	return cf, nil
+}
+
+// CorrelationFilterWithCorrelationID matches messages with the correlation ID
+func CorrelationFilterWithCorrelationID(correlationID string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.CorrelationID = to.StringPtr(correlationID)
+		return nil
+	}
+}
+
+// CorrelationFilterWithMessageID matches messages with the message ID
+func CorrelationFilterWithMessageID(messageID string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.MessageID = to.StringPtr(messageID)
+		return nil
+	}
+}
+
+// CorrelationFilterWithTo matches messages addressed to the value
+func CorrelationFilterWithTo(address string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.To = to.StringPtr(address)
+		return nil
+	}
+}
+
+// CorrelationFilterWithReplyTo matches messages with the reply to address
+func CorrelationFilterWithReplyTo(replyTo string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.ReplyTo = to.StringPtr(replyTo)
+		return nil
+	}
+}
+
+// CorrelationFilterWithLabel matches messages with the label
+func CorrelationFilterWithLabel(label string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.Label = to.StringPtr(label)
+		return nil
+	}
+}
+
+// CorrelationFilterWithSessionID matches messages sent in the session, which is the GroupID of the message
+func CorrelationFilterWithSessionID(sessionID string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.SessionID = to.StringPtr(sessionID)
+		return nil
+	}
+}
+
+// CorrelationFilterWithReplyToSessionID matches messages with the reply to session, which is the ReplyToGroupID of the
+// message
+func CorrelationFilterWithReplyToSessionID(sessionID string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.ReplyToSessionID = to.StringPtr(sessionID)
+		return nil
+	}
+}
+
+// CorrelationFilterWithContentType matches messages with the content type
+func CorrelationFilterWithContentType(contentType string) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		cf.ContentType = to.StringPtr(contentType)
+		return nil
+	}
+}
+
+// CorrelationFilterWithProperty matches messages with the user property set to the value
+func CorrelationFilterWithProperty(key string, value interface{}) CorrelationFilterOption {
+	return func(cf *CorrelationFilter) error {
+		if _, _, err := correlationPropertyValue(value); err != nil {
+			return err
+		}
+		if cf.Properties == nil {
+			cf.Properties = make(CorrelationProperties)
+		}
+		cf.Properties[key] = value
+		return nil
+	}
+}
+
+// Matches reports whether the message would be selected by the correlation filter, which lets senders and tests verify
+// which subscriptions a message will reach. An empty filter matches every message.
+func (m *Message) Matches(filter CorrelationFilter) bool {
+	matches := func(expected *string, actual string) bool {
+		return expected == nil || *expected == actual
+	}
+
+	var sessionID string
+	if m.GroupID != nil {
+		sessionID = *m.GroupID
+	}
+
+	if !matches(filter.CorrelationID, m.CorrelationID) ||
+		!matches(filter.MessageID, m.ID) ||
+		!matches(filter.To, m.To) ||
+		!matches(filter.ReplyTo, m.ReplyTo) ||
+		!matches(filter.Label, m.Label) ||
+		!matches(filter.SessionID, sessionID) ||
+		!matches(filter.ReplyToSessionID, m.ReplyToGroupID) ||
+		!matches(filter.ContentType, m.ContentType) {
+		return false
+	}
+
+	for key, expected := range filter.Properties {
+		actual, ok := m.UserProperties[key]
+		if !ok {
+			return false
+		}
+		expectedType, expectedValue, err := correlationPropertyValue(expected)
+		if err != nil {
+			return false
+		}
+		actualType, actualValue, err := correlationPropertyValue(actual)
+		if err != nil || !sameKind(expectedType, actualType) || expectedValue != actualValue {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalXML writes the properties as the serialized dictionary the Service Bus management API expects
+func (cp CorrelationProperties) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(cp) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(cp))
+	for key := range cp {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		typ, val, err := correlationPropertyValue(cp[key])
+		if err != nil {
+			return err
+		}
+
+		item := xml.StartElement{Name: xml.Name{Local: "KeyValueOfstringanyType"}}
+		value := xml.StartElement{
+			Name: xml.Name{Local: "Value"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "i:type"}, Value: "d6p1:" + typ},
+				{Name: xml.Name{Local: "xmlns:d6p1"}, Value: xmlSchema},
+			},
+		}
+		err = encodeTokens(e,
+			item,
+			xml.StartElement{Name: xml.Name{Local: "Key"}}, xml.CharData(key), xml.EndElement{Name: xml.Name{Local: "Key"}},
+			value, xml.CharData(val), value.End(),
+			item.End())
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// UnmarshalXML reads the properties from the serialized dictionary returned by the Service Bus management API
+func (cp *CorrelationProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var items struct {
+		Properties []correlationProperty `xml:"KeyValueOfstringanyType"`
+	}
+	if err := d.DecodeElement(&items, &start); err != nil {
+		return err
+	}
+
+	if len(items.Properties) == 0 {
+		return nil
+	}
+
+	props := make(CorrelationProperties, len(items.Properties))
+	for _, prop := range items.Properties {
+		val, err := parseCorrelationPropertyValue(prop.Value)
+		if err != nil {
+			return fmt.Errorf("correlation filter property %q: %v", prop.Key, err)
+		}
+		props[prop.Key] = val
+	}
+	*cp = props
+	return nil
+}
+
+func encodeTokens(e *xml.Encoder, tokens ...xml.Token) error {
+	for _, token := range tokens {
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// correlationPropertyValue returns the XML schema type and serialized form of a correlation filter property value
+func correlationPropertyValue(v interface{}) (string, string, error) {
+	switch val := v.(type) {
+	case string:
+		return "string", val, nil
+	case bool:
+		return "boolean", strconv.FormatBool(val), nil
+	case int:
+		return "long", strconv.FormatInt(int64(val), 10), nil
+	case int8:
+		return "byte", strconv.FormatInt(int64(val), 10), nil
+	case int16:
+		return "short", strconv.FormatInt(int64(val), 10), nil
+	case int32:
+		return "int", strconv.FormatInt(int64(val), 10), nil
+	case int64:
+		return "long", strconv.FormatInt(val, 10), nil
+	case uint8:
+		return "unsignedByte", strconv.FormatUint(uint64(val), 10), nil
+	case uint16:
+		return "unsignedShort", strconv.FormatUint(uint64(val), 10), nil
+	case uint32:
+		return "unsignedInt", strconv.FormatUint(uint64(val), 10), nil
+	case uint64:
+		return "unsignedLong", strconv.FormatUint(val, 10), nil
+	case float32:
+		return "float", strconv.FormatFloat(float64(val), 'g', -1, 32), nil
+	case float64:
+		return "double", strconv.FormatFloat(val, 'g', -1, 64), nil
+	case time.Time:
+		return "dateTime", val.UTC().Format(time.RFC3339Nano), nil
+	default:
+		return "", "", fmt.Errorf("correlation filter properties do not support values of type %T", v)
+	}
+}
+
+func parseCorrelationPropertyValue(v correlationPropVal) (interface{}, error) {
+	typ := v.Type
+	for i := len(typ) - 1; i >= 0; i-- {
+		if typ[i] == ':' {
+			typ = typ[i+1:]
+			break
+		}
+	}
+
+	switch typ {
+	case "string", "":
+		return v.Value, nil
+	case "boolean":
+		return strconv.ParseBool(v.Value)
+	case "byte", "short", "int", "long":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "unsignedByte", "unsignedShort", "unsignedInt", "unsignedLong":
+		return strconv.ParseUint(v.Value, 10, 64)
+	case "float", "double":
+		return strconv.ParseFloat(v.Value, 64)
+	case "dateTime":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	default:
+		return nil, fmt.Errorf("unsupported type %q", v.Type)
+	}
+}
+
+// sameKind reports whether two XML schema types hold comparable values, so an int property matches an int64 filter
+func sameKind(a, b string) bool {
+	return kindOf(a) == kindOf(b)
+}
+
+func kindOf(typ string) string {
+	switch typ {
+	case "byte", "short", "int", "long":
+		return "signed"
+	case "unsignedByte", "unsignedShort", "unsignedInt", "unsignedLong":
+		return "unsigned"
+	case "float", "double":
+		return "float"
+	default:
+		return typ
+	}
+}
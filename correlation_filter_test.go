@@ -0,0 +1,107 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCorrelationFilter(t *testing.T) {
+	cf, err := NewCorrelationFilter(
+		CorrelationFilterWithLabel("order"),
+		CorrelationFilterWithSessionID("customer-1"),
+		CorrelationFilterWithProperty("region", "emea"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "order", *cf.Label)
+	assert.Equal(t, "customer-1", *cf.SessionID)
+	assert.Equal(t, CorrelationProperties{"region": "emea"}, cf.Properties)
+
+	_, err = NewCorrelationFilter(CorrelationFilterWithProperty("tags", []string{"a"}))
+	assert.Error(t, err)
+}
+
+func TestMessage_Matches(t *testing.T) {
+	cf, err := NewCorrelationFilter(
+		CorrelationFilterWithLabel("order"),
+		CorrelationFilterWithSessionID("customer-1"),
+		CorrelationFilterWithProperty("priority", int64(3)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	newMsg := func() *Message {
+		msg := NewMessageFromString("hello")
+		msg.Label = "order"
+		msg.GroupID = ptrString("customer-1")
+		msg.UserProperties = map[string]interface{}{"priority": 3}
+		return msg
+	}
+
+	assert.True(t, newMsg().Matches(*cf))
+	assert.True(t, newMsg().Matches(CorrelationFilter{}), "an empty filter matches everything")
+
+	wrongLabel := newMsg()
+	wrongLabel.Label = "invoice"
+	assert.False(t, wrongLabel.Matches(*cf))
+
+	noSession := newMsg()
+	noSession.GroupID = nil
+	assert.False(t, noSession.Matches(*cf))
+
+	missingProperty := newMsg()
+	delete(missingProperty.UserProperties, "priority")
+	assert.False(t, missingProperty.Matches(*cf))
+
+	differentType := newMsg()
+	differentType.Set("priority", "3")
+	assert.False(t, differentType.Matches(*cf))
+}
+
+func TestCorrelationProperties_XMLRoundTrip(t *testing.T) {
+	cf, err := NewCorrelationFilter(
+		CorrelationFilterWithCorrelationID("abc"),
+		CorrelationFilterWithProperty("region", "emea"),
+		CorrelationFilterWithProperty("priority", int32(3)),
+		CorrelationFilterWithProperty("urgent", true))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	b, err := xml.Marshal(newRuleEntry(cf, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(b), `<KeyValueOfstringanyType><Key>region</Key><Value i:type="d6p1:string" xmlns:d6p1="http://www.w3.org/2001/XMLSchema">emea</Value></KeyValueOfstringanyType>`)
+
+	var entry ruleEntry
+	if assert.NoError(t, xml.Unmarshal(b, &entry)) {
+		filter := entry.Content.RuleDescription.Filter
+		assert.Equal(t, "abc", *filter.CorrelationID)
+		assert.Equal(t, CorrelationProperties{"region": "emea", "priority": int64(3), "urgent": true}, filter.Properties)
+	}
+}
@@ -0,0 +1,105 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// correlatedSend handles messages by building the message a handler would send on, stamped as a Queue would stamp it
+func correlatedSend(t *testing.T, opts ...CorrelationOption) (Handler, *[]*Message) {
+	var sent []*Message
+	handler, err := NewCorrelationHandler(HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		next := NewMessageFromString("next hop")
+		stampCorrelation(ctx, next)
+		sent = append(sent, next)
+		return nil
+	}), opts...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return handler, &sent
+}
+
+func TestCorrelationHandler_PropagatesCorrelationID(t *testing.T) {
+	handler, sent := correlatedSend(t)
+
+	msg := NewMessageFromString("first hop")
+	msg.ID = "message-id"
+	msg.CorrelationID = "order-42"
+	handler.Handle(context.Background(), msg)
+
+	uncorrelated := NewMessageFromString("first hop")
+	uncorrelated.ID = "message-id"
+	handler.Handle(context.Background(), uncorrelated)
+
+	if assert.Len(t, *sent, 2) {
+		assert.Equal(t, "order-42", (*sent)[0].CorrelationID)
+		assert.Equal(t, "message-id", (*sent)[1].CorrelationID, "a message without a correlation id starts one")
+	}
+}
+
+func TestCorrelationHandler_WithProperty(t *testing.T) {
+	handler, sent := correlatedSend(t, CorrelationWithProperty("x-correlation"))
+
+	msg := NewMessageFromString("first hop")
+	msg.CorrelationID = "reply-to-request"
+	msg.Set("x-correlation", "order-42")
+	handler.Handle(context.Background(), msg)
+
+	if assert.Len(t, *sent, 1) {
+		assert.Equal(t, "order-42", (*sent)[0].UserProperties["x-correlation"])
+		assert.Empty(t, (*sent)[0].CorrelationID)
+	}
+
+	_, err := NewCorrelationHandler(HandlerFunc(func(context.Context, *Message) DispositionAction { return nil }),
+		CorrelationWithProperty(""))
+	assert.Error(t, err)
+}
+
+func TestCorrelationHandler_WithoutFallback(t *testing.T) {
+	var correlated bool
+	handler, err := NewCorrelationHandler(HandlerFunc(func(ctx context.Context, _ *Message) DispositionAction {
+		_, correlated = CorrelationIDFromContext(ctx)
+		return nil
+	}), CorrelationWithoutFallback())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := NewMessageFromString("first hop")
+	msg.ID = "message-id"
+	handler.Handle(context.Background(), msg)
+	assert.False(t, correlated)
+
+	_, err = NewCorrelationHandler(nil)
+	assert.Error(t, err)
+}
+
+func TestStampCorrelation(t *testing.T) {
+	msg := NewMessageFromString("hello")
+	stampCorrelation(context.Background(), msg)
+	assert.Empty(t, msg.CorrelationID)
+
+	ctx := ContextWithCorrelationID(context.Background(), "order-42")
+	id, ok := CorrelationIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "order-42", id)
+
+	stampCorrelation(ctx, msg)
+	assert.Equal(t, "order-42", msg.CorrelationID)
+
+	own := NewMessageFromString("hello")
+	own.CorrelationID = "mine"
+	stampCorrelation(ctx, own)
+	assert.Equal(t, "mine", own.CorrelationID, "a correlation id set by the sender is kept")
+
+	// a correlation id replaced within a handler keeps the property the handler reads from
+	handlerCtx := context.WithValue(context.Background(), correlationKey{}, correlation{id: "order-42", property: "x-correlation"})
+	replaced := ContextWithCorrelationID(handlerCtx, "order-43")
+	stamped := NewMessageFromString("hello")
+	stampCorrelation(replaced, stamped)
+	assert.Equal(t, "order-43", stamped.UserProperties["x-correlation"])
+	assert.Empty(t, stamped.CorrelationID)
+}
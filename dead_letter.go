@@ -0,0 +1,212 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// deadLetterQueueSuffix addresses the dead-letter queue of an entity when appended to its path
+	deadLetterQueueSuffix = "/$DeadLetterQueue"
+
+	// purgeWaitTime is how long a purge waits for the next dead-lettered message before concluding there are no more
+	purgeWaitTime = 5 * time.Second
+
+	// sweepPeekPageSize is how many messages are peeked at once while looking for the end of a sweep
+	sweepPeekPageSize = 100
+)
+
+// ErrSweepIncomplete is returned, along with the number of messages handled so far, when a purge or sweep runs for
+// longer than the lock duration of the entity, so that messages it held back were delivered to it again before it
+// reached the last one. Running it again continues where it stopped.
+var ErrSweepIncomplete = errors.New("servicebus: locks expired before the sweep reached the last message")
+
+type (
+	// sweepBound ends a sweep at the newest message the entity held when the sweep started, which is found by peeking,
+	// and notices when a message held back is delivered again because its lock expired
+	sweepBound struct {
+		last       int64
+		seen       map[int64]bool
+		done       bool
+		incomplete bool
+	}
+
+	// deadLetterPurge decides which dead-lettered messages a purge removes
+	deadLetterPurge struct {
+		sweepBound
+		before time.Time
+		purged int
+	}
+)
+
+// DeadLetterCount returns the number of messages in the Subscription's dead-letter queue
+func (s *Subscription) DeadLetterCount(ctx context.Context) (int64, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.DeadLetterCount")
+	defer span.End()
+
+	sm, err := s.namespace.NewSubscriptionManager(s.Topic.Name)
+	if err != nil {
+		return 0, err
+	}
+	se, err := sm.Get(ctx, s.Name)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+	if se == nil {
+		return 0, ErrEntityNotFound{EntityPath: s.entityPath()}
+	}
+	return deadLetterCount(se.CountDetails)
+}
+
+// PurgeDeadLetters removes the messages enqueued before the given time from the Subscription's dead-letter queue and
+// returns how many were removed, for example to clean up once the cause of an incident has been resolved. The purge
+// stops at the newest message in the dead-letter queue when it started. Newer messages are locked while the purge
+// runs and are released, untouched, when it finishes, so a purge of a large dead-letter queue should finish within
+// the lock duration of the subscription; ErrSweepIncomplete is returned with the count so far if it does not.
+func (s *Subscription) PurgeDeadLetters(ctx context.Context, before time.Time) (int, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.PurgeDeadLetters")
+	defer span.End()
+
+	p := newDeadLetterPurge(before)
+	err := s.namespace.sweep(ctx, s.entityPath()+deadLetterQueueSuffix, p.handle, &p.sweepBound)
+	if err != nil {
+		log.For(ctx).Error(err)
+	}
+	return p.purged, err
+}
+
+// sweep receives the messages of the entity, up to the newest one it held when the sweep started, and passes them to
+// handle. The end is found by peeking, which neither locks the messages nor counts as a delivery of them.
+func (ns *Namespace) sweep(ctx context.Context, entityPath string, handle HandlerFunc, bound *sweepBound) error {
+	r, err := ns.newReceiver(ctx, entityPath, receiverWithReceiveMode(PeekLockMode))
+	if err != nil {
+		return err
+	}
+	// closing the receiver releases the locks on the messages held back
+	defer r.Close(ctx)
+
+	last, ok, err := lastSequenceNumber(ctx, &entity{Name: entityPath, namespace: ns}, entityPath, r)
+	if err != nil || !ok {
+		return err
+	}
+	bound.last = last
+
+	for !bound.done {
+		err := r.ReceiveOne(ctx, handle, purgeWaitTime)
+		if _, ok := err.(ErrNoMessages); ok {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bound.err()
+}
+
+// lastSequenceNumber peeks through the entity for the sequence number of its newest message. ok is false if the entity
+// has no messages.
+func lastSequenceNumber(ctx context.Context, e *entity, entityPath string, r *receiver) (last int64, ok bool, err error) {
+	it, err := newPeekIterator(e, entityPath, r.connection, PeekWithPageSize(sweepPeekPageSize))
+	if err != nil {
+		return 0, false, err
+	}
+
+	for {
+		msg, err := it.Next(ctx)
+		if _, done := err.(ErrNoMessages); done {
+			return last, ok, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		if sp := msg.SystemProperties; sp != nil && sp.SequenceNumber != nil && (!ok || *sp.SequenceNumber > last) {
+			last, ok = *sp.SequenceNumber, true
+		}
+	}
+}
+
+func newSweepBound() sweepBound {
+	return sweepBound{seen: make(map[int64]bool)}
+}
+
+// pass records the delivery of msg and reports whether the sweep should leave it be, because it was enqueued after the
+// sweep started or it was held back and has been delivered again. Either ends the sweep.
+func (b *sweepBound) pass(msg *Message) bool {
+	sp := msg.SystemProperties
+	if sp == nil || sp.SequenceNumber == nil {
+		return false
+	}
+
+	seq := *sp.SequenceNumber
+	switch {
+	case b.seen[seq]:
+		// a lock expired before the sweep reached its last message
+		b.done, b.incomplete = true, true
+		return true
+	case seq > b.last:
+		b.done = true
+		return true
+	}
+
+	b.seen[seq] = true
+	b.done = seq == b.last
+	return false
+}
+
+// err reports whether the sweep stopped short of its last message
+func (b *sweepBound) err() error {
+	if b.incomplete {
+		return ErrSweepIncomplete
+	}
+	return nil
+}
+
+func newDeadLetterPurge(before time.Time) *deadLetterPurge {
+	return &deadLetterPurge{
+		sweepBound: newSweepBound(),
+		before:     before,
+	}
+}
+
+// handle completes messages enqueued before the cut-off and holds on to the others, without settling them, so they
+// are not delivered again while the purge runs
+func (p *deadLetterPurge) handle(ctx context.Context, msg *Message) DispositionAction {
+	hold := func(context.Context) {}
+
+	if p.pass(msg) {
+		return hold
+	}
+
+	sp := msg.SystemProperties
+	if sp == nil || sp.EnqueuedTime == nil || !sp.EnqueuedTime.Before(p.before) {
+		return hold
+	}
+	p.purged++
+	return msg.Complete()
+}
@@ -0,0 +1,66 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func deadLetteredMessage(seq int64, enqueued time.Time) *Message {
+	msg := NewMessageFromString("dead")
+	msg.SystemProperties = &SystemProperties{SequenceNumber: &seq, EnqueuedTime: &enqueued}
+	return msg
+}
+
+func TestDeadLetterPurge(t *testing.T) {
+	cutoff := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	p := newDeadLetterPurge(cutoff)
+	p.last = 5
+	ctx := context.Background()
+
+	assert.NotNil(t, p.handle(ctx, deadLetteredMessage(1, cutoff.Add(-time.Hour))))
+	assert.NotNil(t, p.handle(ctx, deadLetteredMessage(2, cutoff.Add(time.Hour))))
+	assert.NotNil(t, p.handle(ctx, deadLetteredMessage(3, cutoff.Add(-time.Minute))))
+	assert.NotNil(t, p.handle(ctx, deadLetteredMessage(4, cutoff)))
+	assert.Equal(t, 2, p.purged, "only messages enqueued before the cut-off are purged")
+	assert.False(t, p.done)
+
+	p.handle(ctx, deadLetteredMessage(5, cutoff.Add(-time.Second)))
+	assert.True(t, p.done, "the purge ends at the newest message when it started")
+	assert.Equal(t, 3, p.purged)
+	assert.NoError(t, p.err())
+
+	p = newDeadLetterPurge(cutoff)
+	p.handle(ctx, NewMessageFromString("no system properties"))
+	assert.Zero(t, p.purged)
+}
+
+func TestDeadLetterPurge_StopsAtMessagesEnqueuedSinceItStarted(t *testing.T) {
+	cutoff := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	p := newDeadLetterPurge(cutoff)
+	p.last = 2
+	ctx := context.Background()
+
+	p.handle(ctx, deadLetteredMessage(1, cutoff.Add(-time.Hour)))
+	p.handle(ctx, deadLetteredMessage(3, cutoff.Add(-time.Hour)))
+	assert.True(t, p.done)
+	assert.Equal(t, 1, p.purged, "messages past the bound are left alone")
+	assert.NoError(t, p.err())
+}
+
+func TestDeadLetterPurge_ReportsLocksExpiringBeforeTheEnd(t *testing.T) {
+	cutoff := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	p := newDeadLetterPurge(cutoff)
+	p.last = 10
+	ctx := context.Background()
+
+	p.handle(ctx, deadLetteredMessage(1, cutoff.Add(-time.Hour)))
+	p.handle(ctx, deadLetteredMessage(2, cutoff.Add(time.Hour)))
+	// the message held back is delivered again once its lock expires
+	p.handle(ctx, deadLetteredMessage(2, cutoff.Add(time.Hour)))
+	assert.True(t, p.done)
+	assert.Equal(t, 1, p.purged)
+	assert.Equal(t, ErrSweepIncomplete, p.err(), "a partial purge is not reported as a success")
+}
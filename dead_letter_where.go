@@ -0,0 +1,106 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// deadLetterSweep decides which messages DeadLetterWhere dead-letters
+	deadLetterSweep struct {
+		sweepBound
+		predicate func(*Message) bool
+		reason    string
+		moved     int
+	}
+)
+
+// DeadLetterWhere moves the messages of the Queue matching the predicate to its dead-letter queue, with the reason as
+// their DeadLetterReason, and returns how many were moved. It is meant for flushing known bad messages, such as those
+// sent by a producer with a bug, so they stop being retried. Messages which do not match are locked while the sweep
+// runs and are released, untouched and without counting as a delivery, when it finishes, so a sweep of a large queue
+// should finish within the lock duration of the queue; ErrSweepIncomplete is returned with the count so far if it does
+// not. The sweep stops at the newest message in the queue when it started. Other receivers should be stopped while it
+// runs, as the messages they hold are not swept.
+func (q *Queue) DeadLetterWhere(ctx context.Context, predicate func(*Message) bool, reason string) (int, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.DeadLetterWhere")
+	defer span.End()
+
+	return q.namespace.deadLetterWhere(ctx, q.Name, predicate, reason)
+}
+
+// DeadLetterWhere moves the messages of the Subscription matching the predicate to its dead-letter queue, with the
+// reason as their DeadLetterReason, and returns how many were moved. Messages which do not match are locked while the
+// sweep runs and are released, untouched, when it finishes.
+func (s *Subscription) DeadLetterWhere(ctx context.Context, predicate func(*Message) bool, reason string) (int, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.DeadLetterWhere")
+	defer span.End()
+
+	return s.namespace.deadLetterWhere(ctx, s.entityPath(), predicate, reason)
+}
+
+func (ns *Namespace) deadLetterWhere(ctx context.Context, entityPath string, predicate func(*Message) bool, reason string) (int, error) {
+	if predicate == nil {
+		return 0, errors.New("predicate must not be nil")
+	}
+	if reason == "" {
+		return 0, errors.New("a dead-letter reason is required")
+	}
+
+	sweep := newDeadLetterSweep(predicate, reason)
+	err := ns.sweep(ctx, entityPath, sweep.handle, &sweep.sweepBound)
+	if err != nil {
+		log.For(ctx).Error(err)
+	}
+	return sweep.moved, err
+}
+
+func newDeadLetterSweep(predicate func(*Message) bool, reason string) *deadLetterSweep {
+	return &deadLetterSweep{
+		sweepBound: newSweepBound(),
+		predicate:  predicate,
+		reason:     reason,
+	}
+}
+
+// handle dead-letters messages matching the predicate and holds on to the others, without settling them, so they are
+// not delivered again while the sweep runs
+func (s *deadLetterSweep) handle(ctx context.Context, msg *Message) DispositionAction {
+	hold := func(context.Context) {}
+
+	if s.pass(msg) {
+		return hold
+	}
+
+	if !s.predicate(msg) {
+		return hold
+	}
+	s.moved++
+	return msg.DeadLetterWithInfo(errors.New(s.reason), ErrorInternalError, map[string]string{
+		DeadLetterReasonProperty: s.reason,
+	})
+}
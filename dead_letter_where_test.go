@@ -0,0 +1,61 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterSweep_Handle(t *testing.T) {
+	sweep := newDeadLetterSweep(func(msg *Message) bool {
+		return string(msg.Data) == "bad"
+	}, "producer bug")
+	sweep.last = 4
+	received := func(seq int64, data string) *Message {
+		msg := NewMessageFromString(data)
+		msg.SystemProperties = &SystemProperties{SequenceNumber: &seq}
+		return msg
+	}
+	ctx := context.Background()
+
+	assert.NotNil(t, sweep.handle(ctx, received(1, "bad")))
+	assert.NotNil(t, sweep.handle(ctx, received(2, "good")))
+	assert.NotNil(t, sweep.handle(ctx, received(3, "bad")))
+	assert.Equal(t, 2, sweep.moved)
+	assert.False(t, sweep.done)
+
+	sweep.handle(ctx, received(2, "good"))
+	assert.True(t, sweep.done)
+	assert.Equal(t, 2, sweep.moved)
+	assert.Equal(t, ErrSweepIncomplete, sweep.err(), "a redelivery before the last message means locks expired")
+}
+
+func TestDeadLetterSweep_EndsAtTheLastMessage(t *testing.T) {
+	sweep := newDeadLetterSweep(func(*Message) bool { return true }, "producer bug")
+	sweep.last = 2
+	received := func(seq int64) *Message {
+		msg := NewMessageFromString("bad")
+		msg.SystemProperties = &SystemProperties{SequenceNumber: &seq}
+		return msg
+	}
+	ctx := context.Background()
+
+	sweep.handle(ctx, received(1))
+	sweep.handle(ctx, received(2))
+	assert.True(t, sweep.done)
+	assert.Equal(t, 2, sweep.moved)
+	assert.NoError(t, sweep.err())
+}
+
+func TestNamespace_DeadLetterWhereValidatesArguments(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = ns.deadLetterWhere(context.Background(), "queue", nil, "reason")
+	assert.Error(t, err)
+	_, err = ns.deadLetterWhere(context.Background(), "queue", func(*Message) bool { return true }, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+// defaultDeduplicationCacheSize is the number of message IDs remembered by the default DeduplicationStore
+const defaultDeduplicationCacheSize = 10000
+
+type (
+	// DeduplicationStore records the IDs of messages which have been processed. Implementations backed by a shared
+	// store, such as a database or cache, extend deduplication across consumer processes.
+	DeduplicationStore interface {
+		// Contains reports whether the message ID has been processed
+		Contains(ctx context.Context, messageID string) (bool, error)
+		// Add records the message ID as processed
+		Add(ctx context.Context, messageID string) error
+	}
+
+	// DeduplicationOption configures a handler created by NewDeduplicatingHandler
+	DeduplicationOption func(*deduplicatingHandler) error
+
+	// MemoryDeduplicationStore is a DeduplicationStore which remembers the most recently processed message IDs in memory
+	MemoryDeduplicationStore struct {
+		mu    sync.Mutex
+		size  int
+		order *list.List
+		ids   map[string]*list.Element
+	}
+
+	deduplicatingHandler struct {
+		handler     Handler
+		onDuplicate Handler
+		store       DeduplicationStore
+	}
+)
+
+// NewMemoryDeduplicationStore creates a DeduplicationStore which remembers up to size message IDs, forgetting the least
+// recently processed first
+func NewMemoryDeduplicationStore(size int) (*MemoryDeduplicationStore, error) {
+	if size < 1 {
+		return nil, errors.New("size must be at least 1")
+	}
+
+	return &MemoryDeduplicationStore{
+		size:  size,
+		order: list.New(),
+		ids:   make(map[string]*list.Element),
+	}, nil
+}
+
+// Contains reports whether the message ID is remembered
+func (ms *MemoryDeduplicationStore) Contains(_ context.Context, messageID string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	_, ok := ms.ids[messageID]
+	return ok, nil
+}
+
+// Add remembers the message ID, forgetting the least recently added ID if the store is full
+func (ms *MemoryDeduplicationStore) Add(_ context.Context, messageID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if elem, ok := ms.ids[messageID]; ok {
+		ms.order.MoveToFront(elem)
+		return nil
+	}
+
+	ms.ids[messageID] = ms.order.PushFront(messageID)
+	for ms.order.Len() > ms.size {
+		delete(ms.ids, ms.order.Remove(ms.order.Back()).(string))
+	}
+	return nil
+}
+
+// DeduplicationWithStore configures the store which records processed message IDs. The default store remembers the
+// last 10,000 IDs in memory.
+func DeduplicationWithStore(store DeduplicationStore) DeduplicationOption {
+	return func(dh *deduplicatingHandler) error {
+		if store == nil {
+			return errors.New("store must not be nil")
+		}
+		dh.store = store
+		return nil
+	}
+}
+
+// DeduplicationWithOnDuplicate configures the handler called for duplicate messages instead of the wrapped handler.
+// By default, duplicates are completed.
+func DeduplicationWithOnDuplicate(handler Handler) DeduplicationOption {
+	return func(dh *deduplicatingHandler) error {
+		if handler == nil {
+			return errors.New("handler must not be nil")
+		}
+		dh.onDuplicate = handler
+		return nil
+	}
+}
+
+// NewDeduplicatingHandler wraps the handler so messages whose ID has already been processed are not handled again,
+// giving effectively-once processing on top of at-least-once delivery. A message received in PeekLock mode is recorded
+// as processed once it has been completed or dead-lettered, so abandoned messages are still redelivered to the
+// handler; a message received in ReceiveAndDelete mode is recorded once the handler returns. If the store cannot be
+// read, the message is handled as though it was not a duplicate.
+func NewDeduplicatingHandler(handler Handler, opts ...DeduplicationOption) (Handler, error) {
+	dh := &deduplicatingHandler{
+		handler: handler,
+		onDuplicate: HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+			return msg.Complete()
+		}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(dh); err != nil {
+			return nil, err
+		}
+	}
+
+	if dh.store == nil {
+		store, err := NewMemoryDeduplicationStore(defaultDeduplicationCacheSize)
+		if err != nil {
+			return nil, err
+		}
+		dh.store = store
+	}
+	return dh, nil
+}
+
+func (dh *deduplicatingHandler) Handle(ctx context.Context, msg *Message) DispositionAction {
+	if msg.ID == "" {
+		return dh.handler.Handle(ctx, msg)
+	}
+
+	seen, err := dh.store.Contains(ctx, msg.ID)
+	if err != nil {
+		log.For(ctx).Error(err)
+	} else if seen {
+		log.For(ctx).Debug("skipping duplicate message " + msg.ID)
+		return dh.onDuplicate.Handle(ctx, msg)
+	}
+
+	if msg.receiveMode == ReceiveAndDeleteMode {
+		// the message is settled already and no settlement hook will be called
+		action := dh.handler.Handle(ctx, msg)
+		dh.add(ctx, msg.ID)
+		return action
+	}
+
+	hook := msg.settlementHook
+	msg.settlementHook = func(ctx context.Context, m *Message, outcome SettlementOutcome) {
+		if !outcome.redelivered() {
+			dh.add(ctx, m.ID)
+		}
+		if hook != nil {
+			hook(ctx, m, outcome)
+		}
+	}
+	return dh.handler.Handle(ctx, msg)
+}
+
+func (dh *deduplicatingHandler) add(ctx context.Context, messageID string) {
+	if err := dh.store.Add(ctx, messageID); err != nil {
+		log.For(ctx).Error(err)
+	}
+}
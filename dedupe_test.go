@@ -0,0 +1,139 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicatingHandler_PeekLock(t *testing.T) {
+	ctx := context.Background()
+	var handled []string
+	var duplicates []string
+	handler, err := NewDeduplicatingHandler(
+		HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+			handled = append(handled, msg.ID)
+			return nil
+		}),
+		DeduplicationWithOnDuplicate(HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+			duplicates = append(duplicates, msg.ID)
+			return nil
+		})))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	settle := func(id string, outcome SettlementOutcome) {
+		msg := NewMessageFromString("payload")
+		msg.ID = id
+		handler.Handle(ctx, msg)
+		assert.NoError(t, msg.settle(ctx, outcome, func() error { return nil }))
+	}
+
+	settle("a", OutcomeAbandoned)
+	settle("a", OutcomeReleased)
+	settle("a", OutcomeDeferred)
+	settle("a", OutcomeCompleted)
+	settle("a", OutcomeCompleted)
+	settle("b", OutcomeDeadLettered)
+	settle("b", OutcomeCompleted)
+
+	assert.Equal(t, []string{"a", "a", "a", "a", "b"}, handled, "redelivered messages are handled again")
+	assert.Equal(t, []string{"a", "b"}, duplicates)
+}
+
+func TestDeduplicatingHandler_ChainsSettlementHook(t *testing.T) {
+	ctx := context.Background()
+	handler, err := NewDeduplicatingHandler(HandlerFunc(func(context.Context, *Message) DispositionAction {
+		return nil
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var outcomes []SettlementOutcome
+	msg := NewMessageFromString("payload")
+	msg.ID = "a"
+	msg.settlementHook = func(_ context.Context, _ *Message, outcome SettlementOutcome) {
+		outcomes = append(outcomes, outcome)
+	}
+	handler.Handle(ctx, msg)
+	assert.NoError(t, msg.settle(ctx, OutcomeCompleted, func() error { return nil }))
+	assert.Equal(t, []SettlementOutcome{OutcomeCompleted}, outcomes)
+}
+
+func TestDeduplicatingHandler_ReceiveAndDelete(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemoryDeduplicationStore(10)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	calls := 0
+	handler, err := NewDeduplicatingHandler(HandlerFunc(func(context.Context, *Message) DispositionAction {
+		calls++
+		return nil
+	}), DeduplicationWithStore(store), DeduplicationWithOnDuplicate(HandlerFunc(func(context.Context, *Message) DispositionAction {
+		return nil
+	})))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		msg := NewMessageFromString("payload")
+		msg.ID = "a"
+		msg.receiveMode = ReceiveAndDeleteMode
+		handler.Handle(ctx, msg)
+	}
+	assert.Equal(t, 1, calls)
+
+	seen, err := store.Contains(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, seen)
+}
+
+func TestMemoryDeduplicationStore_EvictsOldest(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemoryDeduplicationStore(2)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, store.Add(ctx, "a"))
+	assert.NoError(t, store.Add(ctx, "b"))
+	assert.NoError(t, store.Add(ctx, "a"))
+	assert.NoError(t, store.Add(ctx, "c"))
+
+	for id, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		seen, err := store.Contains(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, seen, id)
+	}
+
+	_, err = NewMemoryDeduplicationStore(0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// DiagnosticIDProperty is the user property carrying the id of the operation which sent a message, as used by the
+	// .NET SDK and Application Insights. The id is either a W3C traceparent or a hierarchical Request-Id.
+	DiagnosticIDProperty = "Diagnostic-Id"
+	// CorrelationContextProperty is the user property carrying the baggage of the operation which sent a message as a
+	// comma separated list of key=value pairs
+	CorrelationContextProperty = "Correlation-Context"
+
+	diagnosticIDTag    = "diagnostic-id"
+	traceparentVersion = "00"
+)
+
+type (
+	diagnosticIDKey struct{}
+)
+
+// ContextWithDiagnosticID returns a copy of the context carrying the Diagnostic-Id of the operation being processed.
+// Messages sent with the context are given a Diagnostic-Id which continues the trace of that operation.
+func ContextWithDiagnosticID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, diagnosticIDKey{}, id)
+}
+
+// DiagnosticIDFromContext returns the Diagnostic-Id carried by the context. Handlers receive a context carrying the
+// Diagnostic-Id of the message they are handling, if it has one.
+func DiagnosticIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(diagnosticIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// DiagnosticID returns the Diagnostic-Id of the message, or an empty string if it has none
+func (m *Message) DiagnosticID() string {
+	id, _ := m.UserProperties[DiagnosticIDProperty].(string)
+	return id
+}
+
+// injectDiagnostics gives the message a Diagnostic-Id which is a child of the operation in the context, and a
+// Correlation-Context carrying the baggage of the span, unless the message already carries them
+func injectDiagnostics(ctx context.Context, span Span, msg *Message) {
+	if msg.DiagnosticID() == "" {
+		parent, _ := DiagnosticIDFromContext(ctx)
+		msg.Set(DiagnosticIDProperty, newDiagnosticID(parent))
+	}
+	span.SetAttribute(diagnosticIDTag, msg.DiagnosticID())
+
+	if _, ok := msg.UserProperties[CorrelationContextProperty]; ok {
+		return
+	}
+	bs, ok := span.(baggageSpan)
+	if !ok {
+		return
+	}
+	var baggage []string
+	bs.foreachBaggageItem(func(k, v string) bool {
+		baggage = append(baggage, k+"="+v)
+		return true
+	})
+	if len(baggage) > 0 {
+		msg.Set(CorrelationContextProperty, strings.Join(baggage, ","))
+	}
+}
+
+// extractDiagnostics returns a copy of the context carrying the Diagnostic-Id of the received message, and applies the
+// message's Correlation-Context as baggage of the span handling it
+func extractDiagnostics(ctx context.Context, span Span, msg *Message) context.Context {
+	id := msg.DiagnosticID()
+	if id == "" {
+		return ctx
+	}
+	span.SetAttribute(diagnosticIDTag, id)
+
+	if bs, ok := span.(baggageSpan); ok {
+		correlation, _ := msg.UserProperties[CorrelationContextProperty].(string)
+		for _, item := range strings.Split(correlation, ",") {
+			if kv := strings.SplitN(strings.TrimSpace(item), "=", 2); len(kv) == 2 && kv[0] != "" {
+				bs.setBaggageItem(kv[0], kv[1])
+			}
+		}
+	}
+	return ContextWithDiagnosticID(ctx, id)
+}
+
+// newDiagnosticID creates the id of an operation which is a child of parent. A W3C traceparent parent yields a
+// traceparent in the same trace, a hierarchical Request-Id parent yields a hierarchical child and no parent starts a
+// new W3C trace.
+func newDiagnosticID(parent string) string {
+	if traceID, flags, ok := parseTraceparent(parent); ok {
+		return strings.Join([]string{traceparentVersion, traceID, randomHex(8), flags}, "-")
+	}
+	if parent != "" {
+		if !strings.HasSuffix(parent, ".") && !strings.HasSuffix(parent, "_") {
+			parent += "."
+		}
+		return parent + randomHex(4) + "_"
+	}
+	return strings.Join([]string{traceparentVersion, randomHex(16), randomHex(8), "01"}, "-")
+}
+
+// parseTraceparent returns the trace id and flags of a W3C traceparent
+func parseTraceparent(id string) (traceID string, flags string, ok bool) {
+	parts := strings.Split(id, "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false
+	}
+	for _, part := range parts {
+		if _, err := hex.DecodeString(part); err != nil {
+			return "", "", false
+		}
+	}
+	return parts[1], parts[3], true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
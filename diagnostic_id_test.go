@@ -0,0 +1,80 @@
+package servicebus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDiagnosticID(t *testing.T) {
+	root := newDiagnosticID("")
+	traceID, flags, ok := parseTraceparent(root)
+	if assert.True(t, ok, root) {
+		assert.Equal(t, "01", flags)
+	}
+
+	child := newDiagnosticID(root)
+	childTraceID, _, ok := parseTraceparent(child)
+	assert.True(t, ok, child)
+	assert.Equal(t, traceID, childTraceID)
+	assert.NotEqual(t, root, child)
+
+	sampledOut := newDiagnosticID("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	assert.True(t, strings.HasPrefix(sampledOut, "00-0af7651916cd43dd8448eb211c80319c-"))
+	assert.True(t, strings.HasSuffix(sampledOut, "-00"))
+
+	hierarchical := newDiagnosticID("|4bf92f35.1.")
+	assert.True(t, strings.HasPrefix(hierarchical, "|4bf92f35.1."), hierarchical)
+	assert.True(t, strings.HasSuffix(hierarchical, "_"))
+	assert.Len(t, hierarchical, len("|4bf92f35.1.")+9)
+
+	assert.True(t, strings.HasPrefix(newDiagnosticID("|4bf92f35"), "|4bf92f35."))
+}
+
+func TestParseTraceparent(t *testing.T) {
+	_, _, ok := parseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	assert.True(t, ok)
+
+	for _, id := range []string{"", "|abc.1.", "00-xyz-b7ad6b7169203331-01", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331"} {
+		_, _, ok := parseTraceparent(id)
+		assert.False(t, ok, id)
+	}
+}
+
+func TestDiagnosticsRoundTrip(t *testing.T) {
+	tracer := mocktracer.New()
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	sendSpan := tracer.StartSpan("send")
+	sendSpan.SetBaggageItem("tenant", "contoso")
+	msg := NewMessageFromString("hello")
+	injectDiagnostics(ContextWithDiagnosticID(context.Background(), parent), openTracingSpan{span: sendSpan}, msg)
+
+	id := msg.DiagnosticID()
+	assert.True(t, strings.HasPrefix(id, "00-0af7651916cd43dd8448eb211c80319c-"), id)
+	assert.Equal(t, "tenant=contoso", msg.UserProperties[CorrelationContextProperty])
+	assert.Equal(t, id, sendSpan.(*mocktracer.MockSpan).Tag(diagnosticIDTag))
+
+	receiveSpan := tracer.StartSpan("receive")
+	ctx := extractDiagnostics(context.Background(), openTracingSpan{span: receiveSpan}, msg)
+	received, ok := DiagnosticIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, id, received)
+	assert.Equal(t, "contoso", receiveSpan.BaggageItem("tenant"))
+}
+
+func TestInjectDiagnosticsKeepsExistingID(t *testing.T) {
+	span := openTracingSpan{span: mocktracer.New().StartSpan("send")}
+	msg := NewMessageFromString("hello")
+	msg.Set(DiagnosticIDProperty, "|abc.1.")
+	injectDiagnostics(context.Background(), span, msg)
+	assert.Equal(t, "|abc.1.", msg.DiagnosticID())
+	assert.NotContains(t, msg.UserProperties, CorrelationContextProperty)
+
+	ctx := extractDiagnostics(context.Background(), span, NewMessageFromString("no id"))
+	_, ok := DiagnosticIDFromContext(ctx)
+	assert.False(t, ok)
+}
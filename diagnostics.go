@@ -0,0 +1,186 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"sync"
+)
+
+type (
+	// LinkState enumerates the states of an AMQP link held by a Queue or Subscription
+	LinkState int
+
+	// LinkDiagnostics is a snapshot of an AMQP link, intended for debugging links which have stopped making progress
+	LinkDiagnostics struct {
+		EntityPath string
+		State      LinkState
+		// Credit is the link credit a receive link is attached with, which is how many messages the broker may deliver
+		// ahead of them being handled. It is zero for send links.
+		Credit uint32
+		// InFlight is the number of messages being handled by a receive link, or awaiting acknowledgement on a send link
+		InFlight int
+		// LastError is the most recent error the link failed with, even if it has since recovered
+		LastError error
+		// Reconnects is how many times the link has been recovered after failing
+		Reconnects int
+	}
+
+	// Diagnostics is a snapshot of the connection and links of a Queue or Subscription. Sender and Receiver are nil
+	// until the entity first sends or receives.
+	Diagnostics struct {
+		Connection ConnectionStatus
+		Sender     *LinkDiagnostics
+		Receiver   *LinkDiagnostics
+	}
+
+	// linkStats tracks the state of a link for Diagnostics
+	linkStats struct {
+		mu         sync.Mutex
+		state      LinkState
+		inFlight   int
+		reconnects int
+		lastError  error
+	}
+)
+
+const (
+	// LinkDetached means the link has not been attached yet
+	LinkDetached LinkState = iota
+	// LinkAttached means the link is attached and able to transfer messages
+	LinkAttached
+	// LinkPaused means PauseReceiving stopped the receiver taking messages from its link
+	LinkPaused
+	// LinkRecovering means the link failed and is being rebuilt
+	LinkRecovering
+	// LinkClosed means the link was closed and will not be used again
+	LinkClosed
+)
+
+func (s LinkState) String() string {
+	switch s {
+	case LinkDetached:
+		return "Detached"
+	case LinkAttached:
+		return "Attached"
+	case LinkPaused:
+		return "Paused"
+	case LinkRecovering:
+		return "Recovering"
+	case LinkClosed:
+		return "Closed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Diagnostics returns a snapshot of the Queue's connection and links
+func (q *Queue) Diagnostics() Diagnostics {
+	q.senderMu.Lock()
+	s := q.sender
+	q.senderMu.Unlock()
+
+	q.receiverMu.Lock()
+	r := q.receiver
+	q.receiverMu.Unlock()
+
+	return q.namespace.diagnostics(s, r)
+}
+
+// Diagnostics returns a snapshot of the Subscription's connection and receive link
+func (s *Subscription) Diagnostics() Diagnostics {
+	s.receiverMu.Lock()
+	r := s.receiver
+	s.receiverMu.Unlock()
+
+	return s.namespace.diagnostics(nil, r)
+}
+
+func (ns *Namespace) diagnostics(s *sender, r *receiver) Diagnostics {
+	ns.state.mu.Lock()
+	d := Diagnostics{Connection: ns.state.status}
+	ns.state.mu.Unlock()
+
+	if s != nil {
+		d.Sender = s.stats.snapshot(s.entityPath, 0)
+	}
+	if r != nil {
+		d.Receiver = r.stats.snapshot(r.entityPath, r.prefetch)
+	}
+	return d
+}
+
+func (ls *linkStats) snapshot(entityPath string, credit uint32) *LinkDiagnostics {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return &LinkDiagnostics{
+		EntityPath: entityPath,
+		State:      ls.state,
+		Credit:     credit,
+		InFlight:   ls.inFlight,
+		LastError:  ls.lastError,
+		Reconnects: ls.reconnects,
+	}
+}
+
+func (ls *linkStats) setState(state LinkState) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.state = state
+}
+
+// failed records err as the most recent error of the link
+func (ls *linkStats) failed(err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.lastError = err
+}
+
+// recovering records that the link failed with err and is about to be rebuilt
+func (ls *linkStats) recovering(err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.lastError = err
+	if ls.state != LinkClosed {
+		ls.state = LinkRecovering
+	}
+}
+
+// recovered records that the link was rebuilt after failing
+func (ls *linkStats) recovered() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.reconnects++
+	ls.state = LinkAttached
+}
+
+// track counts a message as in flight until the returned func is called
+func (ls *linkStats) track() func() {
+	ls.mu.Lock()
+	ls.inFlight++
+	ls.mu.Unlock()
+	return func() {
+		ls.mu.Lock()
+		ls.inFlight--
+		ls.mu.Unlock()
+	}
+}
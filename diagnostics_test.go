@@ -0,0 +1,79 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestQueue_DiagnosticsBeforeUse(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	d := q.Diagnostics()
+	assert.Equal(t, Disconnected, d.Connection)
+	assert.Nil(t, d.Sender)
+	assert.Nil(t, d.Receiver)
+}
+
+func TestQueue_DiagnosticsReportsReceiver(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := &receiver{namespace: ns, entityPath: "orders", prefetch: 5, mode: ReceiveAndDeleteMode}
+	r.stats.setState(LinkAttached)
+	q.receiver = r
+
+	var during Diagnostics
+	r.handleMessage(context.Background(), amqp.NewMessage([]byte("hello")),
+		HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+			during = q.Diagnostics()
+			return nil
+		}))
+
+	if assert.NotNil(t, during.Receiver) {
+		assert.Equal(t, "orders", during.Receiver.EntityPath)
+		assert.Equal(t, LinkAttached, during.Receiver.State)
+		assert.EqualValues(t, 5, during.Receiver.Credit)
+		assert.Equal(t, 1, during.Receiver.InFlight)
+	}
+	assert.Equal(t, 0, q.Diagnostics().Receiver.InFlight)
+}
+
+func TestLinkStats(t *testing.T) {
+	var stats linkStats
+	assert.Equal(t, LinkDetached, stats.snapshot("x", 0).State)
+
+	detached := errors.New("link detached")
+	stats.setState(LinkAttached)
+	stats.recovering(detached)
+	d := stats.snapshot("x", 0)
+	assert.Equal(t, LinkRecovering, d.State)
+	assert.Equal(t, detached, d.LastError)
+
+	stats.recovered()
+	d = stats.snapshot("x", 0)
+	assert.Equal(t, LinkAttached, d.State)
+	assert.Equal(t, 1, d.Reconnects)
+	assert.Equal(t, detached, d.LastError, "the last error is kept after recovering")
+
+	stats.setState(LinkClosed)
+	stats.recovering(detached)
+	assert.Equal(t, LinkClosed, stats.snapshot("x", 0).State)
+	assert.Equal(t, "Closed", LinkClosed.String())
+}
@@ -0,0 +1,168 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/rpc"
+	"go.opencensus.io/trace"
+	"pack.ag/amqp"
+)
+
+// update-disposition statuses
+const (
+	completedDisposition = "completed"
+	abandonedDisposition = "abandoned"
+	suspendedDisposition = "suspended"
+	// deferredDisposition is spelled as the service expects it
+	deferredDisposition = "defered"
+)
+
+// CompleteMessages completes the messages by their lock tokens in a single update-disposition management call rather
+// than settling them one at a time. The call is made on the Queue's management link, which shares the connection of
+// its sender. Messages without a lock token are skipped.
+func (q *Queue) CompleteMessages(ctx context.Context, messages ...*Message) error {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.CompleteMessages")
+	defer span.End()
+
+	lockTokens := lockTokensOf(ctx, messages)
+	if len(lockTokens) < 1 {
+		log.For(ctx).Info("no lock tokens present to update disposition")
+		return nil
+	}
+
+	link, err := q.managementLink(ctx)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	if err := q.updateDisposition(ctx, link, completedDisposition, lockTokens); err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if m.LockToken != nil {
+			q.settledByManagement(ctx, m, OutcomeCompleted)
+		}
+	}
+	return nil
+}
+
+// managementLink returns the Queue's management link, opened on the connection of its sender and opened again once
+// the sender has reconnected
+func (q *Queue) managementLink(ctx context.Context) (*rpc.Link, error) {
+	if err := q.ensureSender(ctx); err != nil {
+		return nil, err
+	}
+
+	q.managementMu.Lock()
+	defer q.managementMu.Unlock()
+
+	conn := q.sender.connection
+	if q.management != nil && q.managementConn == conn {
+		return q.management, nil
+	}
+
+	link, err := rpc.NewLink(conn, q.ManagementPath())
+	if err != nil {
+		return nil, err
+	}
+	q.management, q.managementConn = link, conn
+	return link, nil
+}
+
+// closeManagementLink closes the Queue's management link, if it has one
+func (q *Queue) closeManagementLink(ctx context.Context) error {
+	q.managementMu.Lock()
+	defer q.managementMu.Unlock()
+
+	if q.management == nil {
+		return nil
+	}
+	link := q.management
+	q.management, q.managementConn = nil, nil
+	return link.Close(ctx)
+}
+
+// settledByManagement records the outcome of a message settled through the management link. The message is not
+// settled on the link it was received on, as its lock is already gone, so it is marked settled here and its settlement
+// hook, or the Queue's for a message which has none, told of the outcome.
+func (q *Queue) settledByManagement(ctx context.Context, m *Message, outcome SettlementOutcome) {
+	m.settledAs, m.settleErr = outcome, nil
+	switch {
+	case m.settlementHook != nil:
+		m.settlementHook(ctx, m, outcome)
+	case q.settlementHook != nil:
+		q.settlementHook(ctx, m, outcome)
+	}
+}
+
+// lockTokensOf collects the lock tokens of the messages, skipping messages which have none
+func lockTokensOf(ctx context.Context, messages []*Message) []amqp.UUID {
+	lockTokens := make([]amqp.UUID, 0, len(messages))
+	for _, m := range messages {
+		if m.LockToken == nil {
+			log.For(ctx).Error(fmt.Errorf("failed: message has nil lock token, cannot update disposition"), trace.StringAttribute("messageId", m.ID))
+			continue
+		}
+		lockTokens = append(lockTokens, amqp.UUID(*m.LockToken))
+	}
+	return lockTokens
+}
+
+// updateDisposition sets the disposition status of the locked messages through the entity management link
+func (e *entity) updateDisposition(ctx context.Context, link *rpc.Link, status string, lockTokens []amqp.UUID) error {
+	span, ctx := e.startSpanFromContext(ctx, "sb.entity.updateDisposition")
+	defer span.End()
+
+	msg := &amqp.Message{
+		ApplicationProperties: map[string]interface{}{
+			operationFieldName: updateDispositionOperationID,
+		},
+		Value: map[string]interface{}{
+			lockTokensFieldName:        lockTokens,
+			dispositionStatusFieldName: status,
+		},
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.ApplicationProperties[serverTimeoutFieldName] = uint(e.namespace.until(deadline) / time.Millisecond)
+	}
+
+	resp, err := link.RetryableRPC(ctx, 3, 1*time.Second, msg)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	if resp.Code != 200 {
+		return ErrAMQP(*resp)
+	}
+
+	return nil
+}
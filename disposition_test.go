@@ -0,0 +1,53 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_CompleteMessagesWithoutLockTokens(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	called := false
+	q, err := ns.NewQueue("foo", QueueWithSettlementHook(func(context.Context, *Message, SettlementOutcome) {
+		called = true
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, q.CompleteMessages(context.Background(), NewMessageFromString("no lock token")))
+	assert.False(t, called, "messages without lock tokens are not settled")
+}
+
+func TestQueue_SettledByManagementMarksMessagesSettled(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var queueOutcomes []SettlementOutcome
+	q, err := ns.NewQueue("foo", QueueWithSettlementHook(func(_ context.Context, _ *Message, outcome SettlementOutcome) {
+		queueOutcomes = append(queueOutcomes, outcome)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var received []SettlementOutcome
+	fromLink := NewMessageFromString("received on a link")
+	fromLink.settlementHook = func(_ context.Context, _ *Message, outcome SettlementOutcome) {
+		received = append(received, outcome)
+	}
+	q.settledByManagement(context.Background(), fromLink, OutcomeCompleted)
+	q.settledByManagement(context.Background(), NewMessageFromString("built elsewhere"), OutcomeCompleted)
+
+	assert.Equal(t, OutcomeCompleted, fromLink.settledAs)
+	assert.Equal(t, []SettlementOutcome{OutcomeCompleted}, received, "the message's own hook covers what it was received with")
+	assert.Equal(t, []SettlementOutcome{OutcomeCompleted}, queueOutcomes)
+}
@@ -0,0 +1,265 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// DLQMonitor polls the number of dead-lettered messages of a queue or subscription and raises a DLQAlert when the
+	// count reaches the configured threshold, and again once it has been drained below it. Alerts are passed to a
+	// DLQAlertHandler and, if configured, posted as JSON to a webhook.
+	DLQMonitor struct {
+		EntityPath string
+		namespace  *Namespace
+		count      func(ctx context.Context) (int64, error)
+		interval   time.Duration
+		threshold  int64
+		webhook    string
+		httpClient *http.Client
+	}
+
+	// DLQMonitorOption configures a DLQMonitor
+	DLQMonitorOption func(*DLQMonitor) error
+
+	// DLQAlert describes the dead-letter count of an entity reaching or falling back below the alert threshold
+	DLQAlert struct {
+		EntityPath string `json:"entityPath"`
+		// DeadLetterCount is the number of dead-lettered messages observed by the poll which raised the alert
+		DeadLetterCount int64 `json:"deadLetterCount"`
+		// PreviousCount is the count observed by the previous poll, or 0 for the first poll
+		PreviousCount int64 `json:"previousCount"`
+		Threshold     int64 `json:"threshold"`
+		// Recovered is true when the count fell back below the threshold
+		Recovered  bool      `json:"recovered"`
+		ObservedAt time.Time `json:"observedAt"`
+	}
+
+	// DLQAlertHandler is called for each DLQAlert raised by a DLQMonitor
+	DLQAlertHandler func(ctx context.Context, alert DLQAlert)
+)
+
+// DLQMonitorWithInterval configures how often the DLQMonitor polls the entity. The default is 30 seconds.
+func DLQMonitorWithInterval(interval time.Duration) DLQMonitorOption {
+	return func(m *DLQMonitor) error {
+		if interval <= 0 {
+			return errors.New("monitor interval must be greater than 0")
+		}
+		m.interval = interval
+		return nil
+	}
+}
+
+// DLQMonitorWithThreshold configures the dead-letter count at which the DLQMonitor raises an alert. The default is 1,
+// alerting as soon as any message is dead-lettered.
+func DLQMonitorWithThreshold(threshold int64) DLQMonitorOption {
+	return func(m *DLQMonitor) error {
+		if threshold < 1 {
+			return errors.New("dead-letter threshold must be at least 1")
+		}
+		m.threshold = threshold
+		return nil
+	}
+}
+
+// DLQMonitorWithWebhook configures the DLQMonitor to POST each alert as JSON to the URL. A nil client uses
+// http.DefaultClient. Failed deliveries are logged and not retried.
+func DLQMonitorWithWebhook(url string, client *http.Client) DLQMonitorOption {
+	return func(m *DLQMonitor) error {
+		if url == "" {
+			return errors.New("webhook URL must not be empty")
+		}
+		if client == nil {
+			client = http.DefaultClient
+		}
+		m.webhook = url
+		m.httpClient = client
+		return nil
+	}
+}
+
+// NewQueueDLQMonitor creates a DLQMonitor for the dead-letter queue of a queue
+func (ns *Namespace) NewQueueDLQMonitor(queueName string, opts ...DLQMonitorOption) (*DLQMonitor, error) {
+	qm := ns.NewQueueManager()
+	return ns.newDLQMonitor(queueName, func(ctx context.Context) (int64, error) {
+		qe, err := qm.Get(ctx, queueName)
+		if err != nil {
+			return 0, err
+		}
+		if qe == nil {
+			return 0, fmt.Errorf("queue %q does not exist", queueName)
+		}
+		return deadLetterCount(qe.CountDetails)
+	}, opts...)
+}
+
+// NewSubscriptionDLQMonitor creates a DLQMonitor for the dead-letter queue of a topic subscription
+func (ns *Namespace) NewSubscriptionDLQMonitor(topicName, subscriptionName string, opts ...DLQMonitorOption) (*DLQMonitor, error) {
+	sm, err := ns.NewSubscriptionManager(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.newDLQMonitor(topicName+"/Subscriptions/"+subscriptionName, func(ctx context.Context) (int64, error) {
+		se, err := sm.Get(ctx, subscriptionName)
+		if err != nil {
+			return 0, err
+		}
+		if se == nil {
+			return 0, fmt.Errorf("subscription %q of topic %q does not exist", subscriptionName, topicName)
+		}
+		return deadLetterCount(se.CountDetails)
+	}, opts...)
+}
+
+func (ns *Namespace) newDLQMonitor(entityPath string, count func(ctx context.Context) (int64, error), opts ...DLQMonitorOption) (*DLQMonitor, error) {
+	m := &DLQMonitor{
+		EntityPath: entityPath,
+		namespace:  ns,
+		count:      count,
+		interval:   defaultWatchInterval,
+		threshold:  1,
+	}
+
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Monitor polls the entity until the context is done, raising alerts as the dead-letter count crosses the threshold.
+// The handler may be nil if a webhook is configured. Errors while polling are logged and the entity is polled again at
+// the next interval.
+func (m *DLQMonitor) Monitor(ctx context.Context, handler DLQAlertHandler) error {
+	span, ctx := m.namespace.startSpanFromContext(ctx, "sb.DLQMonitor.Monitor")
+	defer span.End()
+
+	if handler == nil && m.webhook == "" {
+		return errors.New("a handler or webhook is required to deliver alerts")
+	}
+
+	var previous int64
+	for {
+		count, err := m.count(ctx)
+		if err != nil {
+			log.For(ctx).Error(err)
+		} else {
+			if alert, ok := m.crossed(previous, count); ok {
+				m.deliver(ctx, handler, alert)
+			}
+			previous = count
+		}
+
+		if err := m.namespace.sleep(ctx, m.interval); err != nil {
+			return err
+		}
+	}
+}
+
+// Start runs Monitor in the background. The returned stop function ends monitoring and waits for it to finish.
+func (m *DLQMonitor) Start(ctx context.Context, handler DLQAlertHandler) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := m.Monitor(ctx, handler); err != nil && err != context.Canceled {
+			log.For(ctx).Error(err)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// crossed builds the alert for a change in count from previous, if the change crosses the threshold
+func (m *DLQMonitor) crossed(previous, count int64) (DLQAlert, bool) {
+	wasAbove, isAbove := previous >= m.threshold, count >= m.threshold
+	if wasAbove == isAbove {
+		return DLQAlert{}, false
+	}
+
+	return DLQAlert{
+		EntityPath:      m.EntityPath,
+		DeadLetterCount: count,
+		PreviousCount:   previous,
+		Threshold:       m.threshold,
+		Recovered:       !isAbove,
+		ObservedAt:      m.namespace.getClock().Now(),
+	}, true
+}
+
+func (m *DLQMonitor) deliver(ctx context.Context, handler DLQAlertHandler, alert DLQAlert) {
+	if handler != nil {
+		handler(ctx, alert)
+	}
+
+	if m.webhook != "" {
+		if err := m.postWebhook(ctx, alert); err != nil {
+			log.For(ctx).Error(err)
+		}
+	}
+}
+
+func (m *DLQMonitor) postWebhook(ctx context.Context, alert DLQAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", JSONContentType)
+
+	res, err := m.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("dead-letter alert webhook responded with %s", res.Status)
+	}
+	return nil
+}
+
+func deadLetterCount(details *CountDetails) (int64, error) {
+	if details == nil || details.DeadLetterMessageCount == nil {
+		return 0, ErrMissingField("DeadLetterMessageCount")
+	}
+	return int64(*details.DeadLetterMessageCount), nil
+}
@@ -0,0 +1,119 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDLQMonitor_AlertsOnThresholdCrossings(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	posted := make(chan DLQAlert, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert DLQAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		posted <- alert
+	}))
+	defer server.Close()
+
+	counts := []int64{0, 3, 6, 6, 2, 2}
+	polls := 0
+	m, err := ns.newDLQMonitor("orders", func(context.Context) (int64, error) {
+		defer func() { polls++ }()
+		if polls == 3 {
+			return 0, errors.New("transient")
+		}
+		return counts[polls], nil
+	}, DLQMonitorWithInterval(time.Second), DLQMonitorWithThreshold(5), DLQMonitorWithWebhook(server.URL, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var alerts []DLQAlert
+	done := make(chan error)
+	go func() {
+		done <- m.Monitor(ctx, func(_ context.Context, alert DLQAlert) {
+			alerts = append(alerts, alert)
+		})
+	}()
+
+	for i := 1; i < len(counts); i++ {
+		clock.waitForCalls(i)
+		clock.Advance(time.Second)
+	}
+	clock.waitForCalls(len(counts))
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	if assert.Len(t, alerts, 2) {
+		assert.Equal(t, int64(6), alerts[0].DeadLetterCount)
+		assert.Equal(t, int64(3), alerts[0].PreviousCount)
+		assert.False(t, alerts[0].Recovered)
+		assert.Equal(t, int64(2), alerts[1].DeadLetterCount)
+		assert.True(t, alerts[1].Recovered)
+	}
+
+	for i := 0; i < 2; i++ {
+		alert := <-posted
+		assert.Equal(t, "orders", alert.EntityPath)
+		assert.Equal(t, int64(5), alert.Threshold)
+	}
+}
+
+func TestDLQMonitor_Options(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	m, err := ns.NewQueueDLQMonitor("orders")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), m.threshold)
+		assert.Equal(t, defaultWatchInterval, m.interval)
+		assert.Error(t, m.Monitor(context.Background(), nil), "alerts need somewhere to go")
+	}
+
+	_, err = ns.NewQueueDLQMonitor("orders", DLQMonitorWithThreshold(0))
+	assert.Error(t, err)
+	_, err = ns.NewQueueDLQMonitor("orders", DLQMonitorWithInterval(0))
+	assert.Error(t, err)
+	_, err = ns.NewSubscriptionDLQMonitor("orders", "audit", DLQMonitorWithWebhook("", nil))
+	assert.Error(t, err)
+
+	_, err = deadLetterCount(&CountDetails{})
+	assert.Error(t, err)
+}
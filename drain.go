@@ -0,0 +1,121 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+// Drain gracefully stops the Queue's receiver ahead of the process shutting down, for example from a Kubernetes
+// preStop hook. No further messages are handed to the handler, the message being handled, if any, is allowed to
+// finish and be settled, and then the receive link is closed so prefetched messages return to the queue for other
+// receivers. Receive returns as it does when the Queue is closed. Once drained, the number of active messages still
+// waiting on the queue is returned; an error reading it does not undo the drain.
+func (q *Queue) Drain(ctx context.Context) (int64, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.Drain")
+	defer span.End()
+
+	q.receiverMu.Lock()
+	r := q.receiver
+	q.receiverMu.Unlock()
+
+	if r == nil {
+		return 0, ErrNotReceiving
+	}
+	if err := r.Drain(ctx); err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+
+	qe, err := q.namespace.NewQueueManager().Get(ctx, q.Name)
+	if err != nil {
+		return 0, err
+	}
+	if qe == nil {
+		return 0, ErrEntityNotFound{EntityPath: q.Name}
+	}
+	return activeMessageCount(qe.CountDetails)
+}
+
+// Drain gracefully stops the Subscription's receiver and returns the number of active messages still waiting on the
+// subscription. See Queue.Drain.
+func (s *Subscription) Drain(ctx context.Context) (int64, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.Drain")
+	defer span.End()
+
+	s.receiverMu.Lock()
+	r := s.receiver
+	s.receiverMu.Unlock()
+
+	if r == nil {
+		return 0, ErrNotReceiving
+	}
+	if err := r.Drain(ctx); err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+
+	sm, err := s.namespace.NewSubscriptionManager(s.Topic.Name)
+	if err != nil {
+		return 0, err
+	}
+	se, err := sm.Get(ctx, s.Name)
+	if err != nil {
+		return 0, err
+	}
+	if se == nil {
+		return 0, ErrEntityNotFound{EntityPath: s.Topic.Name + "/Subscriptions/" + s.Name}
+	}
+	return activeMessageCount(se.CountDetails)
+}
+
+// Drain stops the listener taking further messages from the link, waits for the message in flight to be handled and
+// then closes the receiver, releasing any prefetched messages
+func (r *receiver) Drain(ctx context.Context) error {
+	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.Drain")
+	defer span.End()
+
+	r.pauseMu.Lock()
+	stopListening, handled := r.stopListening, r.handled
+	r.pauseMu.Unlock()
+
+	if stopListening != nil {
+		stopListening()
+		select {
+		case <-handled:
+		case <-ctx.Done():
+			return fmt.Errorf("message in flight was not handled before the drain was abandoned: %v", ctx.Err())
+		}
+	}
+	return r.Close(ctx)
+}
+
+func activeMessageCount(details *CountDetails) (int64, error) {
+	if details == nil || details.ActiveMessageCount == nil {
+		return 0, ErrMissingField("ActiveMessageCount")
+	}
+	return int64(*details.ActiveMessageCount), nil
+}
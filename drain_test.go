@@ -0,0 +1,95 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestReceiver_DrainWaitsForMessageInFlight(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	stopped := make(chan struct{})
+	handled := make(chan struct{})
+	r := &receiver{namespace: ns, entityPath: "queue", stopListening: func() { close(stopped) }, handled: handled}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- r.Drain(context.Background())
+	}()
+
+	<-stopped
+	select {
+	case <-drained:
+		t.Fatal("drain should wait for the message in flight to be handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handled)
+	select {
+	case err := <-drained:
+		assert.NoError(t, err)
+		assert.Equal(t, LinkClosed, r.stats.snapshot(r.entityPath, 0).State)
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not finish once the message was handled")
+	}
+}
+
+func TestReceiver_DrainGivesUpWithContext(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := &receiver{namespace: ns, entityPath: "queue", stopListening: func() {}, handled: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, r.Drain(ctx))
+}
+
+func TestReceiver_HandleMessagesStopsWithListener(t *testing.T) {
+	r := &receiver{entityPath: "queue"}
+	messages := make(chan *amqp.Message)
+	close(messages)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.handleMessages(context.Background(), messages, HandlerFunc(func(context.Context, *Message) DispositionAction {
+			return nil
+		}))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handling should stop once the listener has stopped")
+	}
+}
+
+func TestQueue_DrainRequiresReceiver(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("queue")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = q.Drain(context.Background())
+	assert.Equal(t, ErrNotReceiving, err)
+
+	count := int32(7)
+	backlog, err := activeMessageCount(&CountDetails{ActiveMessageCount: &count})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), backlog)
+	_, err = activeMessageCount(nil)
+	assert.Error(t, err)
+}
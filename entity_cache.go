@@ -0,0 +1,186 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueCachePrefix = "queues/"
+	topicCachePrefix = "topics/"
+)
+
+type (
+	// entityCache holds entity descriptions fetched by the Queue and Topic managers of a Namespace until they are
+	// older than the TTL, keyed by kind and name. A nil entityCache caches nothing.
+	entityCache struct {
+		mu      sync.Mutex
+		ttl     time.Duration
+		clock   func() Clock
+		entries map[string]entityCacheEntry
+	}
+
+	entityCacheEntry struct {
+		value   interface{}
+		expires time.Time
+	}
+)
+
+// NamespaceWithManagementCache configures the Queue and Topic managers of a namespace to cache the entities returned by
+// Get, List, Put and Update for the duration ttl, sparing provisioning code which checks the same entities repeatedly
+// a round trip to the management API. Managers created from the namespace share the cache; Put, Update and Delete keep
+// it up to date, but changes made by other processes are not seen until the cached entity expires or is invalidated.
+func NamespaceWithManagementCache(ttl time.Duration) NamespaceOption {
+	return func(ns *Namespace) error {
+		if ttl <= 0 {
+			return errors.New("management cache TTL must be greater than zero")
+		}
+		ns.managementCache = &entityCache{
+			ttl:     ttl,
+			clock:   ns.getClock,
+			entries: make(map[string]entityCacheEntry),
+		}
+		return nil
+	}
+}
+
+// Invalidate removes the queue from the management cache, so the next Get fetches it from the service
+func (qm *QueueManager) Invalidate(name string) {
+	qm.cache.invalidate(queueCachePrefix + name)
+}
+
+// InvalidateAll removes every queue from the management cache
+func (qm *QueueManager) InvalidateAll() {
+	qm.cache.invalidatePrefix(queueCachePrefix)
+}
+
+// Invalidate removes the topic from the management cache, so the next Get fetches it from the service
+func (tm *TopicManager) Invalidate(name string) {
+	tm.cache.invalidate(topicCachePrefix + name)
+}
+
+// InvalidateAll removes every topic from the management cache
+func (tm *TopicManager) InvalidateAll() {
+	tm.cache.invalidatePrefix(topicCachePrefix)
+}
+
+func (qm *QueueManager) cachedQueue(name string) (*QueueEntity, bool) {
+	value, ok := qm.cache.get(queueCachePrefix + name)
+	if !ok {
+		return nil, false
+	}
+	return copyQueueEntity(value.(*QueueEntity)), true
+}
+
+func (qm *QueueManager) cacheQueue(name string, qe *QueueEntity) {
+	if qm.cache != nil {
+		qm.cache.put(queueCachePrefix+name, copyQueueEntity(qe))
+	}
+}
+
+func (tm *TopicManager) cachedTopic(name string) (*TopicEntity, bool) {
+	value, ok := tm.cache.get(topicCachePrefix + name)
+	if !ok {
+		return nil, false
+	}
+	return copyTopicEntity(value.(*TopicEntity)), true
+}
+
+func (tm *TopicManager) cacheTopic(name string, te *TopicEntity) {
+	if tm.cache != nil {
+		tm.cache.put(topicCachePrefix+name, copyTopicEntity(te))
+	}
+}
+
+// copyQueueEntity copies the entity and its description, so callers modifying an entity do not modify the cache
+func copyQueueEntity(qe *QueueEntity) *QueueEntity {
+	copied := *qe
+	if qe.QueueDescription != nil {
+		qd := *qe.QueueDescription
+		copied.QueueDescription = &qd
+	}
+	return &copied
+}
+
+// copyTopicEntity copies the entity and its description, so callers modifying an entity do not modify the cache
+func copyTopicEntity(te *TopicEntity) *TopicEntity {
+	copied := *te
+	if te.TopicDescription != nil {
+		td := *te.TopicDescription
+		copied.TopicDescription = &td
+	}
+	return &copied
+}
+
+func (c *entityCache) get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.clock().Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *entityCache) put(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entityCacheEntry{value: value, expires: c.clock().Now().Add(c.ttl)}
+}
+
+func (c *entityCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *entityCache) invalidatePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
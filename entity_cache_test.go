@@ -0,0 +1,103 @@
+package servicebus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+	"github.com/stretchr/testify/assert"
+)
+
+const cachedQueueEntry = `<entry xmlns="http://www.w3.org/2005/Atom"><title>orders</title>` +
+	`<content type="application/xml"><QueueDescription xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect">` +
+	`<MaxDeliveryCount>10</MaxDeliveryCount></QueueDescription></content></entry>`
+
+func TestQueueManager_CachesGet(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock), NamespaceWithManagementCache(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		_, _ = w.Write([]byte(cachedQueueEntry))
+	}))
+	defer server.Close()
+
+	qm := ns.NewQueueManager()
+	qm.entityManager = &entityManager{EntityManager: atom.NewEntityManager(server.URL+"/", staticTokenProvider("token"))}
+	ctx := context.Background()
+
+	qe, err := qm.Get(ctx, "orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(10), *qe.MaxDeliveryCount)
+
+	// modifying a returned entity must not modify the cache
+	*qe.QueueDescription = QueueDescription{}
+	qe, err = qm.Get(ctx, "orders")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(10), *qe.MaxDeliveryCount)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gets))
+
+	// managers of the namespace share the cache
+	other := ns.NewQueueManager()
+	other.entityManager = qm.entityManager
+	_, err = other.Get(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gets))
+
+	clock.Advance(time.Minute)
+	_, err = qm.Get(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&gets), "expired entities are fetched again")
+
+	qm.Invalidate("orders")
+	_, err = qm.Get(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&gets))
+
+	assert.NoError(t, qm.Delete(ctx, "orders"))
+	_, err = qm.Get(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&gets), "deleting a queue removes it from the cache")
+}
+
+func TestEntityCache_InvalidateAll(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithManagementCache(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	qm, tm := ns.NewQueueManager(), ns.NewTopicManager()
+	qm.cacheQueue("orders", &QueueEntity{Name: "orders", QueueDescription: new(QueueDescription)})
+	tm.cacheTopic("orders", &TopicEntity{Name: "orders", TopicDescription: new(TopicDescription)})
+
+	qm.InvalidateAll()
+	_, ok := qm.cachedQueue("orders")
+	assert.False(t, ok)
+	_, ok = tm.cachedTopic("orders")
+	assert.True(t, ok, "invalidating queues leaves topics of the same name cached")
+
+	uncached, err := NewNamespace()
+	if assert.NoError(t, err) {
+		qm := uncached.NewQueueManager()
+		qm.cacheQueue("orders", &QueueEntity{Name: "orders"})
+		_, ok := qm.cachedQueue("orders")
+		assert.False(t, ok, "the cache is opt-in")
+		qm.InvalidateAll()
+	}
+
+	_, err = NewNamespace(NamespaceWithManagementCache(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// EnvelopeSchemaProperty is the user property which names the schema of a message payload, such as "OrderPlaced"
+	EnvelopeSchemaProperty = "envelope-schema"
+	// EnvelopeVersionProperty is the user property which carries the version of the schema the payload was written with
+	EnvelopeVersionProperty = "envelope-version"
+)
+
+type (
+	// Envelope names the schema of a message payload and the version of the schema it was written with, so consumers
+	// can decode payloads written by producers which have not been upgraded yet, or which have been upgraded first
+	Envelope struct {
+		Schema  string
+		Version int
+	}
+
+	// VersionedHandler is a Handler for the messages of a schema which dispatches each message to the handler registered
+	// for the version of the schema in its envelope. Messages without an envelope, of another schema or of a version
+	// without a handler are dead-lettered with an error describing why. To consume several schemas from one entity,
+	// register a VersionedHandler per schema with a TypeRouter which reads the type from EnvelopeSchemaProperty.
+	VersionedHandler struct {
+		schema   string
+		mu       sync.RWMutex
+		handlers map[int]Handler
+	}
+)
+
+// SetEnvelope annotates the message with the schema and version of its payload
+func (m *Message) SetEnvelope(env Envelope) {
+	if m.UserProperties == nil {
+		m.UserProperties = make(map[string]interface{})
+	}
+	m.UserProperties[EnvelopeSchemaProperty] = env.Schema
+	m.UserProperties[EnvelopeVersionProperty] = int64(env.Version)
+}
+
+// Envelope returns the schema and version the message is annotated with
+func (m *Message) Envelope() (Envelope, error) {
+	rawSchema, ok := m.UserProperties[EnvelopeSchemaProperty]
+	if !ok {
+		return Envelope{}, ErrMissingField(EnvelopeSchemaProperty)
+	}
+	schema, ok := rawSchema.(string)
+	if !ok {
+		return Envelope{}, newErrIncorrectType(EnvelopeSchemaProperty, "", rawSchema)
+	}
+
+	version, err := m.intProperty(EnvelopeVersionProperty)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Schema: schema, Version: version}, nil
+}
+
+// NegotiateVersion returns the highest version which both a producer and its consumers support, so a producer can
+// write the newest version every consumer can read. It returns false if there is no version in common.
+func NegotiateVersion(supported, offered []int) (int, bool) {
+	accepted := make(map[int]bool, len(supported))
+	for _, version := range supported {
+		accepted[version] = true
+	}
+
+	best, found := 0, false
+	for _, version := range offered {
+		if accepted[version] && (!found || version > best) {
+			best, found = version, true
+		}
+	}
+	return best, found
+}
+
+// NewVersionedHandler creates a VersionedHandler for the messages of the schema, without any registered handlers
+func NewVersionedHandler(schema string) (*VersionedHandler, error) {
+	if schema == "" {
+		return nil, errors.New("schema must not be empty")
+	}
+	return &VersionedHandler{schema: schema, handlers: make(map[int]Handler)}, nil
+}
+
+// Register registers the handler for messages written with the version of the schema
+func (vh *VersionedHandler) Register(version int, handler Handler) error {
+	if handler == nil {
+		return errors.New("handler must not be nil")
+	}
+
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+
+	if _, ok := vh.handlers[version]; ok {
+		return fmt.Errorf("a handler is already registered for version %d of schema %q", version, vh.schema)
+	}
+	vh.handlers[version] = handler
+	return nil
+}
+
+// SupportedVersions returns the versions of the schema with a registered handler in ascending order, which can be
+// advertised to producers for NegotiateVersion
+func (vh *VersionedHandler) SupportedVersions() []int {
+	vh.mu.RLock()
+	defer vh.mu.RUnlock()
+
+	versions := make([]int, 0, len(vh.handlers))
+	for version := range vh.handlers {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Handle passes the message to the handler registered for the version of the schema in its envelope, or dead-letters it
+// if it cannot be handled
+func (vh *VersionedHandler) Handle(ctx context.Context, msg *Message) DispositionAction {
+	env, err := msg.Envelope()
+	if err != nil {
+		return msg.DeadLetterWithInfo(err, ErrorInvalidField, map[string]string{"schema": vh.schema})
+	}
+
+	vh.mu.RLock()
+	handler, ok := vh.handlers[env.Version]
+	vh.mu.RUnlock()
+
+	if env.Schema == vh.schema && ok {
+		return handler.Handle(ctx, msg)
+	}
+
+	unsupported := ErrUnsupportedEnvelope{Envelope: env, Schema: vh.schema, SupportedVersions: vh.SupportedVersions()}
+	return msg.DeadLetterWithInfo(unsupported, ErrorNotImplemented, map[string]string{
+		"schema":             env.Schema,
+		"version":            strconv.Itoa(env.Version),
+		"supported-schema":   vh.schema,
+		"supported-versions": fmt.Sprint(unsupported.SupportedVersions),
+	})
+}
@@ -0,0 +1,113 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_Envelope(t *testing.T) {
+	msg := NewMessageFromString("payload")
+	_, err := msg.Envelope()
+	assert.Equal(t, ErrMissingField(EnvelopeSchemaProperty), err)
+
+	msg.SetEnvelope(Envelope{Schema: "OrderPlaced", Version: 2})
+	env, err := msg.Envelope()
+	assert.NoError(t, err)
+	assert.Equal(t, Envelope{Schema: "OrderPlaced", Version: 2}, env)
+
+	for _, version := range []interface{}{2, int32(2), "2"} {
+		msg.UserProperties[EnvelopeVersionProperty] = version
+		env, err := msg.Envelope()
+		if assert.NoError(t, err, "%T", version) {
+			assert.Equal(t, 2, env.Version)
+		}
+	}
+
+	msg.UserProperties[EnvelopeVersionProperty] = "two"
+	_, err = msg.Envelope()
+	assert.IsType(t, ErrIncorrectType{}, err)
+
+	delete(msg.UserProperties, EnvelopeVersionProperty)
+	_, err = msg.Envelope()
+	assert.Equal(t, ErrMissingField(EnvelopeVersionProperty), err)
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	version, ok := NegotiateVersion([]int{1, 2, 3}, []int{4, 2, 1})
+	assert.True(t, ok)
+	assert.Equal(t, 2, version)
+
+	_, ok = NegotiateVersion([]int{1}, []int{2, 3})
+	assert.False(t, ok)
+}
+
+func TestVersionedHandler(t *testing.T) {
+	_, err := NewVersionedHandler("")
+	assert.Error(t, err)
+
+	vh, err := NewVersionedHandler("OrderPlaced")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var handled []int
+	for _, version := range []int{2, 1} {
+		assert.NoError(t, vh.Register(version, HandlerFunc(func(context.Context, *Message) DispositionAction {
+			handled = append(handled, version)
+			return nil
+		})))
+	}
+	assert.Error(t, vh.Register(1, HandlerFunc(func(context.Context, *Message) DispositionAction { return nil })))
+	assert.Error(t, vh.Register(3, nil))
+	assert.Equal(t, []int{1, 2}, vh.SupportedVersions())
+
+	handle := func(env *Envelope) DispositionAction {
+		msg := NewMessageFromString("payload")
+		if env != nil {
+			msg.SetEnvelope(*env)
+		}
+		return vh.Handle(context.Background(), msg)
+	}
+
+	assert.Nil(t, handle(&Envelope{Schema: "OrderPlaced", Version: 2}))
+	assert.Nil(t, handle(&Envelope{Schema: "OrderPlaced", Version: 1}))
+	assert.Equal(t, []int{2, 1}, handled)
+
+	// messages which cannot be handled are dead-lettered rather than passed on
+	assert.NotNil(t, handle(&Envelope{Schema: "OrderPlaced", Version: 3}))
+	assert.NotNil(t, handle(&Envelope{Schema: "OrderShipped", Version: 1}))
+	assert.NotNil(t, handle(nil))
+	assert.Equal(t, []int{2, 1}, handled)
+}
+
+func TestErrUnsupportedEnvelope(t *testing.T) {
+	err := ErrUnsupportedEnvelope{Envelope: Envelope{Schema: "OrderPlaced", Version: 3}, Schema: "OrderPlaced", SupportedVersions: []int{1, 2}}
+	assert.Equal(t, `version 3 of schema "OrderPlaced" is not supported; supported versions are [1, 2]`, err.Error())
+
+	err.Envelope.Schema = "OrderShipped"
+	assert.Equal(t, `message has schema "OrderShipped", but the handler only supports schema "OrderPlaced"`, err.Error())
+}
@@ -0,0 +1,184 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-amqp-common-go/aad"
+	"github.com/Azure/azure-amqp-common-go/sas"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+const (
+	// serviceBusResourceURI is the resource Azure Active Directory tokens for Service Bus are issued for
+	serviceBusResourceURI = "https://servicebus.azure.net/"
+)
+
+type (
+	// environmentCredential is the credential NewNamespaceFromEnvironment chose, and the option configuring it
+	environmentCredential struct {
+		source string
+		option NamespaceOption
+	}
+)
+
+// NewNamespaceFromEnvironment creates a namespace from the environment variables of the process, so 12-factor
+// applications can be configured without code. The first of the following which is fully configured is used:
+//
+// 1. Connection string: "SERVICEBUS_CONNECTION_STRING"
+//
+// 2. Shared access key: "SERVICEBUS_NAMESPACE", "SERVICEBUS_KEY_NAME" and "SERVICEBUS_KEY"
+//
+// 3. Service principal secret: "SERVICEBUS_NAMESPACE", "AZURE_TENANT_ID", "AZURE_CLIENT_ID" and "AZURE_CLIENT_SECRET"
+//
+// 4. Service principal certificate: "SERVICEBUS_NAMESPACE", "AZURE_TENANT_ID", "AZURE_CLIENT_ID",
+// "AZURE_CERTIFICATE_PATH" and optionally "AZURE_CERTIFICATE_PASSWORD"
+//
+// 5. Managed identity: "SERVICEBUS_NAMESPACE", and "AZURE_CLIENT_ID" to choose a user-assigned identity
+//
+// The Azure cloud may be chosen by name, such as "AzureChinaCloud", with "AZURE_ENVIRONMENT". The options are applied
+// after the credentials, so they may override anything read from the environment.
+func NewNamespaceFromEnvironment(opts ...NamespaceOption) (*Namespace, error) {
+	cred, err := credentialFromEnvironment(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	return NewNamespace(append([]NamespaceOption{cred.option}, opts...)...)
+}
+
+// credentialFromEnvironment chooses the credential configured by the variables getenv returns, following the
+// precedence documented on NewNamespaceFromEnvironment
+func credentialFromEnvironment(getenv func(string) string) (*environmentCredential, error) {
+	env := azure.PublicCloud
+	if name := getenv("AZURE_ENVIRONMENT"); name != "" {
+		var err error
+		if env, err = azure.EnvironmentFromName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if connStr := getenv("SERVICEBUS_CONNECTION_STRING"); connStr != "" {
+		return &environmentCredential{
+			source: "connection string",
+			option: withEnvironment(env, NamespaceWithConnectionString(connStr)),
+		}, nil
+	}
+
+	name := getenv("SERVICEBUS_NAMESPACE")
+	if name == "" {
+		return nil, errors.New("no Service Bus credentials in the environment: set SERVICEBUS_CONNECTION_STRING, " +
+			"or SERVICEBUS_NAMESPACE with a shared access key, a service principal or a managed identity")
+	}
+	named := func(option NamespaceOption) NamespaceOption {
+		return withEnvironment(env, func(ns *Namespace) error {
+			ns.Name = name
+			return option(ns)
+		})
+	}
+
+	if keyName, key := getenv("SERVICEBUS_KEY_NAME"), getenv("SERVICEBUS_KEY"); keyName != "" && key != "" {
+		return &environmentCredential{
+			source: "shared access key",
+			option: named(func(ns *Namespace) error {
+				provider, err := sas.NewTokenProvider(sas.TokenProviderWithKey(keyName, key))
+				if err != nil {
+					return err
+				}
+				ns.TokenProvider = provider
+				return nil
+			}),
+		}, nil
+	}
+
+	config := &aad.TokenProviderConfiguration{
+		TenantID:            getenv("AZURE_TENANT_ID"),
+		ClientID:            getenv("AZURE_CLIENT_ID"),
+		ClientSecret:        getenv("AZURE_CLIENT_SECRET"),
+		CertificatePath:     getenv("AZURE_CERTIFICATE_PATH"),
+		CertificatePassword: getenv("AZURE_CERTIFICATE_PASSWORD"),
+		ResourceURI:         serviceBusResourceURI,
+		Env:                 &env,
+	}
+	if config.ClientSecret != "" || config.CertificatePath != "" {
+		if config.TenantID == "" || config.ClientID == "" {
+			return nil, errors.New("AZURE_TENANT_ID and AZURE_CLIENT_ID are required to authenticate as a service principal")
+		}
+		source := "service principal secret"
+		if config.ClientSecret == "" {
+			source = "service principal certificate"
+		}
+		return &environmentCredential{
+			source: source,
+			option: named(func(ns *Namespace) error {
+				token, err := config.NewServicePrincipalToken()
+				if err != nil {
+					return err
+				}
+				return NamespaceWithAzureActiveDirectory(token)(ns)
+			}),
+		}, nil
+	}
+
+	return &environmentCredential{
+		source: "managed identity",
+		option: named(func(ns *Namespace) error {
+			token, err := managedIdentityToken(config.ClientID)
+			if err != nil {
+				return err
+			}
+			return NamespaceWithAzureActiveDirectory(token)(ns)
+		}),
+	}, nil
+}
+
+// withEnvironment runs the option on a namespace in the Azure cloud env
+func withEnvironment(env azure.Environment, option NamespaceOption) NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.Environment = env
+		return option(ns)
+	}
+}
+
+// managedIdentityToken acquires a token for Service Bus from the managed identity of the host, which is the identity
+// with the client ID if one is given, or the system-assigned identity otherwise
+func managedIdentityToken(clientID string) (*adal.ServicePrincipalToken, error) {
+	endpoint, err := adal.GetMSIVMEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	var token *adal.ServicePrincipalToken
+	if clientID != "" {
+		token, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, serviceBusResourceURI, clientID)
+	} else {
+		token, err = adal.NewServicePrincipalTokenFromMSI(endpoint, serviceBusResourceURI)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a token from the managed identity: %v", err)
+	}
+	return token, nil
+}
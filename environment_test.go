@@ -0,0 +1,106 @@
+package servicebus
+
+import (
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialFromEnvironment_Precedence(t *testing.T) {
+	const connStr = "Endpoint=sb://fromconnstr.servicebus.windows.net/;SharedAccessKeyName=key;SharedAccessKey=secret"
+	cases := []struct {
+		name   string
+		env    map[string]string
+		source string
+	}{
+		{
+			name: "connection string wins",
+			env: map[string]string{
+				"SERVICEBUS_CONNECTION_STRING": connStr,
+				"SERVICEBUS_NAMESPACE":         "other",
+				"SERVICEBUS_KEY_NAME":          "key",
+				"SERVICEBUS_KEY":               "secret",
+			},
+			source: "connection string",
+		},
+		{
+			name: "shared access key before service principal",
+			env: map[string]string{
+				"SERVICEBUS_NAMESPACE": "mynamespace",
+				"SERVICEBUS_KEY_NAME":  "key",
+				"SERVICEBUS_KEY":       "secret",
+				"AZURE_TENANT_ID":      "tenant",
+				"AZURE_CLIENT_ID":      "client",
+				"AZURE_CLIENT_SECRET":  "secret",
+			},
+			source: "shared access key",
+		},
+		{
+			name: "service principal secret",
+			env: map[string]string{
+				"SERVICEBUS_NAMESPACE": "mynamespace",
+				"AZURE_TENANT_ID":      "tenant",
+				"AZURE_CLIENT_ID":      "client",
+				"AZURE_CLIENT_SECRET":  "secret",
+			},
+			source: "service principal secret",
+		},
+		{
+			name: "service principal certificate",
+			env: map[string]string{
+				"SERVICEBUS_NAMESPACE":   "mynamespace",
+				"AZURE_TENANT_ID":        "tenant",
+				"AZURE_CLIENT_ID":        "client",
+				"AZURE_CERTIFICATE_PATH": "/etc/certs/sp.pfx",
+			},
+			source: "service principal certificate",
+		},
+		{
+			name: "user-assigned managed identity",
+			env: map[string]string{
+				"SERVICEBUS_NAMESPACE": "mynamespace",
+				"AZURE_CLIENT_ID":      "client",
+			},
+			source: "managed identity",
+		},
+	}
+
+	for _, c := range cases {
+		cred, err := credentialFromEnvironment(func(key string) string { return c.env[key] })
+		if assert.NoError(t, err, c.name) {
+			assert.Equal(t, c.source, cred.source, c.name)
+		}
+	}
+}
+
+func TestCredentialFromEnvironment_ConfiguresNamespace(t *testing.T) {
+	env := map[string]string{
+		"SERVICEBUS_NAMESPACE": "mynamespace",
+		"SERVICEBUS_KEY_NAME":  "key",
+		"SERVICEBUS_KEY":       "secret",
+		"AZURE_ENVIRONMENT":    "AzureChinaCloud",
+	}
+	cred, err := credentialFromEnvironment(func(key string) string { return env[key] })
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ns, err := NewNamespace(cred.option)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mynamespace", ns.Name)
+		assert.Equal(t, azure.ChinaCloud.ServiceBusEndpointSuffix, ns.Environment.ServiceBusEndpointSuffix)
+		assert.NotNil(t, ns.TokenProvider)
+	}
+}
+
+func TestCredentialFromEnvironment_Errors(t *testing.T) {
+	for name, env := range map[string]map[string]string{
+		"nothing configured":        {},
+		"unknown cloud":             {"AZURE_ENVIRONMENT": "Moon", "SERVICEBUS_CONNECTION_STRING": "Endpoint=sb://a/"},
+		"secret without the tenant": {"SERVICEBUS_NAMESPACE": "mynamespace", "AZURE_CLIENT_SECRET": "secret"},
+	} {
+		_, err := credentialFromEnvironment(func(key string) string { return env[key] })
+		assert.Error(t, err, name)
+	}
+}
@@ -2,8 +2,12 @@ package servicebus
 
 import (
 	"fmt"
-	"github.com/Azure/azure-amqp-common-go/rpc"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/rpc"
 )
 
 type (
@@ -25,6 +29,47 @@ type (
 	// ErrNoMessages is returned when an operation returned no messages. It is not indicative that there will not be
 	// more messages in the future.
 	ErrNoMessages struct{}
+
+	// ErrEntityNotFound is returned when the Queue, Topic or Subscription an operation targets does not exist
+	ErrEntityNotFound struct {
+		EntityPath string
+	}
+
+	// ErrEntityPathMismatch is returned when a Queue, Topic or Subscription is created on a namespace whose connection
+	// string is scoped to a different entity. The shared access key in such a connection string is only authorized
+	// for the entity named by its EntityPath, so any other entity would fail with an unauthorized access error.
+	ErrEntityPathMismatch struct {
+		ConnectionEntityPath string
+		EntityPath           string
+	}
+
+	// ErrServerBusy is returned when Service Bus rejects an operation because the namespace is throttling requests.
+	// RetryAfter reports how long the service asked the caller to wait before trying again, when it said so.
+	ErrServerBusy struct {
+		Description string
+		retryAfter  time.Duration
+	}
+
+	// ErrUnknownMessageType is the reason a TypeRouter dead-letters a message whose type has no registered handler
+	ErrUnknownMessageType struct {
+		Type string
+	}
+
+	// ErrIncompleteChunkGroup is the reason the chunks of a message are dead-lettered when the rest of its chunks do not
+	// arrive within the reassembly timeout
+	ErrIncompleteChunkGroup struct {
+		GroupID  string
+		Received int
+		Count    int
+	}
+
+	// ErrUnsupportedEnvelope is the reason a VersionedHandler dead-letters a message whose envelope names a different
+	// schema, or a version of the schema without a registered handler
+	ErrUnsupportedEnvelope struct {
+		Envelope          Envelope
+		Schema            string
+		SupportedVersions []int
+	}
 )
 
 func (e ErrMissingField) Error() string {
@@ -56,3 +101,47 @@ func (e ErrAMQP) Error() string {
 func (e ErrNoMessages) Error() string {
 	return "no messages available"
 }
+
+func (e ErrEntityNotFound) Error() string {
+	return fmt.Sprintf("entity %q not found", e.EntityPath)
+}
+
+func (e ErrEntityPathMismatch) Error() string {
+	return fmt.Sprintf("connection string is scoped to entity %q, but entity %q was requested; use a namespace level "+
+		"connection string or NamespaceWithEntityPathMismatchAllowed to override", e.ConnectionEntityPath, e.EntityPath)
+}
+
+func (e ErrUnknownMessageType) Error() string {
+	if e.Type == "" {
+		return "message has no type to route it to a handler by"
+	}
+	return fmt.Sprintf("no handler is registered for message type %q", e.Type)
+}
+
+func (e ErrIncompleteChunkGroup) Error() string {
+	return fmt.Sprintf("only %d of the %d chunks of message %q arrived before the reassembly timeout", e.Received, e.Count, e.GroupID)
+}
+
+func (e ErrUnsupportedEnvelope) Error() string {
+	if e.Envelope.Schema != e.Schema {
+		return fmt.Sprintf("message has schema %q, but the handler only supports schema %q", e.Envelope.Schema, e.Schema)
+	}
+
+	versions := make([]string, len(e.SupportedVersions))
+	for i, version := range e.SupportedVersions {
+		versions[i] = strconv.Itoa(version)
+	}
+	return fmt.Sprintf("version %d of schema %q is not supported; supported versions are [%s]", e.Envelope.Version, e.Schema, strings.Join(versions, ", "))
+}
+
+func (e ErrServerBusy) Error() string {
+	if e.retryAfter > 0 {
+		return fmt.Sprintf("server busy, retry after %s: %s", e.retryAfter, e.Description)
+	}
+	return "server busy: " + e.Description
+}
+
+// RetryAfter returns the delay the service asked for before the operation is retried, if it provided one
+func (e ErrServerBusy) RetryAfter() (time.Duration, bool) {
+	return e.retryAfter, e.retryAfter > 0
+}
@@ -0,0 +1,219 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"pack.ag/amqp"
+)
+
+// defaultFailoverCheckInterval is how often the host name of the namespace is resolved to detect a Geo-DR failover
+const defaultFailoverCheckInterval = 30 * time.Second
+
+type (
+	// ErrFailover is reported through OnStateChange when the host name of the namespace, such as a Geo-DR alias, starts
+	// resolving to a different namespace. Open connections are closed and reopened against the new namespace.
+	ErrFailover struct {
+		Host string
+		From string
+		To   string
+	}
+
+	// failoverDetector periodically resolves the host name of a namespace and reconnects when its target changes
+	failoverDetector struct {
+		mu          sync.Mutex
+		interval    time.Duration
+		lookupCNAME func(ctx context.Context, host string) (string, error)
+		closeConn   func(conn *amqp.Client) error
+		check       chan struct{}
+		running     bool
+		target      string
+		closed      map[*amqp.Client]struct{}
+	}
+)
+
+func (e ErrFailover) Error() string {
+	return fmt.Sprintf("failover detected: %s moved from %s to %s", e.Host, e.From, e.To)
+}
+
+// NamespaceWithFailoverDetection configures the namespace to detect a Geo-DR failover and reconnect automatically. To
+// use a Geo-DR alias, configure the namespace with the alias name or its connection string; the alias resolves to the
+// current primary namespace. While connections are open, the alias is resolved every 30 seconds, and immediately when
+// the service forcibly closes or redirects a connection. When it resolves to a different namespace, an ErrFailover is
+// reported through OnStateChange and open connections are closed, so senders and receivers reconnect to the new
+// primary.
+func NamespaceWithFailoverDetection() NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.failover = &failoverDetector{
+			interval:    defaultFailoverCheckInterval,
+			lookupCNAME: net.DefaultResolver.LookupCNAME,
+			closeConn:   (*amqp.Client).Close,
+			check:       make(chan struct{}, 1),
+			closed:      make(map[*amqp.Client]struct{}),
+		}
+		return nil
+	}
+}
+
+// watchFailover starts the failover detector if it is enabled and not already running
+func (ns *Namespace) watchFailover() {
+	fd := ns.failover
+	if fd == nil {
+		return
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.running {
+		return
+	}
+	fd.running = true
+	go ns.detectFailovers()
+}
+
+// detectFailovers resolves the host name of the namespace at each interval, or when asked to check early, until the
+// namespace has no open connections left
+func (ns *Namespace) detectFailovers() {
+	fd := ns.failover
+	ctx := context.Background()
+	for {
+		fd.mu.Lock()
+		if !ns.hasConnections() {
+			// restarted by watchFailover when the next connection is opened
+			fd.running = false
+			fd.mu.Unlock()
+			return
+		}
+		fd.mu.Unlock()
+
+		ns.resolveFailover(ctx)
+
+		select {
+		case <-ns.getClock().After(fd.interval):
+		case <-fd.check:
+		}
+	}
+}
+
+// resolveFailover resolves the host name of the namespace and, if it resolves to a different namespace than it did
+// before, closes the open connections so they are reopened against the new target
+func (ns *Namespace) resolveFailover(ctx context.Context) {
+	fd := ns.failover
+	host := ns.getHostName()
+	target, err := fd.lookupCNAME(ctx, host)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return
+	}
+	target = strings.TrimSuffix(target, ".")
+
+	fd.mu.Lock()
+	previous := fd.target
+	fd.target = target
+	fd.mu.Unlock()
+
+	if previous == "" || strings.EqualFold(previous, target) {
+		return
+	}
+
+	failoverErr := ErrFailover{Host: host, From: previous, To: target}
+	log.For(ctx).Info(failoverErr.Error())
+	ns.reconnecting(failoverErr)
+
+	ns.state.mu.Lock()
+	conns := make([]*amqp.Client, 0, len(ns.state.connections))
+	for conn := range ns.state.connections {
+		conns = append(conns, conn)
+	}
+	ns.state.mu.Unlock()
+
+	for _, conn := range conns {
+		fd.mu.Lock()
+		fd.closed[conn] = struct{}{}
+		fd.mu.Unlock()
+		if err := fd.closeConn(conn); err != nil {
+			log.For(ctx).Error(err)
+		}
+	}
+}
+
+// checkFailover asks the failover detector to resolve the host name now if err indicates the service moved the
+// connection
+func (ns *Namespace) checkFailover(err error) {
+	if ns.failover == nil || !isFailoverCondition(err) {
+		return
+	}
+
+	select {
+	case ns.failover.check <- struct{}{}:
+	default:
+	}
+}
+
+// closedForFailover reports whether the connection was closed because a failover was detected, in which case the
+// errors of its links should be recovered from rather than returned
+func (ns *Namespace) closedForFailover(conn *amqp.Client) bool {
+	if ns.failover == nil || conn == nil {
+		return false
+	}
+
+	ns.failover.mu.Lock()
+	defer ns.failover.mu.Unlock()
+	_, ok := ns.failover.closed[conn]
+	return ok
+}
+
+// forgetConnection stops tracking a connection closed for a failover once its owner has closed it
+func (fd *failoverDetector) forgetConnection(conn *amqp.Client) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	delete(fd.closed, conn)
+}
+
+func isFailoverCondition(err error) bool {
+	var amqpErr *amqp.Error
+	switch e := err.(type) {
+	case *amqp.Error:
+		amqpErr = e
+	case *amqp.DetachError:
+		amqpErr = e.RemoteError
+	}
+
+	if amqpErr == nil {
+		return false
+	}
+
+	switch amqpErr.Condition {
+	case amqp.ErrorConnectionForced, amqp.ErrorConnectionRedirect, amqp.ErrorLinkRedirect:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,207 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go"
+	"github.com/Azure/azure-amqp-common-go/log"
+	"pack.ag/amqp"
+)
+
+// defaultFailbackInterval is how long a FailoverSender sends to the secondary before trying the primary again
+const defaultFailbackInterval = time.Minute
+
+type (
+	// FailoverSender sends to a primary entity and, while the primary is failing, to a secondary entity in another
+	// namespace. It supports active/passive disaster recovery without a Geo-DR alias. Consumers must receive from both
+	// entities, and should enable duplicate detection, since a message whose send to the primary failed part way may
+	// reach both.
+	FailoverSender struct {
+		primary          MessageSender
+		secondary        MessageSender
+		failbackInterval time.Duration
+		clock            Clock
+		mu               sync.Mutex
+		failedAt         *time.Time
+	}
+
+	// FailoverSenderOption configures a FailoverSender
+	FailoverSenderOption func(*FailoverSender) error
+
+	// ErrFailoverSend is returned by a FailoverSender when the primary was unavailable and sending to the secondary
+	// failed too. It carries both errors.
+	ErrFailoverSend struct {
+		Primary   error
+		Secondary error
+	}
+)
+
+func (e ErrFailoverSend) Error() string {
+	return fmt.Sprintf("failed to send to the primary: %v; and to the secondary: %v", e.Primary, e.Secondary)
+}
+
+// Unwrap returns the errors of the primary and the secondary
+func (e ErrFailoverSend) Unwrap() []error {
+	return []error{e.Primary, e.Secondary}
+}
+
+// FailoverSenderWithFailbackInterval configures how long the FailoverSender sends to the secondary after the primary
+// fails before it tries the primary again. The default is 1 minute.
+func FailoverSenderWithFailbackInterval(interval time.Duration) FailoverSenderOption {
+	return func(fs *FailoverSender) error {
+		if interval <= 0 {
+			return errors.New("failback interval must be greater than 0")
+		}
+		fs.failbackInterval = interval
+		return nil
+	}
+}
+
+// FailoverSenderWithClock configures the FailoverSender to use the provided Clock to time failback rather than the
+// system clock
+func FailoverSenderWithClock(clock Clock) FailoverSenderOption {
+	return func(fs *FailoverSender) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		fs.clock = clock
+		return nil
+	}
+}
+
+// NewFailoverSender creates a FailoverSender which sends to primary while it is healthy and to secondary otherwise,
+// for example a Queue of the same name in each of two namespaces
+func NewFailoverSender(primary, secondary MessageSender, opts ...FailoverSenderOption) (*FailoverSender, error) {
+	if primary == nil || secondary == nil {
+		return nil, errors.New("both a primary and a secondary sender are required")
+	}
+
+	fs := &FailoverSender{
+		primary:          primary,
+		secondary:        secondary,
+		failbackInterval: defaultFailbackInterval,
+		clock:            systemClock{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(fs); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// Send sends the message to the primary unless it failed within the failback interval, in which case the message is
+// sent to the secondary. If sending to the primary fails because it is unavailable, with a connection error or a
+// transient error such as server busy, the message is sent to the secondary and the primary is avoided until the
+// failback interval has elapsed; the next send after that tries the primary again. Any other error, such as the
+// message being too large or the sender being unauthorized, is returned without failing over, as the secondary would
+// reject the message too. If the secondary fails as well, the returned ErrFailoverSend carries both errors.
+func (fs *FailoverSender) Send(ctx context.Context, msg *Message) error {
+	span, ctx := fs.startSpanFromContext(ctx, "sb.FailoverSender.Send")
+	defer span.End()
+
+	if !fs.primaryAvailable() {
+		return fs.secondary.Send(ctx, msg)
+	}
+
+	primaryErr := fs.primary.Send(ctx, msg)
+	if primaryErr == nil {
+		fs.setFailed(nil)
+		return nil
+	}
+	if ctx.Err() != nil || !isUnavailable(primaryErr) {
+		return primaryErr
+	}
+
+	log.For(ctx).Error(primaryErr)
+	now := fs.clock.Now()
+	fs.setFailed(&now)
+	span.SetAttribute("sb.failover", true)
+
+	if err := fs.secondary.Send(ctx, msg); err != nil {
+		return ErrFailoverSend{Primary: primaryErr, Secondary: err}
+	}
+	return nil
+}
+
+// UsingSecondary reports whether sends are currently routed to the secondary
+func (fs *FailoverSender) UsingSecondary() bool {
+	return !fs.primaryAvailable()
+}
+
+func (fs *FailoverSender) primaryAvailable() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.failedAt == nil || fs.clock.Now().Sub(*fs.failedAt) >= fs.failbackInterval
+}
+
+func (fs *FailoverSender) setFailed(at *time.Time) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failedAt = at
+}
+
+// isUnavailable reports whether the error means the entity could not be reached, or was too busy to take the message,
+// rather than that it rejected the message
+func isUnavailable(err error) bool {
+	if _, ok := ErrorRetryAfter(err); ok {
+		return true
+	}
+
+	switch e := err.(type) {
+	case ErrServerBusy, ErrFailover, common.Retryable:
+		return true
+	case *amqp.DetachError:
+		return e.RemoteError == nil || isUnavailableCondition(e.RemoteError.Condition)
+	case *amqp.Error:
+		return isUnavailableCondition(e.Condition)
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, amqp.ErrConnClosed) ||
+		errors.Is(err, amqp.ErrSessionClosed) ||
+		errors.Is(err, amqp.ErrLinkClosed) ||
+		errors.Is(err, amqp.ErrTimeout) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func isUnavailableCondition(condition amqp.ErrorCondition) bool {
+	switch condition {
+	case serverBusyCondition, amqp.ErrorInternalError, amqp.ErrorConnectionForced, amqp.ErrorConnectionRedirect,
+		amqp.ErrorLinkRedirect, amqp.ErrorDetachForced, amqp.ErrorResourceLimitExceeded:
+		return true
+	default:
+		return false
+	}
+}
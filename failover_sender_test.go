@@ -0,0 +1,149 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+type fakeMessageSender struct {
+	err  error
+	sent []*Message
+}
+
+func (fs *fakeMessageSender) Send(_ context.Context, msg *Message) error {
+	if fs.err != nil {
+		return fs.err
+	}
+	fs.sent = append(fs.sent, msg)
+	return nil
+}
+
+func TestFailoverSender_FailsOverAndBack(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	primary, secondary := new(fakeMessageSender), new(fakeMessageSender)
+	fs, err := NewFailoverSender(primary, secondary, FailoverSenderWithClock(clock), FailoverSenderWithFailbackInterval(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, fs.Send(ctx, NewMessageFromString("1")))
+	assert.Len(t, primary.sent, 1)
+	assert.False(t, fs.UsingSecondary())
+
+	primary.err = &amqp.Error{Condition: serverBusyCondition}
+	assert.NoError(t, fs.Send(ctx, NewMessageFromString("2")))
+	assert.Len(t, secondary.sent, 1, "the failed send is retried on the secondary")
+	assert.True(t, fs.UsingSecondary())
+
+	// the primary is not tried again until the failback interval has elapsed
+	primary.err = nil
+	assert.NoError(t, fs.Send(ctx, NewMessageFromString("3")))
+	assert.Len(t, primary.sent, 1)
+	assert.Len(t, secondary.sent, 2)
+
+	clock.Advance(time.Minute)
+	assert.False(t, fs.UsingSecondary())
+	assert.NoError(t, fs.Send(ctx, NewMessageFromString("4")))
+	assert.Len(t, primary.sent, 2)
+	assert.False(t, fs.UsingSecondary())
+}
+
+func TestFailoverSender_BothFailing(t *testing.T) {
+	primary := &fakeMessageSender{err: amqp.ErrConnClosed}
+	secondary := &fakeMessageSender{err: errors.New("secondary down")}
+	fs, err := NewFailoverSender(primary, secondary)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = fs.Send(context.Background(), NewMessageFromString("1"))
+	assert.Equal(t, ErrFailoverSend{Primary: amqp.ErrConnClosed, Secondary: secondary.err}, err)
+	assert.True(t, errors.Is(err, amqp.ErrConnClosed))
+	assert.True(t, errors.Is(err, secondary.err))
+
+	// once failed over, the secondary's error is returned as it is
+	assert.Equal(t, secondary.err, fs.Send(context.Background(), NewMessageFromString("2")))
+}
+
+func TestFailoverSender_RejectedMessageDoesNotFailOver(t *testing.T) {
+	for _, rejection := range []error{
+		&amqp.Error{Condition: amqp.ErrorMessageSizeExceeded},
+		&amqp.DetachError{RemoteError: &amqp.Error{Condition: amqp.ErrorUnauthorizedAccess}},
+		ErrEntityNotFound{EntityPath: "queue"},
+		errors.New("invalid message"),
+	} {
+		primary := &fakeMessageSender{err: rejection}
+		secondary := new(fakeMessageSender)
+		fs, err := NewFailoverSender(primary, secondary)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, rejection, fs.Send(context.Background(), NewMessageFromString("1")))
+		assert.Empty(t, secondary.sent)
+		assert.False(t, fs.UsingSecondary())
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	for _, err := range []error{
+		ErrServerBusy{Description: "busy"},
+		&amqp.DetachError{RemoteError: &amqp.Error{Condition: serverBusyCondition}},
+		&amqp.DetachError{},
+		&amqp.Error{Condition: amqp.ErrorConnectionForced},
+		amqp.ErrConnClosed,
+		amqp.ErrLinkClosed,
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")},
+		ErrFailover{Host: "alias"},
+	} {
+		assert.True(t, isUnavailable(err), err.Error())
+	}
+}
+
+func TestFailoverSender_CanceledContextDoesNotFailOver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	primary := &fakeMessageSender{err: context.Canceled}
+	secondary := new(fakeMessageSender)
+	fs, err := NewFailoverSender(primary, secondary)
+	if assert.NoError(t, err) {
+		assert.Equal(t, context.Canceled, fs.Send(ctx, NewMessageFromString("1")))
+		assert.Empty(t, secondary.sent)
+		assert.False(t, fs.UsingSecondary())
+	}
+}
+
+func TestNewFailoverSender_Validation(t *testing.T) {
+	_, err := NewFailoverSender(nil, new(fakeMessageSender))
+	assert.Error(t, err)
+	_, err = NewFailoverSender(new(fakeMessageSender), new(fakeMessageSender), FailoverSenderWithFailbackInterval(0))
+	assert.Error(t, err)
+}
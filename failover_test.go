@@ -0,0 +1,179 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+type fakeResolver struct {
+	mu      sync.Mutex
+	target  string
+	lookups int
+}
+
+func (fr *fakeResolver) set(target string) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.target = target
+}
+
+func (fr *fakeResolver) lookupCNAME(_ context.Context, _ string) (string, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.lookups++
+	return fr.target, nil
+}
+
+func (fr *fakeResolver) waitForLookups(n int) {
+	for {
+		fr.mu.Lock()
+		lookups := fr.lookups
+		fr.mu.Unlock()
+		if lookups >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newFailoverTestNamespace(t *testing.T, clock Clock, resolver *fakeResolver, closed chan *amqp.Client) *Namespace {
+	ns, err := NewNamespace(NamespaceWithClock(clock), NamespaceWithFailoverDetection())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ns.Name = "alias"
+	ns.failover.lookupCNAME = resolver.lookupCNAME
+	ns.failover.closeConn = func(conn *amqp.Client) error {
+		closed <- conn
+		return nil
+	}
+	return ns
+}
+
+func TestFailoverDetection_ReconnectsWhenAliasMoves(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	resolver := &fakeResolver{target: "primary.servicebus.windows.net."}
+	closed := make(chan *amqp.Client, 1)
+	ns := newFailoverTestNamespace(t, clock, resolver, closed)
+
+	var mu sync.Mutex
+	var states []State
+	ns.OnStateChange(func(s State) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, s)
+	})
+
+	conn := new(amqp.Client)
+	ns.connectionOpened(conn, nil)
+	clock.waitForCalls(1)
+
+	resolver.set("secondary.servicebus.windows.net.")
+	clock.Advance(defaultFailoverCheckInterval)
+
+	select {
+	case got := <-closed:
+		assert.Equal(t, conn, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed after the alias moved")
+	}
+
+	assert.True(t, ns.closedForFailover(conn))
+	mu.Lock()
+	assert.Equal(t, State{
+		Status: Reconnecting,
+		Err: ErrFailover{
+			Host: "alias.servicebus.windows.net",
+			From: "primary.servicebus.windows.net",
+			To:   "secondary.servicebus.windows.net",
+		},
+	}, states[len(states)-1])
+	mu.Unlock()
+
+	ns.failover.forgetConnection(conn)
+	assert.False(t, ns.closedForFailover(conn))
+}
+
+func TestFailoverDetection_ChecksEarlyOnRedirect(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	resolver := &fakeResolver{target: "primary.servicebus.windows.net."}
+	closed := make(chan *amqp.Client, 1)
+	ns := newFailoverTestNamespace(t, clock, resolver, closed)
+
+	conn := new(amqp.Client)
+	ns.connectionOpened(conn, nil)
+	clock.waitForCalls(1)
+
+	resolver.set("secondary.servicebus.windows.net.")
+	ns.reconnecting(&amqp.DetachError{RemoteError: &amqp.Error{Condition: amqp.ErrorConnectionForced}})
+
+	select {
+	case got := <-closed:
+		assert.Equal(t, conn, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a forced close did not trigger a failover check")
+	}
+}
+
+func TestFailoverDetection_StopsWithoutConnections(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	resolver := &fakeResolver{target: "primary.servicebus.windows.net."}
+	ns := newFailoverTestNamespace(t, clock, resolver, make(chan *amqp.Client, 1))
+
+	conn := new(amqp.Client)
+	ns.connectionOpened(conn, nil)
+	clock.waitForCalls(1)
+
+	ns.state.mu.Lock()
+	delete(ns.state.connections, conn)
+	ns.state.mu.Unlock()
+	clock.Advance(defaultFailoverCheckInterval)
+
+	for {
+		ns.failover.mu.Lock()
+		running := ns.failover.running
+		ns.failover.mu.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ns.connectionOpened(conn, nil)
+	resolver.waitForLookups(2)
+}
+
+func TestIsFailoverCondition(t *testing.T) {
+	assert.True(t, isFailoverCondition(&amqp.Error{Condition: amqp.ErrorConnectionRedirect}))
+	assert.True(t, isFailoverCondition(&amqp.DetachError{RemoteError: &amqp.Error{Condition: amqp.ErrorLinkRedirect}}))
+	assert.False(t, isFailoverCondition(&amqp.Error{Condition: amqp.ErrorNotFound}))
+	assert.False(t, isFailoverCondition(&amqp.DetachError{}))
+	assert.False(t, isFailoverCondition(amqp.ErrConnClosed))
+}
@@ -0,0 +1,97 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"pack.ag/amqp"
+)
+
+type (
+	// faultInjector simulates broker failures so tests can exercise the recovery paths of senders and receivers
+	// deterministically. It is installed with namespaceWithFaultInjector and is never set outside of tests.
+	faultInjector interface {
+		// transfer is called before a message is sent to entityPath. Returning an error fails the transfer as if
+		// the broker had returned it; errTransferDropped loses the message without the sender finding out, and an
+		// *amqp.DetachError forces the sender to recover its link.
+		transfer(ctx context.Context, entityPath string, msg *amqp.Message) error
+		// disposition is called before a received message is settled with the outcome and returns how long to delay
+		// the disposition by, measured by the namespace Clock
+		disposition(ctx context.Context, msg *Message, outcome SettlementOutcome) time.Duration
+		// receive is called before a receiver waits for a message from entityPath. Returning an error fails the
+		// receive as if the link had, so an *amqp.DetachError forces the receiver to recover its link.
+		receive(ctx context.Context, entityPath string) error
+	}
+)
+
+var (
+	// errTransferDropped is returned by a faultInjector to drop a transfer on its way to the broker
+	errTransferDropped = errors.New("transfer dropped by fault injection")
+)
+
+// namespaceWithFaultInjector configures a namespace to consult the faultInjector before transfers, dispositions and
+// receives
+func namespaceWithFaultInjector(fi faultInjector) NamespaceOption {
+	return func(ns *Namespace) error {
+		if fi == nil {
+			return errors.New("fault injector must not be nil")
+		}
+		ns.faults = fi
+		return nil
+	}
+}
+
+// transferFault returns the error a transfer of the message should fail with, or nil to send it. A dropped transfer
+// reports success, as the message is lost after it leaves the sender.
+func (ns *Namespace) transferFault(ctx context.Context, entityPath string, msg *amqp.Message) (dropped bool, err error) {
+	if ns == nil || ns.faults == nil {
+		return false, nil
+	}
+	err = ns.faults.transfer(ctx, entityPath, msg)
+	if err == errTransferDropped {
+		return true, nil
+	}
+	return false, err
+}
+
+// delayDisposition waits for the delay the faultInjector asks for before the message is settled
+func (ns *Namespace) delayDisposition(ctx context.Context, msg *Message, outcome SettlementOutcome) error {
+	if ns == nil || ns.faults == nil {
+		return nil
+	}
+	if delay := ns.faults.disposition(ctx, msg, outcome); delay > 0 {
+		return ns.sleep(ctx, delay)
+	}
+	return nil
+}
+
+// receiveFault returns the error a receive from entityPath should fail with, or nil to receive as usual
+func (ns *Namespace) receiveFault(ctx context.Context, entityPath string) error {
+	if ns == nil || ns.faults == nil {
+		return nil
+	}
+	return ns.faults.receive(ctx, entityPath)
+}
@@ -0,0 +1,108 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+type (
+	// faultPlan is a faultInjector which fails transfers and receives with scripted errors, one per call, and delays
+	// every disposition by a fixed amount
+	faultPlan struct {
+		mu               sync.Mutex
+		transfers        []error
+		receives         []error
+		dispositionDelay time.Duration
+	}
+)
+
+func (fp *faultPlan) transfer(_ context.Context, _ string, _ *amqp.Message) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return nextFault(&fp.transfers)
+}
+
+func (fp *faultPlan) disposition(_ context.Context, _ *Message, _ SettlementOutcome) time.Duration {
+	return fp.dispositionDelay
+}
+
+func (fp *faultPlan) receive(_ context.Context, _ string) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return nextFault(&fp.receives)
+}
+
+func nextFault(errs *[]error) error {
+	if len(*errs) == 0 {
+		return nil
+	}
+	err := (*errs)[0]
+	*errs = (*errs)[1:]
+	return err
+}
+
+func TestFaults_DropAndFailTransfers(t *testing.T) {
+	rejected := errors.New("rejected")
+	plan := &faultPlan{transfers: []error{errTransferDropped, rejected}}
+	ns, err := NewNamespace(namespaceWithFaultInjector(plan))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s := &sender{namespace: ns, entityPath: "queue"}
+	ctx := context.Background()
+	assert.NoError(t, s.trySend(ctx, NewMessageFromString("lost")), "a dropped transfer looks sent to the sender")
+	assert.Equal(t, rejected, s.trySend(ctx, NewMessageFromString("failed")))
+	assert.Equal(t, rejected, s.stats.snapshot(s.entityPath, 0).LastError)
+
+	_, err = NewNamespace(namespaceWithFaultInjector(nil))
+	assert.Error(t, err)
+}
+
+func TestFaults_FailReceive(t *testing.T) {
+	busy := &amqp.DetachError{RemoteError: &amqp.Error{Condition: serverBusyCondition}}
+	ns, err := NewNamespace(namespaceWithFaultInjector(&faultPlan{receives: []error{busy}}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := &receiver{namespace: ns, entityPath: "queue"}
+	_, err = r.listenForMessage(context.Background())
+	assert.IsType(t, ErrServerBusy{}, err)
+}
+
+func TestFaults_DelayDisposition(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock), namespaceWithFaultInjector(&faultPlan{dispositionDelay: time.Minute}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := NewMessageFromString("payload")
+	msg.namespace = ns
+	settled := make(chan error, 1)
+	go func() {
+		settled <- msg.settle(context.Background(), OutcomeCompleted, func() error { return nil })
+	}()
+
+	clock.waitForCalls(1)
+	select {
+	case <-settled:
+		t.Fatal("the disposition should wait for the injected delay")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case err := <-settled:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the disposition was not sent after the delay")
+	}
+}
@@ -0,0 +1,178 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type (
+	// Targetable is an entity messages can be auto forwarded to, such as a Queue or Topic
+	Targetable interface {
+		TargetURI() string
+	}
+
+	// ErrForwardingLoop is returned by the managers instead of configuring auto forwarding which would pass messages
+	// around a loop of entities indefinitely
+	ErrForwardingLoop struct {
+		// Path lists the entities of the loop, starting and ending with the entity being configured
+		Path []string
+	}
+
+	// forwardEdge is an auto forwarding hop from an entity, via one of its subscriptions if the entity is a topic
+	forwardEdge struct {
+		via string
+		to  string
+	}
+
+	// forwardLookup returns the auto forwarding hops out of the named queue or topic
+	forwardLookup func(ctx context.Context, entityName string) ([]forwardEdge, error)
+)
+
+func (e ErrForwardingLoop) Error() string {
+	return "auto forwarding would create a loop: " + strings.Join(e.Path, " -> ")
+}
+
+// TargetURI returns the URI of the Queue, for use as an auto forwarding target
+func (q *Queue) TargetURI() string {
+	return q.namespace.getHTTPSHostURI() + q.Name
+}
+
+// TargetURI returns the URI of the Topic, for use as an auto forwarding target
+func (t *Topic) TargetURI() string {
+	return t.namespace.getHTTPSHostURI() + t.Name
+}
+
+// QueueEntityWithAutoForward configures the queue to automatically forward messages to the target. The QueueManager
+// returns an ErrForwardingLoop rather than creating the queue if the target forwards back to it.
+func QueueEntityWithAutoForward(target Targetable) QueueManagementOption {
+	return func(q *QueueDescription) error {
+		uri := target.TargetURI()
+		q.ForwardTo = &uri
+		return nil
+	}
+}
+
+// SubscriptionWithAutoForward configures the subscription to automatically forward messages to the target. The
+// SubscriptionManager returns an ErrForwardingLoop rather than creating the subscription if the target forwards back
+// to its topic.
+func SubscriptionWithAutoForward(target Targetable) SubscriptionManagementOption {
+	return func(s *SubscriptionDescription) error {
+		uri := target.TargetURI()
+		s.ForwardTo = &uri
+		return nil
+	}
+}
+
+// checkForwardingLoop returns an ErrForwardingLoop if forwarding from source, labeled as from in the error, to the
+// forwardTo URI would lead back to source
+func checkForwardingLoop(ctx context.Context, lookup forwardLookup, source, from, forwardTo string) error {
+	target := forwardTargetName(forwardTo)
+	visited := make(map[string]bool)
+
+	var visit func(entity string, path []string) ([]string, error)
+	visit = func(entity string, path []string) ([]string, error) {
+		if strings.EqualFold(entity, source) {
+			return path, nil
+		}
+
+		key := strings.ToLower(entity)
+		if visited[key] {
+			return nil, nil
+		}
+		visited[key] = true
+
+		edges, err := lookup(ctx, entity)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, edge := range edges {
+			next := append([]string{}, path...)
+			if edge.via != "" {
+				next = append(next, edge.via)
+			}
+			loop, err := visit(edge.to, append(next, edge.to))
+			if loop != nil || err != nil {
+				return loop, err
+			}
+		}
+		return nil, nil
+	}
+
+	loop, err := visit(target, []string{from, target})
+	if err != nil {
+		return fmt.Errorf("checking auto forwarding from %s to %s: %v", from, target, err)
+	}
+	if loop != nil {
+		return ErrForwardingLoop{Path: loop}
+	}
+	return nil
+}
+
+// forwards returns the auto forwarding hops out of the named queue or, via its subscriptions, topic
+func (em *entityManager) forwards(ctx context.Context, entityName string) ([]forwardEdge, error) {
+	qe, err := (&QueueManager{entityManager: em}).Get(ctx, entityName)
+	if err != nil {
+		return nil, err
+	}
+	if qe != nil {
+		if qe.ForwardTo == nil || *qe.ForwardTo == "" {
+			return nil, nil
+		}
+		return []forwardEdge{{to: forwardTargetName(*qe.ForwardTo)}}, nil
+	}
+
+	te, err := (&TopicManager{entityManager: em}).Get(ctx, entityName)
+	if err != nil || te == nil {
+		return nil, err
+	}
+
+	sm := &SubscriptionManager{entityManager: em, Topic: &Topic{entity: &entity{Name: entityName}}}
+	subs, err := sm.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var edges []forwardEdge
+	for _, sub := range subs {
+		if sub.ForwardTo != nil && *sub.ForwardTo != "" {
+			edges = append(edges, forwardEdge{
+				via: entityName + "/subscriptions/" + sub.Name,
+				to:  forwardTargetName(*sub.ForwardTo),
+			})
+		}
+	}
+	return edges, nil
+}
+
+// forwardTargetName returns the entity name of an auto forwarding target, which the service reports as a URI
+func forwardTargetName(forwardTo string) string {
+	if u, err := url.Parse(forwardTo); err == nil && u.Host != "" {
+		return strings.Trim(u.Path, "/")
+	}
+	return strings.Trim(forwardTo, "/")
+}
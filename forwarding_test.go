@@ -0,0 +1,149 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mapForwardLookup(graph map[string][]forwardEdge) forwardLookup {
+	return func(_ context.Context, entityName string) ([]forwardEdge, error) {
+		return graph[entityName], nil
+	}
+}
+
+func TestCheckForwardingLoop(t *testing.T) {
+	lookup := mapForwardLookup(map[string][]forwardEdge{
+		"orders":    {{to: "audit"}},
+		"audit":     {{via: "audit/subscriptions/all", to: "archive"}, {via: "audit/subscriptions/retry", to: "Intake"}},
+		"archive":   nil,
+		"unrelated": {{to: "archive"}},
+	})
+	ctx := context.Background()
+
+	err := checkForwardingLoop(ctx, lookup, "intake", "intake", "https://foo.servicebus.windows.net/orders")
+	assert.Equal(t, ErrForwardingLoop{Path: []string{"intake", "orders", "audit", "audit/subscriptions/retry", "Intake"}}, err)
+	assert.EqualError(t, err, "auto forwarding would create a loop: intake -> orders -> audit -> audit/subscriptions/retry -> Intake")
+
+	assert.NoError(t, checkForwardingLoop(ctx, lookup, "unrelated", "unrelated", "archive"))
+	assert.NoError(t, checkForwardingLoop(ctx, lookup, "new", "topic/subscriptions/new", "https://foo.servicebus.windows.net/orders"))
+
+	err = checkForwardingLoop(ctx, lookup, "self", "self", "self")
+	assert.Equal(t, ErrForwardingLoop{Path: []string{"self", "self"}}, err)
+}
+
+func TestCheckForwardingLoop_TerminatesOnExistingLoops(t *testing.T) {
+	lookup := mapForwardLookup(map[string][]forwardEdge{
+		"a": {{to: "b"}},
+		"b": {{to: "a"}},
+	})
+	assert.NoError(t, checkForwardingLoop(context.Background(), lookup, "c", "c", "a"))
+}
+
+func TestCheckForwardingLoop_LookupError(t *testing.T) {
+	lookup := func(context.Context, string) ([]forwardEdge, error) {
+		return nil, errors.New("unauthorized")
+	}
+	assert.EqualError(t, checkForwardingLoop(context.Background(), lookup, "a", "a", "b"), "checking auto forwarding from a to b: unauthorized")
+}
+
+func TestQueueEntityWithAutoForward(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	ns.Name = "foo"
+	target, err := ns.NewQueue("target")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	qd := new(QueueDescription)
+	assert.NoError(t, QueueEntityWithAutoForward(target)(qd))
+	assert.Equal(t, "https://foo.servicebus.windows.net/target", *qd.ForwardTo)
+
+	b, err := xml.Marshal(qd)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(b), "<ForwardTo>https://foo.servicebus.windows.net/target</ForwardTo>")
+	}
+	assert.Equal(t, "target", forwardTargetName(*qd.ForwardTo))
+}
+
+func TestAutoForward_MarshalsInSchemaOrder(t *testing.T) {
+	status := Active
+	forwardTo := "https://foo.servicebus.windows.net/target"
+	autoDelete := "PT1H"
+
+	b, err := xml.Marshal(&QueueDescription{
+		Status:           &status,
+		ForwardTo:        &forwardTo,
+		AutoDeleteOnIdle: &autoDelete,
+		EnableExpress:    ptrBool(false),
+		CountDetails:     &CountDetails{},
+	})
+	if assert.NoError(t, err) {
+		expected := []string{"Status", "ForwardTo", "CountDetails", "AutoDeleteOnIdle", "EnableExpress"}
+		assert.Equal(t, expected, childElements(t, b))
+	}
+
+	b, err = xml.Marshal(&SubscriptionDescription{
+		Status:           &status,
+		ForwardTo:        &forwardTo,
+		AutoDeleteOnIdle: &autoDelete,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Status", "ForwardTo", "AutoDeleteOnIdle"}, childElements(t, b))
+	}
+}
+
+// childElements lists the names of the elements directly inside the root of the document, in order
+func childElements(t *testing.T, doc []byte) []string {
+	var names []string
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	depth := 0
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return names
+		}
+		if !assert.NoError(t, err) {
+			return names
+		}
+		switch el := token.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				names = append(names, el.Name.Local)
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
@@ -1,18 +1,33 @@
 module github.com/Azure/azure-service-bus-go
 
+go 1.23
+
 require (
 	github.com/Azure/azure-amqp-common-go v1.1.2
 	github.com/Azure/azure-sdk-for-go v21.3.0+incompatible
 	github.com/Azure/go-autorest v11.1.1+incompatible
-	github.com/codahale/hdrhistogram v0.0.0-20161010025455-3a0bb77429bd // indirect
 	github.com/joho/godotenv v1.3.0
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/opentracing/opentracing-go v1.0.2
 	github.com/stretchr/testify v1.2.2
-	github.com/uber-go/atomic v1.3.2 // indirect
 	github.com/uber/jaeger-client-go v2.15.0+incompatible
-	github.com/uber/jaeger-lib v1.5.0 // indirect
 	go.opencensus.io v0.15.0
-	go.uber.org/atomic v1.3.2 // indirect
+	golang.org/x/net v0.0.0-20181023162649-9b4f9f5ad519
+	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
 	pack.ag/amqp v0.10.1
 )
+
+require (
+	github.com/codahale/hdrhistogram v0.0.0-20161010025455-3a0bb77429bd // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
+	github.com/fortytw2/leaktest v1.2.0 // indirect
+	github.com/google/go-cmp v0.7.0 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/uber-go/atomic v1.3.2 // indirect
+	github.com/uber/jaeger-lib v1.5.0 // indirect
+	go.uber.org/atomic v1.3.2 // indirect
+	golang.org/x/crypto v0.0.0-20181001203147-e3636079e1a4 // indirect
+)
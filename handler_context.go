@@ -0,0 +1,82 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+)
+
+type (
+	// deliveryMetadata describes where a message being handled came from
+	deliveryMetadata struct {
+		namespace  string
+		entityPath string
+		receiverID string
+		attempt    uint32
+	}
+
+	deliveryMetadataKey struct{}
+)
+
+// NamespaceFromContext returns the name of the namespace the message being handled was received from, if the context
+// was passed to a Handler by a receiver
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	md, ok := deliveryMetadataFromContext(ctx)
+	return md.namespace, ok
+}
+
+// EntityPathFromContext returns the path of the entity the message being handled was received from, such as
+// "myqueue" or "mytopic/Subscriptions/mysubscription", if the context was passed to a Handler by a receiver
+func EntityPathFromContext(ctx context.Context) (string, bool) {
+	md, ok := deliveryMetadataFromContext(ctx)
+	return md.entityPath, ok
+}
+
+// ReceiverIDFromContext returns the id of the receiver which received the message being handled, if the context was
+// passed to a Handler by a receiver. Each receiver, including each receiver locked to a session, has a unique id.
+func ReceiverIDFromContext(ctx context.Context) (string, bool) {
+	md, ok := deliveryMetadataFromContext(ctx)
+	return md.receiverID, ok
+}
+
+// DeliveryAttemptFromContext returns which delivery attempt of the message is being handled, starting from 1, if the
+// context was passed to a Handler by a receiver
+func DeliveryAttemptFromContext(ctx context.Context) (uint32, bool) {
+	md, ok := deliveryMetadataFromContext(ctx)
+	return md.attempt, ok
+}
+
+func deliveryMetadataFromContext(ctx context.Context) (deliveryMetadata, bool) {
+	md, ok := ctx.Value(deliveryMetadataKey{}).(deliveryMetadata)
+	return md, ok
+}
+
+// withDeliveryMetadata returns a copy of the context describing the delivery of msg by the receiver
+func (r *receiver) withDeliveryMetadata(ctx context.Context, msg *Message) context.Context {
+	return context.WithValue(ctx, deliveryMetadataKey{}, deliveryMetadata{
+		namespace:  r.namespace.Name,
+		entityPath: r.entityPath,
+		receiverID: r.Name,
+		attempt:    msg.DeliveryCount,
+	})
+}
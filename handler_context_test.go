@@ -0,0 +1,75 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestReceiver_HandlerContextCarriesDeliveryMetadata(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	ns.Name = "contoso"
+
+	r := &receiver{namespace: ns, entityPath: "orders/Subscriptions/audit", Name: "receiver-1", mode: ReceiveAndDeleteMode}
+	msg := &amqp.Message{
+		Data:       [][]byte{[]byte("hello")},
+		Header:     &amqp.MessageHeader{DeliveryCount: 2},
+		Properties: &amqp.MessageProperties{MessageID: "id"},
+	}
+
+	var handled bool
+	r.handleMessage(context.Background(), msg, HandlerFunc(func(ctx context.Context, _ *Message) DispositionAction {
+		handled = true
+		namespace, ok := NamespaceFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "contoso", namespace)
+
+		path, _ := EntityPathFromContext(ctx)
+		assert.Equal(t, "orders/Subscriptions/audit", path)
+
+		id, _ := ReceiverIDFromContext(ctx)
+		assert.Equal(t, "receiver-1", id)
+
+		attempt, _ := DeliveryAttemptFromContext(ctx)
+		assert.Equal(t, uint32(3), attempt)
+		return nil
+	}))
+	assert.True(t, handled)
+}
+
+func TestDeliveryMetadataFromContextWithoutReceiver(t *testing.T) {
+	_, ok := EntityPathFromContext(context.Background())
+	assert.False(t, ok)
+	_, ok = DeliveryAttemptFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestReceiver_SettlesAfterHandlerCancelsContext(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var outcomes []SettlementOutcome
+	r := &receiver{namespace: ns, mode: PeekLockMode}
+	r.settlementHook = func(_ context.Context, _ *Message, outcome SettlementOutcome) {
+		outcomes = append(outcomes, outcome)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		// the idiom of stopping the receiver from the handler and then completing the message
+		cancel()
+		return func(ctx context.Context) {
+			msg.settle(ctx, OutcomeCompleted, func() error { return nil })
+		}
+	})
+	r.handleMessage(ctx, amqp.NewMessage([]byte("hello")), handler)
+	assert.Equal(t, []SettlementOutcome{OutcomeCompleted}, outcomes)
+}
@@ -3,7 +3,9 @@ package servicebus
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-amqp-common-go/rpc"
@@ -23,16 +25,28 @@ type (
 		Cursor int
 	}
 
-	peekIterator struct {
+	// PeekIterator browses the messages of a Queue or Subscription in sequence order without locking them. Its Cursor
+	// can be saved and handed back through PeekFromCursor to resume browsing where it left off, even in another process.
+	PeekIterator struct {
 		entity             *entity
+		entityPath         string
 		connection         *amqp.Client
 		buffer             chan *Message
 		lastSequenceNumber int64
+		cursor             int64
+	}
+
+	// PeekCursor records how far a PeekIterator has browsed an entity
+	PeekCursor struct {
+		// EntityPath is the path of the Queue or Subscription being browsed
+		EntityPath string `json:"entityPath"`
+		// SequenceNumber is the sequence number of the last message returned by the PeekIterator
+		SequenceNumber int64 `json:"sequenceNumber"`
 	}
 
 	// PeekOption allows customization of parameters when querying a Service Bus entity for messages without committing
 	// to processing them.
-	PeekOption func(*peekIterator) error
+	PeekOption func(*PeekIterator) error
 )
 
 const (
@@ -62,15 +76,18 @@ func (ms *MessageSliceIterator) Next(_ context.Context) (*Message, error) {
 	return retval, nil
 }
 
-func newPeekIterator(entity *entity, connection *amqp.Client, options ...PeekOption) (*peekIterator, error) {
-	retval := &peekIterator{
+func newPeekIterator(entity *entity, entityPath string, connection *amqp.Client, options ...PeekOption) (*PeekIterator, error) {
+	retval := &PeekIterator{
 		entity:     entity,
+		entityPath: entityPath,
 		connection: connection,
 	}
 
 	foundPageSize := false
 	for i := range options {
-		options[i](retval)
+		if err := options[i](retval); err != nil {
+			return nil, err
+		}
 
 		if retval.buffer != nil {
 			foundPageSize = true
@@ -84,18 +101,19 @@ func newPeekIterator(entity *entity, connection *amqp.Client, options ...PeekOpt
 		}
 	}
 
+	retval.cursor = retval.lastSequenceNumber - 1
 	return retval, nil
 }
 
 // PeekWithPageSize adjusts how many messages are fetched at once while peeking from the server.
 func PeekWithPageSize(pageSize int) PeekOption {
-	return func(pi *peekIterator) error {
+	return func(pi *PeekIterator) error {
 		if pageSize < 0 {
 			return errors.New("page size must not be less than zero")
 		}
 
 		if pi.buffer != nil {
-			return errors.New("cannot modify an existing peekIterator's buffer")
+			return errors.New("cannot modify an existing PeekIterator's buffer")
 		}
 
 		pi.buffer = make(chan *Message, pageSize)
@@ -106,17 +124,32 @@ func PeekWithPageSize(pageSize int) PeekOption {
 // PeekFromSequenceNumber adds a filter to the Peek operation, so that no messages with a Sequence Number less than
 // 'seq' are returned.
 func PeekFromSequenceNumber(seq int64) PeekOption {
-	return func(pi *peekIterator) error {
+	return func(pi *PeekIterator) error {
 		pi.lastSequenceNumber = seq + 1
 		return nil
 	}
 }
 
-func (pi peekIterator) Done() bool {
+// PeekFromCursor resumes browsing after the last message returned by the PeekIterator the cursor was taken from. The
+// cursor must have been taken from an iterator over the same entity.
+func PeekFromCursor(cursor PeekCursor) PeekOption {
+	return func(pi *PeekIterator) error {
+		if cursor.EntityPath != "" && !strings.EqualFold(cursor.EntityPath, pi.entityPath) {
+			return fmt.Errorf("peek cursor for %q cannot be used to browse %q", cursor.EntityPath, pi.entityPath)
+		}
+		pi.lastSequenceNumber = cursor.SequenceNumber + 1
+		return nil
+	}
+}
+
+// Done always returns false, as more messages may arrive at any time
+func (pi PeekIterator) Done() bool {
 	return false
 }
 
-func (pi *peekIterator) Next(ctx context.Context) (*Message, error) {
+// Next returns the message following the last one returned, fetching a new page from the broker when the previous one
+// has been exhausted. ErrNoMessages is returned when there are currently no further messages.
+func (pi *PeekIterator) Next(ctx context.Context) (*Message, error) {
 	if len(pi.buffer) == 0 {
 		if err := pi.getNextPage(ctx); err != nil {
 			return nil, err
@@ -125,13 +158,25 @@ func (pi *peekIterator) Next(ctx context.Context) (*Message, error) {
 
 	select {
 	case next := <-pi.buffer:
+		if next.SystemProperties != nil && next.SystemProperties.SequenceNumber != nil {
+			pi.cursor = *next.SystemProperties.SequenceNumber
+		}
 		return next, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
-func (pi *peekIterator) getNextPage(ctx context.Context) error {
+// Cursor returns the position of the iterator, which can be persisted and later passed to PeekFromCursor to continue
+// browsing from the message following the last one returned by Next.
+func (pi *PeekIterator) Cursor() PeekCursor {
+	return PeekCursor{
+		EntityPath:     pi.entityPath,
+		SequenceNumber: pi.cursor,
+	}
+}
+
+func (pi *PeekIterator) getNextPage(ctx context.Context) error {
 	const messagesField, messageField = "messages", "message"
 
 	msg := &amqp.Message{
@@ -145,10 +190,10 @@ func (pi *peekIterator) getNextPage(ctx context.Context) error {
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
-		msg.ApplicationProperties["server-timeout"] = uint(time.Until(deadline) / time.Millisecond)
+		msg.ApplicationProperties["server-timeout"] = uint(pi.entity.namespace.until(deadline) / time.Millisecond)
 	}
 
-	link, err := rpc.NewLink(pi.connection, pi.entity.ManagementPath())
+	link, err := rpc.NewLink(pi.connection, pi.entityPath+"/$management")
 	if err != nil {
 		return err
 	}
@@ -170,6 +215,10 @@ func (pi *peekIterator) getNextPage(ctx context.Context) error {
 	if val, ok := rsp.Message.Value.(map[string]interface{}); ok {
 		if rawMessages, ok := val[messagesField]; ok {
 			if messages, ok := rawMessages.([]interface{}); ok {
+				if len(messages) == 0 {
+					return ErrNoMessages{}
+				}
+
 				transformedMessages := make([]*Message, len(messages))
 
 				for i := range messages {
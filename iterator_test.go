@@ -19,6 +19,7 @@ func (suite *serviceBusSuite) TestMessageIterator() {
 		"StartHalfway":  testMessageIteratorStartHalfway,
 		"LargePages":    testMessageIteratorLargePageSize,
 		"PeekOne":       testMessageIteratorPeekOne,
+		"ResumeCursor":  testMessageIteratorResumeFromCursor,
 	}
 
 	ns := suite.getNewSasInstance()
@@ -241,6 +242,61 @@ func testMessageIteratorPeekOne(ctx context.Context, t *testing.T, queue *Queue)
 	}
 }
 
+func testMessageIteratorResumeFromCursor(ctx context.Context, t *testing.T, queue *Queue) {
+	const numMessages = 10
+	for i := 0; i < numMessages; i++ {
+		require.NoError(t, queue.Send(ctx, NewMessage([]byte{byte(i)})))
+	}
+
+	first, err := queue.NewPeekIterator(ctx, PeekWithPageSize(3))
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err := first.Next(ctx)
+		require.NoError(t, err)
+	}
+
+	resumed, err := queue.NewPeekIterator(ctx, PeekFromCursor(first.Cursor()))
+	require.NoError(t, err)
+	for i := 4; i < numMessages; i++ {
+		msg, err := resumed.Next(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, i, int(msg.Data[0]))
+	}
+}
+
+func TestPeekIterator_Cursor(t *testing.T) {
+	it, err := newPeekIterator(&entity{Name: "orders"}, "orders", nil, PeekWithPageSize(2), PeekFromSequenceNumber(41))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, PeekCursor{EntityPath: "orders", SequenceNumber: 41}, it.Cursor())
+
+	for _, seq := range []int64{42, 43} {
+		seq := seq
+		it.buffer <- &Message{SystemProperties: &SystemProperties{SequenceNumber: &seq}}
+	}
+	for _, want := range []int64{42, 43} {
+		_, err := it.Next(context.Background())
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, it.Cursor().SequenceNumber)
+		}
+	}
+
+	resumed, err := newPeekIterator(&entity{Name: "orders"}, "orders", nil, PeekFromCursor(it.Cursor()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(44), resumed.lastSequenceNumber)
+		assert.Equal(t, it.Cursor(), resumed.Cursor())
+	}
+}
+
+func TestPeekFromCursor_RejectsOtherEntities(t *testing.T) {
+	_, err := newPeekIterator(&entity{Name: "audit"}, "orders/Subscriptions/audit", nil, PeekFromCursor(PeekCursor{EntityPath: "orders", SequenceNumber: 7}))
+	assert.Error(t, err)
+
+	_, err = newPeekIterator(&entity{Name: "audit"}, "orders/Subscriptions/audit", nil, PeekFromCursor(PeekCursor{SequenceNumber: 7}))
+	assert.NoError(t, err)
+}
+
 func logMessageMatches(t *testing.T, matches, total uint) {
 	if testing.Verbose() || t.Failed() {
 		t.Logf(
@@ -0,0 +1,631 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// jsonSchema is a compiled JSON Schema. It supports the validation keywords of draft 7 other than those listed in
+	// unsupportedJSONSchemaKeywords, which are rejected when the schema is compiled rather than silently ignored.
+	// References are resolved within the schema only.
+	jsonSchema struct {
+		// allow is set for the boolean schemas true and false
+		allow *bool
+		ref   *jsonSchema
+
+		types    []string
+		enum     []interface{}
+		constant interface{}
+		hasConst bool
+
+		properties           map[string]*jsonSchema
+		required             []string
+		additionalProperties *jsonSchema
+		minProperties        *int
+		maxProperties        *int
+
+		items       *jsonSchema
+		minItems    *int
+		maxItems    *int
+		uniqueItems bool
+
+		minimum          *big.Rat
+		maximum          *big.Rat
+		exclusiveMinimum *big.Rat
+		exclusiveMaximum *big.Rat
+		multipleOf       *big.Rat
+
+		minLength *int
+		maxLength *int
+		pattern   *regexp.Regexp
+
+		allOf []*jsonSchema
+		anyOf []*jsonSchema
+		oneOf []*jsonSchema
+		not   *jsonSchema
+	}
+
+	// jsonSchemaCompiler compiles a schema document, caching the compiled schema at each JSON pointer so references,
+	// including recursive ones, resolve to the same schema
+	jsonSchemaCompiler struct {
+		doc      interface{}
+		compiled map[string]*jsonSchema
+	}
+)
+
+// unsupportedJSONSchemaKeywords are validation keywords this package does not implement
+var unsupportedJSONSchemaKeywords = []string{
+	"additionalItems", "contains", "contentEncoding", "contentMediaType", "dependencies", "else", "if",
+	"patternProperties", "propertyNames", "then",
+}
+
+// compileJSONSchema parses and compiles the JSON Schema definition
+func compileJSONSchema(definition string) (*jsonSchema, error) {
+	doc, err := decodeJSON([]byte(definition))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &jsonSchemaCompiler{doc: doc, compiled: make(map[string]*jsonSchema)}
+	return c.compile(doc, "#")
+}
+
+// decodeJSON decodes data into generic values, keeping numbers as json.Number so they are compared exactly
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func (c *jsonSchemaCompiler) compile(node interface{}, pointer string) (*jsonSchema, error) {
+	if s, ok := c.compiled[pointer]; ok {
+		return s, nil
+	}
+
+	s := new(jsonSchema)
+	c.compiled[pointer] = s
+
+	switch n := node.(type) {
+	case bool:
+		s.allow = &n
+		return s, nil
+	case map[string]interface{}:
+		if err := c.compileKeywords(s, n, pointer); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", pointer)
+	}
+}
+
+func (c *jsonSchemaCompiler) compileKeywords(s *jsonSchema, n map[string]interface{}, pointer string) error {
+	for _, keyword := range unsupportedJSONSchemaKeywords {
+		if _, ok := n[keyword]; ok {
+			return fmt.Errorf("%s: the %q keyword is not supported", pointer, keyword)
+		}
+	}
+
+	if ref, ok := n["$ref"]; ok {
+		target, ok := ref.(string)
+		if !ok {
+			return fmt.Errorf("%s/$ref: expected a string", pointer)
+		}
+		resolved, err := c.resolve(target)
+		if err != nil {
+			return fmt.Errorf("%s/$ref: %v", pointer, err)
+		}
+		// other keywords alongside $ref are ignored, as draft 7 specifies
+		s.ref = resolved
+		return nil
+	}
+
+	var err error
+	if s.types, err = schemaTypes(n["type"], pointer); err != nil {
+		return err
+	}
+	if enum, ok := n["enum"]; ok {
+		if s.enum, ok = enum.([]interface{}); !ok {
+			return fmt.Errorf("%s/enum: expected an array", pointer)
+		}
+	}
+	s.constant, s.hasConst = n["const"]
+
+	if props, ok := n["properties"]; ok {
+		m, ok := props.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s/properties: expected an object", pointer)
+		}
+		s.properties = make(map[string]*jsonSchema, len(m))
+		for name, prop := range m {
+			if s.properties[name], err = c.compile(prop, pointer+"/properties/"+escapePointer(name)); err != nil {
+				return err
+			}
+		}
+	}
+	if required, ok := n["required"]; ok {
+		names, ok := required.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s/required: expected an array", pointer)
+		}
+		for _, name := range names {
+			str, ok := name.(string)
+			if !ok {
+				return fmt.Errorf("%s/required: expected property names", pointer)
+			}
+			s.required = append(s.required, str)
+		}
+	}
+	if s.additionalProperties, err = c.optional(n, "additionalProperties", pointer); err != nil {
+		return err
+	}
+	if items, ok := n["items"]; ok {
+		if _, tuple := items.([]interface{}); tuple {
+			return fmt.Errorf("%s/items: arrays of item schemas are not supported", pointer)
+		}
+		if s.items, err = c.compile(items, pointer+"/items"); err != nil {
+			return err
+		}
+	}
+	if s.not, err = c.optional(n, "not", pointer); err != nil {
+		return err
+	}
+	for keyword, dst := range map[string]*[]*jsonSchema{"allOf": &s.allOf, "anyOf": &s.anyOf, "oneOf": &s.oneOf} {
+		if *dst, err = c.compileAll(n, keyword, pointer); err != nil {
+			return err
+		}
+	}
+
+	for keyword, dst := range map[string]**int{
+		"minProperties": &s.minProperties, "maxProperties": &s.maxProperties,
+		"minItems": &s.minItems, "maxItems": &s.maxItems,
+		"minLength": &s.minLength, "maxLength": &s.maxLength,
+	} {
+		if *dst, err = schemaCount(n, keyword, pointer); err != nil {
+			return err
+		}
+	}
+	for keyword, dst := range map[string]**big.Rat{
+		"minimum": &s.minimum, "maximum": &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum, "exclusiveMaximum": &s.exclusiveMaximum,
+		"multipleOf": &s.multipleOf,
+	} {
+		if *dst, err = schemaNumber(n, keyword, pointer); err != nil {
+			return err
+		}
+	}
+	if s.multipleOf != nil && s.multipleOf.Sign() <= 0 {
+		return fmt.Errorf("%s/multipleOf: must be greater than 0", pointer)
+	}
+
+	if unique, ok := n["uniqueItems"]; ok {
+		if s.uniqueItems, ok = unique.(bool); !ok {
+			return fmt.Errorf("%s/uniqueItems: expected a boolean", pointer)
+		}
+	}
+	if pattern, ok := n["pattern"]; ok {
+		str, ok := pattern.(string)
+		if !ok {
+			return fmt.Errorf("%s/pattern: expected a string", pointer)
+		}
+		if s.pattern, err = regexp.Compile(str); err != nil {
+			return fmt.Errorf("%s/pattern: %v", pointer, err)
+		}
+	}
+	return nil
+}
+
+// optional compiles the schema under the keyword, if there is one
+func (c *jsonSchemaCompiler) optional(n map[string]interface{}, keyword, pointer string) (*jsonSchema, error) {
+	node, ok := n[keyword]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(node, pointer+"/"+keyword)
+}
+
+// compileAll compiles the array of schemas under the keyword, if there is one
+func (c *jsonSchemaCompiler) compileAll(n map[string]interface{}, keyword, pointer string) ([]*jsonSchema, error) {
+	node, ok := n[keyword]
+	if !ok {
+		return nil, nil
+	}
+	nodes, ok := node.([]interface{})
+	if !ok || len(nodes) == 0 {
+		return nil, fmt.Errorf("%s/%s: expected a non-empty array", pointer, keyword)
+	}
+
+	schemas := make([]*jsonSchema, len(nodes))
+	for i, node := range nodes {
+		var err error
+		if schemas[i], err = c.compile(node, fmt.Sprintf("%s/%s/%d", pointer, keyword, i)); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// resolve compiles the schema a reference points to. Only references within the schema, such as
+// "#/definitions/address", are supported.
+func (c *jsonSchemaCompiler) resolve(ref string) (*jsonSchema, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only references within the schema are supported, not %q", ref)
+	}
+
+	node := c.doc
+	if ref != "#" {
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			switch n := node.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if node, ok = n[token]; !ok {
+					return nil, fmt.Errorf("%q does not exist", ref)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(n) {
+					return nil, fmt.Errorf("%q does not exist", ref)
+				}
+				node = n[i]
+			default:
+				return nil, fmt.Errorf("%q does not exist", ref)
+			}
+		}
+	}
+	return c.compile(node, ref)
+}
+
+func schemaTypes(node interface{}, pointer string) ([]string, error) {
+	var names []interface{}
+	switch t := node.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = []interface{}{t}
+	case []interface{}:
+		names = t
+	default:
+		return nil, fmt.Errorf("%s/type: expected a string or an array", pointer)
+	}
+
+	types := make([]string, len(names))
+	for i, name := range names {
+		str, _ := name.(string)
+		switch str {
+		case "array", "boolean", "integer", "null", "number", "object", "string":
+			types[i] = str
+		default:
+			return nil, fmt.Errorf("%s/type: %v is not a type", pointer, name)
+		}
+	}
+	return types, nil
+}
+
+func schemaCount(n map[string]interface{}, keyword, pointer string) (*int, error) {
+	node, ok := n[keyword]
+	if !ok {
+		return nil, nil
+	}
+	num, ok := node.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: expected a non-negative integer", pointer, keyword)
+	}
+	count, err := strconv.Atoi(num.String())
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("%s/%s: expected a non-negative integer", pointer, keyword)
+	}
+	return &count, nil
+}
+
+func schemaNumber(n map[string]interface{}, keyword, pointer string) (*big.Rat, error) {
+	node, ok := n[keyword]
+	if !ok {
+		return nil, nil
+	}
+	num, ok := node.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: expected a number", pointer, keyword)
+	}
+	r, ok := new(big.Rat).SetString(num.String())
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: expected a number", pointer, keyword)
+	}
+	return r, nil
+}
+
+// validate checks the decoded JSON value against the schema, returning an error which locates the first violation by
+// its JSON pointer
+func (s *jsonSchema) validate(v interface{}, pointer string) error {
+	if s.allow != nil {
+		if !*s.allow {
+			return fmt.Errorf("%s: no value is allowed", pointer)
+		}
+		return nil
+	}
+	if s.ref != nil {
+		return s.ref.validate(v, pointer)
+	}
+
+	if len(s.types) > 0 && !hasJSONType(v, s.types) {
+		return fmt.Errorf("%s: expected %s, but got %s", pointer, strings.Join(s.types, " or "), jsonTypeOf(v))
+	}
+	if s.enum != nil && !containsJSON(s.enum, v) {
+		return fmt.Errorf("%s: value is not one of the enumerated values", pointer)
+	}
+	if s.hasConst && !equalJSON(s.constant, v) {
+		return fmt.Errorf("%s: value does not equal the constant", pointer)
+	}
+
+	var err error
+	switch t := v.(type) {
+	case map[string]interface{}:
+		err = s.validateObject(t, pointer)
+	case []interface{}:
+		err = s.validateArray(t, pointer)
+	case string:
+		err = s.validateString(t, pointer)
+	case json.Number:
+		err = s.validateNumber(t, pointer)
+	}
+	if err != nil {
+		return err
+	}
+	return s.validateCombinations(v, pointer)
+}
+
+func (s *jsonSchema) validateObject(obj map[string]interface{}, pointer string) error {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: property %q is required", pointer, name)
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		return fmt.Errorf("%s: expected at least %d properties", pointer, *s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		return fmt.Errorf("%s: expected at most %d properties", pointer, *s.maxProperties)
+	}
+
+	// properties are checked in order so the same violation is reported each time
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop := s.properties[name]
+		if prop == nil {
+			prop = s.additionalProperties
+		}
+		if prop == nil {
+			continue
+		}
+		if err := prop.validate(obj[name], pointer+"/"+escapePointer(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateArray(arr []interface{}, pointer string) error {
+	if s.minItems != nil && len(arr) < *s.minItems {
+		return fmt.Errorf("%s: expected at least %d items", pointer, *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		return fmt.Errorf("%s: expected at most %d items", pointer, *s.maxItems)
+	}
+	if s.uniqueItems {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equalJSON(arr[i], arr[j]) {
+					return fmt.Errorf("%s: items %d and %d are equal", pointer, i, j)
+				}
+			}
+		}
+	}
+	if s.items != nil {
+		for i, item := range arr {
+			if err := s.items.validate(item, fmt.Sprintf("%s/%d", pointer, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateString(str, pointer string) error {
+	length := utf8.RuneCountInString(str)
+	if s.minLength != nil && length < *s.minLength {
+		return fmt.Errorf("%s: expected at least %d characters", pointer, *s.minLength)
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		return fmt.Errorf("%s: expected at most %d characters", pointer, *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		return fmt.Errorf("%s: does not match the pattern %q", pointer, s.pattern)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateNumber(num json.Number, pointer string) error {
+	r, ok := new(big.Rat).SetString(num.String())
+	if !ok {
+		return fmt.Errorf("%s: %s is not a number", pointer, num)
+	}
+
+	switch {
+	case s.minimum != nil && r.Cmp(s.minimum) < 0:
+		return fmt.Errorf("%s: must be at least %s", pointer, s.minimum.RatString())
+	case s.maximum != nil && r.Cmp(s.maximum) > 0:
+		return fmt.Errorf("%s: must be at most %s", pointer, s.maximum.RatString())
+	case s.exclusiveMinimum != nil && r.Cmp(s.exclusiveMinimum) <= 0:
+		return fmt.Errorf("%s: must be greater than %s", pointer, s.exclusiveMinimum.RatString())
+	case s.exclusiveMaximum != nil && r.Cmp(s.exclusiveMaximum) >= 0:
+		return fmt.Errorf("%s: must be less than %s", pointer, s.exclusiveMaximum.RatString())
+	case s.multipleOf != nil && !new(big.Rat).Quo(r, s.multipleOf).IsInt():
+		return fmt.Errorf("%s: must be a multiple of %s", pointer, s.multipleOf.RatString())
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateCombinations(v interface{}, pointer string) error {
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, pointer); err != nil {
+			return err
+		}
+	}
+
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.validate(v, pointer) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: does not match any of the schemas in anyOf", pointer)
+		}
+	}
+
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, pointer) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: matches %d of the schemas in oneOf rather than exactly one", pointer, matches)
+		}
+	}
+
+	if s.not != nil && s.not.validate(v, pointer) == nil {
+		return fmt.Errorf("%s: matches the schema it must not", pointer)
+	}
+	return nil
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if r, ok := new(big.Rat).SetString(t.String()); ok && r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func hasJSONType(v interface{}, types []string) bool {
+	actual := jsonTypeOf(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsJSON(values []interface{}, v interface{}) bool {
+	for _, candidate := range values {
+		if equalJSON(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares decoded JSON values, treating numbers of equal value, such as 1 and 1.0, as equal
+func equalJSON(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		rx, okx := new(big.Rat).SetString(x.String())
+		ry, oky := new(big.Rat).SetString(y.String())
+		return okx && oky && rx.Cmp(ry) == 0
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, ok := y[k]
+			if !ok || !equalJSON(xv, yv) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
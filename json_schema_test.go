@@ -0,0 +1,102 @@
+package servicebus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema_Validate(t *testing.T) {
+	const address = `{
+		"definitions": {
+			"address": {
+				"type": "object",
+				"required": ["city"],
+				"properties": {"city": {"type": "string", "minLength": 1}},
+				"additionalProperties": false
+			}
+		},
+		"type": "object",
+		"required": ["id", "lines"],
+		"properties": {
+			"id": {"type": "string", "pattern": "^[a-z]+-[0-9]+$"},
+			"status": {"enum": ["open", "shipped"]},
+			"ship_to": {"$ref": "#/definitions/address"},
+			"lines": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"required": ["sku", "quantity"],
+					"properties": {
+						"sku": {"type": "string"},
+						"quantity": {"type": "integer", "exclusiveMinimum": 0, "multipleOf": 2}
+					}
+				}
+			},
+			"discount": {"anyOf": [{"type": "null"}, {"type": "number", "maximum": 0.5}]}
+		}
+	}`
+
+	schema, err := compileJSONSchema(address)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := []struct {
+		name, doc, err string
+	}{
+		{name: "valid", doc: `{"id":"order-1","status":"open","ship_to":{"city":"Oslo"},"lines":[{"sku":"a","quantity":2}],"discount":0.25}`},
+		{name: "integer written as a decimal", doc: `{"id":"order-1","lines":[{"sku":"a","quantity":4.0}]}`},
+		{name: "missing required", doc: `{"id":"order-1"}`, err: `#: property "lines" is required`},
+		{name: "nested required", doc: `{"id":"order-1","lines":[{"sku":"a"}]}`, err: `#/lines/0: property "quantity" is required`},
+		{name: "wrong nested type", doc: `{"id":"order-1","lines":[{"sku":"a","quantity":"2"}]}`, err: `#/lines/0/quantity: expected integer, but got string`},
+		{name: "not a multiple", doc: `{"id":"order-1","lines":[{"sku":"a","quantity":3}]}`, err: `#/lines/0/quantity: must be a multiple of 2`},
+		{name: "exclusive minimum", doc: `{"id":"order-1","lines":[{"sku":"a","quantity":0}]}`, err: `#/lines/0/quantity: must be greater than 0`},
+		{name: "too few items", doc: `{"id":"order-1","lines":[]}`, err: `#/lines: expected at least 1 items`},
+		{name: "pattern", doc: `{"id":"ORDER","lines":[{"sku":"a","quantity":2}]}`, err: `#/id: does not match the pattern "^[a-z]+-[0-9]+$"`},
+		{name: "enum", doc: `{"id":"order-1","status":"lost","lines":[{"sku":"a","quantity":2}]}`, err: `#/status: value is not one of the enumerated values`},
+		{name: "reference", doc: `{"id":"order-1","ship_to":{"city":""},"lines":[{"sku":"a","quantity":2}]}`, err: `#/ship_to/city: expected at least 1 characters`},
+		{name: "additional property", doc: `{"id":"order-1","ship_to":{"city":"Oslo","zip":1},"lines":[{"sku":"a","quantity":2}]}`, err: `#/ship_to/zip: no value is allowed`},
+		{name: "any of", doc: `{"id":"order-1","lines":[{"sku":"a","quantity":2}],"discount":0.75}`, err: `#/discount: does not match any of the schemas in anyOf`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			doc, err := decodeJSON([]byte(c.doc))
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = schema.validate(doc, "#")
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, c.err)
+			}
+		})
+	}
+}
+
+func TestJSONSchema_RecursiveReferences(t *testing.T) {
+	schema, err := compileJSONSchema(`{
+		"type": "object",
+		"properties": {"name": {"type": "string"}, "children": {"type": "array", "items": {"$ref": "#"}}}
+	}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	doc, _ := decodeJSON([]byte(`{"name":"root","children":[{"name":"leaf","children":[{"name":1}]}]}`))
+	assert.EqualError(t, schema.validate(doc, "#"), "#/children/0/children/0/name: expected string, but got integer")
+}
+
+func TestJSONSchema_RejectsUnsupportedKeywords(t *testing.T) {
+	_, err := compileJSONSchema(`{"if":{"type":"string"},"then":{"minLength":1}}`)
+	assert.EqualError(t, err, `#: the "if" keyword is not supported`)
+
+	_, err = compileJSONSchema(`{"properties":{"a":{"$ref":"https://example.com/a.json"}}}`)
+	assert.Error(t, err)
+
+	_, err = compileJSONSchema(`{"type":"text"}`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// SendTimestampProperty is the user property carrying the time a message was sent, as measured by the sender's
+	// clock. It is stamped on every message sent by a namespace configured with NamespaceWithSendTimestamps.
+	SendTimestampProperty = "client-send-time"
+)
+
+type (
+	// LatencyHook is called as each received message carrying a send timestamp is handed to its handler, with the
+	// time the message took to reach the broker and the time it took from being sent to being received. It allows
+	// end-to-end latency to be recorded in a metrics system. The latencies compare the clocks of the sender, the broker
+	// and the receiver, so they are only as accurate as those clocks are synchronized.
+	LatencyHook func(ctx context.Context, msg *Message, broker, endToEnd time.Duration)
+)
+
+// NamespaceWithSendTimestamps configures a namespace to stamp every message it sends with the SendTimestampProperty,
+// allowing receivers to measure BrokerLatency and E2ELatency
+func NamespaceWithSendTimestamps() NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.stampSendTime = true
+		return nil
+	}
+}
+
+// NamespaceWithLatencyHook configures a namespace to call the hook for each received message which carries a send
+// timestamp
+func NamespaceWithLatencyHook(hook LatencyHook) NamespaceOption {
+	return func(ns *Namespace) error {
+		if hook == nil {
+			return errors.New("latency hook must not be nil")
+		}
+		ns.latencyHook = hook
+		return nil
+	}
+}
+
+// SendTime returns the time the message was sent, if the sender stamped it with the SendTimestampProperty
+func (m *Message) SendTime() (time.Time, bool) {
+	return m.TimeProperty(SendTimestampProperty)
+}
+
+// BrokerLatency returns how long the message took from being sent to being enqueued by the broker. It is only
+// available for received messages carrying a send timestamp.
+func (m *Message) BrokerLatency() (time.Duration, bool) {
+	sent, ok := m.SendTime()
+	if !ok || m.SystemProperties == nil || m.SystemProperties.EnqueuedTime == nil {
+		return 0, false
+	}
+	return m.SystemProperties.EnqueuedTime.Sub(sent), true
+}
+
+// E2ELatency returns how long the message took from being sent to being received. It is only available for received
+// messages carrying a send timestamp.
+func (m *Message) E2ELatency() (time.Duration, bool) {
+	sent, ok := m.SendTime()
+	if !ok || m.receivedAt.IsZero() {
+		return 0, false
+	}
+	return m.receivedAt.Sub(sent), true
+}
+
+// stampSendTimeOn stamps the message with the time it is being sent, if the namespace is configured to
+func (ns *Namespace) stampSendTimeOn(msg *Message) {
+	if ns == nil || !ns.stampSendTime {
+		return
+	}
+	msg.SetTime(SendTimestampProperty, ns.getClock().Now())
+}
+
+// observeLatency records the time the message was received and reports its latency to the namespace's LatencyHook
+func (ns *Namespace) observeLatency(ctx context.Context, msg *Message) {
+	msg.receivedAt = msg.getClock().Now()
+	if ns == nil || ns.latencyHook == nil {
+		return
+	}
+
+	endToEnd, ok := msg.E2ELatency()
+	if !ok {
+		return
+	}
+	broker, _ := msg.BrokerLatency()
+	ns.latencyHook(ctx, msg, broker, endToEnd)
+}
@@ -0,0 +1,87 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSender_StampsSendTime(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	ns, err := NewNamespace(NamespaceWithClock(newFakeClock(now)), NamespaceWithSendTimestamps())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	group := "group"
+	msg := NewMessageFromString("payload")
+	msg.GroupID = &group
+	s := &sender{namespace: ns, entityPath: "queue"}
+	if assert.NoError(t, s.prepare(context.Background(), noopSpan, msg)) {
+		sent, ok := msg.SendTime()
+		assert.True(t, ok)
+		assert.Equal(t, now, sent)
+	}
+
+	unstamped, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg = NewMessageFromString("payload")
+	msg.GroupID = &group
+	s = &sender{namespace: unstamped, entityPath: "queue"}
+	if assert.NoError(t, s.prepare(context.Background(), noopSpan, msg)) {
+		_, ok := msg.SendTime()
+		assert.False(t, ok, "send timestamps are opt-in")
+	}
+}
+
+func TestNamespace_ObserveLatency(t *testing.T) {
+	sent := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	enqueued := sent.Add(20 * time.Millisecond)
+
+	var broker, endToEnd time.Duration
+	ns, err := NewNamespace(NamespaceWithClock(newFakeClock(sent.Add(time.Second))),
+		NamespaceWithLatencyHook(func(_ context.Context, _ *Message, b, e time.Duration) {
+			broker, endToEnd = b, e
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := NewMessageFromString("payload")
+	msg.namespace = ns
+	msg.SetTime(SendTimestampProperty, sent)
+	msg.SystemProperties = &SystemProperties{EnqueuedTime: &enqueued}
+	ns.observeLatency(context.Background(), msg)
+
+	assert.Equal(t, 20*time.Millisecond, broker)
+	assert.Equal(t, time.Second, endToEnd)
+	latency, ok := msg.E2ELatency()
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, latency)
+
+	plain := NewMessageFromString("no timestamp")
+	_, ok = plain.BrokerLatency()
+	assert.False(t, ok)
+	_, ok = plain.E2ELatency()
+	assert.False(t, ok)
+
+	_, err = NewNamespace(NamespaceWithLatencyHook(nil))
+	assert.Error(t, err)
+}
+
+func TestMessage_ForeachKeySkipsNonStringProperties(t *testing.T) {
+	msg := NewMessageFromString("payload")
+	msg.Set("trace", "id")
+	msg.SetTime(SendTimestampProperty, time.Now())
+
+	keys := map[string]string{}
+	assert.NoError(t, msg.ForeachKey(func(key, val string) error {
+		keys[key] = val
+		return nil
+	}))
+	assert.Equal(t, map[string]string{"trace": "id"}, keys)
+}
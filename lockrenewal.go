@@ -14,7 +14,7 @@ import (
 //RenewLocks renews the locks on messages provided
 func (e *entity) RenewLocks(ctx context.Context, messages []*Message) error {
 	span, ctx := e.startSpanFromContext(ctx, "sb.entity.renewLocks")
-	defer span.Finish()
+	defer span.End()
 
 	lockTokens := make([]amqp.UUID, 0, len(messages))
 	for _, m := range messages {
@@ -49,6 +49,8 @@ func (e *entity) RenewLocks(ctx context.Context, messages []*Message) error {
 	if err != nil {
 		return err
 	}
+	defer e.namespace.closeConnection(conn)
+
 	err = e.namespace.negotiateClaim(ctx, conn, entityManagementAddress)
 	if err != nil {
 		log.For(ctx).Error(err)
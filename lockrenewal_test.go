@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-amqp-common-go/uuid"
 	"github.com/Azure/azure-service-bus-go/internal/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -114,3 +116,83 @@ func testQueueSendAndReceiveWithRenewLock(ctx context.Context, t *testing.T, que
 		assert.Equal(t, expected[k], v)
 	}
 }
+
+func TestReceiver_KeepLockAlive(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var mu sync.Mutex
+	renewals := 0
+	r := &receiver{namespace: ns, mode: PeekLockMode}
+	assert.NoError(t, receiverWithAutoLockRenewal(3*time.Minute, func(_ context.Context, messages []*Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		renewals += len(messages)
+		return nil
+	})(r))
+
+	token, err := uuid.NewV4()
+	if !assert.NoError(t, err) {
+		return
+	}
+	lockedUntil := start.Add(time.Minute)
+	msg := NewMessageFromString("slow")
+	msg.LockToken = &token
+	msg.SystemProperties = &SystemProperties{LockedUntil: &lockedUntil}
+
+	stop := r.keepLockAlive(context.Background(), msg)
+	for i := 1; i <= 7; i++ {
+		clock.waitForCalls(i)
+		clock.Advance(30 * time.Second)
+	}
+	stop()
+
+	// renewals every 30 seconds stop once 3 minutes have passed since the message was received
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 6, renewals)
+}
+
+func TestReceiver_KeepLockAliveSkipsUnlockedMessages(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithClock(newFakeClock(time.Now())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	renew := func(context.Context, []*Message) error {
+		t.Error("no lock should have been renewed")
+		return nil
+	}
+	token, err := uuid.NewV4()
+	if !assert.NoError(t, err) {
+		return
+	}
+	locked := NewMessageFromString("locked")
+	locked.LockToken = &token
+
+	r := &receiver{namespace: ns, mode: ReceiveAndDeleteMode, lockRenewal: time.Minute, renewLocks: renew}
+	r.keepLockAlive(context.Background(), locked)()
+
+	r = &receiver{namespace: ns, mode: PeekLockMode, useSessions: true, lockRenewal: time.Minute, renewLocks: renew}
+	r.keepLockAlive(context.Background(), locked)()
+
+	r = &receiver{namespace: ns, mode: PeekLockMode, lockRenewal: time.Minute, renewLocks: renew}
+	r.keepLockAlive(context.Background(), NewMessageFromString("unlocked"))()
+}
+
+func TestLockRenewalInterval(t *testing.T) {
+	now := time.Now()
+	msg := NewMessageFromString("foo")
+	assert.Equal(t, 30*time.Second, lockRenewalInterval(now, msg))
+
+	until := now.Add(2 * time.Minute)
+	msg.SystemProperties = &SystemProperties{LockedUntil: &until}
+	assert.Equal(t, time.Minute, lockRenewalInterval(now, msg))
+
+	until = now.Add(time.Second)
+	assert.Equal(t, time.Second, lockRenewalInterval(now, msg))
+}
@@ -24,13 +24,14 @@ package servicebus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"time"
 
+	"github.com/Azure/azure-amqp-common-go/log"
 	"github.com/Azure/azure-amqp-common-go/uuid"
-	"github.com/mitchellh/mapstructure"
 	"pack.ag/amqp"
 )
 
@@ -52,12 +53,44 @@ type (
 		LockToken        *uuid.UUID
 		SystemProperties *SystemProperties
 		UserProperties   map[string]interface{}
-		message          *amqp.Message
-	}
-
-	// DispositionAction represents the action to notify Azure Service Bus of the Message's disposition
+		// Value is the body of a message sent as an AMQP value rather than as Data, such as the map of a JMS
+		// MapMessage or a list. A message has either Data or a Value, not both. Received maps are decoded with
+		// interface{} keys; see ValueMap. Bodies of AMQP sequence sections are not supported, so send a list as the
+		// Value instead.
+		Value interface{}
+		// DeliveryAnnotations are delivery-specific, non-standard properties conveyed from the sending peer to the
+		// receiving peer. They are optional and preserved when a received message is sent again.
+		DeliveryAnnotations map[string]interface{}
+		// Footer carries details which can only be calculated once the whole message has been constructed, such as
+		// hashes or signatures. It is optional and preserved when a received message is sent again.
+		Footer         map[string]interface{}
+		message        *amqp.Message
+		settlementHook SettlementHook
+		codecs         *CodecRegistry
+		receiveMode    ReceiveMode
+		namespace      *Namespace
+		receivedAt     time.Time
+		settledAs      SettlementOutcome
+		settleErr      error
+		bySequence     *sequenceReceiver
+		reassembled    bool
+	}
+
+	// DispositionAction represents the action to notify Azure Service Bus of the Message's disposition. It gives up
+	// once the context is done; Message.Settle runs it and reports whether the broker acknowledged the disposition.
+	// The receiver runs the action a Handler returns even if the handler cancelled the receive context, waiting up to
+	// DefaultDispositionTimeout.
 	DispositionAction func(ctx context.Context)
 
+	// SettlementOutcome describes the disposition the broker acknowledged for a received message
+	SettlementOutcome string
+
+	// SettlementHook is called after the broker has acknowledged the settlement of a received message. Hooks allow
+	// at-least-once pipelines to commit offsets or side effects only once the disposition is durable, rather than as
+	// soon as a Handler returns. Hooks are not called for messages received in ReceiveAndDelete mode, nor when the
+	// disposition fails.
+	SettlementHook func(ctx context.Context, msg *Message, outcome SettlementOutcome)
+
 	// MessageErrorCondition represents a well-known collection of AMQP errors
 	MessageErrorCondition string
 
@@ -72,6 +105,9 @@ type (
 		ScheduledEnqueueTime   *time.Time `mapstructure:"x-opt-scheduled-enqueue-time"`
 		EnqueuedSequenceNumber *int64     `mapstructure:"x-opt-enqueue-sequence-number"`
 		ViaPartitionKey        *string    `mapstructure:"x-opt-via-partition-key"`
+		// State is set on peeked messages: 0 when the message is active, 1 when it is deferred and 2 when it is
+		// scheduled
+		State *int32 `mapstructure:"x-opt-message-state"`
 	}
 
 	mapStructureTag struct {
@@ -96,10 +132,35 @@ const (
 	ErrorIllegalState          MessageErrorCondition = "amqp:illegal-state"
 )
 
+// Settlement Outcomes
+const (
+	// OutcomeCompleted indicates the message was completed and removed from the entity
+	OutcomeCompleted SettlementOutcome = "completed"
+	// OutcomeAbandoned indicates the message was abandoned and will be redelivered
+	OutcomeAbandoned SettlementOutcome = "abandoned"
+	// OutcomeDeadLettered indicates the message was moved to the dead letter queue
+	OutcomeDeadLettered SettlementOutcome = "deadlettered"
+	// OutcomeReleased indicates the message was handed back unprocessed, without a failure, and will be redelivered
+	OutcomeReleased SettlementOutcome = "released"
+	// OutcomeDeferred indicates the message was deferred and will only be delivered again when it is received by its
+	// sequence number
+	OutcomeDeferred SettlementOutcome = "deferred"
+)
+
+// ErrNotDeferrable is the error of deferring a message reassembled from chunks, which cannot be deferred
+var ErrNotDeferrable = errors.New("servicebus: a message reassembled from chunks cannot be deferred")
+
 const (
 	lockTokenName = "x-opt-lock-token"
+
+	// abandonLockMargin is how long before its lock expires AbandonWithBackoff abandons a message at the latest
+	abandonLockMargin = 2 * time.Second
 )
 
+// DefaultDispositionTimeout is how long a DispositionAction waits for the broker to acknowledge the disposition when
+// the context it is given has no deadline
+const DefaultDispositionTimeout = time.Minute
+
 // NewMessageFromString builds an Message from a string message
 func NewMessageFromString(message string) *Message {
 	return NewMessage([]byte(message))
@@ -112,59 +173,202 @@ func NewMessage(data []byte) *Message {
 	}
 }
 
+// NewMessageFromAMQPValue builds a Message whose body is the AMQP value rather than Data, for consumers which expect
+// structured bodies such as the map of a JMS MapMessage. The value may be a map, a slice or any primitive type AMQP
+// can encode.
+func NewMessageFromAMQPValue(value interface{}) *Message {
+	return &Message{
+		Value: value,
+	}
+}
+
+// ValueMap returns the Value of the message as a map with string keys, as sent by a JMS MapMessage
+func (m *Message) ValueMap() (map[string]interface{}, error) {
+	switch value := m.Value.(type) {
+	case map[string]interface{}:
+		return value, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, val := range value {
+			str, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("message value has a key of type %T, not string", key)
+			}
+			result[str] = val
+		}
+		return result, nil
+	default:
+		return nil, newErrIncorrectType("Value", map[string]interface{}{}, m.Value)
+	}
+}
+
 // Complete will notify Azure Service Bus that the message was successfully handled and should be deleted from the queue
 func (m *Message) Complete() DispositionAction {
 	return func(ctx context.Context) {
-		span, _ := m.startSpanFromContext(ctx, "sb.Message.Complete")
-		defer span.Finish()
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.Complete")
+		defer span.End()
 
-		m.message.Accept()
+		m.settle(ctx, OutcomeCompleted, func() error {
+			return m.accept(ctx)
+		})
 	}
 }
 
 // Abandon will notify Azure Service Bus the message failed but should be re-queued for delivery.
 func (m *Message) Abandon() DispositionAction {
 	return func(ctx context.Context) {
-		span, _ := m.startSpanFromContext(ctx, "sb.Message.Abandon")
-		defer span.Finish()
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.Abandon")
+		defer span.End()
 
-		m.message.Modify(false, false, nil)
+		m.settle(ctx, OutcomeAbandoned, func() error {
+			return m.modify(ctx, false, false)
+		})
 	}
 }
 
-// TODO: Defer - will move to the "defer" queue and user will need to track the sequence number
-// FailButRetryElsewhere will notify Azure Service Bus the message failed but should be re-queued for deliver to any
-// other link but this one.
-//func (m *Message) FailButRetryElsewhere() DispositionAction {
-//	return func(ctx context.Context) {
-//		span, _ := m.startSpanFromContext(ctx, "sb.Message.FailButRetryElsewhere")
-//		defer span.Finish()
-//
-//		m.message.Modify(true, true, nil)
-//	}
-//}
-
-// Release will notify Azure Service Bus the message should be re-queued without failure.
-//func (m *Message) Release() DispositionAction {
-//	return func(ctx context.Context) {
-//		span, _ := m.startSpanFromContext(ctx, "sb.Message.Release")
-//		defer span.Finish()
+// AbandonWithBackoff will notify Azure Service Bus the message failed and should be re-queued, after holding on to the
+// message for a delay which starts at base and doubles with each delivery up to max. Holding the message back slows the
+// rate at which failing messages are redelivered, for example while a downstream dependency is unavailable. The delay
+// is cut short so the message is abandoned before its lock expires.
 //
-//		m.message.Release()
-//	}
-//}
+// The receiver runs the disposition on the goroutine which handles messages, so while the message is held back the
+// whole receiver stops handling messages, not just the failing one. Messages prefetched in the meantime keep their
+// locks running while they wait, so a low prefetch count is advisable.
+func (m *Message) AbandonWithBackoff(base, max time.Duration) DispositionAction {
+	return func(ctx context.Context) {
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.AbandonWithBackoff")
+		defer span.End()
+
+		clock := m.getClock()
+		if delay := m.abandonDelay(base, max, clock.Now()); delay > 0 {
+			select {
+			case <-ctx.Done():
+				// the caller has stopped waiting, so abandon the message now rather than leave it locked
+				ctx = context.WithoutCancel(ctx)
+			case <-clock.After(delay):
+			}
+		}
+
+		m.settle(ctx, OutcomeAbandoned, func() error {
+			return m.modify(ctx, false, false)
+		})
+	}
+}
+
+// abandonDelay is the time AbandonWithBackoff holds the message for, given the current time
+func (m *Message) abandonDelay(base, max time.Duration, now time.Time) time.Duration {
+	attempt := int(m.DeliveryCount)
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := backoffDelay(base, max, attempt)
+	if m.SystemProperties != nil && m.SystemProperties.LockedUntil != nil {
+		if remaining := m.SystemProperties.LockedUntil.Sub(now) - abandonLockMargin; delay > remaining {
+			delay = remaining
+		}
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+func (m *Message) getClock() Clock {
+	if m.namespace == nil {
+		return systemClock{}
+	}
+	return m.namespace.getClock()
+}
+
+// Defer sets the message aside. Service Bus keeps a deferred message on the entity but no longer delivers it to
+// receivers; it can only be received again by its sequence number, with Queue.ReceiveBySequenceNumbers or
+// Subscription.ReceiveOneMatching, so the caller must record SystemProperties.SequenceNumber before deferring. This
+// lets a consumer postpone a message which arrived before one it depends on. Deferring does not count towards the
+// entity's maximum delivery count. A message reassembled from chunks cannot be deferred, as its chunks would each need
+// to be received again; its disposition fails with ErrNotDeferrable.
+func (m *Message) Defer() DispositionAction {
+	return func(ctx context.Context) {
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.Defer")
+		defer span.End()
+
+		m.settle(ctx, OutcomeDeferred, func() error {
+			return m.deferMessage(ctx)
+		})
+	}
+}
+
+// Release will notify Azure Service Bus the message was not processed and should be re-queued without failure, for
+// example when a consumer shutting down hands back messages it has not started on. Unlike Abandon, SettlementHooks and
+// the abandon throttle do not count it as a failure.
+func (m *Message) Release() DispositionAction {
+	return func(ctx context.Context) {
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.Release")
+		defer span.End()
+
+		m.settle(ctx, OutcomeReleased, func() error {
+			return m.release(ctx)
+		})
+	}
+}
+
+// release returns the message to the broker. pack.ag/amqp inverts the check in its Message.Release, so the released
+// outcome is never sent; a modified outcome which neither fails the delivery nor excludes this link is sent instead.
+func (m *Message) release(ctx context.Context) error {
+	return m.modify(ctx, false, false)
+}
+
+// accept completes the message on the link it was received on, or by lock token if it was received by sequence number
+func (m *Message) accept(ctx context.Context) error {
+	if m.bySequence != nil {
+		return m.bySequence.updateDisposition(ctx, m, completedDisposition, nil)
+	}
+	return m.message.Accept()
+}
+
+// modify settles the message with the AMQP modified outcome, or abandons it by lock token if it was received by
+// sequence number, as the update-disposition operation has no equivalent of the modified outcome
+func (m *Message) modify(ctx context.Context, deliveryFailed, undeliverableHere bool) error {
+	if m.bySequence != nil {
+		return m.bySequence.updateDisposition(ctx, m, abandonedDisposition, nil)
+	}
+	return m.message.Modify(deliveryFailed, undeliverableHere, nil)
+}
+
+// deferMessage defers the message on the link it was received on, or by lock token if it was received by sequence
+// number. Service Bus reads the modified outcome marked undeliverable-here, without a delivery failure, as a deferral.
+func (m *Message) deferMessage(ctx context.Context) error {
+	if m.reassembled {
+		return ErrNotDeferrable
+	}
+	if m.bySequence != nil {
+		return m.bySequence.updateDisposition(ctx, m, deferredDisposition, nil)
+	}
+	return m.message.Modify(false, true, nil)
+}
+
+// reject dead-letters the message on the link it was received on, or by lock token if it was received by sequence
+// number
+func (m *Message) reject(ctx context.Context, e *amqp.Error) error {
+	if m.bySequence != nil {
+		return m.bySequence.updateDisposition(ctx, m, suspendedDisposition, e)
+	}
+	return m.message.Reject(e)
+}
 
 // DeadLetter will notify Azure Service Bus the message failed and should not re-queued
 func (m *Message) DeadLetter(err error) DispositionAction {
 	return func(ctx context.Context) {
-		span, _ := m.startSpanFromContext(ctx, "sb.Message.DeadLetter")
-		defer span.Finish()
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.DeadLetter")
+		defer span.End()
 
 		amqpErr := amqp.Error{
 			Condition:   amqp.ErrorCondition(ErrorInternalError),
 			Description: err.Error(),
 		}
-		m.message.Reject(&amqpErr)
+		m.settle(ctx, OutcomeDeadLettered, func() error {
+			return m.reject(ctx, &amqpErr)
+		})
 	}
 }
 
@@ -180,20 +384,104 @@ func (m *Message) DeadLetterWithInfo(err error, condition MessageErrorCondition,
 	}
 
 	return func(ctx context.Context) {
-		span, _ := m.startSpanFromContext(ctx, "sb.Message.DeadLetterWithInfo")
-		defer span.Finish()
+		span, ctx := m.startSpanFromContext(ctx, "sb.Message.DeadLetterWithInfo")
+		defer span.End()
 
 		amqpErr := amqp.Error{
 			Condition:   amqp.ErrorCondition(condition),
 			Description: err.Error(),
 			Info:        info,
 		}
-		m.message.Reject(&amqpErr)
+		m.settle(ctx, OutcomeDeadLettered, func() error {
+			return m.reject(ctx, &amqpErr)
+		})
+	}
+}
+
+// redelivered reports whether a message settled with the outcome remains on the entity to be delivered again, which a
+// deferred message is once it is received by its sequence number
+func (o SettlementOutcome) redelivered() bool {
+	return o == OutcomeAbandoned || o == OutcomeReleased || o == OutcomeDeferred
+}
+
+// failed reports whether the outcome records a failure to process the message
+func (o SettlementOutcome) failed() bool {
+	return o == OutcomeAbandoned
+}
+
+// Settle runs the disposition action and reports the outcome the broker acknowledged. The action gives up, leaving the
+// message locked until its lock expires, once the context is done or, if the context has no deadline, after
+// DefaultDispositionTimeout. An action which is not one of the Message's dispositions, such as one returned for another
+// message, reports an empty outcome, as does any action on a message received in ReceiveAndDelete mode.
+func (m *Message) Settle(ctx context.Context, action DispositionAction) (SettlementOutcome, error) {
+	m.settledAs, m.settleErr = "", nil
+	if action != nil {
+		action(ctx)
+	}
+	return m.settledAs, m.settleErr
+}
+
+// settle runs the disposition against the broker and, once it has been acknowledged, notifies the settlement hook. A
+// message received in ReceiveAndDelete mode was settled on delivery, so there is nothing left to settle.
+func (m *Message) settle(ctx context.Context, outcome SettlementOutcome, disposition func() error) error {
+	if m.receiveMode == ReceiveAndDeleteMode {
+		return nil
+	}
+
+	err := m.trySettle(ctx, outcome, disposition)
+	if err != nil {
+		log.For(ctx).Error(err)
+		m.settleErr = err
+		return err
+	}
+
+	m.settledAs, m.settleErr = outcome, nil
+	if m.settlementHook != nil {
+		m.settlementHook(ctx, m, outcome)
+	}
+	return nil
+}
+
+// dispositionContext is the context the receiver runs a handler's disposition with. Handlers commonly cancel the
+// receive context before returning their disposition, so only its values are kept and the disposition is bounded by
+// DefaultDispositionTimeout instead.
+func dispositionContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// trySettle runs the disposition, returning early if the context is done or the disposition is not acknowledged in
+// time. pack.ag/amqp waits for the acknowledgement without a context, so an abandoned wait finishes in the background.
+func (m *Message) trySettle(ctx context.Context, outcome SettlementOutcome, disposition func() error) error {
+	if err := m.namespace.delayDisposition(ctx, m, outcome); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok {
+		timeout = m.getClock().After(DefaultDispositionTimeout)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- disposition()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return context.DeadlineExceeded
 	}
 }
 
 // ScheduleAt will ensure Azure Service Bus delivers the message after the time specified
-// (usually within 1 minute after the specified time)
+// (usually within 1 minute after the specified time). Send the message with Queue.SendScheduled to be able to cancel
+// it before then.
 func (m *Message) ScheduleAt(t time.Time) {
 	if m.SystemProperties == nil {
 		m.SystemProperties = new(SystemProperties)
@@ -213,8 +501,12 @@ func (m *Message) Set(key, value string) {
 // ForeachKey implements the opentracing.TextMapReader and gets properties on the event to be propagated from the message broker
 func (m *Message) ForeachKey(handler func(key, val string) error) error {
 	for key, value := range m.UserProperties {
-		err := handler(key, value.(string))
-		if err != nil {
+		// only string properties can carry trace context
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if err := handler(key, s); err != nil {
 			return err
 		}
 	}
@@ -224,7 +516,14 @@ func (m *Message) ForeachKey(handler func(key, val string) error) error {
 func (m *Message) toMsg() (*amqp.Message, error) {
 	amqpMsg := m.message
 	if amqpMsg == nil {
-		amqpMsg = amqp.NewMessage(m.Data)
+		if m.Value != nil {
+			if len(m.Data) > 0 {
+				return nil, errors.New("a message body is either Data or a Value, not both")
+			}
+			amqpMsg = &amqp.Message{Value: m.Value}
+		} else {
+			amqpMsg = amqp.NewMessage(m.Data)
+		}
 	}
 
 	amqpMsg.Properties = &amqp.MessageProperties{
@@ -261,6 +560,14 @@ func (m *Message) toMsg() (*amqp.Message, error) {
 		amqpMsg.Annotations = annotationsFromMap(sysPropMap)
 	}
 
+	if len(m.DeliveryAnnotations) > 0 {
+		amqpMsg.DeliveryAnnotations = annotationsFromMap(m.DeliveryAnnotations)
+	}
+
+	if len(m.Footer) > 0 {
+		amqpMsg.Footer = annotationsFromMap(m.Footer)
+	}
+
 	if m.LockToken != nil {
 		if amqpMsg.DeliveryAnnotations == nil {
 			amqpMsg.DeliveryAnnotations = make(amqp.Annotations)
@@ -286,8 +593,24 @@ func annotationsFromMap(m map[string]interface{}) amqp.Annotations {
 	return a
 }
 
+func mapFromAnnotations(a amqp.Annotations) map[string]interface{} {
+	m := make(map[string]interface{}, len(a))
+	for key, val := range a {
+		if str, ok := key.(string); ok {
+			m[str] = val
+			continue
+		}
+		m[fmt.Sprint(key)] = val
+	}
+	return m
+}
+
 func messageFromAMQPMessage(msg *amqp.Message) (*Message, error) {
-	return newMessage(msg.Data[0], msg)
+	var data []byte
+	if len(msg.Data) > 0 {
+		data = msg.Data[0]
+	}
+	return newMessage(data, msg)
 }
 
 func newMessage(data []byte, amqpMsg *amqp.Message) (*Message, error) {
@@ -299,6 +622,7 @@ func newMessage(data []byte, amqpMsg *amqp.Message) (*Message, error) {
 	if amqpMsg == nil {
 		return msg, nil
 	}
+	msg.Value = amqpMsg.Value
 
 	if amqpMsg.Properties != nil {
 		if id, ok := amqpMsg.Properties.MessageID.(string); ok {
@@ -326,10 +650,18 @@ func newMessage(data []byte, amqpMsg *amqp.Message) (*Message, error) {
 	}
 
 	if amqpMsg.Annotations != nil {
-		if err := mapstructure.Decode(amqpMsg.Annotations, &msg.SystemProperties); err != nil {
+		if err := decodeSystemProperties(amqpMsg.Annotations, &msg.SystemProperties); err != nil {
 			return msg, err
 		}
 	}
+	if len(amqpMsg.DeliveryAnnotations) > 0 {
+		msg.DeliveryAnnotations = mapFromAnnotations(amqpMsg.DeliveryAnnotations)
+	}
+
+	if len(amqpMsg.Footer) > 0 {
+		msg.Footer = mapFromAnnotations(amqpMsg.Footer)
+	}
+
 	if amqpMsg.DeliveryTag != nil && len(amqpMsg.DeliveryTag) > 0 {
 		lockToken, err := lockTokenFromMessageTag(amqpMsg)
 		if err != nil {
@@ -0,0 +1,88 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+// OldestMessageAge returns how long the oldest message waiting in the Queue has been enqueued, or 0 if the Queue is
+// empty. Unlike the message count, the age of the oldest message shows how far consumers are lagging behind, so it is
+// better suited to alerting. Messages scheduled for the future are skipped. Deferred messages cannot be told apart
+// from active messages when peeking, so they count towards the age until they are received.
+func (q *Queue) OldestMessageAge(ctx context.Context) (time.Duration, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.OldestMessageAge")
+	defer span.End()
+
+	it, err := q.NewPeekIterator(ctx)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+	return oldestMessageAge(ctx, it, q.namespace.getClock().Now())
+}
+
+// OldestMessageAge returns how long the oldest message waiting in the Subscription has been enqueued, or 0 if the
+// Subscription is empty. Messages scheduled for the future are skipped, while deferred messages count towards the age
+// until they are received.
+func (s *Subscription) OldestMessageAge(ctx context.Context) (time.Duration, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.OldestMessageAge")
+	defer span.End()
+
+	it, err := s.NewPeekIterator(ctx)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+	return oldestMessageAge(ctx, it, s.namespace.getClock().Now())
+}
+
+// oldestMessageAge peeks through the messages of an entity, in sequence order, to the first one which is not scheduled
+// for later and returns how long before now it was enqueued
+func oldestMessageAge(ctx context.Context, it MessageIterator, now time.Time) (time.Duration, error) {
+	for {
+		msg, err := it.Next(ctx)
+		if _, ok := err.(ErrNoMessages); ok {
+			return 0, nil
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			return 0, err
+		}
+
+		props := msg.SystemProperties
+		if props == nil || props.EnqueuedTime == nil {
+			continue
+		}
+		if props.ScheduledEnqueueTime != nil && props.ScheduledEnqueueTime.After(now) {
+			continue
+		}
+		if age := now.Sub(*props.EnqueuedTime); age > 0 {
+			return age, nil
+		}
+		return 0, nil
+	}
+}
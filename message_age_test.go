@@ -0,0 +1,61 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingIterator struct {
+	err error
+}
+
+func (it failingIterator) Done() bool {
+	return false
+}
+
+func (it failingIterator) Next(context.Context) (*Message, error) {
+	return nil, it.err
+}
+
+func TestOldestMessageAge(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	enqueued := func(ago time.Duration, scheduledIn time.Duration) *Message {
+		at := now.Add(-ago)
+		msg := NewMessageFromString("payload")
+		msg.SystemProperties = &SystemProperties{EnqueuedTime: &at}
+		if scheduledIn != 0 {
+			scheduled := now.Add(scheduledIn)
+			msg.SystemProperties.ScheduledEnqueueTime = &scheduled
+		}
+		return msg
+	}
+	ctx := context.Background()
+
+	age, err := oldestMessageAge(ctx, AsMessageSliceIterator([]*Message{
+		enqueued(time.Hour, time.Hour),
+		enqueued(10*time.Minute, 0),
+		enqueued(time.Minute, 0),
+	}), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, age, "messages scheduled for later are not waiting yet")
+
+	age, err = oldestMessageAge(ctx, AsMessageSliceIterator([]*Message{enqueued(2*time.Minute, -time.Minute)}), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, age, "scheduled messages which are due count")
+
+	age, err = oldestMessageAge(ctx, AsMessageSliceIterator(nil), now)
+	assert.NoError(t, err)
+	assert.Zero(t, age)
+
+	age, err = oldestMessageAge(ctx, AsMessageSliceIterator([]*Message{enqueued(-time.Second, 0)}), now)
+	assert.NoError(t, err)
+	assert.Zero(t, age, "clock skew does not produce a negative age")
+
+	peekErr := errors.New("link detached")
+	_, err = oldestMessageAge(ctx, failingIterator{err: peekErr}, now)
+	assert.Equal(t, peekErr, err)
+}
@@ -27,7 +27,7 @@ func newMessageSession(r *receiver, e *entity, sessionID *string) (retval *Messa
 		receiver:       r,
 		entity:         e,
 		sessionID:      sessionID,
-		lockExpiration: time.Now(),
+		lockExpiration: e.namespace.getClock().Now(),
 		done:           make(chan struct{}),
 	}
 
@@ -38,6 +38,10 @@ func newMessageSession(r *receiver, e *entity, sessionID *string) (retval *Messa
 // - A Handler recognizes that no further messages will come to this session.
 // - A Handler has given up on receiving more messages before a session. Future messages should be delegated to the next
 //   available session client.
+//
+// Once the message currently being handled has been settled, the session lock is abandoned so the session can be
+// accepted by another receiver straight away, and the Receive call processing the session returns. Close is safe to
+// call from within Handle and may be called more than once.
 func (ms *MessageSession) Close() {
 	ms.cancel.Do(func() {
 		close(ms.done)
@@ -54,9 +58,6 @@ func (ms *MessageSession) LockedUntil() time.Time {
 
 // RenewLock requests that the Service Bus Server renews this client's lock on an existing Session.
 func (ms *MessageSession) RenewLock(ctx context.Context) error {
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
-
 	link, err := rpc.NewLinkWithSession(ms.receiver.connection, ms.receiver.session.Session, ms.entity.ManagementPath())
 	if err != nil {
 		return err
@@ -72,7 +73,7 @@ func (ms *MessageSession) RenewLock(ctx context.Context) error {
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
-		msg.ApplicationProperties["com.microsoft:server-timeout"] = uint(time.Until(deadline) / time.Millisecond)
+		msg.ApplicationProperties["com.microsoft:server-timeout"] = uint(ms.entity.namespace.until(deadline) / time.Millisecond)
 	}
 
 	resp, err := link.RetryableRPC(ctx, 5, 5*time.Second, msg)
@@ -82,7 +83,10 @@ func (ms *MessageSession) RenewLock(ctx context.Context) error {
 
 	if rawMessageValue, ok := resp.Message.Value.(map[string]interface{}); ok {
 		if rawExpiration, ok := rawMessageValue["expiration"]; ok {
-			if ms.lockExpiration, ok = rawExpiration.(time.Time); ok {
+			if expiration, ok := rawExpiration.(time.Time); ok {
+				ms.mu.Lock()
+				defer ms.mu.Unlock()
+				ms.lockExpiration = expiration
 				return nil
 			}
 			return errors.New("\"expiration\" not of expected type time.Time")
@@ -167,5 +171,19 @@ func (ms *MessageSession) State(ctx context.Context) ([]byte, error) {
 
 // SessionID gets the unique identifier of the session being interacted with by this MessageSession.
 func (ms *MessageSession) SessionID() *string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	return ms.sessionID
 }
+
+// adoptSessionID records the session of the message as the session being interacted with, if it was not known yet.
+// When accepting the next available session, the session ID is only known once a message arrives.
+func (ms *MessageSession) adoptSessionID(msg *Message) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.sessionID == nil && msg.GroupID != nil {
+		ms.sessionID = msg.GroupID
+	}
+}
@@ -2,6 +2,8 @@ package servicebus
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -110,3 +112,84 @@ func testEmptyLock(ctx context.Context, t *testing.T, ms *MessageSession) {
 	require.NoError(t, err)
 	assert.Nil(t, currentState)
 }
+
+func (suite *serviceBusSuite) TestMessageSessionCloseReleasesLock() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	ns := suite.getNewSasInstance()
+	queueName := suite.randEntityName()
+	cleanup := makeQueue(ctx, suite.T(), ns, queueName, QueueEntityWithRequiredSessions())
+	defer cleanup()
+
+	q, err := ns.NewQueue(queueName)
+	suite.Require().NoError(err)
+	defer func() {
+		q.Close(context.Background())
+	}()
+
+	sessionID := suite.randEntityName()
+	for _, body := range []string{"first", "second"} {
+		msg := NewMessageFromString(body)
+		msg.GroupID = &sessionID
+		suite.Require().NoError(q.Send(ctx, msg))
+	}
+
+	receiveFirst := func() string {
+		var ms *MessageSession
+		var got string
+		err := q.ReceiveOneSession(ctx, &sessionID, NewSessionHandler(
+			HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+				got = string(msg.Data)
+				ms.Close()
+				return msg.Complete()
+			}),
+			func(session *MessageSession) error {
+				ms = session
+				return nil
+			},
+			func() {}))
+		suite.NoError(err)
+		return got
+	}
+
+	// the second receive would block until the lock expired if closing the session did not release it
+	suite.Equal("first", receiveFirst())
+	suite.Equal("second", receiveFirst())
+}
+
+func TestMessageSession_AdoptSessionIDConcurrently(t *testing.T) {
+	const sessions, messages = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		ms := &MessageSession{done: make(chan struct{})}
+		id := fmt.Sprintf("session-%d", i)
+
+		// messages arrive on the session's listener while its handler reads the session ID
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				msg := NewMessageFromString("hello")
+				msg.GroupID = &id
+				ms.adoptSessionID(msg)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				if got := ms.SessionID(); got != nil {
+					assert.Equal(t, id, *got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	other := "other"
+	ms := &MessageSession{sessionID: &other}
+	msg := NewMessageFromString("hello")
+	msg.GroupID = new(string)
+	ms.adoptSessionID(msg)
+	assert.Equal(t, &other, ms.SessionID(), "a known session ID is kept")
+}
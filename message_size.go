@@ -0,0 +1,62 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+const (
+	// StandardMaxMessageSizeInBytes is the largest message a Standard tier namespace accepts
+	StandardMaxMessageSizeInBytes = 256 * 1024
+	// PremiumMaxMessageSizeInBytes is the largest message a Premium tier namespace accepts by default
+	PremiumMaxMessageSizeInBytes = 1024 * 1024
+
+	// placeholderMessageID stands in for the ID the sender assigns to a message without one, which is a UUID
+	placeholderMessageID = "00000000-0000-0000-0000-000000000000"
+)
+
+// Size returns the size of the message encoded for transfer, including its properties and annotations, so producers
+// can check messages against the size limit of the namespace and split them or store their payload elsewhere before
+// sending fails. A message without an ID is measured as though it had the UUID the sender will give it. Trace context
+// added by the sender is not included, so leave some headroom, as Fits does.
+func (m *Message) Size() (int, error) {
+	measured := *m
+	// a received message keeps the AMQP message it arrived in, which measuring it must not modify
+	measured.message = nil
+	if measured.ID == "" {
+		measured.ID = placeholderMessageID
+	}
+
+	bin, err := encodeMessage(&measured)
+	if err != nil {
+		return 0, err
+	}
+	return len(bin), nil
+}
+
+// Fits reports whether the message is small enough to send to a namespace whose size limit is maxSize, such as
+// StandardMaxMessageSizeInBytes, while leaving room for the trace context the sender adds
+func (m *Message) Fits(maxSize int) (bool, error) {
+	size, err := m.Size()
+	if err != nil {
+		return false, err
+	}
+	return size+batchEnvelopeOverhead <= maxSize, nil
+}
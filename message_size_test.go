@@ -0,0 +1,86 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestMessage_Size(t *testing.T) {
+	msg := NewMessageFromString(strings.Repeat("a", 1000))
+	msg.ID = placeholderMessageID
+	size, err := msg.Size()
+	if !assert.NoError(t, err) {
+		return
+	}
+	bin, err := encodeMessage(msg)
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(bin), size)
+	}
+	assert.True(t, size > 1000)
+
+	msg.ID = ""
+	withoutID, err := msg.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, size, withoutID, "messages are measured with the ID the sender gives them")
+	assert.Empty(t, msg.ID)
+
+	msg.Set("tenant", strings.Repeat("b", 100))
+	withProperty, err := msg.Size()
+	assert.NoError(t, err)
+	assert.True(t, withProperty >= size+100, "user properties are included")
+
+	msg.Value = "both"
+	_, err = msg.Size()
+	assert.Error(t, err)
+}
+
+func TestMessage_SizeDoesNotModifyReceivedMessages(t *testing.T) {
+	received := &amqp.Message{Data: [][]byte{[]byte("payload")}}
+	msg := NewMessageFromString("payload")
+	msg.message = received
+
+	_, err := msg.Size()
+	assert.NoError(t, err)
+	assert.Nil(t, received.Properties)
+}
+
+func TestMessage_Fits(t *testing.T) {
+	small := NewMessageFromString("payload")
+	fits, err := small.Fits(StandardMaxMessageSizeInBytes)
+	assert.NoError(t, err)
+	assert.True(t, fits)
+
+	large := NewMessage(make([]byte, StandardMaxMessageSizeInBytes))
+	fits, err = large.Fits(StandardMaxMessageSizeInBytes)
+	assert.NoError(t, err)
+	assert.False(t, fits)
+
+	fits, err = large.Fits(PremiumMaxMessageSizeInBytes)
+	assert.NoError(t, err)
+	assert.True(t, fits)
+}
@@ -0,0 +1,223 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"pack.ag/amqp"
+)
+
+type (
+	// MessageStream delivers the messages received in the background by Queue.Messages or Subscription.Messages
+	MessageStream struct {
+		messages chan *ReceivedMessage
+		done     chan struct{}
+		err      error
+	}
+
+	// ReceivedMessage is a message delivered by Messages. Unlike the DispositionActions of Message, its settlement
+	// methods run immediately and report whether the broker accepted the disposition, so they can be called from any
+	// goroutine, such as the worker of a pool.
+	ReceivedMessage struct {
+		*Message
+	}
+)
+
+// ErrAlreadySettled is returned when settling a message which was received in ReceiveAndDelete mode, as the broker
+// settles such messages when delivering them
+var ErrAlreadySettled = errors.New("servicebus: messages received in ReceiveAndDelete mode are settled on delivery")
+
+// Messages receives from the Queue in the background and delivers the messages on the channel of the returned
+// MessageStream, which is closed once the context is done or receiving fails. ErrEntityNotFound is returned promptly if
+// the Queue does not exist, unless ReceiveWithAutoProvision is used to create it. Messages received in PeekLock mode
+// must be settled with the methods of ReceivedMessage; a message left unsettled is redelivered once its lock expires.
+// Locks are not renewed automatically for streamed messages, as the queue cannot tell when a consumer has finished
+// with them.
+func (q *Queue) Messages(ctx context.Context, opts ...ReceiveOption) (*MessageStream, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.Messages")
+	defer span.End()
+
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withAutoProvision(ctx, options, q.provision, func() error {
+		return q.ensureReceiver(ctx)
+	})
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+	return newMessageStream(ctx, q.receiver, options), nil
+}
+
+// Messages receives from the Subscription in the background and delivers the messages on the channel of the returned
+// MessageStream. See Queue.Messages.
+func (s *Subscription) Messages(ctx context.Context, opts ...ReceiveOption) (*MessageStream, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.Messages")
+	defer span.End()
+
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withAutoProvision(ctx, options, s.provision, func() error {
+		return s.ensureReceiver(ctx)
+	})
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+	return newMessageStream(ctx, s.receiver, options), nil
+}
+
+// newMessageStream starts streaming the messages of the receiver in the background
+func newMessageStream(ctx context.Context, r *receiver, options *receiveOptions) *MessageStream {
+	ms := &MessageStream{
+		messages: make(chan *ReceivedMessage),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(ms.messages)
+		err := streamMessages(ctx, r, options, ms.messages)
+		if err != nil && err != ctx.Err() {
+			log.For(ctx).Error(err)
+			ms.err = err
+		}
+		close(ms.done)
+	}()
+	return ms
+}
+
+// C returns the channel the messages are delivered on, which is closed once streaming stops
+func (ms *MessageStream) C() <-chan *ReceivedMessage {
+	return ms.messages
+}
+
+// Err returns the error which stopped the stream once its channel is closed. It is nil while the stream is running
+// and when the stream stopped because its context was done.
+func (ms *MessageStream) Err() error {
+	select {
+	case <-ms.done:
+		return ms.err
+	default:
+		return nil
+	}
+}
+
+// streamMessages listens with the receiver and passes each message accepted by the options on to out until the listener
+// stops. It only returns once no more messages will be sent to out.
+func streamMessages(ctx context.Context, r *receiver, options *receiveOptions, out chan<- *ReceivedMessage) error {
+	handle := r.Listen(ctx, options.filtered(HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		select {
+		case out <- &ReceivedMessage{Message: msg}:
+		case <-ctx.Done():
+		}
+		return settledByConsumer
+	})))
+	options.ready()
+
+	<-handle.Done()
+	<-handle.Handled()
+	return handle.Err()
+}
+
+// Complete tells the broker the message was handled successfully and removes it from the entity
+func (rm *ReceivedMessage) Complete(ctx context.Context) error {
+	span, ctx := rm.startSpanFromContext(ctx, "sb.ReceivedMessage.Complete")
+	defer span.End()
+
+	if rm.receiveMode == ReceiveAndDeleteMode {
+		return ErrAlreadySettled
+	}
+	return rm.settle(ctx, OutcomeCompleted, func() error {
+		return rm.accept(ctx)
+	})
+}
+
+// Abandon releases the lock on the message so it is redelivered
+func (rm *ReceivedMessage) Abandon(ctx context.Context) error {
+	span, ctx := rm.startSpanFromContext(ctx, "sb.ReceivedMessage.Abandon")
+	defer span.End()
+
+	if rm.receiveMode == ReceiveAndDeleteMode {
+		return ErrAlreadySettled
+	}
+	return rm.settle(ctx, OutcomeAbandoned, func() error {
+		return rm.modify(ctx, false, false)
+	})
+}
+
+// Release hands the message back unprocessed so it is redelivered, without counting as a failure. See Message.Release.
+func (rm *ReceivedMessage) Release(ctx context.Context) error {
+	span, ctx := rm.startSpanFromContext(ctx, "sb.ReceivedMessage.Release")
+	defer span.End()
+
+	if rm.receiveMode == ReceiveAndDeleteMode {
+		return ErrAlreadySettled
+	}
+	return rm.settle(ctx, OutcomeReleased, func() error {
+		return rm.release(ctx)
+	})
+}
+
+// Defer sets the message aside and returns its sequence number, which it can only be received again by. See
+// Message.Defer.
+func (rm *ReceivedMessage) Defer(ctx context.Context) (int64, error) {
+	span, ctx := rm.startSpanFromContext(ctx, "sb.ReceivedMessage.Defer")
+	defer span.End()
+
+	if rm.receiveMode == ReceiveAndDeleteMode {
+		return 0, ErrAlreadySettled
+	}
+	if rm.SystemProperties == nil || rm.SystemProperties.SequenceNumber == nil {
+		return 0, errors.New("message has no sequence number to be received again by")
+	}
+	err := rm.settle(ctx, OutcomeDeferred, func() error {
+		return rm.deferMessage(ctx)
+	})
+	return *rm.SystemProperties.SequenceNumber, err
+}
+
+// DeadLetter moves the message to the dead letter queue, recording reason as the description of the failure
+func (rm *ReceivedMessage) DeadLetter(ctx context.Context, reason error) error {
+	span, ctx := rm.startSpanFromContext(ctx, "sb.ReceivedMessage.DeadLetter")
+	defer span.End()
+
+	if rm.receiveMode == ReceiveAndDeleteMode {
+		return ErrAlreadySettled
+	}
+
+	amqpErr := amqp.Error{
+		Condition:   amqp.ErrorCondition(ErrorInternalError),
+		Description: reason.Error(),
+	}
+	return rm.settle(ctx, OutcomeDeadLettered, func() error {
+		return rm.reject(ctx, &amqpErr)
+	})
+}
@@ -0,0 +1,101 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_MessagesRejectsInvalidOptions(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = q.Messages(context.Background(), WithMaxWaitTime(0))
+	assert.Error(t, err)
+}
+
+func TestStreamMessages_StopsWithContext(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a paused receiver never asks the broker for messages, so streaming only ends with the context
+	r := &receiver{namespace: ns, entityPath: "orders", resumed: make(chan struct{})}
+	out := make(chan *ReceivedMessage)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- streamMessages(ctx, r, new(receiveOptions), out)
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("streaming did not stop when the context was canceled")
+	}
+}
+
+func TestMessageStream_ClosesWithContext(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := &receiver{namespace: ns, entityPath: "orders", resumed: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	ms := newMessageStream(ctx, r, new(receiveOptions))
+	assert.NoError(t, ms.Err())
+
+	cancel()
+	select {
+	case _, ok := <-ms.C():
+		assert.False(t, ok)
+		assert.NoError(t, ms.Err(), "a stream stopped by its context has not failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream was not closed when the context was canceled")
+	}
+}
+
+func TestReceivedMessage_ReceiveAndDeleteIsAlreadySettled(t *testing.T) {
+	rm := &ReceivedMessage{Message: NewMessageFromString("done")}
+	rm.receiveMode = ReceiveAndDeleteMode
+
+	ctx := context.Background()
+	assert.Equal(t, ErrAlreadySettled, rm.Complete(ctx))
+	assert.Equal(t, ErrAlreadySettled, rm.Abandon(ctx))
+	assert.Equal(t, ErrAlreadySettled, rm.DeadLetter(ctx, errors.New("poison")))
+}
@@ -1,11 +1,16 @@
 package servicebus
 
 import (
+	"context"
+	"errors"
+	"testing"
 	"time"
 
 	"github.com/Azure/azure-amqp-common-go/uuid"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"pack.ag/amqp"
 )
 
@@ -184,3 +189,263 @@ func (suite *serviceBusSuite) TestAMQPMessageToMessage() {
 		}
 	}
 }
+
+func TestMessage_SettleNotifiesHook(t *testing.T) {
+	var outcomes []SettlementOutcome
+	msg := NewMessageFromString("foo")
+	msg.settlementHook = func(ctx context.Context, m *Message, outcome SettlementOutcome) {
+		assert.Equal(t, msg, m)
+		outcomes = append(outcomes, outcome)
+	}
+
+	msg.settle(context.Background(), OutcomeCompleted, func() error { return nil })
+	msg.settle(context.Background(), OutcomeAbandoned, func() error { return errors.New("link detached") })
+	assert.Equal(t, []SettlementOutcome{OutcomeCompleted}, outcomes)
+}
+
+func TestMessage_SettleSkipsHookInReceiveAndDeleteMode(t *testing.T) {
+	hooked, disposed := false, false
+	msg := NewMessageFromString("foo")
+	msg.receiveMode = ReceiveAndDeleteMode
+	msg.settlementHook = func(context.Context, *Message, SettlementOutcome) {
+		hooked = true
+	}
+
+	outcome, err := msg.Settle(context.Background(), func(ctx context.Context) {
+		msg.settle(ctx, OutcomeCompleted, func() error {
+			disposed = true
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, outcome)
+	assert.False(t, disposed, "a message deleted on receipt has no disposition to send")
+	assert.False(t, hooked)
+}
+
+func TestMessage_SettleHonorsContext(t *testing.T) {
+	hooked := false
+	msg := NewMessageFromString("foo")
+	msg.settlementHook = func(context.Context, *Message, SettlementOutcome) {
+		hooked = true
+	}
+	blocked := make(chan struct{})
+	defer close(blocked)
+	hang := func() error {
+		<-blocked
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, msg.settle(ctx, OutcomeCompleted, hang))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	assert.Equal(t, context.Canceled, msg.settle(canceled, OutcomeCompleted, func() error {
+		called = true
+		return nil
+	}))
+	assert.False(t, called, "a disposition should not be sent once the context is done")
+	assert.False(t, hooked)
+}
+
+func TestMessage_SettleTimesOutWithoutDeadline(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg := NewMessageFromString("foo")
+	msg.namespace = ns
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- msg.settle(context.Background(), OutcomeCompleted, func() error {
+			<-blocked
+			return nil
+		})
+	}()
+
+	clock.waitForCalls(1)
+	clock.Advance(DefaultDispositionTimeout)
+	select {
+	case err := <-done:
+		assert.Equal(t, context.DeadlineExceeded, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("settle did not time out after DefaultDispositionTimeout")
+	}
+}
+
+func TestMessage_SettleReportsOutcome(t *testing.T) {
+	msg := NewMessageFromString("foo")
+	complete := func(ctx context.Context) {
+		msg.settle(ctx, OutcomeCompleted, func() error { return nil })
+	}
+	outcome, err := msg.Settle(context.Background(), complete)
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeCompleted, outcome)
+
+	detached := errors.New("link detached")
+	outcome, err = msg.Settle(context.Background(), func(ctx context.Context) {
+		msg.settle(ctx, OutcomeAbandoned, func() error { return detached })
+	})
+	assert.Equal(t, detached, err)
+	assert.Empty(t, outcome)
+
+	outcome, err = msg.Settle(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, outcome)
+}
+
+func TestSettlementOutcome_Redelivery(t *testing.T) {
+	for _, outcome := range []SettlementOutcome{OutcomeAbandoned, OutcomeReleased, OutcomeDeferred} {
+		assert.True(t, outcome.redelivered(), string(outcome))
+	}
+	for _, outcome := range []SettlementOutcome{OutcomeCompleted, OutcomeDeadLettered} {
+		assert.False(t, outcome.redelivered(), string(outcome))
+	}
+
+	assert.True(t, OutcomeAbandoned.failed())
+	assert.False(t, OutcomeDeferred.failed(), "a deferred message is set aside, not failed")
+	assert.False(t, OutcomeReleased.failed(), "a released message was not processed, so it did not fail")
+}
+
+func TestReceivedMessage_ReleaseInReceiveAndDeleteMode(t *testing.T) {
+	rm := &ReceivedMessage{Message: NewMessageFromString("foo")}
+	rm.receiveMode = ReceiveAndDeleteMode
+	assert.Equal(t, ErrAlreadySettled, rm.Release(context.Background()))
+	_, err := rm.Defer(context.Background())
+	assert.Equal(t, ErrAlreadySettled, err)
+}
+
+func TestReceivedMessage_DeferRequiresSequenceNumber(t *testing.T) {
+	rm := &ReceivedMessage{Message: NewMessageFromString("foo")}
+	_, err := rm.Defer(context.Background())
+	assert.Error(t, err)
+}
+
+func TestMessage_DeferReassembledMessage(t *testing.T) {
+	first, last := NewMessageFromString("a"), NewMessageFromString("b")
+	assembled := reassemble("group", []*Message{first, last}, last)
+	assert.Equal(t, ErrNotDeferrable, assembled.deferMessage(context.Background()))
+}
+
+func TestMessage_FooterAndDeliveryAnnotationsRoundTrip(t *testing.T) {
+	aMsg := &amqp.Message{
+		Properties: &amqp.MessageProperties{
+			MessageID: "messageID",
+		},
+		Header: &amqp.MessageHeader{},
+		DeliveryAnnotations: amqp.Annotations{
+			"x-opt-producer": "jms",
+		},
+		Footer: amqp.Annotations{
+			"x-opt-hash": "abc123",
+		},
+		Data: [][]byte{[]byte("foo")},
+	}
+
+	msg, err := messageFromAMQPMessage(aMsg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{"x-opt-producer": "jms"}, msg.DeliveryAnnotations)
+	assert.Equal(t, map[string]interface{}{"x-opt-hash": "abc123"}, msg.Footer)
+
+	resend := NewMessage(msg.Data)
+	resend.DeliveryAnnotations = msg.DeliveryAnnotations
+	resend.Footer = msg.Footer
+	out, err := resend.toMsg()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "jms", out.DeliveryAnnotations["x-opt-producer"])
+		assert.Equal(t, "abc123", out.Footer["x-opt-hash"])
+	}
+}
+
+func TestMessage_ProtoRoundTrip(t *testing.T) {
+	msg, err := NewProtoMessage(wrapperspb.String("hello"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, ProtobufContentType, msg.ContentType)
+	assert.Equal(t, "google.protobuf.StringValue", msg.UserProperties[ProtoTypeNameProperty])
+
+	var got wrapperspb.StringValue
+	if assert.NoError(t, msg.UnmarshalProto(&got)) {
+		assert.Equal(t, "hello", got.GetValue())
+	}
+
+	assert.Error(t, msg.UnmarshalProto(new(wrapperspb.Int32Value)), "type names should be checked")
+	text := NewMessageFromString("hello")
+	text.ContentType = "text/plain"
+	assert.Error(t, text.UnmarshalProto(&got), "content types should be checked")
+}
+
+func TestMessage_AbandonDelayScalesWithDeliveryCount(t *testing.T) {
+	now := time.Now()
+	msg := NewMessageFromString("retry me")
+
+	for count, want := range map[uint32]time.Duration{
+		0: time.Second,
+		1: time.Second,
+		2: 2 * time.Second,
+		4: 8 * time.Second,
+		9: 10 * time.Second,
+	} {
+		msg.DeliveryCount = count
+		assert.Equal(t, want, msg.abandonDelay(time.Second, 10*time.Second, now), "delivery count %d", count)
+	}
+
+	msg.DeliveryCount = 9
+	lockedUntil := now.Add(5 * time.Second)
+	msg.SystemProperties = &SystemProperties{LockedUntil: &lockedUntil}
+	assert.Equal(t, 5*time.Second-abandonLockMargin, msg.abandonDelay(time.Second, 10*time.Second, now))
+
+	lockedUntil = now.Add(time.Second)
+	assert.Zero(t, msg.abandonDelay(time.Second, 10*time.Second, now))
+}
+
+func TestMessage_AMQPValueRoundTrip(t *testing.T) {
+	sent := NewMessageFromAMQPValue(map[string]interface{}{"sku": "A1", "quantity": int64(3)})
+	sent.ID = "order-1"
+	out, err := sent.toMsg()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, out.Data)
+
+	bin, err := out.MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var wire amqp.Message
+	if !assert.NoError(t, wire.UnmarshalBinary(bin)) {
+		return
+	}
+	wire.Header = &amqp.MessageHeader{}
+
+	received, err := messageFromAMQPMessage(&wire)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, received.Data)
+	assert.Equal(t, "order-1", received.ID)
+	values, err := received.ValueMap()
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"sku": "A1", "quantity": int64(3)}, values)
+	}
+
+	_, err = NewMessageFromAMQPValue([]interface{}{"a", "b"}).ValueMap()
+	assert.IsType(t, ErrIncorrectType{}, err)
+	_, err = NewMessageFromAMQPValue(map[interface{}]interface{}{int64(1): "a"}).ValueMap()
+	assert.Error(t, err)
+
+	both := NewMessageFromString("data")
+	both.Value = "value"
+	_, err = both.toMsg()
+	assert.Error(t, err)
+}
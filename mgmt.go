@@ -23,31 +23,31 @@ package servicebus
 //	SOFTWARE
 
 import (
-	"bytes"
 	"context"
 	"encoding/xml"
-	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-amqp-common-go/auth"
-	"github.com/Azure/azure-amqp-common-go/log"
+
+	"github.com/Azure/azure-service-bus-go/atom"
 )
 
 const (
-	serviceBusSchema = "http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"
-	atomSchema       = "http://www.w3.org/2005/Atom"
-	applicationXML   = "application/xml"
+	serviceBusSchema = atom.ServiceBusSchema
+	atomSchema       = atom.Schema
+	applicationXML   = atom.ApplicationXML
 )
 
 type (
 	// entityManager provides CRUD functionality for Service Bus entities (Queues, Topics, Subscriptions...)
 	entityManager struct {
-		TokenProvider auth.TokenProvider
-		Host          string
+		*atom.EntityManager
+		namespace *Namespace
 	}
 
 	// BaseEntityDescription provides common fields which are part of Queues, Topics and Subscriptions
@@ -56,10 +56,12 @@ type (
 		ServiceBusSchema       *string `xml:"xmlns,attr,omitempty"`
 	}
 
-	managementError struct {
-		XMLName xml.Name `xml:"Error"`
-		Code    int      `xml:"Code"`
-		Detail  string   `xml:"Detail"`
+	// RawXMLElement is an element of an entity description which this library does not model, kept verbatim so that
+	// properties introduced by newer versions of the service are not erased when the entity is updated
+	RawXMLElement struct {
+		XMLName xml.Name
+		Attrs   []xml.Attr `xml:",any,attr"`
+		Content []byte     `xml:",innerxml"`
 	}
 
 	// CountDetails has current active (and other) messages for queue/topic.
@@ -97,116 +99,115 @@ const (
 	Unknown EntityStatus = "Unknown"
 )
 
-func (m *managementError) String() string {
-	return fmt.Sprintf("Code: %d, Details: %s", m.Code, m.Detail)
-}
-
 // newEntityManager creates a new instance of an entityManager given a token provider and host
 func newEntityManager(host string, tokenProvider auth.TokenProvider) *entityManager {
 	return &entityManager{
-		Host:          host,
-		TokenProvider: tokenProvider,
+		EntityManager: atom.NewEntityManager(host, tokenProvider),
 	}
 }
 
-// Get performs an HTTP Get for a given entity path
-func (em *entityManager) Get(ctx context.Context, entityPath string) (*http.Response, error) {
-	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Get")
-	defer span.Finish()
-
-	return em.Execute(ctx, http.MethodGet, entityPath, http.NoBody)
+// newEntityManager creates an entityManager for the namespace, which traces its requests with the namespace's Tracer and
+// retries them under its management RetryPolicy
+func (ns *Namespace) newEntityManager() *entityManager {
+	em := newEntityManager(ns.getHTTPSHostURI(), ns.TokenProvider)
+	em.namespace = ns
+	em.EntityManager.StartSpan = func(ctx context.Context, operationName string) (atom.Span, context.Context) {
+		return em.startSpanFromContext(ctx, operationName)
+	}
+	em.EntityManager.Retry = ns.retryManagement
+	return em
 }
 
-// Put performs an HTTP PUT for a given entity path and body
-func (em *entityManager) Put(ctx context.Context, entityPath string, body []byte) (*http.Response, error) {
-	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Put")
-	defer span.Finish()
-
-	return em.Execute(ctx, http.MethodPut, entityPath, bytes.NewReader(body))
+// NewEntityManager creates an atom.EntityManager for the Namespace which can be used to call ATOM management operations
+// not covered by the Queue, Topic and Subscription managers
+func (ns *Namespace) NewEntityManager() *atom.EntityManager {
+	return ns.newEntityManager().EntityManager
 }
 
-// Delete performs an HTTP DELETE for a given entity path
-func (em *entityManager) Delete(ctx context.Context, entityPath string) (*http.Response, error) {
-	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Delete")
-	defer span.Finish()
-
-	return em.Execute(ctx, http.MethodDelete, entityPath, http.NoBody)
+func isEmptyFeed(b []byte) bool {
+	var emptyFeed queueFeed
+	feedErr := xml.Unmarshal(b, &emptyFeed)
+	return feedErr == nil && emptyFeed.Title == "Publicly Listed Services"
 }
 
-// Post performs an HTTP POST for a given entity path and body
-func (em *entityManager) Post(ctx context.Context, entityPath string, body []byte) (*http.Response, error) {
-	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Post")
-	defer span.Finish()
-
-	return em.Execute(ctx, http.MethodPost, entityPath, bytes.NewReader(body))
+func xmlDoc(content []byte) []byte {
+	return []byte(xml.Header + string(content))
 }
 
-// Execute performs an HTTP request given a http method, path and body
-func (em *entityManager) Execute(ctx context.Context, method string, entityPath string, body io.Reader) (*http.Response, error) {
-	span, ctx := em.startSpanFromContext(ctx, "sb.EntityManger.Execute")
-	defer span.Finish()
+// UnmarshalXML captures the element, leaving out the namespace declarations on it, which are declared again as needed
+// when the element is marshaled
+func (r *RawXMLElement) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type raw RawXMLElement
+	var el raw
+	if err := d.DecodeElement(&el, &start); err != nil {
+		return err
+	}
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
+	var attrs []xml.Attr
+	for _, attr := range el.Attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		attrs = append(attrs, attr)
 	}
-	req, err := http.NewRequest(method, em.Host+strings.TrimPrefix(entityPath, "/"), body)
-	if err != nil {
-		log.For(ctx).Error(err)
-		return nil, err
+	el.Attrs = attrs
+	*r = RawXMLElement(el)
+	return nil
+}
+
+// marshalInSchemaOrder writes the modeled fields of the description together with its extensions, each at the place the
+// schema lists it. The service reads the elements of a description in schema order and ignores any which are out of
+// place, so an extension written after the modeled fields would be lost. Elements the schema does not list go last.
+func marshalInSchemaOrder(e *xml.Encoder, start xml.StartElement, base BaseEntityDescription, description interface{}, extensions []RawXMLElement, schema []string) error {
+	type element struct {
+		start xml.StartElement
+		value interface{}
 	}
 
-	req = addAtomXMLContentType(req)
-	req = addAPIVersion201704(req)
-	applyRequestInfo(span, req)
-	req, err = em.addAuthorization(req)
-	if err != nil {
-		log.For(ctx).Error(err)
-		return nil, err
+	var elements []element
+	v := reflect.ValueOf(description)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := strings.Split(field.Tag.Get("xml"), ",")
+		if field.Anonymous || field.Name == "XMLName" || tag[0] == "" || tag[0] == "-" || v.Field(i).IsZero() {
+			continue
+		}
+		elements = append(elements, element{
+			start: xml.StartElement{Name: xml.Name{Local: tag[0]}},
+			value: v.Field(i).Interface(),
+		})
 	}
-
-	req = req.WithContext(ctx)
-	res, err := client.Do(req)
-
-	applyResponseInfo(span, res)
-	if err != nil {
-		log.For(ctx).Error(err)
+	for _, extension := range extensions {
+		elements = append(elements, element{start: xml.StartElement{Name: extension.XMLName}, value: extension})
 	}
 
-	return res, err
-}
-
-func isEmptyFeed(b []byte) bool {
-	var emptyFeed queueFeed
-	feedErr := xml.Unmarshal(b, &emptyFeed)
-	return feedErr == nil && emptyFeed.Title == "Publicly Listed Services"
-}
-
-func (em *entityManager) addAuthorization(req *http.Request) (*http.Request, error) {
-	signature, err := em.TokenProvider.GetToken(req.URL.String())
-	if err != nil {
-		return nil, err
+	position := func(el element) int {
+		for i, name := range schema {
+			if name == el.start.Name.Local {
+				return i
+			}
+		}
+		return len(schema)
 	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		return position(elements[i]) < position(elements[j])
+	})
 
-	req.Header.Add("Authorization", signature.Token)
-	return req, nil
-}
-
-func addAtomXMLContentType(req *http.Request) *http.Request {
-	if req.Method != http.MethodGet && req.Method != http.MethodHead {
-		req.Header.Add("content-Type", "application/atom+xml;type=entry;charset=utf-8")
+	if base.InstanceMetadataSchema != nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:i"}, Value: *base.InstanceMetadataSchema})
 	}
-	return req
-}
-
-func addAPIVersion201704(req *http.Request) *http.Request {
-	q := req.URL.Query()
-	q.Add("api-version", "2017-04")
-	req.URL.RawQuery = q.Encode()
-	return req
-}
-
-func xmlDoc(content []byte) []byte {
-	return []byte(xml.Header + string(content))
+	if base.ServiceBusSchema != nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: *base.ServiceBusSchema})
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, el := range elements {
+		if err := e.EncodeElement(el.value, el.start); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
 }
 
 // ptrBool takes a boolean and returns a pointer to that bool. For use in literal pointers, ptrBool(true) -> *bool
@@ -225,12 +226,16 @@ func durationTo8601Seconds(duration time.Duration) string {
 	return fmt.Sprintf("PT%dS", duration/time.Second)
 }
 
-func formatManagementError(body []byte) error {
-	var mgmtError managementError
-	unmarshalErr := xml.Unmarshal(body, &mgmtError)
-	if unmarshalErr != nil {
-		return errors.New(string(body))
-	}
+// formatManagementError builds an error from a failed management response and its body, recording the status code and
+// client request ID so the failure can be found in the service's logs
+func formatManagementError(res *http.Response, body []byte) error {
+	return atom.NewManagementError(res, body)
+}
 
-	return fmt.Errorf("error code: %d, Details: %s", mgmtError.Code, mgmtError.Detail)
+// checkDeleteResponse returns an error describing a failed delete. Deleting an entity which does not exist succeeds.
+func checkDeleteResponse(res *http.Response) error {
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return atom.CheckResponse(res)
 }
@@ -23,11 +23,18 @@ package servicebus
 //	SOFTWARE
 
 import (
+	"context"
 	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
 	"time"
 
 	"github.com/Azure/azure-service-bus-go/atom"
 	"github.com/Azure/go-autorest/autorest/date"
+	"github.com/stretchr/testify/assert"
 )
 
 func (suite *serviceBusSuite) TestFeedUnmarshal() {
@@ -62,3 +69,139 @@ func (suite *serviceBusSuite) TestEntryUnmarshal() {
 		suite.Contains(entry.Content.Body, item)
 	}
 }
+
+func TestDeadLetteringOnMessageExpirationSerialization(t *testing.T) {
+	const want = "<DeadLetteringOnMessageExpiration>true</DeadLetteringOnMessageExpiration>"
+
+	qd := new(QueueDescription)
+	if assert.NoError(t, QueueEntityWithDeadLetteringOnMessageExpiration()(qd)) {
+		b, err := xml.Marshal(qd)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), want)
+	}
+
+	sd := new(SubscriptionDescription)
+	if assert.NoError(t, SubscriptionWithDeadLetteringOnMessageExpiration()(sd)) {
+		b, err := xml.Marshal(sd)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), want)
+	}
+}
+
+func TestQueueManager_DeleteReturnsManagementErrors(t *testing.T) {
+	var requestID string
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get(atom.ClientRequestIDHeader)
+		w.WriteHeader(status)
+		if status == http.StatusUnauthorized {
+			_, _ = w.Write([]byte(`<Error><Code>401</Code><Detail>InvalidSignature. TrackingId:abc</Detail></Error>`))
+		}
+	}))
+	defer server.Close()
+
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	qm := ns.NewQueueManager()
+	qm.Host, qm.TokenProvider = server.URL+"/", staticTokenProvider("token")
+
+	err = qm.Delete(context.Background(), "orders")
+	assert.NotEmpty(t, requestID)
+	if assert.IsType(t, &atom.ManagementError{}, err) {
+		mgmtErr := err.(*atom.ManagementError)
+		assert.Equal(t, http.StatusUnauthorized, mgmtErr.StatusCode)
+		assert.Equal(t, "InvalidSignature. TrackingId:abc", mgmtErr.Detail)
+		assert.Equal(t, requestID, mgmtErr.RequestID)
+		assert.Contains(t, err.Error(), requestID)
+	}
+
+	status = http.StatusNotFound
+	assert.NoError(t, qm.Delete(context.Background(), "orders"))
+}
+
+func TestQueueManager_TracesRequestsWithNamespaceTracer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tracer := new(recordingTracer)
+	ns, err := NewNamespace(NamespaceWithTracer(tracer))
+	if !assert.NoError(t, err) {
+		return
+	}
+	qm := ns.NewQueueManager()
+	qm.Host, qm.TokenProvider = server.URL+"/", staticTokenProvider("token")
+
+	qe, err := qm.Get(context.Background(), "orders")
+	assert.NoError(t, err)
+	assert.Nil(t, qe)
+
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+		assert.True(t, span.ended, span.name)
+	}
+	assert.Equal(t, []string{"sb.QueueManager.Get", "sb.EntityManger.Get", "sb.EntityManger.Execute"}, names)
+	if assert.Len(t, tracer.spans, 3) {
+		execute := tracer.spans[2].attributes
+		assert.NotEmpty(t, execute["http.request_id"])
+		assert.Equal(t, uint16(http.StatusNotFound), execute["http.status_code"])
+	}
+}
+
+func TestTopicAndSubscriptionManager_UpdatePreservesExtensions(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "*", r.Header.Get("If-Match"), "updates must not be rejected as creating an existing entity")
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		_, _ = w.Write([]byte(atomEntry("entity", `<TopicDescription></TopicDescription>`)))
+	}))
+	defer server.Close()
+
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	tm := ns.NewTopicManager()
+	tm.Host, tm.TokenProvider = server.URL+"/", staticTokenProvider("token")
+	sm, err := ns.NewSubscriptionManager("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+	sm.Host, sm.TokenProvider = server.URL+"/", staticTokenProvider("token")
+
+	ttl := time.Hour
+	idle := ptrString("PT1H")
+	extension := RawXMLElement{XMLName: xml.Name{Local: "UserMetadata"}, Content: []byte("owned by billing")}
+	te := &TopicEntity{Name: "orders", TopicDescription: &TopicDescription{
+		AutoDeleteOnIdle: idle,
+		Extensions:       []RawXMLElement{extension},
+	}}
+	_, err = tm.Update(context.Background(), te, TopicWithMessageTimeToLive(&ttl))
+	assert.NoError(t, err)
+	assert.Nil(t, te.DefaultMessageTimeToLive, "the entity passed to Update is left unchanged")
+
+	se := &SubscriptionEntity{Name: "audit", SubscriptionDescription: &SubscriptionDescription{
+		AutoDeleteOnIdle: idle,
+		Extensions:       []RawXMLElement{extension},
+	}}
+	_, err = sm.Update(context.Background(), se, SubscriptionWithMessageTimeToLive(&ttl))
+	assert.NoError(t, err)
+
+	if assert.Len(t, bodies, 2) {
+		for _, body := range bodies {
+			assert.Contains(t, body, "<DefaultMessageTimeToLive>PT3600S</DefaultMessageTimeToLive>")
+			assert.Contains(t, body, "<UserMetadata>owned by billing</UserMetadata>")
+			// the service ignores elements out of schema order, so the extension goes before AutoDeleteOnIdle
+			assert.True(t, strings.Index(body, "<UserMetadata>") < strings.Index(body, "<AutoDeleteOnIdle>"), body)
+		}
+	}
+
+	_, err = tm.Update(context.Background(), &TopicEntity{Name: "orders"})
+	assert.Error(t, err)
+}
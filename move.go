@@ -0,0 +1,284 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+// moveIdleTimeout is how long MoveMessages waits for the next message before deciding the source is drained
+const moveIdleTimeout = 10 * time.Second
+
+type (
+	// MessageReceiver is an entity messages can be received from, such as a Queue or Subscription
+	MessageReceiver interface {
+		Receive(ctx context.Context, handler Handler, opts ...ReceiveOption) error
+	}
+
+	// MessageSender is an entity messages can be sent to, such as a Queue or Topic
+	MessageSender interface {
+		Send(ctx context.Context, msg *Message) error
+	}
+
+	// MoveFilter selects the messages MoveMessages moves and may transform them. It returns the message to send to the
+	// destination and whether the message should be moved at all; messages which are not moved stay in the source.
+	MoveFilter func(msg *Message) (*Message, bool)
+
+	// mover tracks the progress of a MoveMessages call
+	mover struct {
+		mu       sync.Mutex
+		dst      MessageSender
+		filter   MoveFilter
+		count    int
+		moved    int
+		err      error
+		skipped  map[string]bool
+		held     map[string]*Message
+		release  func(ctx context.Context, msg *Message)
+		stopped  bool
+		activity chan struct{}
+		cancel   context.CancelFunc
+		once     sync.Once
+	}
+)
+
+// MoveMessages moves up to count messages from src to dst, for example to migrate messages between queues. Each
+// message is received, passed through the filter (if any), sent to dst and only then completed in src, so a failure
+// part way through never loses a message. The message ID is preserved, so enabling duplicate detection on dst
+// discards a message which was sent again because its completion failed. src must receive in PeekLock mode.
+//
+// Messages the filter rejects are held, locked, so the source keeps delivering the messages behind them, and are
+// released once the move ends. A source whose lock duration is shorter than the move may redeliver a held message;
+// it is held again without counting as progress. MoveMessages returns once count messages have been moved, once no
+// new messages arrive within 10 seconds, or on the first error. The number of messages moved is returned in every
+// case.
+func (ns *Namespace) MoveMessages(ctx context.Context, src MessageReceiver, dst MessageSender, count int, filter MoveFilter) (int, error) {
+	span, ctx := ns.startSpanFromContext(ctx, "sb.Namespace.MoveMessages")
+	defer span.End()
+
+	if count < 1 {
+		return 0, errors.New("count must be at least 1")
+	}
+
+	return ns.move(ctx, src, &mover{
+		dst:     dst,
+		filter:  filter,
+		count:   count,
+		release: releaseHeld,
+	})
+}
+
+// move runs the mover against the source until it is done
+func (ns *Namespace) move(ctx context.Context, src MessageReceiver, m *mover) (int, error) {
+	moveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m.skipped = make(map[string]bool)
+	m.held = make(map[string]*Message)
+	m.activity = make(chan struct{}, 1)
+	m.cancel = cancel
+
+	go func() {
+		for {
+			select {
+			case <-moveCtx.Done():
+				return
+			case <-m.activity:
+			case <-ns.getClock().After(moveIdleTimeout):
+				log.For(ctx).Debug("no messages left to move")
+				m.stop(ctx)
+				return
+			}
+		}
+	}()
+
+	err := src.Receive(moveCtx, HandlerFunc(m.handle))
+	// the source stops on its own if the caller's context is done, in which case the held messages are released here
+	m.stop(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.moved, m.err
+	}
+	if ctx.Err() != nil {
+		return m.moved, ctx.Err()
+	}
+	if err != nil && err != context.Canceled {
+		return m.moved, err
+	}
+	return m.moved, nil
+}
+
+func (m *mover) handle(ctx context.Context, msg *Message) DispositionAction {
+	m.mu.Lock()
+	done := m.stopped || m.err != nil || m.moved >= m.count
+	m.mu.Unlock()
+	if done {
+		return func(ctx context.Context) {
+			m.release(ctx, msg)
+		}
+	}
+
+	out, ok := msg, true
+	if m.filter != nil {
+		out, ok = m.filter(msg)
+	}
+
+	if !ok || out == nil {
+		key := moveKey(msg)
+		m.mu.Lock()
+		if m.stopped {
+			m.mu.Unlock()
+			return func(ctx context.Context) {
+				m.release(ctx, msg)
+			}
+		}
+		seen := m.skipped[key]
+		m.skipped[key] = true
+		// a redelivered message replaces the one whose lock expired
+		m.held[key] = msg
+		m.mu.Unlock()
+		if !seen {
+			m.active()
+		}
+		// the message is held rather than abandoned, which would put it back at the head of the source
+		return func(context.Context) {}
+	}
+	m.active()
+
+	if err := m.dst.Send(ctx, copyForMove(out)); err != nil {
+		m.fail(ctx, err)
+		return msg.Abandon()
+	}
+
+	return func(ctx context.Context) {
+		span, ctx := msg.startSpanFromContext(ctx, "sb.Message.Complete")
+		defer span.End()
+
+		if err := msg.settle(ctx, OutcomeCompleted, func() error {
+			return msg.accept(ctx)
+		}); err != nil {
+			m.fail(ctx, err)
+			return
+		}
+
+		m.mu.Lock()
+		m.moved++
+		moved := m.moved
+		m.mu.Unlock()
+		if moved >= m.count {
+			m.stop(ctx)
+		}
+	}
+}
+
+// active tells the idle timer a new message arrived
+func (m *mover) active() {
+	select {
+	case m.activity <- struct{}{}:
+	default:
+	}
+}
+
+func (m *mover) fail(ctx context.Context, err error) {
+	m.mu.Lock()
+	if m.err == nil {
+		m.err = err
+	}
+	m.mu.Unlock()
+	m.stop(ctx)
+}
+
+// stop releases the messages held back from the move, while the source's link is still open, and ends the move
+func (m *mover) stop(ctx context.Context) {
+	m.once.Do(func() {
+		m.mu.Lock()
+		held := m.held
+		m.held = nil
+		m.stopped = true
+		m.mu.Unlock()
+
+		ctx = context.WithoutCancel(ctx)
+		for _, msg := range held {
+			m.release(ctx, msg)
+		}
+		m.cancel()
+	})
+}
+
+// releaseHeld hands a message the filter rejected back to the source
+func releaseHeld(ctx context.Context, msg *Message) {
+	msg.Release()(ctx)
+}
+
+// moveKey identifies a message across redeliveries
+func moveKey(msg *Message) string {
+	if msg.SystemProperties != nil && msg.SystemProperties.SequenceNumber != nil {
+		return fmt.Sprintf("seq:%d", *msg.SystemProperties.SequenceNumber)
+	}
+	return "id:" + msg.ID
+}
+
+// copyForMove builds a new message with the content and properties of msg, including the partition keys and scheduled
+// enqueue time, but none of the broker assigned state of the delivery it was received in
+func copyForMove(msg *Message) *Message {
+	moved := &Message{
+		ContentType:    msg.ContentType,
+		CorrelationID:  msg.CorrelationID,
+		Data:           msg.Data,
+		GroupID:        msg.GroupID,
+		GroupSequence:  msg.GroupSequence,
+		ID:             msg.ID,
+		Label:          msg.Label,
+		ReplyTo:        msg.ReplyTo,
+		ReplyToGroupID: msg.ReplyToGroupID,
+		To:             msg.To,
+		TTL:            msg.TTL,
+		Value:          msg.Value,
+		Footer:         msg.Footer,
+	}
+
+	if sp := msg.SystemProperties; sp != nil && (sp.PartitionKey != nil || sp.ViaPartitionKey != nil || sp.ScheduledEnqueueTime != nil) {
+		// only the properties a sender may set are carried across
+		moved.SystemProperties = &SystemProperties{
+			PartitionKey:         sp.PartitionKey,
+			ViaPartitionKey:      sp.ViaPartitionKey,
+			ScheduledEnqueueTime: sp.ScheduledEnqueueTime,
+		}
+	}
+
+	if len(msg.UserProperties) > 0 {
+		moved.UserProperties = make(map[string]interface{}, len(msg.UserProperties))
+		for key, val := range msg.UserProperties {
+			moved.UserProperties[key] = val
+		}
+	}
+	return moved
+}
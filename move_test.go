@@ -0,0 +1,206 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// replayReceiver hands the same messages to the handler until the context is done, without settling them
+	replayReceiver struct {
+		messages []*Message
+	}
+
+	// onceReceiver hands each message to the handler once, then waits for the context to be done
+	onceReceiver struct {
+		mu       sync.Mutex
+		messages []*Message
+		done     bool
+	}
+
+	recordingSender struct {
+		sent []*Message
+		err  error
+	}
+)
+
+func (r *replayReceiver) Receive(ctx context.Context, handler Handler, _ ...ReceiveOption) error {
+	for {
+		for _, msg := range r.messages {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			handler.Handle(ctx, msg)
+		}
+	}
+}
+
+func (r *onceReceiver) Receive(ctx context.Context, handler Handler, _ ...ReceiveOption) error {
+	for _, msg := range r.messages {
+		handler.Handle(ctx, msg)
+	}
+	r.mu.Lock()
+	r.done = true
+	r.mu.Unlock()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *onceReceiver) delivered() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+func (s *recordingSender) Send(_ context.Context, msg *Message) error {
+	s.sent = append(s.sent, msg)
+	return s.err
+}
+
+// newTestMover creates a mover which records the messages it releases rather than settling them
+func newTestMover(dst MessageSender, count int, filter MoveFilter) (*mover, *[]string) {
+	var mu sync.Mutex
+	released := new([]string)
+	return &mover{
+		dst:    dst,
+		filter: filter,
+		count:  count,
+		release: func(_ context.Context, msg *Message) {
+			mu.Lock()
+			*released = append(*released, msg.ID)
+			mu.Unlock()
+		},
+	}, released
+}
+
+// advanceUntilDone moves the clock past the idle timeout until the move returns
+func advanceUntilDone(clock *fakeClock, done <-chan error) error {
+	timeout := time.After(5 * time.Second)
+	for {
+		clock.Advance(moveIdleTimeout)
+		select {
+		case err := <-done:
+			return err
+		case <-timeout:
+			return errors.New("timed out")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestNamespace_MoveHoldsMessagesTheFilterRejects(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the source keeps redelivering the rejected messages, as it would once their locks expired
+	src := &replayReceiver{messages: []*Message{NewMessageFromString("a"), NewMessageFromString("b")}}
+	src.messages[0].ID, src.messages[1].ID = "a", "b"
+	dst := new(recordingSender)
+	m, released := newTestMover(dst, 10, func(*Message) (*Message, bool) {
+		return nil, false
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		moved, err := ns.move(context.Background(), src, m)
+		assert.Equal(t, 0, moved)
+		done <- err
+	}()
+
+	// redeliveries of held messages are not progress, so the move ends once no new message arrives
+	clock.waitForCalls(1)
+	assert.NoError(t, advanceUntilDone(clock, done), "the move did not end once no new messages arrived")
+	assert.Empty(t, dst.sent)
+	assert.ElementsMatch(t, []string{"a", "b"}, *released, "each held message is released once")
+}
+
+func TestNamespace_MoveMovesMessagesBehindRejectedOnes(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	skip, keep := NewMessageFromString("skip"), NewMessageFromString("keep")
+	skip.ID, keep.ID = "skip", "keep"
+	src := &onceReceiver{messages: []*Message{skip, keep}}
+	dst := new(recordingSender)
+	m, released := newTestMover(dst, 10, func(msg *Message) (*Message, bool) {
+		return msg, msg.ID == "keep"
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ns.move(context.Background(), src, m)
+		done <- err
+	}()
+
+	for !src.delivered() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, advanceUntilDone(clock, done), "the move did not end once no new messages arrived")
+	if assert.Len(t, dst.sent, 1) {
+		assert.Equal(t, "keep", dst.sent[0].ID)
+	}
+	assert.Equal(t, []string{"skip"}, *released)
+}
+
+func TestNamespace_MoveMessagesReturnsSendErrors(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sendErr := errors.New("destination unavailable")
+	src := &replayReceiver{messages: []*Message{NewMessageFromString("a")}}
+	dst := &recordingSender{err: sendErr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	moved, err := ns.MoveMessages(ctx, src, dst, 1, nil)
+	assert.Equal(t, sendErr, err)
+	assert.Equal(t, 0, moved)
+	assert.Len(t, dst.sent, 1)
+}
+
+func TestCopyForMove(t *testing.T) {
+	var seq int64 = 42
+	group := "group"
+	msg := NewMessageFromString("payload")
+	msg.ID = "id"
+	msg.GroupID = &group
+	msg.UserProperties = map[string]interface{}{"key": "value"}
+	msg.SystemProperties = &SystemProperties{SequenceNumber: &seq}
+	msg.DeliveryCount = 3
+
+	moved := copyForMove(msg)
+	assert.Equal(t, "payload", string(moved.Data))
+	assert.Equal(t, "id", moved.ID)
+	assert.Equal(t, &group, moved.GroupID)
+	assert.Equal(t, msg.UserProperties, moved.UserProperties)
+	assert.Nil(t, moved.SystemProperties)
+	assert.Nil(t, moved.LockToken)
+	assert.Zero(t, moved.DeliveryCount)
+
+	assert.Equal(t, "seq:42", moveKey(msg))
+	assert.Equal(t, "id:id", moveKey(moved))
+
+	key := "tenant"
+	at := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	msg.SystemProperties.PartitionKey = &key
+	msg.SystemProperties.ScheduledEnqueueTime = &at
+	moved = copyForMove(msg)
+	if assert.NotNil(t, moved.SystemProperties) {
+		assert.Equal(t, &key, moved.SystemProperties.PartitionKey)
+		assert.Equal(t, &at, moved.SystemProperties.ScheduledEnqueueTime)
+		assert.Nil(t, moved.SystemProperties.SequenceNumber)
+	}
+}
@@ -0,0 +1,844 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// MsgpackCodec encodes values as MessagePack. Structs are encoded as maps keyed by field name, which a msgpack
+	// struct tag can change, with the same options as encoding/json tags: "-" leaves a field out and omitempty leaves
+	// it out when empty. Anonymous struct fields are inlined. time.Time is encoded with the timestamp extension.
+	// Decoding into an empty interface produces map[string]interface{}, for maps keyed by strings, []interface{},
+	// int64, uint64, float64, string, []byte, bool, time.Time or nil; maps with other keys must be decoded into a
+	// map of a matching key type.
+	MsgpackCodec struct{}
+
+	// msgpackPair is a key and value of a decoded map, in the order they were encoded
+	msgpackPair struct {
+		key, value interface{}
+	}
+
+	// msgpackMap is a decoded map, kept as pairs until the type it is decoded into is known
+	msgpackMap []msgpackPair
+
+	msgpackField struct {
+		name      string
+		index     []int
+		omitEmpty bool
+	}
+
+	msgpackDecoder struct {
+		data []byte
+		pos  int
+	}
+)
+
+// msgpackTimestampType is the extension type MessagePack reserves for timestamps
+const msgpackTimestampType = -1
+
+var (
+	errMsgpackTruncated = errors.New("msgpack: data ends in the middle of a value")
+	msgpackFields       sync.Map // reflect.Type -> []msgpackField
+)
+
+// ContentType returns application/msgpack
+func (MsgpackCodec) ContentType() string {
+	return MsgpackContentType
+}
+
+// Encode serializes v as MessagePack
+func (MsgpackCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode deserializes MessagePack data into v, which must be a non-nil pointer
+func (MsgpackCodec) Decode(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: cannot decode into %T, a non-nil pointer is required", v)
+	}
+
+	d := &msgpackDecoder{data: data}
+	decoded, err := d.value()
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return errors.New("msgpack: unexpected data after the value")
+	}
+	return assignMsgpack(decoded, rv.Elem())
+}
+
+func encodeMsgpack(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		return encodeMsgpackTime(buf, v.Interface().(time.Time))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		return encodeMsgpack(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		encodeMsgpackUint(buf, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		writeBigEndian(buf, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		buf.WriteByte(0xcb)
+		writeBigEndian(buf, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		encodeMsgpackString(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			encodeMsgpackBinary(buf, v.Bytes())
+			return nil
+		}
+		return encodeMsgpackArray(buf, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			encodeMsgpackBinary(buf, b)
+			return nil
+		}
+		return encodeMsgpackArray(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		return encodeMsgpackMap(buf, v)
+	case reflect.Struct:
+		return encodeMsgpackStruct(buf, v)
+	default:
+		return fmt.Errorf("msgpack: cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+func encodeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		encodeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		writeBigEndian(buf, uint64(uint16(int16(i))), 2)
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		writeBigEndian(buf, uint64(uint32(int32(i))), 4)
+	default:
+		buf.WriteByte(0xd3)
+		writeBigEndian(buf, uint64(i), 8)
+	}
+}
+
+func encodeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		writeBigEndian(buf, u, 2)
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		writeBigEndian(buf, u, 4)
+	default:
+		buf.WriteByte(0xcf)
+		writeBigEndian(buf, u, 8)
+	}
+}
+
+func encodeMsgpackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(0xdb)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+	buf.WriteString(s)
+}
+
+func encodeMsgpackBinary(buf *bytes.Buffer, b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(0xc6)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+	buf.Write(b)
+}
+
+func encodeMsgpackArrayHeader(buf *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xdc)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(0xdd)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+}
+
+func encodeMsgpackMapHeader(buf *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xde)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(0xdf)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+}
+
+func encodeMsgpackArray(buf *bytes.Buffer, v reflect.Value) error {
+	encodeMsgpackArrayHeader(buf, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := encodeMsgpack(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMsgpackMap encodes the entries of the map ordered by their encoded keys, so equal maps encode identically
+func encodeMsgpackMap(buf *bytes.Buffer, v reflect.Value) error {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var key bytes.Buffer
+		if err := encodeMsgpack(&key, iter.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: key.Bytes(), value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	encodeMsgpackMapHeader(buf, len(entries))
+	for _, e := range entries {
+		buf.Write(e.key)
+		if err := encodeMsgpack(buf, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeMsgpackStruct(buf *bytes.Buffer, v reflect.Value) error {
+	fields := msgpackFieldsOf(v.Type())
+	values := make([]reflect.Value, 0, len(fields))
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		names = append(names, f.name)
+		values = append(values, fv)
+	}
+
+	encodeMsgpackMapHeader(buf, len(values))
+	for i := range values {
+		encodeMsgpackString(buf, names[i])
+		if err := encodeMsgpack(buf, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMsgpackTime encodes t with the timestamp extension, in the smallest of its three formats which can hold it
+func encodeMsgpackTime(buf *bytes.Buffer, t time.Time) error {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		buf.Write([]byte{0xd6, 0xff})
+		writeBigEndian(buf, uint64(sec), 4)
+	case sec >= 0 && sec>>34 == 0:
+		buf.Write([]byte{0xd7, 0xff})
+		writeBigEndian(buf, nsec<<34|uint64(sec), 8)
+	default:
+		buf.Write([]byte{0xc7, 12, 0xff})
+		writeBigEndian(buf, nsec, 4)
+		writeBigEndian(buf, uint64(sec), 8)
+	}
+	return nil
+}
+
+func writeBigEndian(buf *bytes.Buffer, u uint64, size int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], u)
+	buf.Write(b[8-size:])
+}
+
+// msgpackFieldsOf lists the fields of the struct type which are encoded, inlining anonymous struct fields
+func msgpackFieldsOf(t reflect.Type) []msgpackField {
+	if cached, ok := msgpackFields.Load(t); ok {
+		return cached.([]msgpackField)
+	}
+
+	var fields []msgpackField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			for _, inner := range msgpackFieldsOf(ft) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	msgpackFields.Store(t, fields)
+	return fields
+}
+
+// fieldByIndex returns the field at the index, reporting false if it is reached through a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// value decodes the next value into nil, bool, int64, uint64, float64, string, []byte, time.Time, []interface{} or
+// msgpackMap
+func (d *msgpackDecoder) value() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), raw...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return u, nil
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n))
+	default:
+		return nil, fmt.Errorf("msgpack: 0x%x does not start a value", c)
+	}
+}
+
+func (d *msgpackDecoder) str(n int) (string, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+func (d *msgpackDecoder) arrayOf(n int) ([]interface{}, error) {
+	// each element takes at least a byte, which bounds what a corrupt length can allocate
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+	arr := make([]interface{}, n)
+	for i := range arr {
+		var err error
+		if arr[i], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return arr, nil
+}
+
+func (d *msgpackDecoder) mapOf(n int) (msgpackMap, error) {
+	if 2*n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+	m := make(msgpackMap, n)
+	for i := range m {
+		var err error
+		if m[i].key, err = d.value(); err != nil {
+			return nil, err
+		}
+		if m[i].value, err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ext decodes an extension value with n bytes of data. Only timestamps are understood.
+func (d *msgpackDecoder) ext(n int) (interface{}, error) {
+	typ, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != msgpackTimestampType {
+		return nil, fmt.Errorf("msgpack: extension type %d is not supported", int8(typ[0]))
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	default:
+		return nil, fmt.Errorf("msgpack: a timestamp cannot be %d bytes", n)
+	}
+}
+
+// assignMsgpack stores the decoded value in v, converting it to the type of v
+func assignMsgpack(decoded interface{}, v reflect.Value) error {
+	if decoded == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignMsgpack(decoded, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		generic, err := genericMsgpack(decoded)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(generic))
+		return nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("msgpack: cannot decode %T into %s", decoded, v.Type())
+	}
+
+	if v.Type() == timeType {
+		t, ok := decoded.(time.Time)
+		if !ok {
+			return mismatch()
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := decoded.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := decoded.(type) {
+		case int64:
+			i = n
+		default:
+			return mismatch()
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := decoded.(type) {
+		case uint64:
+			u = n
+		case int64:
+			if n < 0 {
+				return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+			}
+			u = uint64(n)
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch n := decoded.(type) {
+		case float64:
+			v.SetFloat(n)
+		case int64:
+			v.SetFloat(float64(n))
+		case uint64:
+			v.SetFloat(float64(n))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		switch s := decoded.(type) {
+		case string:
+			v.SetString(s)
+		case []byte:
+			v.SetString(string(s))
+		default:
+			return mismatch()
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch b := decoded.(type) {
+			case []byte:
+				v.SetBytes(b)
+				return nil
+			case string:
+				v.SetBytes([]byte(b))
+				return nil
+			}
+		}
+		arr, ok := decoded.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, elem := range arr {
+			if err := assignMsgpack(elem, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		if b, ok := decoded.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			if len(b) != v.Len() {
+				return fmt.Errorf("msgpack: cannot decode %d bytes into %s", len(b), v.Type())
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		arr, ok := decoded.([]interface{})
+		if !ok || len(arr) != v.Len() {
+			return mismatch()
+		}
+		for i, elem := range arr {
+			if err := assignMsgpack(elem, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := decoded.(msgpackMap)
+		if !ok {
+			return mismatch()
+		}
+		out := reflect.MakeMapWithSize(v.Type(), len(m))
+		for _, pair := range m {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := assignMsgpack(pair.key, key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := assignMsgpack(pair.value, value); err != nil {
+				return err
+			}
+			out.SetMapIndex(key, value)
+		}
+		v.Set(out)
+	case reflect.Struct:
+		m, ok := decoded.(msgpackMap)
+		if !ok {
+			return mismatch()
+		}
+		return assignMsgpackStruct(m, v)
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// assignMsgpackStruct sets the fields of the struct from the map, matching keys to field names exactly or, failing
+// that, ignoring case. Keys without a field are skipped.
+func assignMsgpackStruct(m msgpackMap, v reflect.Value) error {
+	fields := msgpackFieldsOf(v.Type())
+	for _, pair := range m {
+		name, ok := pair.key.(string)
+		if !ok {
+			continue
+		}
+
+		var field *msgpackField
+		for i := range fields {
+			if fields[i].name == name {
+				field = &fields[i]
+				break
+			}
+			if field == nil && strings.EqualFold(fields[i].name, name) {
+				field = &fields[i]
+			}
+		}
+		if field == nil {
+			continue
+		}
+
+		fv := v
+		for i, x := range field.index {
+			if i > 0 && fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(x)
+		}
+		if err := assignMsgpack(pair.value, fv); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// genericMsgpack converts the decoded value to the types it has when decoded into an empty interface
+func genericMsgpack(decoded interface{}) (interface{}, error) {
+	switch t := decoded.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, elem := range t {
+			var err error
+			if out[i], err = genericMsgpack(elem); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case msgpackMap:
+		out := make(map[string]interface{}, len(t))
+		for _, pair := range t {
+			key, ok := pair.key.(string)
+			if !ok {
+				return nil, fmt.Errorf("msgpack: cannot decode a map keyed by %T into an empty interface", pair.key)
+			}
+			value, err := genericMsgpack(pair.value)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		}
+		return out, nil
+	default:
+		return decoded, nil
+	}
+}
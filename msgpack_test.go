@@ -0,0 +1,119 @@
+package servicebus
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgpackCodec_Encoding(t *testing.T) {
+	cases := []struct {
+		name string
+		v    interface{}
+		want []byte
+	}{
+		{name: "nil", v: nil, want: []byte{0xc0}},
+		{name: "true", v: true, want: []byte{0xc3}},
+		{name: "positive fixint", v: 7, want: []byte{0x07}},
+		{name: "negative fixint", v: -3, want: []byte{0xfd}},
+		{name: "int8", v: -100, want: []byte{0xd0, 0x9c}},
+		{name: "uint16", v: 300, want: []byte{0xcd, 0x01, 0x2c}},
+		{name: "uint64", v: uint64(math.MaxUint64), want: []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "float64", v: 1.5, want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{name: "fixstr", v: "hi", want: []byte{0xa2, 'h', 'i'}},
+		{name: "bin", v: []byte{1, 2}, want: []byte{0xc4, 0x02, 0x01, 0x02}},
+		{name: "fixarray", v: []int{1, 2}, want: []byte{0x92, 0x01, 0x02}},
+		{name: "sorted fixmap", v: map[string]int{"b": 2, "a": 1}, want: []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{name: "timestamp 32", v: time.Unix(1, 0), want: []byte{0xd6, 0xff, 0, 0, 0, 1}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := MsgpackCodec{}.Encode(c.v)
+			if assert.NoError(t, err) {
+				assert.Equal(t, c.want, got)
+			}
+		})
+	}
+}
+
+func TestMsgpackCodec_RoundTrip(t *testing.T) {
+	type address struct {
+		City string `msgpack:"city"`
+	}
+	type base struct {
+		ID string `msgpack:"id"`
+	}
+	type order struct {
+		base
+		Lines    []string          `msgpack:"lines"`
+		Quantity int16             `msgpack:"qty"`
+		Price    float32           `msgpack:"price"`
+		Paid     bool              `msgpack:"paid"`
+		Note     string            `msgpack:"note,omitempty"`
+		Skipped  string            `msgpack:"-"`
+		ShipTo   *address          `msgpack:"ship_to"`
+		Tags     map[string]string `msgpack:"tags"`
+		Digest   [4]byte           `msgpack:"digest"`
+		Placed   time.Time         `msgpack:"placed"`
+		Raw      []byte            `msgpack:"raw"`
+	}
+
+	in := order{
+		base:     base{ID: "order-1"},
+		Lines:    []string{"a", "b"},
+		Quantity: -2,
+		Price:    9.5,
+		Paid:     true,
+		Skipped:  "not encoded",
+		ShipTo:   &address{City: "Oslo"},
+		Tags:     map[string]string{"priority": "high"},
+		Digest:   [4]byte{1, 2, 3, 4},
+		Placed:   time.Date(2018, 10, 1, 12, 0, 0, 123, time.UTC),
+		Raw:      []byte("payload"),
+	}
+
+	data, err := MsgpackCodec{}.Encode(in)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var out order
+	if assert.NoError(t, MsgpackCodec{}.Decode(data, &out)) {
+		in.Skipped = ""
+		assert.Equal(t, in, out)
+	}
+
+	var generic interface{}
+	if assert.NoError(t, MsgpackCodec{}.Decode(data, &generic)) {
+		m := generic.(map[string]interface{})
+		assert.Equal(t, "order-1", m["id"], "anonymous struct fields are inlined")
+		assert.Equal(t, int64(-2), m["qty"])
+		assert.Equal(t, map[string]interface{}{"city": "Oslo"}, m["ship_to"])
+		assert.NotContains(t, m, "note")
+	}
+}
+
+func TestMsgpackCodec_DecodeErrors(t *testing.T) {
+	var s string
+	assert.Error(t, MsgpackCodec{}.Decode([]byte{0xa5, 'a'}, &s), "truncated string")
+	assert.Error(t, MsgpackCodec{}.Decode([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, new([]int)), "length beyond the data")
+	assert.Error(t, MsgpackCodec{}.Decode([]byte{0x01, 0x02}, new(int)), "trailing data")
+	assert.Error(t, MsgpackCodec{}.Decode([]byte{0xcd, 0x01, 0x2c}, new(int8)), "overflow")
+	assert.Error(t, MsgpackCodec{}.Decode([]byte{0x01}, &s), "type mismatch")
+	assert.Error(t, MsgpackCodec{}.Decode([]byte{0x01}, s), "not a pointer")
+}
+
+func TestMsgpackCodec_IsRegisteredByDefault(t *testing.T) {
+	msg, err := DefaultCodecRegistry.NewMessage(MsgpackContentType, map[string]int{"a": 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var got map[string]int
+	if assert.NoError(t, msg.DecodeValue(&got)) {
+		assert.Equal(t, map[string]int{"a": 1}, got)
+	}
+}
@@ -0,0 +1,110 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// MultiReceiverSource is an entity a MultiReceiver receives from, the name its messages are tagged with, and the
+	// options to receive from it with
+	MultiReceiverSource struct {
+		Name     string
+		Receiver MessageReceiver
+		Options  []ReceiveOption
+	}
+
+	// MultiReceiver receives from several queues and subscriptions at once, passing the messages of all of them to a
+	// single handler. Each source keeps its own link and credit, as configured on its Queue or Subscription, so a busy
+	// or slow source does not hold up the others. The handler is called concurrently for messages from different
+	// sources and must be safe for concurrent use; SourceFromContext tells it which source a message came from.
+	MultiReceiver struct {
+		sources []MultiReceiverSource
+	}
+
+	multiReceiverSourceKey struct{}
+)
+
+// NewMultiReceiver creates a MultiReceiver which receives from each of the sources. Every source must have a receiver
+// and a name distinct from the others.
+func NewMultiReceiver(sources ...MultiReceiverSource) (*MultiReceiver, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("at least one source is required")
+	}
+	names := make(map[string]bool, len(sources))
+	for i, source := range sources {
+		if source.Receiver == nil {
+			return nil, fmt.Errorf("source %d has no receiver", i)
+		}
+		if source.Name == "" {
+			return nil, fmt.Errorf("source %d has no name", i)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("source name %q is used more than once", source.Name)
+		}
+		names[source.Name] = true
+	}
+	return &MultiReceiver{sources: sources}, nil
+}
+
+// Receive receives from every source until the context is done or one of them stops, in which case the others are
+// stopped and the error the first source stopped with is returned
+func (mr *MultiReceiver) Receive(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(mr.sources))
+	for _, source := range mr.sources {
+		go func(source MultiReceiverSource) {
+			err := source.Receiver.Receive(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+				return handler.Handle(context.WithValue(ctx, multiReceiverSourceKey{}, source.Name), msg)
+			}), source.Options...)
+			if err != nil && ctx.Err() == nil {
+				log.For(ctx).Error(fmt.Errorf("source %q of multi receiver failed: %v", source.Name, err))
+			}
+			errs <- err
+		}(source)
+	}
+
+	var first error
+	for range mr.sources {
+		err := <-errs
+		cancel()
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// SourceFromContext returns the name of the MultiReceiverSource the message being handled was received from, if the
+// context was passed to a Handler by a MultiReceiver
+func SourceFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(multiReceiverSourceKey{}).(string)
+	return name, ok
+}
@@ -0,0 +1,80 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingReceiver struct {
+	err error
+}
+
+func (r *failingReceiver) Receive(context.Context, Handler, ...ReceiveOption) error {
+	return r.err
+}
+
+func TestNewMultiReceiver(t *testing.T) {
+	_, err := NewMultiReceiver()
+	assert.Error(t, err)
+	_, err = NewMultiReceiver(MultiReceiverSource{Name: "orders"})
+	assert.Error(t, err)
+	_, err = NewMultiReceiver(MultiReceiverSource{Receiver: new(listReceiver)})
+	assert.Error(t, err)
+	_, err = NewMultiReceiver(MultiReceiverSource{Name: "orders", Receiver: new(listReceiver)},
+		MultiReceiverSource{Name: "orders", Receiver: new(listReceiver)})
+	assert.Error(t, err)
+}
+
+func TestMultiReceiver_TagsMessagesWithTheirSource(t *testing.T) {
+	orders := &listReceiver{messages: []*Message{NewMessageFromString("order 1"), NewMessageFromString("order 2")}}
+	refunds := &listReceiver{messages: []*Message{NewMessageFromString("refund 1")}}
+	mr, err := NewMultiReceiver(MultiReceiverSource{Name: "orders", Receiver: orders},
+		MultiReceiverSource{Name: "refunds", Receiver: refunds})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var mu sync.Mutex
+	received := map[string][]string{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = mr.Receive(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		source, ok := SourceFromContext(ctx)
+		assert.True(t, ok)
+
+		mu.Lock()
+		defer mu.Unlock()
+		received[source] = append(received[source], string(msg.Data))
+		if len(received["orders"])+len(received["refunds"]) == 3 {
+			cancel()
+		}
+		return nil
+	}))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"order 1", "order 2"}, received["orders"])
+	assert.Equal(t, []string{"refund 1"}, received["refunds"])
+
+	_, ok := SourceFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestMultiReceiver_StopsWhenASourceFails(t *testing.T) {
+	failure := errors.New("entity not found")
+	mr, err := NewMultiReceiver(MultiReceiverSource{Name: "healthy", Receiver: new(listReceiver)},
+		MultiReceiverSource{Name: "broken", Receiver: &failingReceiver{err: failure}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Equal(t, failure, mr.Receive(ctx, HandlerFunc(func(context.Context, *Message) DispositionAction {
+		return nil
+	})))
+	assert.NoError(t, ctx.Err(), "the healthy source should be stopped rather than waiting for the timeout")
+}
@@ -24,8 +24,10 @@ package servicebus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"strings"
 
 	"github.com/Azure/azure-amqp-common-go/auth"
 	"github.com/Azure/azure-amqp-common-go/cbs"
@@ -45,7 +47,7 @@ const (
 	//`
 
 	// Version is the semantic version number
-	Version = "0.1.0"
+	Version = "0.2.0"
 
 	rootUserAgent = "/golang-service-bus"
 
@@ -57,9 +59,28 @@ type (
 	// Namespace provides a simplified facade over the AMQP implementation of Azure Service Bus and is the entry point
 	// for using Queues, Topics and Subscriptions
 	Namespace struct {
-		Name          string
-		TokenProvider auth.TokenProvider
-		Environment   azure.Environment
+		Name            string
+		TokenProvider   auth.TokenProvider
+		Environment     azure.Environment
+		clock           Clock
+		state           connectionState
+		senders         *senderCache
+		failover        *failoverDetector
+		useWebSocket    bool
+		tokenRouter     *tokenRouter
+		tracingDisabled bool
+		tracer          Tracer
+		entityPath      string
+		anyEntityPath   bool
+		userAgent       string
+		containerID     string
+		faults          faultInjector
+		stampSendTime   bool
+		latencyHook     LatencyHook
+		managementCache *entityCache
+		children        childRegistry
+		managementRetry *RetryPolicy
+		dataPlaneRetry  *RetryPolicy
 	}
 
 	// NamespaceOption provides structure for configuring a new Service Bus namespace
@@ -76,6 +97,7 @@ func NamespaceWithConnectionString(connStr string) NamespaceOption {
 		if parsed.Namespace != "" {
 			ns.Name = parsed.Namespace
 		}
+		ns.entityPath = parsed.HubName
 		provider, err := sas.NewTokenProvider(sas.TokenProviderWithKey(parsed.KeyName, parsed.Key))
 		if err != nil {
 			return err
@@ -85,11 +107,78 @@ func NamespaceWithConnectionString(connStr string) NamespaceOption {
 	}
 }
 
+// NamespaceWithEntityPathMismatchAllowed disables the check which prevents creating a Queue, Topic or Subscription
+// other than the one named by the EntityPath of the namespace's connection string. This is only useful if the shared
+// access key is authorized for more than the entity it names.
+func NamespaceWithEntityPathMismatchAllowed() NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.anyEntityPath = true
+		return nil
+	}
+}
+
+// NamespaceWithTokenProvider configures a namespace to authorize its connections with the provided token provider, such
+// as an Azure Active Directory JWT provider, rather than a shared access signature
+func NamespaceWithTokenProvider(provider auth.TokenProvider) NamespaceOption {
+	return func(ns *Namespace) error {
+		if provider == nil {
+			return errors.New("token provider must not be nil")
+		}
+		ns.TokenProvider = provider
+		return nil
+	}
+}
+
+// NamespaceWithWebSocket configures a namespace to connect with AMQP over WebSockets on port 443 rather than AMQP on
+// port 5671, for environments where only HTTPS egress is allowed. The connection honors the HTTPS_PROXY and NO_PROXY
+// environment variables. Claims are negotiated over the WebSocket as usual, so it may be combined with any token provider.
+func NamespaceWithWebSocket() NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.useWebSocket = true
+		return nil
+	}
+}
+
+// NamespaceWithUserAgent appends the application's user agent to the library's own on every AMQP connection the
+// namespace opens, so the connections of an application can be found in the server-side logs
+func NamespaceWithUserAgent(userAgent string) NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.userAgent = strings.TrimSpace(userAgent)
+		return nil
+	}
+}
+
+// NamespaceWithContainerID sets the AMQP container ID of every connection the namespace opens, rather than a random one,
+// so that a particular application instance can be identified in the server-side logs and support cases
+func NamespaceWithContainerID(containerID string) NamespaceOption {
+	return func(ns *Namespace) error {
+		if containerID == "" {
+			return errors.New("container ID must not be empty")
+		}
+		ns.containerID = containerID
+		return nil
+	}
+}
+
+// NamespaceWithClock configures a namespace to use the provided Clock for scheduling, lock expiration and retry back-off
+// rather than the system clock
+func NamespaceWithClock(clock Clock) NamespaceOption {
+	return func(ns *Namespace) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		ns.clock = clock
+		return nil
+	}
+}
+
 // NewNamespace creates a new namespace configured through NamespaceOption(s)
 func NewNamespace(opts ...NamespaceOption) (*Namespace, error) {
 	ns := &Namespace{
 		Environment: azure.PublicCloud,
+		clock:       systemClock{},
 	}
+	ns.senders = newSenderCache(ns.getClock)
 
 	for _, opt := range opts {
 		err := opt(ns)
@@ -102,34 +191,77 @@ func NewNamespace(opts ...NamespaceOption) (*Namespace, error) {
 }
 
 func (ns *Namespace) newConnection() (*amqp.Client, error) {
-	host := ns.getAMQPHostURI()
-	return amqp.Dial(host,
+	var client *amqp.Client
+	var err error
+	if ns.useWebSocket {
+		client, err = ns.newWebSocketConnection()
+	} else {
+		client, err = amqp.Dial(ns.getAMQPHostURI(), ns.connOptions()...)
+	}
+	ns.connectionOpened(client, err)
+	return client, err
+}
+
+// connOptions are the AMQP connection options common to every transport
+func (ns *Namespace) connOptions() []amqp.ConnOption {
+	opts := []amqp.ConnOption{
 		amqp.ConnSASLAnonymous(),
 		amqp.ConnMaxSessions(65535),
 		amqp.ConnProperty("product", "MSGolangClient"),
 		amqp.ConnProperty("version", Version),
 		amqp.ConnProperty("platform", runtime.GOOS),
 		amqp.ConnProperty("framework", runtime.Version()),
-		amqp.ConnProperty("user-agent", rootUserAgent),
-	)
+		amqp.ConnProperty("user-agent", ns.getUserAgent()),
+	}
+	if ns.containerID != "" {
+		opts = append(opts, amqp.ConnContainerID(ns.containerID))
+	}
+	return opts
+}
+
+// getUserAgent is the library's user agent followed by the application's, if one was configured
+func (ns *Namespace) getUserAgent() string {
+	if ns.userAgent == "" {
+		return rootUserAgent
+	}
+	return rootUserAgent + " " + ns.userAgent
 }
 
 func (ns *Namespace) negotiateClaim(ctx context.Context, conn *amqp.Client, entityPath string) error {
 	span, ctx := ns.startSpanFromContext(ctx, "sb.namespace.negotiateClaim")
-	defer span.Finish()
+	defer span.End()
 
 	audience := ns.getEntityAudience(entityPath)
-	return cbs.NegotiateClaim(ctx, audience, conn, ns.TokenProvider)
+	return cbs.NegotiateClaim(ctx, audience, conn, ns.tokenProviderFor(entityPath))
+}
+
+func (ns *Namespace) getHostName() string {
+	return fmt.Sprintf("%s.%s", ns.Name, ns.Environment.ServiceBusEndpointSuffix)
 }
 
 func (ns *Namespace) getAMQPHostURI() string {
-	return fmt.Sprintf("amqps://%s.%s/", ns.Name, ns.Environment.ServiceBusEndpointSuffix)
+	return fmt.Sprintf("amqps://%s/", ns.getHostName())
 }
 
 func (ns *Namespace) getHTTPSHostURI() string {
-	return fmt.Sprintf("https://%s.%s/", ns.Name, ns.Environment.ServiceBusEndpointSuffix)
+	return fmt.Sprintf("https://%s/", ns.getHostName())
 }
 
 func (ns *Namespace) getEntityAudience(entityPath string) string {
 	return ns.getAMQPHostURI() + entityPath
 }
+
+// checkEntityPath returns an ErrEntityPathMismatch if the namespace's connection string is scoped to an entity which
+// neither is, nor contains, nor is contained by the entity at path
+func (ns *Namespace) checkEntityPath(path string) error {
+	if ns.entityPath == "" || ns.anyEntityPath {
+		return nil
+	}
+
+	scope := strings.ToLower(strings.Trim(ns.entityPath, "/"))
+	target := strings.ToLower(strings.Trim(path, "/"))
+	if scope == target || strings.HasPrefix(target, scope+"/") || strings.HasPrefix(scope, target+"/") {
+		return nil
+	}
+	return ErrEntityPathMismatch{ConnectionEntityPath: ns.entityPath, EntityPath: path}
+}
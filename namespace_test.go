@@ -31,6 +31,7 @@ import (
 
 	"github.com/Azure/azure-service-bus-go/internal/test"
 	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -116,3 +117,72 @@ func (suite *serviceBusSuite) getNewSasInstance() *Namespace {
 func getNewSasInstance(connStr string) (*Namespace, error) {
 	return NewNamespace(NamespaceWithConnectionString(connStr))
 }
+
+func TestNamespace_EntityPathMismatch(t *testing.T) {
+	const scoped = "Endpoint=sb://foo.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=c2VjcmV0;EntityPath=orders"
+	ns, err := NewNamespace(NamespaceWithConnectionString(scoped))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = ns.NewQueue("Orders")
+	assert.NoError(t, err)
+
+	_, err = ns.NewQueue("invoices")
+	if assert.IsType(t, ErrEntityPathMismatch{}, err) {
+		assert.Equal(t, ErrEntityPathMismatch{ConnectionEntityPath: "orders", EntityPath: "invoices"}, err)
+		assert.Contains(t, err.Error(), `"orders"`)
+	}
+
+	topic, err := ns.NewTopic("orders")
+	if assert.NoError(t, err) {
+		_, err = topic.NewSubscription("audit")
+		assert.NoError(t, err)
+	}
+
+	_, err = ns.NewTopic("invoices")
+	assert.IsType(t, ErrEntityPathMismatch{}, err)
+
+	allowed, err := NewNamespace(NamespaceWithConnectionString(scoped), NamespaceWithEntityPathMismatchAllowed())
+	if assert.NoError(t, err) {
+		_, err = allowed.NewQueue("invoices")
+		assert.NoError(t, err)
+	}
+}
+
+func TestNamespace_SubscriptionScopedEntityPath(t *testing.T) {
+	const scoped = "Endpoint=sb://foo.servicebus.windows.net/;SharedAccessKeyName=listen;SharedAccessKey=c2VjcmV0;EntityPath=orders/subscriptions/audit"
+	ns, err := NewNamespace(NamespaceWithConnectionString(scoped))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	topic, err := ns.NewTopic("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = topic.NewSubscription("audit")
+	assert.NoError(t, err)
+	_, err = topic.NewSubscription("billing")
+	assert.IsType(t, ErrEntityPathMismatch{}, err)
+}
+
+func TestNamespaceWithUserAgentAndContainerID(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, rootUserAgent, ns.getUserAgent())
+	defaults := len(ns.connOptions())
+
+	ns, err = NewNamespace(NamespaceWithUserAgent(" orders-api/1.2 "), NamespaceWithContainerID("orders-api-0"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, rootUserAgent+" orders-api/1.2", ns.getUserAgent())
+	assert.Equal(t, "orders-api-0", ns.containerID)
+	assert.Len(t, ns.connOptions(), defaults+1)
+
+	_, err = NewNamespace(NamespaceWithContainerID(""))
+	assert.Error(t, err)
+}
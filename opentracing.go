@@ -0,0 +1,100 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+type (
+	// openTracingTracer adapts an opentracing Tracer, or the global opentracing tracer if it has none, to a Tracer
+	openTracingTracer struct {
+		tracer opentracing.Tracer
+	}
+
+	openTracingSpan struct {
+		span opentracing.Span
+	}
+)
+
+// OpenTracingTracer adapts an opentracing Tracer to a Tracer
+func OpenTracingTracer(tracer opentracing.Tracer) Tracer {
+	return openTracingTracer{tracer: tracer}
+}
+
+func (ot openTracingTracer) get() opentracing.Tracer {
+	if ot.tracer != nil {
+		return ot.tracer
+	}
+	return opentracing.GlobalTracer()
+}
+
+// StartSpan starts an opentracing span as a child of the span in the context
+func (ot openTracingTracer) StartSpan(ctx context.Context, operationName string) (context.Context, Span) {
+	var opts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	span := ot.get().StartSpan(operationName, opts...)
+	return opentracing.ContextWithSpan(ctx, span), openTracingSpan{span: span}
+}
+
+func (ot openTracingTracer) isNoop() bool {
+	_, noop := ot.get().(opentracing.NoopTracer)
+	return noop
+}
+
+// startSpanFromWire starts an opentracing span following from the span context carried on a received message
+func (ot openTracingTracer) startSpanFromWire(ctx context.Context, operationName string, carrier textMapReader) (context.Context, Span, bool) {
+	tracer := ot.get()
+	reference, err := tracer.Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		return ctx, nil, false
+	}
+	span := tracer.StartSpan(operationName, opentracing.FollowsFrom(reference))
+	return opentracing.ContextWithSpan(ctx, span), openTracingSpan{span: span}, true
+}
+
+// SetAttribute sets a tag on the span
+func (ots openTracingSpan) SetAttribute(key string, value interface{}) {
+	ots.span.SetTag(key, value)
+}
+
+// End finishes the span
+func (ots openTracingSpan) End() {
+	ots.span.Finish()
+}
+
+func (ots openTracingSpan) inject(carrier textMapWriter) error {
+	return ots.span.Tracer().Inject(ots.span.Context(), opentracing.TextMap, carrier)
+}
+
+func (ots openTracingSpan) foreachBaggageItem(handler func(key, value string) bool) {
+	ots.span.Context().ForeachBaggageItem(handler)
+}
+
+func (ots openTracingSpan) setBaggageItem(key, value string) {
+	ots.span.SetBaggageItem(key, value)
+}
@@ -4,15 +4,18 @@ const vendorPrefix = "com.microsoft:"
 
 // Operations
 const (
-	lockRenewalOperationName   = vendorPrefix + "renew-lock"
-	peekMessageOperationID     = vendorPrefix + "peek-message"
-	scheduleMessageOperationID = vendorPrefix + "schedule-message"
-	cancelScheduledOperationID = vendorPrefix + "cancel-scheduled-message"
+	lockRenewalOperationName     = vendorPrefix + "renew-lock"
+	peekMessageOperationID       = vendorPrefix + "peek-message"
+	scheduleMessageOperationID   = vendorPrefix + "schedule-message"
+	cancelScheduledOperationID   = vendorPrefix + "cancel-scheduled-message"
+	updateDispositionOperationID = vendorPrefix + "update-disposition"
+	receiveBySequenceOperationID = vendorPrefix + "receive-by-sequence-number"
 )
 
 // Field Descriptions
 const (
-	operationFieldName     = "operation"
-	lockTokensFieldName    = "lock-tokens"
-	serverTimeoutFieldName = vendorPrefix + "server-timeout"
+	operationFieldName         = "operation"
+	lockTokensFieldName        = "lock-tokens"
+	dispositionStatusFieldName = "disposition-status"
+	serverTimeoutFieldName     = vendorPrefix + "server-timeout"
 )
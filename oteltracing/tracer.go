@@ -0,0 +1,89 @@
+// Package oteltracing adapts OpenTelemetry tracers so they can trace Service Bus operations through
+// servicebus.NamespaceWithTracer. It is a separate module so the servicebus package does not depend on OpenTelemetry.
+// It requires servicebus v0.2.0, the first release with the Tracer interface; to work on both modules together, use them
+// from a go.work rather than a replace directive.
+package oteltracing
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-service-bus-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	tracer struct {
+		tracer trace.Tracer
+	}
+
+	span struct {
+		span trace.Span
+	}
+)
+
+// NewTracer adapts the OpenTelemetry tracer to a servicebus.Tracer
+func NewTracer(t trace.Tracer) servicebus.Tracer {
+	return tracer{tracer: t}
+}
+
+// StartSpan starts an OpenTelemetry span as a child of the span in the context
+func (t tracer) StartSpan(ctx context.Context, operationName string) (context.Context, servicebus.Span) {
+	ctx, s := t.tracer.Start(ctx, operationName)
+	return ctx, span{span: s}
+}
+
+// SetAttribute sets an attribute on the span
+func (s span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(attributeOf(key, value))
+}
+
+// End completes the span
+func (s span) End() {
+	s.span.End()
+}
+
+// attributeOf converts a span tag to the closest OpenTelemetry attribute type, falling back to its string form
+func attributeOf(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case uint32:
+		return attribute.Int64(key, int64(v))
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,65 @@
+package oteltracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type (
+	recordingTracer struct {
+		noop.Tracer
+		spans []*recordingSpan
+	}
+
+	recordingSpan struct {
+		noop.Span
+		name       string
+		attributes []attribute.KeyValue
+		ended      bool
+	}
+)
+
+func (rt *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordingSpan{name: name}
+	rt.spans = append(rt.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (rs *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	rs.attributes = append(rs.attributes, kv...)
+}
+
+func (rs *recordingSpan) End(...trace.SpanEndOption) {
+	rs.ended = true
+}
+
+func TestTracer_StartSpan(t *testing.T) {
+	rt := new(recordingTracer)
+	ctx, s := NewTracer(rt).StartSpan(context.Background(), "sb.Queue.Send")
+	s.SetAttribute("amqp.message-id", "abc")
+	s.SetAttribute("amqp.message-group-sequence", uint32(7))
+	s.End()
+
+	if assert.Len(t, rt.spans, 1) {
+		recorded := rt.spans[0]
+		assert.Equal(t, "sb.Queue.Send", recorded.name)
+		assert.True(t, recorded.ended)
+		assert.Equal(t, []attribute.KeyValue{
+			attribute.String("amqp.message-id", "abc"),
+			attribute.Int64("amqp.message-group-sequence", 7),
+		}, recorded.attributes)
+		assert.Equal(t, recorded, trace.SpanFromContext(ctx))
+	}
+}
+
+func TestAttributeOf(t *testing.T) {
+	assert.Equal(t, attribute.Bool("ok", true), attributeOf("ok", true))
+	assert.Equal(t, attribute.Float64("ratio", 0.5), attributeOf("ratio", 0.5))
+	type spanKind string
+	assert.Equal(t, attribute.String("span.kind", "consumer"), attributeOf("span.kind", spanKind("consumer")))
+}
@@ -0,0 +1,104 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// maxPartitionKeyLength is the longest partition key the broker accepts
+	maxPartitionKeyLength = 128
+)
+
+// SetPartitionKey sets the x-opt-partition-key annotation, which steers the message to a partition of a partitioned
+// entity so that messages sharing the key are stored, and delivered, in order on the same partition. For messages sent
+// to a session, the partition key must be the session ID, which is already used to choose the partition if no key is
+// set. The key is ignored by entities which are not partitioned.
+func (m *Message) SetPartitionKey(key string) error {
+	if err := validatePartitionKey("partition key", key); err != nil {
+		return err
+	}
+	if m.SystemProperties == nil {
+		m.SystemProperties = new(SystemProperties)
+	}
+	m.SystemProperties.PartitionKey = &key
+	return nil
+}
+
+// SetViaPartitionKey sets the x-opt-via-partition-key annotation, which chooses the partition of the transfer queue a
+// message sent via another entity passes through
+func (m *Message) SetViaPartitionKey(key string) error {
+	if err := validatePartitionKey("via partition key", key); err != nil {
+		return err
+	}
+	if m.SystemProperties == nil {
+		m.SystemProperties = new(SystemProperties)
+	}
+	m.SystemProperties.ViaPartitionKey = &key
+	return nil
+}
+
+// PartitionKey returns the partition key of the message, if it has one
+func (m *Message) PartitionKey() (string, bool) {
+	if m.SystemProperties == nil || m.SystemProperties.PartitionKey == nil {
+		return "", false
+	}
+	return *m.SystemProperties.PartitionKey, true
+}
+
+// PartitionID returns the partition of a partitioned entity which stored the received message, which is useful when
+// logging where a message came from. Messages received from entities which are not partitioned have no partition ID.
+func (m *Message) PartitionID() (int16, bool) {
+	if m.SystemProperties == nil || m.SystemProperties.PartitionID == nil {
+		return 0, false
+	}
+	return *m.SystemProperties.PartitionID, true
+}
+
+// validatePartitionKeys checks the partition keys of a message about to be sent, before the sender assigns it a
+// session of its own
+func (m *Message) validatePartitionKeys() error {
+	key, ok := m.PartitionKey()
+	if !ok {
+		return nil
+	}
+	if err := validatePartitionKey("partition key", key); err != nil {
+		return err
+	}
+	if m.GroupID != nil && *m.GroupID != key {
+		return fmt.Errorf("partition key %q must match the session ID %q of the message", key, *m.GroupID)
+	}
+	return nil
+}
+
+func validatePartitionKey(name, key string) error {
+	if key == "" {
+		return errors.New(name + " must not be empty")
+	}
+	if len(key) > maxPartitionKeyLength {
+		return fmt.Errorf("%s must be at most %d characters long", name, maxPartitionKeyLength)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package servicebus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestMessage_PartitionKeys(t *testing.T) {
+	msg := NewMessageFromString("payload")
+	_, ok := msg.PartitionKey()
+	assert.False(t, ok)
+
+	assert.NoError(t, msg.SetPartitionKey("customer-42"))
+	assert.NoError(t, msg.SetViaPartitionKey("transfer"))
+	assert.Error(t, msg.SetPartitionKey(""))
+	assert.Error(t, msg.SetViaPartitionKey(strings.Repeat("k", maxPartitionKeyLength+1)))
+
+	key, ok := msg.PartitionKey()
+	assert.True(t, ok)
+	assert.Equal(t, "customer-42", key)
+
+	amqpMsg, err := msg.toMsg()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "customer-42", amqpMsg.Annotations["x-opt-partition-key"])
+		assert.Equal(t, "transfer", amqpMsg.Annotations["x-opt-via-partition-key"])
+	}
+}
+
+func TestMessage_PartitionID(t *testing.T) {
+	received, err := messageFromAMQPMessage(&amqp.Message{
+		Data:        [][]byte{[]byte("payload")},
+		Annotations: amqp.Annotations{"x-opt-partition-id": int16(3)},
+	})
+	if assert.NoError(t, err) {
+		id, ok := received.PartitionID()
+		assert.True(t, ok)
+		assert.Equal(t, int16(3), id)
+	}
+
+	_, ok := NewMessageFromString("payload").PartitionID()
+	assert.False(t, ok)
+}
+
+func TestSender_RejectsPartitionKeyOtherThanSession(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := &sender{namespace: ns, entityPath: "queue"}
+
+	session := "session"
+	msg := NewMessageFromString("payload")
+	msg.GroupID = &session
+	assert.NoError(t, msg.SetPartitionKey("customer-42"))
+	assert.Error(t, s.prepare(context.Background(), noopSpan, msg))
+
+	assert.NoError(t, msg.SetPartitionKey(session))
+	assert.NoError(t, s.prepare(context.Background(), noopSpan, msg))
+}
+
+func TestSender_DoesNotGivePartitionedMessagesItsSession(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	session, err := newSession(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := &sender{namespace: ns, entityPath: "queue", session: session}
+
+	keyed := NewMessageFromString("payload")
+	assert.NoError(t, keyed.SetPartitionKey("customer-42"))
+	if assert.NoError(t, s.prepare(context.Background(), noopSpan, keyed)) {
+		assert.Nil(t, keyed.GroupID, "a random session would not match the partition key")
+	}
+
+	plain := NewMessageFromString("payload")
+	if assert.NoError(t, s.prepare(context.Background(), noopSpan, plain)) && assert.NotNil(t, plain.GroupID) {
+		assert.Equal(t, s.session.SessionID, *plain.GroupID)
+	}
+}
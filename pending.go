@@ -0,0 +1,117 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"sync"
+)
+
+// pendingSends counts the messages a Queue or Topic has been asked to send which the broker has not settled yet, so
+// that producers can wait for them before shutting down or checkpointing
+type pendingSends struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+// Pending returns the number of messages passed to Send, SendAsync or SendBatch which the broker has not yet accepted
+// or rejected
+func (q *Queue) Pending() int {
+	return q.pending.len()
+}
+
+// WaitForConfirmations blocks until every message passed to Send, SendAsync or SendBatch before it returns has been
+// accepted or rejected by the broker, or the context is done. Messages sent while waiting are waited for too, so
+// producers should stop sending first. It reports only whether the transfers were settled: errors from the sends
+// themselves are returned to their callers.
+func (q *Queue) WaitForConfirmations(ctx context.Context) error {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.WaitForConfirmations")
+	defer span.End()
+
+	return q.pending.wait(ctx)
+}
+
+// Pending returns the number of messages passed to Send or SendBatch which the broker has not yet accepted or
+// rejected
+func (t *Topic) Pending() int {
+	return t.pending.len()
+}
+
+// WaitForConfirmations blocks until every message passed to Send or SendBatch before it returns has been accepted or
+// rejected by the broker, or the context is done. Messages sent while waiting are waited for too, so producers should
+// stop sending first. It reports only whether the transfers were settled: errors from the sends themselves are
+// returned to their callers.
+func (t *Topic) WaitForConfirmations(ctx context.Context) error {
+	span, ctx := t.startSpanFromContext(ctx, "sb.Topic.WaitForConfirmations")
+	defer span.End()
+
+	return t.pending.wait(ctx)
+}
+
+// add counts n messages as pending until the returned func is called
+func (ps *pendingSends) add(n int) func() {
+	ps.mu.Lock()
+	ps.count += n
+	ps.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ps.mu.Lock()
+			defer ps.mu.Unlock()
+			ps.count -= n
+			if ps.count == 0 && ps.idle != nil {
+				close(ps.idle)
+				ps.idle = nil
+			}
+		})
+	}
+}
+
+func (ps *pendingSends) len() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.count
+}
+
+// wait blocks until no messages are pending or the context is done
+func (ps *pendingSends) wait(ctx context.Context) error {
+	ps.mu.Lock()
+	if ps.count == 0 {
+		ps.mu.Unlock()
+		return nil
+	}
+	if ps.idle == nil {
+		ps.idle = make(chan struct{})
+	}
+	idle := ps.idle
+	ps.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
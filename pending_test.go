@@ -0,0 +1,71 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_WaitForConfirmations(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("queue")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, q.WaitForConfirmations(context.Background()))
+
+	first := q.pending.add(1)
+	batch := q.pending.add(3)
+	assert.Equal(t, 4, q.Pending())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.WaitForConfirmations(ctx))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- q.WaitForConfirmations(context.Background())
+	}()
+
+	first()
+	first()
+	assert.Equal(t, 3, q.Pending())
+	select {
+	case <-done:
+		t.Fatal("WaitForConfirmations returned while messages were pending")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	batch()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForConfirmations did not return once nothing was pending")
+	}
+	assert.Zero(t, q.Pending())
+}
+
+func TestTopic_PendingCountsFailedSends(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	topic, err := ns.NewTopic("topic")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, topic.Send(ctx, NewMessageFromString("hello")))
+	assert.Error(t, topic.SendBatch(ctx, []*Message{NewMessageFromString("a"), NewMessageFromString("b")}))
+	assert.Zero(t, topic.Pending())
+	assert.NoError(t, topic.WaitForConfirmations(context.Background()))
+}
@@ -0,0 +1,222 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PriorityProperty is the user property carrying the priority level a PrioritySender sent a message with
+	PriorityProperty = "priority"
+)
+
+type (
+	// PrioritySender sends messages to one of several entities according to their priority, implementing the priority
+	// queue pattern on top of Service Bus, which delivers the messages of a single entity in order regardless of any
+	// priority. Level 0 is the highest priority.
+	PrioritySender struct {
+		levels []MessageSender
+	}
+
+	// PriorityLevel is an entity a PriorityReceiver receives from, and the number of its messages handled in each round
+	// of receiving before giving lower priority levels their turn
+	PriorityLevel struct {
+		Receiver MessageReceiver
+		Weight   int
+	}
+
+	// PriorityReceiver receives from the entities a PrioritySender sends to. Messages are handled one at a time, with
+	// each level handling up to its weight in messages per round, in order of priority. A level without messages
+	// waiting does not hold up the others, so lower priority messages are handled promptly when there is spare
+	// capacity, but cannot starve higher priority levels when there is not.
+	PriorityReceiver struct {
+		levels []PriorityLevel
+	}
+
+	// priorityDelivery is a message waiting for its level to be given a turn
+	priorityDelivery struct {
+		ctx  context.Context
+		msg  *Message
+		done chan DispositionAction
+	}
+)
+
+// NewPrioritySender creates a PrioritySender which sends to the entities in order of priority, highest first
+func NewPrioritySender(levels ...MessageSender) (*PrioritySender, error) {
+	if len(levels) == 0 {
+		return nil, errors.New("at least one priority level is required")
+	}
+	for i, level := range levels {
+		if level == nil {
+			return nil, fmt.Errorf("priority level %d has no sender", i)
+		}
+	}
+	return &PrioritySender{levels: levels}, nil
+}
+
+// SendWithPriority sends the message to the entity of the priority level, recording the level in the
+// PriorityProperty of the message
+func (ps *PrioritySender) SendWithPriority(ctx context.Context, priority int, msg *Message) error {
+	if priority < 0 || priority >= len(ps.levels) {
+		return fmt.Errorf("priority %d is out of range; levels are 0 to %d", priority, len(ps.levels)-1)
+	}
+	msg.setProperty(PriorityProperty, int32(priority))
+	return ps.levels[priority].Send(ctx, msg)
+}
+
+// Send sends the message to the entity of the priority level in its PriorityProperty, or to the lowest priority level
+// if it has none. It allows a PrioritySender to be used wherever a MessageSender is.
+func (ps *PrioritySender) Send(ctx context.Context, msg *Message) error {
+	priority, ok := messagePriority(msg)
+	if !ok {
+		priority = len(ps.levels) - 1
+	}
+	return ps.SendWithPriority(ctx, priority, msg)
+}
+
+// NewPriorityReceiver creates a PriorityReceiver which receives from the levels in order of priority, highest first
+func NewPriorityReceiver(levels ...PriorityLevel) (*PriorityReceiver, error) {
+	if len(levels) == 0 {
+		return nil, errors.New("at least one priority level is required")
+	}
+	for i, level := range levels {
+		if level.Receiver == nil {
+			return nil, fmt.Errorf("priority level %d has no receiver", i)
+		}
+		if level.Weight < 1 {
+			return nil, fmt.Errorf("priority level %d must have a weight of at least 1", i)
+		}
+	}
+	return &PriorityReceiver{levels: levels}, nil
+}
+
+// Receive receives from every level until the context is done or one of them fails, passing messages to the handler
+// one at a time. A message waits, with its lock renewed as usual, until its level is given a turn, so a low prefetch
+// count keeps lower priority levels from holding locks on more messages than they can handle.
+func (pr *PriorityReceiver) Receive(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	deliveries := make([]chan *priorityDelivery, len(pr.levels))
+	wake := make(chan struct{}, 1)
+	errs := make(chan error, len(pr.levels))
+	for i, level := range pr.levels {
+		deliveries[i] = make(chan *priorityDelivery, 1)
+		go func(receiver MessageReceiver, deliveries chan *priorityDelivery) {
+			errs <- receiver.Receive(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+				return awaitTurn(ctx, msg, deliveries, wake)
+			}))
+		}(level.Receiver, deliveries[i])
+	}
+
+	pending := make([]*priorityDelivery, len(pr.levels))
+	credit := make([]int, len(pr.levels))
+	for {
+		for i := range deliveries {
+			if pending[i] != nil {
+				continue
+			}
+			select {
+			case d := <-deliveries[i]:
+				pending[i] = d
+			default:
+			}
+		}
+
+		level := pr.nextTurn(pending, credit)
+		if level < 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case err := <-errs:
+				if err == nil {
+					err = ctx.Err()
+				}
+				return err
+			case <-wake:
+			}
+			continue
+		}
+
+		d := pending[level]
+		pending[level] = nil
+		d.done <- handler.Handle(d.ctx, d.msg)
+	}
+}
+
+// nextTurn returns the highest priority level with a message waiting and credit left in the round, starting a new
+// round once every waiting level has used its credit. It returns -1 if no message is waiting.
+func (pr *PriorityReceiver) nextTurn(pending []*priorityDelivery, credit []int) int {
+	for round := 0; round < 2; round++ {
+		for i, d := range pending {
+			if d != nil && credit[i] > 0 {
+				credit[i]--
+				return i
+			}
+		}
+		for i, level := range pr.levels {
+			credit[i] = level.Weight
+		}
+	}
+	return -1
+}
+
+// awaitTurn hands the message to the PriorityReceiver and waits for it to be handled. A message whose turn does not
+// come before the context is done is abandoned so it is redelivered.
+func awaitTurn(ctx context.Context, msg *Message, deliveries chan *priorityDelivery, wake chan struct{}) DispositionAction {
+	d := &priorityDelivery{ctx: ctx, msg: msg, done: make(chan DispositionAction, 1)}
+	select {
+	case deliveries <- d:
+	case <-ctx.Done():
+		return msg.Abandon()
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case action := <-d.done:
+		return action
+	case <-ctx.Done():
+		return msg.Abandon()
+	}
+}
+
+// messagePriority returns the priority level recorded on the message
+func messagePriority(msg *Message) (int, bool) {
+	switch priority := msg.UserProperties[PriorityProperty].(type) {
+	case int32:
+		return int(priority), true
+	case int64:
+		return int(priority), true
+	case int:
+		return priority, true
+	default:
+		return 0, false
+	}
+}
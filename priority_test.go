@@ -0,0 +1,106 @@
+package servicebus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// listReceiver hands its messages to the handler once each, then waits for the context to be done
+	listReceiver struct {
+		messages []*Message
+	}
+)
+
+func (r *listReceiver) Receive(ctx context.Context, handler Handler, _ ...ReceiveOption) error {
+	for _, msg := range r.messages {
+		handler.Handle(ctx, msg)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestPrioritySender(t *testing.T) {
+	high, low := new(recordingSender), new(recordingSender)
+	ps, err := NewPrioritySender(high, low)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, ps.SendWithPriority(ctx, 0, NewMessageFromString("urgent")))
+	assert.NoError(t, ps.Send(ctx, NewMessageFromString("whenever")))
+	routed := NewMessageFromString("routed")
+	routed.UserProperties = map[string]interface{}{PriorityProperty: int64(0)}
+	assert.NoError(t, ps.Send(ctx, routed))
+	assert.Error(t, ps.SendWithPriority(ctx, 2, NewMessageFromString("nowhere")))
+
+	if assert.Len(t, high.sent, 2) {
+		assert.Equal(t, int32(0), high.sent[0].UserProperties[PriorityProperty])
+		assert.Equal(t, "routed", string(high.sent[1].Data))
+	}
+	if assert.Len(t, low.sent, 1) {
+		assert.Equal(t, int32(1), low.sent[0].UserProperties[PriorityProperty])
+	}
+
+	_, err = NewPrioritySender()
+	assert.Error(t, err)
+}
+
+func TestPriorityReceiver_NextTurnHonorsWeights(t *testing.T) {
+	pr, err := NewPriorityReceiver(PriorityLevel{Receiver: new(listReceiver), Weight: 2},
+		PriorityLevel{Receiver: new(listReceiver), Weight: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	waiting := &priorityDelivery{}
+	pending := []*priorityDelivery{waiting, waiting}
+	credit := make([]int, 2)
+	var turns []int
+	for i := 0; i < 6; i++ {
+		turns = append(turns, pr.nextTurn(pending, credit))
+	}
+	assert.Equal(t, []int{0, 0, 1, 0, 0, 1}, turns)
+
+	// a level without messages waiting does not hold up the others
+	pending[0] = nil
+	assert.Equal(t, 1, pr.nextTurn(pending, credit))
+	assert.Equal(t, 1, pr.nextTurn(pending, credit))
+
+	pending[1] = nil
+	assert.Equal(t, -1, pr.nextTurn(pending, credit))
+
+	_, err = NewPriorityReceiver(PriorityLevel{Receiver: new(listReceiver)})
+	assert.Error(t, err)
+}
+
+func TestPriorityReceiver_HandlesEveryLevel(t *testing.T) {
+	high := &listReceiver{messages: []*Message{NewMessageFromString("h1"), NewMessageFromString("h2")}}
+	low := &listReceiver{messages: []*Message{NewMessageFromString("l1"), NewMessageFromString("l2")}}
+	pr, err := NewPriorityReceiver(PriorityLevel{Receiver: high, Weight: 3}, PriorityLevel{Receiver: low, Weight: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	handled := make(map[string]bool)
+	err = pr.Receive(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[string(msg.Data)] = true
+		if len(handled) == 4 {
+			cancel()
+		}
+		return func(context.Context) {}
+	}))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, map[string]bool{"h1": true, "h2": true, "l1": true, "l2": true}, handled)
+}
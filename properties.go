@@ -0,0 +1,209 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DeadLetterReasonProperty is the user property carrying the reason a message was dead-lettered. Passing it as a
+	// key of the additional data to DeadLetterWithInfo sets the reason reported by the dead letter queue.
+	DeadLetterReasonProperty = "DeadLetterReason"
+	// DeadLetterErrorDescriptionProperty is the user property carrying the description of the error which caused a
+	// message to be dead-lettered
+	DeadLetterErrorDescriptionProperty = "DeadLetterErrorDescription"
+
+	ticksPerSecond  = int64(time.Second / ticksDuration)
+	ticksDuration   = 100 * time.Nanosecond
+	maxDecimalDigit = 28
+	maxDurationDays = int64(math.MaxInt64 / int64(24*time.Hour))
+)
+
+var (
+	// timeSpanPattern matches the invariant "c" format of a .NET TimeSpan, [-][d.]hh:mm:ss[.fffffff]
+	timeSpanPattern = regexp.MustCompile(`^(-)?(?:(\d+)\.)?(\d{1,2}):(\d{1,2}):(\d{1,2})(?:\.(\d{1,7}))?$`)
+	decimalPattern  = regexp.MustCompile(`^-?(\d+)(?:\.(\d+))?$`)
+)
+
+// DeadLetterReason returns the reason the message was dead-lettered, or an empty string if it has none
+func (m *Message) DeadLetterReason() string {
+	reason, _ := m.UserProperties[DeadLetterReasonProperty].(string)
+	return reason
+}
+
+// DeadLetterErrorDescription returns the description of the error which caused the message to be dead-lettered, or
+// an empty string if it has none
+func (m *Message) DeadLetterErrorDescription() string {
+	description, _ := m.UserProperties[DeadLetterErrorDescriptionProperty].(string)
+	return description
+}
+
+// SetTime sets a user property to an AMQP timestamp, which the .NET SDK reads as a DateTime. Timestamps carry
+// millisecond precision, so the time is truncated to the millisecond and converted to UTC.
+func (m *Message) SetTime(key string, t time.Time) {
+	m.setProperty(key, t.UTC().Truncate(time.Millisecond))
+}
+
+// TimeProperty returns the user property as a time, if it is a timestamp
+func (m *Message) TimeProperty(key string) (time.Time, bool) {
+	t, ok := m.UserProperties[key].(time.Time)
+	return t, ok
+}
+
+// SetDuration sets a user property to the duration formatted as a .NET TimeSpan, [-][d.]hh:mm:ss[.fffffff], which
+// TimeSpan.Parse reads back. The .NET SDK encodes a TimeSpan as a described type the AMQP library cannot write, so the
+// invariant string form is the closest portable encoding. Durations are rounded to the 100ns resolution of a TimeSpan.
+func (m *Message) SetDuration(key string, d time.Duration) {
+	m.setProperty(key, formatTimeSpan(d))
+}
+
+// DurationProperty returns the user property as a duration, if it is a .NET TimeSpan string
+func (m *Message) DurationProperty(key string) (time.Duration, bool) {
+	s, ok := m.UserProperties[key].(string)
+	if !ok {
+		return 0, false
+	}
+	d, err := parseTimeSpan(s)
+	return d, err == nil
+}
+
+// SetDecimal sets a user property to a decimal number such as "-12.50", which decimal.Parse in .NET reads back
+// without the rounding a float64 would introduce. The AMQP library cannot write decimal128, so the number is sent in
+// its invariant string form. An error is returned if value is not a plain decimal of at most 28 significant digits.
+func (m *Message) SetDecimal(key, value string) error {
+	if !isDecimal(value) {
+		return fmt.Errorf("%q is not a decimal of at most %d digits", value, maxDecimalDigit)
+	}
+	m.setProperty(key, value)
+	return nil
+}
+
+// DecimalProperty returns the user property as a decimal string, if it is one
+func (m *Message) DecimalProperty(key string) (string, bool) {
+	s, ok := m.UserProperties[key].(string)
+	return s, ok && isDecimal(s)
+}
+
+func (m *Message) setProperty(key string, value interface{}) {
+	if m.UserProperties == nil {
+		m.UserProperties = make(map[string]interface{})
+	}
+	m.UserProperties[key] = value
+}
+
+// intProperty returns the user property as an int. Integers are sent as longs, but may be read back as any integer
+// type, or as text written by other clients.
+func (m *Message) intProperty(key string) (int, error) {
+	raw, ok := m.UserProperties[key]
+	if !ok {
+		return 0, ErrMissingField(key)
+	}
+
+	switch v := raw.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case string:
+		if parsed, err := strconv.Atoi(v); err == nil {
+			return parsed, nil
+		}
+	}
+	return 0, newErrIncorrectType(key, int64(0), raw)
+}
+
+func isDecimal(s string) bool {
+	parts := decimalPattern.FindStringSubmatch(s)
+	if parts == nil {
+		return false
+	}
+	digits := strings.TrimLeft(parts[1], "0") + parts[2]
+	return len(digits) <= maxDecimalDigit
+}
+
+func formatTimeSpan(d time.Duration) string {
+	sign := ""
+	ticks := int64(d.Round(ticksDuration) / ticksDuration)
+	if ticks < 0 {
+		sign = "-"
+		ticks = -ticks
+	}
+
+	fraction := ticks % ticksPerSecond
+	seconds := ticks / ticksPerSecond
+	days := seconds / 86400
+	s := fmt.Sprintf("%02d:%02d:%02d", seconds/3600%24, seconds/60%60, seconds%60)
+	if days > 0 {
+		s = fmt.Sprintf("%d.%s", days, s)
+	}
+	if fraction > 0 {
+		s = fmt.Sprintf("%s.%07d", s, fraction)
+	}
+	return sign + s
+}
+
+func parseTimeSpan(s string) (time.Duration, error) {
+	parts := timeSpanPattern.FindStringSubmatch(s)
+	if parts == nil {
+		return 0, fmt.Errorf("%q is not a TimeSpan", s)
+	}
+
+	var fields [5]int64
+	for i, part := range parts[2:] {
+		if i == 4 {
+			// fractions of a second are written to 7 digits, but may be shortened
+			part += strings.Repeat("0", 7-len(part))
+		}
+		if part == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		fields[i] = v
+	}
+
+	days, hours, minutes, seconds, fraction := fields[0], fields[1], fields[2], fields[3], fields[4]
+	if hours > 23 || minutes > 59 || seconds > 59 {
+		return 0, fmt.Errorf("%q is not a TimeSpan", s)
+	}
+	if days >= maxDurationDays {
+		return 0, fmt.Errorf("%q overflows a time.Duration", s)
+	}
+
+	total := ((days*24+hours)*60+minutes)*60 + seconds
+	d := time.Duration(total)*time.Second + time.Duration(fraction)*ticksDuration
+	if parts[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,73 @@
+package servicebus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_TypedProperties(t *testing.T) {
+	msg := NewMessageFromString("payload")
+
+	at := time.Date(2018, 10, 1, 12, 30, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+	msg.SetTime("at", at)
+	got, ok := msg.TimeProperty("at")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2018, 10, 1, 10, 30, 0, 123000000, time.UTC), got)
+
+	msg.SetDuration("ttl", 26*time.Hour+3*time.Minute+4*time.Second+500*time.Millisecond)
+	assert.Equal(t, "1.02:03:04.5000000", msg.UserProperties["ttl"])
+	d, ok := msg.DurationProperty("ttl")
+	assert.True(t, ok)
+	assert.Equal(t, 26*time.Hour+3*time.Minute+4*time.Second+500*time.Millisecond, d)
+
+	assert.NoError(t, msg.SetDecimal("price", "-12.50"))
+	price, ok := msg.DecimalProperty("price")
+	assert.True(t, ok)
+	assert.Equal(t, "-12.50", price)
+	assert.Error(t, msg.SetDecimal("price", "1e5"))
+	assert.Error(t, msg.SetDecimal("price", "12345678901234567890.123456789"))
+
+	_, ok = msg.TimeProperty("ttl")
+	assert.False(t, ok)
+	_, ok = msg.DurationProperty("missing")
+	assert.False(t, ok)
+}
+
+func TestTimeSpan(t *testing.T) {
+	cases := map[string]time.Duration{
+		"00:00:00":            0,
+		"00:00:01":            time.Second,
+		"-00:01:00":           -time.Minute,
+		"23:59:59.9999999":    24*time.Hour - 100*time.Nanosecond,
+		"10675.00:00:00":      10675 * 24 * time.Hour,
+		"00:00:00.0000001":    100 * time.Nanosecond,
+		"-1.00:00:00.2500000": -(24*time.Hour + 250*time.Millisecond),
+	}
+	for s, d := range cases {
+		assert.Equal(t, s, formatTimeSpan(d))
+		parsed, err := parseTimeSpan(s)
+		assert.NoError(t, err)
+		assert.Equal(t, d, parsed, s)
+	}
+
+	parsed, err := parseTimeSpan("00:00:00.5")
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, parsed)
+
+	for _, s := range []string{"", "1:2", "00:60:00", "24:00:00", "abc", "200000.00:00:00"} {
+		_, err := parseTimeSpan(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMessage_DeadLetterProperties(t *testing.T) {
+	msg := NewMessageFromString("payload")
+	assert.Empty(t, msg.DeadLetterReason())
+
+	msg.Set(DeadLetterReasonProperty, "MaxDeliveryCountExceeded")
+	msg.Set(DeadLetterErrorDescriptionProperty, "Message could not be consumed after 10 delivery attempts.")
+	assert.Equal(t, "MaxDeliveryCountExceeded", msg.DeadLetterReason())
+	assert.Equal(t, "Message could not be consumed after 10 delivery attempts.", msg.DeadLetterErrorDescription())
+}
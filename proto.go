@@ -0,0 +1,68 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ProtobufContentType is the content type of messages built with NewProtoMessage
+	ProtobufContentType = "application/x-protobuf"
+	// ProtoTypeNameProperty is the user property which carries the full name of the protobuf message type
+	ProtoTypeNameProperty = "proto-type-name"
+)
+
+// NewProtoMessage builds a message whose payload is the protobuf encoding of pm. The content type is set to
+// application/x-protobuf and the full name of the message type is recorded in the ProtoTypeNameProperty user property.
+func NewProtoMessage(pm proto.Message) (*Message, error) {
+	var codec ProtobufCodec
+	data, err := codec.Encode(pm)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := NewMessage(data)
+	msg.ContentType = codec.ContentType()
+	msg.Set(ProtoTypeNameProperty, string(pm.ProtoReflect().Descriptor().FullName()))
+	return msg, nil
+}
+
+// UnmarshalProto decodes the protobuf payload of the message into dst. If the message carries a type name, it must
+// match the type of dst.
+func (m *Message) UnmarshalProto(dst proto.Message) error {
+	if m.ContentType != "" && m.ContentType != ProtobufContentType {
+		return fmt.Errorf("message content type %q is not %q", m.ContentType, ProtobufContentType)
+	}
+
+	if typeName, ok := m.UserProperties[ProtoTypeNameProperty]; ok {
+		want := string(dst.ProtoReflect().Descriptor().FullName())
+		if typeName != want {
+			return fmt.Errorf("message contains %v, but was unmarshalled into %s", typeName, want)
+		}
+	}
+
+	return ProtobufCodec{}.Decode(m.Data, dst)
+}
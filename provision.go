@@ -0,0 +1,105 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"strings"
+
+	"pack.ag/amqp"
+)
+
+// isEntityNotFound reports whether err is the broker refusing a link or a claim because the entity does not exist
+func isEntityNotFound(err error) bool {
+	var amqpErr *amqp.Error
+	switch e := err.(type) {
+	case ErrEntityNotFound:
+		return true
+	case *amqp.Error:
+		amqpErr = e
+	case *amqp.DetachError:
+		amqpErr = e.RemoteError
+	default:
+		// claims are negotiated over the management link, which reports a missing entity with an HTTP status code
+		return err != nil && strings.Contains(err.Error(), "status code 404")
+	}
+	return amqpErr != nil && amqpErr.Condition == amqp.ErrorNotFound
+}
+
+// entityNotFound converts errors reporting that entityPath does not exist into ErrEntityNotFound
+func entityNotFound(entityPath string, err error) error {
+	if isEntityNotFound(err) {
+		return ErrEntityNotFound{EntityPath: entityPath}
+	}
+	return err
+}
+
+// withAutoProvision runs op, and if it fails with ErrEntityNotFound and the options ask for it, provisions the entity
+// then runs op once more
+func withAutoProvision(ctx context.Context, options *receiveOptions, provision func(context.Context) error, op func() error) error {
+	err := op()
+	if _, ok := err.(ErrEntityNotFound); !ok || !options.autoProvision {
+		return err
+	}
+
+	if err := provision(ctx); err != nil {
+		return err
+	}
+	return op()
+}
+
+// provision creates the Queue, with the options of QueueWithAutoProvision if any, if it does not exist
+func (q *Queue) provision(ctx context.Context) error {
+	qm := q.namespace.NewQueueManager()
+	existing, err := qm.Get(ctx, q.Name)
+	if err != nil || existing != nil {
+		return err
+	}
+	_, err = qm.Put(ctx, q.Name, q.provisionOptions...)
+	return err
+}
+
+// provision creates the Topic and the Subscription with the default settings if they do not exist
+func (s *Subscription) provision(ctx context.Context) error {
+	tm := s.namespace.NewTopicManager()
+	topic, err := tm.Get(ctx, s.Topic.Name)
+	if err != nil {
+		return err
+	}
+	if topic == nil {
+		if _, err := tm.Put(ctx, s.Topic.Name); err != nil {
+			return err
+		}
+	}
+
+	sm, err := s.namespace.NewSubscriptionManager(s.Topic.Name)
+	if err != nil {
+		return err
+	}
+	existing, err := sm.Get(ctx, s.Name)
+	if err != nil || existing != nil {
+		return err
+	}
+	_, err = sm.Put(ctx, s.Name)
+	return err
+}
@@ -0,0 +1,107 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+var (
+	_ MessageReceiver = (*Queue)(nil)
+	_ MessageReceiver = (*Subscription)(nil)
+)
+
+func TestIsEntityNotFound(t *testing.T) {
+	notFound := &amqp.Error{Condition: amqp.ErrorNotFound, Description: "The messaging entity could not be found"}
+	assert.True(t, isEntityNotFound(notFound))
+	assert.True(t, isEntityNotFound(&amqp.DetachError{RemoteError: notFound}))
+	assert.True(t, isEntityNotFound(errors.New("unhandled error link 1: status code 404 and description: not found")))
+	assert.True(t, isEntityNotFound(ErrEntityNotFound{EntityPath: "foo"}))
+
+	assert.False(t, isEntityNotFound(nil))
+	assert.False(t, isEntityNotFound(&amqp.Error{Condition: amqp.ErrorUnauthorizedAccess}))
+	assert.False(t, isEntityNotFound(&amqp.DetachError{}))
+	assert.False(t, isEntityNotFound(amqp.ErrConnClosed))
+
+	assert.Equal(t, ErrEntityNotFound{EntityPath: "foo"}, entityNotFound("foo", notFound))
+	assert.Equal(t, amqp.ErrConnClosed, entityNotFound("foo", amqp.ErrConnClosed))
+	assert.EqualError(t, ErrEntityNotFound{EntityPath: "foo"}, `entity "foo" not found`)
+}
+
+func TestWithAutoProvision(t *testing.T) {
+	missing := ErrEntityNotFound{EntityPath: "foo"}
+	newOp := func(results ...error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			err := results[calls]
+			calls++
+			return err
+		}, &calls
+	}
+	provisioned := 0
+	provision := func(context.Context) error {
+		provisioned++
+		return nil
+	}
+
+	options, err := newReceiveOptions(ReceiveWithAutoProvision())
+	if !assert.NoError(t, err) {
+		return
+	}
+	op, calls := newOp(missing, nil)
+	assert.NoError(t, withAutoProvision(context.Background(), options, provision, op))
+	assert.Equal(t, 2, *calls)
+	assert.Equal(t, 1, provisioned)
+
+	// without the option the error is returned straight away
+	defaults, err := newReceiveOptions()
+	if !assert.NoError(t, err) {
+		return
+	}
+	op, calls = newOp(missing)
+	assert.Equal(t, missing, withAutoProvision(context.Background(), defaults, provision, op))
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, 1, provisioned)
+
+	// other errors are never a reason to provision
+	other := errors.New("boom")
+	op, _ = newOp(other)
+	assert.Equal(t, other, withAutoProvision(context.Background(), options, provision, op))
+	assert.Equal(t, 1, provisioned)
+
+	denied := errors.New("not authorized to manage entities")
+	op, calls = newOp(missing)
+	assert.Equal(t, denied, withAutoProvision(context.Background(), options, func(context.Context) error {
+		return denied
+	}, op))
+	assert.Equal(t, 1, *calls)
+}
+
+func TestQueueWithAutoProvision(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("foo", QueueWithAutoProvision(QueueEntityWithPartitioning(), QueueEntityWithRequiredSessions()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, q.autoProvision)
+
+	qd := new(QueueDescription)
+	for _, opt := range q.provisionOptions {
+		assert.NoError(t, opt(qd))
+	}
+	assert.Equal(t, ptrBool(true), qd.EnablePartitioning)
+	assert.Equal(t, ptrBool(true), qd.RequiresSession)
+
+	q, err = ns.NewQueue("foo", QueueWithAutoProvision())
+	if assert.NoError(t, err) {
+		assert.True(t, q.autoProvision)
+		assert.Empty(t, q.provisionOptions)
+	}
+}
@@ -0,0 +1,149 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	defaultPurgeBatchSize = 100
+)
+
+type (
+	// PurgeOption configures Queue.Purge
+	PurgeOption func(*purgeOptions) error
+
+	// PurgeProgress is called after each batch of messages is purged with the number of messages purged so far
+	PurgeProgress func(purged int)
+
+	purgeOptions struct {
+		batchSize int
+		progress  PurgeProgress
+		rate      float64
+		limiter   *rateLimiter
+	}
+)
+
+// PurgeWithBatchSize configures how many messages are received and deleted at a time. The default is 100.
+func PurgeWithBatchSize(size int) PurgeOption {
+	return func(o *purgeOptions) error {
+		if size < 1 {
+			return errors.New("batch size must be at least 1")
+		}
+		o.batchSize = size
+		return nil
+	}
+}
+
+// PurgeWithProgress configures a func which is called after each batch with the number of messages purged so far
+func PurgeWithProgress(progress PurgeProgress) PurgeOption {
+	return func(o *purgeOptions) error {
+		o.progress = progress
+		return nil
+	}
+}
+
+// PurgeWithRateLimit limits the rate at which messages are purged to roughly msgsPerSecond, so that emptying a large
+// queue does not use up the throughput the namespace needs for other work. The rate is applied to each batch before it
+// is requested, but the purging receiver keeps a batch of credit with the broker, which delivers, and so deletes, up to
+// a batch of messages ahead of the limit. The rate is therefore a lower bound on how fast messages are deleted.
+func PurgeWithRateLimit(msgsPerSecond float64) PurgeOption {
+	return func(o *purgeOptions) error {
+		if msgsPerSecond <= 0 {
+			return errors.New("rate must be greater than 0")
+		}
+		o.rate = msgsPerSecond
+		return nil
+	}
+}
+
+// Purge deletes every message from the Queue and returns how many were deleted. Messages are received in
+// ReceiveAndDelete mode on a receiver of their own, so the Queue's own receiver is unaffected, and the purge finishes
+// once no further message arrives for a few seconds. Purge does not apply to queues which require sessions.
+//
+// Messages are gone as soon as the broker delivers them. pack.ag/amqp cannot grant the broker credit for one batch at
+// a time, so the receiver prefetches up to a batch of messages, and a purge which fails or is cancelled part way
+// through may have deleted up to a batch more messages than it counted. The count is then a lower bound.
+func (q *Queue) Purge(ctx context.Context, opts ...PurgeOption) (int, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.Purge")
+	defer span.End()
+
+	options := &purgeOptions{batchSize: defaultPurgeBatchSize}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return 0, err
+		}
+	}
+	if options.rate > 0 {
+		// a whole batch is requested at once, so the burst must allow for one
+		limiter, err := newRateLimiter(options.rate, options.batchSize, q.namespace.getClock)
+		if err != nil {
+			return 0, err
+		}
+		options.limiter = limiter
+	}
+
+	r, err := q.namespace.newReceiver(ctx, q.Name, receiverWithReceiveMode(ReceiveAndDeleteMode),
+		receiverWithPrefetchCount(uint32(options.batchSize)))
+	if err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+	defer r.Close(ctx)
+
+	return purge(ctx, options, func(ctx context.Context, maxMessages int, handler Handler) error {
+		return r.ReceiveBatch(ctx, maxMessages, handler, purgeWaitTime)
+	})
+}
+
+// purge receives batches of messages until none are left, counting the messages received
+func purge(ctx context.Context, options *purgeOptions, receiveBatch func(context.Context, int, Handler) error) (int, error) {
+	purged := 0
+	count := HandlerFunc(func(context.Context, *Message) DispositionAction {
+		purged++
+		return nil
+	})
+
+	for {
+		if err := options.limiter.wait(ctx, options.batchSize); err != nil {
+			return purged, err
+		}
+
+		err := receiveBatch(ctx, options.batchSize, count)
+		if _, ok := err.(ErrNoMessages); ok {
+			return purged, nil
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			return purged, err
+		}
+
+		if options.progress != nil {
+			options.progress(purged)
+		}
+	}
+}
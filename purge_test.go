@@ -0,0 +1,92 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// batchesOf returns a receiveBatch func which hands out total messages in batches, then reports ErrNoMessages
+func batchesOf(total int) func(context.Context, int, Handler) error {
+	return func(ctx context.Context, maxMessages int, handler Handler) error {
+		if total == 0 {
+			return ErrNoMessages{}
+		}
+		for i := 0; i < maxMessages && total > 0; i++ {
+			handler.Handle(ctx, NewMessageFromString("purge me"))
+			total--
+		}
+		return nil
+	}
+}
+
+func TestPurge_ReportsProgress(t *testing.T) {
+	var progress []int
+	options := &purgeOptions{batchSize: 10}
+	assert.NoError(t, PurgeWithProgress(func(purged int) { progress = append(progress, purged) })(options))
+
+	purged, err := purge(context.Background(), options, batchesOf(25))
+	assert.NoError(t, err)
+	assert.Equal(t, 25, purged)
+	assert.Equal(t, []int{10, 20, 25}, progress)
+}
+
+func TestPurge_StopsOnError(t *testing.T) {
+	failure := errors.New("link detached")
+	receive := batchesOf(15)
+	calls := 0
+	purged, err := purge(context.Background(), &purgeOptions{batchSize: 10}, func(ctx context.Context, n int, h Handler) error {
+		calls++
+		if calls == 2 {
+			return failure
+		}
+		return receive(ctx, n, h)
+	})
+	assert.Equal(t, failure, err)
+	assert.Equal(t, 10, purged)
+}
+
+func TestPurge_RateLimit(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	limiter, err := newRateLimiter(10, 10, func() Clock { return clock })
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		purged, _ := purge(context.Background(), &purgeOptions{batchSize: 10, limiter: limiter}, batchesOf(20))
+		done <- purged
+	}()
+
+	// the first batch is within the burst, the second waits a second for the bucket to refill
+	clock.waitForCalls(1)
+	select {
+	case <-done:
+		t.Fatal("the purge should wait for the rate limit")
+	default:
+	}
+	clock.Advance(time.Second)
+	clock.waitForCalls(2)
+	clock.Advance(time.Second)
+
+	select {
+	case purged := <-done:
+		assert.Equal(t, 20, purged)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the purge did not finish once the rate limit allowed")
+	}
+}
+
+func TestPurgeOptions(t *testing.T) {
+	options := new(purgeOptions)
+	assert.Error(t, PurgeWithBatchSize(0)(options))
+	assert.Error(t, PurgeWithRateLimit(0)(options))
+	assert.NoError(t, PurgeWithBatchSize(5)(options))
+	assert.NoError(t, PurgeWithRateLimit(50)(options))
+	assert.Equal(t, 5, options.batchSize)
+	assert.Equal(t, float64(50), options.rate)
+}
@@ -56,6 +56,20 @@ type (
 		senderMu          sync.Mutex
 		receiveMode       ReceiveMode
 		requiredSessionID *string
+		settlementHook    SettlementHook
+		sendLimiter       *rateLimiter
+		prefetchCount     uint32
+		autoLockRenewal   time.Duration
+		autoProvision     bool
+		provisionOptions  []QueueManagementOption
+		codecs            *CodecRegistry
+		schemas           *SchemaEncoder
+		contentType       string
+		senderLinkOptions []SenderLinkOption
+		pending           pendingSends
+		managementMu      sync.Mutex
+		management        *rpc.Link
+		managementConn    *amqp.Client
 	}
 
 	// queueContent is a specialized Queue body for an Atom entry
@@ -65,7 +79,8 @@ type (
 		QueueDescription QueueDescription `xml:"QueueDescription"`
 	}
 
-	// QueueDescription is the content type for Queue management requests
+	// QueueDescription is the content type for Queue management requests. It is written in the order of the service's
+	// schema, as the service ignores elements which are out of place.
 	QueueDescription struct {
 		XMLName xml.Name `xml:"QueueDescription"`
 		BaseEntityDescription
@@ -82,6 +97,7 @@ type (
 		MessageCount                        *int64        `xml:"MessageCount,omitempty"`                        // MessageCount - The number of messages in the queue.
 		IsAnonymousAccessible               *bool         `xml:"IsAnonymousAccessible,omitempty"`
 		Status                              *EntityStatus `xml:"Status,omitempty"`
+		ForwardTo                           *string       `xml:"ForwardTo,omitempty"`
 		CreatedAt                           *date.Time    `xml:"CreatedAt,omitempty"`
 		UpdatedAt                           *date.Time    `xml:"UpdatedAt,omitempty"`
 		SupportOrdering                     *bool         `xml:"SupportOrdering,omitempty"`
@@ -89,6 +105,8 @@ type (
 		EnablePartitioning                  *bool         `xml:"EnablePartitioning,omitempty"`
 		EnableExpress                       *bool         `xml:"EnableExpress,omitempty"`
 		CountDetails                        *CountDetails `xml:"CountDetails,omitempty"`
+		// Extensions holds the elements of the description which are not modeled above, so that they survive an Update
+		Extensions []RawXMLElement `xml:",any"`
 	}
 
 	// QueueOption represents named options for assisting Queue message handling
@@ -106,6 +124,42 @@ const (
 	ReceiveAndDeleteMode ReceiveMode = 1
 )
 
+// queueDescriptionSchema lists the elements of a QueueDescription in the order the service expects them
+var queueDescriptionSchema = []string{
+	"LockDuration",
+	"MaxSizeInMegabytes",
+	"RequiresDuplicateDetection",
+	"RequiresSession",
+	"DefaultMessageTimeToLive",
+	"DeadLetteringOnMessageExpiration",
+	"DuplicateDetectionHistoryTimeWindow",
+	"MaxDeliveryCount",
+	"EnableBatchedOperations",
+	"SizeInBytes",
+	"MessageCount",
+	"IsAnonymousAccessible",
+	"AuthorizationRules",
+	"Status",
+	"ForwardTo",
+	"UserMetadata",
+	"CreatedAt",
+	"UpdatedAt",
+	"AccessedAt",
+	"SupportOrdering",
+	"CountDetails",
+	"AutoDeleteOnIdle",
+	"EnablePartitioning",
+	"EntityAvailabilityStatus",
+	"EnableExpress",
+	"ForwardDeadLetteredMessagesTo",
+	"MaxMessageSizeInKilobytes",
+}
+
+// MarshalXML writes the description with its Extensions back in their place among the modeled elements
+func (qd QueueDescription) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalInSchemaOrder(e, start, qd.BaseEntityDescription, qd, qd.Extensions, queueDescriptionSchema)
+}
+
 // QueueWithReceiveAndDelete configures a queue to pop and delete messages off of the queue upon receiving the message.
 // This differs from the default, PeekLock, where PeekLock receives a message, locks it for a period of time, then sends
 // a disposition to the broker when the message has been processed.
@@ -116,6 +170,53 @@ func QueueWithReceiveAndDelete() QueueOption {
 	}
 }
 
+// QueueWithSettlementHook configures a queue to call the hook each time the broker acknowledges the settlement of a
+// received message.
+func QueueWithSettlementHook(hook SettlementHook) QueueOption {
+	return func(q *Queue) error {
+		q.settlementHook = hook
+		return nil
+	}
+}
+
+// QueueWithPrefetchCount configures the queue to request up to count messages from the broker ahead of the handler
+// asking for them. The default is 1. A higher prefetch count improves throughput, but prefetched messages held in
+// PeekLock mode have their lock running while they wait to be handled.
+func QueueWithPrefetchCount(count uint32) QueueOption {
+	return func(q *Queue) error {
+		if count < 1 {
+			return errors.New("prefetch count must be at least 1")
+		}
+		q.prefetchCount = count
+		return nil
+	}
+}
+
+// QueueWithAutoLockRenewal configures the queue to keep renewing the lock of each PeekLock message while its handler
+// is running, for up to maxDuration after the message was received. This lets handlers run for longer than the lock
+// duration of the queue without the message being redelivered to another receiver.
+func QueueWithAutoLockRenewal(maxDuration time.Duration) QueueOption {
+	return func(q *Queue) error {
+		if maxDuration <= 0 {
+			return errors.New("auto lock renewal duration must be greater than 0")
+		}
+		q.autoLockRenewal = maxDuration
+		return nil
+	}
+}
+
+// QueueWithAutoProvision configures the queue to create itself with the provided management options, using the
+// QueueManager of the namespace, before the first message is sent if it does not exist yet. This simplifies bootstrapping
+// development and test environments, and the use of ephemeral queues. The credentials of the namespace must grant the
+// Manage right. The same options are used when a receive with ReceiveWithAutoProvision finds the queue missing.
+func QueueWithAutoProvision(opts ...QueueManagementOption) QueueOption {
+	return func(q *Queue) error {
+		q.autoProvision = true
+		q.provisionOptions = opts
+		return nil
+	}
+}
+
 //// QueueWithRequiredSession configures a queue to use a session
 //func QueueWithRequiredSession(sessionID string) QueueOption {
 //	return func(q *Queue) error {
@@ -126,6 +227,10 @@ func QueueWithReceiveAndDelete() QueueOption {
 
 // NewQueue creates a new Queue Sender / Receiver
 func (ns *Namespace) NewQueue(name string, opts ...QueueOption) (*Queue, error) {
+	if err := ns.checkEntityPath(name); err != nil {
+		return nil, err
+	}
+
 	queue := &Queue{
 		entity: &entity{
 			namespace: ns,
@@ -139,13 +244,28 @@ func (ns *Namespace) NewQueue(name string, opts ...QueueOption) (*Queue, error)
 			return nil, err
 		}
 	}
+
+	ns.children.track(queue)
 	return queue, nil
 }
 
 // Send sends messages to the Queue
 func (q *Queue) Send(ctx context.Context, event *Message) error {
+	defer q.pending.add(1)()
+	return q.send(ctx, event)
+}
+
+func (q *Queue) send(ctx context.Context, event *Message) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.Send")
-	defer span.Finish()
+	defer span.End()
+
+	if err := q.schemas.validate(ctx, event); err != nil {
+		return err
+	}
+
+	if err := q.sendLimiter.wait(ctx, 1); err != nil {
+		return err
+	}
 
 	err := q.ensureSender(ctx)
 	if err != nil {
@@ -155,6 +275,21 @@ func (q *Queue) Send(ctx context.Context, event *Message) error {
 	return q.sender.Send(ctx, event)
 }
 
+// SendAsync sends a message to the Queue without waiting for the broker to acknowledge it. The returned channel
+// receives nil once the broker accepts the transfer, or the error if it is rejected or the send fails, and is then
+// closed. Concurrent calls to SendAsync are pipelined over the same link, so the order in which their messages are
+// enqueued is not guaranteed.
+func (q *Queue) SendAsync(ctx context.Context, event *Message) <-chan error {
+	done := make(chan error, 1)
+	settled := q.pending.add(1)
+	go func() {
+		defer close(done)
+		defer settled()
+		done <- q.send(ctx, event)
+	}()
+	return done
+}
+
 // ScheduleAt will send a batch of messages to a Queue, schedule them to be enqueued, and return the sequence numbers
 // that can be used to cancel each message.
 func (q *Queue) ScheduleAt(ctx context.Context, enqueueTime time.Time, messages ...*Message) ([]int64, error) {
@@ -200,6 +335,10 @@ func (q *Queue) ScheduleAt(ctx context.Context, enqueueTime time.Time, messages
 		transformed = append(transformed, individualMessage)
 	}
 
+	if err := q.sendLimiter.wait(ctx, len(messages)); err != nil {
+		return nil, err
+	}
+
 	msg := &amqp.Message{
 		ApplicationProperties: map[string]interface{}{
 			operationFieldName: scheduleMessageOperationID,
@@ -210,7 +349,7 @@ func (q *Queue) ScheduleAt(ctx context.Context, enqueueTime time.Time, messages
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
-		msg.ApplicationProperties[serverTimeoutFieldName] = uint(time.Until(deadline) / time.Millisecond)
+		msg.ApplicationProperties[serverTimeoutFieldName] = uint(q.namespace.until(deadline) / time.Millisecond)
 	}
 
 	err := q.ensureSender(ctx)
@@ -263,7 +402,7 @@ func (q *Queue) CancelScheduled(ctx context.Context, seq ...int64) error {
 	}
 
 	if deadline, ok := ctx.Deadline(); ok {
-		msg.ApplicationProperties[serverTimeoutFieldName] = uint(time.Until(deadline) / time.Millisecond)
+		msg.ApplicationProperties[serverTimeoutFieldName] = uint(q.namespace.until(deadline) / time.Millisecond)
 	}
 
 	err := q.ensureSender(ctx)
@@ -298,12 +437,22 @@ func (q *Queue) CancelScheduled(ctx context.Context, seq ...int64) error {
 // unable to complete the operation, or an empty slice of messages and an instance of "ErrNoMessages" signifying that
 // there are currently no messages in the queue with a sequence ID larger than previously viewed ones.
 func (q *Queue) Peek(ctx context.Context, options ...PeekOption) (MessageIterator, error) {
+	it, err := q.NewPeekIterator(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// NewPeekIterator creates a PeekIterator over the queue. Pass the Cursor of an earlier iterator with PeekFromCursor to
+// continue browsing where it stopped.
+func (q *Queue) NewPeekIterator(ctx context.Context, options ...PeekOption) (*PeekIterator, error) {
 	err := q.ensureReceiver(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return newPeekIterator(q.entity, q.receiver.connection, options...)
+	return newPeekIterator(q.entity, q.Name, q.receiver.connection, options...)
 }
 
 // PeekOne fetches a single Message from the Service Bus broker without acquiring a lock or committing to a disposition.
@@ -319,98 +468,142 @@ func (q *Queue) PeekOne(ctx context.Context, options ...PeekOption) (*Message, e
 	//   be unread.
 	options = append(options, PeekWithPageSize(1))
 
-	it, err := newPeekIterator(q.entity, q.receiver.connection, options...)
+	it, err := newPeekIterator(q.entity, q.Name, q.receiver.connection, options...)
 	if err != nil {
 		return nil, err
 	}
 	return it.Next(ctx)
 }
 
-// ReceiveOne will listen to receive a single message. ReceiveOne will only wait as long as the context allows.
-func (q *Queue) ReceiveOne(ctx context.Context, handler Handler) error {
+// ReceiveOne will listen to receive a single message. ReceiveOne will only wait as long as the context allows, or up
+// to the duration configured with WithMaxWaitTime, in which case ErrNoMessages is returned if no message arrives.
+func (q *Queue) ReceiveOne(ctx context.Context, handler Handler, opts ...ReceiveOption) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ReceiveOne")
-	defer span.Finish()
+	defer span.End()
+
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
+		return err
+	}
+	handler = options.wrap(q.namespace, handler)
+
+	err = withAutoProvision(ctx, options, q.provision, func() error {
+		if err := q.ensureReceiver(ctx); err != nil {
+			return err
+		}
+		return q.receiver.ReceiveOne(ctx, handler, options.maxWaitTime)
+	})
+	return options.filteredOut(err)
+}
 
-	if err := q.ensureReceiver(ctx); err != nil {
+// ReceiveBatch receives up to maxMessages messages, passing each to the handler as it arrives. It waits as long as the
+// context allows, or up to the duration configured with WithMaxWaitTime, for the first message, then returns once
+// maxMessages have been handled or no further message is immediately available. ErrNoMessages is returned if the wait
+// time elapses without any message arriving.
+func (q *Queue) ReceiveBatch(ctx context.Context, maxMessages int, handler Handler, opts ...ReceiveOption) error {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ReceiveBatch")
+	defer span.End()
+
+	if maxMessages < 1 {
+		return errors.New("maxMessages must be at least 1")
+	}
+
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
 		return err
 	}
+	handler = options.wrap(q.namespace, handler)
 
-	return q.receiver.ReceiveOne(ctx, handler)
+	err = withAutoProvision(ctx, options, q.provision, func() error {
+		if err := q.ensureReceiver(ctx); err != nil {
+			return err
+		}
+		return q.receiver.ReceiveBatch(ctx, maxMessages, handler, options.maxWaitTime)
+	})
+	return options.filteredOut(err)
 }
 
-// Receive subscribes for messages sent to the Queue
-func (q *Queue) Receive(ctx context.Context, handler Handler) error {
+// Receive subscribes for messages sent to the Queue. ErrEntityNotFound is returned promptly if the Queue does not exist,
+// unless ReceiveWithAutoProvision is used to create it.
+func (q *Queue) Receive(ctx context.Context, handler Handler, opts ...ReceiveOption) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.Receive")
-	defer span.Finish()
+	defer span.End()
 
-	err := q.ensureReceiver(ctx)
+	options, err := newReceiveOptions(opts...)
 	if err != nil {
 		return err
 	}
+	handler = options.wrap(q.namespace, handler)
+
+	return withAutoProvision(ctx, options, q.provision, func() error {
+		if err := q.ensureReceiver(ctx); err != nil {
+			return err
+		}
 
-	handle := q.receiver.Listen(ctx, handler)
-	<-handle.Done()
-	return handle.Err()
+		handle := q.receiver.Listen(ctx, handler)
+		options.ready()
+		<-handle.Done()
+		return handle.Err()
+	})
 }
 
 // ReceiveOneSession waits for the lock on a particular session to become available, takes it, then process the session.
-func (q *Queue) ReceiveOneSession(ctx context.Context, sessionID *string, handler SessionHandler) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
+func (q *Queue) ReceiveOneSession(ctx context.Context, sessionID *string, handler SessionHandler, opts ...ReceiveOption) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ReceiveOneSession")
-	defer span.Finish()
-
-	// Establish a receiver that reads a particular session.
-	q.requiredSessionID = sessionID
-	if err := q.ensureReceiver(ctx, receiverWithSession(sessionID)); err != nil {
-		return err
-	}
+	defer span.End()
 
-	ms, err := newMessageSession(q.receiver, q.entity, sessionID)
+	options, err := newReceiveOptions(opts...)
 	if err != nil {
 		return err
 	}
 
-	err = handler.Start(ms)
-	if err != nil {
+	// Establish a receiver that reads a particular session.
+	q.requiredSessionID = sessionID
+	if err := q.ensureReceiver(ctx, receiverWithSession(sessionID)); err != nil {
 		return err
 	}
 
-	defer handler.End()
-	handle := q.receiver.Listen(ctx, handler)
-
-	select {
-	case <-handle.Done():
-		return handle.Err()
-	case <-ms.done:
-		return nil
-	}
+	return handleSession(ctx, q.entity, q.receiver, sessionID, handler, options)
 }
 
 // ReceiveSessions is the session-based counterpart of `Receive`. It subscribes to a Queue and waits for new sessions to
-// become available.
-func (q *Queue) ReceiveSessions(ctx context.Context, handler SessionHandler) error {
+// become available. By default one session is processed at a time; use WithMaxConcurrentSessions to drain a
+// session-enabled queue with bounded parallelism.
+func (q *Queue) ReceiveSessions(ctx context.Context, handler SessionHandler, opts ...ReceiveOption) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ReceiveSessions")
-	defer span.Finish()
+	defer span.End()
 
-	for {
-		if err := q.ReceiveOneSession(ctx, nil, handler); err != nil {
-			return err
-		}
+	return receiveSessions(ctx, q.entity, q.newSessionReceiver, handler, opts...)
+}
+
+// newSessionReceiver builds a receiver, independent of the Queue's own receiver, which is locked to a session
+func (q *Queue) newSessionReceiver(ctx context.Context, sessionID *string) (*receiver, error) {
+	return q.namespace.newReceiver(ctx, q.Name, q.receiverOptions(receiverWithSession(sessionID))...)
+}
+
+// receiverOptions appends the Queue's receive configuration to the provided options
+func (q *Queue) receiverOptions(opts ...receiverOption) []receiverOption {
+	opts = append(opts, receiverWithReceiveMode(q.receiveMode), receiverWithSettlementHook(q.settlementHook))
+	if q.prefetchCount > 0 {
+		opts = append(opts, receiverWithPrefetchCount(q.prefetchCount))
+	}
+	if q.codecs != nil {
+		opts = append(opts, receiverWithCodecs(q.codecs))
 	}
+	if q.autoLockRenewal > 0 {
+		opts = append(opts, receiverWithAutoLockRenewal(q.autoLockRenewal, q.RenewLocks))
+	}
+	return opts
 }
 
 func (q *Queue) ensureReceiver(ctx context.Context, opts ...receiverOption) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ensureReceiver")
-	defer span.Finish()
+	defer span.End()
 
 	q.receiverMu.Lock()
 	defer q.receiverMu.Unlock()
 
-	opts = append(opts, receiverWithReceiveMode(q.receiveMode))
-
-	receiver, err := q.namespace.newReceiver(ctx, q.Name, opts...)
+	receiver, err := q.namespace.newReceiver(ctx, q.Name, q.receiverOptions(opts...)...)
 	if err != nil {
 		log.For(ctx).Error(err)
 		return err
@@ -423,7 +616,13 @@ func (q *Queue) ensureReceiver(ctx context.Context, opts ...receiverOption) erro
 // Close the underlying connection to Service Bus
 func (q *Queue) Close(ctx context.Context) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.Close")
-	defer span.Finish()
+	defer span.End()
+
+	q.namespace.children.untrack(q)
+
+	if err := q.closeManagementLink(ctx); err != nil {
+		log.For(ctx).Error(err)
+	}
 
 	if q.receiver != nil {
 		if err := q.receiver.Close(ctx); err != nil {
@@ -442,17 +641,24 @@ func (q *Queue) Close(ctx context.Context) error {
 
 func (q *Queue) ensureSender(ctx context.Context) error {
 	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ensureSender")
-	defer span.Finish()
+	defer span.End()
 
 	q.senderMu.Lock()
 	defer q.senderMu.Unlock()
 
-	var opts []senderOption
+	opts := withSenderLinkOptions(q.senderLinkOptions)
 	if q.requiredSessionID != nil {
 		opts = append(opts, sendWithSession(*q.requiredSessionID))
 	}
 
 	if q.sender == nil {
+		if q.autoProvision {
+			if err := q.provision(ctx); err != nil {
+				log.For(ctx).Error(err)
+				return err
+			}
+		}
+
 		s, err := q.namespace.newSender(ctx, q.Name, opts...)
 		if err != nil {
 			log.For(ctx).Error(err)
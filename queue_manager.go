@@ -17,6 +17,7 @@ type (
 	// QueueManager provides CRUD functionality for Service Bus Queues
 	QueueManager struct {
 		*entityManager
+		cache *entityCache
 	}
 
 	// QueueEntity is the Azure Service Bus description of a Queue for management activities
@@ -170,27 +171,33 @@ func QueueEntityWithMaxDeliveryCount(count int32) QueueManagementOption {
 // NewQueueManager creates a new QueueManager for a Service Bus Namespace
 func (ns *Namespace) NewQueueManager() *QueueManager {
 	return &QueueManager{
-		entityManager: newEntityManager(ns.getHTTPSHostURI(), ns.TokenProvider),
+		entityManager: ns.newEntityManager(),
+		cache:         ns.managementCache,
 	}
 }
 
 // Delete deletes a Service Bus Queue entity by name
 func (qm *QueueManager) Delete(ctx context.Context, name string) error {
 	span, ctx := qm.startSpanFromContext(ctx, "sb.QueueManager.Delete")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := qm.entityManager.Delete(ctx, "/"+name)
+	qm.Invalidate(name)
 	if res != nil {
 		defer res.Body.Close()
 	}
 
-	return err
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return checkDeleteResponse(res)
 }
 
 // Put creates or updates a Service Bus Queue
 func (qm *QueueManager) Put(ctx context.Context, name string, opts ...QueueManagementOption) (*QueueEntity, error) {
 	span, ctx := qm.startSpanFromContext(ctx, "sb.QueueManager.Put")
-	defer span.Finish()
+	defer span.End()
 
 	qd := new(QueueDescription)
 	for _, opt := range opts {
@@ -200,6 +207,41 @@ func (qm *QueueManager) Put(ctx context.Context, name string, opts ...QueueManag
 		}
 	}
 
+	return qm.put(ctx, name, qd)
+}
+
+// Update applies the options to the description of an existing queue, as returned by Get or List, and writes it back.
+// Properties of the description which are not modeled by QueueDescription, such as those introduced by newer versions
+// of the service, are preserved in its Extensions and sent back unchanged.
+func (qm *QueueManager) Update(ctx context.Context, qe *QueueEntity, opts ...QueueManagementOption) (*QueueEntity, error) {
+	span, ctx := qm.startSpanFromContext(ctx, "sb.QueueManager.Update")
+	defer span.End()
+
+	if qe == nil || qe.QueueDescription == nil {
+		return nil, errors.New("queue entity must have a description to update")
+	}
+
+	qd := *qe.QueueDescription
+	for _, opt := range opts {
+		if err := opt(&qd); err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+	}
+
+	// extensions may use the instance prefix of the original document, so it must be declared
+	qd.InstanceMetadataSchema = to.StringPtr(xmlSchemaInstance)
+	return qm.put(ctx, qe.Name, &qd, atom.IfMatch("*"))
+}
+
+func (qm *QueueManager) put(ctx context.Context, name string, qd *QueueDescription, opts ...atom.RequestOption) (*QueueEntity, error) {
+	if qd.ForwardTo != nil {
+		if err := checkForwardingLoop(ctx, qm.forwards, name, name, *qd.ForwardTo); err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+	}
+
 	qd.ServiceBusSchema = to.StringPtr(serviceBusSchema)
 
 	qe := &queueEntry{
@@ -219,7 +261,7 @@ func (qm *QueueManager) Put(ctx context.Context, name string, opts ...QueueManag
 	}
 
 	reqBytes = xmlDoc(reqBytes)
-	res, err := qm.entityManager.Put(ctx, "/"+name, reqBytes)
+	res, err := qm.entityManager.Put(ctx, "/"+name, reqBytes, opts...)
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -238,15 +280,17 @@ func (qm *QueueManager) Put(ctx context.Context, name string, opts ...QueueManag
 	var entry queueEntry
 	err = xml.Unmarshal(b, &entry)
 	if err != nil {
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
-	return queueEntryToEntity(&entry), nil
+	entity := queueEntryToEntity(&entry)
+	qm.cacheQueue(name, entity)
+	return entity, nil
 }
 
 // List fetches all of the queues for a Service Bus Namespace
 func (qm *QueueManager) List(ctx context.Context) ([]*QueueEntity, error) {
 	span, ctx := qm.startSpanFromContext(ctx, "sb.QueueManager.List")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := qm.entityManager.Get(ctx, `/$Resources/Queues`)
 	if res != nil {
@@ -267,12 +311,13 @@ func (qm *QueueManager) List(ctx context.Context) ([]*QueueEntity, error) {
 	var feed queueFeed
 	err = xml.Unmarshal(b, &feed)
 	if err != nil {
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
 
 	qd := make([]*QueueEntity, len(feed.Entries))
 	for idx, entry := range feed.Entries {
 		qd[idx] = queueEntryToEntity(&entry)
+		qm.cacheQueue(qd[idx].Name, qd[idx])
 	}
 	return qd, nil
 }
@@ -280,7 +325,11 @@ func (qm *QueueManager) List(ctx context.Context) ([]*QueueEntity, error) {
 // Get fetches a Service Bus Queue entity by name
 func (qm *QueueManager) Get(ctx context.Context, name string) (*QueueEntity, error) {
 	span, ctx := qm.startSpanFromContext(ctx, "sb.QueueManager.Get")
-	defer span.Finish()
+	defer span.End()
+
+	if cached, ok := qm.cachedQueue(name); ok {
+		return cached, nil
+	}
 
 	res, err := qm.entityManager.Get(ctx, name)
 	if res != nil {
@@ -308,8 +357,10 @@ func (qm *QueueManager) Get(ctx context.Context, name string) (*QueueEntity, err
 		if isEmptyFeed(b) {
 			return nil, nil
 		}
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
 
-	return queueEntryToEntity(&entry), nil
+	entity := queueEntryToEntity(&entry)
+	qm.cacheQueue(name, entity)
+	return entity, nil
 }
@@ -27,6 +27,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -221,6 +222,7 @@ func (suite *serviceBusSuite) TestQueueUnmarshal() {
 func (suite *serviceBusSuite) TestQueueManagementWrites() {
 	tests := map[string]func(context.Context, *testing.T, *QueueManager, string){
 		"TestPutDefaultQueue": testPutQueue,
+		"TestUpdateQueue":     testUpdateQueue,
 	}
 
 	ns := suite.getNewSasInstance()
@@ -244,6 +246,28 @@ func testPutQueue(ctx context.Context, t *testing.T, qm *QueueManager, name stri
 	}
 }
 
+func testUpdateQueue(ctx context.Context, t *testing.T, qm *QueueManager, name string) {
+	if _, err := qm.Put(ctx, name, QueueEntityWithMaxDeliveryCount(5)); !assert.NoError(t, err) {
+		return
+	}
+	q, err := qm.Get(ctx, name)
+	if !assert.NoError(t, err) || !assert.NotNil(t, q) {
+		return
+	}
+
+	window := 3 * time.Minute
+	_, err = qm.Update(ctx, q, QueueEntityWithLockDuration(&window))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err = qm.Get(ctx, name)
+	if assert.NoError(t, err) && assert.NotNil(t, q) {
+		assert.Equal(t, "PT3M", *q.LockDuration)
+		assert.EqualValues(t, 5, *q.MaxDeliveryCount, "properties not changed by the update are kept")
+	}
+}
+
 func (suite *serviceBusSuite) TestQueueManagementReads() {
 	tests := map[string]func(context.Context, *testing.T, *QueueManager, []string){
 		"TestGetQueue":   testGetQueue,
@@ -405,9 +429,18 @@ func buildQueue(ctx context.Context, t *testing.T, qm *QueueManager, name string
 func (suite *serviceBusSuite) TestQueueClient() {
 	tests := map[string]func(context.Context, *testing.T, *Queue){
 		"SimpleSend":         testQueueSend,
+		"SendAsync":          testQueueSendAsync,
+		"SendBatch":          testQueueSendBatch,
 		"DuplicateDetection": testDuplicateDetection,
 		"MessageProperties":  testMessageProperties,
 		"Retry":              testRequeueOnFail,
+		"Drain":              testQueueDrain,
+		"Purge":              testQueuePurge,
+		"RouterSender":       testQueueRouterSender,
+		"OldestMessageAge":   testQueueOldestMessageAge,
+		"DeadLetterWhere":    testQueueDeadLetterWhere,
+		"OnReady":            testQueueOnReady,
+		"Release":            testQueueRelease,
 	}
 
 	ns := suite.getNewSasInstance()
@@ -429,7 +462,8 @@ func (suite *serviceBusSuite) TestQueueClient() {
 				cleanup()
 			}()
 			testFunc(ctx, t, q)
-			if !t.Failed() && name != "SimpleSend" {
+			if !t.Failed() && name != "SimpleSend" && name != "SendAsync" && name != "SendBatch" && name != "Drain" &&
+				name != "DeadLetterWhere" {
 				checkZeroQueueMessages(ctx, t, ns, queueName)
 			}
 		}
@@ -438,6 +472,184 @@ func (suite *serviceBusSuite) TestQueueClient() {
 	}
 }
 
+func testQueueDrain(ctx context.Context, t *testing.T, q *Queue) {
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.Send(ctx, NewMessageFromString(fmt.Sprintf("message %d", i))))
+	}
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	received := make(chan error, 1)
+	go func() {
+		received <- q.Receive(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+			once.Do(func() { close(handling) })
+			<-release
+			return msg.Complete()
+		}))
+	}()
+
+	<-handling
+	drained := make(chan error, 1)
+	go func() {
+		backlog, err := q.Drain(ctx)
+		assert.True(t, backlog <= 2, "at most the messages which were not handled remain, got %d", backlog)
+		drained <- err
+	}()
+	close(release)
+
+	assert.NoError(t, <-drained)
+	assert.Error(t, <-received, "Receive returns once the receiver is drained")
+}
+
+func testQueuePurge(ctx context.Context, t *testing.T, q *Queue) {
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, q.Send(ctx, NewMessageFromString(fmt.Sprintf("message %d", i))))
+	}
+
+	var progress []int
+	purged, err := q.Purge(ctx, PurgeWithBatchSize(2), PurgeWithProgress(func(purged int) {
+		progress = append(progress, purged)
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, purged)
+	if assert.NotEmpty(t, progress) {
+		assert.Equal(t, 5, progress[len(progress)-1])
+	}
+}
+
+func testQueueRouterSender(ctx context.Context, t *testing.T, q *Queue) {
+	rs, err := q.namespace.NewRouterSender()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, rs.Close(ctx))
+	}()
+
+	msg := NewMessageFromString("routed")
+	msg.To = q.Name
+	if !assert.NoError(t, rs.Send(ctx, msg)) {
+		return
+	}
+
+	err = q.ReceiveOne(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		assert.Equal(t, "routed", string(msg.Data))
+		return msg.Complete()
+	}))
+	assert.NoError(t, err)
+}
+
+func testQueueOldestMessageAge(ctx context.Context, t *testing.T, q *Queue) {
+	age, err := q.OldestMessageAge(ctx)
+	if assert.NoError(t, err) {
+		assert.Zero(t, age)
+	}
+
+	if !assert.NoError(t, q.Send(ctx, NewMessageFromString("waiting"))) {
+		return
+	}
+	time.Sleep(2 * time.Second)
+	age, err = q.OldestMessageAge(ctx)
+	if assert.NoError(t, err) {
+		assert.True(t, age > time.Second, "expected an age over a second, got %v", age)
+	}
+
+	err = q.ReceiveOne(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		return msg.Complete()
+	}))
+	assert.NoError(t, err)
+}
+
+func testQueueDeadLetterWhere(ctx context.Context, t *testing.T, q *Queue) {
+	for _, data := range []string{"bad", "good", "bad"} {
+		assert.NoError(t, q.Send(ctx, NewMessageFromString(data)))
+	}
+
+	moved, err := q.DeadLetterWhere(ctx, func(msg *Message) bool {
+		return string(msg.Data) == "bad"
+	}, "producer bug")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+
+	err = q.ReceiveOne(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		assert.Equal(t, "good", string(msg.Data))
+		return msg.Complete()
+	}))
+	assert.NoError(t, err)
+}
+
+func testQueueOnReady(ctx context.Context, t *testing.T, q *Queue) {
+	ready := make(chan struct{})
+	received := make(chan string, 1)
+	receiveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = q.Receive(receiveCtx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+			received <- string(msg.Data)
+			return msg.Complete()
+		}), OnReady(func() { close(ready) }))
+	}()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		t.Fatal("receiver never became ready")
+	}
+
+	if !assert.NoError(t, q.Send(ctx, NewMessageFromString("after ready"))) {
+		return
+	}
+	select {
+	case data := <-received:
+		assert.Equal(t, "after ready", data)
+	case <-ctx.Done():
+		t.Fatal("message sent once the receiver was ready was not received")
+	}
+}
+
+func testQueueRelease(ctx context.Context, t *testing.T, q *Queue) {
+	if !assert.NoError(t, q.Send(ctx, NewMessageFromString("handed back"))) {
+		return
+	}
+
+	for _, settle := range []func(*Message) DispositionAction{
+		(*Message).Release,
+		(*Message).Complete,
+	} {
+		err := q.ReceiveOne(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+			assert.Equal(t, "handed back", string(msg.Data))
+			return settle(msg)
+		}))
+		assert.NoError(t, err)
+	}
+}
+
+func testQueueSendAsync(ctx context.Context, t *testing.T, q *Queue) {
+	results := make([]<-chan error, 10)
+	for i := range results {
+		results[i] = q.SendAsync(ctx, NewMessageFromString(fmt.Sprintf("message %d", i)))
+	}
+
+	for i, result := range results {
+		assert.NoError(t, <-result, "message %d", i)
+		_, open := <-result
+		assert.False(t, open, "the result channel should be closed after the outcome")
+	}
+}
+
+func testQueueSendBatch(ctx context.Context, t *testing.T, q *Queue) {
+	messages := make([]*Message, 20)
+	for i := range messages {
+		messages[i] = NewMessageFromString(fmt.Sprintf("message %d %s", i, strings.Repeat("x", 10*1024)))
+	}
+
+	assert.NoError(t, q.SendBatch(ctx, messages, BatchWithMaxSizeInBytes(64*1024)))
+	for i, msg := range messages {
+		assert.NotEmpty(t, msg.ID, "message %d", i)
+	}
+}
+
 func testRequeueOnFail(ctx context.Context, t *testing.T, q *Queue) {
 	const payload = "Hello World!!!"
 
@@ -674,3 +886,64 @@ func (suite *serviceBusSuite) cleanupQueue(name string) {
 		suite.T().Fatal(err)
 	}
 }
+
+func TestQueueDescription_PreservesUnknownElements(t *testing.T) {
+	const described = `
+		<QueueDescription
+            xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"
+            xmlns:i="http://www.w3.org/2001/XMLSchema-instance">
+            <LockDuration>PT1M</LockDuration>
+            <AuthorizationRules/>
+            <Status>Active</Status>
+            <UserMetadata>owned by billing</UserMetadata>
+            <EntityAvailabilityStatus>Available</EntityAvailabilityStatus>
+            <ForwardDeadLetteredMessagesTo i:nil="true"/>
+            <MaxMessageSizeInKilobytes>1024</MaxMessageSizeInKilobytes>
+        </QueueDescription>`
+
+	var qd QueueDescription
+	if !assert.NoError(t, xml.Unmarshal([]byte(described), &qd)) {
+		return
+	}
+	assert.Equal(t, "PT1M", *qd.LockDuration)
+	if !assert.Len(t, qd.Extensions, 5) {
+		return
+	}
+	assert.Equal(t, "UserMetadata", qd.Extensions[1].XMLName.Local)
+	assert.Equal(t, "owned by billing", string(qd.Extensions[1].Content))
+
+	window := 2 * time.Minute
+	if !assert.NoError(t, QueueEntityWithLockDuration(&window)(&qd)) {
+		return
+	}
+	qd.ForwardTo = ptrString("https://foo.servicebus.windows.net/target")
+	qd.EnableExpress = ptrBool(false)
+	b, err := xml.Marshal(qd)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the service ignores elements out of schema order, so the extensions must be written back among the modeled ones
+	assert.Equal(t, []string{
+		"LockDuration",
+		"AuthorizationRules",
+		"Status",
+		"ForwardTo",
+		"UserMetadata",
+		"EntityAvailabilityStatus",
+		"EnableExpress",
+		"ForwardDeadLetteredMessagesTo",
+		"MaxMessageSizeInKilobytes",
+	}, childElements(t, b))
+
+	var roundTripped QueueDescription
+	if assert.NoError(t, xml.Unmarshal(b, &roundTripped)) {
+		assert.Equal(t, "PT120S", *roundTripped.LockDuration)
+		if assert.Len(t, roundTripped.Extensions, 5) {
+			assert.Equal(t, "owned by billing", string(roundTripped.Extensions[1].Content))
+			assert.Equal(t, "Available", string(roundTripped.Extensions[2].Content))
+			assert.Equal(t, qd.Extensions[3].Attrs, roundTripped.Extensions[3].Attrs)
+			assert.Equal(t, "1024", string(roundTripped.Extensions[4].Content))
+		}
+	}
+}
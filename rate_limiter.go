@@ -0,0 +1,127 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type (
+	// rateLimiter is a token bucket which allows events at a steady rate with bursts of up to burst events
+	rateLimiter struct {
+		mu     sync.Mutex
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+		clock  func() Clock
+	}
+)
+
+// QueueWithSendRateLimit limits the rate at which the queue sends messages to msgsPerSecond, allowing bursts of up to
+// burst messages, so producers stay under the throttling limits of the namespace rather than reacting to server busy
+// errors. Sends wait until they are within the limit or their context is done.
+func QueueWithSendRateLimit(msgsPerSecond float64, burst int) QueueOption {
+	return func(q *Queue) error {
+		limiter, err := newRateLimiter(msgsPerSecond, burst, q.namespace.getClock)
+		if err != nil {
+			return err
+		}
+		q.sendLimiter = limiter
+		return nil
+	}
+}
+
+// TopicWithSendRateLimit limits the rate at which the topic sends messages to msgsPerSecond, allowing bursts of up to
+// burst messages. Sends wait until they are within the limit or their context is done.
+func TopicWithSendRateLimit(msgsPerSecond float64, burst int) TopicOption {
+	return func(t *Topic) error {
+		limiter, err := newRateLimiter(msgsPerSecond, burst, t.namespace.getClock)
+		if err != nil {
+			return err
+		}
+		t.sendLimiter = limiter
+		return nil
+	}
+}
+
+func newRateLimiter(perSecond float64, burst int, clock func() Clock) (*rateLimiter, error) {
+	if perSecond <= 0 {
+		return nil, errors.New("rate must be greater than 0")
+	}
+	if burst < 1 {
+		return nil, errors.New("burst must be at least 1")
+	}
+
+	return &rateLimiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock().Now(),
+		clock:  clock,
+	}, nil
+}
+
+// wait blocks until n events are allowed or the context is done. Tokens are reserved before waiting, so concurrent
+// waiters are admitted in the order they arrived.
+func (rl *rateLimiter) wait(ctx context.Context, n int) error {
+	if rl == nil {
+		return nil
+	}
+
+	rl.mu.Lock()
+	now := rl.clock().Now()
+	rl.refill(now)
+	rl.tokens -= float64(n)
+	deficit := -rl.tokens
+	rl.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	delay := time.Duration(deficit / rl.rate * float64(time.Second))
+	select {
+	case <-ctx.Done():
+		rl.mu.Lock()
+		rl.tokens += float64(n)
+		rl.mu.Unlock()
+		return ctx.Err()
+	case <-rl.clock().After(delay):
+		return nil
+	}
+}
+
+// refill adds the tokens accrued since the last refill, up to the burst; the caller must hold the lock
+func (rl *rateLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(rl.last); elapsed > 0 {
+		rl.tokens += elapsed.Seconds() * rl.rate
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+		rl.last = now
+	}
+}
@@ -0,0 +1,112 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_BurstThenSteadyRate(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	rl, err := newRateLimiter(10, 2, func() Clock { return clock })
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	// the burst is admitted immediately
+	assert.NoError(t, rl.wait(ctx, 1))
+	assert.NoError(t, rl.wait(ctx, 1))
+	assert.Equal(t, 0, clock.pending())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rl.wait(ctx, 1)
+	}()
+
+	for clock.pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("the third message should wait for a token")
+	default:
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	assert.NoError(t, <-done)
+}
+
+func TestRateLimiter_RefillsUpToBurst(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	rl, err := newRateLimiter(1, 3, func() Clock { return clock })
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, rl.wait(context.Background(), 3))
+	clock.Advance(time.Hour)
+	assert.NoError(t, rl.wait(context.Background(), 3))
+	assert.Equal(t, 0, clock.pending())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, rl.wait(ctx, 1))
+	assert.Equal(t, float64(0), rl.tokens, "tokens reserved by a cancelled wait are returned")
+}
+
+func TestQueueWithSendRateLimit_Validation(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("foo", QueueWithSendRateLimit(100, 10))
+	if assert.NoError(t, err) {
+		assert.NotNil(t, q.sendLimiter)
+	}
+
+	_, err = ns.NewQueue("foo", QueueWithSendRateLimit(0, 10))
+	assert.Error(t, err)
+	_, err = ns.NewQueue("foo", QueueWithSendRateLimit(100, 0))
+	assert.Error(t, err)
+}
+
+func TestTopicWithSendRateLimit_Validation(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	topic, err := ns.NewTopic("foo", TopicWithSendRateLimit(100, 10))
+	if assert.NoError(t, err) {
+		assert.NotNil(t, topic.sendLimiter)
+	}
+
+	_, err = ns.NewTopic("foo", TopicWithSendRateLimit(0, 10))
+	assert.Error(t, err)
+}
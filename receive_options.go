@@ -0,0 +1,235 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+// filterAbandonDeliveries is how many deliveries of a message not matching a receive filter are abandoned straight away
+const filterAbandonDeliveries = 2
+
+// ErrMessageFiltered is returned by ReceiveOne and ReceiveBatch when none of the messages they received matched the
+// filter configured with ReceiveWithFilter, so the handler was not called
+var ErrMessageFiltered = errors.New("servicebus: no message received matched the receive filter")
+
+type (
+	// ReceiveOption provides a way to customize how messages and sessions are received from a Queue or Subscription
+	ReceiveOption func(*receiveOptions) error
+
+	// receiveOptions holds the configuration accumulated from ReceiveOptions
+	receiveOptions struct {
+		maxConcurrentSessions int
+		sessionIdleTimeout    time.Duration
+		maxWaitTime           time.Duration
+		autoProvision         bool
+		filter                func(*Message) bool
+		matched               uint32
+		unmatched             uint32
+		handlerTimeout        time.Duration
+		abandonThrottle       *abandonThrottle
+		onReady               func()
+		readyOnce             sync.Once
+	}
+)
+
+// WithMaxConcurrentSessions configures ReceiveSessions to keep up to n sessions locked and processing at once. As each
+// session completes, a new session is accepted in its place. When n is greater than one, the SessionHandler will be
+// called concurrently and must be safe for concurrent use.
+func WithMaxConcurrentSessions(n int) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if n < 1 {
+			return errors.New("WithMaxConcurrentSessions: must be 1 or greater")
+		}
+		o.maxConcurrentSessions = n
+		return nil
+	}
+}
+
+// SessionIdleTimeout configures session receivers to release a locked session once no message has arrived for the
+// duration d, moving on to the next available session rather than holding the lock indefinitely.
+func SessionIdleTimeout(d time.Duration) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if d <= 0 {
+			return errors.New("SessionIdleTimeout: must be greater than zero")
+		}
+		o.sessionIdleTimeout = d
+		return nil
+	}
+}
+
+// WithMaxWaitTime configures ReceiveOne and ReceiveBatch to long-poll: they wait up to the duration d for a message to
+// arrive, then return ErrNoMessages rather than blocking until the context is done. This lets callers poll an empty
+// entity once a minute, for example, without looping on short timeouts.
+func WithMaxWaitTime(d time.Duration) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if d <= 0 {
+			return errors.New("WithMaxWaitTime: must be greater than zero")
+		}
+		o.maxWaitTime = d
+		return nil
+	}
+}
+
+// ReceiveWithAutoProvision configures a receive operation to create its Queue, or its Topic and Subscription, with the
+// default settings when it fails with ErrEntityNotFound, then to try once more.
+func ReceiveWithAutoProvision() ReceiveOption {
+	return func(o *receiveOptions) error {
+		o.autoProvision = true
+		return nil
+	}
+}
+
+// ReceiveWithFilter configures a receive operation to pass only the messages matching the filter to the handler, for
+// example while consumers of different message types share a queue during a migration. Other messages are abandoned
+// straight away on their first two deliveries so another consumer can take them. After that they are left locked
+// without being settled, so they are only delivered again once their lock expires; this bounds how fast consumers
+// which all reject a message pass it between them. Every delivery counts towards the entity's maximum delivery count,
+// so a message no consumer accepts is eventually dead-lettered. ReceiveOne and ReceiveBatch return ErrMessageFiltered
+// when none of the messages they received matched. Messages received in ReceiveAndDelete mode are already removed from
+// the entity, so those not matching the filter are lost.
+func ReceiveWithFilter(filter func(*Message) bool) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if filter == nil {
+			return errors.New("ReceiveWithFilter: filter must not be nil")
+		}
+		o.filter = filter
+		return nil
+	}
+}
+
+// ReceiveWithHandlerTimeout configures a receive operation to cancel the context passed to the handler and abandon the
+// message once the handler has run for the duration d, so that a stuck handler does not hold the message's lock until
+// it expires. The disposition the handler returns after the timeout is ignored, so handlers should return promptly
+// once their context is done.
+func ReceiveWithHandlerTimeout(d time.Duration) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if d <= 0 {
+			return errors.New("ReceiveWithHandlerTimeout: must be greater than zero")
+		}
+		o.handlerTimeout = d
+		return nil
+	}
+}
+
+// OnReady configures Receive, or Messages, to call ready once the receive link is attached and has issued credit, so
+// messages sent from then on will be delivered to the handler. Tests and orchestrators can wait for it rather than
+// sleeping until the receiver is likely to be listening. ready is called at most once, even if the link is later
+// recovered.
+func OnReady(ready func()) ReceiveOption {
+	return func(o *receiveOptions) error {
+		if ready == nil {
+			return errors.New("OnReady: ready must not be nil")
+		}
+		o.onReady = ready
+		return nil
+	}
+}
+
+// ready calls the OnReady callback, if any, the first time it is called
+func (o *receiveOptions) ready() {
+	if o.onReady == nil {
+		return
+	}
+	o.readyOnce.Do(o.onReady)
+}
+
+// wrap applies the filter, abandon throttle and handler timeout configured by the options, if any, to the handler.
+// Messages the filter abandons are not handled, so they do not count towards the abandon rate.
+func (o *receiveOptions) wrap(ns *Namespace, handler Handler) Handler {
+	return o.filtered(o.throttled(ns, o.timed(ns, handler)))
+}
+
+// timed wraps the handler so that it is cancelled, and the message abandoned, once it exceeds the handler timeout
+func (o *receiveOptions) timed(ns *Namespace, handler Handler) Handler {
+	if o.handlerTimeout <= 0 {
+		return handler
+	}
+	return HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		result := make(chan DispositionAction, 1)
+		go func() {
+			result <- handler.Handle(ctx, msg)
+		}()
+
+		select {
+		case action := <-result:
+			return action
+		case <-ns.getClock().After(o.handlerTimeout):
+			log.For(ctx).Info(fmt.Sprintf("handler exceeded %v, abandoning message id %q", o.handlerTimeout, msg.ID))
+			return msg.Abandon()
+		}
+	})
+}
+
+// filtered wraps the handler so messages not matching the filter, if any, do not reach it. Those are abandoned for
+// their first filterAbandonDeliveries deliveries and left to their lock expiring after that.
+func (o *receiveOptions) filtered(handler Handler) Handler {
+	if o.filter == nil {
+		return handler
+	}
+	return HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		if o.filter(msg) {
+			atomic.AddUint32(&o.matched, 1)
+			return handler.Handle(ctx, msg)
+		}
+
+		atomic.AddUint32(&o.unmatched, 1)
+		if msg.DeliveryCount > filterAbandonDeliveries {
+			log.For(ctx).Debug(fmt.Sprintf("leaving unmatched message id %q locked after %d deliveries", msg.ID, msg.DeliveryCount))
+			return settledByConsumer
+		}
+		return msg.Abandon()
+	})
+}
+
+// filteredOut returns ErrMessageFiltered if the filter kept every message received from the handler, or else err
+func (o *receiveOptions) filteredOut(err error) error {
+	if err == nil && atomic.LoadUint32(&o.unmatched) > 0 && atomic.LoadUint32(&o.matched) == 0 {
+		return ErrMessageFiltered
+	}
+	return err
+}
+
+// newReceiveOptions applies each of the ReceiveOptions over the defaults
+func newReceiveOptions(opts ...ReceiveOption) (*receiveOptions, error) {
+	o := &receiveOptions{
+		maxConcurrentSessions: 1,
+	}
+
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
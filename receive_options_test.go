@@ -0,0 +1,208 @@
+package servicebus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveOptions_MaxConcurrentSessions(t *testing.T) {
+	o, err := newReceiveOptions()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, o.maxConcurrentSessions)
+	}
+
+	o, err = newReceiveOptions(WithMaxConcurrentSessions(8))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 8, o.maxConcurrentSessions)
+	}
+
+	_, err = newReceiveOptions(WithMaxConcurrentSessions(0))
+	assert.Error(t, err)
+}
+
+func TestReceiveOptions_SessionIdleTimeout(t *testing.T) {
+	o, err := newReceiveOptions(SessionIdleTimeout(30 * time.Second))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 30*time.Second, o.sessionIdleTimeout)
+	}
+
+	_, err = newReceiveOptions(SessionIdleTimeout(0))
+	assert.Error(t, err)
+}
+
+func TestReleaseIdleSession(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ms := &MessageSession{done: make(chan struct{})}
+	activity := make(chan bool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go releaseIdleSession(ctx, clock, ms, activity, time.Minute)
+
+	// a message arriving before the timeout keeps the session for as long as it is being handled
+	clock.waitForCalls(1)
+	clock.Advance(45 * time.Second)
+	activity <- true
+	clock.Advance(5 * time.Minute)
+	select {
+	case <-ms.done:
+		t.Fatal("session was released while a message was being handled")
+	default:
+	}
+
+	// the timeout starts again once the message has been settled
+	activity <- false
+	clock.waitForCalls(2)
+	clock.Advance(45 * time.Second)
+	select {
+	case <-ms.done:
+		t.Fatal("session was released while still active")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case <-ms.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle session was not released")
+	}
+}
+
+func TestReceiveOptions_MaxWaitTime(t *testing.T) {
+	o, err := newReceiveOptions(WithMaxWaitTime(time.Minute))
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Minute, o.maxWaitTime)
+	}
+
+	_, err = newReceiveOptions(WithMaxWaitTime(0))
+	assert.Error(t, err)
+}
+
+func TestReceiveOptions_Filter(t *testing.T) {
+	o, err := newReceiveOptions(ReceiveWithFilter(func(msg *Message) bool {
+		return msg.Label == "order"
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var handled []string
+	handler := o.filtered(HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		handled = append(handled, msg.ID)
+		return nil
+	}))
+
+	order, invoice := NewMessageFromString("a"), NewMessageFromString("b")
+	order.ID, order.Label = "order-1", "order"
+	invoice.ID, invoice.Label = "invoice-1", "invoice"
+
+	assert.Nil(t, handler.Handle(context.Background(), order))
+	assert.Equal(t, []string{"order-1"}, handled)
+
+	invoice.DeliveryCount = filterAbandonDeliveries
+	abandon := handler.Handle(context.Background(), invoice)
+	assert.NotNil(t, abandon, "unmatched messages are abandoned")
+	assert.NotEqual(t, reflect.ValueOf(settledByConsumer).Pointer(), reflect.ValueOf(abandon).Pointer())
+	invoice.DeliveryCount++
+	skip := handler.Handle(context.Background(), invoice)
+	assert.Equal(t, reflect.ValueOf(settledByConsumer).Pointer(), reflect.ValueOf(skip).Pointer(),
+		"unmatched messages redelivered too often are left to their lock expiring")
+
+	_, err = newReceiveOptions(ReceiveWithFilter(nil))
+	assert.Error(t, err)
+}
+
+func TestReceiveOptions_HandlerTimeout(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+	o, err := newReceiveOptions(ReceiveWithHandlerTimeout(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cancelled := make(chan struct{})
+	stuck := o.wrap(ns, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		<-ctx.Done()
+		close(cancelled)
+		return nil
+	}))
+
+	actions := make(chan DispositionAction, 1)
+	go func() {
+		actions <- stuck.Handle(context.Background(), NewMessageFromString("a"))
+	}()
+	clock.waitForCalls(1)
+	clock.Advance(time.Minute)
+
+	select {
+	case action := <-actions:
+		assert.NotNil(t, action, "the message is abandoned once the handler times out")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler was not timed out")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler's context was not cancelled")
+	}
+
+	prompt := o.wrap(ns, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		return nil
+	}))
+	assert.Nil(t, prompt.Handle(context.Background(), NewMessageFromString("b")))
+
+	_, err = newReceiveOptions(ReceiveWithHandlerTimeout(0))
+	assert.Error(t, err)
+}
+
+func TestReceiveOptions_OnReady(t *testing.T) {
+	calls := 0
+	o, err := newReceiveOptions(OnReady(func() { calls++ }))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	o.ready()
+	o.ready()
+	assert.Equal(t, 1, calls, "ready is only signalled once")
+
+	o, err = newReceiveOptions()
+	if assert.NoError(t, err) {
+		o.ready()
+	}
+
+	_, err = newReceiveOptions(OnReady(nil))
+	assert.Error(t, err)
+}
+
+func TestReceiveOptions_FilteredOut(t *testing.T) {
+	newOptions := func() *receiveOptions {
+		o, err := newReceiveOptions(ReceiveWithFilter(func(msg *Message) bool {
+			return msg.Label == "order"
+		}))
+		assert.NoError(t, err)
+		return o
+	}
+	order, invoice := NewMessageFromString("a"), NewMessageFromString("b")
+	order.Label, invoice.Label = "order", "invoice"
+	handler := HandlerFunc(func(context.Context, *Message) DispositionAction {
+		return nil
+	})
+
+	o := newOptions()
+	assert.NoError(t, o.filteredOut(nil), "nothing was received")
+
+	o.filtered(handler).Handle(context.Background(), invoice)
+	assert.Equal(t, ErrMessageFiltered, o.filteredOut(nil))
+	assert.Equal(t, context.Canceled, o.filteredOut(context.Canceled))
+
+	o.filtered(handler).Handle(context.Background(), order)
+	assert.NoError(t, o.filteredOut(nil), "a message reached the handler")
+}
@@ -25,29 +25,48 @@ package servicebus
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-amqp-common-go"
 	"github.com/Azure/azure-amqp-common-go/log"
-	"github.com/opentracing/opentracing-go"
+	"github.com/Azure/azure-amqp-common-go/uuid"
 	"pack.ag/amqp"
 )
 
+const (
+	sessionFilterName = vendorPrefix + "session-filter"
+	sessionFilterCode = uint64(0x00000137000000C)
+
+	// batchDrainTimeout is how long ReceiveBatch waits for each message after the first before returning the batch
+	batchDrainTimeout = 100 * time.Millisecond
+)
+
 // receiver provides session and link handling for a receiving entity path
 type (
 	receiver struct {
-		namespace   *Namespace
-		connection  *amqp.Client
-		session     *session
-		receiver    *amqp.Receiver
-		entityPath  string
-		done        func()
-		Name        string
-		useSessions bool
-		sessionID   *string
-		lastError   error
-		mode        ReceiveMode
-		prefetch    uint32
+		namespace      *Namespace
+		connection     *amqp.Client
+		session        *session
+		receiver       *amqp.Receiver
+		entityPath     string
+		done           func()
+		Name           string
+		useSessions    bool
+		sessionID      *string
+		lastError      error
+		mode           ReceiveMode
+		prefetch       uint32
+		settlementHook SettlementHook
+		codecs         *CodecRegistry
+		lockRenewal    time.Duration
+		renewLocks     func(ctx context.Context, messages []*Message) error
+		pauseMu        sync.Mutex
+		resumed        chan struct{}
+		interrupt      context.CancelFunc
+		stopListening  context.CancelFunc
+		handled        chan struct{}
+		stats          linkStats
 	}
 
 	// receiverOption provides a structure for configuring receivers
@@ -55,19 +74,27 @@ type (
 
 	// ListenerHandle provides the ability to close or listen to the close of a Receiver
 	listenerHandle struct {
-		r   *receiver
-		ctx context.Context
+		r       *receiver
+		ctx     context.Context
+		handled chan struct{}
 	}
 )
 
 // newReceiver creates a new Service Bus message listener given an AMQP client and an entity path
 func (ns *Namespace) newReceiver(ctx context.Context, entityPath string, opts ...receiverOption) (*receiver, error) {
 	span, ctx := ns.startSpanFromContext(ctx, "sb.Hub.newReceiver")
-	defer span.Finish()
+	defer span.End()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
 
 	receiver := &receiver{
 		namespace:  ns,
 		entityPath: entityPath,
+		Name:       id.String(),
 		mode:       PeekLockMode,
 		prefetch:   1,
 	}
@@ -78,7 +105,7 @@ func (ns *Namespace) newReceiver(ctx context.Context, entityPath string, opts ..
 		}
 	}
 
-	err := receiver.newSessionAndLink(ctx)
+	err = receiver.newSessionAndLink(ctx)
 	return receiver, err
 }
 
@@ -88,29 +115,33 @@ func (r *receiver) Close(ctx context.Context) error {
 		r.done()
 	}
 
-	return r.connection.Close()
+	r.stats.setState(LinkClosed)
+	return r.namespace.closeConnection(r.connection)
 }
 
 // Recover will attempt to close the current session and link, then rebuild them
 func (r *receiver) Recover(ctx context.Context) error {
 	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.Recover")
-	defer span.Finish()
+	defer span.End()
 
 	// we expect the sender, session or client is in an error state, ignore errors
 	closeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	closeCtx = opentracing.ContextWithSpan(closeCtx, span)
 	defer cancel()
 	_ = r.receiver.Close(closeCtx)
 	_ = r.session.Close(closeCtx)
-	_ = r.connection.Close()
-	return r.newSessionAndLink(ctx)
+	_ = r.namespace.closeConnection(r.connection)
+	if err := r.newSessionAndLink(ctx); err != nil {
+		return err
+	}
+	r.stats.recovered()
+	return nil
 }
 
-func (r *receiver) ReceiveOne(ctx context.Context, handler Handler) error {
+func (r *receiver) ReceiveOne(ctx context.Context, handler Handler, maxWait time.Duration) error {
 	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.ReceiveOne")
-	defer span.Finish()
+	defer span.End()
 
-	amqpMsg, err := r.listenForMessage(ctx)
+	amqpMsg, err := r.listenWithin(ctx, maxWait)
 	if err != nil {
 		log.For(ctx).Error(err)
 		return err
@@ -121,32 +152,86 @@ func (r *receiver) ReceiveOne(ctx context.Context, handler Handler) error {
 	return nil
 }
 
+// ReceiveBatch waits up to maxWait for a message, then handles it and any further messages which follow it within
+// batchDrainTimeout, up to maxMessages
+func (r *receiver) ReceiveBatch(ctx context.Context, maxMessages int, handler Handler, maxWait time.Duration) error {
+	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.ReceiveBatch")
+	defer span.End()
+
+	for i := 0; i < maxMessages; i++ {
+		wait := maxWait
+		if i > 0 {
+			wait = batchDrainTimeout
+		}
+
+		amqpMsg, err := r.listenWithin(ctx, wait)
+		if _, ok := err.(ErrNoMessages); ok && i > 0 {
+			return nil
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			return err
+		}
+
+		r.handleMessage(ctx, amqpMsg, handler)
+	}
+	return nil
+}
+
+// listenWithin waits for a message for up to maxWait, returning ErrNoMessages if none arrives. A maxWait of zero waits
+// as long as the context allows.
+func (r *receiver) listenWithin(ctx context.Context, maxWait time.Duration) (*amqp.Message, error) {
+	waitCtx, cancel := r.namespace.withTimeout(ctx, maxWait)
+	defer cancel()
+
+	amqpMsg, err := r.listenForMessage(waitCtx)
+	if err != nil && ctx.Err() == nil && waitCtx.Err() != nil {
+		return nil, ErrNoMessages{}
+	}
+	return amqpMsg, err
+}
+
 // Listen start a listener for messages sent to the entity path
 func (r *receiver) Listen(ctx context.Context, handler Handler) *listenerHandle {
 	ctx, done := context.WithCancel(ctx)
 	r.done = done
 
 	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.Listen")
-	defer span.Finish()
+	defer span.End()
 
 	messages := make(chan *amqp.Message)
-	go r.listenForMessages(ctx, messages)
-	go r.handleMessages(ctx, messages, handler)
+	handled := make(chan struct{})
+	// the listener can be stopped on its own so a drain lets the handler finish the message in flight
+	listenCtx, stopListening := context.WithCancel(ctx)
+	r.pauseMu.Lock()
+	r.stopListening, r.handled = stopListening, handled
+	r.pauseMu.Unlock()
+
+	go r.listenForMessages(listenCtx, messages)
+	go func() {
+		defer close(handled)
+		r.handleMessages(ctx, messages, handler)
+	}()
 
 	return &listenerHandle{
-		r:   r,
-		ctx: ctx,
+		r:       r,
+		ctx:     ctx,
+		handled: handled,
 	}
 }
 
 func (r *receiver) handleMessages(ctx context.Context, messages chan *amqp.Message, handler Handler) {
 	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.handleMessages")
-	defer span.Finish()
+	defer span.End()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case msg := <-messages:
+		case msg, ok := <-messages:
+			if !ok {
+				// the listener has stopped
+				return
+			}
 			r.handleMessage(ctx, msg, handler)
 		}
 	}
@@ -154,62 +239,99 @@ func (r *receiver) handleMessages(ctx context.Context, messages chan *amqp.Messa
 
 func (r *receiver) handleMessage(ctx context.Context, msg *amqp.Message, handler Handler) {
 	const optName = "sb.receiver.handleMessage"
+	defer r.stats.track()()
+
 	event, err := messageFromAMQPMessage(msg)
 	if err != nil {
 		_, ctx := r.startConsumerSpanFromContext(ctx, optName)
 		log.For(ctx).Error(err)
 	}
-	var span opentracing.Span
-	wireContext, err := extractWireContext(event)
-	if err == nil {
-		span, ctx = r.startConsumerSpanFromWire(ctx, optName, wireContext)
-	} else {
-		span, ctx = r.startConsumerSpanFromContext(ctx, optName)
-	}
-	defer span.Finish()
+	event.settlementHook = r.settlementHook
+	event.codecs = r.codecs
+	event.receiveMode = r.mode
+	event.namespace = r.namespace
+	span, ctx := r.startConsumerSpanFromWire(ctx, optName, event)
+	defer span.End()
 
 	id := messageID(msg)
-	span.SetTag("amqp.message-id", id)
+	span.SetAttribute("amqp.message-id", id)
+	ctx = extractDiagnostics(ctx, span, event)
+	ctx = r.withDeliveryMetadata(ctx, event)
+	r.namespace.observeLatency(ctx, event)
 
+	stopRenewal := r.keepLockAlive(ctx, event)
 	dispositionAction := handler.Handle(ctx, event)
+	stopRenewal()
 
 	if r.mode == ReceiveAndDeleteMode {
 		return
 	}
 
 	if dispositionAction != nil {
-		dispositionAction(ctx)
+		dispositionAction(dispositionContext(ctx))
 	} else {
 		log.For(ctx).Info(fmt.Sprintf("disposition action not provided auto accepted message id %q", id))
 		event.Complete()
 	}
 }
 
-func extractWireContext(reader opentracing.TextMapReader) (opentracing.SpanContext, error) {
-	return opentracing.GlobalTracer().Extract(opentracing.TextMap, reader)
-}
-
 func (r *receiver) listenForMessages(ctx context.Context, msgChan chan *amqp.Message) {
 	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.listenForMessages")
-	defer span.Finish()
+	defer span.End()
+	defer close(msgChan)
 
 	for {
-		msg, err := r.listenForMessage(ctx)
+		if _, err := r.waitWhilePaused(ctx); err != nil {
+			return
+		}
+
+		waitCtx, stopWaiting := r.interruptible(ctx)
+		msg, err := r.listenForMessage(waitCtx)
+		interrupted := waitCtx.Err() != nil && ctx.Err() == nil
+		stopWaiting()
 		if err == nil {
-			msgChan <- msg
+			select {
+			case msgChan <- msg:
+			case <-ctx.Done():
+				// the handler has stopped, leave the message unsettled so it is redelivered
+				return
+			}
+			continue
+		}
+
+		// the wait for a message is interrupted when the receiver is paused, which is not a failure to recover from even
+		// if the receiver has been resumed again by now
+		if interrupted {
 			continue
 		}
 
+		// recovering cannot bring a missing entity into existence, so give up straight away
+		if _, ok := err.(ErrEntityNotFound); ok {
+			r.stats.failed(err)
+			r.lastError = err
+			r.Close(ctx)
+			return
+		}
+
 		select {
 		case <-ctx.Done():
 			log.For(ctx).Debug("context done")
 			return
 		default:
-			_, retryErr := common.Retry(10, 10*time.Second, func() (interface{}, error) {
+			r.stats.recovering(err)
+			r.namespace.reconnecting(err)
+			if after, ok := ErrorRetryAfter(err); ok {
+				// the link was detached because the namespace is throttling, so back off before reattaching
+				if err := r.namespace.sleep(ctx, after); err != nil {
+					return
+				}
+			}
+			_, retryErr := r.namespace.retryWithPolicy(ctx, r.namespace.dataPlaneRetryPolicy(), func() (interface{}, error) {
 				sp, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.listenForMessages.tryRecover")
-				defer sp.Finish()
+				defer sp.End()
 
 				log.For(ctx).Debug("recovering connection")
+				r.namespace.reconnecting(nil)
 				err := r.Recover(ctx)
 				if err == nil {
 					log.For(ctx).Debug("recovered connection")
@@ -220,12 +342,17 @@ func (r *receiver) listenForMessages(ctx context.Context, msgChan chan *amqp.Mes
 				case <-ctx.Done():
 					return nil, ctx.Err()
 				default:
+					if busy, ok := serverBusy(err).(ErrServerBusy); ok {
+						// handed back as is so the retry waits for as long as the service asked
+						return nil, busy
+					}
 					return nil, common.Retryable(err.Error())
 				}
 			})
 
 			if retryErr != nil {
 				log.For(ctx).Debug("retried, but error was unrecoverable")
+				r.stats.failed(retryErr)
 				r.lastError = retryErr
 				r.Close(ctx)
 				return
@@ -236,16 +363,20 @@ func (r *receiver) listenForMessages(ctx context.Context, msgChan chan *amqp.Mes
 
 func (r *receiver) listenForMessage(ctx context.Context) (*amqp.Message, error) {
 	span, ctx := r.startConsumerSpanFromContext(ctx, "sb.receiver.listenForMessage")
-	defer span.Finish()
+	defer span.End()
 
-	msg, err := r.receiver.Receive(ctx)
+	var msg *amqp.Message
+	err := r.namespace.receiveFault(ctx, r.entityPath)
+	if err == nil {
+		msg, err = r.receiver.Receive(ctx)
+	}
 	if err != nil {
 		log.For(ctx).Debug(err.Error())
-		return nil, err
+		return nil, serverBusy(entityNotFound(r.entityPath, err))
 	}
 
 	id := messageID(msg)
-	span.SetTag("amqp.message-id", id)
+	span.SetAttribute("amqp.message-id", id)
 	return msg, nil
 }
 
@@ -260,7 +391,7 @@ func (r *receiver) newSessionAndLink(ctx context.Context) error {
 	err = r.namespace.negotiateClaim(ctx, connection, r.entityPath)
 	if err != nil {
 		log.For(ctx).Error(err)
-		return err
+		return entityNotFound(r.entityPath, err)
 	}
 
 	amqpSession, err := connection.NewSession()
@@ -275,6 +406,11 @@ func (r *receiver) newSessionAndLink(ctx context.Context) error {
 		return err
 	}
 
+	return r.newLink(ctx)
+}
+
+// newLink attaches a new receive link on the receiver's session
+func (r *receiver) newLink(ctx context.Context) error {
 	receiveMode := amqp.ModeSecond
 	sendMode := amqp.ModeUnsettled
 	if r.mode == ReceiveAndDeleteMode {
@@ -290,16 +426,21 @@ func (r *receiver) newSessionAndLink(ctx context.Context) error {
 	}
 
 	if r.useSessions {
-		amqp.LinkSourceFilter("com.microsoft:session-filter", uint64(0x00000137000000C), r.sessionID)
-		//r.session.SessionID = *r.sessionID
+		// a nil filter value asks the broker for the next available session
+		var filterValue interface{}
+		if r.sessionID != nil {
+			filterValue = *r.sessionID
+		}
+		opts = append(opts, amqp.LinkSourceFilter(sessionFilterName, sessionFilterCode, filterValue))
 	}
 
-	amqpReceiver, err := amqpSession.NewReceiver(opts...)
+	amqpReceiver, err := r.session.NewReceiver(opts...)
 	if err != nil {
-		return err
+		return entityNotFound(r.entityPath, err)
 	}
 
 	r.receiver = amqpReceiver
+	r.stats.setState(LinkAttached)
 	return nil
 }
 
@@ -319,6 +460,90 @@ func receiverWithReceiveMode(mode ReceiveMode) receiverOption {
 	}
 }
 
+// receiverWithSettlementHook configures a receiver to notify the hook once a message's disposition is acknowledged
+func receiverWithSettlementHook(hook SettlementHook) receiverOption {
+	return func(r *receiver) error {
+		r.settlementHook = hook
+		return nil
+	}
+}
+
+// receiverWithCodecs configures the registry received messages decode their values with
+func receiverWithCodecs(registry *CodecRegistry) receiverOption {
+	return func(r *receiver) error {
+		r.codecs = registry
+		return nil
+	}
+}
+
+// receiverWithPrefetchCount configures the link credit of the receiver, which is how many messages the broker may
+// deliver ahead of them being handled
+func receiverWithPrefetchCount(count uint32) receiverOption {
+	return func(r *receiver) error {
+		r.prefetch = count
+		return nil
+	}
+}
+
+// receiverWithAutoLockRenewal configures a receiver to renew the lock of PeekLock messages with renew while they are
+// being handled, for up to maxDuration after each message is received
+func receiverWithAutoLockRenewal(maxDuration time.Duration, renew func(ctx context.Context, messages []*Message) error) receiverOption {
+	return func(r *receiver) error {
+		r.lockRenewal = maxDuration
+		r.renewLocks = renew
+		return nil
+	}
+}
+
+// keepLockAlive renews the lock of msg in the background until the returned func is called, which blocks until the
+// renewal has stopped. Session messages are not renewed as they are covered by the lock on their session.
+func (r *receiver) keepLockAlive(ctx context.Context, msg *Message) func() {
+	if r.lockRenewal <= 0 || r.renewLocks == nil || r.mode != PeekLockMode || r.useSessions || msg.LockToken == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	clock := r.namespace.getClock()
+	deadline := clock.Now().Add(r.lockRenewal)
+	interval := lockRenewalInterval(clock.Now(), msg)
+
+	go func() {
+		defer close(done)
+		for {
+			if err := r.namespace.sleep(ctx, interval); err != nil {
+				return
+			}
+			if clock.Now().After(deadline) {
+				return
+			}
+			if err := r.renewLocks(ctx, []*Message{msg}); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.For(ctx).Error(err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// lockRenewalInterval is half of the lock duration of msg, so each renewal has time to complete before the lock expires
+func lockRenewalInterval(now time.Time, msg *Message) time.Duration {
+	const defaultInterval = 30 * time.Second // half of the default lock duration
+	if msg.SystemProperties == nil || msg.SystemProperties.LockedUntil == nil {
+		return defaultInterval
+	}
+	if remaining := msg.SystemProperties.LockedUntil.Sub(now); remaining > 2*time.Second {
+		return remaining / 2
+	}
+	return time.Second
+}
+
 func messageID(msg *amqp.Message) interface{} {
 	var id interface{} = "null"
 	if msg.Properties != nil {
@@ -337,6 +562,11 @@ func (lc *listenerHandle) Done() <-chan struct{} {
 	return lc.ctx.Done()
 }
 
+// Handled will close the channel once the listener has stopped and the message in flight, if any, has been handled
+func (lc *listenerHandle) Handled() <-chan struct{} {
+	return lc.handled
+}
+
 // Err will return the last error encountered
 func (lc *listenerHandle) Err() error {
 	if lc.r.lastError != nil {
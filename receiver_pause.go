@@ -0,0 +1,169 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotReceiving is returned when pausing or resuming an entity which has not started receiving
+var ErrNotReceiving = errors.New("servicebus: the entity is not receiving")
+
+// PauseReceiving stops the Queue's receiver taking messages from its receive link, for example to apply backpressure
+// while a downstream dependency is unavailable. Receive calls keep blocking until ResumeReceiving is called. The link
+// stays attached, so messages already being handled can still be settled and a session receiver keeps its session.
+//
+// pack.ag/amqp grants the broker credit as the receiver's prefetch buffer empties and cannot drain it, so up to the
+// prefetch count of messages may still arrive and wait, locked, in the buffer while the receiver is paused. If their
+// locks expire before ResumeReceiving is called they are redelivered with their delivery count incremented, so a low
+// prefetch count is advisable for receivers which pause for long.
+func (q *Queue) PauseReceiving(ctx context.Context) error {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.PauseReceiving")
+	defer span.End()
+
+	q.receiverMu.Lock()
+	defer q.receiverMu.Unlock()
+
+	if q.receiver == nil {
+		return ErrNotReceiving
+	}
+	return q.receiver.Pause(ctx)
+}
+
+// ResumeReceiving restores the flow of messages stopped by PauseReceiving
+func (q *Queue) ResumeReceiving(ctx context.Context) error {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ResumeReceiving")
+	defer span.End()
+
+	q.receiverMu.Lock()
+	defer q.receiverMu.Unlock()
+
+	if q.receiver == nil {
+		return ErrNotReceiving
+	}
+	return q.receiver.Resume(ctx)
+}
+
+// PauseReceiving stops the flow of messages to the Subscription's receiver. See Queue.PauseReceiving.
+func (s *Subscription) PauseReceiving(ctx context.Context) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.PauseReceiving")
+	defer span.End()
+
+	s.receiverMu.Lock()
+	defer s.receiverMu.Unlock()
+
+	if s.receiver == nil {
+		return ErrNotReceiving
+	}
+	return s.receiver.Pause(ctx)
+}
+
+// ResumeReceiving restores the flow of messages stopped by PauseReceiving
+func (s *Subscription) ResumeReceiving(ctx context.Context) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ResumeReceiving")
+	defer span.End()
+
+	s.receiverMu.Lock()
+	defer s.receiverMu.Unlock()
+
+	if s.receiver == nil {
+		return ErrNotReceiving
+	}
+	return s.receiver.Resume(ctx)
+}
+
+// Pause stops the listener taking messages from the receive link, interrupting its wait for the next one, until Resume
+func (r *receiver) Pause(ctx context.Context) error {
+	span, _ := r.startConsumerSpanFromContext(ctx, "sb.receiver.Pause")
+	defer span.End()
+
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+
+	if r.resumed != nil {
+		return nil
+	}
+	r.resumed = make(chan struct{})
+	r.stats.setState(LinkPaused)
+	if r.interrupt != nil {
+		r.interrupt()
+	}
+	return nil
+}
+
+// Resume releases the listener held by Pause
+func (r *receiver) Resume(ctx context.Context) error {
+	span, _ := r.startConsumerSpanFromContext(ctx, "sb.receiver.Resume")
+	defer span.End()
+
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+
+	if r.resumed == nil {
+		return nil
+	}
+	r.stats.setState(LinkAttached)
+	close(r.resumed)
+	r.resumed = nil
+	return nil
+}
+
+// interruptible returns a context for waiting on the next message which is cancelled if the receiver is paused. The
+// returned function must be called once the wait is over.
+func (r *receiver) interruptible(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	if r.resumed != nil {
+		// paused since the listener last checked
+		cancel()
+		return ctx, cancel
+	}
+	r.interrupt = cancel
+	return ctx, func() {
+		r.pauseMu.Lock()
+		r.interrupt = nil
+		r.pauseMu.Unlock()
+		cancel()
+	}
+}
+
+// waitWhilePaused blocks while the receiver is paused and reports whether it was paused
+func (r *receiver) waitWhilePaused(ctx context.Context) (bool, error) {
+	r.pauseMu.Lock()
+	resumed := r.resumed
+	r.pauseMu.Unlock()
+
+	if resumed == nil {
+		return false, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-resumed:
+		return true, nil
+	}
+}
@@ -0,0 +1,133 @@
+package servicebus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestQueue_PauseReceivingWithoutReceiver(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("foo")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, ErrNotReceiving, q.PauseReceiving(context.Background()))
+	assert.Equal(t, ErrNotReceiving, q.ResumeReceiving(context.Background()))
+}
+
+func TestReceiver_WaitWhilePaused(t *testing.T) {
+	r := new(receiver)
+
+	paused, err := r.waitWhilePaused(context.Background())
+	assert.False(t, paused)
+	assert.NoError(t, err)
+
+	r.resumed = make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	paused, err = r.waitWhilePaused(ctx)
+	assert.True(t, paused)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	waited := make(chan bool)
+	go func() {
+		paused, _ := r.waitWhilePaused(context.Background())
+		waited <- paused
+	}()
+	close(r.resumed)
+	assert.True(t, <-waited)
+}
+
+func TestReceiver_PauseInterruptsTheWaitForAMessage(t *testing.T) {
+	r := new(receiver)
+
+	waitCtx, stop := r.interruptible(context.Background())
+	defer stop()
+	assert.NoError(t, r.Pause(context.Background()))
+	select {
+	case <-waitCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("pausing did not interrupt the wait for a message")
+	}
+
+	// a wait started while paused ends straight away
+	pausedCtx, stopPaused := r.interruptible(context.Background())
+	defer stopPaused()
+	assert.Error(t, pausedCtx.Err())
+
+	assert.NoError(t, r.Resume(context.Background()))
+	resumedCtx, stopResumed := r.interruptible(context.Background())
+	assert.NoError(t, resumedCtx.Err())
+	stopResumed()
+	assert.Equal(t, LinkAttached, r.stats.state)
+}
+
+type (
+	// blockingReceives is a faultInjector whose receives wait until they are interrupted, reporting each call
+	blockingReceives struct {
+		faultPlan
+		calls chan struct{}
+	}
+)
+
+func (br *blockingReceives) receive(ctx context.Context, _ string) error {
+	br.calls <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReceiver_PauseThenResumeDoesNotRecover(t *testing.T) {
+	faults := &blockingReceives{calls: make(chan struct{})}
+	ns, err := NewNamespace(namespaceWithFaultInjector(faults))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var states []ConnectionStatus
+	var mu sync.Mutex
+	ns.OnStateChange(func(state State) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state.Status)
+	})
+
+	r := &receiver{namespace: ns, entityPath: "queue"}
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan *amqp.Message)
+	go r.listenForMessages(ctx, messages)
+
+	awaitReceive := func() {
+		select {
+		case <-faults.calls:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the listener did not wait for a message")
+		}
+	}
+	awaitReceive()
+	assert.NoError(t, r.Pause(context.Background()))
+	assert.NoError(t, r.Resume(context.Background()))
+	awaitReceive()
+
+	cancel()
+	go func() {
+		for range faults.calls {
+		}
+	}()
+	for range messages {
+	}
+	close(faults.calls)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotContains(t, states, Reconnecting)
+	assert.NotEqual(t, LinkRecovering, r.stats.snapshot(r.entityPath, 0).State)
+}
@@ -0,0 +1,263 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	defaultReplayBatchSize = 100
+)
+
+type (
+	// ReplayOption configures Queue.ReplayDeadLetters
+	ReplayOption func(*replayOptions) error
+
+	replayOptions struct {
+		batchSize      int
+		inEnqueueOrder bool
+		rate           float64
+		limiter        *rateLimiter
+	}
+
+	// deadLetterReplay sends dead-lettered messages back to their entity, completing each in the dead-letter queue
+	// once it has been sent and renewing the locks of the rest of the batch when a slow replay would outlast them
+	deadLetterReplay struct {
+		options      *replayOptions
+		receiveBatch func(context.Context, int, Handler) error
+		send         func(context.Context, *Message) error
+		complete     func(context.Context, *Message) error
+		renew        func(context.Context, []*Message) error
+		clock        Clock
+	}
+)
+
+// ReplayWithBatchSize configures how many dead-lettered messages are locked and replayed at a time. The default is 100.
+// With ReplayInEnqueueOrder, larger batches preserve the original order over more messages, but every message of a
+// batch must be replayed within the lock duration of the queue.
+func ReplayWithBatchSize(size int) ReplayOption {
+	return func(o *replayOptions) error {
+		if size < 1 {
+			return errors.New("batch size must be at least 1")
+		}
+		o.batchSize = size
+		return nil
+	}
+}
+
+// ReplayInEnqueueOrder configures the replay to send the messages of each batch in the order they were originally
+// enqueued, by their EnqueuedSequenceNumber, rather than the order they were dead-lettered in, so consumers which rely
+// on the order of messages see them as close to their original order as possible. Messages are only sorted within a
+// batch, so the order is only fully preserved if every dead-lettered message fits in one.
+func ReplayInEnqueueOrder() ReplayOption {
+	return func(o *replayOptions) error {
+		o.inEnqueueOrder = true
+		return nil
+	}
+}
+
+// ReplayWithRateLimit limits the rate at which messages are sent back to the queue to msgsPerSecond, so a large replay
+// does not swamp its consumers. A batch which takes longer than the lock duration of the queue to replay at that rate
+// has the locks of its remaining messages renewed as it goes.
+func ReplayWithRateLimit(msgsPerSecond float64) ReplayOption {
+	return func(o *replayOptions) error {
+		if msgsPerSecond <= 0 {
+			return errors.New("rate must be greater than 0")
+		}
+		o.rate = msgsPerSecond
+		return nil
+	}
+}
+
+// ReplayDeadLetters sends the messages in the Queue's dead-letter queue back to the Queue, once the cause of their
+// failure has been fixed, and returns how many were replayed. Each message is sent before it is completed in the
+// dead-letter queue, so a replay which fails part way through never loses a message, though the message being replayed
+// at the time may be sent twice. Replayed messages keep their ID, so they are discarded as duplicates if the Queue
+// detects duplicates and they were first sent within its detection window. The reason they were dead-lettered is
+// removed from their properties. Messages whose lock expired while they waited in the prefetch buffer are left for a
+// later batch, as they can no longer be completed.
+func (q *Queue) ReplayDeadLetters(ctx context.Context, opts ...ReplayOption) (int, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ReplayDeadLetters")
+	defer span.End()
+
+	options := &replayOptions{batchSize: defaultReplayBatchSize}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return 0, err
+		}
+	}
+	if options.rate > 0 {
+		limiter, err := newRateLimiter(options.rate, 1, q.namespace.getClock)
+		if err != nil {
+			return 0, err
+		}
+		options.limiter = limiter
+	}
+
+	r, err := q.namespace.newReceiver(ctx, q.Name+deadLetterQueueSuffix, receiverWithReceiveMode(PeekLockMode),
+		receiverWithPrefetchCount(uint32(options.batchSize)))
+	if err != nil {
+		log.For(ctx).Error(err)
+		return 0, err
+	}
+	// closing the receiver releases the locks on any messages not replayed
+	defer r.Close(ctx)
+
+	deadLetters := &entity{Name: q.Name + deadLetterQueueSuffix, namespace: q.namespace}
+	replay := &deadLetterReplay{
+		options: options,
+		receiveBatch: func(ctx context.Context, maxMessages int, handler Handler) error {
+			return r.ReceiveBatch(ctx, maxMessages, handler, purgeWaitTime)
+		},
+		send: q.Send,
+		complete: func(ctx context.Context, msg *Message) error {
+			msg.Complete()(ctx)
+			if msg.settledAs != OutcomeCompleted {
+				return fmt.Errorf("replayed message %q could not be completed in the dead-letter queue", msg.ID)
+			}
+			return nil
+		},
+		renew: deadLetters.RenewLocks,
+		clock: q.namespace.getClock(),
+	}
+	return replay.run(ctx)
+}
+
+// run replays batches of dead-lettered messages until none are left
+func (dr *deadLetterReplay) run(ctx context.Context) (int, error) {
+	replayed := 0
+	for {
+		var batch []*Message
+		err := dr.receiveBatch(ctx, dr.options.batchSize, HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+			batch = append(batch, msg)
+			// hold on to the message until the whole batch has been received and sorted
+			return func(context.Context) {}
+		}))
+		if _, ok := err.(ErrNoMessages); ok {
+			return replayed, nil
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			return replayed, err
+		}
+
+		receivedAt := dr.clock.Now()
+		batch = unexpired(receivedAt, batch)
+		if len(batch) == 0 {
+			continue
+		}
+
+		if dr.options.inEnqueueOrder {
+			sort.SliceStable(batch, func(i, j int) bool {
+				return enqueuedSequenceNumber(batch[i]) < enqueuedSequenceNumber(batch[j])
+			})
+		}
+
+		// the batch is renewed once half of its shortest lock has gone by, and again each time as long again has
+		interval := lockRenewalInterval(receivedAt, earliestLock(batch))
+		renewAt := receivedAt.Add(interval)
+		for i, msg := range batch {
+			if err := dr.options.limiter.wait(ctx, 1); err != nil {
+				return replayed, err
+			}
+			if now := dr.clock.Now(); !now.Before(renewAt) {
+				if err := dr.renew(ctx, batch[i:]); err != nil {
+					log.For(ctx).Error(err)
+					return replayed, err
+				}
+				renewAt = now.Add(interval)
+			}
+			if err := dr.send(ctx, copyForReplay(msg)); err != nil {
+				log.For(ctx).Error(err)
+				return replayed, err
+			}
+			if err := dr.complete(ctx, msg); err != nil {
+				log.For(ctx).Error(err)
+				return replayed, err
+			}
+			replayed++
+		}
+	}
+}
+
+// unexpired returns the messages of the batch whose locks have not expired by now, such as messages which sat in the
+// prefetch buffer while the previous batch was replayed. Messages with expired locks are delivered again later.
+func unexpired(now time.Time, batch []*Message) []*Message {
+	live := batch[:0]
+	for _, msg := range batch {
+		if sp := msg.SystemProperties; sp != nil && sp.LockedUntil != nil && !sp.LockedUntil.After(now) {
+			continue
+		}
+		live = append(live, msg)
+	}
+	return live
+}
+
+// earliestLock returns the message of the batch whose lock is known to expire first, or the first message if none are
+func earliestLock(batch []*Message) *Message {
+	earliest := batch[0]
+	for _, msg := range batch[1:] {
+		sp := msg.SystemProperties
+		if sp == nil || sp.LockedUntil == nil {
+			continue
+		}
+		if esp := earliest.SystemProperties; esp == nil || esp.LockedUntil == nil || sp.LockedUntil.Before(*esp.LockedUntil) {
+			earliest = msg
+		}
+	}
+	return earliest
+}
+
+// enqueuedSequenceNumber returns the sequence number the message was originally enqueued with, before it was moved to
+// the dead-letter queue
+func enqueuedSequenceNumber(msg *Message) int64 {
+	sp := msg.SystemProperties
+	switch {
+	case sp == nil:
+		return 0
+	case sp.EnqueuedSequenceNumber != nil:
+		return *sp.EnqueuedSequenceNumber
+	case sp.SequenceNumber != nil:
+		return *sp.SequenceNumber
+	default:
+		return 0
+	}
+}
+
+// copyForReplay copies a dead-lettered message to be sent again, without the reason it was dead-lettered
+func copyForReplay(msg *Message) *Message {
+	replayed := copyForMove(msg)
+	delete(replayed.UserProperties, DeadLetterReasonProperty)
+	delete(replayed.UserProperties, DeadLetterErrorDescriptionProperty)
+	if len(replayed.UserProperties) == 0 {
+		replayed.UserProperties = nil
+	}
+	return replayed
+}
@@ -0,0 +1,171 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// messageBatches returns a receiveBatch func handing out the batches in turn, then ErrNoMessages
+func messageBatches(batches ...[]*Message) func(context.Context, int, Handler) error {
+	return func(ctx context.Context, _ int, handler Handler) error {
+		if len(batches) == 0 {
+			return ErrNoMessages{}
+		}
+		for _, msg := range batches[0] {
+			handler.Handle(ctx, msg)(ctx)
+		}
+		batches = batches[1:]
+		return nil
+	}
+}
+
+func deadLettered(id string, enqueuedSeq int64) *Message {
+	msg := NewMessageFromString(id)
+	msg.ID = id
+	msg.UserProperties = map[string]interface{}{
+		DeadLetterReasonProperty: "downstream outage",
+		"tenant":                 "contoso",
+	}
+	msg.SystemProperties = &SystemProperties{EnqueuedSequenceNumber: &enqueuedSeq}
+	return msg
+}
+
+func TestDeadLetterReplay_InEnqueueOrder(t *testing.T) {
+	sender := new(recordingSender)
+	var completed []string
+	replay := &deadLetterReplay{
+		options:      &replayOptions{batchSize: 3, inEnqueueOrder: true},
+		receiveBatch: messageBatches([]*Message{deadLettered("c", 3), deadLettered("a", 1), deadLettered("b", 2)}, []*Message{deadLettered("d", 4)}),
+		send:         sender.Send,
+		complete: func(_ context.Context, msg *Message) error {
+			completed = append(completed, msg.ID)
+			return nil
+		},
+		clock: systemClock{},
+	}
+
+	replayed, err := replay.run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, replayed)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, completed)
+	if assert.Len(t, sender.sent, 4) {
+		for i, id := range completed {
+			assert.Equal(t, id, sender.sent[i].ID)
+		}
+		assert.Equal(t, map[string]interface{}{"tenant": "contoso"}, sender.sent[0].UserProperties)
+		assert.Nil(t, sender.sent[0].SystemProperties)
+	}
+}
+
+func TestDeadLetterReplay_StopsWithoutCompletingUnsentMessages(t *testing.T) {
+	sendErr := errors.New("queue unavailable")
+	var completed int
+	replay := &deadLetterReplay{
+		options:      &replayOptions{batchSize: 2},
+		receiveBatch: messageBatches([]*Message{deadLettered("b", 2), deadLettered("a", 1)}),
+		send: func(context.Context, *Message) error {
+			return sendErr
+		},
+		complete: func(context.Context, *Message) error {
+			completed++
+			return nil
+		},
+		clock: systemClock{},
+	}
+
+	replayed, err := replay.run(context.Background())
+	assert.Equal(t, sendErr, err)
+	assert.Zero(t, replayed)
+	assert.Zero(t, completed)
+}
+
+func TestDeadLetterReplay_RateLimit(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	limiter, err := newRateLimiter(1, 1, func() Clock { return clock })
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sender := new(recordingSender)
+	replay := &deadLetterReplay{
+		options:      &replayOptions{batchSize: 2, limiter: limiter},
+		receiveBatch: messageBatches([]*Message{deadLettered("a", 1), deadLettered("b", 2)}),
+		send:         sender.Send,
+		complete:     func(context.Context, *Message) error { return nil },
+		clock:        clock,
+	}
+
+	done := make(chan int)
+	go func() {
+		replayed, _ := replay.run(context.Background())
+		done <- replayed
+	}()
+	clock.waitForCalls(1)
+	clock.Advance(time.Second)
+	assert.Equal(t, 2, <-done)
+}
+
+func TestDeadLetterReplay_RenewsLocksOfASlowBatch(t *testing.T) {
+	start := time.Now()
+	clock := newFakeClock(start)
+	limiter, err := newRateLimiter(1, 1, func() Clock { return clock })
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	locked := func(id string, seq int64) *Message {
+		msg := deadLettered(id, seq)
+		until := start.Add(4 * time.Second)
+		msg.SystemProperties.LockedUntil = &until
+		return msg
+	}
+	expired := deadLettered("expired", 0)
+	lapsed := start.Add(-time.Second)
+	expired.SystemProperties.LockedUntil = &lapsed
+
+	sender := new(recordingSender)
+	var renewed [][]string
+	replay := &deadLetterReplay{
+		options:      &replayOptions{batchSize: 5, limiter: limiter},
+		receiveBatch: messageBatches([]*Message{expired, locked("a", 1), locked("b", 2), locked("c", 3), locked("d", 4)}),
+		send:         sender.Send,
+		complete:     func(context.Context, *Message) error { return nil },
+		renew: func(_ context.Context, msgs []*Message) error {
+			var ids []string
+			for _, msg := range msgs {
+				ids = append(ids, msg.ID)
+			}
+			renewed = append(renewed, ids)
+			return nil
+		},
+		clock: clock,
+	}
+
+	done := make(chan int)
+	go func() {
+		replayed, _ := replay.run(context.Background())
+		done <- replayed
+	}()
+	for i := 0; i < 3; i++ {
+		clock.waitForCalls(i + 1)
+		clock.Advance(time.Second)
+	}
+
+	assert.Equal(t, 4, <-done)
+	assert.Equal(t, [][]string{{"c", "d"}}, renewed, "the rest of the batch is renewed half way through its locks")
+	if assert.Len(t, sender.sent, 4) {
+		assert.Equal(t, "a", sender.sent[0].ID, "a message whose lock lapsed in the buffer is not replayed")
+	}
+}
+
+func TestReplayOptions(t *testing.T) {
+	options := new(replayOptions)
+	assert.Error(t, ReplayWithBatchSize(0)(options))
+	assert.Error(t, ReplayWithRateLimit(0)(options))
+	assert.NoError(t, ReplayInEnqueueOrder()(options))
+	assert.True(t, options.inEnqueueOrder)
+}
@@ -0,0 +1,446 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+)
+
+const (
+	// brokerPropertiesHeader carries the system properties of a message sent or received over the REST API as JSON
+	brokerPropertiesHeader = "BrokerProperties"
+
+	defaultRESTReceiveTimeout = 30 * time.Second
+	maxRESTReceiveTimeout     = 55 * time.Second
+)
+
+var (
+	// restResponseHeaders are the headers of a received message which are not user properties
+	restResponseHeaders = map[string]bool{
+		"Brokerproperties":          true,
+		"Content-Length":            true,
+		"Content-Type":              true,
+		"Date":                      true,
+		"Location":                  true,
+		"Server":                    true,
+		"Strict-Transport-Security": true,
+		"Transfer-Encoding":         true,
+	}
+)
+
+type (
+	// RESTClient sends and receives messages over the Service Bus REST API, for environments where the AMQP ports are
+	// blocked and even AMQP over WebSockets is unavailable. It works with the same Message as a Queue or Topic, but each
+	// operation is a separate HTTPS request, so throughput is far lower than over AMQP; use it only as a fallback.
+	//
+	// Received messages are settled through the RESTClient rather than their disposition actions. User property names
+	// travel as HTTP headers, so they are received in canonical header form, such as "Order-Id" for "order-id".
+	RESTClient struct {
+		namespace      *Namespace
+		entityPath     string
+		manager        *atom.EntityManager
+		receiveTimeout time.Duration
+	}
+
+	// RESTClientOption configures a RESTClient
+	RESTClientOption func(*RESTClient) error
+
+	// brokerProperties is the JSON form of the system properties of a message in the REST API
+	brokerProperties struct {
+		ContentType             string   `json:",omitempty"`
+		CorrelationID           string   `json:"CorrelationId,omitempty"`
+		DeadLetterSource        string   `json:",omitempty"`
+		DeliveryCount           uint32   `json:",omitempty"`
+		EnqueuedSequenceNumber  int64    `json:",omitempty"`
+		EnqueuedTimeUtc         string   `json:",omitempty"`
+		Label                   string   `json:",omitempty"`
+		LockToken               string   `json:",omitempty"`
+		LockedUntilUtc          string   `json:",omitempty"`
+		MessageID               string   `json:"MessageId,omitempty"`
+		PartitionKey            string   `json:",omitempty"`
+		ReplyTo                 string   `json:",omitempty"`
+		ReplyToSessionID        string   `json:"ReplyToSessionId,omitempty"`
+		ScheduledEnqueueTimeUtc string   `json:",omitempty"`
+		SequenceNumber          int64    `json:",omitempty"`
+		SessionID               string   `json:"SessionId,omitempty"`
+		TimeToLive              *float64 `json:",omitempty"`
+		To                      string   `json:",omitempty"`
+	}
+)
+
+// RESTClientWithReceiveTimeout configures how long a receive waits for a message to arrive before returning
+// ErrNoMessages. The default is 30 seconds and the REST API allows at most 55 seconds.
+func RESTClientWithReceiveTimeout(timeout time.Duration) RESTClientOption {
+	return func(rc *RESTClient) error {
+		if timeout < time.Second || timeout > maxRESTReceiveTimeout {
+			return fmt.Errorf("receive timeout must be between 1 second and %s", maxRESTReceiveTimeout)
+		}
+		rc.receiveTimeout = timeout
+		return nil
+	}
+}
+
+// NewRESTClient creates a RESTClient for the Queue, Topic or Subscription at entityPath; Subscriptions are addressed
+// as "topic/subscriptions/name"
+func (ns *Namespace) NewRESTClient(entityPath string, opts ...RESTClientOption) (*RESTClient, error) {
+	if err := ns.checkEntityPath(entityPath); err != nil {
+		return nil, err
+	}
+
+	manager := ns.NewEntityManager()
+	// sends, receives and settlements are not idempotent, so they are not retried under the management RetryPolicy
+	manager.Retry = nil
+	rc := &RESTClient{
+		namespace:      ns,
+		entityPath:     strings.Trim(entityPath, "/"),
+		manager:        manager,
+		receiveTimeout: defaultRESTReceiveTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(rc); err != nil {
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// Send sends the message to the Queue or Topic. Messages with an AMQP Value body cannot be sent over the REST API.
+func (rc *RESTClient) Send(ctx context.Context, msg *Message) error {
+	span, ctx := rc.namespace.startSpanFromContext(ctx, "sb.RESTClient.Send")
+	defer span.End()
+
+	if msg.Value != nil {
+		return errors.New("messages with a Value body cannot be sent over the REST API")
+	}
+
+	headers, err := restHeaders(msg)
+	if err != nil {
+		return err
+	}
+
+	res, err := rc.manager.Execute(ctx, http.MethodPost, rc.entityPath+"/messages", bytes.NewReader(msg.Data), withHeaders(headers))
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return checkRESTResponse(res, http.StatusCreated)
+}
+
+// ReceiveAndDelete receives the next message, removing it from the entity as it is received. ErrNoMessages is
+// returned if no message arrives within the receive timeout.
+func (rc *RESTClient) ReceiveAndDelete(ctx context.Context) (*Message, error) {
+	span, ctx := rc.namespace.startSpanFromContext(ctx, "sb.RESTClient.ReceiveAndDelete")
+	defer span.End()
+
+	return rc.receive(ctx, http.MethodDelete, http.StatusOK)
+}
+
+// PeekLock receives and locks the next message, which must then be settled with Complete or Abandon before its lock
+// expires. ErrNoMessages is returned if no message arrives within the receive timeout.
+func (rc *RESTClient) PeekLock(ctx context.Context) (*Message, error) {
+	span, ctx := rc.namespace.startSpanFromContext(ctx, "sb.RESTClient.PeekLock")
+	defer span.End()
+
+	return rc.receive(ctx, http.MethodPost, http.StatusCreated)
+}
+
+// Complete deletes a message received with PeekLock from the entity
+func (rc *RESTClient) Complete(ctx context.Context, msg *Message) error {
+	span, ctx := rc.namespace.startSpanFromContext(ctx, "sb.RESTClient.Complete")
+	defer span.End()
+
+	return rc.settle(ctx, http.MethodDelete, msg)
+}
+
+// Abandon unlocks a message received with PeekLock so it is delivered again
+func (rc *RESTClient) Abandon(ctx context.Context, msg *Message) error {
+	span, ctx := rc.namespace.startSpanFromContext(ctx, "sb.RESTClient.Abandon")
+	defer span.End()
+
+	return rc.settle(ctx, http.MethodPut, msg)
+}
+
+func (rc *RESTClient) receive(ctx context.Context, method string, expected int) (*Message, error) {
+	timeout := strconv.Itoa(int(rc.receiveTimeout / time.Second))
+	res, err := rc.manager.Execute(ctx, method, rc.entityPath+"/messages/head", nil, withQuery("timeout", timeout))
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil, ErrNoMessages{}
+	}
+	if err := checkRESTResponse(res, expected); err != nil {
+		return nil, err
+	}
+	return messageFromRESTResponse(res)
+}
+
+func (rc *RESTClient) settle(ctx context.Context, method string, msg *Message) error {
+	if msg.LockToken == nil || msg.SystemProperties == nil || msg.SystemProperties.SequenceNumber == nil {
+		return errors.New("only messages received with PeekLock can be settled")
+	}
+
+	path := fmt.Sprintf("%s/messages/%d/%s", rc.entityPath, *msg.SystemProperties.SequenceNumber, msg.LockToken.String())
+	res, err := rc.manager.Execute(ctx, method, path, nil)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return checkRESTResponse(res, http.StatusOK)
+}
+
+// restHeaders returns the headers carrying the properties of a message sent over the REST API
+func restHeaders(msg *Message) (http.Header, error) {
+	props := brokerProperties{
+		CorrelationID:    msg.CorrelationID,
+		Label:            msg.Label,
+		MessageID:        msg.ID,
+		ReplyTo:          msg.ReplyTo,
+		ReplyToSessionID: msg.ReplyToGroupID,
+		To:               msg.To,
+	}
+	if msg.GroupID != nil {
+		props.SessionID = *msg.GroupID
+	}
+	if msg.TTL != nil {
+		ttl := msg.TTL.Seconds()
+		props.TimeToLive = &ttl
+	}
+	if sp := msg.SystemProperties; sp != nil {
+		if sp.PartitionKey != nil {
+			props.PartitionKey = *sp.PartitionKey
+		}
+		if sp.ScheduledEnqueueTime != nil {
+			props.ScheduledEnqueueTimeUtc = sp.ScheduledEnqueueTime.UTC().Format(http.TimeFormat)
+		}
+	}
+
+	encoded, err := json.Marshal(props)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(http.Header)
+	headers.Set(brokerPropertiesHeader, string(encoded))
+	headers.Set("Content-Type", "application/octet-stream")
+	if msg.ContentType != "" {
+		headers.Set("Content-Type", msg.ContentType)
+	}
+
+	for key, value := range msg.UserProperties {
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC().Format(http.TimeFormat)
+		}
+		switch value.(type) {
+		case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		default:
+			return nil, fmt.Errorf("user property %q of type %T cannot be sent over the REST API", key, value)
+		}
+		// strings are quoted while numbers and booleans are not, which lets the service restore their types
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		headers.Set(key, string(encoded))
+	}
+	return headers, nil
+}
+
+// messageFromRESTResponse builds a Message from a message received over the REST API
+func messageFromRESTResponse(res *http.Response) (*Message, error) {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var props brokerProperties
+	if raw := res.Header.Get(brokerPropertiesHeader); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &props); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := &Message{
+		ContentType:      res.Header.Get("Content-Type"),
+		CorrelationID:    props.CorrelationID,
+		Data:             body,
+		DeliveryCount:    props.DeliveryCount,
+		ID:               props.MessageID,
+		Label:            props.Label,
+		ReplyTo:          props.ReplyTo,
+		ReplyToGroupID:   props.ReplyToSessionID,
+		To:               props.To,
+		SystemProperties: new(SystemProperties),
+	}
+	if props.SessionID != "" {
+		msg.GroupID = &props.SessionID
+	}
+	if props.TimeToLive != nil {
+		ttl := time.Duration(*props.TimeToLive * float64(time.Second))
+		msg.TTL = &ttl
+	}
+	if props.LockToken != "" {
+		lockToken, err := parseLockToken(props.LockToken)
+		if err != nil {
+			return nil, err
+		}
+		msg.LockToken = lockToken
+	}
+
+	sp := msg.SystemProperties
+	if props.SequenceNumber != 0 {
+		sp.SequenceNumber = &props.SequenceNumber
+	}
+	if props.EnqueuedSequenceNumber != 0 {
+		sp.EnqueuedSequenceNumber = &props.EnqueuedSequenceNumber
+	}
+	if props.PartitionKey != "" {
+		sp.PartitionKey = &props.PartitionKey
+	}
+	if props.DeadLetterSource != "" {
+		sp.DeadLetterSource = &props.DeadLetterSource
+	}
+	sp.EnqueuedTime = parseRESTTime(props.EnqueuedTimeUtc)
+	sp.LockedUntil = parseRESTTime(props.LockedUntilUtc)
+	sp.ScheduledEnqueueTime = parseRESTTime(props.ScheduledEnqueueTimeUtc)
+
+	for key, values := range res.Header {
+		if restResponseHeaders[key] || len(values) == 0 {
+			continue
+		}
+		value, ok := restPropertyValue(values[0])
+		if !ok {
+			// not a property the service encoded, such as a header added by a proxy
+			continue
+		}
+		if msg.UserProperties == nil {
+			msg.UserProperties = make(map[string]interface{})
+		}
+		msg.UserProperties[key] = value
+	}
+	return msg, nil
+}
+
+// restPropertyValue decodes a user property header, restoring quoted strings, booleans and numbers, with whole
+// numbers as int64
+func restPropertyValue(header string) (interface{}, bool) {
+	dec := json.NewDecoder(strings.NewReader(header))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return nil, false
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		f, err := v.Float64()
+		return f, err == nil
+	case string, bool:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// checkRESTResponse returns an error describing the response unless it has the expected status code
+func checkRESTResponse(res *http.Response, expected int) error {
+	if res.StatusCode == expected {
+		return nil
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return ErrEntityNotFound{EntityPath: strings.TrimPrefix(res.Request.URL.Path, "/")}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("REST request failed with status code %d: %v", res.StatusCode, atom.NewManagementError(res, body))
+}
+
+func parseRESTTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(http.TimeFormat, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func parseLockToken(value string) (*uuid.UUID, error) {
+	raw, err := hex.DecodeString(strings.Replace(value, "-", "", -1))
+	if err != nil || len(raw) != len(uuid.UUID{}) {
+		return nil, fmt.Errorf("lock token %q is not a UUID", value)
+	}
+	var lockToken uuid.UUID
+	copy(lockToken[:], raw)
+	return &lockToken, nil
+}
+
+func withHeaders(headers http.Header) atom.RequestOption {
+	return func(req *http.Request) {
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+	}
+}
+
+func withQuery(key, value string) atom.RequestOption {
+	return func(req *http.Request) {
+		q := req.URL.Query()
+		q.Set(key, value)
+		req.URL.RawQuery = q.Encode()
+	}
+}
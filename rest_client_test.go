@@ -0,0 +1,152 @@
+package servicebus
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+)
+
+func newTestRESTClient(t *testing.T, handler http.HandlerFunc) (*RESTClient, func()) {
+	server := httptest.NewServer(handler)
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		server.Close()
+		t.FailNow()
+	}
+
+	rc := &RESTClient{
+		namespace:      ns,
+		entityPath:     "queue",
+		manager:        atom.NewEntityManager(server.URL+"/", staticTokenProvider("token")),
+		receiveTimeout: defaultRESTReceiveTimeout,
+	}
+	return rc, server.Close
+}
+
+func TestRESTClient_Send(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	rc, done := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer done()
+
+	group := "session"
+	ttl := 90 * time.Second
+	msg := NewMessageFromString("payload")
+	msg.ID = "id"
+	msg.Label = "label"
+	msg.GroupID = &group
+	msg.TTL = &ttl
+	msg.ContentType = "text/plain"
+	msg.UserProperties = map[string]interface{}{"region": "west", "attempt": 3}
+
+	if !assert.NoError(t, rc.Send(context.Background(), msg)) {
+		return
+	}
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/queue/messages", req.URL.Path)
+	assert.Equal(t, "token", req.Header.Get("Authorization"))
+	assert.Equal(t, "text/plain", req.Header.Get("Content-Type"))
+	assert.Equal(t, `"west"`, req.Header.Get("Region"))
+	assert.Equal(t, "3", req.Header.Get("Attempt"))
+	assert.Equal(t, "payload", string(body))
+
+	var props map[string]interface{}
+	if assert.NoError(t, json.Unmarshal([]byte(req.Header.Get(brokerPropertiesHeader)), &props)) {
+		assert.Equal(t, map[string]interface{}{
+			"MessageId":  "id",
+			"Label":      "label",
+			"SessionId":  "session",
+			"TimeToLive": float64(90),
+		}, props)
+	}
+
+	msg.UserProperties = map[string]interface{}{"nested": map[string]string{}}
+	assert.Error(t, rc.Send(context.Background(), msg))
+}
+
+func TestRESTClient_PeekLockAndComplete(t *testing.T) {
+	var settled *http.Request
+	rc, done := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/queue/messages/head":
+			assert.Equal(t, "30", r.URL.Query().Get("timeout"))
+			w.Header().Set(brokerPropertiesHeader, `{"DeliveryCount":2,"LockToken":"2e0d2f8c-2a47-4f6c-9c9e-1a2b3c4d5e6f",`+
+				`"LockedUntilUtc":"Mon, 01 Oct 2018 12:01:00 GMT","MessageId":"id","SequenceNumber":42,`+
+				`"EnqueuedTimeUtc":"Mon, 01 Oct 2018 12:00:00 GMT"}`)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Region", `"west"`)
+			w.Header().Set("Attempt", "3")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("payload"))
+		default:
+			settled = r
+		}
+	})
+	defer done()
+
+	msg, err := rc.PeekLock(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "payload", string(msg.Data))
+	assert.Equal(t, "id", msg.ID)
+	assert.Equal(t, "text/plain", msg.ContentType)
+	assert.Equal(t, uint32(2), msg.DeliveryCount)
+	assert.Equal(t, int64(42), *msg.SystemProperties.SequenceNumber)
+	assert.Equal(t, time.Date(2018, 10, 1, 12, 1, 0, 0, time.UTC), *msg.SystemProperties.LockedUntil)
+	assert.Equal(t, "2e0d2f8c-2a47-4f6c-9c9e-1a2b3c4d5e6f", msg.LockToken.String())
+	assert.Equal(t, map[string]interface{}{"Region": "west", "Attempt": int64(3)}, msg.UserProperties)
+
+	if assert.NoError(t, rc.Complete(context.Background(), msg)) {
+		assert.Equal(t, http.MethodDelete, settled.Method)
+		assert.Equal(t, "/queue/messages/42/2e0d2f8c-2a47-4f6c-9c9e-1a2b3c4d5e6f", settled.URL.Path)
+	}
+	if assert.NoError(t, rc.Abandon(context.Background(), msg)) {
+		assert.Equal(t, http.MethodPut, settled.Method)
+	}
+	assert.Error(t, rc.Complete(context.Background(), NewMessageFromString("never received")))
+}
+
+func TestRESTClient_ReceiveAndDelete(t *testing.T) {
+	status := http.StatusNoContent
+	rc, done := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		w.WriteHeader(status)
+	})
+	defer done()
+
+	_, err := rc.ReceiveAndDelete(context.Background())
+	assert.Equal(t, ErrNoMessages{}, err)
+
+	status = http.StatusNotFound
+	_, err = rc.ReceiveAndDelete(context.Background())
+	assert.IsType(t, ErrEntityNotFound{}, err)
+}
+
+func TestNewRESTClient(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = ns.NewRESTClient("queue", RESTClientWithReceiveTimeout(time.Minute))
+	assert.Error(t, err)
+	rc, err := ns.NewRESTClient("/topic/subscriptions/sub/", RESTClientWithReceiveTimeout(10*time.Second))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "topic/subscriptions/sub", rc.entityPath)
+		assert.Equal(t, 10*time.Second, rc.receiveTimeout)
+		assert.Nil(t, rc.manager.Retry, "REST sends and receives must not be retried")
+	}
+}
@@ -0,0 +1,186 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go"
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// RetryPolicy describes how an operation which failed with a transient error is retried. The management (ATOM)
+	// endpoints and the AMQP data plane have separate policies, configured with NamespaceWithManagementRetryPolicy and
+	// NamespaceWithDataPlaneRetryPolicy, as throttled HTTP calls and dropped links call for different back-off. A delay
+	// the service asks for, such as the Retry-After of a 429 or 503 response, takes precedence over the policy's own.
+	RetryPolicy struct {
+		// MaxAttempts is the number of times an operation is tried before its last error is returned
+		MaxAttempts int
+		// MinDelay is the wait before the first retry, which doubles with each further retry up to MaxDelay
+		MinDelay time.Duration
+		// MaxDelay caps the wait between two attempts
+		MaxDelay time.Duration
+		// Jitter, if positive, randomly lengthens or shortens each wait by up to its value so that clients which
+		// failed together do not all retry at the same moment
+		Jitter time.Duration
+	}
+)
+
+var (
+	// DefaultManagementRetryPolicy is used for management requests unless NamespaceWithManagementRetryPolicy says
+	// otherwise. Requests which were throttled, timed out or met a server error are retried for up to about a minute.
+	DefaultManagementRetryPolicy = RetryPolicy{
+		MaxAttempts: 5,
+		MinDelay:    2 * time.Second,
+		MaxDelay:    30 * time.Second,
+		Jitter:      250 * time.Millisecond,
+	}
+
+	// DefaultDataPlaneRetryPolicy is used for sends and receive link recovery unless NamespaceWithDataPlaneRetryPolicy
+	// says otherwise
+	DefaultDataPlaneRetryPolicy = RetryPolicy{
+		MaxAttempts: 10,
+		MinDelay:    4 * time.Second,
+		MaxDelay:    30 * time.Second,
+		Jitter:      500 * time.Millisecond,
+	}
+)
+
+// NamespaceWithManagementRetryPolicy configures how the namespace retries management requests, made over HTTP to
+// create, inspect and delete entities. Requests throttled with 429 Too Many Requests are retried, as are reads,
+// deletions and conditional updates which fail to reach the service, time out or meet a server error. Creations are
+// not retried after a server error, as they may have succeeded, and neither are the sends and receives of a
+// RESTClient. A policy of a single attempt disables retries.
+func NamespaceWithManagementRetryPolicy(policy RetryPolicy) NamespaceOption {
+	return func(ns *Namespace) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		ns.managementRetry = &policy
+		return nil
+	}
+}
+
+// NamespaceWithDataPlaneRetryPolicy configures how the namespace retries sends which fail with an AMQP error, and how
+// often receivers try to recover a link which was lost before giving up
+func NamespaceWithDataPlaneRetryPolicy(policy RetryPolicy) NamespaceOption {
+	return func(ns *Namespace) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		ns.dataPlaneRetry = &policy
+		return nil
+	}
+}
+
+// validate checks that the policy allows at least one attempt and that its delays are consistent
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return errors.New("retry policy must allow at least one attempt")
+	case p.MinDelay < 0 || p.Jitter < 0:
+		return errors.New("retry policy delays must not be negative")
+	case p.MaxDelay < p.MinDelay:
+		return errors.New("retry policy max delay must not be less than its min delay")
+	}
+	return nil
+}
+
+// delay returns the wait after the failed attempt, which is the one the service asked for when err carries it
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	if after, ok := ErrorRetryAfter(err); ok {
+		return after
+	}
+
+	delay := backoffDelay(p.MinDelay, p.MaxDelay, attempt)
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(2*p.Jitter))) - p.Jitter
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// managementRetryPolicy returns the RetryPolicy configured for management requests, falling back to the default
+func (ns *Namespace) managementRetryPolicy() RetryPolicy {
+	if ns == nil || ns.managementRetry == nil {
+		return DefaultManagementRetryPolicy
+	}
+	return *ns.managementRetry
+}
+
+// dataPlaneRetryPolicy returns the RetryPolicy configured for AMQP operations, falling back to the default
+func (ns *Namespace) dataPlaneRetryPolicy() RetryPolicy {
+	if ns == nil || ns.dataPlaneRetry == nil {
+		return DefaultDataPlaneRetryPolicy
+	}
+	return *ns.dataPlaneRetry
+}
+
+// retryManagement backs off after a failed attempt of a management request, reporting whether the request should be
+// sent again under the namespace's management RetryPolicy
+func (ns *Namespace) retryManagement(ctx context.Context, attempt int, res *http.Response, err error) bool {
+	policy := ns.managementRetryPolicy()
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+
+	delay := policy.delay(attempt, err)
+	if err != nil {
+		log.For(ctx).Debug("management request failed, retrying in " + delay.String() + ": " + err.Error())
+	} else {
+		log.For(ctx).Debug("management request failed with " + res.Status + ", retrying in " + delay.String())
+	}
+	return ns.sleep(ctx, delay) == nil
+}
+
+// retryWithPolicy will attempt an action up to the policy's maximum number of attempts while it returns a
+// common.Retryable error or one carrying a RetryAfter delay, backing off between attempts as measured by the
+// namespace Clock
+func (ns *Namespace) retryWithPolicy(ctx context.Context, policy RetryPolicy, action func() (interface{}, error)) (interface{}, error) {
+	for attempt := 1; ; attempt++ {
+		item, err := action()
+		if err == nil {
+			return item, nil
+		}
+
+		if _, ok := ErrorRetryAfter(err); !ok {
+			if _, ok := err.(common.Retryable); !ok {
+				return nil, err
+			}
+		}
+		if attempt >= policy.MaxAttempts {
+			return nil, err
+		}
+
+		if err := ns.sleep(ctx, policy.delay(attempt, err)); err != nil {
+			return nil, err
+		}
+	}
+}
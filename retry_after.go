@@ -0,0 +1,98 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"strconv"
+	"time"
+
+	"pack.ag/amqp"
+)
+
+const (
+	// serverBusyCondition is the AMQP error condition Service Bus uses when it is throttling a namespace
+	serverBusyCondition amqp.ErrorCondition = "com.microsoft:server-busy"
+)
+
+var (
+	// retryAfterInfoKeys are the keys of an AMQP error's info map which may carry the delay to wait before retrying
+	retryAfterInfoKeys = []string{"com.microsoft:retry-after", "retry-after"}
+)
+
+type retryAfterer interface {
+	RetryAfter() (time.Duration, bool)
+}
+
+// ErrorRetryAfter returns the delay the service asked for before an operation which failed with err is retried. The
+// delay is available for throttling errors from both the AMQP links and the management endpoints.
+func ErrorRetryAfter(err error) (time.Duration, bool) {
+	if ra, ok := serverBusy(err).(retryAfterer); ok {
+		return ra.RetryAfter()
+	}
+	return 0, false
+}
+
+// serverBusy converts AMQP errors reporting that the namespace is throttling requests into ErrServerBusy, leaving any
+// other error as it was
+func serverBusy(err error) error {
+	var amqpErr *amqp.Error
+	switch e := err.(type) {
+	case *amqp.Error:
+		amqpErr = e
+	case *amqp.DetachError:
+		amqpErr = e.RemoteError
+	}
+
+	if amqpErr == nil || amqpErr.Condition != serverBusyCondition {
+		return err
+	}
+	return ErrServerBusy{
+		Description: amqpErr.Description,
+		retryAfter:  retryAfterFromInfo(amqpErr.Info),
+	}
+}
+
+// retryAfterFromInfo reads the retry delay from an AMQP error info map. Numbers are milliseconds, as durations are
+// elsewhere in AMQP, while strings may be either a Go duration or a number of seconds as in an HTTP Retry-After header.
+func retryAfterFromInfo(info map[string]interface{}) time.Duration {
+	for _, key := range retryAfterInfoKeys {
+		switch v := info[key].(type) {
+		case int32:
+			return time.Duration(v) * time.Millisecond
+		case int64:
+			return time.Duration(v) * time.Millisecond
+		case uint32:
+			return time.Duration(v) * time.Millisecond
+		case uint64:
+			return time.Duration(v) * time.Millisecond
+		case string:
+			if d, err := time.ParseDuration(v); err == nil && d > 0 {
+				return d
+			}
+			if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestServerBusy(t *testing.T) {
+	busy := &amqp.Error{
+		Condition:   serverBusyCondition,
+		Description: "namespace is being throttled",
+		Info:        map[string]interface{}{"com.microsoft:retry-after": int64(1500)},
+	}
+
+	err := serverBusy(busy)
+	if assert.IsType(t, ErrServerBusy{}, err) {
+		assert.Equal(t, "namespace is being throttled", err.(ErrServerBusy).Description)
+	}
+	after, ok := ErrorRetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, after)
+
+	after, ok = ErrorRetryAfter(&amqp.DetachError{RemoteError: busy})
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, after)
+
+	busy.Info = map[string]interface{}{"retry-after": "3"}
+	after, ok = ErrorRetryAfter(busy)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, after)
+
+	busy.Info = nil
+	_, ok = ErrorRetryAfter(busy)
+	assert.False(t, ok, "a server busy error without a delay leaves the choice of delay to the caller")
+	assert.IsType(t, ErrServerBusy{}, serverBusy(busy))
+
+	other := &amqp.Error{Condition: amqp.ErrorInternalError}
+	assert.Equal(t, other, serverBusy(other))
+	_, ok = ErrorRetryAfter(errors.New("boom"))
+	assert.False(t, ok)
+}
+
+func TestErrorRetryAfter_Management(t *testing.T) {
+	var err error = &atom.ServerBusyError{StatusCode: 503}
+	_, ok := ErrorRetryAfter(err)
+	assert.False(t, ok)
+}
+
+func TestNamespace_RetryHonorsRetryAfter(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		_, err := ns.retry(context.Background(), 2, time.Hour, func() (interface{}, error) {
+			attempts++
+			if attempts < 2 {
+				return nil, ErrServerBusy{retryAfter: 5 * time.Second}
+			}
+			return nil, nil
+		})
+		done <- err
+	}()
+
+	for clock.pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(5 * time.Second)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry did not honor the delay the service asked for")
+	}
+}
@@ -0,0 +1,197 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// RetryAttemptProperty is the user property which counts how many times a RetryPolicyReceiver has rescheduled a
+	// message
+	RetryAttemptProperty = "retry-attempt"
+
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = 10 * time.Second
+	defaultRetryMaxDelay    = 10 * time.Minute
+)
+
+type (
+	// MessageScheduler is an entity messages can be scheduled on, such as a Queue
+	MessageScheduler interface {
+		ScheduleAt(ctx context.Context, enqueueTime time.Time, messages ...*Message) ([]int64, error)
+	}
+
+	// RetryHandler processes a message received by a RetryPolicyReceiver. Returning nil completes the message;
+	// returning an error schedules the message to be retried.
+	RetryHandler func(ctx context.Context, msg *Message) error
+
+	// RetryPolicyReceiver receives messages and retries those whose handler fails after an exponentially increasing
+	// delay. A failed message is copied and scheduled, and the original is completed, so the entity keeps delivering
+	// other messages while the retry waits; after the maximum number of attempts the message is dead-lettered instead.
+	RetryPolicyReceiver struct {
+		receiver    MessageReceiver
+		scheduler   MessageScheduler
+		maxAttempts int
+		baseDelay   time.Duration
+		maxDelay    time.Duration
+		clock       Clock
+	}
+
+	// RetryPolicyOption configures a RetryPolicyReceiver
+	RetryPolicyOption func(*RetryPolicyReceiver) error
+)
+
+// RetryPolicyWithMaxAttempts configures how many times a message is handled before it is dead-lettered. The default
+// is 5.
+func RetryPolicyWithMaxAttempts(attempts int) RetryPolicyOption {
+	return func(rr *RetryPolicyReceiver) error {
+		if attempts < 1 {
+			return errors.New("max attempts must be at least 1")
+		}
+		rr.maxAttempts = attempts
+		return nil
+	}
+}
+
+// RetryPolicyWithBackoff configures the delay before the first retry, which doubles with each further retry up to
+// maxDelay. The defaults are 10 seconds and 10 minutes.
+func RetryPolicyWithBackoff(baseDelay, maxDelay time.Duration) RetryPolicyOption {
+	return func(rr *RetryPolicyReceiver) error {
+		if baseDelay <= 0 || maxDelay < baseDelay {
+			return errors.New("base delay must be greater than 0 and no greater than max delay")
+		}
+		rr.baseDelay = baseDelay
+		rr.maxDelay = maxDelay
+		return nil
+	}
+}
+
+// RetryPolicyWithClock configures the RetryPolicyReceiver to use the provided Clock to schedule retries rather than
+// the system clock
+func RetryPolicyWithClock(clock Clock) RetryPolicyOption {
+	return func(rr *RetryPolicyReceiver) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		rr.clock = clock
+		return nil
+	}
+}
+
+// NewRetryPolicyReceiver creates a RetryPolicyReceiver which receives from receiver and schedules retries on
+// scheduler. The scheduler is usually the Queue being received from; when receiving from a Subscription, it is a
+// retry Queue whose messages are forwarded back to the topic or handled by the same code.
+func NewRetryPolicyReceiver(receiver MessageReceiver, scheduler MessageScheduler, opts ...RetryPolicyOption) (*RetryPolicyReceiver, error) {
+	if receiver == nil || scheduler == nil {
+		return nil, errors.New("both a receiver and a scheduler are required")
+	}
+
+	rr := &RetryPolicyReceiver{
+		receiver:    receiver,
+		scheduler:   scheduler,
+		maxAttempts: defaultRetryMaxAttempts,
+		baseDelay:   defaultRetryBaseDelay,
+		maxDelay:    defaultRetryMaxDelay,
+		clock:       systemClock{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(rr); err != nil {
+			return nil, err
+		}
+	}
+	return rr, nil
+}
+
+// Receive receives messages until the context is done, passing each to the handler and retrying or dead-lettering
+// those it fails. The receiver must receive in PeekLock mode.
+func (rr *RetryPolicyReceiver) Receive(ctx context.Context, handler RetryHandler) error {
+	return rr.receiver.Receive(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		return rr.handle(ctx, msg, handler)
+	}))
+}
+
+func (rr *RetryPolicyReceiver) handle(ctx context.Context, msg *Message, handler RetryHandler) DispositionAction {
+	err := handler(ctx, msg)
+	if err == nil {
+		return msg.Complete()
+	}
+
+	attempt := retryAttempt(msg) + 1
+	if attempt >= rr.maxAttempts {
+		log.For(ctx).Error(fmt.Errorf("message %s failed after %d attempts: %v", msg.ID, attempt, err))
+		return msg.DeadLetter(err)
+	}
+
+	retry := copyForMove(msg)
+	// a new ID keeps duplicate detection from discarding the retry
+	retry.ID = ""
+	if retry.UserProperties == nil {
+		retry.UserProperties = make(map[string]interface{})
+	}
+	retry.UserProperties[RetryAttemptProperty] = int32(attempt)
+
+	if _, scheduleErr := rr.scheduler.ScheduleAt(ctx, rr.clock.Now().Add(rr.delay(attempt)), retry); scheduleErr != nil {
+		// leave the message to be redelivered as usual
+		log.For(ctx).Error(scheduleErr)
+		return msg.Abandon()
+	}
+	return msg.Complete()
+}
+
+// delay returns the back-off before the retry following the attempt
+func (rr *RetryPolicyReceiver) delay(attempt int) time.Duration {
+	return backoffDelay(rr.baseDelay, rr.maxDelay, attempt)
+}
+
+// backoffDelay returns baseDelay doubled for each attempt after the first, up to maxDelay
+func backoffDelay(baseDelay, maxDelay time.Duration, attempt int) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
+
+// retryAttempt returns the number of times the message has been retried
+func retryAttempt(msg *Message) int {
+	switch attempt := msg.UserProperties[RetryAttemptProperty].(type) {
+	case int32:
+		return int(attempt)
+	case int64:
+		return int(attempt)
+	case int:
+		return attempt
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,108 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingScheduler struct {
+	err       error
+	scheduled []*Message
+	at        []time.Time
+}
+
+func (rs *recordingScheduler) ScheduleAt(_ context.Context, enqueueTime time.Time, messages ...*Message) ([]int64, error) {
+	if rs.err != nil {
+		return nil, rs.err
+	}
+	rs.scheduled = append(rs.scheduled, messages...)
+	rs.at = append(rs.at, enqueueTime)
+	return make([]int64, len(messages)), nil
+}
+
+func TestRetryPolicyReceiver_SchedulesWithBackoff(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := new(recordingScheduler)
+	rr, err := NewRetryPolicyReceiver(new(replayReceiver), scheduler,
+		RetryPolicyWithClock(newFakeClock(now)),
+		RetryPolicyWithMaxAttempts(3),
+		RetryPolicyWithBackoff(time.Second, time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	failing := func(context.Context, *Message) error { return errors.New("downstream unavailable") }
+	msg := NewMessageFromString("payload")
+	msg.ID = "original"
+	msg.UserProperties = map[string]interface{}{"key": "value"}
+
+	assert.NotNil(t, rr.handle(context.Background(), msg, failing))
+	if !assert.Len(t, scheduler.scheduled, 1) {
+		return
+	}
+	retry := scheduler.scheduled[0]
+	assert.Equal(t, "payload", string(retry.Data))
+	assert.Empty(t, retry.ID)
+	assert.Equal(t, "value", retry.UserProperties["key"])
+	assert.Equal(t, int32(1), retry.UserProperties[RetryAttemptProperty])
+	assert.Equal(t, now.Add(time.Second), scheduler.at[0])
+
+	assert.NotNil(t, rr.handle(context.Background(), retry, failing))
+	if !assert.Len(t, scheduler.scheduled, 2) {
+		return
+	}
+	assert.Equal(t, int32(2), scheduler.scheduled[1].UserProperties[RetryAttemptProperty])
+	assert.Equal(t, now.Add(2*time.Second), scheduler.at[1])
+
+	// the third attempt is the last, so the message is dead-lettered rather than scheduled again
+	assert.NotNil(t, rr.handle(context.Background(), scheduler.scheduled[1], failing))
+	assert.Len(t, scheduler.scheduled, 2)
+}
+
+func TestRetryPolicyReceiver_Delay(t *testing.T) {
+	rr, err := NewRetryPolicyReceiver(new(replayReceiver), new(recordingScheduler), RetryPolicyWithBackoff(time.Second, 5*time.Second))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, time.Second, rr.delay(1))
+	assert.Equal(t, 2*time.Second, rr.delay(2))
+	assert.Equal(t, 4*time.Second, rr.delay(3))
+	assert.Equal(t, 5*time.Second, rr.delay(4))
+	assert.Equal(t, 5*time.Second, rr.delay(40))
+}
+
+func TestNewRetryPolicyReceiver_Validation(t *testing.T) {
+	_, err := NewRetryPolicyReceiver(nil, new(recordingScheduler))
+	assert.Error(t, err)
+	_, err = NewRetryPolicyReceiver(new(replayReceiver), new(recordingScheduler), RetryPolicyWithMaxAttempts(0))
+	assert.Error(t, err)
+	_, err = NewRetryPolicyReceiver(new(replayReceiver), new(recordingScheduler), RetryPolicyWithBackoff(time.Minute, time.Second))
+	assert.Error(t, err)
+}
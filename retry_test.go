@@ -0,0 +1,157 @@
+package servicebus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+)
+
+// newRetryingEntityManager creates an entityManager for the server which retries under the namespace's management
+// RetryPolicy
+func newRetryingEntityManager(ns *Namespace, server *httptest.Server) *entityManager {
+	em := newEntityManager(server.URL+"/", staticTokenProvider("token"))
+	em.namespace = ns
+	em.EntityManager.Retry = ns.retryManagement
+	return em
+}
+
+func TestNamespaceWithRetryPolicies(t *testing.T) {
+	ns, err := NewNamespace()
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultManagementRetryPolicy, ns.managementRetryPolicy())
+		assert.Equal(t, DefaultDataPlaneRetryPolicy, ns.dataPlaneRetryPolicy())
+	}
+
+	management := RetryPolicy{MaxAttempts: 2, MinDelay: time.Second, MaxDelay: time.Minute}
+	dataPlane := RetryPolicy{MaxAttempts: 20, MinDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	ns, err = NewNamespace(NamespaceWithManagementRetryPolicy(management), NamespaceWithDataPlaneRetryPolicy(dataPlane))
+	if assert.NoError(t, err) {
+		assert.Equal(t, management, ns.managementRetryPolicy())
+		assert.Equal(t, dataPlane, ns.dataPlaneRetryPolicy())
+	}
+
+	for _, policy := range []RetryPolicy{
+		{},
+		{MaxAttempts: 1, MinDelay: -time.Second},
+		{MaxAttempts: 1, Jitter: -time.Second},
+		{MaxAttempts: 1, MinDelay: time.Minute, MaxDelay: time.Second},
+	} {
+		_, err = NewNamespace(NamespaceWithManagementRetryPolicy(policy))
+		assert.Error(t, err, "%+v", policy)
+		_, err = NewNamespace(NamespaceWithDataPlaneRetryPolicy(policy))
+		assert.Error(t, err, "%+v", policy)
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, MinDelay: time.Second, MaxDelay: 3 * time.Second}
+	assert.Equal(t, time.Second, policy.delay(1, nil))
+	assert.Equal(t, 2*time.Second, policy.delay(2, nil))
+	assert.Equal(t, 3*time.Second, policy.delay(3, nil))
+	assert.Equal(t, 7*time.Second, policy.delay(1, ErrServerBusy{retryAfter: 7 * time.Second}))
+
+	policy.Jitter = 100 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		delay := policy.delay(1, nil)
+		assert.True(t, delay >= 900*time.Millisecond && delay < 1100*time.Millisecond, delay.String())
+	}
+}
+
+func TestNamespace_RetryWithPolicyStopsAfterMaxAttempts(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithClock(newFakeClock(time.Now())))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	attempts := 0
+	_, err = ns.retryWithPolicy(context.Background(), RetryPolicy{MaxAttempts: 4}, func() (interface{}, error) {
+		attempts++
+		return nil, common.Retryable("try again")
+	})
+	assert.Equal(t, common.Retryable("try again"), err)
+	assert.Equal(t, 4, attempts)
+}
+
+func TestEntityManager_RetriesThrottledRequests(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		attempt := len(bodies)
+		mu.Unlock()
+
+		switch attempt {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	ns, err := NewNamespace(
+		NamespaceWithClock(newFakeClock(time.Now())),
+		NamespaceWithManagementRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	res, err := newRetryingEntityManager(ns, server).Put(context.Background(), "queue", []byte("<entry/>"), atom.IfMatch("*"))
+	if assert.NoError(t, err) {
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+	assert.Equal(t, []string{"<entry/>", "<entry/>", "<entry/>"}, bodies)
+}
+
+func TestEntityManager_StopsRetryingAfterMaxAttempts(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ns, err := NewNamespace(
+		NamespaceWithClock(newFakeClock(time.Now())),
+		NamespaceWithManagementRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	em := newRetryingEntityManager(ns, server)
+
+	res, err := em.Get(context.Background(), "busy")
+	if res != nil {
+		defer res.Body.Close()
+	}
+	assert.IsType(t, &atom.ServerBusyError{}, err)
+	assert.Equal(t, 2, requests)
+
+	requests = 0
+	res, err = em.Get(context.Background(), "missing")
+	if assert.NoError(t, err) {
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	}
+	assert.Equal(t, 1, requests)
+}
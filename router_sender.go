@@ -0,0 +1,146 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// RouterSender sends each message to the Queue or Topic named by its To field, so a single integration point can
+	// route messages to destinations which are only known as they are sent. Sender links are cached by destination in
+	// the same way as for Namespace.Send, but separately from it, so closing the RouterSender closes only its own links.
+	RouterSender struct {
+		namespace          *Namespace
+		defaultDestination string
+		senders            *senderCache
+	}
+
+	// RouterSenderOption provides a way to customize a RouterSender
+	RouterSenderOption func(*RouterSender) error
+)
+
+// RouterSenderWithDefaultDestination configures the RouterSender to send messages without a To field to the Queue or
+// Topic at the entity path, rather than failing to send them
+func RouterSenderWithDefaultDestination(entityPath string) RouterSenderOption {
+	return func(rs *RouterSender) error {
+		if entityPath == "" {
+			return errors.New("default destination must not be empty")
+		}
+		rs.defaultDestination = entityPath
+		return nil
+	}
+}
+
+// RouterSenderWithCacheSize configures the maximum number of sender links the RouterSender keeps open. Once the cache
+// is full, the least recently used link is closed.
+func RouterSenderWithCacheSize(size int) RouterSenderOption {
+	return func(rs *RouterSender) error {
+		if size < 1 {
+			return errors.New("sender cache size must be at least 1")
+		}
+		rs.senders.size = size
+		return nil
+	}
+}
+
+// NewRouterSender creates a RouterSender for the namespace
+func (ns *Namespace) NewRouterSender(opts ...RouterSenderOption) (*RouterSender, error) {
+	rs := &RouterSender{
+		namespace: ns,
+		senders:   newSenderCache(ns.getClock),
+	}
+	rs.senders.idleTimeout = ns.senders.idleTimeout
+
+	for _, opt := range opts {
+		if err := opt(rs); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// Send sends the message to the Queue or Topic named by its To field, which is either an entity path, such as
+// "myqueue", or the URI of an entity in the namespace, such as "sb://mynamespace.servicebus.windows.net/myqueue"
+func (rs *RouterSender) Send(ctx context.Context, msg *Message, opts ...SendOption) error {
+	span, ctx := rs.namespace.startSpanFromContext(ctx, "sb.RouterSender.Send")
+	defer span.End()
+
+	entityPath, err := rs.destination(msg)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	s, release, err := rs.senders.get(ctx, entityPath, func(ctx context.Context) (*sender, error) {
+		return rs.namespace.newSender(ctx, entityPath)
+	})
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	defer release()
+
+	return s.Send(ctx, msg, opts...)
+}
+
+// Close closes the sender links cached by the RouterSender
+func (rs *RouterSender) Close(ctx context.Context) error {
+	span, ctx := rs.namespace.startSpanFromContext(ctx, "sb.RouterSender.Close")
+	defer span.End()
+
+	return rs.senders.close(ctx)
+}
+
+// destination returns the path of the entity the message is routed to
+func (rs *RouterSender) destination(msg *Message) (string, error) {
+	if msg.To == "" {
+		if rs.defaultDestination == "" {
+			return "", errors.New("message has no To field and the router sender has no default destination")
+		}
+		return rs.defaultDestination, nil
+	}
+
+	if !strings.Contains(msg.To, "://") {
+		return msg.To, nil
+	}
+
+	u, err := url.Parse(msg.To)
+	if err != nil {
+		return "", fmt.Errorf("message To field %q is not a valid URI: %v", msg.To, err)
+	}
+	if !strings.EqualFold(u.Host, rs.namespace.getHostName()) {
+		return "", fmt.Errorf("message To field %q is not an entity of namespace %q", msg.To, rs.namespace.getHostName())
+	}
+	entityPath := strings.Trim(u.Path, "/")
+	if entityPath == "" {
+		return "", fmt.Errorf("message To field %q does not name an entity", msg.To)
+	}
+	return entityPath, nil
+}
@@ -0,0 +1,67 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterSender_Destination(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	ns.Name = "mynamespace"
+
+	rs, err := ns.NewRouterSender(RouterSenderWithDefaultDestination("fallback"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := map[string]string{
+		"":        "fallback",
+		"orders":  "orders",
+		"mytopic": "mytopic",
+		"sb://mynamespace.servicebus.windows.net/refunds":      "refunds",
+		"amqps://MyNamespace.servicebus.windows.net/invoices/": "invoices",
+	}
+	for to, expected := range cases {
+		msg := NewMessageFromString("payload")
+		msg.To = to
+		entityPath, err := rs.destination(msg)
+		if assert.NoError(t, err, to) {
+			assert.Equal(t, expected, entityPath, to)
+		}
+	}
+
+	for _, to := range []string{
+		"sb://othernamespace.servicebus.windows.net/orders",
+		"sb://mynamespace.servicebus.windows.net/",
+		"sb://mynamespace.servicebus.windows.net/%zz",
+	} {
+		msg := NewMessageFromString("payload")
+		msg.To = to
+		_, err := rs.destination(msg)
+		assert.Error(t, err, to)
+	}
+}
+
+func TestRouterSender_SendWithoutDestination(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rs, err := ns.NewRouterSender()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Error(t, rs.Send(context.Background(), NewMessageFromString("nowhere")))
+	assert.NoError(t, rs.Close(context.Background()))
+
+	_, err = ns.NewRouterSender(RouterSenderWithDefaultDestination(""))
+	assert.Error(t, err)
+	_, err = ns.NewRouterSender(RouterSenderWithCacheSize(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,336 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const (
+	// DefaultRuleName is the name of the rule Service Bus adds to every new subscription, which accepts all messages
+	DefaultRuleName = "$Default"
+
+	xmlSchemaInstance       = "http://www.w3.org/2001/XMLSchema-instance"
+	sqlCompatibilityLevel   = 20
+	sqlFilterType           = "SqlFilter"
+	trueFilterType          = "TrueFilter"
+	falseFilterType         = "FalseFilter"
+	correlationFilterType   = "CorrelationFilter"
+	sqlRuleActionType       = "SqlRuleAction"
+	emptyRuleActionType     = "EmptyRuleAction"
+	trueFilterSQLExpression = "1=1"
+)
+
+type (
+	// RuleDescription is the content of Subscription Rule management requests
+	RuleDescription struct {
+		XMLName xml.Name `xml:"RuleDescription"`
+		BaseEntityDescription
+		Filter FilterDescription  `xml:"Filter"`
+		Action *ActionDescription `xml:"Action,omitempty"`
+	}
+
+	// DefaultRuleDescription is the rule a subscription is created with in place of the $Default rule which accepts
+	// all messages
+	DefaultRuleDescription struct {
+		Filter FilterDescription  `xml:"Filter"`
+		Action *ActionDescription `xml:"Action,omitempty"`
+		Name   string             `xml:"Name,omitempty"`
+	}
+
+	// FilterDescription describes a filter which selects the messages of the topic a subscription receives
+	FilterDescription struct {
+		XMLName xml.Name `xml:"Filter"`
+		CorrelationFilter
+		Type               string  `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+		SQLExpression      *string `xml:"SqlExpression,omitempty"`
+		CompatibilityLevel int     `xml:"CompatibilityLevel,omitempty"`
+	}
+
+	// ActionDescription describes an action applied to the messages which match a filter
+	ActionDescription struct {
+		Type               string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+		SQLExpression      string `xml:"SqlExpression,omitempty"`
+		CompatibilityLevel int    `xml:"CompatibilityLevel,omitempty"`
+	}
+
+	// RuleEntity is the Azure Service Bus description of a Subscription Rule for management activities
+	RuleEntity struct {
+		*RuleDescription
+		Name string
+	}
+
+	// FilterDescriber can transform itself into a FilterDescription
+	FilterDescriber interface {
+		ToFilterDescription() FilterDescription
+	}
+
+	// ActionDescriber can transform itself into an ActionDescription
+	ActionDescriber interface {
+		ToActionDescription() ActionDescription
+	}
+
+	// SQLFilter selects the messages for which a SQL-92 like expression over the message properties is true, such as
+	// "priority = 'high'"
+	SQLFilter struct {
+		Expression string
+	}
+
+	// TrueFilter selects all messages
+	TrueFilter struct{}
+
+	// FalseFilter selects no messages
+	FalseFilter struct{}
+
+	// CorrelationFilter selects the messages whose system properties equal all of the set fields and whose user
+	// properties include all of the Properties. Correlation filters are evaluated far more efficiently by the service
+	// than SQL filters.
+	CorrelationFilter struct {
+		CorrelationID    *string               `xml:"CorrelationId,omitempty"`
+		MessageID        *string               `xml:"MessageId,omitempty"`
+		To               *string               `xml:"To,omitempty"`
+		ReplyTo          *string               `xml:"ReplyTo,omitempty"`
+		Label            *string               `xml:"Label,omitempty"`
+		SessionID        *string               `xml:"SessionId,omitempty"`
+		ReplyToSessionID *string               `xml:"ReplyToSessionId,omitempty"`
+		ContentType      *string               `xml:"ContentType,omitempty"`
+		Properties       CorrelationProperties `xml:"Properties,omitempty"`
+	}
+
+	// SQLAction modifies the properties of the messages which match a filter with a SQL-92 like statement, such as
+	// "SET priority = 'high'"
+	SQLAction struct {
+		Expression string
+	}
+
+	ruleFeed struct {
+		*atom.Feed
+		Entries []ruleEntry `xml:"entry"`
+	}
+
+	ruleEntry struct {
+		*atom.Entry
+		Content *ruleContent `xml:"content"`
+	}
+
+	ruleContent struct {
+		XMLName         xml.Name        `xml:"content"`
+		Type            string          `xml:"type,attr"`
+		RuleDescription RuleDescription `xml:"RuleDescription"`
+	}
+)
+
+// ToFilterDescription builds the FilterDescription of the SQLFilter
+func (sf SQLFilter) ToFilterDescription() FilterDescription {
+	return FilterDescription{
+		Type:               sqlFilterType,
+		SQLExpression:      to.StringPtr(sf.Expression),
+		CompatibilityLevel: sqlCompatibilityLevel,
+	}
+}
+
+// ToFilterDescription builds the FilterDescription of the TrueFilter
+func (TrueFilter) ToFilterDescription() FilterDescription {
+	return FilterDescription{
+		Type:               trueFilterType,
+		SQLExpression:      to.StringPtr(trueFilterSQLExpression),
+		CompatibilityLevel: sqlCompatibilityLevel,
+	}
+}
+
+// ToFilterDescription builds the FilterDescription of the FalseFilter
+func (FalseFilter) ToFilterDescription() FilterDescription {
+	return FilterDescription{
+		Type:               falseFilterType,
+		SQLExpression:      to.StringPtr("1=0"),
+		CompatibilityLevel: sqlCompatibilityLevel,
+	}
+}
+
+// ToFilterDescription builds the FilterDescription of the CorrelationFilter
+func (cf CorrelationFilter) ToFilterDescription() FilterDescription {
+	return FilterDescription{
+		Type:              correlationFilterType,
+		CorrelationFilter: cf,
+	}
+}
+
+// ToActionDescription builds the ActionDescription of the SQLAction
+func (sa SQLAction) ToActionDescription() ActionDescription {
+	return ActionDescription{
+		Type:               sqlRuleActionType,
+		SQLExpression:      sa.Expression,
+		CompatibilityLevel: sqlCompatibilityLevel,
+	}
+}
+
+// PutRule creates a rule on the subscription which selects messages with the filter and, if action is not nil,
+// modifies them with the action
+func (sm *SubscriptionManager) PutRule(ctx context.Context, subscriptionName, ruleName string, filter FilterDescriber, action ActionDescriber) (*RuleEntity, error) {
+	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.PutRule")
+	defer span.End()
+
+	return sm.putRule(ctx, subscriptionName, ruleName, filter, action)
+}
+
+// UpdateRule replaces the filter and action of an existing rule of the subscription in place
+func (sm *SubscriptionManager) UpdateRule(ctx context.Context, subscriptionName, ruleName string, filter FilterDescriber, action ActionDescriber) (*RuleEntity, error) {
+	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.UpdateRule")
+	defer span.End()
+
+	return sm.putRule(ctx, subscriptionName, ruleName, filter, action, atom.IfMatch("*"))
+}
+
+// ReplaceDefaultRule replaces the filter and action of the $Default rule of the subscription, which accepts all
+// messages unless it has been replaced before. The rule is updated in place in a single request, so the subscription
+// neither misses messages the new filter selects nor receives messages it rejects while the rule is being replaced.
+// If the subscription has no $Default rule, it is created.
+func (sm *SubscriptionManager) ReplaceDefaultRule(ctx context.Context, subscriptionName string, filter FilterDescriber, action ActionDescriber) (*RuleEntity, error) {
+	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.ReplaceDefaultRule")
+	defer span.End()
+
+	re, err := sm.putRule(ctx, subscriptionName, DefaultRuleName, filter, action, atom.IfMatch("*"))
+	if mgmtErr, ok := err.(*atom.ManagementError); ok && mgmtErr.Code == http.StatusNotFound {
+		return sm.putRule(ctx, subscriptionName, DefaultRuleName, filter, action)
+	}
+	return re, err
+}
+
+// DeleteRule deletes the named rule of the subscription
+func (sm *SubscriptionManager) DeleteRule(ctx context.Context, subscriptionName, ruleName string) error {
+	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.DeleteRule")
+	defer span.End()
+
+	res, err := sm.entityManager.Delete(ctx, sm.getRuleResourceURI(subscriptionName, ruleName))
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return err
+	}
+	return checkDeleteResponse(res)
+}
+
+// ListRules fetches all of the rules of the subscription
+func (sm *SubscriptionManager) ListRules(ctx context.Context, subscriptionName string) ([]*RuleEntity, error) {
+	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.ListRules")
+	defer span.End()
+
+	res, err := sm.entityManager.Get(ctx, sm.getResourceURI(subscriptionName)+"/rules")
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed ruleFeed
+	err = xml.Unmarshal(b, &feed)
+	if err != nil {
+		return nil, formatManagementError(res, b)
+	}
+
+	rules := make([]*RuleEntity, len(feed.Entries))
+	for idx, entry := range feed.Entries {
+		rules[idx] = ruleEntryToEntity(&entry)
+	}
+	return rules, nil
+}
+
+func (sm *SubscriptionManager) putRule(ctx context.Context, subscriptionName, ruleName string, filter FilterDescriber, action ActionDescriber, opts ...atom.RequestOption) (*RuleEntity, error) {
+	reqBytes, err := xml.Marshal(newRuleEntry(filter, action))
+	if err != nil {
+		return nil, err
+	}
+
+	reqBytes = xmlDoc(reqBytes)
+	res, err := sm.entityManager.Put(ctx, sm.getRuleResourceURI(subscriptionName, ruleName), reqBytes, opts...)
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry ruleEntry
+	err = xml.Unmarshal(b, &entry)
+	if err != nil {
+		return nil, formatManagementError(res, b)
+	}
+	return ruleEntryToEntity(&entry), nil
+}
+
+func newRuleEntry(filter FilterDescriber, action ActionDescriber) *ruleEntry {
+	rd := RuleDescription{
+		BaseEntityDescription: BaseEntityDescription{
+			InstanceMetadataSchema: to.StringPtr(xmlSchemaInstance),
+			ServiceBusSchema:       to.StringPtr(serviceBusSchema),
+		},
+		Filter: filter.ToFilterDescription(),
+		Action: &ActionDescription{Type: emptyRuleActionType},
+	}
+	if action != nil {
+		ad := action.ToActionDescription()
+		rd.Action = &ad
+	}
+
+	return &ruleEntry{
+		Entry: &atom.Entry{
+			AtomSchema: atomSchema,
+		},
+		Content: &ruleContent{
+			Type:            applicationXML,
+			RuleDescription: rd,
+		},
+	}
+}
+
+func ruleEntryToEntity(entry *ruleEntry) *RuleEntity {
+	return &RuleEntity{
+		RuleDescription: &entry.Content.RuleDescription,
+		Name:            entry.Title,
+	}
+}
+
+func (sm *SubscriptionManager) getRuleResourceURI(subscriptionName, ruleName string) string {
+	return sm.getResourceURI(subscriptionName) + "/rules/" + ruleName
+}
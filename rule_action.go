@@ -0,0 +1,151 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// SQLActionStatement is a single SET or REMOVE statement of a SQLAction
+	SQLActionStatement struct {
+		statement string
+		err       error
+	}
+)
+
+// sqlPropertyName matches property names which can be used in a SQL expression without being delimited, optionally
+// scoped to the system or user properties, such as "priority", "user.priority" or "sys.Label"
+var sqlPropertyName = regexp.MustCompile(`^((sys|user)\.)?[A-Za-z_][A-Za-z0-9_]*$`)
+
+// NewSQLAction builds a SQLAction from SET and REMOVE statements, such as
+//
+//	NewSQLAction(SQLActionSet("priority", "high"), SQLActionRemove("internal"))
+//
+// which results in "SET priority = 'high'; REMOVE internal". Values and property names are quoted as needed.
+func NewSQLAction(statements ...SQLActionStatement) (SQLAction, error) {
+	if len(statements) == 0 {
+		return SQLAction{}, errors.New("a SQL action needs at least one statement")
+	}
+
+	parts := make([]string, len(statements))
+	for i, s := range statements {
+		if s.err != nil {
+			return SQLAction{}, s.err
+		}
+		parts[i] = s.statement
+	}
+	return SQLAction{Expression: strings.Join(parts, "; ")}, nil
+}
+
+// SQLActionSet sets the property to the value, adding the property if the message does not have it. The value may be
+// nil, a string, a bool or any integer or floating point number.
+func SQLActionSet(property string, value interface{}) SQLActionStatement {
+	name, err := sqlProperty(property)
+	if err != nil {
+		return SQLActionStatement{err: err}
+	}
+
+	literal, err := sqlLiteral(value)
+	if err != nil {
+		return SQLActionStatement{err: fmt.Errorf("cannot set %q: %v", property, err)}
+	}
+	return SQLActionStatement{statement: fmt.Sprintf("SET %s = %s", name, literal)}
+}
+
+// SQLActionRemove removes the property from the message
+func SQLActionRemove(property string) SQLActionStatement {
+	name, err := sqlProperty(property)
+	if err != nil {
+		return SQLActionStatement{err: err}
+	}
+	return SQLActionStatement{statement: "REMOVE " + name}
+}
+
+// sqlProperty delimits the property name with brackets unless it is a plain, optionally scoped, identifier
+func sqlProperty(property string) (string, error) {
+	switch {
+	case property == "":
+		return "", errors.New("property name must not be empty")
+	case sqlPropertyName.MatchString(property):
+		return property, nil
+	case strings.ContainsAny(property, "[]"):
+		return "", fmt.Errorf("property name %q must not contain brackets", property)
+	default:
+		return "[" + property + "]", nil
+	}
+}
+
+// sqlLiteral formats the value as a SQL constant
+func sqlLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return sqlFloat(float64(v)), nil
+	case float64:
+		return sqlFloat(v), nil
+	default:
+		return "", fmt.Errorf("values of type %T are not supported", value)
+	}
+}
+
+// sqlFloat formats the number so the service reads it as a floating point rather than an integer constant
+func sqlFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleEntry_SQLFilterWithAction(t *testing.T) {
+	b, err := xml.Marshal(newRuleEntry(SQLFilter{Expression: "priority = 'high'"}, SQLAction{Expression: "SET escalated = 1"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	body := string(b)
+	assert.Contains(t, body, `<SqlExpression>priority = &#39;high&#39;</SqlExpression>`)
+	assert.Contains(t, body, `<SqlExpression>SET escalated = 1</SqlExpression>`)
+	assert.Contains(t, body, `type="SqlFilter"`)
+	assert.Contains(t, body, `type="SqlRuleAction"`)
+	assert.True(t, strings.Index(body, "<Filter") < strings.Index(body, "<Action"), "the filter must precede the action")
+
+	var entry ruleEntry
+	if assert.NoError(t, xml.Unmarshal(b, &entry)) {
+		rd := entry.Content.RuleDescription
+		assert.Equal(t, "SqlFilter", rd.Filter.Type)
+		assert.Equal(t, "priority = 'high'", *rd.Filter.SQLExpression)
+		assert.Equal(t, "SqlRuleAction", rd.Action.Type)
+		assert.Equal(t, "SET escalated = 1", rd.Action.SQLExpression)
+	}
+}
+
+func TestRuleEntry_CorrelationFilterWithoutAction(t *testing.T) {
+	filter := CorrelationFilter{Label: to.StringPtr("order"), CorrelationID: to.StringPtr("abc")}
+	b, err := xml.Marshal(newRuleEntry(filter, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	body := string(b)
+	assert.Contains(t, body, `type="CorrelationFilter"`)
+	assert.Contains(t, body, `<CorrelationId>abc</CorrelationId><Label>order</Label>`)
+	assert.NotContains(t, body, "SqlExpression")
+	assert.Contains(t, body, `type="EmptyRuleAction"`)
+}
+
+func TestTrueAndFalseFilters(t *testing.T) {
+	assert.Equal(t, "1=1", *TrueFilter{}.ToFilterDescription().SQLExpression)
+	assert.Equal(t, "TrueFilter", TrueFilter{}.ToFilterDescription().Type)
+	assert.Equal(t, "1=0", *FalseFilter{}.ToFilterDescription().SQLExpression)
+	assert.Equal(t, "FalseFilter", FalseFilter{}.ToFilterDescription().Type)
+}
+
+func TestNewSQLAction(t *testing.T) {
+	action, err := NewSQLAction(
+		SQLActionSet("priority", "it's high"),
+		SQLActionSet("user.escalated", true),
+		SQLActionSet("retries", 3),
+		SQLActionSet("weight", 2.0),
+		SQLActionSet("order id", nil),
+		SQLActionRemove("sys.Label"),
+	)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "SET priority = 'it''s high'; SET user.escalated = TRUE; SET retries = 3; SET weight = 2.0; SET [order id] = NULL; REMOVE sys.Label", action.Expression)
+		assert.Equal(t, "SqlRuleAction", action.ToActionDescription().Type)
+	}
+}
+
+func TestNewSQLAction_RejectsInvalidStatements(t *testing.T) {
+	_, err := NewSQLAction()
+	assert.Error(t, err)
+
+	_, err = NewSQLAction(SQLActionSet("", 1))
+	assert.Error(t, err)
+
+	_, err = NewSQLAction(SQLActionRemove("bad]name"))
+	assert.Error(t, err)
+
+	_, err = NewSQLAction(SQLActionSet("created", struct{}{}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/Azure/azure-amqp-common-go/sas"
+)
+
+const (
+	sasTokenPrefix = "SharedAccessSignature "
+
+	// sasRefreshMargin is how long before a shared access signature expires that a replacement is requested
+	sasRefreshMargin = 5 * time.Minute
+)
+
+type (
+	// sasTokenProvider provides pre-minted shared access signatures for claims based security, asking for a
+	// replacement shortly before the current signature expires
+	sasTokenProvider struct {
+		mu      sync.Mutex
+		token   string
+		expiry  time.Time
+		refresh func() (string, time.Time)
+		clock   func() Clock
+	}
+)
+
+// NewSASToken generates a shared access signature for the resource URI, signed with the named shared access key and
+// valid until expiry. The result may be handed to a client which has no access to the key and passed to
+// NamespaceWithSASToken.
+func NewSASToken(keyName, key, resourceURI string, expiry time.Time) string {
+	return sas.NewSigner(keyName, key).SignWithExpiry(resourceURI, strconv.FormatInt(expiry.Unix(), 10))
+}
+
+// NamespaceWithSASToken configures a namespace to authorize its connections with a pre-minted shared access
+// signature rather than a shared access key. The expiry of the token is read from its se field. If refresh is not nil
+// it is called for a replacement token shortly before the current one expires; without it the namespace stops
+// authorizing new links once the token has expired.
+func NamespaceWithSASToken(token string, refresh func() (string, time.Time)) NamespaceOption {
+	return func(ns *Namespace) error {
+		expiry, err := sasTokenExpiry(token)
+		if err != nil {
+			return err
+		}
+		ns.TokenProvider = &sasTokenProvider{
+			token:   token,
+			expiry:  expiry,
+			refresh: refresh,
+			clock:   ns.getClock,
+		}
+		return nil
+	}
+}
+
+// GetToken returns the current shared access signature, refreshing it first if it is about to expire. The
+// signature is presented for every audience; the broker rejects it for audiences outside of its sr scope.
+func (p *sasTokenProvider) GetToken(audience string) (*auth.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock().Now()
+	if p.refresh != nil && !now.Add(sasRefreshMargin).Before(p.expiry) {
+		token, expiry := p.refresh()
+		if token == "" {
+			if !now.Before(p.expiry) {
+				return nil, errors.New("shared access signature has expired and no replacement was provided")
+			}
+		} else {
+			if !strings.HasPrefix(token, sasTokenPrefix) {
+				return nil, errors.New("refreshed token is not a shared access signature")
+			}
+			p.token, p.expiry = token, expiry
+		}
+	}
+
+	if !now.Before(p.expiry) {
+		return nil, fmt.Errorf("shared access signature expired at %s", p.expiry.Format(time.RFC3339))
+	}
+	return auth.NewToken(auth.CBSTokenTypeSAS, p.token, strconv.FormatInt(p.expiry.Unix(), 10)), nil
+}
+
+// sasTokenExpiry parses the expiry from the se field of a shared access signature
+func sasTokenExpiry(token string) (time.Time, error) {
+	if !strings.HasPrefix(token, sasTokenPrefix) {
+		return time.Time{}, errors.New("token is not a shared access signature")
+	}
+
+	fields, err := url.ParseQuery(strings.TrimPrefix(token, sasTokenPrefix))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	se := fields.Get("se")
+	if se == "" {
+		return time.Time{}, errors.New("shared access signature has no se expiry field")
+	}
+	seconds, err := strconv.ParseInt(se, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("shared access signature has an invalid se expiry field %q", se)
+	}
+	return time.Unix(seconds, 0), nil
+}
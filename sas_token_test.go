@@ -0,0 +1,113 @@
+package servicebus
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSASToken(t *testing.T) {
+	expiry := time.Date(2018, 10, 1, 13, 0, 0, 0, time.UTC)
+	token := NewSASToken("send", "c2VjcmV0", "amqps://foo.servicebus.windows.net/queue", expiry)
+	assert.Contains(t, token, "skn=send")
+
+	parsed, err := sasTokenExpiry(token)
+	if assert.NoError(t, err) {
+		assert.True(t, expiry.Equal(parsed))
+	}
+}
+
+func TestNamespaceWithSASToken_RejectsMalformedTokens(t *testing.T) {
+	for _, token := range []string{
+		"",
+		"Bearer abc",
+		"SharedAccessSignature sr=foo&sig=bar&skn=send",
+		"SharedAccessSignature sr=foo&sig=bar&se=soon&skn=send",
+	} {
+		_, err := NewNamespace(NamespaceWithSASToken(token, nil))
+		assert.Error(t, err, token)
+	}
+}
+
+func TestNamespaceWithSASToken_ReturnsTokenUntilExpiry(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	expiry := now.Add(time.Hour)
+	token := NewSASToken("send", "c2VjcmV0", "amqps://foo.servicebus.windows.net/", expiry)
+
+	ns, err := NewNamespace(NamespaceWithSASToken(token, nil), NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	got, err := ns.TokenProvider.GetToken("amqps://foo.servicebus.windows.net/queue")
+	if assert.NoError(t, err) {
+		assert.Equal(t, auth.CBSTokenTypeSAS, got.TokenType)
+		assert.Equal(t, token, got.Token)
+		assert.Equal(t, strconv.FormatInt(expiry.Unix(), 10), got.Expiry)
+	}
+
+	clock.Advance(time.Hour)
+	_, err = ns.TokenProvider.GetToken("amqps://foo.servicebus.windows.net/queue")
+	assert.Error(t, err)
+}
+
+func TestNamespaceWithSASToken_RefreshesBeforeExpiry(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	first := NewSASToken("send", "c2VjcmV0", "amqps://foo.servicebus.windows.net/", now.Add(time.Hour))
+	second := NewSASToken("send", "c2VjcmV0", "amqps://foo.servicebus.windows.net/", now.Add(2*time.Hour))
+
+	refreshes := 0
+	refresh := func() (string, time.Time) {
+		refreshes++
+		return second, now.Add(2 * time.Hour)
+	}
+	ns, err := NewNamespace(NamespaceWithSASToken(first, refresh), NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	got, err := ns.TokenProvider.GetToken("audience")
+	if assert.NoError(t, err) {
+		assert.Equal(t, first, got.Token)
+	}
+	assert.Equal(t, 0, refreshes)
+
+	clock.Advance(time.Hour - sasRefreshMargin)
+	got, err = ns.TokenProvider.GetToken("audience")
+	if assert.NoError(t, err) {
+		assert.Equal(t, second, got.Token)
+		assert.Equal(t, strconv.FormatInt(now.Add(2*time.Hour).Unix(), 10), got.Expiry)
+	}
+	assert.Equal(t, 1, refreshes)
+
+	_, err = ns.TokenProvider.GetToken("audience")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, refreshes)
+}
+
+func TestNamespaceWithSASToken_KeepsCurrentTokenWhenRefreshFails(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	token := NewSASToken("send", "c2VjcmV0", "amqps://foo.servicebus.windows.net/", now.Add(time.Minute))
+
+	ns, err := NewNamespace(NamespaceWithSASToken(token, func() (string, time.Time) {
+		return "", time.Time{}
+	}), NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	got, err := ns.TokenProvider.GetToken("audience")
+	if assert.NoError(t, err) {
+		assert.Equal(t, token, got.Token)
+	}
+
+	clock.Advance(time.Minute)
+	_, err = ns.TokenProvider.GetToken("audience")
+	assert.Error(t, err)
+}
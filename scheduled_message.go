@@ -0,0 +1,85 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type (
+	// ScheduledMessage is a message the broker holds back until its scheduled enqueue time. Until then it can be
+	// canceled with Cancel.
+	ScheduledMessage struct {
+		SequenceNumber int64
+		EnqueueTime    time.Time
+		cancel         func(ctx context.Context, seq ...int64) error
+	}
+)
+
+// SendScheduled sends a message which was scheduled with Message.ScheduleAt through the broker's schedule-message
+// operation, and returns a handle which can cancel the message before it is enqueued. Unlike Send, which only annotates
+// the message with its enqueue time, the handle carries the sequence number the broker assigned to the message.
+func (q *Queue) SendScheduled(ctx context.Context, msg *Message) (*ScheduledMessage, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.SendScheduled")
+	defer span.End()
+
+	enqueueTime, err := scheduledEnqueueTime(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs, err := q.ScheduleAt(ctx, enqueueTime, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) != 1 {
+		return nil, ErrMissingField("sequence-numbers")
+	}
+
+	return &ScheduledMessage{
+		SequenceNumber: seqs[0],
+		EnqueueTime:    enqueueTime,
+		cancel:         q.CancelScheduled,
+	}, nil
+}
+
+// Cancel removes the message from the broker before it is enqueued. Canceling a message which has already been
+// enqueued fails.
+func (sm *ScheduledMessage) Cancel(ctx context.Context) error {
+	if sm.cancel == nil {
+		return errors.New("scheduled message was not sent through SendScheduled and cannot be canceled")
+	}
+	return sm.cancel(ctx, sm.SequenceNumber)
+}
+
+func scheduledEnqueueTime(msg *Message) (time.Time, error) {
+	if msg == nil {
+		return time.Time{}, errors.New("message must not be nil")
+	}
+	if msg.SystemProperties == nil || msg.SystemProperties.ScheduledEnqueueTime == nil {
+		return time.Time{}, errors.New("message has no scheduled enqueue time; call ScheduleAt before sending it")
+	}
+	return *msg.SystemProperties.ScheduledEnqueueTime, nil
+}
@@ -0,0 +1,65 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_SendScheduledRequiresScheduledMessage(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = q.SendScheduled(context.Background(), nil)
+	assert.Error(t, err)
+
+	_, err = q.SendScheduled(context.Background(), NewMessageFromString("unscheduled"))
+	assert.Error(t, err)
+}
+
+func TestScheduledMessage_Cancel(t *testing.T) {
+	var canceled []int64
+	sm := &ScheduledMessage{
+		SequenceNumber: 42,
+		EnqueueTime:    time.Now().Add(time.Hour),
+		cancel: func(_ context.Context, seq ...int64) error {
+			canceled = append(canceled, seq...)
+			return nil
+		},
+	}
+
+	assert.NoError(t, sm.Cancel(context.Background()))
+	assert.Equal(t, []int64{42}, canceled)
+
+	assert.Error(t, new(ScheduledMessage).Cancel(context.Background()))
+}
@@ -0,0 +1,323 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// SchemaIDProperty is the user property which carries the ID of the schema a message payload was encoded with
+	SchemaIDProperty = "schema-id"
+
+	// SchemaFormatAvro identifies Apache Avro schemas. This package does not include an Avro codec, so that it does not
+	// depend on an Avro library; supply a SchemaCodec for Avro to encode and validate Avro payloads.
+	SchemaFormatAvro SchemaFormat = "Avro"
+	// SchemaFormatJSON identifies JSON Schema schemas
+	SchemaFormatJSON SchemaFormat = "Json"
+)
+
+type (
+	// SchemaFormat is the serialization format described by a schema
+	SchemaFormat string
+
+	// Schema is a schema definition stored in a schema registry
+	Schema struct {
+		ID         string
+		Group      string
+		Name       string
+		Format     SchemaFormat
+		Definition string
+	}
+
+	// SchemaRegistry stores schemas and resolves them by ID. The schemaregistry package provides an implementation
+	// backed by Azure Schema Registry.
+	SchemaRegistry interface {
+		// GetSchemaID registers the definition under the group and name, if it is not registered yet, and returns its ID
+		GetSchemaID(ctx context.Context, group, name string, format SchemaFormat, definition string) (string, error)
+		// GetSchema fetches a schema by ID
+		GetSchema(ctx context.Context, id string) (*Schema, error)
+	}
+
+	// SchemaCodec provides the Codec for payloads described by schemas of a particular format. Implementations for
+	// formats such as Avro can be plugged in without this package depending on a specific serialization library. A
+	// Codec which also has a Validate([]byte) error method is used to validate payloads without decoding them;
+	// otherwise payloads are validated by decoding them into an empty interface.
+	SchemaCodec interface {
+		// Format is the schema format the codec understands
+		Format() SchemaFormat
+		// ForSchema returns the Codec which encodes and decodes payloads with the schema, validating them against it
+		ForSchema(schema *Schema) (Codec, error)
+	}
+
+	// SchemaEncoder builds messages whose payloads are encoded with a schema from a SchemaRegistry and decodes
+	// received messages using the schema ID they are annotated with. Schema IDs and the codecs for each schema are
+	// cached, so the registry is only consulted the first time a schema is used.
+	SchemaEncoder struct {
+		registry SchemaRegistry
+		group    string
+		codec    SchemaCodec
+		mu       sync.Mutex
+		ids      map[string]string
+		codecs   map[string]Codec
+	}
+
+	// JSONSchemaCodec is a SchemaCodec for JSON Schema. It serializes with encoding/json and validates payloads against
+	// the validation keywords of draft 7, at every level of the payload. References are resolved within the schema
+	// only, and schemas using if, then, else, dependencies, patternProperties, propertyNames, contains,
+	// additionalItems, the content keywords or arrays of item schemas are rejected rather than partially checked.
+	// Formats are not checked.
+	JSONSchemaCodec struct{}
+
+	// jsonSchemaCodec is the Codec JSONSchemaCodec provides for a schema
+	jsonSchemaCodec struct {
+		JSONCodec
+		name     string
+		compiled *jsonSchema
+	}
+
+	// payloadValidator is implemented by codecs which validate payloads without decoding them
+	payloadValidator interface {
+		Validate(data []byte) error
+	}
+)
+
+// NewSchemaEncoder creates a SchemaEncoder which registers and resolves schemas in the group of the registry
+func NewSchemaEncoder(registry SchemaRegistry, group string, codec SchemaCodec) *SchemaEncoder {
+	return &SchemaEncoder{
+		registry: registry,
+		group:    group,
+		codec:    codec,
+		ids:      make(map[string]string),
+		codecs:   make(map[string]Codec),
+	}
+}
+
+// NewMessage validates and encodes v with the named schema definition and returns a message annotated with the ID of
+// the schema, which consumers use to decode the payload
+func (se *SchemaEncoder) NewMessage(ctx context.Context, name, definition string, v interface{}) (*Message, error) {
+	id, err := se.schemaID(ctx, name, definition)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := se.codecFor(ctx, id, &Schema{
+		ID:         id,
+		Group:      se.group,
+		Name:       name,
+		Format:     se.codec.Format(),
+		Definition: definition,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := NewMessage(data)
+	msg.ContentType = codec.ContentType()
+	msg.Set(SchemaIDProperty, id)
+	return msg, nil
+}
+
+// Decode decodes the payload of the message into v using the schema the message is annotated with
+func (se *SchemaEncoder) Decode(ctx context.Context, msg *Message, v interface{}) error {
+	codec, err := se.codecOf(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(msg.Data, v)
+}
+
+// Validate checks that the message is annotated with the ID of a schema and that its payload conforms to the schema
+func (se *SchemaEncoder) Validate(ctx context.Context, msg *Message) error {
+	codec, err := se.codecOf(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if validator, ok := codec.(payloadValidator); ok {
+		return validator.Validate(msg.Data)
+	}
+	var discard interface{}
+	return codec.Decode(msg.Data, &discard)
+}
+
+// QueueWithSchemaValidation validates every message sent to the Queue with the SchemaEncoder before it is sent, so
+// messages which are not annotated with a schema ID, or whose payload does not conform to their schema, are rejected
+// rather than reaching consumers
+func QueueWithSchemaValidation(encoder *SchemaEncoder) QueueOption {
+	return func(q *Queue) error {
+		if encoder == nil {
+			return errors.New("schema encoder must not be nil")
+		}
+		q.schemas = encoder
+		return nil
+	}
+}
+
+// TopicWithSchemaValidation validates every message sent to the Topic with the SchemaEncoder before it is sent, so
+// messages which are not annotated with a schema ID, or whose payload does not conform to their schema, are rejected
+// rather than reaching subscribers
+func TopicWithSchemaValidation(encoder *SchemaEncoder) TopicOption {
+	return func(t *Topic) error {
+		if encoder == nil {
+			return errors.New("schema encoder must not be nil")
+		}
+		t.schemas = encoder
+		return nil
+	}
+}
+
+// validate validates the messages, if an entity has been configured with the SchemaEncoder. se may be nil.
+func (se *SchemaEncoder) validate(ctx context.Context, messages ...*Message) error {
+	if se == nil {
+		return nil
+	}
+	for _, msg := range messages {
+		if err := se.Validate(ctx, msg); err != nil {
+			log.For(ctx).Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// codecOf resolves the codec for the schema the message is annotated with
+func (se *SchemaEncoder) codecOf(ctx context.Context, msg *Message) (Codec, error) {
+	rawID, ok := msg.UserProperties[SchemaIDProperty]
+	if !ok {
+		return nil, ErrMissingField(SchemaIDProperty)
+	}
+
+	id, ok := rawID.(string)
+	if !ok {
+		return nil, newErrIncorrectType(SchemaIDProperty, "", rawID)
+	}
+	return se.codecFor(ctx, id, nil)
+}
+
+func (se *SchemaEncoder) schemaID(ctx context.Context, name, definition string) (string, error) {
+	key := name + "\x00" + definition
+	se.mu.Lock()
+	id, ok := se.ids[key]
+	se.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	id, err := se.registry.GetSchemaID(ctx, se.group, name, se.codec.Format(), definition)
+	if err != nil {
+		return "", err
+	}
+
+	se.mu.Lock()
+	se.ids[key] = id
+	se.mu.Unlock()
+	return id, nil
+}
+
+// codecFor returns the codec for the schema with the ID, fetching the schema from the registry if it is not given
+func (se *SchemaEncoder) codecFor(ctx context.Context, id string, schema *Schema) (Codec, error) {
+	se.mu.Lock()
+	codec, ok := se.codecs[id]
+	se.mu.Unlock()
+	if ok {
+		return codec, nil
+	}
+
+	if schema == nil {
+		var err error
+		if schema, err = se.registry.GetSchema(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if schema.Format != se.codec.Format() {
+		return nil, fmt.Errorf("schema %q has format %q, but the codec decodes %q", id, schema.Format, se.codec.Format())
+	}
+	codec, err := se.codec.ForSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	se.mu.Lock()
+	se.codecs[id] = codec
+	se.mu.Unlock()
+	return codec, nil
+}
+
+// Format returns SchemaFormatJSON
+func (JSONSchemaCodec) Format() SchemaFormat {
+	return SchemaFormatJSON
+}
+
+// ForSchema compiles the JSON schema and returns a Codec which validates payloads against it
+func (JSONSchemaCodec) ForSchema(schema *Schema) (Codec, error) {
+	compiled, err := compileJSONSchema(schema.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("schema %q is not a valid JSON schema: %v", schema.Name, err)
+	}
+	return &jsonSchemaCodec{name: schema.Name, compiled: compiled}, nil
+}
+
+// Encode marshals v to JSON and validates the result against the schema
+func (c *jsonSchemaCodec) Encode(v interface{}) ([]byte, error) {
+	data, err := c.JSONCodec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Decode validates the JSON data against the schema and unmarshals it into v
+func (c *jsonSchemaCodec) Decode(data []byte, v interface{}) error {
+	if err := c.Validate(data); err != nil {
+		return err
+	}
+	return c.JSONCodec.Decode(data, v)
+}
+
+// Validate checks that the JSON data conforms to the schema
+func (c *jsonSchemaCodec) Validate(data []byte) error {
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return fmt.Errorf("payload is not valid JSON: %v", err)
+	}
+
+	if err := c.compiled.validate(doc, "#"); err != nil {
+		return fmt.Errorf("payload does not conform to schema %q: %v", c.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package servicebus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySchemaRegistry struct {
+	schemas map[string]*Schema
+	lookups int
+}
+
+func (r *memorySchemaRegistry) GetSchemaID(_ context.Context, group, name string, format SchemaFormat, definition string) (string, error) {
+	r.lookups++
+	for id, s := range r.schemas {
+		if s.Group == group && s.Name == name && s.Definition == definition {
+			return id, nil
+		}
+	}
+	id := fmt.Sprintf("id-%d", len(r.schemas))
+	r.schemas[id] = &Schema{ID: id, Group: group, Name: name, Format: format, Definition: definition}
+	return id, nil
+}
+
+func (r *memorySchemaRegistry) GetSchema(_ context.Context, id string) (*Schema, error) {
+	r.lookups++
+	if s, ok := r.schemas[id]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("schema %q not found", id)
+}
+
+func TestSchemaEncoder_RoundTrip(t *testing.T) {
+	type order struct {
+		ID       string `json:"id"`
+		Quantity int    `json:"quantity"`
+	}
+	const definition = `{"type":"object","required":["id","quantity"]}`
+
+	registry := &memorySchemaRegistry{schemas: make(map[string]*Schema)}
+	encoder := NewSchemaEncoder(registry, "orders", JSONSchemaCodec{})
+	ctx := context.Background()
+
+	msg, err := encoder.NewMessage(ctx, "order", definition, order{ID: "a", Quantity: 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "application/json", msg.ContentType)
+	assert.Equal(t, "id-0", msg.UserProperties[SchemaIDProperty])
+
+	_, err = encoder.NewMessage(ctx, "order", definition, order{ID: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, registry.lookups, "schema IDs should be cached")
+
+	var got order
+	if assert.NoError(t, encoder.Decode(ctx, msg, &got)) {
+		assert.Equal(t, order{ID: "a", Quantity: 2}, got)
+	}
+
+	_, err = encoder.NewMessage(ctx, "order", definition, map[string]string{"id": "c"})
+	assert.EqualError(t, err, `payload does not conform to schema "order": #: property "quantity" is required`)
+
+	assert.Error(t, encoder.Decode(ctx, NewMessageFromString("{}"), &got))
+}
+
+func TestQueueWithSchemaValidation_RejectsMessagesBeforeSending(t *testing.T) {
+	const definition = `{"type":"object","properties":{"quantity":{"type":"integer","minimum":1}}}`
+
+	registry := &memorySchemaRegistry{schemas: make(map[string]*Schema)}
+	encoder := NewSchemaEncoder(registry, "orders", JSONSchemaCodec{})
+	ctx := context.Background()
+
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("orders", QueueWithSchemaValidation(encoder))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, ErrMissingField(SchemaIDProperty), q.Send(ctx, NewMessageFromString(`{"quantity":1}`)))
+
+	msg, err := encoder.NewMessage(ctx, "order", definition, map[string]int{"quantity": 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg.Data = []byte(`{"quantity":0}`)
+	assert.EqualError(t, q.Send(ctx, msg), `payload does not conform to schema "order": #/quantity: must be at least 1`)
+	assert.Error(t, q.SendBatch(ctx, []*Message{msg}))
+}
@@ -0,0 +1,164 @@
+// Package schemaregistry provides a servicebus.SchemaRegistry backed by Azure Schema Registry
+package schemaregistry
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/Azure/azure-amqp-common-go/log"
+
+	"github.com/Azure/azure-service-bus-go"
+)
+
+const (
+	apiVersion = "2021-10"
+
+	schemaIDHeader        = "Schema-Id"
+	schemaGroupNameHeader = "Schema-Group-Name"
+	schemaNameHeader      = "Schema-Name"
+	serializationParam    = "serialization"
+)
+
+type (
+	// Client is a servicebus.SchemaRegistry which registers and fetches schemas from an Azure Schema Registry
+	Client struct {
+		Endpoint      string
+		TokenProvider auth.TokenProvider
+		HTTPClient    *http.Client
+	}
+)
+
+var _ servicebus.SchemaRegistry = (*Client)(nil)
+
+// NewClient creates a new Client for the schema registry of a namespace, for example
+// myregistry.servicebus.windows.net. The token provider must issue Azure Active Directory tokens.
+func NewClient(fullyQualifiedNamespace string, tokenProvider auth.TokenProvider) *Client {
+	endpoint := fullyQualifiedNamespace
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	return &Client{
+		Endpoint:      strings.TrimSuffix(endpoint, "/") + "/",
+		TokenProvider: tokenProvider,
+		HTTPClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// GetSchemaID registers the schema definition in the group, which returns the ID of the existing schema if an
+// identical definition is already registered
+func (c *Client) GetSchemaID(ctx context.Context, group, name string, format servicebus.SchemaFormat, definition string) (string, error) {
+	path := fmt.Sprintf("$schemagroups/%s/schemas/%s", url.PathEscape(group), url.PathEscape(name))
+	res, err := c.execute(ctx, http.MethodPut, path, string(format), strings.NewReader(definition))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	id := res.Header.Get(schemaIDHeader)
+	if id == "" {
+		return "", fmt.Errorf("schema registry response is missing the %s header", schemaIDHeader)
+	}
+	return id, nil
+}
+
+// GetSchema fetches the schema with the ID
+func (c *Client) GetSchema(ctx context.Context, id string) (*servicebus.Schema, error) {
+	res, err := c.execute(ctx, http.MethodGet, "$schemagroups/$schemas/"+url.PathEscape(id), "", http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	definition, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &servicebus.Schema{
+		ID:         id,
+		Group:      res.Header.Get(schemaGroupNameHeader),
+		Name:       res.Header.Get(schemaNameHeader),
+		Format:     formatFromContentType(res.Header.Get("Content-Type")),
+		Definition: string(definition),
+	}, nil
+}
+
+func (c *Client) execute(ctx context.Context, method, path, format string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.Endpoint+path+"?api-version="+apiVersion, body)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	if format != "" {
+		req.Header.Set("Content-Type", "application/json; "+serializationParam+"="+format)
+	}
+
+	token, err := c.TokenProvider.GetToken(c.Endpoint)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+	if token.TokenType == auth.CBSTokenTypeJWT {
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+	} else {
+		req.Header.Set("Authorization", token.Token)
+	}
+
+	res, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		err := fmt.Errorf("schema registry request failed with status %d: %s", res.StatusCode, string(b))
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+	return res, nil
+}
+
+func formatFromContentType(contentType string) servicebus.SchemaFormat {
+	for _, part := range strings.Split(contentType, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], serializationParam) {
+			return servicebus.SchemaFormat(kv[1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package schemaregistry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-service-bus-go"
+)
+
+type staticTokenProvider struct{}
+
+func (staticTokenProvider) GetToken(string) (*auth.Token, error) {
+	return auth.NewToken(auth.CBSTokenTypeJWT, "secret", "0"), nil
+}
+
+func TestClient_RoundTrip(t *testing.T) {
+	const definition = `{"type":"object"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, apiVersion, r.URL.Query().Get("api-version"))
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/$schemagroups/group/schemas/order":
+			assert.Equal(t, "application/json; serialization=Json", r.Header.Get("Content-Type"))
+			b, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, definition, string(b))
+			w.Header().Set(schemaIDHeader, "abc")
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/$schemagroups/$schemas/abc":
+			w.Header().Set("Content-Type", "application/json; serialization=Json")
+			w.Header().Set(schemaGroupNameHeader, "group")
+			w.Header().Set(schemaNameHeader, "order")
+			w.Write([]byte(definition))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, staticTokenProvider{})
+	ctx := context.Background()
+
+	id, err := client.GetSchemaID(ctx, "group", "order", servicebus.SchemaFormatJSON, definition)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "abc", id)
+	}
+
+	schema, err := client.GetSchema(ctx, "abc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &servicebus.Schema{
+			ID:         "abc",
+			Group:      "group",
+			Name:       "order",
+			Format:     servicebus.SchemaFormatJSON,
+			Definition: definition,
+		}, schema)
+	}
+
+	_, err = client.GetSchema(ctx, "missing")
+	assert.Error(t, err)
+}
@@ -25,12 +25,10 @@ package servicebus
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/Azure/azure-amqp-common-go/log"
 	"github.com/Azure/azure-amqp-common-go/uuid"
-	"github.com/opentracing/opentracing-go"
 	"pack.ag/amqp"
 )
 
@@ -44,6 +42,10 @@ type (
 		entityPath string
 		Name       string
 		sessionID  *string
+		stats      linkStats
+
+		linkProperties      map[string]interface{}
+		transferDestination string
 	}
 
 	// SendOption provides a way to customize a message on sending
@@ -61,7 +63,7 @@ type (
 // newSender creates a new Service Bus message sender given an AMQP client and entity path
 func (ns *Namespace) newSender(ctx context.Context, entityPath string, opts ...senderOption) (*sender, error) {
 	span, ctx := ns.startSpanFromContext(ctx, "sb.sender.newSender")
-	defer span.Finish()
+	defer span.End()
 
 	s := &sender{
 		namespace:  ns,
@@ -85,34 +87,48 @@ func (ns *Namespace) newSender(ctx context.Context, entityPath string, opts ...s
 // Recover will attempt to close the current session and link, then rebuild them
 func (s *sender) Recover(ctx context.Context) error {
 	span, ctx := s.startProducerSpanFromContext(ctx, "sb.sender.Recover")
-	defer span.Finish()
+	defer span.End()
 
 	// we expect the sender, session or client is in an error state, ignore errors
 	closeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	closeCtx = opentracing.ContextWithSpan(closeCtx, span)
 	defer cancel()
 	_ = s.sender.Close(closeCtx)
 	_ = s.session.Close(closeCtx)
-	_ = s.connection.Close()
-	return s.newSessionAndLink(ctx)
+	_ = s.namespace.closeConnection(s.connection)
+	if err := s.newSessionAndLink(ctx); err != nil {
+		return err
+	}
+	s.stats.recovered()
+	return nil
 }
 
 // Close will close the AMQP connection, session and link of the sender
 func (s *sender) Close(ctx context.Context) error {
 	span, _ := s.startProducerSpanFromContext(ctx, "sb.sender.Close")
-	defer span.Finish()
+	defer span.End()
 
-	return s.connection.Close()
+	s.stats.setState(LinkClosed)
+	return s.namespace.closeConnection(s.connection)
 }
 
 // Send will send a message to the entity path with options
 //
-// This will retry sending the message if the server responds with a busy error.
+// This will retry sending the message under the namespace's data plane RetryPolicy if the server responds with a busy
+// error.
 func (s *sender) Send(ctx context.Context, event *Message, opts ...SendOption) error {
 	span, ctx := s.startProducerSpanFromContext(ctx, "sb.sender.Send")
-	defer span.Finish()
+	defer span.End()
+
+	if err := s.prepare(ctx, span, event, opts...); err != nil {
+		return err
+	}
+	return s.trySend(ctx, event)
+}
 
-	if event.GroupID == nil {
+// prepare assigns the message an ID and the sender's session if it has neither, then applies the send options. A
+// message with a partition key is not given the sender's session, which would not match its key.
+func (s *sender) prepare(ctx context.Context, span Span, event *Message, opts ...SendOption) error {
+	if _, keyed := event.PartitionKey(); event.GroupID == nil && !keyed {
 		event.GroupID = &s.session.SessionID
 		next := s.session.getNext()
 		event.GroupSequence = &next
@@ -135,15 +151,23 @@ func (s *sender) Send(ctx context.Context, event *Message, opts ...SendOption) e
 		}
 	}
 
-	return s.trySend(ctx, event)
+	// validated last, once the session and the send options have had their say
+	if err := event.validatePartitionKeys(); err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	s.namespace.stampSendTimeOn(event)
+	stampCorrelation(ctx, event)
+	injectDiagnostics(ctx, span, event)
+	return nil
 }
 
 func (s *sender) trySend(ctx context.Context, evt eventer) error {
 	sp, ctx := s.startProducerSpanFromContext(ctx, "sb.sender.trySend")
-	defer sp.Finish()
+	defer sp.End()
 
-	err := opentracing.GlobalTracer().Inject(sp.Context(), opentracing.TextMap, evt)
-	if err != nil {
+	if err := injectSpan(sp, evt); err != nil {
 		log.For(ctx).Error(err)
 		return err
 	}
@@ -152,25 +176,59 @@ func (s *sender) trySend(ctx context.Context, evt eventer) error {
 	if err != nil {
 		return err
 	}
-	sp.SetTag("sb.message-id", msg.Properties.MessageID)
+	sp.SetAttribute("sb.message-id", msg.Properties.MessageID)
 
+	policy := s.namespace.dataPlaneRetryPolicy()
+	failures := 0
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			// try as long as the context is not dead
-			err = s.sender.Send(ctx, msg)
+			// try as long as the context is not dead and the retry policy allows
+			var dropped bool
+			dropped, err = s.namespace.transferFault(ctx, s.entityPath, msg)
+			if err == nil && !dropped {
+				sent := s.stats.track()
+				err = s.sender.Send(ctx, msg)
+				sent()
+			}
 			if err == nil {
 				// successful send
 				return err
 			}
 
+			if s.namespace.closedForFailover(s.connection) {
+				// the connection was closed to move to the namespace a Geo-DR alias fails over to
+				log.For(ctx).Debug("connection closed for failover, recovering: " + err.Error())
+				s.stats.recovering(err)
+				if err := s.Recover(ctx); err != nil {
+					log.For(ctx).Debug("failed to recover connection")
+				}
+				continue
+			}
+
+			if isEntityNotFound(err) {
+				// retrying cannot bring a missing entity into existence
+				err = ErrEntityNotFound{EntityPath: s.entityPath}
+				s.stats.failed(err)
+				return err
+			}
+
 			switch err.(type) {
 			case *amqp.Error, *amqp.DetachError:
-				log.For(ctx).Debug("amqp error, delaying 4 seconds: " + err.Error())
-				skew := time.Duration(rand.Intn(1000)-500) * time.Millisecond
-				time.Sleep(4*time.Second + skew)
+				failures++
+				if failures >= policy.MaxAttempts {
+					s.stats.failed(err)
+					return err
+				}
+				delay := policy.delay(failures, err)
+				log.For(ctx).Debug(fmt.Sprintf("amqp error, delaying %s: %s", delay, err.Error()))
+				s.stats.recovering(err)
+				s.namespace.reconnecting(err)
+				if err := s.namespace.sleep(ctx, delay); err != nil {
+					return err
+				}
 				err := s.Recover(ctx)
 				if err != nil {
 					log.For(ctx).Debug("failed to recover connection")
@@ -178,6 +236,7 @@ func (s *sender) trySend(ctx context.Context, evt eventer) error {
 				log.For(ctx).Debug("recovered connection")
 			default:
 				fmt.Println(err.Error())
+				s.stats.failed(err)
 				return err
 			}
 		}
@@ -199,7 +258,7 @@ func (s *sender) getFullIdentifier() string {
 // newSessionAndLink will replace the existing session and link
 func (s *sender) newSessionAndLink(ctx context.Context) error {
 	span, ctx := s.startProducerSpanFromContext(ctx, "sb.sender.newSessionAndLink")
-	defer span.Finish()
+	defer span.End()
 
 	connection, err := s.namespace.newConnection()
 	if err != nil {
@@ -211,7 +270,14 @@ func (s *sender) newSessionAndLink(ctx context.Context) error {
 	err = s.namespace.negotiateClaim(ctx, connection, s.getAddress())
 	if err != nil {
 		log.For(ctx).Error(err)
-		return err
+		return entityNotFound(s.entityPath, err)
+	}
+
+	if s.transferDestination != "" {
+		if err := s.namespace.negotiateClaim(ctx, connection, s.transferDestination); err != nil {
+			log.For(ctx).Error(err)
+			return entityNotFound(s.transferDestination, err)
+		}
 	}
 
 	amqpSession, err := connection.NewSession()
@@ -220,12 +286,10 @@ func (s *sender) newSessionAndLink(ctx context.Context) error {
 		return err
 	}
 
-	amqpSender, err := amqpSession.NewSender(
-		amqp.LinkTargetAddress(s.getAddress()),
-		amqp.LinkSenderSettle(amqp.ModeMixed))
+	amqpSender, err := amqpSession.NewSender(s.linkOptions()...)
 	if err != nil {
 		log.For(ctx).Error(err)
-		return err
+		return entityNotFound(s.entityPath, err)
 	}
 
 	s.session, err = newSession(amqpSession)
@@ -238,6 +302,7 @@ func (s *sender) newSessionAndLink(ctx context.Context) error {
 	}
 
 	s.sender = amqpSender
+	s.stats.setState(LinkAttached)
 	return nil
 }
 
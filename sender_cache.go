@@ -0,0 +1,297 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// defaultSenderCacheSize is the number of sender links the Namespace keeps open for ad-hoc sends
+	defaultSenderCacheSize = 64
+	// defaultSenderIdleTimeout is how long a cached sender link may go unused before it is closed
+	defaultSenderIdleTimeout = 5 * time.Minute
+)
+
+type (
+	// senderCache is a least recently used cache of senders keyed by entity path
+	senderCache struct {
+		mu          sync.Mutex
+		size        int
+		idleTimeout time.Duration
+		clock       func() Clock
+		order       *list.List
+		entries     map[string]*list.Element
+		stopSweep   chan struct{}
+	}
+
+	// senderCacheEntry is a cached sender. Entries count the callers using their sender, which is only closed once it
+	// has been evicted and the last of them is done with it.
+	senderCacheEntry struct {
+		entityPath string
+		sender     *sender
+		lastUsed   time.Time
+		refs       int
+		evicted    bool
+		closed     bool
+		// ready is closed once the sender has been built, or failed to be with err
+		ready chan struct{}
+		err   error
+	}
+)
+
+func newSenderCache(clock func() Clock) *senderCache {
+	return &senderCache{
+		size:        defaultSenderCacheSize,
+		idleTimeout: defaultSenderIdleTimeout,
+		clock:       clock,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+// NamespaceWithSenderCacheSize configures the maximum number of sender links cached for Namespace.Send. Once the
+// cache is full, the least recently used link is closed.
+func NamespaceWithSenderCacheSize(size int) NamespaceOption {
+	return func(ns *Namespace) error {
+		if size < 1 {
+			return errors.New("sender cache size must be at least 1")
+		}
+		ns.senders.size = size
+		return nil
+	}
+}
+
+// NamespaceWithSenderIdleTimeout configures how long a sender link cached for Namespace.Send may go unused before it
+// is closed. A timeout of 0 keeps links open until they are evicted by size or the Namespace is closed.
+func NamespaceWithSenderIdleTimeout(timeout time.Duration) NamespaceOption {
+	return func(ns *Namespace) error {
+		if timeout < 0 {
+			return errors.New("sender idle timeout must not be negative")
+		}
+		ns.senders.idleTimeout = timeout
+		return nil
+	}
+}
+
+// Send sends a message to the Queue or Topic at the entity path without requiring a Queue or Topic client. Sender links
+// are cached by entity path; the least recently used link is closed once the cache is full, and links which go unused
+// for longer than the idle timeout are closed in the background.
+func (ns *Namespace) Send(ctx context.Context, entityPath string, msg *Message, opts ...SendOption) error {
+	span, ctx := ns.startSpanFromContext(ctx, "sb.Namespace.Send")
+	defer span.End()
+
+	s, release, err := ns.senders.get(ctx, entityPath, func(ctx context.Context) (*sender, error) {
+		return ns.newSender(ctx, entityPath)
+	})
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	defer release()
+
+	return s.Send(ctx, msg, opts...)
+}
+
+// get returns the cached sender for the entity path, building it with newSender if it is not cached. The sender is
+// held for the caller until release is called, so it is not closed while in use. Only one caller builds the sender for
+// an entity path; others asking for it meanwhile wait for it without blocking senders to other entities.
+func (sc *senderCache) get(ctx context.Context, entityPath string, newSender func(context.Context) (*sender, error)) (*sender, func(), error) {
+	sc.mu.Lock()
+	now := sc.clock().Now()
+	if elem, ok := sc.entries[entityPath]; ok {
+		entry := elem.Value.(*senderCacheEntry)
+		entry.refs++
+		entry.lastUsed = now
+		sc.order.MoveToFront(elem)
+		sc.mu.Unlock()
+
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			sc.release(entry)
+			return nil, nil, ctx.Err()
+		}
+		if entry.err != nil {
+			sc.release(entry)
+			return nil, nil, entry.err
+		}
+		return entry.sender, func() { sc.release(entry) }, nil
+	}
+
+	entry := &senderCacheEntry{entityPath: entityPath, lastUsed: now, refs: 1, ready: make(chan struct{})}
+	sc.entries[entityPath] = sc.order.PushFront(entry)
+	sc.mu.Unlock()
+
+	// the sender is built without holding the lock, as dialing and negotiating claims can take a while
+	s, err := newSender(ctx)
+
+	sc.mu.Lock()
+	if err != nil {
+		if elem, ok := sc.entries[entityPath]; ok && elem.Value == entry {
+			sc.order.Remove(elem)
+			delete(sc.entries, entityPath)
+		}
+		entry.err = err
+		close(entry.ready)
+		sc.mu.Unlock()
+		if s != nil {
+			_ = s.Close(ctx)
+		}
+		return nil, nil, err
+	}
+
+	entry.sender = s
+	close(entry.ready)
+	var closing []*sender
+	for sc.order.Len() > sc.size {
+		closing = append(closing, sc.evict(sc.order.Back())...)
+	}
+	if sc.idleTimeout > 0 && sc.stopSweep == nil {
+		sc.stopSweep = make(chan struct{})
+		go sc.sweep(sc.stopSweep)
+	}
+	sc.mu.Unlock()
+
+	closeSenders(ctx, closing)
+	return s, func() { sc.release(entry) }, nil
+}
+
+// release hands back a sender returned by get, closing it if it was evicted while in use
+func (sc *senderCache) release(entry *senderCacheEntry) {
+	sc.mu.Lock()
+	entry.refs--
+	entry.lastUsed = sc.clock().Now()
+	closing := entry.evicted && entry.refs == 0 && entry.sender != nil && !entry.closed
+	if closing {
+		entry.closed = true
+	}
+	sc.mu.Unlock()
+
+	if closing {
+		closeSenders(context.Background(), []*sender{entry.sender})
+	}
+}
+
+// sweep periodically closes senders which have been idle for longer than the idle timeout until stop is closed
+func (sc *senderCache) sweep(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-sc.clock().After(sc.idleTimeout):
+			sc.evictIdle()
+		}
+	}
+}
+
+// evictIdle closes the senders which have not been used within the idle timeout
+func (sc *senderCache) evictIdle() {
+	ctx := context.Background()
+	sc.mu.Lock()
+	var closing []*sender
+	defer func() {
+		sc.mu.Unlock()
+		closeSenders(ctx, closing)
+	}()
+
+	now := sc.clock().Now()
+	// the list is ordered by when senders were last taken, so the idle senders are at the back, along with any taken
+	// long ago which are still in use and so are not idle
+	for elem := sc.order.Back(); elem != nil; {
+		entry := elem.Value.(*senderCacheEntry)
+		prev := elem.Prev()
+		if entry.refs == 0 {
+			if now.Sub(entry.lastUsed) < sc.idleTimeout {
+				return
+			}
+			log.For(ctx).Debug("closing idle sender for " + entry.entityPath)
+			closing = append(closing, sc.evict(elem)...)
+		}
+		elem = prev
+	}
+
+	if sc.order.Len() == 0 && sc.stopSweep != nil {
+		// nothing left to sweep, the sweeper is restarted when the next sender is cached
+		close(sc.stopSweep)
+		sc.stopSweep = nil
+	}
+}
+
+// evict removes the element from the cache, returning its sender to be closed unless it is in use, in which case it
+// is closed once it is released. The caller must hold the lock.
+func (sc *senderCache) evict(elem *list.Element) []*sender {
+	entry := sc.order.Remove(elem).(*senderCacheEntry)
+	delete(sc.entries, entry.entityPath)
+	entry.evicted = true
+	if entry.refs > 0 || entry.sender == nil || entry.closed {
+		return nil
+	}
+	entry.closed = true
+	return []*sender{entry.sender}
+}
+
+// closeSenders closes the senders, logging any failure
+func closeSenders(ctx context.Context, senders []*sender) {
+	for _, s := range senders {
+		if err := s.Close(ctx); err != nil {
+			log.For(ctx).Error(err)
+		}
+	}
+}
+
+// close closes all cached senders, including those in use, returning the last error encountered
+func (sc *senderCache) close(ctx context.Context) error {
+	sc.mu.Lock()
+	if sc.stopSweep != nil {
+		close(sc.stopSweep)
+		sc.stopSweep = nil
+	}
+
+	var closing []*sender
+	for elem := sc.order.Back(); elem != nil; elem = sc.order.Back() {
+		entry := sc.order.Remove(elem).(*senderCacheEntry)
+		delete(sc.entries, entry.entityPath)
+		entry.evicted = true
+		if entry.sender != nil && !entry.closed {
+			entry.closed = true
+			closing = append(closing, entry.sender)
+		}
+	}
+	sc.mu.Unlock()
+
+	var lastErr error
+	for _, s := range closing {
+		if err := s.Close(ctx); err != nil {
+			log.For(ctx).Error(err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,228 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenderCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	cache := newSenderCache(ns.getClock)
+	cache.size = 2
+	cache.idleTimeout = 0
+	built := 0
+	newSender := func(entityPath string) func(context.Context) (*sender, error) {
+		return func(context.Context) (*sender, error) {
+			built++
+			return &sender{namespace: ns, entityPath: entityPath}, nil
+		}
+	}
+
+	for _, path := range []string{"a", "b", "a", "c", "a", "b"} {
+		s, release, err := cache.get(ctx, path, newSender(path))
+		if assert.NoError(t, err) {
+			assert.Equal(t, path, s.entityPath)
+			release()
+		}
+	}
+
+	// "b" is evicted when "c" is added since "a" was used more recently, then rebuilt
+	assert.Equal(t, 4, built)
+	assert.Len(t, cache.entries, 2)
+	assert.Contains(t, cache.entries, "a")
+	assert.Contains(t, cache.entries, "b")
+
+	assert.NoError(t, cache.close(ctx))
+	assert.Empty(t, cache.entries)
+	assert.Equal(t, 0, cache.order.Len())
+}
+
+func TestSenderCache_DoesNotCacheFailures(t *testing.T) {
+	cache := newSenderCache(func() Clock { return systemClock{} })
+	buildErr := errors.New("boom")
+
+	_, _, err := cache.get(context.Background(), "a", func(context.Context) (*sender, error) {
+		return nil, buildErr
+	})
+	assert.Equal(t, buildErr, err)
+	assert.Empty(t, cache.entries)
+}
+
+func TestSenderCache_EvictsIdleSenders(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock), NamespaceWithSenderIdleTimeout(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	get := func(entityPath string) {
+		_, release, err := ns.senders.get(ctx, entityPath, func(context.Context) (*sender, error) {
+			return &sender{namespace: ns, entityPath: entityPath}, nil
+		})
+		if assert.NoError(t, err) {
+			release()
+		}
+	}
+
+	get("a")
+	clock.waitForCalls(1)
+	clock.Advance(30 * time.Second)
+	get("b")
+	clock.Advance(30 * time.Second)
+
+	// "a" has been idle for the full timeout, "b" only for half of it
+	cached := func(entityPath string) bool {
+		ns.senders.mu.Lock()
+		defer ns.senders.mu.Unlock()
+		_, ok := ns.senders.entries[entityPath]
+		return ok
+	}
+	for deadline := time.Now().Add(time.Second); cached("a") && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, cached("a"))
+	assert.True(t, cached("b"))
+
+	assert.NoError(t, ns.Close(ctx))
+}
+
+func TestSenderCache_SweepSkipsSendersInUse(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	cache := newSenderCache(ns.getClock)
+	cache.idleTimeout = time.Minute
+	s, release, err := cache.get(ctx, "busy", func(context.Context) (*sender, error) {
+		return &sender{namespace: ns, entityPath: "busy"}, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	clock.Advance(2 * time.Minute)
+	cache.evictIdle()
+	assert.Contains(t, cache.entries, "busy", "a sender in use is not idle however long ago it was taken")
+	assert.False(t, linkClosed(s))
+
+	release()
+	clock.Advance(2 * time.Minute)
+	cache.evictIdle()
+	assert.NotContains(t, cache.entries, "busy")
+	assert.True(t, linkClosed(s))
+}
+
+// linkClosed reports whether the sender has been closed
+func linkClosed(s *sender) bool {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return s.stats.state == LinkClosed
+}
+
+func TestSenderCache_ClosesEvictedSenderOnceReleased(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	cache := newSenderCache(ns.getClock)
+	cache.size = 1
+	cache.idleTimeout = 0
+	newSender := func(entityPath string) func(context.Context) (*sender, error) {
+		return func(context.Context) (*sender, error) {
+			return &sender{namespace: ns, entityPath: entityPath}, nil
+		}
+	}
+
+	a, releaseA, err := cache.get(ctx, "a", newSender("a"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, releaseB, err := cache.get(ctx, "b", newSender("b"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer releaseB()
+
+	assert.NotContains(t, cache.entries, "a")
+	assert.False(t, linkClosed(a), "a sender must not be closed while it is sending")
+	releaseA()
+	assert.True(t, linkClosed(a))
+}
+
+func TestSenderCache_BuildsSendersWithoutBlockingOtherEntities(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	cache := newSenderCache(ns.getClock)
+	cache.idleTimeout = 0
+	dialing := make(chan struct{})
+	unblock := make(chan struct{})
+	built := make(chan *sender, 2)
+	go func() {
+		s, release, err := cache.get(ctx, "slow", func(context.Context) (*sender, error) {
+			close(dialing)
+			<-unblock
+			return &sender{namespace: ns, entityPath: "slow"}, nil
+		})
+		if assert.NoError(t, err) {
+			release()
+		}
+		built <- s
+	}()
+	<-dialing
+
+	fast, release, err := cache.get(ctx, "fast", func(context.Context) (*sender, error) {
+		return &sender{namespace: ns, entityPath: "fast"}, nil
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "fast", fast.entityPath)
+		release()
+	}
+
+	// a second caller for the entity being dialed waits for the same sender rather than building another
+	go func() {
+		s, release, err := cache.get(ctx, "slow", func(context.Context) (*sender, error) {
+			t.Error("the sender being built should be shared")
+			return nil, errors.New("unexpected build")
+		})
+		if assert.NoError(t, err) {
+			release()
+		}
+		built <- s
+	}()
+	close(unblock)
+	first, second := <-built, <-built
+	assert.True(t, first == second, "both callers should get the same sender")
+}
+
+func TestNamespaceWithSenderCacheOptions(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithSenderCacheSize(8), NamespaceWithSenderIdleTimeout(0))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 8, ns.senders.size)
+		assert.Equal(t, time.Duration(0), ns.senders.idleTimeout)
+	}
+
+	_, err = NewNamespace(NamespaceWithSenderCacheSize(0))
+	assert.Error(t, err)
+
+	_, err = NewNamespace(NamespaceWithSenderIdleTimeout(-time.Second))
+	assert.Error(t, err)
+}
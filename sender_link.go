@@ -0,0 +1,136 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"time"
+
+	"pack.ag/amqp"
+)
+
+const (
+	// transferDestinationAddressProperty names the entity a message sent to a via entity is transferred to
+	transferDestinationAddressProperty = "com.microsoft:transfer-destination-address"
+	// linkTimeoutProperty is the server side timeout, in milliseconds, for operations on a link
+	linkTimeoutProperty = "com.microsoft:timeout"
+)
+
+type (
+	// SenderLinkOption customizes the AMQP link a Queue or Topic attaches to send messages. These options are for
+	// advanced scenarios which need broker features not otherwise exposed by this package.
+	SenderLinkOption func(*sender) error
+)
+
+// SenderWithLinkProperty sets a string entry in the properties the sender link is attached with. This option can be
+// used multiple times.
+func SenderWithLinkProperty(key, value string) SenderLinkOption {
+	return func(s *sender) error {
+		return s.setLinkProperty(key, value)
+	}
+}
+
+// SenderWithLinkPropertyInt64 sets an integer entry in the properties the sender link is attached with. This option
+// can be used multiple times.
+func SenderWithLinkPropertyInt64(key string, value int64) SenderLinkOption {
+	return func(s *sender) error {
+		return s.setLinkProperty(key, value)
+	}
+}
+
+// SenderWithTransferDestination attaches the sender link to the Queue or Topic as a via entity, which transfers every
+// message it receives on to the entity at destination. Both entities must be in the same namespace, and with
+// partitioned entities both must share the partition chosen by the message's partition key. Claims are negotiated for
+// both the via entity and the destination.
+func SenderWithTransferDestination(destination string) SenderLinkOption {
+	return func(s *sender) error {
+		if destination == "" {
+			return errors.New("transfer destination must not be empty")
+		}
+		s.transferDestination = destination
+		return s.setLinkProperty(transferDestinationAddressProperty, destination)
+	}
+}
+
+// SenderWithLinkTimeout sets the server side timeout for operations on the sender link, including its attach
+func SenderWithLinkTimeout(timeout time.Duration) SenderLinkOption {
+	return func(s *sender) error {
+		if timeout <= 0 {
+			return errors.New("link timeout must be greater than 0")
+		}
+		return s.setLinkProperty(linkTimeoutProperty, int64(timeout/time.Millisecond))
+	}
+}
+
+// QueueWithSenderLinkOptions configures the AMQP link the Queue attaches to send messages
+func QueueWithSenderLinkOptions(opts ...SenderLinkOption) QueueOption {
+	return func(q *Queue) error {
+		q.senderLinkOptions = append(q.senderLinkOptions, opts...)
+		return nil
+	}
+}
+
+// TopicWithSenderLinkOptions configures the AMQP link the Topic attaches to send messages
+func TopicWithSenderLinkOptions(opts ...SenderLinkOption) TopicOption {
+	return func(t *Topic) error {
+		t.senderLinkOptions = append(t.senderLinkOptions, opts...)
+		return nil
+	}
+}
+
+// withSenderLinkOptions adapts link options into the options newSender accepts
+func withSenderLinkOptions(opts []SenderLinkOption) []senderOption {
+	converted := make([]senderOption, len(opts))
+	for i, opt := range opts {
+		converted[i] = senderOption(opt)
+	}
+	return converted
+}
+
+func (s *sender) setLinkProperty(key string, value interface{}) error {
+	if key == "" {
+		return errors.New("link property key must not be empty")
+	}
+	if s.linkProperties == nil {
+		s.linkProperties = make(map[string]interface{})
+	}
+	s.linkProperties[key] = value
+	return nil
+}
+
+// linkOptions returns the options the sender link is attached with
+func (s *sender) linkOptions() []amqp.LinkOption {
+	opts := []amqp.LinkOption{
+		amqp.LinkTargetAddress(s.getAddress()),
+		amqp.LinkSenderSettle(amqp.ModeMixed),
+	}
+	for key, value := range s.linkProperties {
+		switch v := value.(type) {
+		case int64:
+			opts = append(opts, amqp.LinkPropertyInt64(key, v))
+		case string:
+			opts = append(opts, amqp.LinkProperty(key, v))
+		}
+	}
+	return opts
+}
@@ -0,0 +1,58 @@
+package servicebus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenderLinkOptions(t *testing.T) {
+	s := &sender{entityPath: "via"}
+	for _, opt := range withSenderLinkOptions([]SenderLinkOption{
+		SenderWithLinkProperty("custom", "value"),
+		SenderWithLinkPropertyInt64("count", 3),
+		SenderWithTransferDestination("destination"),
+		SenderWithLinkTimeout(30 * time.Second),
+	}) {
+		if !assert.NoError(t, opt(s)) {
+			return
+		}
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"custom":                           "value",
+		"count":                            int64(3),
+		transferDestinationAddressProperty: "destination",
+		linkTimeoutProperty:                int64(30000),
+	}, s.linkProperties)
+	assert.Equal(t, "destination", s.transferDestination)
+	assert.Len(t, s.linkOptions(), 6)
+}
+
+func TestSenderLinkOptions_RejectInvalidValues(t *testing.T) {
+	s := new(sender)
+	assert.Error(t, SenderWithLinkProperty("", "value")(s))
+	assert.Error(t, SenderWithLinkPropertyInt64("", 1)(s))
+	assert.Error(t, SenderWithTransferDestination("")(s))
+	assert.Error(t, SenderWithLinkTimeout(0)(s))
+	assert.Empty(t, s.linkProperties)
+	assert.Len(t, s.linkOptions(), 2)
+}
+
+func TestQueueAndTopicWithSenderLinkOptions(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("via", QueueWithSenderLinkOptions(SenderWithTransferDestination("destination")))
+	if assert.NoError(t, err) {
+		assert.Len(t, q.senderLinkOptions, 1)
+	}
+
+	topic, err := ns.NewTopic("topic", TopicWithSenderLinkOptions(SenderWithLinkTimeout(time.Second), SenderWithLinkProperty("k", "v")))
+	if assert.NoError(t, err) {
+		assert.Len(t, topic.senderLinkOptions, 2)
+	}
+}
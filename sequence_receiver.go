@@ -0,0 +1,311 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/rpc"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+	"pack.ag/amqp"
+)
+
+// deferredMessageState is the x-opt-message-state of a deferred message
+const deferredMessageState int32 = 1
+
+type (
+	// sequenceReceiver receives messages by sequence number through the management link of an entity. Messages received
+	// this way are not delivered on a receive link, so they are settled by lock token through the management link too.
+	sequenceReceiver struct {
+		namespace      *Namespace
+		entityPath     string
+		connection     *amqp.Client
+		mode           ReceiveMode
+		settlementHook SettlementHook
+		codecs         *CodecRegistry
+	}
+)
+
+// ReceiveOneMatching peeks ahead through the Subscription for the first deferred message the predicate matches,
+// receives it by its sequence number, locking it, and passes it to the handler. It lets consumers sharing a
+// subscription pick out the messages they should handle first, such as those labelled high priority, rather than taking
+// them in order. The PeekOptions control where peeking starts and how many messages are peeked at a time.
+//
+// Service Bus only hands out a message by its sequence number once it has been deferred, so the messages to choose from
+// must have been set aside with Message.Defer or ReceivedMessage.Defer by the consumers receiving from the subscription
+// in order. Peeked messages which are not deferred are skipped without being received, as are matching messages which
+// another consumer took first. ErrNoMessages is returned if no message can be received. The handler's message is
+// settled by lock token through the management link, so releasing it abandons it instead; deferring it again leaves it
+// to be picked out later.
+func (s *Subscription) ReceiveOneMatching(ctx context.Context, predicate func(*Message) bool, handler Handler, opts ...PeekOption) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ReceiveOneMatching")
+	defer span.End()
+
+	if predicate == nil {
+		return errors.New("predicate must not be nil")
+	}
+	if handler == nil {
+		return errors.New("handler must not be nil")
+	}
+
+	if err := s.ensureReceiver(ctx); err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	it, err := newPeekIterator(s.entity, s.entityPath(), s.receiver.connection, opts...)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+
+	sr := &sequenceReceiver{
+		namespace:      s.namespace,
+		entityPath:     s.entityPath(),
+		connection:     s.receiver.connection,
+		mode:           s.receiveMode,
+		settlementHook: s.settlementHook,
+	}
+	return receiveOneMatching(ctx, it, sr.receiveOne, predicate, handler)
+}
+
+// ReceiveBySequenceNumbers receives the messages of the Queue with the sequence numbers, through the management
+// receive-by-sequence-number operation, locking them unless the Queue receives in ReceiveAndDelete mode. It is how
+// messages set aside with Message.Defer or ReceivedMessage.Defer are taken up again once their consumer is ready for
+// them. Service Bus only hands out deferred messages this way; ErrAMQP is returned if any of the messages is not
+// deferred and waiting to be received. The messages are settled by lock token through the management link, so
+// releasing them abandons them instead.
+func (q *Queue) ReceiveBySequenceNumbers(ctx context.Context, sequenceNumbers ...int64) ([]*ReceivedMessage, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.ReceiveBySequenceNumbers")
+	defer span.End()
+
+	if len(sequenceNumbers) == 0 {
+		return nil, errors.New("expected one or more sequence numbers")
+	}
+
+	if err := q.ensureReceiver(ctx); err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	sr := &sequenceReceiver{
+		namespace:      q.namespace,
+		entityPath:     q.Name,
+		connection:     q.receiver.connection,
+		mode:           q.receiveMode,
+		settlementHook: q.settlementHook,
+		codecs:         q.codecs,
+	}
+	messages, err := sr.receive(ctx, sequenceNumbers...)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	received := make([]*ReceivedMessage, len(messages))
+	for i, msg := range messages {
+		received[i] = &ReceivedMessage{Message: msg}
+	}
+	return received, nil
+}
+
+// receiveOneMatching receives the first message peeked from the iterator which matches the predicate and can be
+// received, and hands it to the handler. The message is completed if the handler returns no disposition.
+func receiveOneMatching(ctx context.Context, peek MessageIterator, receive func(context.Context, int64) (*Message, error), predicate func(*Message) bool, handler Handler) error {
+	for {
+		peeked, err := peek.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if peeked.SystemProperties == nil || peeked.SystemProperties.SequenceNumber == nil || !predicate(peeked) {
+			continue
+		}
+		if state := peeked.SystemProperties.State; state != nil && *state != deferredMessageState {
+			// only deferred messages can be received by sequence number
+			continue
+		}
+
+		msg, err := receive(ctx, *peeked.SystemProperties.SequenceNumber)
+		if isMessageNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+			return err
+		}
+
+		action := handler.Handle(ctx, msg)
+		if msg.receiveMode == ReceiveAndDeleteMode {
+			return nil
+		}
+		if action == nil {
+			action = msg.Complete()
+		}
+		action(dispositionContext(ctx))
+		return nil
+	}
+}
+
+// isMessageNotFound reports whether err is the broker's answer to receiving a message by a sequence number it will not
+// hand out, either because no such message is waiting or because it is not deferred
+func isMessageNotFound(err error) bool {
+	var amqpErr ErrAMQP
+	return errors.As(err, &amqpErr) && (amqpErr.Code == 404 || amqpErr.Code == 410)
+}
+
+// receiveOne receives the message with the sequence number
+func (sr *sequenceReceiver) receiveOne(ctx context.Context, sequenceNumber int64) (*Message, error) {
+	messages, err := sr.receive(ctx, sequenceNumber)
+	if err != nil {
+		return nil, err
+	}
+	return messages[0], nil
+}
+
+// receive locks the messages with the sequence numbers, or removes them if the receive mode is ReceiveAndDelete
+func (sr *sequenceReceiver) receive(ctx context.Context, sequenceNumbers ...int64) ([]*Message, error) {
+	settleMode := uint32(1)
+	if sr.mode == ReceiveAndDeleteMode {
+		settleMode = 0
+	}
+
+	rsp, err := sr.rpc(ctx, receiveBySequenceOperationID, map[string]interface{}{
+		"sequence-numbers":     sequenceNumbers,
+		"receiver-settle-mode": settleMode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := messagesFromSequenceResponse(rsp.Message.Value)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		msg.namespace = sr.namespace
+		msg.receiveMode = sr.mode
+		msg.settlementHook = sr.settlementHook
+		msg.codecs = sr.codecs
+		msg.bySequence = sr
+	}
+	return messages, nil
+}
+
+// updateDisposition settles the message by its lock token, dead-lettering it with the reason if the status is
+// suspended
+func (sr *sequenceReceiver) updateDisposition(ctx context.Context, m *Message, status string, reason *amqp.Error) error {
+	if m.LockToken == nil {
+		return ErrMissingField("lock-token")
+	}
+
+	value := map[string]interface{}{
+		lockTokensFieldName:        []amqp.UUID{amqp.UUID(*m.LockToken)},
+		dispositionStatusFieldName: status,
+	}
+	if reason != nil {
+		value["deadletter-reason"] = string(reason.Condition)
+		value["deadletter-description"] = reason.Description
+	}
+
+	_, err := sr.rpc(ctx, updateDispositionOperationID, value)
+	return err
+}
+
+func (sr *sequenceReceiver) rpc(ctx context.Context, operation string, value map[string]interface{}) (*rpc.Response, error) {
+	msg := &amqp.Message{
+		ApplicationProperties: map[string]interface{}{
+			operationFieldName: operation,
+		},
+		Value: value,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.ApplicationProperties[serverTimeoutFieldName] = uint(sr.namespace.until(deadline) / time.Millisecond)
+	}
+
+	link, err := rpc.NewLink(sr.connection, sr.entityPath+"/$management")
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := link.RetryableRPC(ctx, 3, 1*time.Second, msg)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Code != 200 {
+		return nil, ErrAMQP(*rsp)
+	}
+	return rsp, nil
+}
+
+// messagesFromSequenceResponse decodes the messages of a receive-by-sequence-number response, which come back as a
+// map with the key "messages" of an array of maps, each holding an encoded message and its lock token
+func messagesFromSequenceResponse(value interface{}) ([]*Message, error) {
+	const messagesField, messageField, lockTokenField = "messages", "message", "lock-token"
+
+	body, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, newErrIncorrectType(messagesField, map[string]interface{}{}, value)
+	}
+	rawMessages, ok := body[messagesField]
+	if !ok {
+		return nil, ErrMissingField(messagesField)
+	}
+	entries, ok := rawMessages.([]interface{})
+	if !ok {
+		return nil, newErrIncorrectType(messagesField, []interface{}{}, rawMessages)
+	}
+	if len(entries) == 0 {
+		return nil, ErrNoMessages{}
+	}
+
+	messages := make([]*Message, len(entries))
+	for i, rawEntry := range entries {
+		entry, ok := rawEntry.(map[string]interface{})
+		if !ok {
+			return nil, newErrIncorrectType(messageField, map[string]interface{}{}, rawEntry)
+		}
+		marshaled, ok := entry[messageField].([]byte)
+		if !ok {
+			return nil, ErrMissingField(messageField)
+		}
+
+		var rehydrated amqp.Message
+		if err := rehydrated.UnmarshalBinary(marshaled); err != nil {
+			return nil, err
+		}
+		msg, err := messageFromAMQPMessage(&rehydrated)
+		if err != nil {
+			return nil, err
+		}
+
+		if token, ok := entry[lockTokenField].(amqp.UUID); ok {
+			lockToken := uuid.UUID(token)
+			msg.LockToken = &lockToken
+		}
+		messages[i] = msg
+	}
+	return messages, nil
+}
@@ -0,0 +1,159 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-amqp-common-go/rpc"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func peekedWithLabel(seq int64, label string) *Message {
+	msg := NewMessageFromString(label)
+	msg.Label = label
+	msg.SystemProperties = &SystemProperties{SequenceNumber: &seq}
+	return msg
+}
+
+func TestReceiveOneMatching_SkipsMessagesItCannotReceive(t *testing.T) {
+	peeked := AsMessageSliceIterator([]*Message{
+		peekedWithLabel(1, "low"),
+		peekedWithLabel(2, "high"),
+		peekedWithLabel(3, "low"),
+		peekedWithLabel(4, "high"),
+	})
+	high := func(msg *Message) bool { return msg.Label == "high" }
+
+	var asked []int64
+	receive := func(_ context.Context, seq int64) (*Message, error) {
+		asked = append(asked, seq)
+		if seq == 2 {
+			// taken by another consumer since it was peeked
+			return nil, ErrAMQP(rpc.Response{Code: 410, Description: "message not found"})
+		}
+		return peekedWithLabel(seq, "high"), nil
+	}
+
+	var handled []int64
+	var outcome SettlementOutcome
+	handler := HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		handled = append(handled, *msg.SystemProperties.SequenceNumber)
+		return func(ctx context.Context) {
+			outcome, _ = msg.Settle(ctx, func(ctx context.Context) {
+				msg.settle(ctx, OutcomeCompleted, func() error { return nil })
+			})
+		}
+	})
+
+	err := receiveOneMatching(context.Background(), peeked, receive, high, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 4}, asked)
+	assert.Equal(t, []int64{4}, handled)
+	assert.Equal(t, OutcomeCompleted, outcome)
+}
+
+func TestReceiveOneMatching_NoMatch(t *testing.T) {
+	peeked := AsMessageSliceIterator([]*Message{peekedWithLabel(1, "low")})
+	receive := func(context.Context, int64) (*Message, error) {
+		t.Fatal("a message the predicate rejects should not be received")
+		return nil, nil
+	}
+	handler := HandlerFunc(func(context.Context, *Message) DispositionAction {
+		t.Fatal("the handler should not be called")
+		return nil
+	})
+
+	err := receiveOneMatching(context.Background(), peeked, receive, func(*Message) bool { return false }, handler)
+	assert.IsType(t, ErrNoMessages{}, err)
+}
+
+func TestReceiveOneMatching_SkipsMessagesWhichAreNotDeferred(t *testing.T) {
+	active, deferred := int32(0), deferredMessageState
+	first, second := peekedWithLabel(1, "high"), peekedWithLabel(2, "high")
+	first.SystemProperties.State = &active
+	second.SystemProperties.State = &deferred
+
+	var asked []int64
+	receive := func(_ context.Context, seq int64) (*Message, error) {
+		asked = append(asked, seq)
+		return peekedWithLabel(seq, "high"), nil
+	}
+	handler := HandlerFunc(func(context.Context, *Message) DispositionAction {
+		return func(context.Context) {}
+	})
+
+	err := receiveOneMatching(context.Background(), AsMessageSliceIterator([]*Message{first, second}), receive, func(*Message) bool { return true }, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2}, asked, "an active message cannot be received by sequence number")
+}
+
+func TestReceiveOneMatching_ReturnsReceiveErrors(t *testing.T) {
+	peeked := AsMessageSliceIterator([]*Message{peekedWithLabel(1, "high")})
+	unauthorized := ErrAMQP(rpc.Response{Code: 401, Description: "unauthorized"})
+	receive := func(context.Context, int64) (*Message, error) {
+		return nil, unauthorized
+	}
+
+	err := receiveOneMatching(context.Background(), peeked, receive, func(*Message) bool { return true }, HandlerFunc(func(context.Context, *Message) DispositionAction {
+		return nil
+	}))
+	assert.Equal(t, unauthorized, err)
+}
+
+func TestMessagesFromSequenceResponse(t *testing.T) {
+	encoded, err := (&amqp.Message{
+		Header:     &amqp.MessageHeader{DeliveryCount: 1},
+		Data:       [][]byte{[]byte("hello")},
+		Properties: &amqp.MessageProperties{MessageID: "id"},
+	}).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	token, err := uuid.NewV4()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	messages, err := messagesFromSequenceResponse(map[string]interface{}{
+		"messages": []interface{}{
+			map[string]interface{}{"message": encoded, "lock-token": amqp.UUID(token)},
+			map[string]interface{}{"message": encoded},
+		},
+	})
+	if assert.NoError(t, err) && assert.Len(t, messages, 2) {
+		assert.Equal(t, "hello", string(messages[0].Data))
+		assert.Equal(t, "id", messages[0].ID)
+		assert.Equal(t, &token, messages[0].LockToken)
+		assert.Nil(t, messages[1].LockToken)
+	}
+
+	_, err = messagesFromSequenceResponse(map[string]interface{}{"messages": []interface{}{}})
+	assert.IsType(t, ErrNoMessages{}, err)
+	_, err = messagesFromSequenceResponse(map[string]interface{}{})
+	assert.Equal(t, ErrMissingField("messages"), err)
+}
+
+func TestIsMessageNotFound(t *testing.T) {
+	assert.True(t, isMessageNotFound(ErrAMQP(rpc.Response{Code: 404})))
+	assert.True(t, isMessageNotFound(ErrAMQP(rpc.Response{Code: 410})))
+	assert.False(t, isMessageNotFound(ErrAMQP(rpc.Response{Code: 500})))
+	assert.False(t, isMessageNotFound(errors.New("link detached")))
+	assert.False(t, isMessageNotFound(nil))
+}
+
+func TestQueue_ReceiveBySequenceNumbersRequiresSequenceNumbers(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := ns.NewQueue("queue")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = q.ReceiveBySequenceNumbers(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"pack.ag/amqp"
+)
+
+const (
+	// errorTimeout is returned by the broker when no session became available before the link attach timed out
+	errorTimeout amqp.ErrorCondition = "com.microsoft:timeout"
+
+	// sessionAcceptRetryDelay is the time to wait before asking the broker for another session after a failed attempt
+	sessionAcceptRetryDelay = 1 * time.Second
+)
+
+type (
+	// newSessionReceiverFunc builds a receiver locked to a session, or to the next available session if sessionID is nil
+	newSessionReceiverFunc func(ctx context.Context, sessionID *string) (*receiver, error)
+
+	messageSessionKey struct{}
+)
+
+// MessageSessionFromContext returns the MessageSession of the message being handled, if the context was passed to a
+// SessionHandler. Handlers shared by concurrently processed sessions use it to reach the state of the right session.
+func MessageSessionFromContext(ctx context.Context) (*MessageSession, bool) {
+	ms, ok := ctx.Value(messageSessionKey{}).(*MessageSession)
+	return ms, ok
+}
+
+// receiveSessions accepts sessions from an entity and processes them with the handler, keeping up to
+// maxConcurrentSessions sessions active until the context is done or a session fails.
+func receiveSessions(ctx context.Context, e *entity, newReceiver newSessionReceiverFunc, handler SessionHandler, opts ...ReceiveOption) error {
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, options.maxConcurrentSessions)
+	var wg sync.WaitGroup
+	for i := 0; i < options.maxConcurrentSessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := acceptNextSession(ctx, e, newReceiver, handler, options)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// acceptNextSession locks the next available session, processes it with the handler and then releases it
+func acceptNextSession(ctx context.Context, e *entity, newReceiver newSessionReceiverFunc, handler SessionHandler, options *receiveOptions) error {
+	r, err := newReceiver(ctx, nil)
+	if err != nil {
+		if r != nil && r.connection != nil {
+			_ = e.namespace.closeConnection(r.connection)
+		}
+		if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Condition == errorTimeout {
+			// no sessions are currently available, wait a moment and try again
+			log.For(ctx).Debug("no session available: " + err.Error())
+			return e.namespace.sleep(ctx, sessionAcceptRetryDelay)
+		}
+		return err
+	}
+	defer func() {
+		_ = r.Close(ctx)
+	}()
+
+	return handleSession(ctx, e, r, nil, handler, options)
+}
+
+// handleSession processes a single locked session with the handler until either the handler closes the MessageSession
+// or the receiver stops listening. If a session idle timeout is configured, the session is also released once the
+// timeout passes without a message arriving after the last one was settled.
+func handleSession(ctx context.Context, e *entity, r *receiver, sessionID *string, handler SessionHandler, options *receiveOptions) error {
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ms, err := newMessageSession(r, e, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := handler.Start(ms); err != nil {
+		return err
+	}
+	defer handler.End()
+
+	activity := make(chan bool)
+	signal := func(handling bool) {}
+	if options.sessionIdleTimeout > 0 {
+		go releaseIdleSession(listenCtx, e.namespace.getClock(), ms, activity, options.sessionIdleTimeout)
+		signal = func(handling bool) {
+			select {
+			case activity <- handling:
+			case <-listenCtx.Done():
+			case <-ms.done:
+			}
+		}
+	}
+
+	handle := r.Listen(listenCtx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		signal(true)
+
+		ms.adoptSessionID(msg)
+		action := options.wrap(e.namespace, handler).Handle(context.WithValue(ctx, messageSessionKey{}, ms), msg)
+		if action == nil || r.mode == ReceiveAndDeleteMode {
+			// the receiver has nothing left to settle
+			signal(false)
+			return action
+		}
+		return func(ctx context.Context) {
+			defer signal(false)
+			action(ctx)
+		}
+	}))
+
+	select {
+	case <-handle.Done():
+		return handle.Err()
+	case <-ms.done:
+		return releaseSession(ctx, r, handle, cancel)
+	}
+}
+
+// releaseSession stops receiving, lets the message in flight finish its disposition and then detaches the session
+// link, which releases the session lock and abandons any messages delivered but not yet handled
+func releaseSession(ctx context.Context, r *receiver, handle *listenerHandle, stop context.CancelFunc) error {
+	stop()
+	<-handle.Handled()
+
+	closeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := r.receiver.Close(closeCtx); err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return nil
+}
+
+// releaseIdleSession closes the MessageSession once the idle timeout passes with no message being handled. Activity
+// signals true when a message arrives and false once it has been settled, which starts the timeout again.
+func releaseIdleSession(ctx context.Context, clock Clock, ms *MessageSession, activity <-chan bool, timeout time.Duration) {
+	handling := false
+	for {
+		var idle <-chan time.Time
+		if !handling {
+			idle = clock.After(timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ms.done:
+			return
+		case handling = <-activity:
+		case <-idle:
+			log.For(ctx).Debug("releasing idle session")
+			ms.Close()
+			return
+		}
+	}
+}
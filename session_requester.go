@@ -0,0 +1,228 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+)
+
+const (
+	sessionRequesterRetryDelay = 5 * time.Second
+)
+
+// ErrRequesterClosed is returned by SessionRequester.Request once the SessionRequester has been closed
+var ErrRequesterClosed = errors.New("servicebus: the session requester is closed")
+
+type (
+	// SessionRequester sends requests and waits for their replies on a session of a shared reply queue which belongs
+	// to the SessionRequester alone. Sharing one session-enabled reply queue between many requesters, rather than
+	// creating a queue per requester, is the recommended way to scale request-response over Service Bus.
+	//
+	// Each request carries the reply queue as its ReplyTo and the requester's session as its ReplyToGroupID, and the
+	// replier answers with Message.NewReply, which correlates the reply with the request and addresses it to the
+	// session. Replies to requests which are no longer waiting, for example because they timed out, are discarded.
+	SessionRequester struct {
+		namespace *Namespace
+		requests  MessageSender
+		replies   *Queue
+		replyTo   string
+		sessionID string
+		receive   func(ctx context.Context, sessionID *string, handler SessionHandler) error
+		mu        sync.Mutex
+		pending   map[string]chan *Message
+		closed    bool
+		cancel    context.CancelFunc
+		stopped   chan struct{}
+	}
+)
+
+// NewSessionRequester creates a SessionRequester which sends requests to requests and receives replies on a new,
+// uniquely named session of the session-enabled queue replyQueueName. The queue options configure the receiver of
+// the reply queue.
+func (ns *Namespace) NewSessionRequester(requests MessageSender, replyQueueName string, opts ...QueueOption) (*SessionRequester, error) {
+	if requests == nil {
+		return nil, errors.New("a sender for requests is required")
+	}
+
+	replies, err := ns.NewQueue(replyQueueName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	sr := newSessionRequester(ns, requests, replyQueueName, id.String(), func(ctx context.Context, sessionID *string, handler SessionHandler) error {
+		return replies.ReceiveOneSession(ctx, sessionID, handler)
+	})
+	sr.replies = replies
+	return sr, nil
+}
+
+func newSessionRequester(ns *Namespace, requests MessageSender, replyTo, sessionID string, receive func(context.Context, *string, SessionHandler) error) *SessionRequester {
+	ctx, cancel := context.WithCancel(context.Background())
+	sr := &SessionRequester{
+		namespace: ns,
+		requests:  requests,
+		replyTo:   replyTo,
+		sessionID: sessionID,
+		receive:   receive,
+		pending:   make(map[string]chan *Message),
+		cancel:    cancel,
+		stopped:   make(chan struct{}),
+	}
+	go sr.listen(ctx)
+	return sr
+}
+
+// SessionID returns the session of the reply queue the SessionRequester receives its replies on
+func (sr *SessionRequester) SessionID() string {
+	return sr.sessionID
+}
+
+// Request sends the request and waits for its reply until the context is done. The request is given a message ID if
+// it has none, and its ReplyTo and ReplyToGroupID are set to the reply queue and session of the SessionRequester.
+func (sr *SessionRequester) Request(ctx context.Context, msg *Message) (*Message, error) {
+	span, ctx := sr.namespace.startSpanFromContext(ctx, "sb.SessionRequester.Request")
+	defer span.End()
+
+	if msg.ID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		msg.ID = id.String()
+	}
+	msg.ReplyTo = sr.replyTo
+	msg.ReplyToGroupID = sr.sessionID
+
+	reply := make(chan *Message, 1)
+	sr.mu.Lock()
+	if sr.closed {
+		sr.mu.Unlock()
+		return nil, ErrRequesterClosed
+	}
+	sr.pending[msg.ID] = reply
+	sr.mu.Unlock()
+
+	defer func() {
+		sr.mu.Lock()
+		delete(sr.pending, msg.ID)
+		sr.mu.Unlock()
+	}()
+
+	if err := sr.requests.Send(ctx, msg); err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-sr.stopped:
+		return nil, ErrRequesterClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops receiving replies, failing any requests still waiting with ErrRequesterClosed, and closes the reply
+// queue
+func (sr *SessionRequester) Close(ctx context.Context) error {
+	sr.mu.Lock()
+	sr.closed = true
+	sr.mu.Unlock()
+
+	sr.cancel()
+	select {
+	case <-sr.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if sr.replies != nil {
+		return sr.replies.Close(ctx)
+	}
+	return nil
+}
+
+// listen receives replies on the session until the SessionRequester is closed, taking the session again whenever the
+// session receiver fails
+func (sr *SessionRequester) listen(ctx context.Context) {
+	defer close(sr.stopped)
+
+	handler := NewSessionHandler(HandlerFunc(sr.handleReply), func(*MessageSession) error { return nil }, func() {})
+	for {
+		err := sr.receive(ctx, &sr.sessionID, handler)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.For(ctx).Error(err)
+		}
+		if sr.namespace.sleep(ctx, sessionRequesterRetryDelay) != nil {
+			return
+		}
+	}
+}
+
+// handleReply hands the reply to the request it is correlated with, if that request is still waiting
+func (sr *SessionRequester) handleReply(ctx context.Context, msg *Message) DispositionAction {
+	sr.mu.Lock()
+	reply, ok := sr.pending[msg.CorrelationID]
+	sr.mu.Unlock()
+
+	if !ok {
+		log.For(ctx).Debug("discarding reply to request " + msg.CorrelationID + " which is no longer waiting")
+		return msg.Complete()
+	}
+
+	select {
+	case reply <- msg:
+	default:
+		// a reply has already been received for the request
+	}
+	return msg.Complete()
+}
+
+// NewReply creates a reply to the message, correlated with it through its CorrelationID and addressed to the entity
+// named by its ReplyTo. When the requester asked for its reply on a session with ReplyToGroupID, the reply is sent to
+// that session. The reply still has to be sent to the ReplyTo entity.
+func (m *Message) NewReply(data []byte) *Message {
+	reply := NewMessage(data)
+	reply.CorrelationID = m.ID
+	reply.To = m.ReplyTo
+	if m.ReplyToGroupID != "" {
+		session := m.ReplyToGroupID
+		reply.GroupID = &session
+	}
+	return reply
+}
@@ -0,0 +1,94 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// replyingSender answers each request it is sent through the handler of a fake reply session
+	replyingSender struct {
+		handlers chan SessionHandler
+		err      error
+	}
+)
+
+func (s *replyingSender) Send(ctx context.Context, msg *Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	handler := <-s.handlers
+	defer func() { s.handlers <- handler }()
+
+	// a late reply to an unknown request is discarded
+	handler.Handle(ctx, NewMessageFromString("late").NewReply(nil))
+	handler.Handle(ctx, msg.NewReply([]byte("reply to "+string(msg.Data))))
+	return nil
+}
+
+func newTestSessionRequester(t *testing.T, sender *replyingSender) *SessionRequester {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	sender.handlers = make(chan SessionHandler, 1)
+	return newSessionRequester(ns, sender, "replies", "session", func(ctx context.Context, sessionID *string, handler SessionHandler) error {
+		assert.Equal(t, "session", *sessionID)
+		sender.handlers <- handler
+		<-ctx.Done()
+		<-sender.handlers
+		return ctx.Err()
+	})
+}
+
+func TestSessionRequester_Request(t *testing.T) {
+	sr := newTestSessionRequester(t, new(replyingSender))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request := NewMessageFromString("ping")
+	reply, err := sr.Request(ctx, request)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "reply to ping", string(reply.Data))
+		assert.Equal(t, request.ID, reply.CorrelationID)
+		assert.Equal(t, "replies", reply.To)
+		assert.Equal(t, "session", *reply.GroupID)
+	}
+	assert.NotEmpty(t, request.ID)
+	assert.Equal(t, "replies", request.ReplyTo)
+	assert.Equal(t, "session", request.ReplyToGroupID)
+
+	assert.NoError(t, sr.Close(ctx))
+	_, err = sr.Request(ctx, NewMessageFromString("too late"))
+	assert.Equal(t, ErrRequesterClosed, err)
+}
+
+func TestSessionRequester_RequestFailsWithSend(t *testing.T) {
+	sendErr := errors.New("unavailable")
+	sr := newTestSessionRequester(t, &replyingSender{err: sendErr})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	defer sr.Close(ctx)
+
+	_, err := sr.Request(ctx, NewMessageFromString("ping"))
+	assert.Equal(t, sendErr, err)
+	assert.Empty(t, sr.pending)
+}
+
+func TestMessage_NewReply(t *testing.T) {
+	request := NewMessageFromString("request")
+	request.ID = "id"
+	request.ReplyTo = "replies"
+
+	reply := request.NewReply([]byte("reply"))
+	assert.Equal(t, "id", reply.CorrelationID)
+	assert.Equal(t, "replies", reply.To)
+	assert.Nil(t, reply.GroupID, "replies are only sent to a session when the requester asks for one")
+}
@@ -0,0 +1,109 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+// NewSession locks the session with the ID, or the next available session if sessionID is nil, so its messages can be
+// consumed from the channel returned by MessageSession.Messages. The session lock is held until the MessageSession is
+// closed, which must be done once the session is no longer needed.
+func (q *Queue) NewSession(ctx context.Context, sessionID *string) (*MessageSession, error) {
+	span, ctx := q.startSpanFromContext(ctx, "sb.Queue.NewSession")
+	defer span.End()
+
+	return openSession(ctx, q.entity, q.newSessionReceiver, sessionID)
+}
+
+// NewSession locks the session with the ID, or the next available session if sessionID is nil, so its messages can be
+// consumed from the channel returned by MessageSession.Messages. The session lock is held until the MessageSession is
+// closed, which must be done once the session is no longer needed.
+func (s *Subscription) NewSession(ctx context.Context, sessionID *string) (*MessageSession, error) {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.NewSession")
+	defer span.End()
+
+	return openSession(ctx, s.entity, s.newSessionReceiver, sessionID)
+}
+
+func openSession(ctx context.Context, e *entity, newReceiver newSessionReceiverFunc, sessionID *string) (*MessageSession, error) {
+	r, err := newReceiver(ctx, sessionID)
+	if err != nil {
+		if r != nil && r.connection != nil {
+			_ = e.namespace.closeConnection(r.connection)
+		}
+		return nil, err
+	}
+
+	ms, err := newMessageSession(r, e, sessionID)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+
+	go func() {
+		<-ms.done
+		closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := r.Close(closeCtx); err != nil {
+			log.For(closeCtx).Error(err)
+		}
+	}()
+	return ms, nil
+}
+
+// Messages streams the messages of the session until the context is done or the session is closed, at which point the
+// channel is closed. Messages are not settled automatically; complete, abandon or dead-letter each one received in
+// PeekLock mode. A message which was not yet taken from the channel when the stream stopped is redelivered once its
+// lock expires. Messages should be called at most once per session.
+func (ms *MessageSession) Messages(ctx context.Context) <-chan *Message {
+	out := make(chan *Message)
+	listenCtx, cancel := context.WithCancel(ctx)
+
+	handle := ms.receiver.Listen(listenCtx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+		ms.adoptSessionID(msg)
+
+		select {
+		case out <- msg:
+		case <-ctx.Done():
+		}
+		return settledByConsumer
+	}))
+
+	go func() {
+		defer close(out)
+		select {
+		case <-handle.Done():
+		case <-ms.done:
+		}
+		cancel()
+		<-handle.Handled()
+	}()
+	return out
+}
+
+// settledByConsumer is returned by handlers which pass messages on to be settled elsewhere
+func settledByConsumer(context.Context) {}
@@ -0,0 +1,69 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageSession_MessagesClosesWithSession(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a paused receiver never asks the broker for messages, so the stream only ends when the session is closed
+	r := &receiver{namespace: ns, entityPath: "orders", resumed: make(chan struct{})}
+	ms, err := newMessageSession(r, &entity{namespace: ns, Name: "orders"}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	messages := ms.Messages(context.Background())
+	ms.Close()
+
+	select {
+	case _, ok := <-messages:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message stream was not closed with the session")
+	}
+}
+
+func TestOpenSession_ReturnsReceiverErrors(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fail := errors.New("session is locked by another receiver")
+	_, err = openSession(context.Background(), &entity{namespace: ns, Name: "orders"}, func(context.Context, *string) (*receiver, error) {
+		return nil, fail
+	}, nil)
+	assert.Equal(t, fail, err)
+}
@@ -0,0 +1,137 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// namespaceChild is a Queue, Topic or Subscription created from a Namespace, which Namespace.Close closes
+	namespaceChild interface {
+		Close(ctx context.Context) error
+	}
+
+	// receivingChild is a namespaceChild which may be receiving, and is drained before anything is closed
+	receivingChild interface {
+		namespaceChild
+		stopReceiving(ctx context.Context) error
+	}
+
+	// childRegistry tracks the children of a Namespace which have not been closed yet, in the order they were created
+	childRegistry struct {
+		mu       sync.Mutex
+		children []namespaceChild
+	}
+)
+
+// Close shuts down everything created from the Namespace with a single call, in order. First the receivers of its
+// Queues and Subscriptions are drained: no further messages are handed to their handlers, the messages being handled
+// are allowed to finish and be settled, and prefetched messages are released. Then its Queues, Topics and Subscriptions
+// are closed, detaching their links and closing their connections, and finally the sender links cached for
+// Namespace.Send are closed. Entities which were closed already are skipped. Every step is attempted even if an
+// earlier one fails, and the first error is returned.
+//
+// The Namespace holds on to each Queue, Topic and Subscription created from it until it is closed, so applications
+// which create them per request should close them when done.
+func (ns *Namespace) Close(ctx context.Context) error {
+	span, ctx := ns.startSpanFromContext(ctx, "sb.Namespace.Close")
+	defer span.End()
+
+	var firstErr error
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		log.For(ctx).Error(err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	children := ns.children.snapshot()
+	for _, child := range children {
+		if receiving, ok := child.(receivingChild); ok {
+			record(receiving.stopReceiving(ctx))
+		}
+	}
+	for _, child := range children {
+		record(child.Close(ctx))
+	}
+	record(ns.senders.close(ctx))
+	return firstErr
+}
+
+// stopReceiving drains the Queue's receiver, if it has one
+func (q *Queue) stopReceiving(ctx context.Context) error {
+	q.receiverMu.Lock()
+	r := q.receiver
+	q.receiverMu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+	return r.Drain(ctx)
+}
+
+// stopReceiving drains the Subscription's receiver, if it has one
+func (s *Subscription) stopReceiving(ctx context.Context) error {
+	s.receiverMu.Lock()
+	r := s.receiver
+	s.receiverMu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+	return r.Drain(ctx)
+}
+
+func (cr *childRegistry) track(child namespaceChild) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.children = append(cr.children, child)
+}
+
+func (cr *childRegistry) untrack(child namespaceChild) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	for i, c := range cr.children {
+		if c == child {
+			cr.children = append(cr.children[:i], cr.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot returns the children being tracked
+func (cr *childRegistry) snapshot() []namespaceChild {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	return append([]namespaceChild(nil), cr.children...)
+}
@@ -0,0 +1,86 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	recordingChild struct {
+		name  string
+		calls *[]string
+		err   error
+	}
+
+	recordingReceivingChild struct {
+		recordingChild
+	}
+)
+
+func (c *recordingChild) Close(context.Context) error {
+	*c.calls = append(*c.calls, "close "+c.name)
+	return c.err
+}
+
+func (c *recordingReceivingChild) stopReceiving(context.Context) error {
+	*c.calls = append(*c.calls, "drain "+c.name)
+	return nil
+}
+
+func TestNamespace_CloseDrainsThenClosesChildren(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var calls []string
+	closeErr := errors.New("link detached")
+	ns.children.track(&recordingReceivingChild{recordingChild{name: "queue", calls: &calls}})
+	ns.children.track(&recordingChild{name: "topic", calls: &calls, err: closeErr})
+	ns.children.track(&recordingReceivingChild{recordingChild{name: "subscription", calls: &calls}})
+
+	assert.Equal(t, closeErr, ns.Close(context.Background()))
+	assert.Equal(t, []string{
+		"drain queue",
+		"drain subscription",
+		"close queue",
+		"close topic",
+		"close subscription",
+	}, calls, "every child is closed even when one fails")
+}
+
+func TestNamespace_TracksEntitiesUntilClosed(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+	topic, err := ns.NewTopic("events")
+	if !assert.NoError(t, err) {
+		return
+	}
+	sub, err := ns.NewSubscription("events", "audit")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = ns.NewSubscriptionManager("events")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []namespaceChild{q, topic, sub}, ns.children.snapshot(),
+		"topics created only as parents are not tracked")
+
+	ctx := context.Background()
+	assert.NoError(t, q.Close(ctx))
+	assert.Equal(t, []namespaceChild{topic, sub}, ns.children.snapshot())
+
+	assert.NoError(t, ns.Close(ctx))
+	assert.Empty(t, ns.children.snapshot())
+}
@@ -0,0 +1,164 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"sync"
+
+	"pack.ag/amqp"
+)
+
+type (
+	// ConnectionStatus enumerates the states of the AMQP connections held by a Namespace
+	ConnectionStatus int
+
+	// State describes a connection state transition of a Namespace. Err holds the error which caused the transition,
+	// if any.
+	State struct {
+		Status ConnectionStatus
+		Err    error
+	}
+
+	// connectionState tracks the open AMQP connections of a Namespace and notifies listeners of transitions
+	connectionState struct {
+		mu          sync.Mutex
+		notifyMu    sync.Mutex
+		status      ConnectionStatus
+		connections map[*amqp.Client]struct{}
+		listeners   []func(State)
+	}
+)
+
+const (
+	// Disconnected means no connection could be established, or the last attempt failed
+	Disconnected ConnectionStatus = iota
+	// Connected means at least one connection to the namespace is established
+	Connected
+	// Reconnecting means a connection was lost and is being recovered
+	Reconnecting
+	// Closed means all connections to the namespace have been closed
+	Closed
+)
+
+func (s ConnectionStatus) String() string {
+	switch s {
+	case Disconnected:
+		return "Disconnected"
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	case Closed:
+		return "Closed"
+	default:
+		return "Unknown"
+	}
+}
+
+// OnStateChange registers a callback which is invoked each time the connection state of the Namespace transitions
+// between Connected, Disconnected, Reconnecting and Closed. Callbacks are invoked synchronously and in order, so they
+// should return quickly.
+func (ns *Namespace) OnStateChange(fn func(State)) {
+	ns.state.mu.Lock()
+	defer ns.state.mu.Unlock()
+	ns.state.listeners = append(ns.state.listeners, fn)
+}
+
+// connectionOpened records the outcome of dialing a new connection
+func (ns *Namespace) connectionOpened(conn *amqp.Client, err error) {
+	if err != nil {
+		ns.setState(Disconnected, err, nil)
+		return
+	}
+
+	ns.setState(Connected, nil, func(cs *connectionState) {
+		cs.connections[conn] = struct{}{}
+	})
+	ns.watchFailover()
+}
+
+// reconnecting records that a connection failed with err and is about to be recovered
+func (ns *Namespace) reconnecting(err error) {
+	ns.setState(Reconnecting, err, nil)
+	ns.checkFailover(err)
+}
+
+// closeConnection closes a connection opened by the namespace. Once the last connection is closed, the namespace
+// transitions to Closed unless a connection is being recovered.
+func (ns *Namespace) closeConnection(conn *amqp.Client) error {
+	if conn == nil {
+		return nil
+	}
+
+	ns.state.mu.Lock()
+	_, tracked := ns.state.connections[conn]
+	delete(ns.state.connections, conn)
+	last := tracked && len(ns.state.connections) == 0 && ns.state.status != Reconnecting
+	ns.state.mu.Unlock()
+
+	if ns.failover != nil {
+		ns.failover.forgetConnection(conn)
+	}
+
+	err := conn.Close()
+	if last {
+		ns.setState(Closed, nil, nil)
+	}
+	return err
+}
+
+// hasConnections reports whether the namespace has any open connections
+func (ns *Namespace) hasConnections() bool {
+	ns.state.mu.Lock()
+	defer ns.state.mu.Unlock()
+	return len(ns.state.connections) > 0
+}
+
+// setState applies the update and transitions to status, notifying listeners if the status changed or an error
+// caused the transition
+func (ns *Namespace) setState(status ConnectionStatus, err error, update func(*connectionState)) {
+	cs := &ns.state
+	cs.notifyMu.Lock()
+	defer cs.notifyMu.Unlock()
+
+	cs.mu.Lock()
+	if cs.connections == nil {
+		cs.connections = make(map[*amqp.Client]struct{})
+	}
+	if update != nil {
+		update(cs)
+	}
+	changed := cs.status != status
+	cs.status = status
+	listeners := make([]func(State), len(cs.listeners))
+	copy(listeners, cs.listeners)
+	cs.mu.Unlock()
+
+	if !changed && err == nil {
+		return
+	}
+
+	for _, fn := range listeners {
+		fn(State{Status: status, Err: err})
+	}
+}
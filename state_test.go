@@ -0,0 +1,46 @@
+package servicebus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestNamespace_OnStateChange(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var states []State
+	ns.OnStateChange(func(s State) {
+		states = append(states, s)
+	})
+
+	dialErr := errors.New("dial failed")
+	linkErr := errors.New("link detached")
+	conn := new(amqp.Client)
+
+	ns.connectionOpened(nil, dialErr)
+	ns.connectionOpened(conn, nil)
+	ns.connectionOpened(conn, nil)
+	ns.reconnecting(linkErr)
+	ns.reconnecting(nil)
+	ns.connectionOpened(conn, nil)
+
+	assert.Equal(t, []State{
+		{Status: Disconnected, Err: dialErr},
+		{Status: Connected},
+		{Status: Reconnecting, Err: linkErr},
+		{Status: Connected},
+	}, states)
+}
+
+func TestConnectionStatus_String(t *testing.T) {
+	assert.Equal(t, "Disconnected", Disconnected.String())
+	assert.Equal(t, "Connected", Connected.String())
+	assert.Equal(t, "Reconnecting", Reconnecting.String())
+	assert.Equal(t, "Closed", Closed.String())
+}
@@ -25,7 +25,9 @@ package servicebus
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-amqp-common-go/log"
 	"github.com/Azure/go-autorest/autorest/date"
@@ -42,31 +44,68 @@ type (
 		receiverMu        sync.Mutex
 		receiveMode       ReceiveMode
 		requiredSessionID *string
+		settlementHook    SettlementHook
+		prefetchCount     uint32
+		autoLockRenewal   time.Duration
 	}
 
-	// SubscriptionDescription is the content type for Subscription management requests
+	// SubscriptionDescription is the content type for Subscription management requests. It is written in the order of
+	// the service's schema, as the service ignores elements which are out of place.
 	SubscriptionDescription struct {
 		XMLName xml.Name `xml:"SubscriptionDescription"`
 		BaseEntityDescription
-		LockDuration                              *string       `xml:"LockDuration,omitempty"` // LockDuration - ISO 8601 timespan duration of a peek-lock; that is, the amount of time that the message is locked for other receivers. The maximum value for LockDuration is 5 minutes; the default value is 1 minute.
-		RequiresSession                           *bool         `xml:"RequiresSession,omitempty"`
-		DefaultMessageTimeToLive                  *string       `xml:"DefaultMessageTimeToLive,omitempty"`         // DefaultMessageTimeToLive - ISO 8601 default message timespan to live value. This is the duration after which the message expires, starting from when the message is sent to Service Bus. This is the default value used when TimeToLive is not set on a message itself.
-		DeadLetteringOnMessageExpiration          *bool         `xml:"DeadLetteringOnMessageExpiration,omitempty"` // DeadLetteringOnMessageExpiration - A value that indicates whether this queue has dead letter support when a message expires.
-		DeadLetteringOnFilterEvaluationExceptions *bool         `xml:"DeadLetteringOnFilterEvaluationExceptions,omitempty"`
-		MessageCount                              *int64        `xml:"MessageCount,omitempty"`            // MessageCount - The number of messages in the queue.
-		MaxDeliveryCount                          *int32        `xml:"MaxDeliveryCount,omitempty"`        // MaxDeliveryCount - The maximum delivery count. A message is automatically deadlettered after this number of deliveries. default value is 10.
-		EnableBatchedOperations                   *bool         `xml:"EnableBatchedOperations,omitempty"` // EnableBatchedOperations - Value that indicates whether server-side batched operations are enabled.
-		Status                                    *EntityStatus `xml:"Status,omitempty"`
-		CreatedAt                                 *date.Time    `xml:"CreatedAt,omitempty"`
-		UpdatedAt                                 *date.Time    `xml:"UpdatedAt,omitempty"`
-		AccessedAt                                *date.Time    `xml:"AccessedAt,omitempty"`
-		AutoDeleteOnIdle                          *string       `xml:"AutoDeleteOnIdle,omitempty"`
+		LockDuration                              *string                 `xml:"LockDuration,omitempty"` // LockDuration - ISO 8601 timespan duration of a peek-lock; that is, the amount of time that the message is locked for other receivers. The maximum value for LockDuration is 5 minutes; the default value is 1 minute.
+		RequiresSession                           *bool                   `xml:"RequiresSession,omitempty"`
+		DefaultMessageTimeToLive                  *string                 `xml:"DefaultMessageTimeToLive,omitempty"`         // DefaultMessageTimeToLive - ISO 8601 default message timespan to live value. This is the duration after which the message expires, starting from when the message is sent to Service Bus. This is the default value used when TimeToLive is not set on a message itself.
+		DeadLetteringOnMessageExpiration          *bool                   `xml:"DeadLetteringOnMessageExpiration,omitempty"` // DeadLetteringOnMessageExpiration - A value that indicates whether this queue has dead letter support when a message expires.
+		DeadLetteringOnFilterEvaluationExceptions *bool                   `xml:"DeadLetteringOnFilterEvaluationExceptions,omitempty"`
+		DefaultRuleDescription                    *DefaultRuleDescription `xml:"DefaultRuleDescription,omitempty"`
+		MessageCount                              *int64                  `xml:"MessageCount,omitempty"`            // MessageCount - The number of messages in the queue.
+		MaxDeliveryCount                          *int32                  `xml:"MaxDeliveryCount,omitempty"`        // MaxDeliveryCount - The maximum delivery count. A message is automatically deadlettered after this number of deliveries. default value is 10.
+		EnableBatchedOperations                   *bool                   `xml:"EnableBatchedOperations,omitempty"` // EnableBatchedOperations - Value that indicates whether server-side batched operations are enabled.
+		Status                                    *EntityStatus           `xml:"Status,omitempty"`
+		ForwardTo                                 *string                 `xml:"ForwardTo,omitempty"`
+		CreatedAt                                 *date.Time              `xml:"CreatedAt,omitempty"`
+		UpdatedAt                                 *date.Time              `xml:"UpdatedAt,omitempty"`
+		AccessedAt                                *date.Time              `xml:"AccessedAt,omitempty"`
+		AutoDeleteOnIdle                          *string                 `xml:"AutoDeleteOnIdle,omitempty"`
+		CountDetails                              *CountDetails           `xml:"CountDetails,omitempty"`
+		// Extensions holds the elements of the description which are not modeled above, so that they survive an Update
+		Extensions []RawXMLElement `xml:",any"`
 	}
 
 	// SubscriptionOption configures the Subscription Azure Service Bus client
 	SubscriptionOption func(*Subscription) error
 )
 
+// subscriptionDescriptionSchema lists the elements of a SubscriptionDescription in the order the service expects them
+var subscriptionDescriptionSchema = []string{
+	"LockDuration",
+	"RequiresSession",
+	"DefaultMessageTimeToLive",
+	"DeadLetteringOnMessageExpiration",
+	"DeadLetteringOnFilterEvaluationExceptions",
+	"DefaultRuleDescription",
+	"MessageCount",
+	"MaxDeliveryCount",
+	"EnableBatchedOperations",
+	"Status",
+	"ForwardTo",
+	"UserMetadata",
+	"ForwardDeadLetteredMessagesTo",
+	"CreatedAt",
+	"UpdatedAt",
+	"AccessedAt",
+	"CountDetails",
+	"AutoDeleteOnIdle",
+	"EntityAvailabilityStatus",
+}
+
+// MarshalXML writes the description with its Extensions back in their place among the modeled elements
+func (sd SubscriptionDescription) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalInSchemaOrder(e, start, sd.BaseEntityDescription, sd, sd.Extensions, subscriptionDescriptionSchema)
+}
+
 // SubscriptionWithReceiveAndDelete configures a subscription to pop and delete messages off of the queue upon receiving the message.
 // This differs from the default, PeekLock, where PeekLock receives a message, locks it for a period of time, then sends
 // a disposition to the broker when the message has been processed.
@@ -77,8 +116,54 @@ func SubscriptionWithReceiveAndDelete() SubscriptionOption {
 	}
 }
 
+// SubscriptionWithSettlementHook configures a subscription to call the hook each time the broker acknowledges the
+// settlement of a received message.
+func SubscriptionWithSettlementHook(hook SettlementHook) SubscriptionOption {
+	return func(s *Subscription) error {
+		s.settlementHook = hook
+		return nil
+	}
+}
+
+// SubscriptionWithPrefetchCount configures the subscription to request up to count messages from the broker ahead of
+// the handler asking for them. The default is 1.
+func SubscriptionWithPrefetchCount(count uint32) SubscriptionOption {
+	return func(s *Subscription) error {
+		if count < 1 {
+			return errors.New("prefetch count must be at least 1")
+		}
+		s.prefetchCount = count
+		return nil
+	}
+}
+
+// SubscriptionWithAutoLockRenewal configures the subscription to keep renewing the lock of each PeekLock message while
+// its handler is running, for up to maxDuration after the message was received.
+func SubscriptionWithAutoLockRenewal(maxDuration time.Duration) SubscriptionOption {
+	return func(s *Subscription) error {
+		if maxDuration <= 0 {
+			return errors.New("auto lock renewal duration must be greater than 0")
+		}
+		s.autoLockRenewal = maxDuration
+		return nil
+	}
+}
+
+// NewSubscription creates a new Subscription client for the named Topic
+func (ns *Namespace) NewSubscription(topicName, name string, opts ...SubscriptionOption) (*Subscription, error) {
+	topic, err := ns.newTopic(topicName)
+	if err != nil {
+		return nil, err
+	}
+	return topic.NewSubscription(name, opts...)
+}
+
 // NewSubscription creates a new Topic Subscription client
 func (t *Topic) NewSubscription(name string, opts ...SubscriptionOption) (*Subscription, error) {
+	if err := t.namespace.checkEntityPath(t.Name + "/subscriptions/" + name); err != nil {
+		return nil, err
+	}
+
 	sub := &Subscription{
 		entity: &entity{
 			namespace: t.namespace,
@@ -92,6 +177,8 @@ func (t *Topic) NewSubscription(name string, opts ...SubscriptionOption) (*Subsc
 			return nil, err
 		}
 	}
+
+	t.namespace.children.track(sub)
 	return sub, nil
 }
 
@@ -105,12 +192,22 @@ func (t *Topic) NewSubscription(name string, opts ...SubscriptionOption) (*Subsc
 // unable to complete the operation, or an empty slice of messages and an instance of "ErrNoMessages" signifying that
 // there are currently no messages in the subscription with a sequence ID larger than previously viewed ones.
 func (s *Subscription) Peek(ctx context.Context, options ...PeekOption) (MessageIterator, error) {
+	it, err := s.NewPeekIterator(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// NewPeekIterator creates a PeekIterator over the subscription. Pass the Cursor of an earlier iterator with PeekFromCursor to
+// continue browsing where it stopped.
+func (s *Subscription) NewPeekIterator(ctx context.Context, options ...PeekOption) (*PeekIterator, error) {
 	err := s.ensureReceiver(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return newPeekIterator(s.entity, s.receiver.connection, options...)
+	return newPeekIterator(s.entity, s.entityPath(), s.receiver.connection, options...)
 }
 
 // PeekOne fetches a single Message from the Service Bus broker without acquiring a lock or committing to a disposition.
@@ -126,86 +223,142 @@ func (s *Subscription) PeekOne(ctx context.Context, options ...PeekOption) (*Mes
 	//   be unread.
 	options = append(options, PeekWithPageSize(1))
 
-	it, err := newPeekIterator(s.entity, s.receiver.connection, options...)
+	it, err := newPeekIterator(s.entity, s.entityPath(), s.receiver.connection, options...)
 	if err != nil {
 		return nil, err
 	}
 	return it.Next(ctx)
 }
 
-// ReceiveOne will listen to receive a single message. ReceiveOne will only wait as long as the context allows.
-func (s *Subscription) ReceiveOne(ctx context.Context, handler Handler) error {
+// ReceiveOne will listen to receive a single message. ReceiveOne will only wait as long as the context allows, or up
+// to the duration configured with WithMaxWaitTime, in which case ErrNoMessages is returned if no message arrives.
+func (s *Subscription) ReceiveOne(ctx context.Context, handler Handler, opts ...ReceiveOption) error {
 	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ReceiveOne")
-	defer span.Finish()
+	defer span.End()
 
-	if err := s.ensureReceiver(ctx); err != nil {
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
 		return err
 	}
+	handler = options.wrap(s.namespace, handler)
 
-	return s.receiver.ReceiveOne(ctx, handler)
+	err = withAutoProvision(ctx, options, s.provision, func() error {
+		if err := s.ensureReceiver(ctx); err != nil {
+			return err
+		}
+		return s.receiver.ReceiveOne(ctx, handler, options.maxWaitTime)
+	})
+	return options.filteredOut(err)
 }
 
-// Receive subscribes for messages sent to the Subscription
-func (s *Subscription) Receive(ctx context.Context, handler Handler) error {
-	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.Receive")
-	defer span.Finish()
+// ReceiveBatch receives up to maxMessages messages, passing each to the handler as it arrives. It waits as long as the
+// context allows, or up to the duration configured with WithMaxWaitTime, for the first message, then returns once
+// maxMessages have been handled or no further message is immediately available. ErrNoMessages is returned if the wait
+// time elapses without any message arriving.
+func (s *Subscription) ReceiveBatch(ctx context.Context, maxMessages int, handler Handler, opts ...ReceiveOption) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ReceiveBatch")
+	defer span.End()
 
-	if err := s.ensureReceiver(ctx); err != nil {
+	if maxMessages < 1 {
+		return errors.New("maxMessages must be at least 1")
+	}
+
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
 		return err
 	}
-	handle := s.receiver.Listen(ctx, handler)
-	<-handle.Done()
-	return handle.Err()
-}
+	handler = options.wrap(s.namespace, handler)
 
-// ReceiveOneSession waits for the lock on a particular session to become available, takes it, then process the session.
-func (s *Subscription) ReceiveOneSession(ctx context.Context, sessionID *string, handler SessionHandler) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	err = withAutoProvision(ctx, options, s.provision, func() error {
+		if err := s.ensureReceiver(ctx); err != nil {
+			return err
+		}
+		return s.receiver.ReceiveBatch(ctx, maxMessages, handler, options.maxWaitTime)
+	})
+	return options.filteredOut(err)
+}
 
-	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ReceiveOneSession")
-	defer span.Finish()
+// Receive subscribes for messages sent to the Subscription. ErrEntityNotFound is returned promptly if the Topic or
+// Subscription does not exist, unless ReceiveWithAutoProvision is used to create them.
+func (s *Subscription) Receive(ctx context.Context, handler Handler, opts ...ReceiveOption) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.Receive")
+	defer span.End()
 
-	options := make([]receiverOption, 0, 1)
-	if sessionID != nil {
-		options = append(options, receiverWithSession(sessionID))
-	}
-	s.requiredSessionID = sessionID
-	if err := s.ensureReceiver(ctx, options...); err != nil {
+	options, err := newReceiveOptions(opts...)
+	if err != nil {
 		return err
 	}
+	handler = options.wrap(s.namespace, handler)
+
+	return withAutoProvision(ctx, options, s.provision, func() error {
+		if err := s.ensureReceiver(ctx); err != nil {
+			return err
+		}
+		handle := s.receiver.Listen(ctx, handler)
+		options.ready()
+		<-handle.Done()
+		return handle.Err()
+	})
+}
 
-	ms, err := newMessageSession(s.receiver, s.entity, sessionID)
+// ReceiveOneSession waits for the lock on a particular session to become available, takes it, then process the session.
+func (s *Subscription) ReceiveOneSession(ctx context.Context, sessionID *string, handler SessionHandler, opts ...ReceiveOption) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ReceiveOneSession")
+	defer span.End()
+
+	options, err := newReceiveOptions(opts...)
 	if err != nil {
 		return err
 	}
 
-	err = handler.Start(ms)
-	if err != nil {
+	s.requiredSessionID = sessionID
+	if err := s.ensureReceiver(ctx, receiverWithSession(sessionID)); err != nil {
 		return err
 	}
 
-	defer handler.End()
-	handle := s.receiver.Listen(ctx, handler)
+	return handleSession(ctx, s.entity, s.receiver, sessionID, handler, options)
+}
 
-	select {
-	case <-handle.Done():
-		return handle.Err()
-	case <-ms.done:
-		return nil
+// ReceiveSessions is the session-based counterpart of `Receive`. It subscribes to a Subscription and waits for new
+// sessions to become available. By default one session is processed at a time; use WithMaxConcurrentSessions to drain
+// a session-enabled subscription with bounded parallelism.
+func (s *Subscription) ReceiveSessions(ctx context.Context, handler SessionHandler, opts ...ReceiveOption) error {
+	span, ctx := s.startSpanFromContext(ctx, "sb.Subscription.ReceiveSessions")
+	defer span.End()
+
+	return receiveSessions(ctx, s.entity, s.newSessionReceiver, handler, opts...)
+}
+
+// newSessionReceiver builds a receiver, independent of the Subscription's own receiver, which is locked to a session
+func (s *Subscription) newSessionReceiver(ctx context.Context, sessionID *string) (*receiver, error) {
+	return s.namespace.newReceiver(ctx, s.entityPath(), s.receiverOptions(receiverWithSession(sessionID))...)
+}
+
+// receiverOptions appends the Subscription's receive configuration to the provided options
+func (s *Subscription) receiverOptions(opts ...receiverOption) []receiverOption {
+	opts = append(opts, receiverWithReceiveMode(s.receiveMode), receiverWithSettlementHook(s.settlementHook))
+	if s.prefetchCount > 0 {
+		opts = append(opts, receiverWithPrefetchCount(s.prefetchCount))
 	}
+	if s.autoLockRenewal > 0 {
+		opts = append(opts, receiverWithAutoLockRenewal(s.autoLockRenewal, s.RenewLocks))
+	}
+	return opts
+}
+
+// entityPath is the AMQP address of the Subscription
+func (s *Subscription) entityPath() string {
+	return s.Topic.Name + "/Subscriptions/" + s.Name
 }
 
 func (s *Subscription) ensureReceiver(ctx context.Context, options ...receiverOption) error {
 	span, ctx := s.startSpanFromContext(ctx, "sb.Queue.ensureReceiver")
-	defer span.Finish()
+	defer span.End()
 
 	s.receiverMu.Lock()
 	defer s.receiverMu.Unlock()
 
-	options = append(options, receiverWithReceiveMode(s.receiveMode))
-
-	receiver, err := s.namespace.newReceiver(ctx, s.Topic.Name+"/Subscriptions/"+s.Name, options...)
+	receiver, err := s.namespace.newReceiver(ctx, s.entityPath(), s.receiverOptions(options...)...)
 	if err != nil {
 		log.For(ctx).Error(err)
 		return err
@@ -217,6 +370,7 @@ func (s *Subscription) ensureReceiver(ctx context.Context, options ...receiverOp
 
 // Close the underlying connection to Service Bus
 func (s *Subscription) Close(ctx context.Context) error {
+	s.namespace.children.untrack(s)
 	if s.receiver != nil {
 		return s.receiver.Close(ctx)
 	}
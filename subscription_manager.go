@@ -51,19 +51,19 @@ type (
 // NewSubscriptionManager creates a new SubscriptionManager for a Service Bus Topic
 func (t *Topic) NewSubscriptionManager() *SubscriptionManager {
 	return &SubscriptionManager{
-		entityManager: newEntityManager(t.namespace.getHTTPSHostURI(), t.namespace.TokenProvider),
+		entityManager: t.namespace.newEntityManager(),
 		Topic:         t,
 	}
 }
 
 // NewSubscriptionManager creates a new SubscriptionManger for a Service Bus Namespace
 func (ns *Namespace) NewSubscriptionManager(topicName string) (*SubscriptionManager, error) {
-	t, err := ns.NewTopic(topicName)
+	t, err := ns.newTopic(topicName)
 	if err != nil {
 		return nil, err
 	}
 	return &SubscriptionManager{
-		entityManager: newEntityManager(t.namespace.getHTTPSHostURI(), t.namespace.TokenProvider),
+		entityManager: t.namespace.newEntityManager(),
 		Topic:         t,
 	}, nil
 }
@@ -71,20 +71,23 @@ func (ns *Namespace) NewSubscriptionManager(topicName string) (*SubscriptionMana
 // Delete deletes a Service Bus Topic entity by name
 func (sm *SubscriptionManager) Delete(ctx context.Context, name string) error {
 	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.Delete")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := sm.entityManager.Delete(ctx, sm.getResourceURI(name))
 	if res != nil {
 		defer res.Body.Close()
 	}
 
-	return err
+	if err != nil {
+		return err
+	}
+	return checkDeleteResponse(res)
 }
 
 // Put creates or updates a Service Bus Topic
 func (sm *SubscriptionManager) Put(ctx context.Context, name string, opts ...SubscriptionManagementOption) (*SubscriptionEntity, error) {
 	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.Put")
-	defer span.Finish()
+	defer span.End()
 
 	sd := new(SubscriptionDescription)
 	for _, opt := range opts {
@@ -93,6 +96,40 @@ func (sm *SubscriptionManager) Put(ctx context.Context, name string, opts ...Sub
 		}
 	}
 
+	return sm.put(ctx, name, sd)
+}
+
+// Update applies the options to the description of an existing subscription, as returned by Get or List, and writes
+// it back. Properties of the description which are not modeled by SubscriptionDescription are preserved in its
+// Extensions and sent back unchanged.
+func (sm *SubscriptionManager) Update(ctx context.Context, se *SubscriptionEntity, opts ...SubscriptionManagementOption) (*SubscriptionEntity, error) {
+	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.Update")
+	defer span.End()
+
+	if se == nil || se.SubscriptionDescription == nil {
+		return nil, errors.New("subscription entity must have a description to update")
+	}
+
+	sd := *se.SubscriptionDescription
+	for _, opt := range opts {
+		if err := opt(&sd); err != nil {
+			return nil, err
+		}
+	}
+
+	// extensions may use the instance prefix of the original document, so it must be declared
+	sd.InstanceMetadataSchema = to.StringPtr(xmlSchemaInstance)
+	return sm.put(ctx, se.Name, &sd, atom.IfMatch("*"))
+}
+
+func (sm *SubscriptionManager) put(ctx context.Context, name string, sd *SubscriptionDescription, opts ...atom.RequestOption) (*SubscriptionEntity, error) {
+	if sd.ForwardTo != nil {
+		from := sm.Topic.Name + "/subscriptions/" + name
+		if err := checkForwardingLoop(ctx, sm.forwards, sm.Topic.Name, from, *sd.ForwardTo); err != nil {
+			return nil, err
+		}
+	}
+
 	sd.ServiceBusSchema = to.StringPtr(serviceBusSchema)
 
 	qe := &subscriptionEntry{
@@ -111,7 +148,7 @@ func (sm *SubscriptionManager) Put(ctx context.Context, name string, opts ...Sub
 	}
 
 	reqBytes = xmlDoc(reqBytes)
-	res, err := sm.entityManager.Put(ctx, sm.getResourceURI(name), reqBytes)
+	res, err := sm.entityManager.Put(ctx, sm.getResourceURI(name), reqBytes, opts...)
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -128,7 +165,7 @@ func (sm *SubscriptionManager) Put(ctx context.Context, name string, opts ...Sub
 	var entry subscriptionEntry
 	err = xml.Unmarshal(b, &entry)
 	if err != nil {
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
 	return subscriptionEntryToEntity(&entry), nil
 }
@@ -136,7 +173,7 @@ func (sm *SubscriptionManager) Put(ctx context.Context, name string, opts ...Sub
 // List fetches all of the Topics for a Service Bus Namespace
 func (sm *SubscriptionManager) List(ctx context.Context) ([]*SubscriptionEntity, error) {
 	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.List")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := sm.entityManager.Get(ctx, "/"+sm.Topic.Name+"/subscriptions")
 	if res != nil {
@@ -155,7 +192,7 @@ func (sm *SubscriptionManager) List(ctx context.Context) ([]*SubscriptionEntity,
 	var feed subscriptionFeed
 	err = xml.Unmarshal(b, &feed)
 	if err != nil {
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
 
 	subs := make([]*SubscriptionEntity, len(feed.Entries))
@@ -168,7 +205,7 @@ func (sm *SubscriptionManager) List(ctx context.Context) ([]*SubscriptionEntity,
 // Get fetches a Service Bus Topic entity by name
 func (sm *SubscriptionManager) Get(ctx context.Context, name string) (*SubscriptionEntity, error) {
 	span, ctx := sm.startSpanFromContext(ctx, "sb.SubscriptionManager.Get")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := sm.entityManager.Get(ctx, sm.getResourceURI(name))
 	if res != nil {
@@ -194,7 +231,7 @@ func (sm *SubscriptionManager) Get(ctx context.Context, name string) (*Subscript
 		if isEmptyFeed(b) {
 			return nil, nil
 		}
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
 	return subscriptionEntryToEntity(&entry), nil
 }
@@ -276,3 +313,36 @@ func SubscriptionWithMessageTimeToLive(window *time.Duration) SubscriptionManage
 		return nil
 	}
 }
+
+// SubscriptionWithCorrelationFilter creates the subscription with a $Default rule which selects only the messages with
+// the label, correlation ID and user properties, rather than all messages, so that the subscription never receives
+// messages it was not meant for. Empty label or correlationID values are not matched on. The rule is only applied when
+// the subscription is created; use ReplaceDefaultRule to change the rule of an existing subscription.
+func SubscriptionWithCorrelationFilter(label, correlationID string, userProps map[string]interface{}) SubscriptionManagementOption {
+	return func(s *SubscriptionDescription) error {
+		var opts []CorrelationFilterOption
+		if label != "" {
+			opts = append(opts, CorrelationFilterWithLabel(label))
+		}
+		if correlationID != "" {
+			opts = append(opts, CorrelationFilterWithCorrelationID(correlationID))
+		}
+		for key, value := range userProps {
+			opts = append(opts, CorrelationFilterWithProperty(key, value))
+		}
+		if len(opts) == 0 {
+			return errors.New("a correlation filter needs a label, correlation ID or user property to match")
+		}
+
+		filter, err := NewCorrelationFilter(opts...)
+		if err != nil {
+			return err
+		}
+		s.DefaultRuleDescription = &DefaultRuleDescription{
+			Filter: filter.ToFilterDescription(),
+			Action: &ActionDescription{Type: emptyRuleActionType},
+			Name:   DefaultRuleName,
+		}
+		return nil
+	}
+}
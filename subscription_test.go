@@ -25,6 +25,7 @@ package servicebus
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -66,6 +67,67 @@ const (
 	</entry>`
 )
 
+func TestNamespace_NewSubscription(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sub, err := ns.NewSubscription("topic", "sub",
+		SubscriptionWithReceiveAndDelete(),
+		SubscriptionWithPrefetchCount(50),
+		SubscriptionWithAutoLockRenewal(5*time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "topic", sub.Topic.Name)
+	assert.Equal(t, "topic/Subscriptions/sub", sub.entityPath())
+	assert.Equal(t, ReceiveAndDeleteMode, sub.receiveMode)
+
+	r := &receiver{namespace: ns, prefetch: 1}
+	for _, opt := range sub.receiverOptions() {
+		assert.NoError(t, opt(r))
+	}
+	assert.Equal(t, uint32(50), r.prefetch)
+	assert.Equal(t, 5*time.Minute, r.lockRenewal)
+	assert.NotNil(t, r.renewLocks)
+
+	_, err = ns.NewSubscription("topic", "sub", SubscriptionWithPrefetchCount(0))
+	assert.Error(t, err)
+	_, err = ns.NewSubscription("topic", "sub", SubscriptionWithAutoLockRenewal(0))
+	assert.Error(t, err)
+}
+
+func TestQueue_ReceiverOptionsParity(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := ns.NewQueue("foo", QueueWithPrefetchCount(20), QueueWithAutoLockRenewal(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r := &receiver{namespace: ns, prefetch: 1}
+	for _, opt := range q.receiverOptions() {
+		assert.NoError(t, opt(r))
+	}
+	assert.Equal(t, uint32(20), r.prefetch)
+	assert.Equal(t, time.Minute, r.lockRenewal)
+
+	defaults, err := ns.NewQueue("foo")
+	if !assert.NoError(t, err) {
+		return
+	}
+	r = &receiver{namespace: ns, prefetch: 1}
+	for _, opt := range defaults.receiverOptions() {
+		assert.NoError(t, opt(r))
+	}
+	assert.Equal(t, uint32(1), r.prefetch)
+	assert.Zero(t, r.lockRenewal)
+}
+
 func (suite *serviceBusSuite) TestSubscriptionEntryUnmarshal() {
 	var entry subscriptionEntry
 	err := xml.Unmarshal([]byte(subscriptionEntryContent), &entry)
@@ -148,6 +210,7 @@ func (suite *serviceBusSuite) TestSubscriptionManagement() {
 		"TestSubscriptionWithMessageTimeToLive":                testSubscriptionWithMessageTimeToLive,
 		"TestSubscriptionWithLockDuration":                     testSubscriptionWithLockDuration,
 		"TestSubscriptionWithBatchedOperations":                testSubscriptionWithBatchedOperations,
+		"TestSubscriptionWithCorrelationFilter":                testSubscriptionWithCorrelationFilter,
 	}
 
 	ns := suite.getNewSasInstance()
@@ -222,6 +285,21 @@ func testSubscriptionWithLockDuration(ctx context.Context, t *testing.T, sm *Sub
 	assert.Equal(t, "PT3M", *s.LockDuration)
 }
 
+func testSubscriptionWithCorrelationFilter(ctx context.Context, t *testing.T, sm *SubscriptionManager, _, name string) {
+	buildSubscription(ctx, t, sm, name, SubscriptionWithCorrelationFilter("order", "", map[string]interface{}{"region": "emea"}))
+	rules, err := sm.ListRules(ctx, name)
+	if assert.NoError(t, err) && assert.Len(t, rules, 1) {
+		assert.Equal(t, DefaultRuleName, rules[0].Name)
+		filter := rules[0].Filter
+		assert.Equal(t, correlationFilterType, filter.Type)
+		if assert.NotNil(t, filter.Label) {
+			assert.Equal(t, "order", *filter.Label)
+		}
+		assert.Nil(t, filter.CorrelationID)
+		assert.Equal(t, "emea", filter.Properties["region"])
+	}
+}
+
 func buildSubscription(ctx context.Context, t *testing.T, sm *SubscriptionManager, name string, opts ...SubscriptionManagementOption) *SubscriptionEntity {
 	_, err := sm.Put(ctx, name, opts...)
 	if err != nil {
@@ -239,6 +317,7 @@ func (suite *serviceBusSuite) TestSubscriptionClient() {
 	tests := map[string]func(context.Context, *testing.T, *Topic, *Subscription){
 		"SimpleReceive": testSubscriptionReceive,
 		"ReceiveOne":    testSubscriptionReceiveOne,
+		"PurgeDLQ":      testSubscriptionPurgeDeadLetters,
 	}
 
 	ns := suite.getNewSasInstance()
@@ -290,6 +369,25 @@ func testSubscriptionReceiveOne(ctx context.Context, t *testing.T, topic *Topic,
 	}
 }
 
+func testSubscriptionPurgeDeadLetters(ctx context.Context, t *testing.T, topic *Topic, sub *Subscription) {
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, topic.Send(ctx, NewMessageFromString("poison"))) {
+			return
+		}
+		assert.NoError(t, sub.ReceiveOne(ctx, HandlerFunc(func(ctx context.Context, msg *Message) DispositionAction {
+			return msg.DeadLetter(errors.New("poison message"))
+		})))
+	}
+
+	purged, err := sub.PurgeDeadLetters(ctx, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	count, err := sub.DeadLetterCount(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
+
 func makeSubscription(ctx context.Context, t *testing.T, topic *Topic, name string, opts ...SubscriptionManagementOption) func() {
 	sm := topic.NewSubscriptionManager()
 	entity, err := sm.Get(ctx, name)
@@ -328,3 +426,26 @@ func checkZeroSubscriptionMessages(ctx context.Context, t *testing.T, topic *Top
 
 	assert.Fail(t, "message count never reached zero")
 }
+
+func TestSubscriptionWithCorrelationFilter(t *testing.T) {
+	sd := new(SubscriptionDescription)
+	err := SubscriptionWithCorrelationFilter("order", "abc", map[string]interface{}{"priority": 2})(sd)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	b, err := xml.Marshal(sd)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := string(b)
+	assert.Contains(t, body, `<DefaultRuleDescription><Filter`)
+	assert.Contains(t, body, `type="CorrelationFilter"`)
+	assert.Contains(t, body, `<CorrelationId>abc</CorrelationId><Label>order</Label>`)
+	assert.Contains(t, body, `<Key>priority</Key>`)
+	assert.Contains(t, body, `type="EmptyRuleAction"`)
+	assert.Contains(t, body, `<Name>$Default</Name></DefaultRuleDescription>`)
+
+	assert.Error(t, SubscriptionWithCorrelationFilter("", "", nil)(new(SubscriptionDescription)))
+	assert.Error(t, SubscriptionWithCorrelationFilter("", "", map[string]interface{}{"bad": []int{1}})(new(SubscriptionDescription)))
+}
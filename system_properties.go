@@ -0,0 +1,115 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"pack.ag/amqp"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// decodeSystemProperties decodes the message annotations set by the broker, tolerating the differing integer widths
+// and timestamp encodings used by the producers of other SDKs
+func decodeSystemProperties(annotations amqp.Annotations, sp **SystemProperties) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(timeDecodeHook, integerDecodeHook),
+		Result:     sp,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(annotations)
+}
+
+// timeDecodeHook decodes timestamps sent as milliseconds since the Unix epoch, or as RFC 3339 strings, into time.Time
+func timeDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != timeType {
+		return data, nil
+	}
+
+	value := reflect.ValueOf(data)
+	switch from.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return time.Unix(0, value.Int()*int64(time.Millisecond)).UTC(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return time.Unix(0, int64(value.Uint())*int64(time.Millisecond)).UTC(), nil
+	case reflect.String:
+		return time.Parse(time.RFC3339Nano, value.String())
+	default:
+		return data, nil
+	}
+}
+
+// integerDecodeHook converts integers of any width or signedness, and decimal strings, to the integer type expected,
+// failing rather than truncating values which do not fit
+func integerDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	target := reflect.New(to).Elem()
+	switch to.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return data, nil
+	}
+
+	value := reflect.ValueOf(data)
+	var n int64
+	var u uint64
+	negative := false
+	switch from.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = value.Int()
+		negative = n < 0
+		u = uint64(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u = value.Uint()
+		n = int64(u)
+	case reflect.String:
+		parsed, err := strconv.ParseInt(value.String(), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		n, u, negative = parsed, uint64(parsed), parsed < 0
+	default:
+		return data, nil
+	}
+
+	switch to.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if (!negative && n < 0) || target.OverflowInt(n) {
+			return nil, fmt.Errorf("value %v overflows %v", data, to)
+		}
+		target.SetInt(n)
+	default:
+		if negative || target.OverflowUint(u) {
+			return nil, fmt.Errorf("value %v overflows %v", data, to)
+		}
+		target.SetUint(u)
+	}
+	return target.Interface(), nil
+}
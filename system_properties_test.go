@@ -0,0 +1,53 @@
+package servicebus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pack.ag/amqp"
+)
+
+func TestDecodeSystemProperties_WidensIntegers(t *testing.T) {
+	var sp *SystemProperties
+	err := decodeSystemProperties(amqp.Annotations{
+		"x-opt-sequence-number":         int32(42),
+		"x-opt-enqueue-sequence-number": uint32(7),
+		"x-opt-partition-id":            int64(3),
+	}, &sp)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 42, *sp.SequenceNumber)
+		assert.EqualValues(t, 7, *sp.EnqueuedSequenceNumber)
+		assert.EqualValues(t, 3, *sp.PartitionID)
+	}
+
+	sp = nil
+	err = decodeSystemProperties(amqp.Annotations{"x-opt-sequence-number": "1234"}, &sp)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 1234, *sp.SequenceNumber)
+	}
+
+	sp = nil
+	assert.Error(t, decodeSystemProperties(amqp.Annotations{"x-opt-partition-id": int64(1 << 20)}, &sp),
+		"values which do not fit are rejected rather than truncated")
+	sp = nil
+	assert.Error(t, decodeSystemProperties(amqp.Annotations{"x-opt-sequence-number": uint64(1 << 63)}, &sp))
+}
+
+func TestDecodeSystemProperties_ConvertsTimes(t *testing.T) {
+	enqueued := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	var sp *SystemProperties
+	err := decodeSystemProperties(amqp.Annotations{
+		"x-opt-enqueued-time":          enqueued,
+		"x-opt-locked-until":           enqueued.UnixNano() / int64(time.Millisecond),
+		"x-opt-scheduled-enqueue-time": enqueued.Format(time.RFC3339Nano),
+	}, &sp)
+	if assert.NoError(t, err) {
+		assert.True(t, enqueued.Equal(*sp.EnqueuedTime))
+		assert.True(t, enqueued.Equal(*sp.LockedUntil))
+		assert.True(t, enqueued.Equal(*sp.ScheduledEnqueueTime))
+	}
+
+	sp = nil
+	assert.Error(t, decodeSystemProperties(amqp.Annotations{"x-opt-locked-until": "tomorrow"}, &sp))
+}
@@ -0,0 +1,79 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+	"github.com/Azure/azure-amqp-common-go/uuid"
+)
+
+const defaultTemporaryQueuePrefix = "tmp"
+
+// NewTemporaryQueue provisions a uniquely named queue which Service Bus deletes once it has been idle for
+// autoDeleteOnIdle, and returns it along with its path. The path can be handed to other parties, for example as the
+// ReplyTo of a request, making temporary queues well suited to RPC reply channels and to isolating tests. The name
+// starts with prefix, or "tmp" if prefix is empty, and autoDeleteOnIdle must be at least 5 minutes.
+func (ns *Namespace) NewTemporaryQueue(ctx context.Context, prefix string, autoDeleteOnIdle time.Duration, opts ...QueueOption) (*Queue, string, error) {
+	span, ctx := ns.startSpanFromContext(ctx, "sb.Namespace.NewTemporaryQueue")
+	defer span.End()
+
+	autoDelete := QueueEntityWithAutoDeleteOnIdle(&autoDeleteOnIdle)
+	if err := autoDelete(new(QueueDescription)); err != nil {
+		return nil, "", err
+	}
+
+	name, err := temporaryQueueName(prefix)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, "", err
+	}
+
+	if _, err := ns.NewQueueManager().Put(ctx, name, autoDelete); err != nil {
+		log.For(ctx).Error(err)
+		return nil, "", err
+	}
+
+	q, err := ns.NewQueue(name, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return q, name, nil
+}
+
+// temporaryQueueName is the prefix followed by a random suffix
+func temporaryQueueName(prefix string) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	prefix = strings.TrimRight(prefix, "-")
+	if prefix == "" {
+		prefix = defaultTemporaryQueuePrefix
+	}
+	return prefix + "-" + id.String(), nil
+}
@@ -0,0 +1,40 @@
+package servicebus
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemporaryQueueName(t *testing.T) {
+	name, err := temporaryQueueName("replies-")
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(name, "replies-"), name)
+		assert.Len(t, name, len("replies-")+36)
+	}
+
+	other, err := temporaryQueueName("replies")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, name, other)
+	}
+
+	name, err = temporaryQueueName("")
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(name, "tmp-"), name)
+	}
+}
+
+func TestNamespace_NewTemporaryQueueRejectsShortIdleWindow(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, path, err := ns.NewTemporaryQueue(context.Background(), "replies", time.Minute)
+	assert.Error(t, err)
+	assert.Nil(t, q)
+	assert.Empty(t, path)
+}
@@ -0,0 +1,88 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+)
+
+type (
+	// TokenProviderFactory returns the TokenProvider holding the credentials for an entity, such as "myqueue" or
+	// "mytopic/Subscriptions/mysubscription". Returning nil falls back to the TokenProvider of the Namespace.
+	TokenProviderFactory func(entityPath string) auth.TokenProvider
+
+	// tokenRouter resolves the TokenProvider of each entity through a TokenProviderFactory, calling the factory once per
+	// entity
+	tokenRouter struct {
+		factory   TokenProviderFactory
+		mu        sync.Mutex
+		providers map[string]auth.TokenProvider
+	}
+)
+
+// NamespaceWithTokenProviderFactory configures a namespace to authorize each entity with the TokenProvider the factory
+// returns for it, so a single process serving many tenants can present different credentials per entity. Every link
+// negotiates its own claim, so entities with different credentials can be used side by side. Management operations,
+// which are not bound to an entity, keep using the TokenProvider of the Namespace.
+func NamespaceWithTokenProviderFactory(factory TokenProviderFactory) NamespaceOption {
+	return func(ns *Namespace) error {
+		if factory == nil {
+			return errors.New("token provider factory must not be nil")
+		}
+		ns.tokenRouter = &tokenRouter{
+			factory:   factory,
+			providers: make(map[string]auth.TokenProvider),
+		}
+		return nil
+	}
+}
+
+// tokenProviderFor returns the TokenProvider to negotiate claims for the address, which is an entity path or the
+// management address of an entity
+func (ns *Namespace) tokenProviderFor(address string) auth.TokenProvider {
+	if ns.tokenRouter == nil {
+		return ns.TokenProvider
+	}
+
+	entityPath := strings.TrimSuffix(address, "/$management")
+	if provider := ns.tokenRouter.providerFor(entityPath); provider != nil {
+		return provider
+	}
+	return ns.TokenProvider
+}
+
+func (tr *tokenRouter) providerFor(entityPath string) auth.TokenProvider {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if provider, ok := tr.providers[entityPath]; ok {
+		return provider
+	}
+	provider := tr.factory(entityPath)
+	tr.providers[entityPath] = provider
+	return provider
+}
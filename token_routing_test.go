@@ -0,0 +1,53 @@
+package servicebus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticTokenProvider string
+
+func (p staticTokenProvider) GetToken(audience string) (*auth.Token, error) {
+	return auth.NewToken(auth.CBSTokenTypeSAS, string(p), "0"), nil
+}
+
+func TestNamespaceWithTokenProviderFactory(t *testing.T) {
+	calls := map[string]int{}
+	factory := func(entityPath string) auth.TokenProvider {
+		calls[entityPath]++
+		if strings.HasPrefix(entityPath, "tenant-a") {
+			return staticTokenProvider("a")
+		}
+		return nil
+	}
+
+	ns, err := NewNamespace(NamespaceWithTokenProvider(staticTokenProvider("default")), NamespaceWithTokenProviderFactory(factory))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, staticTokenProvider("a"), ns.tokenProviderFor("tenant-a-orders"))
+	assert.Equal(t, staticTokenProvider("a"), ns.tokenProviderFor("tenant-a-orders/$management"))
+	assert.Equal(t, staticTokenProvider("a"), ns.tokenProviderFor("tenant-a-events/Subscriptions/audit"))
+	assert.Equal(t, staticTokenProvider("default"), ns.tokenProviderFor("tenant-b-orders"))
+	assert.Equal(t, staticTokenProvider("default"), ns.tokenProviderFor("tenant-b-orders"))
+
+	assert.Equal(t, map[string]int{
+		"tenant-a-orders":                     1,
+		"tenant-a-events/Subscriptions/audit": 1,
+		"tenant-b-orders":                     1,
+	}, calls)
+
+	_, err = NewNamespace(NamespaceWithTokenProviderFactory(nil))
+	assert.Error(t, err)
+}
+
+func TestNamespace_TokenProviderForWithoutFactory(t *testing.T) {
+	ns, err := NewNamespace(NamespaceWithTokenProvider(staticTokenProvider("default")))
+	if assert.NoError(t, err) {
+		assert.Equal(t, staticTokenProvider("default"), ns.tokenProviderFor("anything"))
+	}
+}
@@ -43,11 +43,17 @@ type (
 	// Messages are received from a subscription identically to the way they are received from a queue.
 	Topic struct {
 		*entity
-		sender   *sender
-		senderMu sync.Mutex
+		sender      *sender
+		senderMu    sync.Mutex
+		sendLimiter *rateLimiter
+		schemas     *SchemaEncoder
+
+		senderLinkOptions []SenderLinkOption
+		pending           pendingSends
 	}
 
-	// TopicDescription is the content type for Topic management requests
+	// TopicDescription is the content type for Topic management requests. It is written in the order of the service's
+	// schema, as the service ignores elements which are out of place.
 	TopicDescription struct {
 		XMLName xml.Name `xml:"TopicDescription"`
 		BaseEntityDescription
@@ -68,14 +74,65 @@ type (
 		EnableSubscriptionPartitioning      *bool         `xml:"EnableSubscriptionPartitioning,omitempty"`
 		EnableExpress                       *bool         `xml:"EnableExpress,omitempty"`
 		CountDetails                        *CountDetails `xml:"CountDetails,omitempty"`
+		// Extensions holds the elements of the description which are not modeled above, so that they survive an Update
+		Extensions []RawXMLElement `xml:",any"`
 	}
 
 	// TopicOption represents named options for assisting Topic message handling
 	TopicOption func(*Topic) error
 )
 
+// topicDescriptionSchema lists the elements of a TopicDescription in the order the service expects them
+var topicDescriptionSchema = []string{
+	"DefaultMessageTimeToLive",
+	"MaxSizeInMegabytes",
+	"RequiresDuplicateDetection",
+	"DuplicateDetectionHistoryTimeWindow",
+	"EnableBatchedOperations",
+	"SizeInBytes",
+	"FilteringMessagesBeforePublishing",
+	"IsAnonymousAccessible",
+	"AuthorizationRules",
+	"Status",
+	"UserMetadata",
+	"CreatedAt",
+	"UpdatedAt",
+	"AccessedAt",
+	"SupportOrdering",
+	"CountDetails",
+	"SubscriptionCount",
+	"AutoDeleteOnIdle",
+	"EnablePartitioning",
+	"IsExpress",
+	"EntityAvailabilityStatus",
+	"EnableSubscriptionPartitioning",
+	"EnableExpress",
+	"MaxMessageSizeInKilobytes",
+}
+
+// MarshalXML writes the description with its Extensions back in their place among the modeled elements
+func (td TopicDescription) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalInSchemaOrder(e, start, td.BaseEntityDescription, td, td.Extensions, topicDescriptionSchema)
+}
+
 // NewTopic creates a new Topic Sender
 func (ns *Namespace) NewTopic(name string, opts ...TopicOption) (*Topic, error) {
+	topic, err := ns.newTopic(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.children.track(topic)
+	return topic, nil
+}
+
+// newTopic creates a Topic which Namespace.Close does not close, as the parent of a Subscription or
+// SubscriptionManager which has no need of its sender
+func (ns *Namespace) newTopic(name string, opts ...TopicOption) (*Topic, error) {
+	if err := ns.checkEntityPath(name); err != nil {
+		return nil, err
+	}
+
 	topic := &Topic{
 		entity: &entity{
 			namespace: ns,
@@ -95,7 +152,16 @@ func (ns *Namespace) NewTopic(name string, opts ...TopicOption) (*Topic, error)
 // Send sends messages to the Topic
 func (t *Topic) Send(ctx context.Context, event *Message, opts ...SendOption) error {
 	span, ctx := t.startSpanFromContext(ctx, "sb.Topic.Send")
-	defer span.Finish()
+	defer span.End()
+	defer t.pending.add(1)()
+
+	if err := t.schemas.validate(ctx, event); err != nil {
+		return err
+	}
+
+	if err := t.sendLimiter.wait(ctx, 1); err != nil {
+		return err
+	}
 
 	err := t.ensureSender(ctx)
 	if err != nil {
@@ -108,7 +174,9 @@ func (t *Topic) Send(ctx context.Context, event *Message, opts ...SendOption) er
 // Close the underlying connection to Service Bus
 func (t *Topic) Close(ctx context.Context) error {
 	span, ctx := t.startSpanFromContext(ctx, "sb.Topic.Close")
-	defer span.Finish()
+	defer span.End()
+
+	t.namespace.children.untrack(t)
 
 	if t.sender != nil {
 		return t.sender.Close(ctx)
@@ -119,13 +187,13 @@ func (t *Topic) Close(ctx context.Context) error {
 
 func (t *Topic) ensureSender(ctx context.Context) error {
 	span, ctx := t.startSpanFromContext(ctx, "sb.Topic.ensureSender")
-	defer span.Finish()
+	defer span.End()
 
 	t.senderMu.Lock()
 	defer t.senderMu.Unlock()
 
 	if t.sender == nil {
-		s, err := t.namespace.newSender(ctx, t.Name)
+		s, err := t.namespace.newSender(ctx, t.Name, withSenderLinkOptions(t.senderLinkOptions)...)
 		if err != nil {
 			log.For(ctx).Error(err)
 			return err
@@ -17,6 +17,7 @@ type (
 	// TopicManager provides CRUD functionality for Service Bus Topics
 	TopicManager struct {
 		*entityManager
+		cache *entityCache
 	}
 
 	// TopicEntity is the Azure Service Bus description of a Topic for management activities
@@ -51,27 +52,33 @@ type (
 // NewTopicManager creates a new TopicManager for a Service Bus Namespace
 func (ns *Namespace) NewTopicManager() *TopicManager {
 	return &TopicManager{
-		entityManager: newEntityManager(ns.getHTTPSHostURI(), ns.TokenProvider),
+		entityManager: ns.newEntityManager(),
+		cache:         ns.managementCache,
 	}
 }
 
 // Delete deletes a Service Bus Topic entity by name
 func (tm *TopicManager) Delete(ctx context.Context, name string) error {
 	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.Delete")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := tm.entityManager.Delete(ctx, "/"+name)
+	tm.Invalidate(name)
 	if res != nil {
 		defer res.Body.Close()
 	}
 
-	return err
+	if err != nil {
+		log.For(ctx).Error(err)
+		return err
+	}
+	return checkDeleteResponse(res)
 }
 
 // Put creates or updates a Service Bus Topic
 func (tm *TopicManager) Put(ctx context.Context, name string, opts ...TopicManagementOption) (*TopicEntity, error) {
 	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.Put")
-	defer span.Finish()
+	defer span.End()
 
 	td := new(TopicDescription)
 	for _, opt := range opts {
@@ -81,6 +88,34 @@ func (tm *TopicManager) Put(ctx context.Context, name string, opts ...TopicManag
 		}
 	}
 
+	return tm.put(ctx, name, td)
+}
+
+// Update applies the options to the description of an existing topic, as returned by Get or List, and writes it back.
+// Properties of the description which are not modeled by TopicDescription are preserved in its Extensions and sent
+// back unchanged.
+func (tm *TopicManager) Update(ctx context.Context, te *TopicEntity, opts ...TopicManagementOption) (*TopicEntity, error) {
+	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.Update")
+	defer span.End()
+
+	if te == nil || te.TopicDescription == nil {
+		return nil, errors.New("topic entity must have a description to update")
+	}
+
+	td := *te.TopicDescription
+	for _, opt := range opts {
+		if err := opt(&td); err != nil {
+			log.For(ctx).Error(err)
+			return nil, err
+		}
+	}
+
+	// extensions may use the instance prefix of the original document, so it must be declared
+	td.InstanceMetadataSchema = to.StringPtr(xmlSchemaInstance)
+	return tm.put(ctx, te.Name, &td, atom.IfMatch("*"))
+}
+
+func (tm *TopicManager) put(ctx context.Context, name string, td *TopicDescription, opts ...atom.RequestOption) (*TopicEntity, error) {
 	td.ServiceBusSchema = to.StringPtr(serviceBusSchema)
 
 	qe := &topicEntry{
@@ -100,7 +135,7 @@ func (tm *TopicManager) Put(ctx context.Context, name string, opts ...TopicManag
 	}
 
 	reqBytes = xmlDoc(reqBytes)
-	res, err := tm.entityManager.Put(ctx, "/"+name, reqBytes)
+	res, err := tm.entityManager.Put(ctx, "/"+name, reqBytes, opts...)
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -119,15 +154,17 @@ func (tm *TopicManager) Put(ctx context.Context, name string, opts ...TopicManag
 	var entry topicEntry
 	err = xml.Unmarshal(b, &entry)
 	if err != nil {
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
-	return topicEntryToEntity(&entry), nil
+	entity := topicEntryToEntity(&entry)
+	tm.cacheTopic(name, entity)
+	return entity, nil
 }
 
 // List fetches all of the Topics for a Service Bus Namespace
 func (tm *TopicManager) List(ctx context.Context) ([]*TopicEntity, error) {
 	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.List")
-	defer span.Finish()
+	defer span.End()
 
 	res, err := tm.entityManager.Get(ctx, `/$Resources/Topics`)
 	if res != nil {
@@ -148,12 +185,13 @@ func (tm *TopicManager) List(ctx context.Context) ([]*TopicEntity, error) {
 	var feed topicFeed
 	err = xml.Unmarshal(b, &feed)
 	if err != nil {
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
 
 	topics := make([]*TopicEntity, len(feed.Entries))
 	for idx, entry := range feed.Entries {
 		topics[idx] = topicEntryToEntity(&entry)
+		tm.cacheTopic(topics[idx].Name, topics[idx])
 	}
 	return topics, nil
 }
@@ -161,7 +199,11 @@ func (tm *TopicManager) List(ctx context.Context) ([]*TopicEntity, error) {
 // Get fetches a Service Bus Topic entity by name
 func (tm *TopicManager) Get(ctx context.Context, name string) (*TopicEntity, error) {
 	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.Get")
-	defer span.Finish()
+	defer span.End()
+
+	if cached, ok := tm.cachedTopic(name); ok {
+		return cached, nil
+	}
 
 	res, err := tm.entityManager.Get(ctx, name)
 	if res != nil {
@@ -189,9 +231,11 @@ func (tm *TopicManager) Get(ctx context.Context, name string) (*TopicEntity, err
 		if isEmptyFeed(b) {
 			return nil, nil
 		}
-		return nil, formatManagementError(b)
+		return nil, formatManagementError(res, b)
 	}
-	return topicEntryToEntity(&entry), nil
+	entity := topicEntryToEntity(&entry)
+	tm.cacheTopic(name, entity)
+	return entity, nil
 }
 
 func topicEntryToEntity(entry *topicEntry) *TopicEntity {
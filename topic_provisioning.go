@@ -0,0 +1,240 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+
+	"github.com/Azure/azure-service-bus-go/atom"
+)
+
+const (
+	// rollbackTimeout bounds how long PutWithSubscriptions spends deleting what it created once it has failed
+	rollbackTimeout = time.Minute
+)
+
+type (
+	// TopicDefinition describes a Topic for TopicManager.PutWithSubscriptions to create
+	TopicDefinition struct {
+		Name    string
+		Options []TopicManagementOption
+	}
+
+	// SubscriptionDefinition describes a Subscription for TopicManager.PutWithSubscriptions to create, along with the
+	// rules which select the messages it receives
+	SubscriptionDefinition struct {
+		Name    string
+		Options []SubscriptionManagementOption
+		Rules   []RuleDefinition
+	}
+
+	// RuleDefinition describes a rule of a Subscription. Action may be nil.
+	RuleDefinition struct {
+		Name   string
+		Filter FilterDescriber
+		Action ActionDescriber
+	}
+
+	// topologyRollback records the entities PutWithSubscriptions created, so they can be deleted if a later step fails
+	topologyRollback struct {
+		topic         string
+		subscriptions []string
+		rules         []createdRule
+	}
+
+	createdRule struct {
+		subscription string
+		name         string
+	}
+)
+
+// PutWithSubscriptions creates the Topic and each of the Subscriptions along with their rules in a single call, for
+// example to set up the topology an application needs as part of its deployment. It can be run again safely: a Topic or
+// Subscription which already exists is left as it is, and rules are created or updated to match their definitions. A
+// Subscription defined with rules, none of which is the $Default rule, has its $Default rule removed so that it only
+// receives the messages its rules select.
+//
+// If any step fails, the Topic, Subscriptions and rules created by the call are deleted again before the error is
+// returned, leaving the namespace as it was found. Rules which existed before the call and were updated, and $Default
+// rules removed before a failure, are not restored; $Default rules are removed after every other step has succeeded.
+func (tm *TopicManager) PutWithSubscriptions(ctx context.Context, topic TopicDefinition, subscriptions ...SubscriptionDefinition) (*TopicTopology, error) {
+	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.PutWithSubscriptions")
+	defer span.End()
+
+	if err := validateTopology(topic, subscriptions); err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	sm := &SubscriptionManager{
+		entityManager: tm.entityManager,
+		Topic:         &Topic{entity: &entity{Name: topic.Name, namespace: tm.namespace}},
+	}
+	rollback := new(topologyRollback)
+	topology, err := tm.putTopology(ctx, sm, rollback, topic, subscriptions)
+	if err != nil {
+		log.For(ctx).Error(err)
+		rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		rollback.run(rollbackCtx, tm, sm)
+		return nil, err
+	}
+	return topology, nil
+}
+
+func (tm *TopicManager) putTopology(ctx context.Context, sm *SubscriptionManager, rollback *topologyRollback, topic TopicDefinition, subscriptions []SubscriptionDefinition) (*TopicTopology, error) {
+	te, err := tm.Get(ctx, topic.Name)
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		if te, err = tm.Put(ctx, topic.Name, topic.Options...); err != nil {
+			return nil, err
+		}
+		rollback.topic = topic.Name
+	}
+
+	topology := &TopicTopology{TopicEntity: te}
+	var replaceDefault []string
+	for _, def := range subscriptions {
+		se, err := sm.Get(ctx, def.Name)
+		if err != nil {
+			return nil, err
+		}
+		if se == nil {
+			if se, err = sm.Put(ctx, def.Name, def.Options...); err != nil {
+				return nil, err
+			}
+			rollback.subscriptions = append(rollback.subscriptions, def.Name)
+		}
+
+		if err := sm.putRules(ctx, rollback, def); err != nil {
+			return nil, err
+		}
+		if len(def.Rules) > 0 && !hasRule(def.Rules, DefaultRuleName) {
+			replaceDefault = append(replaceDefault, def.Name)
+		}
+		topology.Subscriptions = append(topology.Subscriptions, se)
+	}
+
+	// the $Default rules are removed last, as they cannot be restored if a later step fails
+	for _, name := range replaceDefault {
+		if err := sm.DeleteRule(ctx, name, DefaultRuleName); err != nil {
+			return nil, err
+		}
+	}
+	return topology, nil
+}
+
+// putRules creates or updates each rule of the subscription
+func (sm *SubscriptionManager) putRules(ctx context.Context, rollback *topologyRollback, def SubscriptionDefinition) error {
+	for _, rule := range def.Rules {
+		if rule.Name == DefaultRuleName {
+			if _, err := sm.ReplaceDefaultRule(ctx, def.Name, rule.Filter, rule.Action); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err := sm.putRule(ctx, def.Name, rule.Name, rule.Filter, rule.Action)
+		if mgmtErr, ok := err.(*atom.ManagementError); ok && mgmtErr.Code == http.StatusConflict {
+			_, err = sm.putRule(ctx, def.Name, rule.Name, rule.Filter, rule.Action, atom.IfMatch("*"))
+		} else if err == nil {
+			rollback.rules = append(rollback.rules, createdRule{subscription: def.Name, name: rule.Name})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasRule(rules []RuleDefinition, name string) bool {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// run deletes the entities created so far, most recent first. Failures are logged rather than returned, so that the
+// error which caused the rollback is the one reported.
+func (r *topologyRollback) run(ctx context.Context, tm *TopicManager, sm *SubscriptionManager) {
+	if r.topic != "" {
+		// deleting the topic deletes its subscriptions and their rules
+		if err := tm.Delete(ctx, r.topic); err != nil {
+			log.For(ctx).Error(err)
+		}
+		return
+	}
+
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		if err := sm.DeleteRule(ctx, r.rules[i].subscription, r.rules[i].name); err != nil {
+			log.For(ctx).Error(err)
+		}
+	}
+	for i := len(r.subscriptions) - 1; i >= 0; i-- {
+		if err := sm.Delete(ctx, r.subscriptions[i]); err != nil {
+			log.For(ctx).Error(err)
+		}
+	}
+}
+
+func validateTopology(topic TopicDefinition, subscriptions []SubscriptionDefinition) error {
+	if topic.Name == "" {
+		return errors.New("topic name must not be empty")
+	}
+
+	seen := make(map[string]bool, len(subscriptions))
+	for _, def := range subscriptions {
+		if def.Name == "" {
+			return errors.New("subscription name must not be empty")
+		}
+		if seen[def.Name] {
+			return fmt.Errorf("subscription %q is defined more than once", def.Name)
+		}
+		seen[def.Name] = true
+
+		rules := make(map[string]bool, len(def.Rules))
+		for _, rule := range def.Rules {
+			if rule.Name == "" {
+				return fmt.Errorf("subscription %q has a rule without a name", def.Name)
+			}
+			if rule.Filter == nil {
+				return fmt.Errorf("rule %q of subscription %q has no filter", rule.Name, def.Name)
+			}
+			if rules[rule.Name] {
+				return fmt.Errorf("rule %q of subscription %q is defined more than once", rule.Name, def.Name)
+			}
+			rules[rule.Name] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package servicebus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// topologyServer is an in-memory stand-in for the management API of a namespace, tracking which topics,
+	// subscriptions and rules exist by their path
+	topologyServer struct {
+		mu       sync.Mutex
+		entities map[string]bool
+		failPut  string
+		puts     []string
+	}
+)
+
+func newTopologyServer(existing ...string) *topologyServer {
+	ts := &topologyServer{entities: make(map[string]bool)}
+	for _, path := range existing {
+		ts.entities[path] = true
+	}
+	return ts
+}
+
+func (ts *topologyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	path := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		if !ts.entities[path] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case http.MethodPut:
+		ts.puts = append(ts.puts, path)
+		if path == ts.failPut {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`<Error><Code>400</Code><Detail>Invalid filter. TrackingId:abc</Detail></Error>`))
+			return
+		}
+		if ts.entities[path] && r.Header.Get("If-Match") == "" {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`<Error><Code>409</Code><Detail>Entity already exists. TrackingId:abc</Detail></Error>`))
+			return
+		}
+		ts.entities[path] = true
+		if strings.Count(path, "/") == 3 {
+			// new subscriptions come with a $Default rule accepting every message
+			ts.entities[path+"/rules/"+DefaultRuleName] = true
+		}
+	case http.MethodDelete:
+		if !ts.entities[path] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for existing := range ts.entities {
+			if existing == path || strings.HasPrefix(existing, path+"/") {
+				delete(ts.entities, existing)
+			}
+		}
+		return
+	}
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	var description string
+	switch strings.Count(path, "/") {
+	case 1:
+		description = `<TopicDescription></TopicDescription>`
+	case 3:
+		description = `<SubscriptionDescription></SubscriptionDescription>`
+	default:
+		description = `<RuleDescription></RuleDescription>`
+	}
+	_, _ = w.Write([]byte(atomEntry(name, description)))
+}
+
+func (ts *topologyServer) paths() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var paths []string
+	for path := range ts.entities {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func newTopologyTopicManager(ts *topologyServer) (*TopicManager, func()) {
+	server := httptest.NewServer(ts)
+	tm := &TopicManager{entityManager: newEntityManager(server.URL+"/", staticTokenProvider("token"))}
+	return tm, server.Close
+}
+
+func orderTopology() (TopicDefinition, []SubscriptionDefinition) {
+	return TopicDefinition{Name: "orders", Options: []TopicManagementOption{TopicWithPartitioning()}},
+		[]SubscriptionDefinition{
+			{Name: "everything"},
+			{Name: "large", Rules: []RuleDefinition{
+				{Name: "over-100", Filter: SQLFilter{Expression: "total > 100"}},
+			}},
+		}
+}
+
+func TestTopicManager_PutWithSubscriptions(t *testing.T) {
+	ts := newTopologyServer()
+	tm, closeServer := newTopologyTopicManager(ts)
+	defer closeServer()
+
+	topic, subs := orderTopology()
+	topology, err := tm.PutWithSubscriptions(context.Background(), topic, subs...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "orders", topology.Name)
+	if assert.Len(t, topology.Subscriptions, 2) {
+		assert.Equal(t, "everything", topology.Subscriptions[0].Name)
+		assert.Equal(t, "large", topology.Subscriptions[1].Name)
+	}
+
+	expected := []string{
+		"/orders",
+		"/orders/subscriptions/everything",
+		"/orders/subscriptions/everything/rules/$Default",
+		"/orders/subscriptions/large",
+		"/orders/subscriptions/large/rules/over-100",
+	}
+	assert.Equal(t, expected, ts.paths(), "the $Default rule of a subscription with rules is removed")
+
+	// running it again changes nothing, only updating the rules in place
+	ts.puts = nil
+	_, err = tm.PutWithSubscriptions(context.Background(), topic, subs...)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, ts.paths())
+	assert.Equal(t, []string{
+		"/orders/subscriptions/large/rules/over-100",
+		"/orders/subscriptions/large/rules/over-100",
+	}, ts.puts, "an existing rule is created, which conflicts, then updated")
+}
+
+func TestTopicManager_PutWithSubscriptionsRollsBackNewTopic(t *testing.T) {
+	ts := newTopologyServer()
+	ts.failPut = "/orders/subscriptions/large/rules/over-100"
+	tm, closeServer := newTopologyTopicManager(ts)
+	defer closeServer()
+
+	topic, subs := orderTopology()
+	_, err := tm.PutWithSubscriptions(context.Background(), topic, subs...)
+	assert.Error(t, err)
+	assert.Empty(t, ts.paths(), "the topic created by the call is deleted along with its subscriptions")
+}
+
+func TestTopicManager_PutWithSubscriptionsRollsBackOnlyWhatItCreated(t *testing.T) {
+	existing := []string{
+		"/orders",
+		"/orders/subscriptions/everything",
+		"/orders/subscriptions/everything/rules/$Default",
+	}
+	ts := newTopologyServer(existing...)
+	ts.failPut = "/orders/subscriptions/large/rules/over-100"
+	tm, closeServer := newTopologyTopicManager(ts)
+	defer closeServer()
+
+	topic, subs := orderTopology()
+	subs[0].Rules = []RuleDefinition{{Name: "eu", Filter: SQLFilter{Expression: "region = 'eu'"}}}
+	_, err := tm.PutWithSubscriptions(context.Background(), topic, subs...)
+	assert.Error(t, err)
+	assert.Equal(t, existing, ts.paths(), "the new rule and subscription are deleted, and the existing $Default rule is kept")
+}
+
+func TestValidateTopology(t *testing.T) {
+	filter := SQLFilter{Expression: "1=1"}
+	for i, c := range []struct {
+		topic TopicDefinition
+		subs  []SubscriptionDefinition
+	}{
+		{topic: TopicDefinition{}},
+		{topic: TopicDefinition{Name: "t"}, subs: []SubscriptionDefinition{{}}},
+		{topic: TopicDefinition{Name: "t"}, subs: []SubscriptionDefinition{{Name: "s"}, {Name: "s"}}},
+		{topic: TopicDefinition{Name: "t"}, subs: []SubscriptionDefinition{{Name: "s", Rules: []RuleDefinition{{Filter: filter}}}}},
+		{topic: TopicDefinition{Name: "t"}, subs: []SubscriptionDefinition{{Name: "s", Rules: []RuleDefinition{{Name: "r"}}}}},
+		{topic: TopicDefinition{Name: "t"}, subs: []SubscriptionDefinition{{Name: "s", Rules: []RuleDefinition{{Name: "r", Filter: filter}, {Name: "r", Filter: filter}}}}},
+	} {
+		assert.Error(t, validateTopology(c.topic, c.subs), fmt.Sprintf("case %d", i))
+	}
+
+	assert.NoError(t, validateTopology(TopicDefinition{Name: "t"}, []SubscriptionDefinition{{Name: "s", Rules: []RuleDefinition{{Name: "r", Filter: filter}}}}))
+}
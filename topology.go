@@ -0,0 +1,169 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const (
+	// managementPageSize is the number of entries requested per page when listing entities
+	managementPageSize = 100
+	// maxConcurrentListings bounds how many subscription listings are requested at once
+	maxConcurrentListings = 8
+)
+
+type (
+	// TopicTopology is a Topic along with all of its Subscriptions. Both carry their runtime message counts in
+	// CountDetails.
+	TopicTopology struct {
+		*TopicEntity
+		Subscriptions []*SubscriptionEntity
+	}
+)
+
+// ListWithSubscriptions fetches every Topic of the namespace along with every one of their Subscriptions, including the
+// message counts of each. Topics and Subscriptions are fetched page by page. The management API has no endpoint listing
+// the Subscriptions of several Topics, so they are listed Topic by Topic, with up to 8 listings in flight at once.
+func (tm *TopicManager) ListWithSubscriptions(ctx context.Context) ([]*TopicTopology, error) {
+	span, ctx := tm.startSpanFromContext(ctx, "sb.TopicManager.ListWithSubscriptions")
+	defer span.End()
+
+	topics, err := tm.listAll(ctx)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	topology := make([]*TopicTopology, len(topics))
+	for i, topic := range topics {
+		topology[i] = &TopicTopology{TopicEntity: topic}
+	}
+
+	work := make(chan *TopicTopology)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < min(maxConcurrentListings, len(topology)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range work {
+				subs, err := tm.listSubscriptions(ctx, t.Name)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				t.Subscriptions = subs
+			}
+		}()
+	}
+
+feed:
+	for _, t := range topology {
+		select {
+		case work <- t:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		log.For(ctx).Error(firstErr)
+		return nil, firstErr
+	}
+	return topology, nil
+}
+
+// listAll fetches every Topic of the namespace, page by page
+func (tm *TopicManager) listAll(ctx context.Context) ([]*TopicEntity, error) {
+	var topics []*TopicEntity
+	for skip := 0; ; skip += managementPageSize {
+		var feed topicFeed
+		if err := tm.getFeedPage(ctx, "/$Resources/Topics", skip, &feed); err != nil {
+			return nil, err
+		}
+		for idx := range feed.Entries {
+			topics = append(topics, topicEntryToEntity(&feed.Entries[idx]))
+		}
+		if len(feed.Entries) < managementPageSize {
+			return topics, nil
+		}
+	}
+}
+
+// listSubscriptions fetches every Subscription of the Topic, page by page
+func (tm *TopicManager) listSubscriptions(ctx context.Context, topicName string) ([]*SubscriptionEntity, error) {
+	var subs []*SubscriptionEntity
+	for skip := 0; ; skip += managementPageSize {
+		var feed subscriptionFeed
+		if err := tm.getFeedPage(ctx, "/"+topicName+"/subscriptions", skip, &feed); err != nil {
+			return nil, err
+		}
+		for idx := range feed.Entries {
+			subs = append(subs, subscriptionEntryToEntity(&feed.Entries[idx]))
+		}
+		if len(feed.Entries) < managementPageSize {
+			return subs, nil
+		}
+	}
+}
+
+// getFeedPage fetches a page of the feed at path into feed
+func (em *entityManager) getFeedPage(ctx context.Context, path string, skip int, feed interface{}) error {
+	res, err := em.Get(ctx, fmt.Sprintf("%s?$skip=%d&$top=%d", path, skip, managementPageSize))
+	if res != nil {
+		defer res.Body.Close()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(b, feed); err != nil {
+		return formatManagementError(res, b)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package topology
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadJSON reads a namespace description from JSON, rejecting unknown fields so that misspelled properties are not
+// silently ignored
+func LoadJSON(r io.Reader) (*Namespace, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var ns Namespace
+	if err := dec.Decode(&ns); err != nil {
+		return nil, err
+	}
+	if err := ns.Validate(); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+// LoadYAML reads a namespace description from YAML, rejecting unknown fields so that misspelled properties are not
+// silently ignored
+func LoadYAML(r io.Reader) (*Namespace, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var ns Namespace
+	if err := dec.Decode(&ns); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := ns.Validate(); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+// LoadFile reads a namespace description from a .json, .yaml or .yml file
+func LoadFile(path string) (*Namespace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return LoadJSON(f)
+	case ".yaml", ".yml":
+		return LoadYAML(f)
+	default:
+		return nil, fmt.Errorf("cannot load a namespace description from a %q file; use .json, .yaml or .yml", ext)
+	}
+}
@@ -0,0 +1,880 @@
+package topology
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-service-bus-go"
+)
+
+const (
+	// ActionCreate creates an entity which does not exist
+	ActionCreate Action = "create"
+	// ActionUpdate changes the properties of an existing entity
+	ActionUpdate Action = "update"
+	// ActionDelete deletes an entity which is not described
+	ActionDelete Action = "delete"
+
+	// KindQueue is a queue
+	KindQueue Kind = "queue"
+	// KindTopic is a topic
+	KindTopic Kind = "topic"
+	// KindSubscription is a subscription of a topic
+	KindSubscription Kind = "subscription"
+	// KindRule is a rule of a subscription
+	KindRule Kind = "rule"
+)
+
+// changes are applied in this order, so that forwarding targets exist before the entities which forward to them and
+// rules which are kept are in place before the rules they replace are deleted
+const (
+	orderEntity = iota
+	orderForwardingEntity
+	orderSubscription
+	orderRule
+	orderRuleDelete
+	orderSubscriptionDelete
+	orderEntityDelete
+)
+
+type (
+	// Action is what a Change does to an entity
+	Action string
+
+	// Kind is the kind of entity a Change applies to
+	Kind string
+
+	// FieldChange is a property of an entity which a Change sets. From is empty for entities which are created.
+	// Immutable properties are only reported by Reconciler.Diff, as the service does not allow them to change without
+	// deleting and recreating the entity.
+	FieldChange struct {
+		Name      string
+		From      string
+		To        string
+		Immutable bool
+	}
+
+	// Change is a single management operation which brings an entity of the namespace in line with its description.
+	// The Path of a subscription is "topic/subscription" and the Path of a rule is "topic/subscription/rule".
+	Change struct {
+		Action Action
+		Kind   Kind
+		Path   string
+		Fields []FieldChange
+
+		order int
+		apply func(ctx context.Context) error
+	}
+
+	// Diff lists the changes which reconcile a namespace with its description, in the order they are applied
+	Diff struct {
+		Changes []Change
+
+		// drift reports immutable differences rather than failing the plan
+		drift bool
+	}
+
+	// Reconciler plans and applies the changes which bring a namespace in line with a description of it
+	Reconciler struct {
+		prune               bool
+		queueManager        func() *servicebus.QueueManager
+		topicManager        func() *servicebus.TopicManager
+		subscriptionManager func(topic string) (*servicebus.SubscriptionManager, error)
+	}
+
+	// ReconcilerOption configures a Reconciler
+	ReconcilerOption func(*Reconciler) error
+
+	// property is a property of an entity, rendered as text for comparison and display. Only managed properties are
+	// compared, which are the booleans and those which are described.
+	property struct {
+		name      string
+		want      string
+		have      string
+		managed   bool
+		immutable bool
+	}
+)
+
+// NewReconciler creates a Reconciler for the namespace
+func NewReconciler(ns *servicebus.Namespace, opts ...ReconcilerOption) (*Reconciler, error) {
+	if ns == nil {
+		return nil, errors.New("namespace must not be nil")
+	}
+
+	r := &Reconciler{
+		queueManager:        ns.NewQueueManager,
+		topicManager:        ns.NewTopicManager,
+		subscriptionManager: ns.NewSubscriptionManager,
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// ReconcilerWithPrune deletes the queues and topics of the namespace, and the subscriptions of described topics, which
+// are not described
+func ReconcilerWithPrune() ReconcilerOption {
+	return func(r *Reconciler) error {
+		r.prune = true
+		return nil
+	}
+}
+
+// Reconcile plans the changes which bring the namespace in line with the description and applies them. The planned
+// Diff is returned along with any error, so the changes which were applied before a failure can be reported.
+func (r *Reconciler) Reconcile(ctx context.Context, desired *Namespace) (*Diff, error) {
+	diff, err := r.Plan(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	return diff, r.Apply(ctx, diff)
+}
+
+// Plan compares the namespace with the description and returns the changes which would bring it in line, without
+// applying them. Plan fails if an existing entity differs in a property which the service does not allow to change,
+// such as whether a queue requires sessions, since that entity would have to be deleted along with its messages.
+func (r *Reconciler) Plan(ctx context.Context, desired *Namespace) (*Diff, error) {
+	return r.plan(ctx, desired, new(Diff))
+}
+
+// Diff reports how the namespace has drifted from its description without changing it, such as to verify the
+// configuration of an environment in CI, where an empty Diff means the namespace matches. Unlike Plan, differences in
+// properties which cannot be changed are reported as Immutable fields rather than failing, and applying the changes
+// which include them fails.
+func (r *Reconciler) Diff(ctx context.Context, desired *Namespace) (*Diff, error) {
+	return r.plan(ctx, desired, &Diff{drift: true})
+}
+
+func (r *Reconciler) plan(ctx context.Context, desired *Namespace, diff *Diff) (*Diff, error) {
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+
+	qm := r.queueManager()
+	for _, q := range desired.Queues {
+		if err := r.planQueue(ctx, diff, qm, q); err != nil {
+			return nil, err
+		}
+	}
+
+	tm := r.topicManager()
+	for _, t := range desired.Topics {
+		if err := r.planTopic(ctx, diff, tm, t); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.prune {
+		if err := r.planPrune(ctx, diff, qm, tm, desired); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].order < diff.Changes[j].order
+	})
+	return diff, nil
+}
+
+// Apply applies the changes of a Diff planned by the Reconciler in order, stopping at the first which fails
+func (r *Reconciler) Apply(ctx context.Context, diff *Diff) error {
+	for _, c := range diff.Changes {
+		if c.apply == nil {
+			return fmt.Errorf("%s of %s %q was not planned by a Reconciler", c.Action, c.Kind, c.Path)
+		}
+		if err := c.apply(ctx); err != nil {
+			return fmt.Errorf("failed to %s %s %q: %v", c.Action, c.Kind, c.Path, err)
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the namespace already matches its description
+func (d *Diff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// String renders the diff with one line per change, followed by an indented line per property it sets
+func (d *Diff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+
+	lines := make([]string, len(d.Changes))
+	for i, c := range d.Changes {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// String renders the change on one line, followed by an indented line per property it sets
+func (c Change) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s", c.Action, c.Kind, c.Path)
+	for _, f := range c.Fields {
+		if c.Action == ActionCreate {
+			fmt.Fprintf(&sb, "\n  %s: %s", f.Name, f.To)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n  %s: %s -> %s", f.Name, f.From, f.To)
+		if f.Immutable {
+			sb.WriteString(" (requires recreating the entity)")
+		}
+	}
+	return sb.String()
+}
+
+func (d *Diff) add(c Change) {
+	for _, f := range c.Fields {
+		if f.Immutable {
+			name := f.Name
+			c.apply = func(context.Context) error {
+				return fmt.Errorf("%s cannot be changed without deleting and recreating the entity", name)
+			}
+			break
+		}
+	}
+	d.Changes = append(d.Changes, c)
+}
+
+func (r *Reconciler) planQueue(ctx context.Context, diff *Diff, qm *servicebus.QueueManager, q Queue) error {
+	qe, err := qm.Get(ctx, q.Name)
+	if err != nil {
+		return err
+	}
+
+	order := orderEntity
+	if q.ForwardTo != "" {
+		order = orderForwardingEntity
+	}
+
+	if qe == nil {
+		diff.add(Change{
+			Action: ActionCreate,
+			Kind:   KindQueue,
+			Path:   q.Name,
+			Fields: created(q.properties(nil)),
+			order:  order,
+			apply: func(ctx context.Context) error {
+				_, err := qm.Put(ctx, q.Name, q.describe)
+				return err
+			},
+		})
+		return nil
+	}
+
+	fields, err := diff.updated(KindQueue, q.Name, q.properties(qe.QueueDescription))
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	diff.add(Change{
+		Action: ActionUpdate,
+		Kind:   KindQueue,
+		Path:   q.Name,
+		Fields: fields,
+		order:  order,
+		apply: func(ctx context.Context) error {
+			_, err := qm.Update(ctx, qe, q.describe)
+			return err
+		},
+	})
+	return nil
+}
+
+func (r *Reconciler) planTopic(ctx context.Context, diff *Diff, tm *servicebus.TopicManager, t Topic) error {
+	te, err := tm.Get(ctx, t.Name)
+	if err != nil {
+		return err
+	}
+
+	if te == nil {
+		diff.add(Change{
+			Action: ActionCreate,
+			Kind:   KindTopic,
+			Path:   t.Name,
+			Fields: created(t.properties(nil)),
+			order:  orderEntity,
+			apply: func(ctx context.Context) error {
+				_, err := tm.Put(ctx, t.Name, t.describe)
+				return err
+			},
+		})
+	} else {
+		fields, err := diff.updated(KindTopic, t.Name, t.properties(te.TopicDescription))
+		if err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			diff.add(Change{
+				Action: ActionUpdate,
+				Kind:   KindTopic,
+				Path:   t.Name,
+				Fields: fields,
+				order:  orderEntity,
+				apply: func(ctx context.Context) error {
+					_, err := tm.Update(ctx, te, t.describe)
+					return err
+				},
+			})
+		}
+	}
+
+	sm, err := r.subscriptionManager(t.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range t.Subscriptions {
+		if err := r.planSubscription(ctx, diff, sm, t.Name, s, te == nil); err != nil {
+			return err
+		}
+	}
+
+	if !r.prune || te == nil {
+		return nil
+	}
+
+	existing, err := sm.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	described := make(map[string]bool)
+	for _, s := range t.Subscriptions {
+		described[strings.ToLower(s.Name)] = true
+	}
+	for _, se := range existing {
+		if described[strings.ToLower(se.Name)] {
+			continue
+		}
+		name := se.Name
+		diff.add(Change{
+			Action: ActionDelete,
+			Kind:   KindSubscription,
+			Path:   t.Name + "/" + name,
+			order:  orderSubscriptionDelete,
+			apply: func(ctx context.Context) error {
+				return sm.Delete(ctx, name)
+			},
+		})
+	}
+	return nil
+}
+
+// planSubscription plans the changes to a subscription and its rules. The subscriptions of a topic which is about to
+// be created do not exist yet, so they are not fetched.
+func (r *Reconciler) planSubscription(ctx context.Context, diff *Diff, sm *servicebus.SubscriptionManager, topic string, s Subscription, topicCreated bool) error {
+	path := topic + "/" + s.Name
+
+	var se *servicebus.SubscriptionEntity
+	if !topicCreated {
+		var err error
+		if se, err = sm.Get(ctx, s.Name); err != nil {
+			return err
+		}
+	}
+
+	if se == nil {
+		diff.add(Change{
+			Action: ActionCreate,
+			Kind:   KindSubscription,
+			Path:   path,
+			Fields: created(s.properties(nil)),
+			order:  orderSubscription,
+			apply: func(ctx context.Context) error {
+				_, err := sm.Put(ctx, s.Name, s.describe)
+				return err
+			},
+		})
+
+		// a new subscription starts out with the $Default rule, which accepts all messages
+		defaultRule := &servicebus.RuleEntity{
+			Name:            servicebus.DefaultRuleName,
+			RuleDescription: &servicebus.RuleDescription{Filter: servicebus.TrueFilter{}.ToFilterDescription()},
+		}
+		return r.planRules(diff, sm, path, s, []*servicebus.RuleEntity{defaultRule})
+	}
+
+	fields, err := diff.updated(KindSubscription, path, s.properties(se.SubscriptionDescription))
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		diff.add(Change{
+			Action: ActionUpdate,
+			Kind:   KindSubscription,
+			Path:   path,
+			Fields: fields,
+			order:  orderSubscription,
+			apply: func(ctx context.Context) error {
+				_, err := sm.Update(ctx, se, s.describe)
+				return err
+			},
+		})
+	}
+
+	if s.Rules == nil {
+		return nil
+	}
+
+	existing, err := sm.ListRules(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+	return r.planRules(diff, sm, path, s, existing)
+}
+
+func (r *Reconciler) planRules(diff *Diff, sm *servicebus.SubscriptionManager, path string, s Subscription, existing []*servicebus.RuleEntity) error {
+	if s.Rules == nil {
+		return nil
+	}
+
+	current := make(map[string]*servicebus.RuleEntity, len(existing))
+	for _, re := range existing {
+		current[strings.ToLower(re.Name)] = re
+	}
+
+	for _, rule := range s.Rules {
+		filter, action := rule.filter(), rule.action()
+		props := []property{
+			{name: "Filter", want: describeFilter(filter.ToFilterDescription()), managed: true},
+			{name: "Action", managed: action != nil},
+		}
+		if action != nil {
+			ad := action.ToActionDescription()
+			props[1].want = describeAction(&ad)
+		}
+
+		re, ok := current[strings.ToLower(rule.Name)]
+		delete(current, strings.ToLower(rule.Name))
+		if !ok {
+			diff.add(Change{
+				Action: ActionCreate,
+				Kind:   KindRule,
+				Path:   path + "/" + rule.Name,
+				Fields: created(props),
+				order:  orderRule,
+				apply: func(ctx context.Context) error {
+					_, err := sm.PutRule(ctx, s.Name, rule.Name, filter, action)
+					return err
+				},
+			})
+			continue
+		}
+
+		props[0].have = describeFilter(re.Filter)
+		props[1].have = describeAction(re.Action)
+		props[1].managed = true
+		fields, err := diff.updated(KindRule, path+"/"+rule.Name, props)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		diff.add(Change{
+			Action: ActionUpdate,
+			Kind:   KindRule,
+			Path:   path + "/" + rule.Name,
+			Fields: fields,
+			order:  orderRule,
+			apply: func(ctx context.Context) error {
+				_, err := sm.UpdateRule(ctx, s.Name, re.Name, filter, action)
+				return err
+			},
+		})
+	}
+
+	// rules are deleted in the order they were listed, which is stable across plans
+	for _, re := range existing {
+		if _, ok := current[strings.ToLower(re.Name)]; !ok {
+			continue
+		}
+		name := re.Name
+		diff.add(Change{
+			Action: ActionDelete,
+			Kind:   KindRule,
+			Path:   path + "/" + name,
+			order:  orderRuleDelete,
+			apply: func(ctx context.Context) error {
+				return sm.DeleteRule(ctx, s.Name, name)
+			},
+		})
+	}
+	return nil
+}
+
+func (r *Reconciler) planPrune(ctx context.Context, diff *Diff, qm *servicebus.QueueManager, tm *servicebus.TopicManager, desired *Namespace) error {
+	described := make(map[string]bool)
+	for _, q := range desired.Queues {
+		described[strings.ToLower(q.Name)] = true
+	}
+	for _, t := range desired.Topics {
+		described[strings.ToLower(t.Name)] = true
+	}
+
+	queues, err := qm.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, qe := range queues {
+		if described[strings.ToLower(qe.Name)] {
+			continue
+		}
+		name := qe.Name
+		diff.add(Change{
+			Action: ActionDelete,
+			Kind:   KindQueue,
+			Path:   name,
+			order:  orderEntityDelete,
+			apply: func(ctx context.Context) error {
+				return qm.Delete(ctx, name)
+			},
+		})
+	}
+
+	topics, err := tm.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, te := range topics {
+		if described[strings.ToLower(te.Name)] {
+			continue
+		}
+		name := te.Name
+		diff.add(Change{
+			Action: ActionDelete,
+			Kind:   KindTopic,
+			Path:   name,
+			order:  orderEntityDelete,
+			apply: func(ctx context.Context) error {
+				return tm.Delete(ctx, name)
+			},
+		})
+	}
+	return nil
+}
+
+func (q Queue) properties(qd *servicebus.QueueDescription) []property {
+	if qd == nil {
+		qd = new(servicebus.QueueDescription)
+	}
+	return []property{
+		durationProperty("LockDuration", q.LockDuration, qd.LockDuration),
+		countProperty("MaxDeliveryCount", q.MaxDeliveryCount, qd.MaxDeliveryCount),
+		countProperty("MaxSizeInMegabytes", q.MaxSizeInMegabytes, qd.MaxSizeInMegabytes),
+		durationProperty("DefaultMessageTimeToLive", q.DefaultMessageTimeToLive, qd.DefaultMessageTimeToLive),
+		durationProperty("AutoDeleteOnIdle", q.AutoDeleteOnIdle, qd.AutoDeleteOnIdle),
+		boolProperty("DeadLetteringOnMessageExpiration", q.DeadLetteringOnMessageExpiration, qd.DeadLetteringOnMessageExpiration, false),
+		boolProperty("RequiresSession", q.RequiresSession, qd.RequiresSession, true),
+		boolProperty("EnablePartitioning", q.EnablePartitioning, qd.EnablePartitioning, true),
+		boolProperty("RequiresDuplicateDetection", q.DuplicateDetectionWindow > 0, qd.RequiresDuplicateDetection, true),
+		durationProperty("DuplicateDetectionHistoryTimeWindow", q.DuplicateDetectionWindow, qd.DuplicateDetectionHistoryTimeWindow),
+		forwardToProperty(q.ForwardTo, qd.ForwardTo),
+	}
+}
+
+// describe sets the described properties of the queue, leaving the others as they are
+func (q Queue) describe(qd *servicebus.QueueDescription) error {
+	setDuration(&qd.LockDuration, q.LockDuration)
+	setCount(&qd.MaxDeliveryCount, q.MaxDeliveryCount)
+	setCount(&qd.MaxSizeInMegabytes, q.MaxSizeInMegabytes)
+	setDuration(&qd.DefaultMessageTimeToLive, q.DefaultMessageTimeToLive)
+	setDuration(&qd.AutoDeleteOnIdle, q.AutoDeleteOnIdle)
+	qd.DeadLetteringOnMessageExpiration = boolPtr(q.DeadLetteringOnMessageExpiration)
+	qd.RequiresSession = boolPtr(q.RequiresSession)
+	qd.EnablePartitioning = boolPtr(q.EnablePartitioning)
+	qd.RequiresDuplicateDetection = boolPtr(q.DuplicateDetectionWindow > 0)
+	setDuration(&qd.DuplicateDetectionHistoryTimeWindow, q.DuplicateDetectionWindow)
+	qd.ForwardTo = stringPtr(q.ForwardTo)
+	return nil
+}
+
+func (t Topic) properties(td *servicebus.TopicDescription) []property {
+	if td == nil {
+		td = new(servicebus.TopicDescription)
+	}
+	return []property{
+		countProperty("MaxSizeInMegabytes", t.MaxSizeInMegabytes, td.MaxSizeInMegabytes),
+		durationProperty("DefaultMessageTimeToLive", t.DefaultMessageTimeToLive, td.DefaultMessageTimeToLive),
+		durationProperty("AutoDeleteOnIdle", t.AutoDeleteOnIdle, td.AutoDeleteOnIdle),
+		boolProperty("EnablePartitioning", t.EnablePartitioning, td.EnablePartitioning, true),
+		boolProperty("RequiresDuplicateDetection", t.DuplicateDetectionWindow > 0, td.RequiresDuplicateDetection, true),
+		durationProperty("DuplicateDetectionHistoryTimeWindow", t.DuplicateDetectionWindow, td.DuplicateDetectionHistoryTimeWindow),
+	}
+}
+
+// describe sets the described properties of the topic, leaving the others as they are
+func (t Topic) describe(td *servicebus.TopicDescription) error {
+	setCount(&td.MaxSizeInMegabytes, t.MaxSizeInMegabytes)
+	setDuration(&td.DefaultMessageTimeToLive, t.DefaultMessageTimeToLive)
+	setDuration(&td.AutoDeleteOnIdle, t.AutoDeleteOnIdle)
+	td.EnablePartitioning = boolPtr(t.EnablePartitioning)
+	td.RequiresDuplicateDetection = boolPtr(t.DuplicateDetectionWindow > 0)
+	setDuration(&td.DuplicateDetectionHistoryTimeWindow, t.DuplicateDetectionWindow)
+	return nil
+}
+
+func (s Subscription) properties(sd *servicebus.SubscriptionDescription) []property {
+	if sd == nil {
+		sd = new(servicebus.SubscriptionDescription)
+	}
+	return []property{
+		durationProperty("LockDuration", s.LockDuration, sd.LockDuration),
+		countProperty("MaxDeliveryCount", s.MaxDeliveryCount, sd.MaxDeliveryCount),
+		durationProperty("DefaultMessageTimeToLive", s.DefaultMessageTimeToLive, sd.DefaultMessageTimeToLive),
+		durationProperty("AutoDeleteOnIdle", s.AutoDeleteOnIdle, sd.AutoDeleteOnIdle),
+		boolProperty("DeadLetteringOnMessageExpiration", s.DeadLetteringOnMessageExpiration, sd.DeadLetteringOnMessageExpiration, false),
+		boolProperty("RequiresSession", s.RequiresSession, sd.RequiresSession, true),
+		forwardToProperty(s.ForwardTo, sd.ForwardTo),
+	}
+}
+
+// describe sets the described properties of the subscription, leaving the others as they are
+func (s Subscription) describe(sd *servicebus.SubscriptionDescription) error {
+	setDuration(&sd.LockDuration, s.LockDuration)
+	setCount(&sd.MaxDeliveryCount, s.MaxDeliveryCount)
+	setDuration(&sd.DefaultMessageTimeToLive, s.DefaultMessageTimeToLive)
+	setDuration(&sd.AutoDeleteOnIdle, s.AutoDeleteOnIdle)
+	sd.DeadLetteringOnMessageExpiration = boolPtr(s.DeadLetteringOnMessageExpiration)
+	sd.RequiresSession = boolPtr(s.RequiresSession)
+	sd.ForwardTo = stringPtr(s.ForwardTo)
+	return nil
+}
+
+func (r Rule) filter() servicebus.FilterDescriber {
+	switch {
+	case r.SQLFilter != "":
+		return servicebus.SQLFilter{Expression: r.SQLFilter}
+	case r.CorrelationFilter != nil:
+		cf := r.CorrelationFilter
+		filter := servicebus.CorrelationFilter{
+			CorrelationID:    stringPtr(cf.CorrelationID),
+			MessageID:        stringPtr(cf.MessageID),
+			To:               stringPtr(cf.To),
+			ReplyTo:          stringPtr(cf.ReplyTo),
+			Label:            stringPtr(cf.Label),
+			SessionID:        stringPtr(cf.SessionID),
+			ReplyToSessionID: stringPtr(cf.ReplyToSessionID),
+			ContentType:      stringPtr(cf.ContentType),
+		}
+		if len(cf.Properties) > 0 {
+			filter.Properties = make(servicebus.CorrelationProperties, len(cf.Properties))
+			for key, value := range cf.Properties {
+				filter.Properties[key] = value
+			}
+		}
+		return filter
+	default:
+		return servicebus.TrueFilter{}
+	}
+}
+
+func (r Rule) action() servicebus.ActionDescriber {
+	if r.SQLAction == "" {
+		return nil
+	}
+	return servicebus.SQLAction{Expression: r.SQLAction}
+}
+
+// describeFilter renders a filter as text which is equal for equivalent filters
+func describeFilter(fd servicebus.FilterDescription) string {
+	if fd.SQLExpression != nil && fd.Type != "CorrelationFilter" {
+		return fmt.Sprintf("%s(%s)", fd.Type, *fd.SQLExpression)
+	}
+
+	var parts []string
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"CorrelationId", fd.CorrelationID},
+		{"MessageId", fd.MessageID},
+		{"To", fd.To},
+		{"ReplyTo", fd.ReplyTo},
+		{"Label", fd.Label},
+		{"SessionId", fd.SessionID},
+		{"ReplyToSessionId", fd.ReplyToSessionID},
+		{"ContentType", fd.ContentType},
+	} {
+		if field.value != nil {
+			parts = append(parts, fmt.Sprintf("%s=%s", field.name, *field.value))
+		}
+	}
+
+	keys := make([]string, 0, len(fd.Properties))
+	for key := range fd.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, fd.Properties[key]))
+	}
+	return fmt.Sprintf("%s(%s)", fd.Type, strings.Join(parts, ", "))
+}
+
+// describeAction renders an action as text, which is empty when the rule does not modify messages
+func describeAction(ad *servicebus.ActionDescription) string {
+	if ad == nil || ad.SQLExpression == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s(%s)", ad.Type, ad.SQLExpression)
+}
+
+// created lists the properties an entity is created with, leaving out those which are not described or are off
+func created(props []property) []FieldChange {
+	var fields []FieldChange
+	for _, p := range props {
+		if p.managed && p.want != "" && p.want != "false" {
+			fields = append(fields, FieldChange{Name: p.name, To: p.want})
+		}
+	}
+	return fields
+}
+
+// updated lists the properties of an existing entity which differ from its description, failing if one of them cannot
+// be changed unless drift is being reported
+func (d *Diff) updated(kind Kind, path string, props []property) ([]FieldChange, error) {
+	var fields []FieldChange
+	for _, p := range props {
+		if !p.managed || p.want == p.have {
+			continue
+		}
+		if p.immutable && !d.drift {
+			return nil, fmt.Errorf("%s %q has %s %s, which cannot be changed to %s without deleting and recreating it", kind, path, p.name, p.have, p.want)
+		}
+		fields = append(fields, FieldChange{Name: p.name, From: p.have, To: p.want, Immutable: p.immutable})
+	}
+	return fields, nil
+}
+
+func durationProperty(name string, want Duration, have *string) property {
+	p := property{name: name, want: want.String(), managed: want > 0}
+	if have != nil {
+		p.have = *have
+		if d, err := parseISO8601Duration(*have); err == nil {
+			p.have = d.String()
+		}
+	}
+	return p
+}
+
+func countProperty(name string, want int32, have *int32) property {
+	p := property{name: name, want: strconv.Itoa(int(want)), managed: want > 0}
+	if have != nil {
+		p.have = strconv.Itoa(int(*have))
+	}
+	return p
+}
+
+func boolProperty(name string, want bool, have *bool, immutable bool) property {
+	return property{
+		name:      name,
+		want:      strconv.FormatBool(want),
+		have:      strconv.FormatBool(have != nil && *have),
+		managed:   true,
+		immutable: immutable,
+	}
+}
+
+// forwardToProperty compares forwarding targets by entity name, since the service reports them as absolute URLs
+func forwardToProperty(want string, have *string) property {
+	p := property{name: "ForwardTo", want: want, managed: true}
+	if have != nil {
+		p.have = *have
+		if u, err := url.Parse(*have); err == nil && u.IsAbs() {
+			p.have = strings.TrimPrefix(u.Path, "/")
+		}
+	}
+	if strings.EqualFold(p.want, p.have) {
+		p.have = p.want
+	}
+	return p
+}
+
+func setDuration(field **string, d Duration) {
+	if d > 0 {
+		*field = stringPtr(fmt.Sprintf("PT%dS", int64(time.Duration(d)/time.Second)))
+	}
+}
+
+func setCount(field **int32, count int32) {
+	if count > 0 {
+		*field = &count
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// stringPtr returns nil for the empty string, which leaves the element out of the description
+func stringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+var iso8601Duration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISO8601Duration parses the day-time durations the service describes entities with, such as "PT1M" or
+// "P10675199DT2H48M5.4775807S", which is the largest duration the service allows and is capped to the largest
+// time.Duration
+func parseISO8601Duration(s string) (time.Duration, error) {
+	m := iso8601Duration.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("%q is not an ISO 8601 duration", s)
+	}
+
+	var seconds float64
+	for i, unit := range []float64{24 * 60 * 60, 60 * 60, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds += value * unit
+	}
+
+	if seconds*float64(time.Second) >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond), nil
+}
@@ -0,0 +1,384 @@
+package topology
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-service-bus-go"
+)
+
+const trueRule = `<RuleDescription><Filter xmlns:i="http://www.w3.org/2001/XMLSchema-instance" i:type="TrueFilter">` +
+	`<SqlExpression>1=1</SqlExpression></Filter></RuleDescription>`
+
+type (
+	staticTokenProvider struct{}
+
+	// fakeNamespace is an in-memory stand-in for the management API of a namespace, which stores the descriptions
+	// of entities by their path
+	fakeNamespace struct {
+		mu       sync.Mutex
+		entities map[string]string
+		requests []string
+	}
+)
+
+var contentPattern = regexp.MustCompile(`(?s)<content[^>]*>(.*)</content>`)
+
+func (staticTokenProvider) GetToken(string) (*auth.Token, error) {
+	return auth.NewToken(auth.CBSTokenTypeSAS, "token", "0"), nil
+}
+
+func newFakeNamespace() *fakeNamespace {
+	return &fakeNamespace{entities: make(map[string]string)}
+}
+
+func (fn *fakeNamespace) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn.mu.Lock()
+	defer fn.mu.Unlock()
+
+	path := r.URL.Path
+	fn.requests = append(fn.requests, r.Method+" "+path)
+	switch r.Method {
+	case http.MethodGet:
+		switch {
+		case path == "/$Resources/Queues":
+			_, _ = w.Write([]byte(fn.feed("/", "<QueueDescription")))
+		case path == "/$Resources/Topics":
+			_, _ = w.Write([]byte(fn.feed("/", "<TopicDescription")))
+		case strings.HasSuffix(path, "/subscriptions") || strings.HasSuffix(path, "/rules"):
+			_, _ = w.Write([]byte(fn.feed(path+"/", "")))
+		default:
+			description, ok := fn.entities[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(entry(path, description)))
+		}
+	case http.MethodPut:
+		if _, ok := fn.entities[path]; ok && r.Header.Get("If-Match") == "" {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`<Error><Code>409</Code><Detail>Entity already exists.</Detail></Error>`))
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		description := contentPattern.FindStringSubmatch(string(b))[1]
+		fn.entities[path] = description
+		if strings.HasPrefix(description, "<SubscriptionDescription") {
+			fn.entities[path+"/rules/$Default"] = trueRule
+		}
+		_, _ = w.Write([]byte(entry(path, description)))
+	case http.MethodDelete:
+		if _, ok := fn.entities[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for existing := range fn.entities {
+			if existing == path || strings.HasPrefix(existing, path+"/") {
+				delete(fn.entities, existing)
+			}
+		}
+	}
+}
+
+// feed lists the entities directly under the prefix whose description starts with kind
+func (fn *fakeNamespace) feed(prefix, kind string) string {
+	var entries []string
+	for _, path := range fn.paths() {
+		rest := strings.TrimPrefix(path, prefix)
+		if rest == path || strings.Contains(rest, "/") || !strings.HasPrefix(fn.entities[path], kind) {
+			continue
+		}
+		entries = append(entries, entry(path, fn.entities[path]))
+	}
+	return `<feed xmlns="http://www.w3.org/2005/Atom"><title type="text">feed</title>` + strings.Join(entries, "") + `</feed>`
+}
+
+func (fn *fakeNamespace) paths() []string {
+	var paths []string
+	for path := range fn.entities {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (fn *fakeNamespace) writes() []string {
+	fn.mu.Lock()
+	defer fn.mu.Unlock()
+
+	var writes []string
+	for _, request := range fn.requests {
+		if !strings.HasPrefix(request, http.MethodGet) {
+			writes = append(writes, request)
+		}
+	}
+	fn.requests = nil
+	return writes
+}
+
+func entry(path, description string) string {
+	name := path[strings.LastIndex(path, "/")+1:]
+	return fmt.Sprintf(`<entry xmlns="http://www.w3.org/2005/Atom"><title type="text">%s</title><content type="application/xml">%s</content></entry>`, name, description)
+}
+
+func newFakeReconciler(t *testing.T, fn *fakeNamespace, opts ...ReconcilerOption) (*Reconciler, func()) {
+	server := httptest.NewServer(fn)
+	ns, err := servicebus.NewNamespace()
+	if !assert.NoError(t, err) {
+		server.Close()
+		t.FailNow()
+	}
+
+	r, err := NewReconciler(ns, opts...)
+	if !assert.NoError(t, err) {
+		server.Close()
+		t.FailNow()
+	}
+
+	// every manager talks to the fake namespace instead of the service
+	r.queueManager = func() *servicebus.QueueManager {
+		qm := ns.NewQueueManager()
+		qm.Host, qm.TokenProvider = server.URL+"/", staticTokenProvider{}
+		return qm
+	}
+	r.topicManager = func() *servicebus.TopicManager {
+		tm := ns.NewTopicManager()
+		tm.Host, tm.TokenProvider = server.URL+"/", staticTokenProvider{}
+		return tm
+	}
+	r.subscriptionManager = func(topic string) (*servicebus.SubscriptionManager, error) {
+		sm, err := ns.NewSubscriptionManager(topic)
+		if err != nil {
+			return nil, err
+		}
+		sm.Host, sm.TokenProvider = server.URL+"/", staticTokenProvider{}
+		return sm, nil
+	}
+	return r, server.Close
+}
+
+func orders() *Namespace {
+	return &Namespace{
+		Queues: []Queue{
+			{Name: "archive", ForwardTo: "invoices"},
+			{Name: "invoices", LockDuration: Duration(30e9), MaxDeliveryCount: 5, DeadLetteringOnMessageExpiration: true},
+		},
+		Topics: []Topic{
+			{Name: "orders", DuplicateDetectionWindow: Duration(600e9), Subscriptions: []Subscription{
+				{Name: "everything"},
+				{Name: "large", Rules: []Rule{
+					{Name: "over-100", SQLFilter: "total > 100", SQLAction: "SET large = TRUE"},
+					{Name: "priority", CorrelationFilter: &CorrelationFilter{Label: "priority", Properties: map[string]interface{}{"tier": "gold"}}},
+				}},
+			}},
+		},
+	}
+}
+
+func TestReconciler_CreatesDescribedEntities(t *testing.T) {
+	fn := newFakeNamespace()
+	r, closeServer := newFakeReconciler(t, fn)
+	defer closeServer()
+
+	diff, err := r.Reconcile(context.Background(), orders())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var changes []string
+	for _, c := range diff.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Path))
+	}
+	assert.Equal(t, []string{
+		"create queue invoices",
+		"create topic orders",
+		"create queue archive",
+		"create subscription orders/everything",
+		"create subscription orders/large",
+		"create rule orders/large/over-100",
+		"create rule orders/large/priority",
+		"delete rule orders/large/$Default",
+	}, changes, "forwarding queues are created after their targets and rules are replaced before $Default is deleted")
+	assert.Equal(t, []FieldChange{
+		{Name: "LockDuration", To: "30s"},
+		{Name: "MaxDeliveryCount", To: "5"},
+		{Name: "DeadLetteringOnMessageExpiration", To: "true"},
+	}, diff.Changes[0].Fields)
+
+	assert.Equal(t, []string{
+		"/archive",
+		"/invoices",
+		"/orders",
+		"/orders/subscriptions/everything",
+		"/orders/subscriptions/everything/rules/$Default",
+		"/orders/subscriptions/large",
+		"/orders/subscriptions/large/rules/over-100",
+		"/orders/subscriptions/large/rules/priority",
+	}, fn.paths())
+
+	// the namespace now matches its description, so there is nothing left to do
+	fn.writes()
+	diff, err = r.Reconcile(context.Background(), orders())
+	if assert.NoError(t, err) {
+		assert.True(t, diff.Empty(), diff.String())
+		assert.Empty(t, fn.writes())
+	}
+}
+
+func TestReconciler_UpdatesAndPrunes(t *testing.T) {
+	fn := newFakeNamespace()
+	r, closeServer := newFakeReconciler(t, fn, ReconcilerWithPrune())
+	defer closeServer()
+
+	if _, err := r.Reconcile(context.Background(), orders()); !assert.NoError(t, err) {
+		return
+	}
+	fn.entities["/legacy"] = `<QueueDescription></QueueDescription>`
+	fn.entities["/orders/subscriptions/large/rules/stale"] = trueRule
+	fn.writes()
+
+	desired := orders()
+	desired.Queues[1].MaxDeliveryCount = 10
+	desired.Topics[0].Subscriptions = desired.Topics[0].Subscriptions[1:]
+	desired.Topics[0].Subscriptions[0].Rules[0].SQLFilter = "total > 500"
+
+	// a fresh reconciler does not see the queues the first one cached
+	r, closeServer = newFakeReconciler(t, fn, ReconcilerWithPrune())
+	defer closeServer()
+	diff, err := r.Plan(context.Background(), desired)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "update queue invoices\n"+
+		"  MaxDeliveryCount: 5 -> 10\n"+
+		"update rule orders/large/over-100\n"+
+		"  Filter: SqlFilter(total > 100) -> SqlFilter(total > 500)\n"+
+		"delete rule orders/large/stale\n"+
+		"delete subscription orders/everything\n"+
+		"delete queue legacy", diff.String())
+	assert.Empty(t, fn.writes(), "planning does not change the namespace")
+
+	if !assert.NoError(t, r.Apply(context.Background(), diff)) {
+		return
+	}
+	assert.Equal(t, []string{
+		"PUT /invoices",
+		"PUT /orders/subscriptions/large/rules/over-100",
+		"DELETE /orders/subscriptions/large/rules/stale",
+		"DELETE /orders/subscriptions/everything",
+		"DELETE /legacy",
+	}, fn.writes())
+	assert.Contains(t, fn.entities["/invoices"], "<MaxDeliveryCount>10</MaxDeliveryCount>")
+	assert.Contains(t, fn.entities["/invoices"], "<LockDuration>PT30S</LockDuration>", "properties which did not change are kept")
+}
+
+func TestReconciler_PlanRejectsImmutableChanges(t *testing.T) {
+	fn := newFakeNamespace()
+	fn.entities["/invoices"] = `<QueueDescription><RequiresSession>false</RequiresSession></QueueDescription>`
+	r, closeServer := newFakeReconciler(t, fn)
+	defer closeServer()
+
+	_, err := r.Plan(context.Background(), &Namespace{Queues: []Queue{{Name: "invoices", RequiresSession: true}}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "RequiresSession false")
+	}
+	assert.Empty(t, fn.writes())
+}
+
+func TestReconciler_ApplyRequiresPlannedChanges(t *testing.T) {
+	ns, err := servicebus.NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	r, err := NewReconciler(ns)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = r.Apply(context.Background(), &Diff{Changes: []Change{{Action: ActionDelete, Kind: KindQueue, Path: "orders"}}})
+	assert.Error(t, err)
+
+	_, err = NewReconciler(nil)
+	assert.Error(t, err)
+}
+
+func TestForwardToProperty(t *testing.T) {
+	target := "https://example.servicebus.windows.net/Invoices"
+	p := forwardToProperty("invoices", &target)
+	assert.Equal(t, p.want, p.have, "the service reports forwarding targets as URLs")
+
+	p = forwardToProperty("", &target)
+	assert.Equal(t, "Invoices", p.have)
+	assert.Empty(t, p.want)
+}
+
+func TestParseISO8601Duration(t *testing.T) {
+	cases := map[string]string{
+		"PT30S":                      "30s",
+		"PT1M":                       "1m0s",
+		"P14D":                       "336h0m0s",
+		"P1DT2H3M4.5S":               "26h3m4.5s",
+		"P10675199DT2H48M5.4775807S": "2562047h47m16.854775807s",
+	}
+	for iso, expected := range cases {
+		d, err := parseISO8601Duration(iso)
+		if assert.NoError(t, err, iso) {
+			assert.Equal(t, expected, d.String(), iso)
+		}
+	}
+
+	for _, invalid := range []string{"", "P", "PT", "30s", "P1H"} {
+		_, err := parseISO8601Duration(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestReconciler_DiffReportsDriftWithoutChanges(t *testing.T) {
+	fn := newFakeNamespace()
+	fn.entities["/invoices"] = `<QueueDescription><MaxDeliveryCount>10</MaxDeliveryCount>` +
+		`<RequiresSession>true</RequiresSession></QueueDescription>`
+	r, closeServer := newFakeReconciler(t, fn)
+	defer closeServer()
+
+	desired := &Namespace{Queues: []Queue{{Name: "invoices", MaxDeliveryCount: 5}, {Name: "archive"}}}
+	diff, err := r.Diff(context.Background(), desired)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "update queue invoices\n"+
+		"  MaxDeliveryCount: 10 -> 5\n"+
+		"  RequiresSession: true -> false (requires recreating the entity)\n"+
+		"create queue archive", diff.String())
+	assert.Equal(t, []FieldChange{
+		{Name: "MaxDeliveryCount", From: "10", To: "5"},
+		{Name: "RequiresSession", From: "true", To: "false", Immutable: true},
+	}, diff.Changes[0].Fields)
+	assert.Empty(t, fn.writes())
+
+	err = r.Apply(context.Background(), diff)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "RequiresSession cannot be changed")
+	}
+	assert.Empty(t, fn.writes(), "changes which cannot be applied are not attempted")
+
+	fn.entities["/invoices"] = `<QueueDescription><MaxDeliveryCount>5</MaxDeliveryCount></QueueDescription>`
+	fn.entities["/archive"] = `<QueueDescription></QueueDescription>`
+	r, closeServer = newFakeReconciler(t, fn)
+	defer closeServer()
+	diff, err = r.Diff(context.Background(), desired)
+	if assert.NoError(t, err) {
+		assert.True(t, diff.Empty(), diff.String())
+	}
+}
@@ -0,0 +1,196 @@
+// Package topology reconciles a Service Bus namespace with a declarative description of its queues, topics,
+// subscriptions and rules, which can be written in Go or loaded from JSON or YAML
+package topology
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	// Namespace describes the queues and topics a namespace should have. Entities of the namespace which are not
+	// described are left alone unless the Reconciler prunes them.
+	Namespace struct {
+		Queues []Queue `json:"queues,omitempty" yaml:"queues,omitempty"`
+		Topics []Topic `json:"topics,omitempty" yaml:"topics,omitempty"`
+	}
+
+	// Queue describes a queue. Durations and counts which are zero are left at the value the service chose, while
+	// booleans and ForwardTo are always enforced.
+	Queue struct {
+		Name                             string   `json:"name" yaml:"name"`
+		LockDuration                     Duration `json:"lockDuration,omitempty" yaml:"lockDuration,omitempty"`
+		MaxDeliveryCount                 int32    `json:"maxDeliveryCount,omitempty" yaml:"maxDeliveryCount,omitempty"`
+		MaxSizeInMegabytes               int32    `json:"maxSizeInMegabytes,omitempty" yaml:"maxSizeInMegabytes,omitempty"`
+		DefaultMessageTimeToLive         Duration `json:"defaultMessageTimeToLive,omitempty" yaml:"defaultMessageTimeToLive,omitempty"`
+		AutoDeleteOnIdle                 Duration `json:"autoDeleteOnIdle,omitempty" yaml:"autoDeleteOnIdle,omitempty"`
+		DeadLetteringOnMessageExpiration bool     `json:"deadLetteringOnMessageExpiration,omitempty" yaml:"deadLetteringOnMessageExpiration,omitempty"`
+		RequiresSession                  bool     `json:"requiresSession,omitempty" yaml:"requiresSession,omitempty"`
+		EnablePartitioning               bool     `json:"enablePartitioning,omitempty" yaml:"enablePartitioning,omitempty"`
+		// DuplicateDetectionWindow enables duplicate detection when it is not zero
+		DuplicateDetectionWindow Duration `json:"duplicateDetectionWindow,omitempty" yaml:"duplicateDetectionWindow,omitempty"`
+		// ForwardTo is the name of the queue or topic received messages are forwarded to
+		ForwardTo string `json:"forwardTo,omitempty" yaml:"forwardTo,omitempty"`
+	}
+
+	// Topic describes a topic and its subscriptions. Durations and sizes which are zero are left at the value the
+	// service chose, while booleans are always enforced.
+	Topic struct {
+		Name                     string   `json:"name" yaml:"name"`
+		MaxSizeInMegabytes       int32    `json:"maxSizeInMegabytes,omitempty" yaml:"maxSizeInMegabytes,omitempty"`
+		DefaultMessageTimeToLive Duration `json:"defaultMessageTimeToLive,omitempty" yaml:"defaultMessageTimeToLive,omitempty"`
+		AutoDeleteOnIdle         Duration `json:"autoDeleteOnIdle,omitempty" yaml:"autoDeleteOnIdle,omitempty"`
+		EnablePartitioning       bool     `json:"enablePartitioning,omitempty" yaml:"enablePartitioning,omitempty"`
+		// DuplicateDetectionWindow enables duplicate detection when it is not zero
+		DuplicateDetectionWindow Duration       `json:"duplicateDetectionWindow,omitempty" yaml:"duplicateDetectionWindow,omitempty"`
+		Subscriptions            []Subscription `json:"subscriptions,omitempty" yaml:"subscriptions,omitempty"`
+	}
+
+	// Subscription describes a subscription of a topic. Durations and counts which are zero are left at the value the
+	// service chose, while booleans and ForwardTo are always enforced.
+	Subscription struct {
+		Name                             string   `json:"name" yaml:"name"`
+		LockDuration                     Duration `json:"lockDuration,omitempty" yaml:"lockDuration,omitempty"`
+		MaxDeliveryCount                 int32    `json:"maxDeliveryCount,omitempty" yaml:"maxDeliveryCount,omitempty"`
+		DefaultMessageTimeToLive         Duration `json:"defaultMessageTimeToLive,omitempty" yaml:"defaultMessageTimeToLive,omitempty"`
+		AutoDeleteOnIdle                 Duration `json:"autoDeleteOnIdle,omitempty" yaml:"autoDeleteOnIdle,omitempty"`
+		DeadLetteringOnMessageExpiration bool     `json:"deadLetteringOnMessageExpiration,omitempty" yaml:"deadLetteringOnMessageExpiration,omitempty"`
+		RequiresSession                  bool     `json:"requiresSession,omitempty" yaml:"requiresSession,omitempty"`
+		// ForwardTo is the name of the queue or topic received messages are forwarded to
+		ForwardTo string `json:"forwardTo,omitempty" yaml:"forwardTo,omitempty"`
+		// Rules are the rules the subscription should have. When Rules is nil the rules of the subscription are left
+		// alone, otherwise rules which are not listed are deleted, including the $Default rule which accepts all
+		// messages.
+		Rules []Rule `json:"rules,omitempty" yaml:"rules,omitempty"`
+	}
+
+	// Rule describes a rule of a subscription. A rule with neither a SQLFilter nor a CorrelationFilter accepts all
+	// messages.
+	Rule struct {
+		Name              string             `json:"name" yaml:"name"`
+		SQLFilter         string             `json:"sqlFilter,omitempty" yaml:"sqlFilter,omitempty"`
+		CorrelationFilter *CorrelationFilter `json:"correlationFilter,omitempty" yaml:"correlationFilter,omitempty"`
+		SQLAction         string             `json:"sqlAction,omitempty" yaml:"sqlAction,omitempty"`
+	}
+
+	// CorrelationFilter selects the messages whose system properties equal all of the set fields and whose user
+	// properties include all of the Properties
+	CorrelationFilter struct {
+		CorrelationID    string                 `json:"correlationId,omitempty" yaml:"correlationId,omitempty"`
+		MessageID        string                 `json:"messageId,omitempty" yaml:"messageId,omitempty"`
+		To               string                 `json:"to,omitempty" yaml:"to,omitempty"`
+		ReplyTo          string                 `json:"replyTo,omitempty" yaml:"replyTo,omitempty"`
+		Label            string                 `json:"label,omitempty" yaml:"label,omitempty"`
+		SessionID        string                 `json:"sessionId,omitempty" yaml:"sessionId,omitempty"`
+		ReplyToSessionID string                 `json:"replyToSessionId,omitempty" yaml:"replyToSessionId,omitempty"`
+		ContentType      string                 `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+		Properties       map[string]interface{} `json:"properties,omitempty" yaml:"properties,omitempty"`
+	}
+
+	// Duration is a time.Duration written as text such as "30s" or "1h30m" in JSON and YAML descriptions
+	Duration time.Duration
+)
+
+// MarshalText writes the duration as text such as "1m30s"
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText reads a duration written as text such as "1m30s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// String returns the duration as text such as "1m30s"
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Validate checks that every entity of the description is named, that names are unique and that no rule has more
+// than one filter
+func (n *Namespace) Validate() error {
+	if n == nil {
+		return errors.New("namespace description must not be nil")
+	}
+
+	// queues and topics share the paths of the namespace, which are not case sensitive
+	entities := make(map[string]bool)
+	claim := func(kind, name string) error {
+		if name == "" {
+			return fmt.Errorf("every %s must have a name", kind)
+		}
+		if entities[strings.ToLower(name)] {
+			return fmt.Errorf("%s %q is described more than once", kind, name)
+		}
+		entities[strings.ToLower(name)] = true
+		return nil
+	}
+
+	for _, q := range n.Queues {
+		if err := claim(string(KindQueue), q.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range n.Topics {
+		if err := claim(string(KindTopic), t.Name); err != nil {
+			return err
+		}
+
+		subscriptions := make(map[string]bool)
+		for _, s := range t.Subscriptions {
+			if s.Name == "" {
+				return fmt.Errorf("every subscription of topic %q must have a name", t.Name)
+			}
+			if subscriptions[strings.ToLower(s.Name)] {
+				return fmt.Errorf("subscription %q of topic %q is described more than once", s.Name, t.Name)
+			}
+			subscriptions[strings.ToLower(s.Name)] = true
+
+			rules := make(map[string]bool)
+			for _, r := range s.Rules {
+				path := t.Name + "/" + s.Name
+				if r.Name == "" {
+					return fmt.Errorf("every rule of subscription %q must have a name", path)
+				}
+				if rules[strings.ToLower(r.Name)] {
+					return fmt.Errorf("rule %q of subscription %q is described more than once", r.Name, path)
+				}
+				rules[strings.ToLower(r.Name)] = true
+				if r.SQLFilter != "" && r.CorrelationFilter != nil {
+					return fmt.Errorf("rule %q of subscription %q must not have both a SQL and a correlation filter", r.Name, path)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package topology
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ordersYAML = `
+queues:
+  - name: invoices
+    lockDuration: 30s
+    maxDeliveryCount: 5
+    deadLetteringOnMessageExpiration: true
+  - name: archive
+    forwardTo: invoices
+topics:
+  - name: orders
+    duplicateDetectionWindow: 10m
+    subscriptions:
+      - name: everything
+      - name: large
+        rules:
+          - name: over-100
+            sqlFilter: total > 100
+            sqlAction: SET large = TRUE
+          - name: priority
+            correlationFilter:
+              label: priority
+              properties:
+                tier: gold
+`
+
+const ordersJSON = `{
+  "queues": [
+    {"name": "invoices", "lockDuration": "30s", "maxDeliveryCount": 5, "deadLetteringOnMessageExpiration": true},
+    {"name": "archive", "forwardTo": "invoices"}
+  ],
+  "topics": [
+    {"name": "orders", "duplicateDetectionWindow": "10m", "subscriptions": [
+      {"name": "everything"},
+      {"name": "large", "rules": [
+        {"name": "over-100", "sqlFilter": "total > 100", "sqlAction": "SET large = TRUE"},
+        {"name": "priority", "correlationFilter": {"label": "priority", "properties": {"tier": "gold"}}}
+      ]}
+    ]}
+  ]
+}`
+
+func TestLoad(t *testing.T) {
+	fromYAML, err := LoadYAML(strings.NewReader(ordersYAML))
+	if !assert.NoError(t, err) {
+		return
+	}
+	fromJSON, err := LoadJSON(strings.NewReader(ordersJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, ns := range []*Namespace{fromYAML, fromJSON} {
+		if !assert.Len(t, ns.Queues, 2) || !assert.Len(t, ns.Topics, 1) {
+			continue
+		}
+		assert.Equal(t, Duration(30*time.Second), ns.Queues[0].LockDuration)
+		assert.Equal(t, int32(5), ns.Queues[0].MaxDeliveryCount)
+		assert.True(t, ns.Queues[0].DeadLetteringOnMessageExpiration)
+		assert.Equal(t, "invoices", ns.Queues[1].ForwardTo)
+		assert.Equal(t, Duration(10*time.Minute), ns.Topics[0].DuplicateDetectionWindow)
+
+		subs := ns.Topics[0].Subscriptions
+		if assert.Len(t, subs, 2) {
+			assert.Nil(t, subs[0].Rules, "subscriptions without rules keep the rules they have")
+			if assert.Len(t, subs[1].Rules, 2) {
+				assert.Equal(t, Rule{Name: "over-100", SQLFilter: "total > 100", SQLAction: "SET large = TRUE"}, subs[1].Rules[0])
+				assert.Equal(t, "priority", subs[1].Rules[1].CorrelationFilter.Label)
+				assert.Equal(t, "gold", subs[1].Rules[1].CorrelationFilter.Properties["tier"])
+			}
+		}
+	}
+	assert.Equal(t, fromJSON, fromYAML)
+	assert.Equal(t, orders().Queues[1], fromYAML.Queues[0])
+}
+
+func TestLoad_RejectsInvalidDescriptions(t *testing.T) {
+	_, err := LoadYAML(strings.NewReader("queues:\n  - name: invoices\n    lockDuraton: 30s\n"))
+	assert.Error(t, err, "misspelled properties are rejected")
+
+	_, err = LoadJSON(strings.NewReader(`{"queues": [{"name": "invoices", "lockDuration": "thirty seconds"}]}`))
+	assert.Error(t, err)
+
+	_, err = LoadYAML(strings.NewReader("queues:\n  - name: orders\ntopics:\n  - name: Orders\n"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "more than once", "queues and topics share the names of the namespace")
+	}
+
+	ns, err := LoadYAML(strings.NewReader(""))
+	if assert.NoError(t, err) {
+		assert.Empty(t, ns.Queues)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "topology")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{"orders.yml": ordersYAML, "orders.json": ordersJSON, "orders.toml": ""} {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)) {
+			return
+		}
+	}
+
+	for _, name := range []string{"orders.yml", "orders.json"} {
+		ns, err := LoadFile(filepath.Join(dir, name))
+		if assert.NoError(t, err, name) {
+			assert.Len(t, ns.Topics, 1, name)
+		}
+	}
+
+	_, err = LoadFile(filepath.Join(dir, "orders.toml"))
+	assert.Error(t, err)
+	_, err = LoadFile(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestNamespace_Validate(t *testing.T) {
+	var missing *Namespace
+	assert.Error(t, missing.Validate())
+	assert.NoError(t, orders().Validate())
+
+	invalid := []*Namespace{
+		{Queues: []Queue{{}}},
+		{Topics: []Topic{{Name: "orders", Subscriptions: []Subscription{{Name: "a"}, {Name: "A"}}}}},
+		{Topics: []Topic{{Name: "orders", Subscriptions: []Subscription{{Name: "a", Rules: []Rule{{}}}}}}},
+		{Topics: []Topic{{Name: "orders", Subscriptions: []Subscription{{Name: "a", Rules: []Rule{
+			{Name: "both", SQLFilter: "1=1", CorrelationFilter: &CorrelationFilter{Label: "x"}},
+		}}}}}},
+	}
+	for _, ns := range invalid {
+		assert.Error(t, ns.Validate())
+	}
+}
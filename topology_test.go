@@ -0,0 +1,104 @@
+package servicebus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func atomFeed(entries []string) string {
+	return `<feed xmlns="http://www.w3.org/2005/Atom"><title type="text">feed</title>` + strings.Join(entries, "") + `</feed>`
+}
+
+func atomEntry(title, content string) string {
+	return fmt.Sprintf(`<entry><title type="text">%s</title><content type="application/xml">%s</content></entry>`, title, content)
+}
+
+func countDetails(active int) string {
+	return fmt.Sprintf(`<CountDetails xmlns:d2p1="http://schemas.microsoft.com/netservices/2011/06/servicebus">`+
+		`<d2p1:ActiveMessageCount>%d</d2p1:ActiveMessageCount><d2p1:DeadLetterMessageCount>1</d2p1:DeadLetterMessageCount>`+
+		`</CountDetails>`, active)
+}
+
+func TestTopicManager_ListWithSubscriptions(t *testing.T) {
+	const topicCount = managementPageSize + 1
+	var mu sync.Mutex
+	requests := map[string]int{}
+	inFlight, maxInFlight := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		skip, _ := strconv.Atoi(r.URL.Query().Get("$skip"))
+		assert.Equal(t, strconv.Itoa(managementPageSize), r.URL.Query().Get("$top"))
+
+		var entries []string
+		switch {
+		case r.URL.Path == "/$Resources/Topics":
+			for i := skip; i < topicCount && i < skip+managementPageSize; i++ {
+				entries = append(entries, atomEntry(fmt.Sprintf("topic%d", i), `<TopicDescription>`+countDetails(i)+`</TopicDescription>`))
+			}
+		case strings.HasSuffix(r.URL.Path, "/subscriptions"):
+			topic := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0]
+			entries = append(entries, atomEntry(topic+"-sub", `<SubscriptionDescription><MessageCount>7</MessageCount>`+countDetails(7)+`</SubscriptionDescription>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(atomFeed(entries)))
+	}))
+	defer server.Close()
+
+	tm := &TopicManager{entityManager: newEntityManager(server.URL+"/", staticTokenProvider("token"))}
+	topology, err := tm.ListWithSubscriptions(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.Len(t, topology, topicCount) {
+		last := topology[topicCount-1]
+		assert.Equal(t, "topic100", last.Name)
+		assert.Equal(t, int32(100), *last.CountDetails.ActiveMessageCount)
+		if assert.Len(t, last.Subscriptions, 1) {
+			sub := last.Subscriptions[0]
+			assert.Equal(t, "topic100-sub", sub.Name)
+			assert.Equal(t, int32(7), *sub.CountDetails.ActiveMessageCount)
+			assert.Equal(t, int32(1), *sub.CountDetails.DeadLetterMessageCount)
+		}
+	}
+	assert.Equal(t, 2, requests["/$Resources/Topics"])
+	assert.Equal(t, 1, requests["/topic0/subscriptions"])
+	assert.True(t, maxInFlight <= maxConcurrentListings, "%d listings were in flight at once", maxInFlight)
+}
+
+func TestTopicManager_ListWithSubscriptionsReturnsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/$Resources/Topics" {
+			_, _ = w.Write([]byte(atomFeed([]string{atomEntry("topic", `<TopicDescription/>`)})))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`<Error><Code>401</Code><Detail>Unauthorized</Detail></Error>`))
+	}))
+	defer server.Close()
+
+	tm := &TopicManager{entityManager: newEntityManager(server.URL+"/", staticTokenProvider("token"))}
+	_, err := tm.ListWithSubscriptions(context.Background())
+	assert.Error(t, err)
+}
@@ -24,91 +24,248 @@ package servicebus
 
 import (
 	"context"
-	"net/http"
+	"errors"
 	"os"
+	"sync"
+)
+
+const (
+	componentAttribute    = "component"
+	spanKindAttribute     = "span.kind"
+	destinationAttribute  = "message_bus.destination"
+	peerHostnameAttribute = "peer.hostname"
+)
+
+type (
+	// Tracer starts the spans tracing the operations of a namespace. It decouples the package from any particular
+	// tracing library: OpenTracingTracer adapts an opentracing Tracer and the oteltracing package adapts an
+	// OpenTelemetry Tracer. Namespaces without a Tracer use the global opentracing tracer.
+	Tracer interface {
+		// StartSpan starts a span for the operation as a child of the span in the context, if any, and returns a copy of
+		// the context carrying the new span
+		StartSpan(ctx context.Context, operationName string) (context.Context, Span)
+	}
+
+	// Span is an operation traced by a Tracer
+	Span interface {
+		// SetAttribute records a key and value describing the operation
+		SetAttribute(key string, value interface{})
+		// End completes the span
+		End()
+	}
+
+	// textMapWriter is a carrier, such as a message, which trace context can be written to as string keys and values
+	textMapWriter interface {
+		Set(key, value string)
+	}
+
+	// textMapReader is a carrier, such as a received message, which trace context can be read from
+	textMapReader interface {
+		ForeachKey(handler func(key, value string) error) error
+	}
+
+	// noopTracer is implemented by Tracers which can tell they record nothing, so spans need not be started at all
+	noopTracer interface {
+		isNoop() bool
+	}
+
+	// wireTracer is implemented by Tracers which can continue a trace carried on a received message. It reports false
+	// if the carrier holds no trace context.
+	wireTracer interface {
+		startSpanFromWire(ctx context.Context, operationName string, carrier textMapReader) (context.Context, Span, bool)
+	}
 
-	"github.com/opentracing/opentracing-go"
-	tag "github.com/opentracing/opentracing-go/ext"
+	// injectingSpan is implemented by Spans whose context can be carried on a sent message
+	injectingSpan interface {
+		inject(carrier textMapWriter) error
+	}
+
+	// baggageSpan is implemented by Spans which carry baggage items to the spans following them
+	baggageSpan interface {
+		foreachBaggageItem(handler func(key, value string) bool)
+		setBaggageItem(key, value string)
+	}
+
+	nopSpan struct{}
 )
 
-func (ns *Namespace) startSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operationName, opts...)
+var (
+	// noopSpan is handed out in place of a real span when tracing is off, so callers need not check
+	noopSpan Span = nopSpan{}
+
+	hostnameOnce sync.Once
+	hostname     string
+)
+
+// NamespaceWithTracingDisabled stops the namespace and the entities created from it from starting spans, avoiding their
+// overhead on hot paths such as sending and settling messages. Spans are already skipped while the global tracer is
+// the opentracing no-op tracer.
+func NamespaceWithTracingDisabled() NamespaceOption {
+	return func(ns *Namespace) error {
+		ns.tracingDisabled = true
+		return nil
+	}
+}
+
+// NamespaceWithTracer traces the operations of the namespace, and of the entities created from it, with the Tracer
+// rather than the global opentracing tracer
+func NamespaceWithTracer(tracer Tracer) NamespaceOption {
+	return func(ns *Namespace) error {
+		if tracer == nil {
+			return errors.New("tracer must not be nil")
+		}
+		ns.tracer = tracer
+		return nil
+	}
+}
+
+// tracerOf returns the Tracer of the namespace, which may be nil, or else the global opentracing tracer
+func tracerOf(ns *Namespace) Tracer {
+	if ns != nil && ns.tracer != nil {
+		return ns.tracer
+	}
+	return openTracingTracer{}
+}
+
+// startSpan starts a span with the Tracer of the namespace, which may be nil
+func startSpan(ns *Namespace, ctx context.Context, operationName string) (Span, context.Context) {
+	ctx, span := tracerOf(ns).StartSpan(ctx, operationName)
+	return span, ctx
+}
+
+// tracingEnabled reports whether spans should be started for operations of the namespace, which may be nil
+func tracingEnabled(ns *Namespace) bool {
+	if ns != nil && ns.tracingDisabled {
+		return false
+	}
+	if t, ok := tracerOf(ns).(noopTracer); ok {
+		return !t.isNoop()
+	}
+	return true
+}
+
+func (ns *Namespace) startSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(ns) {
+		return noopSpan, ctx
+	}
+	span, ctx := startSpan(ns, ctx, operationName)
 	applyComponentInfo(span)
 	return span, ctx
 }
 
-func (m *Message) startSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operationName, opts...)
+func (m *Message) startSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(m.namespace) {
+		return noopSpan, ctx
+	}
+	span, ctx := startSpan(m.namespace, ctx, operationName)
 	applyComponentInfo(span)
-	span.SetTag("amqp.message-id", m.ID)
+	span.SetAttribute("amqp.message-id", m.ID)
 	if m.GroupID != nil {
-		span.SetTag("amqp.message-group-id", *m.GroupID)
+		span.SetAttribute("amqp.message-group-id", *m.GroupID)
 	}
 	if m.GroupSequence != nil {
-		span.SetTag("amqp.message-group-sequence", *m.GroupSequence)
+		span.SetAttribute("amqp.message-group-sequence", *m.GroupSequence)
 	}
 	return span, ctx
 }
 
-func (em *entityManager) startSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operationName, opts...)
+func (em *entityManager) startSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(em.namespace) {
+		return noopSpan, ctx
+	}
+	span, ctx := startSpan(em.namespace, ctx, operationName)
 	applyComponentInfo(span)
-	tag.SpanKindRPCClient.Set(span)
+	span.SetAttribute(spanKindAttribute, "client")
 	return span, ctx
 }
 
-func applyRequestInfo(span opentracing.Span, req *http.Request) {
-	tag.HTTPUrl.Set(span, req.URL.String())
-	tag.HTTPMethod.Set(span, req.Method)
-}
-
-func applyResponseInfo(span opentracing.Span, res *http.Response) {
-	if res != nil {
-		tag.HTTPStatusCode.Set(span, uint16(res.StatusCode))
+func (s *entity) startSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(s.namespace) {
+		return noopSpan, ctx
 	}
+	span, ctx := startSpan(s.namespace, ctx, operationName)
+	applyComponentInfo(span)
+	return span, ctx
 }
 
-func (s *entity) startSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operationName, opts...)
+func (fs *FailoverSender) startSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(nil) {
+		return noopSpan, ctx
+	}
+	span, ctx := startSpan(nil, ctx, operationName)
 	applyComponentInfo(span)
+	span.SetAttribute(spanKindAttribute, "producer")
 	return span, ctx
 }
 
-func (s *sender) startProducerSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operationName, opts...)
+func (s *sender) startProducerSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(s.namespace) {
+		return noopSpan, ctx
+	}
+	span, ctx := startSpan(s.namespace, ctx, operationName)
 	applyComponentInfo(span)
-	tag.SpanKindProducer.Set(span)
-	tag.MessageBusDestination.Set(span, s.getFullIdentifier())
+	span.SetAttribute(spanKindAttribute, "producer")
+	span.SetAttribute(destinationAttribute, s.getFullIdentifier())
 	return span, ctx
 }
 
-func (r *receiver) startConsumerSpanFromContext(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operationName, opts...)
-	applyComponentInfo(span)
-	tag.SpanKindConsumer.Set(span)
-	tag.MessageBusDestination.Set(span, r.entityPath)
+func (r *receiver) startConsumerSpanFromContext(ctx context.Context, operationName string) (Span, context.Context) {
+	if !tracingEnabled(r.namespace) {
+		return noopSpan, ctx
+	}
+	span, ctx := startSpan(r.namespace, ctx, operationName)
+	r.applyConsumerInfo(span)
 	return span, ctx
 }
 
-func (r *receiver) startConsumerSpanFromWire(ctx context.Context, operationName string, reference opentracing.SpanContext, opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
-	opts = append(opts, opentracing.FollowsFrom(reference))
-	span := opentracing.StartSpan(operationName, opts...)
-	ctx = opentracing.ContextWithSpan(ctx, span)
+// startConsumerSpanFromWire starts a span following the trace carried on the received message, if the Tracer can read
+// it, or else a span in the trace of the context
+func (r *receiver) startConsumerSpanFromWire(ctx context.Context, operationName string, carrier textMapReader) (Span, context.Context) {
+	if !tracingEnabled(r.namespace) {
+		return noopSpan, ctx
+	}
+	wt, ok := tracerOf(r.namespace).(wireTracer)
+	if !ok {
+		return r.startConsumerSpanFromContext(ctx, operationName)
+	}
+	wireCtx, span, ok := wt.startSpanFromWire(ctx, operationName, carrier)
+	if !ok {
+		return r.startConsumerSpanFromContext(ctx, operationName)
+	}
+	r.applyConsumerInfo(span)
+	return span, wireCtx
+}
+
+func (r *receiver) applyConsumerInfo(span Span) {
 	applyComponentInfo(span)
-	tag.SpanKindConsumer.Set(span)
-	tag.MessageBusDestination.Set(span, r.entityPath)
-	return span, ctx
+	span.SetAttribute(spanKindAttribute, "consumer")
+	span.SetAttribute(destinationAttribute, r.entityPath)
 }
 
-func applyComponentInfo(span opentracing.Span) {
-	tag.Component.Set(span, "github.com/Azure/azure-service-bus-go")
-	span.SetTag("version", Version)
+// injectSpan writes the context of the span to the carrier, if the span supports it, so the receiver of the message
+// can continue its trace
+func injectSpan(span Span, carrier textMapWriter) error {
+	if is, ok := span.(injectingSpan); ok {
+		return is.inject(carrier)
+	}
+	return nil
+}
+
+func applyComponentInfo(span Span) {
+	span.SetAttribute(componentAttribute, "github.com/Azure/azure-service-bus-go")
+	span.SetAttribute("version", Version)
 	applyNetworkInfo(span)
 }
 
-func applyNetworkInfo(span opentracing.Span) {
-	hostname, err := os.Hostname()
-	if err == nil {
-		tag.PeerHostname.Set(span, hostname)
+func applyNetworkInfo(span Span) {
+	hostnameOnce.Do(func() {
+		hostname, _ = os.Hostname()
+	})
+	if hostname != "" {
+		span.SetAttribute(peerHostnameAttribute, hostname)
 	}
 }
+
+func (nopSpan) SetAttribute(string, interface{}) {}
+
+func (nopSpan) End() {}
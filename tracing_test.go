@@ -0,0 +1,162 @@
+package servicebus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceWithTracingDisabled(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	traced, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+	untraced, err := NewNamespace(NamespaceWithTracingDisabled())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	span, _ := traced.startSpanFromContext(context.Background(), "traced")
+	span.End()
+	span, ctx := untraced.startSpanFromContext(context.Background(), "untraced")
+	span.End()
+	assert.Equal(t, noopSpan, span)
+	assert.Nil(t, opentracing.SpanFromContext(ctx))
+
+	msg := &Message{namespace: untraced}
+	span, _ = msg.startSpanFromContext(context.Background(), "settle")
+	assert.Equal(t, noopSpan, span)
+
+	if finished := tracer.FinishedSpans(); assert.Len(t, finished, 1) {
+		assert.Equal(t, "traced", finished[0].OperationName)
+	}
+}
+
+func TestTracingSkippedWithNoopTracer(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.False(t, tracingEnabled(ns))
+	span, _ := ns.startSpanFromContext(context.Background(), "noop")
+	assert.Equal(t, noopSpan, span)
+}
+
+type (
+	recordingTracer struct {
+		spans []*recordingSpan
+	}
+
+	recordingSpan struct {
+		name       string
+		attributes map[string]interface{}
+		ended      bool
+	}
+)
+
+func (rt *recordingTracer) StartSpan(ctx context.Context, operationName string) (context.Context, Span) {
+	span := &recordingSpan{name: operationName, attributes: make(map[string]interface{})}
+	rt.spans = append(rt.spans, span)
+	return ctx, span
+}
+
+func (rs *recordingSpan) SetAttribute(key string, value interface{}) {
+	rs.attributes[key] = value
+}
+
+func (rs *recordingSpan) End() {
+	rs.ended = true
+}
+
+func TestNamespaceWithTracer(t *testing.T) {
+	tracer := new(recordingTracer)
+	ns, err := NewNamespace(NamespaceWithTracer(tracer))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := &Message{ID: "abc", namespace: ns}
+	span, _ := msg.startSpanFromContext(context.Background(), "sb.Message.Complete")
+	span.End()
+
+	if assert.Len(t, tracer.spans, 1) {
+		recorded := tracer.spans[0]
+		assert.Equal(t, "sb.Message.Complete", recorded.name)
+		assert.True(t, recorded.ended)
+		assert.Equal(t, "abc", recorded.attributes["amqp.message-id"])
+		assert.Equal(t, Version, recorded.attributes["version"])
+	}
+
+	_, err = NewNamespace(NamespaceWithTracer(nil))
+	assert.Error(t, err)
+}
+
+func TestOpenTracingTracer(t *testing.T) {
+	tracer := mocktracer.New()
+	ns, err := NewNamespace(NamespaceWithTracer(OpenTracingTracer(tracer)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	parent, ctx := ns.startSpanFromContext(context.Background(), "parent")
+	child, _ := ns.startSpanFromContext(ctx, "child")
+	child.End()
+	parent.End()
+
+	if finished := tracer.FinishedSpans(); assert.Len(t, finished, 2) {
+		assert.Equal(t, "child", finished[0].OperationName)
+		assert.Equal(t, finished[1].SpanContext.SpanID, finished[0].ParentID)
+	}
+}
+
+func TestOpenTracingTracerContinuesTraceFromWire(t *testing.T) {
+	tracer := mocktracer.New()
+	ns, err := NewNamespace(NamespaceWithTracer(OpenTracingTracer(tracer)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := NewMessageFromString("hello")
+	send, _ := ns.startSpanFromContext(context.Background(), "send")
+	assert.NoError(t, injectSpan(send, msg))
+	send.End()
+
+	r := &receiver{namespace: ns, entityPath: "queue"}
+	receive, _ := r.startConsumerSpanFromWire(context.Background(), "receive", msg)
+	receive.End()
+	unsent, _ := r.startConsumerSpanFromWire(context.Background(), "unsent", NewMessageFromString("no context"))
+	unsent.End()
+
+	if finished := tracer.FinishedSpans(); assert.Len(t, finished, 3) {
+		assert.Equal(t, finished[0].SpanContext.TraceID, finished[1].SpanContext.TraceID)
+		assert.Equal(t, "queue", finished[1].Tag(destinationAttribute))
+		assert.NotEqual(t, finished[0].SpanContext.TraceID, finished[2].SpanContext.TraceID)
+	}
+}
+
+func TestTracerWithoutWireSupportStartsSpansFromContext(t *testing.T) {
+	tracer := new(recordingTracer)
+	ns, err := NewNamespace(NamespaceWithTracer(tracer))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := NewMessageFromString("hello")
+	send, _ := ns.startSpanFromContext(context.Background(), "send")
+	assert.NoError(t, injectSpan(send, msg))
+	r := &receiver{namespace: ns, entityPath: "queue"}
+	receive, _ := r.startConsumerSpanFromWire(context.Background(), "receive", msg)
+	receive.End()
+
+	if assert.Len(t, tracer.spans, 2) {
+		assert.Equal(t, "consumer", tracer.spans[1].attributes[spanKindAttribute])
+	}
+}
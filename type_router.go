@@ -0,0 +1,131 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	// TypeRouter is a Handler which dispatches each message to the handler registered for its type, which is its Label
+	// unless the router is configured to read it from a user property. Messages of a type without a handler are passed
+	// to the fallback handler, which dead-letters them by default.
+	TypeRouter struct {
+		mu           sync.RWMutex
+		typeProperty string
+		handlers     map[string]Handler
+		fallback     Handler
+	}
+
+	// TypeRouterOption provides a way to customize a TypeRouter
+	TypeRouterOption func(*TypeRouter) error
+)
+
+// TypeRouterWithTypeProperty configures the TypeRouter to read the type of each message from the user property with
+// the key, rather than from its Label
+func TypeRouterWithTypeProperty(key string) TypeRouterOption {
+	return func(tr *TypeRouter) error {
+		if key == "" {
+			return errors.New("type property key must not be empty")
+		}
+		tr.typeProperty = key
+		return nil
+	}
+}
+
+// TypeRouterWithFallback configures the handler called for messages whose type has no registered handler, including
+// messages without a type. By default, they are dead-lettered with an ErrUnknownMessageType.
+func TypeRouterWithFallback(handler Handler) TypeRouterOption {
+	return func(tr *TypeRouter) error {
+		if handler == nil {
+			return errors.New("handler must not be nil")
+		}
+		tr.fallback = handler
+		return nil
+	}
+}
+
+// NewTypeRouter creates a TypeRouter without any registered handlers
+func NewTypeRouter(opts ...TypeRouterOption) (*TypeRouter, error) {
+	tr := &TypeRouter{handlers: make(map[string]Handler)}
+	tr.fallback = HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+		return msg.DeadLetter(ErrUnknownMessageType{Type: tr.messageType(msg)})
+	})
+
+	for _, opt := range opts {
+		if err := opt(tr); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+// Register registers the handler for messages of the type. Each type may only have one handler.
+func (tr *TypeRouter) Register(messageType string, handler Handler) error {
+	if messageType == "" {
+		return errors.New("message type must not be empty")
+	}
+	if handler == nil {
+		return errors.New("handler must not be nil")
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if _, ok := tr.handlers[messageType]; ok {
+		return fmt.Errorf("a handler is already registered for message type %q", messageType)
+	}
+	tr.handlers[messageType] = handler
+	return nil
+}
+
+// Handle passes the message to the handler registered for its type, or to the fallback handler
+func (tr *TypeRouter) Handle(ctx context.Context, msg *Message) DispositionAction {
+	tr.mu.RLock()
+	handler, ok := tr.handlers[tr.messageType(msg)]
+	tr.mu.RUnlock()
+
+	if !ok {
+		return tr.fallback.Handle(ctx, msg)
+	}
+	return handler.Handle(ctx, msg)
+}
+
+// messageType returns the type of the message, which is empty if it has none
+func (tr *TypeRouter) messageType(msg *Message) string {
+	if tr.typeProperty == "" {
+		return msg.Label
+	}
+
+	value, ok := msg.UserProperties[tr.typeProperty]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,94 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypeRouter_DispatchesByLabel(t *testing.T) {
+	var handled []string
+	record := func(name string) Handler {
+		return HandlerFunc(func(_ context.Context, msg *Message) DispositionAction {
+			handled = append(handled, name+":"+msg.ID)
+			return nil
+		})
+	}
+
+	router, err := NewTypeRouter(TypeRouterWithFallback(record("fallback")))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, router.Register("OrderPlaced", record("placed")))
+	assert.NoError(t, router.Register("OrderShipped", record("shipped")))
+	assert.Error(t, router.Register("OrderPlaced", record("again")), "each type has one handler")
+	assert.Error(t, router.Register("", record("empty")))
+	assert.Error(t, router.Register("OrderCancelled", nil))
+
+	for id, label := range map[string]string{"a": "OrderPlaced", "b": "OrderShipped", "c": "OrderRefunded", "d": ""} {
+		msg := NewMessageFromString("payload")
+		msg.ID, msg.Label = id, label
+		assert.Nil(t, router.Handle(context.Background(), msg))
+	}
+	sort.Strings(handled)
+	assert.Equal(t, []string{"fallback:c", "fallback:d", "placed:a", "shipped:b"}, handled)
+}
+
+func TestTypeRouter_DispatchesByTypeProperty(t *testing.T) {
+	router, err := NewTypeRouter(TypeRouterWithTypeProperty("type"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var handled int
+	assert.NoError(t, router.Register("42", HandlerFunc(func(context.Context, *Message) DispositionAction {
+		handled++
+		return nil
+	})))
+
+	msg := NewMessageFromString("payload")
+	msg.Label = "ignored"
+	msg.UserProperties = map[string]interface{}{"type": int64(42)}
+	assert.Nil(t, router.Handle(context.Background(), msg))
+	assert.Equal(t, 1, handled)
+
+	// unknown types are dead-lettered by default
+	msg.UserProperties["type"] = "43"
+	assert.NotNil(t, router.Handle(context.Background(), msg))
+	assert.Equal(t, "43", router.messageType(msg))
+	assert.Equal(t, 1, handled)
+}
+
+func TestNewTypeRouter_RejectsInvalidOptions(t *testing.T) {
+	_, err := NewTypeRouter(TypeRouterWithTypeProperty(""))
+	assert.Error(t, err)
+	_, err = NewTypeRouter(TypeRouterWithFallback(nil))
+	assert.Error(t, err)
+
+	assert.Equal(t, `no handler is registered for message type "OrderRefunded"`, ErrUnknownMessageType{Type: "OrderRefunded"}.Error())
+	assert.Equal(t, "message has no type to route it to a handler by", ErrUnknownMessageType{}.Error())
+}
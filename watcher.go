@@ -0,0 +1,176 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+const defaultWatchInterval = 30 * time.Second
+
+type (
+	// Watcher polls the number of active messages in an entity at an interval and emits a ThresholdEvent each time the
+	// count crosses one of the configured thresholds. It is intended to feed autoscalers which add consumers as a
+	// queue backs up and remove them as it drains.
+	Watcher struct {
+		EntityPath string
+		namespace  *Namespace
+		depth      func(ctx context.Context) (int64, error)
+		interval   time.Duration
+		thresholds []int64
+	}
+
+	// WatcherOption configures a Watcher
+	WatcherOption func(*Watcher) error
+
+	// ThresholdEvent describes the active message count of an entity crossing a threshold
+	ThresholdEvent struct {
+		EntityPath string
+		// ActiveMessageCount is the count which crossed the threshold
+		ActiveMessageCount int64
+		// PreviousCount is the count observed by the previous poll, or 0 for the first poll
+		PreviousCount int64
+		// Threshold is the furthest threshold crossed since the previous poll
+		Threshold int64
+		// Rising is true when the count rose to or above the threshold and false when it fell below it
+		Rising bool
+	}
+
+	// ThresholdHandler is called for each ThresholdEvent emitted by a Watcher
+	ThresholdHandler func(ctx context.Context, event ThresholdEvent)
+)
+
+// WatcherWithInterval configures how often the Watcher polls the entity. The default is 30 seconds.
+func WatcherWithInterval(interval time.Duration) WatcherOption {
+	return func(w *Watcher) error {
+		if interval <= 0 {
+			return errors.New("watch interval must be greater than 0")
+		}
+		w.interval = interval
+		return nil
+	}
+}
+
+// WatcherWithThresholds configures the active message counts at which the Watcher emits events
+func WatcherWithThresholds(thresholds ...int64) WatcherOption {
+	return func(w *Watcher) error {
+		w.thresholds = append(w.thresholds, thresholds...)
+		return nil
+	}
+}
+
+// NewQueueWatcher creates a Watcher for the active message count of a queue
+func (ns *Namespace) NewQueueWatcher(queueName string, opts ...WatcherOption) (*Watcher, error) {
+	qm := ns.NewQueueManager()
+	return ns.newWatcher(queueName, func(ctx context.Context) (int64, error) {
+		qe, err := qm.Get(ctx, queueName)
+		if err != nil {
+			return 0, err
+		}
+		if qe == nil {
+			return 0, fmt.Errorf("queue %q does not exist", queueName)
+		}
+		if qe.CountDetails == nil || qe.CountDetails.ActiveMessageCount == nil {
+			return 0, ErrMissingField("ActiveMessageCount")
+		}
+		return int64(*qe.CountDetails.ActiveMessageCount), nil
+	}, opts...)
+}
+
+func (ns *Namespace) newWatcher(entityPath string, depth func(ctx context.Context) (int64, error), opts ...WatcherOption) (*Watcher, error) {
+	w := &Watcher{
+		EntityPath: entityPath,
+		namespace:  ns,
+		depth:      depth,
+		interval:   defaultWatchInterval,
+	}
+
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(w.thresholds) == 0 {
+		return nil, errors.New("at least one threshold must be configured")
+	}
+	sort.Slice(w.thresholds, func(i, j int) bool { return w.thresholds[i] < w.thresholds[j] })
+	return w, nil
+}
+
+// Watch polls the entity until the context is done, calling the handler whenever the active message count crosses a
+// threshold. The first poll reports the highest threshold already reached, if any. Errors while polling are logged and
+// the entity is polled again at the next interval.
+func (w *Watcher) Watch(ctx context.Context, handler ThresholdHandler) error {
+	span, ctx := w.namespace.startSpanFromContext(ctx, "sb.Watcher.Watch")
+	defer span.End()
+
+	var previous int64
+	for {
+		count, err := w.depth(ctx)
+		if err != nil {
+			log.For(ctx).Error(err)
+		} else {
+			if event, ok := w.crossed(previous, count); ok {
+				handler(ctx, event)
+			}
+			previous = count
+		}
+
+		if err := w.namespace.sleep(ctx, w.interval); err != nil {
+			return err
+		}
+	}
+}
+
+// crossed builds the event for a change in count from previous, if the change crosses a threshold
+func (w *Watcher) crossed(previous, count int64) (ThresholdEvent, bool) {
+	before, after := w.level(previous), w.level(count)
+	if before == after {
+		return ThresholdEvent{}, false
+	}
+
+	event := ThresholdEvent{
+		EntityPath:         w.EntityPath,
+		ActiveMessageCount: count,
+		PreviousCount:      previous,
+		Rising:             after > before,
+	}
+	if event.Rising {
+		event.Threshold = w.thresholds[after-1]
+	} else {
+		event.Threshold = w.thresholds[after]
+	}
+	return event, true
+}
+
+// level returns the number of thresholds reached by the count
+func (w *Watcher) level(count int64) int {
+	return sort.Search(len(w.thresholds), func(i int) bool { return w.thresholds[i] > count })
+}
@@ -0,0 +1,68 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher_EmitsThresholdCrossings(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	ns, err := NewNamespace(NamespaceWithClock(clock))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	counts := []int64{150, 120, 600, 1200, 40, 40}
+	polls := 0
+	w, err := ns.newWatcher("foo", func(context.Context) (int64, error) {
+		defer func() { polls++ }()
+		if polls == 2 {
+			return 0, errors.New("transient")
+		}
+		return counts[polls], nil
+	}, WatcherWithInterval(time.Second), WatcherWithThresholds(1000, 100, 500))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var events []ThresholdEvent
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(ctx, func(_ context.Context, event ThresholdEvent) {
+			events = append(events, event)
+			if len(events) == 3 {
+				cancel()
+			}
+		})
+	}()
+
+	for i := 1; i < len(counts); i++ {
+		clock.waitForCalls(i)
+		clock.Advance(time.Second)
+	}
+	assert.Equal(t, context.Canceled, <-done)
+
+	assert.Equal(t, []ThresholdEvent{
+		{EntityPath: "foo", ActiveMessageCount: 150, PreviousCount: 0, Threshold: 100, Rising: true},
+		{EntityPath: "foo", ActiveMessageCount: 1200, PreviousCount: 120, Threshold: 1000, Rising: true},
+		{EntityPath: "foo", ActiveMessageCount: 40, PreviousCount: 1200, Threshold: 100, Rising: false},
+	}, events)
+}
+
+func TestWatcher_RequiresThresholds(t *testing.T) {
+	ns, err := NewNamespace()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = ns.NewQueueWatcher("foo")
+	assert.Error(t, err)
+
+	_, err = ns.NewQueueWatcher("foo", WatcherWithThresholds(1), WatcherWithInterval(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"pack.ag/amqp"
+)
+
+const (
+	webSocketPath     = "/$servicebus/websocket"
+	webSocketProtocol = "AMQPWSB10"
+
+	// webSocketDialTimeout bounds opening a WebSocket, including any proxy tunnel and the TLS and WebSocket handshakes
+	webSocketDialTimeout = 30 * time.Second
+)
+
+func (ns *Namespace) getWebSocketURI() string {
+	return fmt.Sprintf("wss://%s%s", ns.getHostName(), webSocketPath)
+}
+
+// newWebSocketConnection opens an AMQP connection tunnelled through a WebSocket to the namespace
+func (ns *Namespace) newWebSocketConnection() (*amqp.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webSocketDialTimeout)
+	defer cancel()
+
+	host := ns.getHostName()
+	conn, err := dialWebSocket(ctx, ns.getWebSocketURI(), ns.getHTTPSHostURI(), &tls.Config{ServerName: host}, http.ProxyFromEnvironment)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := amqp.New(conn, append(ns.connOptions(), amqp.ConnServerHostname(host))...)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// dialWebSocket opens a WebSocket speaking the AMQP sub-protocol to location, tunnelling through the proxy returned for
+// the location, if any. It gives up once the context is done.
+func dialWebSocket(ctx context.Context, location, origin string, tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) (net.Conn, error) {
+	config, err := websocket.NewConfig(location, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{webSocketProtocol}
+
+	secure := config.Location.Scheme == "wss"
+	addr := hostWithPort(config.Location, secure)
+	httpScheme := "http"
+	if secure {
+		httpScheme = "https"
+	}
+	proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: httpScheme, Host: config.Location.Host}})
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialTCP(ctx, addr, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	var ws *websocket.Conn
+	err = handshake(ctx, conn, func() error {
+		var err error
+		ws, err = websocket.NewClient(config, conn)
+		return err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
+
+// dialTCP connects to addr directly, or through an HTTP CONNECT tunnel when a proxy is provided. It gives up once the
+// context is done.
+func dialTCP(ctx context.Context, addr string, proxy *url.URL) (net.Conn, error) {
+	if proxy == nil {
+		return new(net.Dialer).DialContext(ctx, "tcp", addr)
+	}
+
+	secure := proxy.Scheme == "https"
+	var conn net.Conn
+	var err error
+	if secure {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: proxy.Hostname()}}
+		conn, err = dialer.DialContext(ctx, "tcp", hostWithPort(proxy, secure))
+	} else {
+		conn, err = new(net.Dialer).DialContext(ctx, "tcp", hostWithPort(proxy, secure))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	var res *http.Response
+	err = handshake(ctx, conn, func() error {
+		if err := req.Write(conn); err != nil {
+			return err
+		}
+		// the tunnel is silent until the client speaks, so nothing past the response is buffered by the reader
+		var err error
+		res, err = http.ReadResponse(bufio.NewReader(conn), req)
+		return err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", proxy.Host, addr, res.Status)
+	}
+	return conn, nil
+}
+
+// handshake runs an exchange over the connection, interrupting it by expiring the connection's deadline if the context
+// is done first. The connection is unusable after an interrupted exchange.
+func handshake(ctx context.Context, conn net.Conn, exchange func() error) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	err := exchange()
+	if !stop() {
+		return ctx.Err()
+	}
+	return err
+}
+
+// hostWithPort returns the host of u, adding the default HTTP or HTTPS port when it has none
+func hostWithPort(u *url.URL, secure bool) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if secure {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,203 @@
+package servicebus
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/auth"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func newEchoWebSocketServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			assert.Equal(t, webSocketPath, r.URL.Path)
+			assert.Equal(t, []string{webSocketProtocol}, config.Protocol)
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			_, _ = io.Copy(ws, ws)
+		},
+	})
+}
+
+// newConnectProxy tunnels CONNECT requests which carry the expected credentials, refusing all others
+func newConnectProxy(t *testing.T, credentials string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+		if r.Header.Get("Proxy-Authorization") != expected {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			_ = target.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(target, conn)
+			_ = target.Close()
+		}()
+		_, _ = io.Copy(conn, target)
+		_ = conn.Close()
+	}))
+}
+
+func noProxy(*http.Request) (*url.URL, error) {
+	return nil, nil
+}
+
+func assertEchoes(t *testing.T, conn net.Conn) {
+	payload := []byte{0x41, 0x4d, 0x51, 0x50, 0x00, 0x01, 0x00, 0x00}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write(payload)
+	if !assert.NoError(t, err) {
+		return
+	}
+	echoed := make([]byte, len(payload))
+	_, err = io.ReadFull(conn, echoed)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, echoed)
+}
+
+func TestDialWebSocket(t *testing.T) {
+	server := newEchoWebSocketServer(t)
+	defer server.Close()
+
+	location := "ws://" + strings.TrimPrefix(server.URL, "http://") + webSocketPath
+	conn, err := dialWebSocket(context.Background(), location, server.URL, nil, noProxy)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	assertEchoes(t, conn)
+}
+
+func TestDialWebSocketThroughProxy(t *testing.T) {
+	server := newEchoWebSocketServer(t)
+	defer server.Close()
+	proxy := newConnectProxy(t, "user:secret")
+	defer proxy.Close()
+
+	location := "ws://" + strings.TrimPrefix(server.URL, "http://") + webSocketPath
+	proxyURL, err := url.Parse(proxy.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	proxyURL.User = url.UserPassword("user", "secret")
+	conn, err := dialWebSocket(context.Background(), location, server.URL, nil, http.ProxyURL(proxyURL))
+	if assert.NoError(t, err) {
+		assertEchoes(t, conn)
+		_ = conn.Close()
+	}
+
+	proxyURL.User = url.UserPassword("user", "wrong")
+	_, err = dialWebSocket(context.Background(), location, server.URL, nil, http.ProxyURL(proxyURL))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "407")
+	}
+}
+
+func TestDialWebSocketGivesUpWithContext(t *testing.T) {
+	// a server which accepts connections but never answers the WebSocket handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer listener.Close()
+	stalled := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			stalled <- conn
+		}
+	}()
+	defer func() {
+		select {
+		case conn := <-stalled:
+			_ = conn.Close()
+		default:
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := dialWebSocket(ctx, "ws://"+listener.Addr().String()+webSocketPath, "http://localhost", nil, noProxy)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.DeadlineExceeded, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handshake was not interrupted when the context expired")
+	}
+}
+
+func TestHostWithPort(t *testing.T) {
+	assert.Equal(t, "foo.servicebus.windows.net:443", hostWithPort(&url.URL{Host: "foo.servicebus.windows.net"}, true))
+	assert.Equal(t, "proxy:80", hostWithPort(&url.URL{Host: "proxy"}, false))
+	assert.Equal(t, "proxy:3128", hostWithPort(&url.URL{Host: "proxy:3128"}, false))
+}
+
+func TestNamespaceWithWebSocketAndAzureActiveDirectory(t *testing.T) {
+	oauth, err := adal.NewOAuthConfig("https://login.microsoftonline.com/", "tenant")
+	if !assert.NoError(t, err) {
+		return
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+	spt, err := adal.NewServicePrincipalTokenFromManualToken(*oauth, "client", "https://servicebus.azure.net/", adal.Token{
+		AccessToken: "jwt",
+		ExpiresOn:   json.Number(strconv.FormatInt(expires, 10)),
+		Resource:    "https://servicebus.azure.net/",
+		Type:        "Bearer",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ns, err := NewNamespace(NamespaceWithWebSocket(), NamespaceWithAzureActiveDirectory(spt))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ns.Name = "foo"
+	assert.True(t, ns.useWebSocket)
+	assert.Equal(t, "wss://foo.servicebus.windows.net/$servicebus/websocket", ns.getWebSocketURI())
+
+	token, err := ns.TokenProvider.GetToken(ns.getEntityAudience("queue"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, auth.CBSTokenTypeJWT, token.TokenType)
+		assert.Equal(t, "jwt", token.Token)
+	}
+
+	_, err = NewNamespace(NamespaceWithAzureActiveDirectory(nil))
+	assert.Error(t, err)
+	_, err = NewNamespace(NamespaceWithTokenProvider(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-amqp-common-go/log"
+)
+
+type (
+	// Workflow is a SessionHandler which runs a state machine per session, such as the steps of a saga. Each session is
+	// an instance of the workflow; its current step and data are stored in the session state, so an instance can be
+	// resumed by any receiver once its session lock is released. Receive with ReceiveSessions or ReceiveOneSession on
+	// a session enabled Queue or Subscription.
+	Workflow struct {
+		initialStep string
+		mu          sync.RWMutex
+		steps       map[string]WorkflowStep
+		// stateOf resolves the session state store of the message being handled
+		stateOf func(ctx context.Context) (sessionStateStore, bool)
+	}
+
+	// WorkflowStep handles a message for an instance which is at the step. It moves the instance on with
+	// TransitionTo or Complete. If it returns an error, the message is abandoned and the state is left unchanged.
+	WorkflowStep func(ctx context.Context, instance *WorkflowInstance, msg *Message) error
+
+	// WorkflowInstance is the state of a workflow for one session
+	WorkflowInstance struct {
+		SessionID string
+		step      string
+		data      json.RawMessage
+		changed   bool
+		completed bool
+	}
+
+	workflowState struct {
+		Step string          `json:"step"`
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+
+	sessionStateStore interface {
+		State(ctx context.Context) ([]byte, error)
+		SetState(ctx context.Context, state []byte) error
+	}
+)
+
+// NewWorkflow creates a Workflow whose instances start at the initial step
+func NewWorkflow(initialStep string) *Workflow {
+	return &Workflow{
+		initialStep: initialStep,
+		steps:       make(map[string]WorkflowStep),
+		stateOf: func(ctx context.Context) (sessionStateStore, bool) {
+			return MessageSessionFromContext(ctx)
+		},
+	}
+}
+
+// AddStep registers the handler for messages received by instances at the named step
+func (w *Workflow) AddStep(name string, step WorkflowStep) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.steps[name] = step
+}
+
+// Start is called when a session is accepted and does nothing, since the state is loaded for each message
+func (w *Workflow) Start(*MessageSession) error {
+	return nil
+}
+
+// End is called when a session is released and does nothing
+func (w *Workflow) End() {}
+
+// Handle loads the instance of the session the message belongs to, passes the message to the step the instance is at
+// and stores the resulting state before completing the message. Messages for a step with no handler are
+// dead-lettered.
+func (w *Workflow) Handle(ctx context.Context, msg *Message) DispositionAction {
+	store, ok := w.stateOf(ctx)
+	if !ok {
+		err := errors.New("workflow messages must be received from a session")
+		log.For(ctx).Error(err)
+		return msg.DeadLetter(err)
+	}
+
+	instance, err := w.load(ctx, store, msg)
+	if err != nil {
+		log.For(ctx).Error(err)
+		return msg.Abandon()
+	}
+
+	w.mu.RLock()
+	step, ok := w.steps[instance.step]
+	w.mu.RUnlock()
+	if !ok {
+		err := fmt.Errorf("workflow has no step %q", instance.step)
+		log.For(ctx).Error(err)
+		return msg.DeadLetter(err)
+	}
+
+	if err := step(ctx, instance, msg); err != nil {
+		log.For(ctx).Error(err)
+		return msg.Abandon()
+	}
+
+	if err := w.save(ctx, store, instance); err != nil {
+		log.For(ctx).Error(err)
+		return msg.Abandon()
+	}
+	return msg.Complete()
+}
+
+func (w *Workflow) load(ctx context.Context, store sessionStateStore, msg *Message) (*WorkflowInstance, error) {
+	instance := &WorkflowInstance{step: w.initialStep}
+	if msg.GroupID != nil {
+		instance.SessionID = *msg.GroupID
+	}
+
+	raw, err := store.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		return instance, nil
+	}
+
+	var state workflowState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("session %q does not hold workflow state: %v", instance.SessionID, err)
+	}
+	instance.step = state.Step
+	instance.data = state.Data
+	return instance, nil
+}
+
+func (w *Workflow) save(ctx context.Context, store sessionStateStore, instance *WorkflowInstance) error {
+	if instance.completed {
+		// clearing the state lets the session ID start a new instance
+		return store.SetState(ctx, nil)
+	}
+
+	if !instance.changed {
+		return nil
+	}
+
+	raw, err := json.Marshal(workflowState{Step: instance.step, Data: instance.data})
+	if err != nil {
+		return err
+	}
+	return store.SetState(ctx, raw)
+}
+
+// Step returns the step the instance is at
+func (wi *WorkflowInstance) Step() string {
+	return wi.step
+}
+
+// TransitionTo moves the instance to the step, which handles the next message of the session
+func (wi *WorkflowInstance) TransitionTo(step string) {
+	wi.step = step
+	wi.changed = true
+}
+
+// Complete finishes the instance and clears its state
+func (wi *WorkflowInstance) Complete() {
+	wi.completed = true
+}
+
+// Data unmarshals the data stored with the instance into v. If no data has been stored, v is left unchanged.
+func (wi *WorkflowInstance) Data(v interface{}) error {
+	if len(wi.data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(wi.data, v)
+}
+
+// SetData stores v, marshaled to JSON, with the instance
+func (wi *WorkflowInstance) SetData(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	wi.data = data
+	wi.changed = true
+	return nil
+}
@@ -0,0 +1,121 @@
+package servicebus
+
+//	MIT License
+//
+//	Copyright (c) Microsoft Corporation. All rights reserved.
+//
+//	Permission is hereby granted, free of charge, to any person obtaining a copy
+//	of this software and associated documentation files (the "Software"), to deal
+//	in the Software without restriction, including without limitation the rights
+//	to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+//	copies of the Software, and to permit persons to whom the Software is
+//	furnished to do so, subject to the following conditions:
+//
+//	The above copyright notice and this permission notice shall be included in all
+//	copies or substantial portions of the Software.
+//
+//	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+//	IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+//	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+//	AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+//	LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+//	OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+//	SOFTWARE
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySessionState struct {
+	state []byte
+	sets  int
+}
+
+func (ms *memorySessionState) State(context.Context) ([]byte, error) {
+	return ms.state, nil
+}
+
+func (ms *memorySessionState) SetState(_ context.Context, state []byte) error {
+	ms.sets++
+	ms.state = state
+	return nil
+}
+
+type order struct {
+	Items int `json:"items"`
+}
+
+func newOrderWorkflow(store *memorySessionState) *Workflow {
+	wf := NewWorkflow("created")
+	wf.stateOf = func(context.Context) (sessionStateStore, bool) {
+		return store, true
+	}
+
+	wf.AddStep("created", func(_ context.Context, instance *WorkflowInstance, msg *Message) error {
+		if err := instance.SetData(order{Items: len(msg.Data)}); err != nil {
+			return err
+		}
+		instance.TransitionTo("paid")
+		return nil
+	})
+	wf.AddStep("paid", func(_ context.Context, instance *WorkflowInstance, msg *Message) error {
+		if string(msg.Data) == "fail" {
+			return errors.New("payment provider unavailable")
+		}
+		var o order
+		if err := instance.Data(&o); err != nil {
+			return err
+		}
+		if o.Items != 3 {
+			return errors.New("order data was not restored")
+		}
+		instance.Complete()
+		return nil
+	})
+	return wf
+}
+
+func TestWorkflow_Transitions(t *testing.T) {
+	ctx := context.Background()
+	store := new(memorySessionState)
+	wf := newOrderWorkflow(store)
+
+	newMsg := func(data string) *Message {
+		msg := NewMessageFromString(data)
+		msg.GroupID = ptrString("order-1")
+		return msg
+	}
+
+	assert.NotNil(t, wf.Handle(ctx, newMsg("abc")))
+	assert.JSONEq(t, `{"step":"paid","data":{"items":3}}`, string(store.state))
+
+	// a failing step leaves the state unchanged so the redelivered message is handled by the same step
+	assert.NotNil(t, wf.Handle(ctx, newMsg("fail")))
+	assert.JSONEq(t, `{"step":"paid","data":{"items":3}}`, string(store.state))
+	assert.Equal(t, 1, store.sets)
+
+	assert.NotNil(t, wf.Handle(ctx, newMsg("ok")))
+	assert.Nil(t, store.state, "a completed instance clears the session state")
+	assert.Equal(t, 2, store.sets)
+}
+
+func TestWorkflow_UnknownStep(t *testing.T) {
+	store := &memorySessionState{state: []byte(`{"step":"shipped"}`)}
+	wf := newOrderWorkflow(store)
+	assert.NotNil(t, wf.Handle(context.Background(), NewMessageFromString("abc")))
+	assert.Equal(t, 0, store.sets)
+}
+
+func TestMessageSessionFromContext(t *testing.T) {
+	_, ok := MessageSessionFromContext(context.Background())
+	assert.False(t, ok)
+
+	ms := new(MessageSession)
+	got, ok := MessageSessionFromContext(context.WithValue(context.Background(), messageSessionKey{}, ms))
+	assert.True(t, ok)
+	assert.Equal(t, ms, got)
+}